@@ -0,0 +1,81 @@
+/**
+ * Annotation Store Builder
+ *
+ * Builds the local ClinVar / gnomAD / COSMIC snapshot used for variant
+ * context instead of the remote APIs. The server opens it when
+ * ANNOTATION_STORE points at it.
+ *
+ * ClinVar and gnomAD VCFs must be position-sorted (bcftools sort); gnomAD
+ * may be given as one file per chromosome. COSMIC accepts the mutation
+ * export TSV or CosmicCodingMuts VCF.
+ *
+ * Usage:
+ *   go run main.go -clinvar clinvar.vcf.gz \
+ *     -gnomad gnomad.genomes.chr1.vcf.bgz,gnomad.genomes.chr2.vcf.bgz \
+ *     -cosmic Cosmic_GenomeScreensMutant.tsv.gz -out annotations.gva
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"genomevedic/internal/ai"
+)
+
+func main() {
+	clinVar := flag.String("clinvar", "", "ClinVar VCF files (comma-separated)")
+	gnomAD := flag.String("gnomad", "", "gnomAD sites VCF files (comma-separated)")
+	cosmic := flag.String("cosmic", "", "COSMIC mutation export TSV or VCF files (comma-separated)")
+	hotspotSamples := flag.Int("hotspot-samples", 25, "COSMIC samples per codon for a hotspot")
+	outPath := flag.String("out", "", "Output store file")
+	flag.Parse()
+
+	if *outPath == "" || (*clinVar == "" && *gnomAD == "" && *cosmic == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	start := time.Now()
+	builder, err := ai.CreateAnnotationStore(*outPath)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	builder.HotspotSamples = *hotspotSamples
+
+	inputs := []struct {
+		source ai.AnnotationSource
+		paths  string
+	}{
+		{ai.SourceClinVar, *clinVar},
+		{ai.SourceGnomAD, *gnomAD},
+		{ai.SourceCOSMIC, *cosmic},
+	}
+	for _, input := range inputs {
+		for _, path := range strings.Split(input.paths, ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			fmt.Printf("Loading %s from %s...\n", input.source, path)
+			count, err := builder.IngestFile(input.source, path)
+			if err != nil {
+				builder.Discard()
+				fmt.Printf("ERROR: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("  %d records\n", count)
+		}
+	}
+
+	if err := builder.Close(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Wrote %s in %v\n", *outPath, time.Since(start).Round(time.Millisecond))
+}
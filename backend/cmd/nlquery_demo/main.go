@@ -22,10 +22,10 @@ import (
 )
 
 func main() {
-	// Check for API key
+	// Without an API key the engine uses offline rule-based translation
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable not set")
+		log.Println("OPENAI_API_KEY not set: using offline rule-based translation")
 	}
 
 	fmt.Println("╔══════════════════════════════════════════════════════════════╗")
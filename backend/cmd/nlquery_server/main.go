@@ -4,7 +4,7 @@
  * Runs the GenomeVedic API server for natural language queries
  *
  * Usage:
- *   export OPENAI_API_KEY="your-api-key"
+ *   export OPENAI_API_KEY="your-api-key"   # optional; offline translation without it
  *   go run main.go
  */
 
@@ -26,11 +26,6 @@ func main() {
 	port := flag.Int("port", 8080, "Port to run the server on")
 	flag.Parse()
 
-	// Check for OpenAI API key
-	if os.Getenv("OPENAI_API_KEY") == "" {
-		log.Fatal("OPENAI_API_KEY environment variable not set")
-	}
-
 	// Create server
 	server, err := api.NewServer(*port)
 	if err != nil {
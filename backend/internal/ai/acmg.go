@@ -0,0 +1,659 @@
+/**
+ * ACMG/AMP Variant Classification
+ *
+ * Deterministic evaluation of the ACMG/AMP 2015 germline criteria
+ * (Richards et al., Genet Med 17:405) that can be decided from the data in
+ * VariantContext, with ClinGen SVI refinements:
+ *
+ * - PVS1  Null variant (nonsense, frameshift, canonical splice, start loss)
+ *         in a gene where loss of function causes disease
+ * - PM1   Missense variant at a COSMIC mutational hotspot
+ * - PM2   Absent or extremely rare in gnomAD (applied at Supporting)
+ * - PM4   In-frame indel or stop loss changing protein length
+ * - PP3 / BP4  Calibrated REVEL thresholds (Pejaver et al. 2022) for
+ *         missense variants, otherwise SpliceAI
+ * - PP5 / BP6  ClinVar assertion with at least multiple concordant submitters
+ * - BA1   Allele frequency above 5% (stand-alone benign)
+ * - BS1   Allele frequency greater than expected for the disorder
+ * - BP7   Synonymous variant with no predicted splice impact
+ *
+ * Criteria are combined with the 2015 rules (Table 5). Criteria met at a
+ * modified strength (e.g. PP3 at Strong) count at that strength. When both
+ * pathogenic and benign rules are satisfied the variant is Uncertain.
+ *
+ * Every met criterion carries the evidence it was decided from, so a
+ * classification can be audited and the LLM only writes the narrative.
+ */
+
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"genomevedic/internal/mutations"
+)
+
+// ACMGStrength is the weight of a criterion
+type ACMGStrength int
+
+const (
+	StrengthSupporting ACMGStrength = iota
+	StrengthModerate
+	StrengthStrong
+	StrengthVeryStrong
+	StrengthStandAlone
+)
+
+// String returns the strength name
+func (s ACMGStrength) String() string {
+	switch s {
+	case StrengthSupporting:
+		return "Supporting"
+	case StrengthModerate:
+		return "Moderate"
+	case StrengthStrong:
+		return "Strong"
+	case StrengthVeryStrong:
+		return "Very Strong"
+	case StrengthStandAlone:
+		return "Stand-alone"
+	}
+	return "Unknown"
+}
+
+// MarshalText encodes the strength by name in JSON
+func (s ACMGStrength) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ACMG/AMP classifications
+const (
+	ClassPathogenic       = "Pathogenic"
+	ClassLikelyPathogenic = "Likely pathogenic"
+	ClassUncertain        = "Uncertain significance"
+	ClassLikelyBenign     = "Likely benign"
+	ClassBenign           = "Benign"
+)
+
+// ACMGEvidence is a data point a criterion was decided from
+type ACMGEvidence struct {
+	Source    string `json:"source"`              // "ClinVar", "gnomAD", "COSMIC", "PubMed", "REVEL", ...
+	Detail    string `json:"detail"`              // Human-readable value
+	Reference string `json:"reference,omitempty"` // Identifier, e.g. gnomAD variant ID or PMID
+}
+
+// ACMGCriterion is an evaluated criterion
+type ACMGCriterion struct {
+	Code       string         `json:"code"` // "PVS1", "PM2", ...
+	Pathogenic bool           `json:"pathogenic"`
+	Strength   ACMGStrength   `json:"strength"`
+	Met        bool           `json:"met"`
+	Rationale  string         `json:"rationale"`
+	Evidence   []ACMGEvidence `json:"evidence,omitempty"`
+}
+
+// Label returns the code with the ClinGen strength suffix when the
+// criterion is applied at a non-default strength: "PP3_Strong"
+func (c *ACMGCriterion) Label() string {
+	if c.Strength != defaultStrength(c.Code) {
+		return c.Code + "_" + strings.ReplaceAll(c.Strength.String(), " ", "")
+	}
+	return c.Code
+}
+
+// defaultStrength returns the strength a code carries in the 2015 rules
+func defaultStrength(code string) ACMGStrength {
+	switch {
+	case code == "BA1":
+		return StrengthStandAlone
+	case strings.HasPrefix(code, "PVS"):
+		return StrengthVeryStrong
+	case strings.HasPrefix(code, "PS"), strings.HasPrefix(code, "BS"):
+		return StrengthStrong
+	case strings.HasPrefix(code, "PM"):
+		return StrengthModerate
+	}
+	return StrengthSupporting
+}
+
+// ACMGResult is a classification with the criteria behind it
+type ACMGResult struct {
+	Classification string           `json:"classification"`
+	Rule           string           `json:"rule"`        // Combining rule that fired
+	Conflicting    bool             `json:"conflicting"` // Both pathogenic and benign rules met
+	Consequence    string           `json:"consequence"` // Sequence Ontology term evaluated
+	Criteria       []*ACMGCriterion `json:"criteria"`    // Met criteria
+	NotMet         []*ACMGCriterion `json:"not_met"`     // Evaluated but not met, with reasons
+	Literature     []ACMGEvidence   `json:"literature,omitempty"`
+}
+
+// Codes returns the labels of the met criteria: ["PVS1", "PM2_Supporting"]
+func (r *ACMGResult) Codes() []string {
+	codes := make([]string, len(r.Criteria))
+	for i, criterion := range r.Criteria {
+		codes[i] = criterion.Label()
+	}
+	return codes
+}
+
+// ClassificationRequest is a variant to classify. Consequence (a Sequence
+// Ontology term) is inferred from the protein change when empty; REVEL and
+// SpliceAI scores are optional in-silico predictions.
+type ClassificationRequest struct {
+	VariantInput
+	Consequence string   `json:"consequence,omitempty"`
+	REVEL       *float64 `json:"revel,omitempty"`
+	SpliceAI    *float64 `json:"spliceai,omitempty"` // Maximum delta score
+	Narrative   bool     `json:"narrative"`          // Ask the LLM for a narrative
+}
+
+// ACMGOptions configures thresholds that depend on the disease context
+type ACMGOptions struct {
+	BA1Frequency float64 // Stand-alone benign above this AF (default 0.05)
+	BS1Frequency float64 // Strong benign above this AF (default 0.01)
+	PM2Frequency float64 // Rare below this AF (default 0.0001)
+
+	// LossOfFunctionGenes are genes where loss of function is an
+	// established disease mechanism (PVS1)
+	LossOfFunctionGenes map[string]bool
+
+	// UseClinVar applies PP5/BP6 from ClinVar assertions. ClinGen SVI
+	// recommends against them when the submitters' evidence is available.
+	UseClinVar bool
+}
+
+// DefaultLossOfFunctionGenes are haploinsufficient cancer predisposition
+// genes (ClinGen haploinsufficiency score 3)
+var DefaultLossOfFunctionGenes = []string{
+	"APC", "ATM", "BAP1", "BMPR1A", "BRCA1", "BRCA2", "BRIP1", "CDH1", "CHEK2",
+	"DICER1", "FH", "MEN1", "MLH1", "MSH2", "MSH6", "NF1", "NF2", "PALB2",
+	"PMS2", "PTCH1", "PTEN", "RAD51C", "RAD51D", "RB1", "SDHB", "SDHD",
+	"SMAD4", "SMARCB1", "STK11", "TP53", "TSC1", "TSC2", "VHL", "WT1",
+}
+
+// DefaultACMGOptions returns general-purpose thresholds
+func DefaultACMGOptions() ACMGOptions {
+	genes := make(map[string]bool, len(DefaultLossOfFunctionGenes))
+	for _, gene := range DefaultLossOfFunctionGenes {
+		genes[gene] = true
+	}
+	return ACMGOptions{
+		BA1Frequency:        0.05,
+		BS1Frequency:        0.01,
+		PM2Frequency:        0.0001,
+		LossOfFunctionGenes: genes,
+		UseClinVar:          true,
+	}
+}
+
+// REVEL calibration (Pejaver et al., Am J Hum Genet 2022)
+var (
+	revelPathogenic = []struct {
+		threshold float64
+		strength  ACMGStrength
+	}{{0.932, StrengthStrong}, {0.773, StrengthModerate}, {0.644, StrengthSupporting}}
+	revelBenign = []struct {
+		threshold float64
+		strength  ACMGStrength
+	}{{0.003, StrengthVeryStrong}, {0.016, StrengthStrong}, {0.183, StrengthModerate}, {0.290, StrengthSupporting}}
+)
+
+// SpliceAI delta score cut-offs (ClinGen SVI splicing subgroup)
+const (
+	spliceAIImpact   = 0.2
+	spliceAINoImpact = 0.1
+)
+
+// Sequence Ontology consequences evaluated by the engine
+const (
+	consequenceStopGained = "stop_gained"
+	consequenceFrameshift = "frameshift_variant"
+	consequenceSplice     = "splice_donor_variant"
+	consequenceAcceptor   = "splice_acceptor_variant"
+	consequenceStartLost  = "start_lost"
+	consequenceStopLost   = "stop_lost"
+	consequenceInframeDel = "inframe_deletion"
+	consequenceInframeIns = "inframe_insertion"
+	consequenceMissense   = "missense_variant"
+	consequenceSynonymous = "synonymous_variant"
+)
+
+// ACMGEngine evaluates ACMG/AMP criteria. Safe for concurrent use.
+type ACMGEngine struct {
+	options ACMGOptions
+}
+
+// NewACMGEngine creates an engine with the given thresholds
+func NewACMGEngine(options ACMGOptions) *ACMGEngine {
+	return &ACMGEngine{options: options}
+}
+
+// Evaluate classifies a variant from its retrieved context
+func (e *ACMGEngine) Evaluate(request ClassificationRequest, context *VariantContext) *ACMGResult {
+	if context == nil {
+		context = &VariantContext{}
+	}
+	consequence := request.Consequence
+	if consequence == "" {
+		consequence = InferConsequence(request.Variant)
+	}
+	consequence, _, _ = strings.Cut(consequence, "&")
+
+	result := &ACMGResult{Consequence: consequence}
+	evaluations := []*ACMGCriterion{
+		e.pvs1(request, consequence),
+		e.pm1(consequence, context.COSMIC),
+		e.pm4(consequence),
+	}
+	evaluations = append(evaluations, e.frequency(request.VariantInput, context.GnomAD)...)
+	evaluations = append(evaluations, e.inSilico(request, consequence)...)
+	evaluations = append(evaluations, e.bp7(request, consequence))
+	if e.options.UseClinVar {
+		evaluations = append(evaluations, e.clinVar(context.ClinVar))
+	}
+
+	for _, criterion := range evaluations {
+		if criterion == nil {
+			continue
+		}
+		if criterion.Met {
+			result.Criteria = append(result.Criteria, criterion)
+		} else {
+			result.NotMet = append(result.NotMet, criterion)
+		}
+	}
+	result.Classification, result.Rule, result.Conflicting = combineCriteria(result.Criteria)
+
+	if context.PubMed != nil {
+		for _, citation := range context.PubMed.Citations {
+			result.Literature = append(result.Literature, ACMGEvidence{
+				Source:    "PubMed",
+				Detail:    strings.TrimSpace(fmt.Sprintf("%s %s (%s)", citation.Title, citation.Journal, citation.Year)),
+				Reference: "PMID:" + citation.PMID,
+			})
+		}
+	}
+	return result
+}
+
+// ClassifyVariant retrieves a variant's context and classifies it without
+// an LLM; request.Narrative is ignored (see ChatGPTInterpreter.ClassifyVariant)
+func ClassifyVariant(ctx context.Context, retriever *ContextRetriever, engine *ACMGEngine, request ClassificationRequest) (*ClassificationResponse, error) {
+	startTime := time.Now()
+	variantContext, err := retriever.GetVariantContext(ctx, request.VariantInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve variant context: %w", err)
+	}
+	return &ClassificationResponse{
+		Classification: engine.Evaluate(request, variantContext),
+		Context:        variantContext,
+		ResponseTime:   time.Since(startTime),
+	}, nil
+}
+
+// InferConsequence derives a Sequence Ontology consequence from a protein
+// or coding change: "R175H" -> missense_variant, "p.Arg213Ter" ->
+// stop_gained, "c.5266dupC"/"E1756fs" -> frameshift_variant,
+// "c.4357+1G>A" -> splice_donor_variant. Returns "" when unknown.
+func InferConsequence(change string) string {
+	change = strings.TrimSpace(change)
+	if coding, ok := strings.CutPrefix(change, "c."); ok {
+		// Canonical splice sites: c.N+1, c.N+2 (donor), c.N-1, c.N-2 (acceptor)
+		for _, site := range []struct{ marker, consequence string }{
+			{"+1", consequenceSplice}, {"+2", consequenceSplice},
+			{"-1", consequenceAcceptor}, {"-2", consequenceAcceptor},
+		} {
+			if i := strings.Index(coding, site.marker); i > 0 && i+2 < len(coding) && !isDigit(coding[i+2]) {
+				return site.consequence
+			}
+		}
+		return ""
+	}
+
+	short := mutations.ShortProteinChange(change)
+	switch {
+	case short == "":
+		return ""
+	case strings.Contains(short, "fs"):
+		return consequenceFrameshift
+	case strings.Contains(short, "ext"):
+		return consequenceStopLost
+	case strings.Contains(short, "delins"), strings.Contains(short, "ins"), strings.Contains(short, "dup"):
+		return consequenceInframeIns
+	case strings.Contains(short, "del"):
+		return consequenceInframeDel
+	case strings.HasSuffix(short, "="):
+		return consequenceSynonymous
+	}
+
+	// Single residue substitution: ref, position, alt
+	end := 1
+	for end < len(short) && isDigit(short[end]) {
+		end++
+	}
+	if end == 1 || end != len(short)-1 {
+		return ""
+	}
+	ref, position, alt := short[0], short[1:end], short[end]
+	switch {
+	case ref == alt:
+		return consequenceSynonymous
+	case alt == '*':
+		return consequenceStopGained
+	case ref == '*':
+		return consequenceStopLost
+	case ref == 'M' && position == "1":
+		return consequenceStartLost
+	}
+	return consequenceMissense
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isNull reports whether a consequence is a loss-of-function change
+func isNull(consequence string) bool {
+	switch consequence {
+	case consequenceStopGained, consequenceFrameshift, consequenceSplice, consequenceAcceptor, consequenceStartLost:
+		return true
+	}
+	return false
+}
+
+// pvs1 evaluates null variants in loss-of-function genes
+func (e *ACMGEngine) pvs1(request ClassificationRequest, consequence string) *ACMGCriterion {
+	criterion := &ACMGCriterion{Code: "PVS1", Pathogenic: true, Strength: StrengthVeryStrong}
+	gene := strings.ToUpper(request.Gene)
+	switch {
+	case !isNull(consequence):
+		return nil
+	case !e.options.LossOfFunctionGenes[gene]:
+		criterion.Rationale = fmt.Sprintf("%s is a null variant, but loss of function is not an established disease mechanism for %s", consequence, gene)
+	default:
+		criterion.Met = true
+		criterion.Rationale = fmt.Sprintf("%s in %s, a gene where loss of function causes disease", consequence, gene)
+		criterion.Evidence = []ACMGEvidence{{Source: "Consequence", Detail: fmt.Sprintf("%s %s", gene, request.Variant)}}
+	}
+	return criterion
+}
+
+// pm1 evaluates missense variants at somatic hotspots
+func (e *ACMGEngine) pm1(consequence string, cosmic *COSMICData) *ACMGCriterion {
+	if consequence != consequenceMissense {
+		return nil
+	}
+	criterion := &ACMGCriterion{Code: "PM1", Pathogenic: true, Strength: StrengthModerate}
+	switch {
+	case cosmic == nil || !cosmic.Found:
+		criterion.Rationale = "No COSMIC data for the variant"
+	case !cosmic.IsHotspot:
+		criterion.Rationale = fmt.Sprintf("Observed in %d COSMIC samples, not at a recognised hotspot", cosmic.Frequency)
+	default:
+		criterion.Met = true
+		criterion.Rationale = "Missense variant at a mutational hotspot"
+		criterion.Evidence = []ACMGEvidence{{
+			Source: "COSMIC",
+			Detail: fmt.Sprintf("Hotspot; %d samples (%s)", cosmic.Frequency, cosmic.CancerAssociation),
+		}}
+	}
+	return criterion
+}
+
+// pm4 evaluates protein length changes
+func (e *ACMGEngine) pm4(consequence string) *ACMGCriterion {
+	switch consequence {
+	case consequenceInframeDel, consequenceInframeIns, consequenceStopLost:
+		return &ACMGCriterion{
+			Code:       "PM4",
+			Pathogenic: true,
+			Strength:   StrengthModerate,
+			Met:        true,
+			Rationale:  fmt.Sprintf("Protein length change (%s); not checked against repeat regions", consequence),
+			Evidence:   []ACMGEvidence{{Source: "Consequence", Detail: consequence}},
+		}
+	}
+	return nil
+}
+
+// frequency evaluates BA1, BS1 and PM2 from gnomAD. The highest
+// population AF is used when known. Absence (PM2) is only evaluated when
+// the allele was looked up by its coordinates.
+func (e *ACMGEngine) frequency(input VariantInput, gnomAD *GnomADData) []*ACMGCriterion {
+	notEvaluated := func(rationale string) []*ACMGCriterion {
+		return []*ACMGCriterion{{Code: "PM2", Pathogenic: true, Strength: StrengthSupporting, Rationale: "Not evaluated: " + rationale}}
+	}
+	switch {
+	case !input.HasCoordinates() && (gnomAD == nil || !gnomAD.Found):
+		return notEvaluated("population frequency needs chromosome, position, ref and alt alleles")
+	case gnomAD == nil:
+		return notEvaluated("gnomAD was not available")
+	case !gnomAD.Found && !gnomAD.Queried:
+		return notEvaluated("the gnomAD lookup did not complete")
+	}
+
+	af, population := gnomAD.AlleleFrequency, "overall"
+	if gnomAD.PopulationMaxAF > af {
+		af, population = gnomAD.PopulationMaxAF, gnomAD.PopulationMaxName
+	}
+	evidence := []ACMGEvidence{{
+		Source:    "gnomAD",
+		Detail:    fmt.Sprintf("AF %.6g, %s AF %.6g, %d homozygotes", gnomAD.AlleleFrequency, population, af, gnomAD.HomozygoteCount),
+		Reference: fmt.Sprintf("%s-%d-%s-%s", normalizeChromosome(input.Chromosome), input.Position, input.RefAllele, input.AltAllele),
+	}}
+	if !gnomAD.Found {
+		evidence = []ACMGEvidence{{Source: "gnomAD", Detail: "Absent"}}
+	}
+
+	ba1 := &ACMGCriterion{Code: "BA1", Strength: StrengthStandAlone, Evidence: evidence}
+	bs1 := &ACMGCriterion{Code: "BS1", Strength: StrengthStrong, Evidence: evidence}
+	pm2 := &ACMGCriterion{Code: "PM2", Pathogenic: true, Strength: StrengthSupporting, Evidence: evidence}
+
+	switch {
+	case !gnomAD.Found:
+		pm2.Met = true
+		pm2.Rationale = "Absent from gnomAD"
+		return []*ACMGCriterion{pm2}
+	case af > e.options.BA1Frequency:
+		ba1.Met = true
+		ba1.Rationale = fmt.Sprintf("%s AF %.4g exceeds %.4g", population, af, e.options.BA1Frequency)
+		return []*ACMGCriterion{ba1}
+	case af > e.options.BS1Frequency:
+		bs1.Met = true
+		bs1.Rationale = fmt.Sprintf("%s AF %.4g exceeds %.4g expected for the disorder", population, af, e.options.BS1Frequency)
+		return []*ACMGCriterion{bs1}
+	case af < e.options.PM2Frequency:
+		pm2.Met = true
+		pm2.Rationale = fmt.Sprintf("Extremely rare: %s AF %.4g below %.4g", population, af, e.options.PM2Frequency)
+		return []*ACMGCriterion{pm2}
+	}
+	pm2.Rationale = fmt.Sprintf("%s AF %.4g is too common for PM2 and too rare for BS1", population, af)
+	return []*ACMGCriterion{pm2}
+}
+
+// inSilico evaluates PP3/BP4: calibrated REVEL for missense variants,
+// otherwise SpliceAI. Not applied with PVS1 (ClinGen SVI).
+func (e *ACMGEngine) inSilico(request ClassificationRequest, consequence string) []*ACMGCriterion {
+	if isNull(consequence) {
+		return nil
+	}
+
+	if consequence == consequenceMissense && request.REVEL != nil {
+		score := *request.REVEL
+		evidence := []ACMGEvidence{{Source: "REVEL", Detail: fmt.Sprintf("%.3f", score)}}
+		for _, level := range revelPathogenic {
+			if score >= level.threshold {
+				return []*ACMGCriterion{{
+					Code: "PP3", Pathogenic: true, Strength: level.strength, Met: true, Evidence: evidence,
+					Rationale: fmt.Sprintf("REVEL %.3f >= %.3f", score, level.threshold),
+				}}
+			}
+		}
+		for _, level := range revelBenign {
+			if score <= level.threshold {
+				return []*ACMGCriterion{{
+					Code: "BP4", Strength: level.strength, Met: true, Evidence: evidence,
+					Rationale: fmt.Sprintf("REVEL %.3f <= %.3f", score, level.threshold),
+				}}
+			}
+		}
+		return []*ACMGCriterion{{
+			Code: "PP3", Pathogenic: true, Strength: StrengthSupporting, Evidence: evidence,
+			Rationale: fmt.Sprintf("REVEL %.3f is in the indeterminate range", score),
+		}}
+	}
+
+	if request.SpliceAI != nil {
+		score := *request.SpliceAI
+		evidence := []ACMGEvidence{{Source: "SpliceAI", Detail: fmt.Sprintf("max delta %.2f", score)}}
+		switch {
+		case score >= spliceAIImpact:
+			return []*ACMGCriterion{{
+				Code: "PP3", Pathogenic: true, Strength: StrengthSupporting, Met: true, Evidence: evidence,
+				Rationale: fmt.Sprintf("SpliceAI %.2f >= %.2f predicts a splicing impact", score, spliceAIImpact),
+			}}
+		case score <= spliceAINoImpact && consequence != consequenceMissense:
+			return []*ACMGCriterion{{
+				Code: "BP4", Strength: StrengthSupporting, Met: true, Evidence: evidence,
+				Rationale: fmt.Sprintf("SpliceAI %.2f <= %.2f predicts no splicing impact", score, spliceAINoImpact),
+			}}
+		}
+	}
+	return []*ACMGCriterion{{Code: "PP3", Pathogenic: true, Strength: StrengthSupporting, Rationale: "No informative in-silico prediction"}}
+}
+
+// bp7 evaluates synonymous variants without a predicted splicing impact
+func (e *ACMGEngine) bp7(request ClassificationRequest, consequence string) *ACMGCriterion {
+	if consequence != consequenceSynonymous {
+		return nil
+	}
+	criterion := &ACMGCriterion{Code: "BP7", Strength: StrengthSupporting}
+	switch {
+	case request.SpliceAI == nil:
+		criterion.Rationale = "Synonymous, but no splicing prediction was provided"
+	case *request.SpliceAI > spliceAINoImpact:
+		criterion.Rationale = fmt.Sprintf("Synonymous, but SpliceAI %.2f does not exclude a splicing impact", *request.SpliceAI)
+	default:
+		criterion.Met = true
+		criterion.Rationale = "Synonymous with no predicted splicing impact"
+		criterion.Evidence = []ACMGEvidence{{Source: "SpliceAI", Detail: fmt.Sprintf("max delta %.2f", *request.SpliceAI)}}
+	}
+	return criterion
+}
+
+// clinVar evaluates PP5/BP6 from assertions with concordant submitters
+func (e *ACMGEngine) clinVar(clinVar *ClinVarData) *ACMGCriterion {
+	if clinVar == nil || !clinVar.Found {
+		return nil
+	}
+	significance := strings.ToLower(clinVar.Pathogenicity)
+	review := strings.ToLower(clinVar.ReviewStatus)
+
+	criterion := &ACMGCriterion{Code: "PP5", Pathogenic: true, Strength: StrengthSupporting}
+	if strings.Contains(significance, "benign") && !strings.Contains(significance, "pathogenic") {
+		criterion = &ACMGCriterion{Code: "BP6", Strength: StrengthSupporting}
+	}
+	evidence := ACMGEvidence{
+		Source: "ClinVar",
+		Detail: fmt.Sprintf("%s (%s)", clinVar.Pathogenicity, clinVar.ReviewStatus),
+	}
+	if clinVar.LastEvaluated != "" {
+		evidence.Detail += ", " + clinVar.LastEvaluated
+	}
+	criterion.Evidence = []ACMGEvidence{evidence}
+
+	concordant := strings.Contains(review, "expert panel") || strings.Contains(review, "practice guideline") ||
+		(strings.Contains(review, "multiple submitters") && strings.Contains(review, "no conflicts"))
+	switch {
+	case strings.Contains(significance, "conflicting") || strings.Contains(significance, "uncertain"):
+		criterion.Rationale = "ClinVar assertion is not conclusive"
+	case !strings.Contains(significance, "pathogenic") && !strings.Contains(significance, "benign"):
+		criterion.Rationale = "ClinVar has no pathogenicity assertion"
+	case !concordant:
+		criterion.Rationale = "ClinVar assertion lacks concordant multiple-submitter or expert review"
+	default:
+		criterion.Met = true
+		criterion.Rationale = "Reputable source reports the variant as " + clinVar.Pathogenicity
+	}
+	return criterion
+}
+
+// combineCriteria applies the ACMG/AMP 2015 combining rules
+func combineCriteria(criteria []*ACMGCriterion) (string, string, bool) {
+	var pvs, ps, pm, pp, ba, bs, bp int
+	for _, c := range criteria {
+		switch {
+		case c.Pathogenic && c.Strength >= StrengthVeryStrong:
+			pvs++
+		case c.Pathogenic && c.Strength == StrengthStrong:
+			ps++
+		case c.Pathogenic && c.Strength == StrengthModerate:
+			pm++
+		case c.Pathogenic:
+			pp++
+		case c.Strength == StrengthStandAlone:
+			ba++
+		case c.Strength >= StrengthStrong:
+			bs++
+		default:
+			bp++
+		}
+	}
+
+	pathogenic, pathogenicRule := "", ""
+	switch {
+	case pvs >= 1 && ps >= 1:
+		pathogenic, pathogenicRule = ClassPathogenic, "PVS + >=1 PS"
+	case pvs >= 1 && pm >= 2:
+		pathogenic, pathogenicRule = ClassPathogenic, "PVS + >=2 PM"
+	case pvs >= 1 && pm == 1 && pp >= 1:
+		pathogenic, pathogenicRule = ClassPathogenic, "PVS + PM + PP"
+	case pvs >= 1 && pp >= 2:
+		pathogenic, pathogenicRule = ClassPathogenic, "PVS + >=2 PP"
+	case ps >= 2:
+		pathogenic, pathogenicRule = ClassPathogenic, ">=2 PS"
+	case ps == 1 && pm >= 3:
+		pathogenic, pathogenicRule = ClassPathogenic, "PS + >=3 PM"
+	case ps == 1 && pm == 2 && pp >= 2:
+		pathogenic, pathogenicRule = ClassPathogenic, "PS + 2 PM + >=2 PP"
+	case ps == 1 && pm == 1 && pp >= 4:
+		pathogenic, pathogenicRule = ClassPathogenic, "PS + PM + >=4 PP"
+	case pvs >= 1 && pm == 1:
+		pathogenic, pathogenicRule = ClassLikelyPathogenic, "PVS + PM"
+	case ps == 1 && pm >= 1:
+		pathogenic, pathogenicRule = ClassLikelyPathogenic, "PS + 1-2 PM"
+	case ps == 1 && pp >= 2:
+		pathogenic, pathogenicRule = ClassLikelyPathogenic, "PS + >=2 PP"
+	case pm >= 3:
+		pathogenic, pathogenicRule = ClassLikelyPathogenic, ">=3 PM"
+	case pm == 2 && pp >= 2:
+		pathogenic, pathogenicRule = ClassLikelyPathogenic, "2 PM + >=2 PP"
+	case pm == 1 && pp >= 4:
+		pathogenic, pathogenicRule = ClassLikelyPathogenic, "PM + >=4 PP"
+	}
+
+	benign, benignRule := "", ""
+	switch {
+	case ba >= 1:
+		benign, benignRule = ClassBenign, "BA1"
+	case bs >= 2:
+		benign, benignRule = ClassBenign, ">=2 BS"
+	case bs == 1 && bp >= 1:
+		benign, benignRule = ClassLikelyBenign, "BS + BP"
+	case bp >= 2:
+		benign, benignRule = ClassLikelyBenign, ">=2 BP"
+	}
+
+	switch {
+	case pathogenic != "" && benign != "":
+		return ClassUncertain, pathogenicRule + " conflicts with " + benignRule, true
+	case pathogenic != "":
+		return pathogenic, pathogenicRule, false
+	case benign != "":
+		return benign, benignRule, false
+	}
+	return ClassUncertain, "criteria for another classification not met", false
+}
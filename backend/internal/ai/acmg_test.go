@@ -0,0 +1,245 @@
+/**
+ * ACMG Engine Tests
+ *
+ * Evaluates criteria and combining rules against hand-built variant context
+ */
+
+package ai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+// TestInferConsequence maps protein and coding changes to SO terms
+func TestInferConsequence(t *testing.T) {
+	tests := map[string]string{
+		"R175H":             "missense_variant",
+		"p.Arg175His":       "missense_variant",
+		"p.Arg213Ter":       "stop_gained",
+		"R213*":             "stop_gained",
+		"p.Glu1756fs":       "frameshift_variant",
+		"p.Arg97ProfsTer23": "frameshift_variant",
+		"c.4357+1G>A":       "splice_donor_variant",
+		"c.4358-2A>G":       "splice_acceptor_variant",
+		"c.4357+12G>A":      "",
+		"p.Met1?":           "start_lost",
+		"p.Ter394Glnext*17": "stop_lost",
+		"p.Phe508del":       "inframe_deletion",
+		"p.Leu23_Val24dup":  "inframe_insertion",
+		"p.Gly12=":          "synonymous_variant",
+		"":                  "",
+	}
+	for change, want := range tests {
+		if got := InferConsequence(change); got != want {
+			t.Errorf("InferConsequence(%q) = %q, want %q", change, got, want)
+		}
+	}
+}
+
+// TestACMGClassifications checks the combining rules end to end
+func TestACMGClassifications(t *testing.T) {
+	engine := NewACMGEngine(DefaultACMGOptions())
+	absent := &GnomADData{Found: false, Queried: true, PopulationMaxName: "Unknown"}
+	expertPathogenic := &ClinVarData{Found: true, Pathogenicity: "Pathogenic", ReviewStatus: "reviewed by expert panel"}
+
+	tests := []struct {
+		name      string
+		request   ClassificationRequest
+		context   *VariantContext
+		want      string
+		wantCodes []string
+	}{
+		{
+			name:      "nonsense in a tumour suppressor",
+			request:   ClassificationRequest{VariantInput: VariantInput{Gene: "TP53", Variant: "R213*", Chromosome: "17", Position: 7674221, RefAllele: "G", AltAllele: "A"}},
+			context:   &VariantContext{GnomAD: absent, ClinVar: expertPathogenic},
+			want:      ClassPathogenic,
+			wantCodes: []string{"PVS1", "PM2_Supporting", "PP5"},
+		},
+		{
+			name:      "nonsense outside loss-of-function genes",
+			request:   ClassificationRequest{VariantInput: VariantInput{Gene: "KRAS", Variant: "Q22*", Chromosome: "12", Position: 25245287, RefAllele: "G", AltAllele: "A"}},
+			context:   &VariantContext{GnomAD: absent},
+			want:      ClassUncertain,
+			wantCodes: []string{"PM2_Supporting"},
+		},
+		{
+			name:      "absence without coordinates is not evidence",
+			request:   ClassificationRequest{VariantInput: VariantInput{Gene: "TP53", Variant: "R213*"}},
+			context:   &VariantContext{GnomAD: &GnomADData{Found: false, PopulationMaxName: "Unknown"}, ClinVar: expertPathogenic},
+			want:      ClassUncertain,
+			wantCodes: []string{"PVS1", "PP5"},
+		},
+		{
+			name:      "failed gnomAD lookup is not absence",
+			request:   ClassificationRequest{VariantInput: VariantInput{Gene: "KRAS", Variant: "Q22*", Chromosome: "12", Position: 25245287, RefAllele: "G", AltAllele: "A"}},
+			context:   &VariantContext{GnomAD: &GnomADData{Found: false}},
+			want:      ClassUncertain,
+			wantCodes: []string{},
+		},
+		{
+			name: "hotspot missense with strong in-silico evidence",
+			request: ClassificationRequest{
+				VariantInput: VariantInput{Gene: "TP53", Variant: "R175H"},
+				REVEL:        float(0.95),
+			},
+			context: &VariantContext{
+				GnomAD: &GnomADData{Found: true, AlleleFrequency: 0.000004, PopulationMaxAF: 0.000006, PopulationMaxName: "nfe"},
+				COSMIC: &COSMICData{Found: true, Frequency: 1500, IsHotspot: true},
+			},
+			want:      ClassLikelyPathogenic,
+			wantCodes: []string{"PM1", "PM2_Supporting", "PP3_Strong"},
+		},
+		{
+			name:      "common polymorphism",
+			request:   ClassificationRequest{VariantInput: VariantInput{Gene: "TP53", Variant: "P72R"}, REVEL: float(0.1)},
+			context:   &VariantContext{GnomAD: &GnomADData{Found: true, AlleleFrequency: 0.6, PopulationMaxAF: 0.7, PopulationMaxName: "afr"}},
+			want:      ClassBenign,
+			wantCodes: []string{"BA1", "BP4_Moderate"},
+		},
+		{
+			name: "synonymous without splice impact",
+			request: ClassificationRequest{
+				VariantInput: VariantInput{Gene: "BRCA2", Variant: "p.Ser1982="},
+				SpliceAI:     float(0.02),
+			},
+			context:   &VariantContext{GnomAD: &GnomADData{Found: true, AlleleFrequency: 0.002}},
+			want:      ClassLikelyBenign,
+			wantCodes: []string{"BP4", "BP7"},
+		},
+		{
+			name:      "pathogenic and benign evidence conflict",
+			request:   ClassificationRequest{VariantInput: VariantInput{Gene: "BRCA1", Variant: "p.Gln1756fs"}},
+			context:   &VariantContext{GnomAD: &GnomADData{Found: true, AlleleFrequency: 0.02}, ClinVar: expertPathogenic},
+			want:      ClassUncertain,
+			wantCodes: []string{"PVS1", "BS1", "PP5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := engine.Evaluate(tt.request, tt.context)
+			if result.Classification != tt.want {
+				t.Errorf("classification = %s (%s), want %s", result.Classification, result.Rule, tt.want)
+			}
+			if codes := result.Codes(); !reflect.DeepEqual(codes, tt.wantCodes) {
+				t.Errorf("criteria = %v, want %v", codes, tt.wantCodes)
+			}
+			for _, criterion := range result.Criteria {
+				if len(criterion.Evidence) == 0 {
+					t.Errorf("%s has no evidence", criterion.Code)
+				}
+			}
+		})
+	}
+}
+
+// TestClassifyVariantNarrative passes structured evidence to the LLM and
+// keeps the engine's classification
+func TestClassifyVariantNarrative(t *testing.T) {
+	store := buildTestStore(t)
+	retriever := NewContextRetriever("")
+	retriever.UseAnnotationStore(store, false)
+
+	mock := NewMockProvider("TP53 R175H is classified as likely pathogenic [PM1, PM2_Supporting].")
+	config := DefaultConfig()
+	config.EnableCache = false
+	interpreter := NewChatGPTInterpreterWithProvider(config, mock)
+	interpreter.SetContextRetriever(retriever)
+
+	response, err := interpreter.ClassifyVariant(context.Background(), ClassificationRequest{
+		VariantInput: VariantInput{Gene: "TP53", Variant: "R175H", Chromosome: "17", Position: 7675088, RefAllele: "C", AltAllele: "T"},
+		REVEL:        float(0.95),
+		Narrative:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Classification.Classification != ClassLikelyPathogenic {
+		t.Errorf("classification = %s %v", response.Classification.Classification, response.Classification.Codes())
+	}
+	if response.Narrative == "" {
+		t.Error("expected a narrative")
+	}
+
+	requests := mock.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("got %d LLM requests, want 1", len(requests))
+	}
+	prompt := requests[0].Messages[0].Content
+	for _, want := range []string{"Do not change the classification", "PM1 (Moderate)", "PP3_Strong (Strong)", "ClinVar: Pathogenic/Likely pathogenic", "17-7675088-C-T"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt lacks %q:\n%s", want, prompt)
+		}
+	}
+
+	// Without a narrative the LLM is not called
+	if _, err := interpreter.ClassifyVariant(context.Background(), ClassificationRequest{
+		VariantInput: VariantInput{Gene: "KRAS", Variant: "G12D"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.Requests()) != 1 {
+		t.Error("classification without narrative called the LLM")
+	}
+}
+
+// roundTripFunc serves HTTP requests from a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestGnomADLookupStates separates absence from lookups that did not happen
+func TestGnomADLookupStates(t *testing.T) {
+	r175h := VariantInput{Gene: "TP53", Variant: "R175H", Chromosome: "17", Position: 7675088, RefAllele: "C", AltAllele: "T"}
+	tests := []struct {
+		name      string
+		input     VariantInput
+		status    int
+		body      string
+		found     bool
+		queried   bool
+		requested bool
+	}{
+		{"protein change only", VariantInput{Gene: "TP53", Variant: "R175H"}, 0, "", false, false, false},
+		{"service unavailable", r175h, http.StatusServiceUnavailable, "", false, false, true},
+		{"not in gnomAD", r175h, http.StatusOK, `{"data":{"variant":null},"errors":[{"message":"Variant not found"}]}`, false, true, true},
+		{"invalid variant ID", r175h, http.StatusOK, `{"data":{"variant":null},"errors":[{"message":"Invalid variant ID"}]}`, false, false, true},
+		{"found", r175h, http.StatusOK, `{"data":{"variant":{"variant_id":"17-7675088-C-T","genome":{"af":0.000004,"homozygote_count":0,"populations":[{"id":"nfe","af":0.000006}]}}}}`, true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested := false
+			retriever := NewContextRetriever("")
+			retriever.httpClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				requested = true
+				return &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body)), Header: make(http.Header)}, nil
+			})}
+
+			data, err := retriever.getGnomADData(context.Background(), tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.Found != tt.found || data.Queried != tt.queried || requested != tt.requested {
+				t.Errorf("got %+v (requested %v), want found %v, queried %v, requested %v", data, requested, tt.found, tt.queried, tt.requested)
+			}
+
+			pm2 := NewACMGEngine(DefaultACMGOptions()).frequency(tt.input, data)[0]
+			if evaluated := !strings.HasPrefix(pm2.Rationale, "Not evaluated"); evaluated != (tt.found || tt.queried) {
+				t.Errorf("%s %q evaluated = %v", pm2.Code, pm2.Rationale, evaluated)
+			}
+		})
+	}
+}
@@ -0,0 +1,1249 @@
+/**
+ * Local Annotation Store
+ *
+ * Serves ClinVar, gnomAD and COSMIC annotations from an indexed snapshot
+ * file, so variant context can be retrieved without the NCBI, Clinical
+ * Tables and gnomAD APIs (slow, rate-limited, and unreachable from secured
+ * clusters).
+ *
+ * Sources:
+ * - ClinVar VCF: CLNSIG, CLNREVSTAT, CLNDN; the file date is reported as
+ *   the evaluation date
+ * - gnomAD sites VCFs (whole-genome or per chromosome): AF, nhomalt and
+ *   grpmax/popmax, or the largest AF_<population> when those are absent
+ * - COSMIC mutation exports: the TSV (legacy "Gene name"/"Mutation AA"
+ *   columns or v99 GENE_SYMBOL/MUTATION_AA columns) or CosmicCodingMuts VCF
+ *
+ * Layout:
+ * - Each source is a table of records sorted by position within each
+ *   chromosome, packed into deflate-compressed blocks of ~64 KiB. A position
+ *   never spans two blocks.
+ * - The block index (first position, offset and size of every block) sits in
+ *   the footer and is loaded on open, so a lookup inflates a single block.
+ * - COSMIC protein changes ("TP53 R175H") are indexed to genomic positions in
+ *   a second block table, so inputs without coordinates still resolve.
+ *
+ * ClinVar and gnomAD VCFs are streamed and must be sorted (bcftools sort);
+ * COSMIC exports are aggregated in memory. Build with cmd/annotation_index
+ * and serve through ContextRetriever.UseAnnotationStore.
+ */
+
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"genomevedic/internal/mutations"
+)
+
+const (
+	annotationMagic     = "GVANNOT1"
+	annotationBlockSize = 64 << 10
+	footerSize          = 8 + len(annotationMagic)
+
+	// defaultHotspotSamples is the number of COSMIC samples mutated at a
+	// codon for its variants to be reported as hotspots
+	defaultHotspotSamples = 25
+
+	// maxCancerTypes limits the primary sites reported per variant
+	maxCancerTypes = 5
+)
+
+// AnnotationSource identifies a table in an annotation store
+type AnnotationSource uint8
+
+const (
+	SourceClinVar AnnotationSource = iota
+	SourceGnomAD
+	SourceCOSMIC
+	numAnnotationSources
+)
+
+// String returns the source name
+func (s AnnotationSource) String() string {
+	switch s {
+	case SourceClinVar:
+		return "ClinVar"
+	case SourceGnomAD:
+		return "gnomAD"
+	case SourceCOSMIC:
+		return "COSMIC"
+	}
+	return "unknown"
+}
+
+// ParseAnnotationSource parses a source name (case-insensitive)
+func ParseAnnotationSource(name string) (AnnotationSource, error) {
+	for s := AnnotationSource(0); s < numAnnotationSources; s++ {
+		if strings.EqualFold(name, s.String()) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown annotation source %q (want clinvar, gnomad or cosmic)", name)
+}
+
+// ErrSourceNotLoaded is returned by lookups against a source the store was
+// built without
+var ErrSourceNotLoaded = errors.New("annotation source not in store")
+
+// Record field layouts per source
+const (
+	clinVarSignificance = iota
+	clinVarReviewStatus
+	clinVarConditions // "|"-separated
+	clinVarFileDate
+	clinVarFields
+)
+
+const (
+	gnomADAlleleFrequency = iota
+	gnomADPopMaxAF
+	gnomADPopMaxName
+	gnomADHomozygotes
+	gnomADFields
+)
+
+const (
+	cosmicSamples = iota
+	cosmicSites   // "site=count|..." in descending count order
+	cosmicHotspot
+	cosmicFields
+)
+
+// gnomADPopulations are the genetic ancestry groups searched for the
+// maximum AF when the VCF has no grpmax/popmax fields
+var gnomADPopulations = []string{"afr", "ami", "amr", "asj", "eas", "fin", "mid", "nfe", "sas", "oth", "remaining"}
+
+// annotationKey is a normalised variant: chromosome without "chr", alleles
+// trimmed to their minimal VCF representation. Empty alleles match any.
+type annotationKey struct {
+	Chromosome string
+	Position   uint64
+	Ref        string
+	Alt        string
+}
+
+// newAnnotationKey normalises variant coordinates
+func newAnnotationKey(chromosome string, position uint64, ref, alt string) annotationKey {
+	key := annotationKey{Chromosome: normalizeChromosome(chromosome), Position: position}
+	if ref != "" && alt != "" {
+		key.Position, key.Ref, key.Alt = mutations.TrimAlleles(position, strings.ToUpper(ref), strings.ToUpper(alt))
+	}
+	return key
+}
+
+// withAlleles adds the alleles of a query to a position-only key, so that
+// an input giving only one allele still selects it. A lone allele cannot
+// be trimmed and is compared as given.
+func withAlleles(key annotationKey, ref, alt string) annotationKey {
+	if ref != "" && alt != "" {
+		return newAnnotationKey(key.Chromosome, key.Position, ref, alt)
+	}
+	key.Ref, key.Alt = strings.ToUpper(ref), strings.ToUpper(alt)
+	return key
+}
+
+// matches reports whether a stored key answers a query key
+func (k annotationKey) matches(query annotationKey) bool {
+	return k.Chromosome == query.Chromosome && k.Position == query.Position &&
+		(k.Ref == "" || query.Ref == "" || k.Ref == query.Ref) &&
+		(k.Alt == "" || query.Alt == "" || k.Alt == query.Alt)
+}
+
+// annotationBlock locates a compressed block
+type annotationBlock struct {
+	First  uint64 // First position (genomic tables)
+	Key    string // First key (protein table)
+	Offset uint64
+	Size   uint32
+}
+
+// annotationTable is one source's block index
+type annotationTable struct {
+	chromosomes map[string][]annotationBlock
+	records     uint64
+}
+
+func newAnnotationTable() *annotationTable {
+	return &annotationTable{chromosomes: make(map[string][]annotationBlock)}
+}
+
+// proteinKey builds the protein index key: "TP53 R175H"
+func proteinKey(gene, change string) string {
+	gene, _, _ = strings.Cut(strings.ToUpper(strings.TrimSpace(gene)), "_")
+	return gene + " " + mutations.ShortProteinChange(strings.TrimSpace(change))
+}
+
+// AnnotationStore answers ClinVar, gnomAD and COSMIC lookups from a
+// snapshot file. Safe for concurrent use.
+type AnnotationStore struct {
+	file     *os.File
+	tables   [numAnnotationSources]*annotationTable
+	proteins []annotationBlock
+}
+
+// OpenAnnotationStore opens a store written by AnnotationStoreBuilder
+func OpenAnnotationStore(path string) (*AnnotationStore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open annotation store: %w", err)
+	}
+	store := &AnnotationStore{file: file}
+	if err := store.readIndex(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read annotation store %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Close closes the store file
+func (s *AnnotationStore) Close() error {
+	return s.file.Close()
+}
+
+// Has reports whether the store holds a source
+func (s *AnnotationStore) Has(source AnnotationSource) bool {
+	return source < numAnnotationSources && s.tables[source] != nil
+}
+
+// ClinVar returns the ClinVar classification of a variant
+func (s *AnnotationStore) ClinVar(input VariantInput) (*ClinVarData, error) {
+	fields, err := s.first(SourceClinVar, input)
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return &ClinVarData{Found: false, Pathogenicity: "Unknown", ReviewStatus: "No data available"}, nil
+	}
+
+	data := &ClinVarData{
+		Found:         true,
+		Pathogenicity: fields[clinVarSignificance],
+		ReviewStatus:  fields[clinVarReviewStatus],
+		LastEvaluated: fields[clinVarFileDate],
+	}
+	if fields[clinVarConditions] != "" {
+		data.Conditions = strings.Split(fields[clinVarConditions], "|")
+	}
+	return data, nil
+}
+
+// GnomAD returns the population frequencies of a variant
+func (s *AnnotationStore) GnomAD(input VariantInput) (*GnomADData, error) {
+	fields, err := s.first(SourceGnomAD, input)
+	if err != nil {
+		return nil, err
+	}
+	// Absence only counts for an allele looked up by its coordinates
+	if fields == nil {
+		return &GnomADData{Found: false, Queried: input.HasCoordinates(), PopulationMaxName: "Unknown"}, nil
+	}
+
+	data := &GnomADData{Found: true, Queried: input.HasCoordinates(), PopulationMaxName: fields[gnomADPopMaxName]}
+	data.AlleleFrequency, _ = strconv.ParseFloat(fields[gnomADAlleleFrequency], 64)
+	data.PopulationMaxAF, _ = strconv.ParseFloat(fields[gnomADPopMaxAF], 64)
+	data.HomozygoteCount, _ = strconv.Atoi(fields[gnomADHomozygotes])
+	return data, nil
+}
+
+// COSMIC returns the somatic mutation counts of a variant. A protein change
+// caused by several nucleotide changes sums their samples.
+func (s *AnnotationStore) COSMIC(input VariantInput) (*COSMICData, error) {
+	records, err := s.lookup(SourceCOSMIC, input, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return &COSMICData{Found: false, CancerAssociation: "No data available"}, nil
+	}
+
+	data := &COSMICData{Found: true}
+	sites := make(map[string]int)
+	for _, fields := range records {
+		count, _ := strconv.Atoi(fields[cosmicSamples])
+		data.Frequency += count
+		data.IsHotspot = data.IsHotspot || fields[cosmicHotspot] == "1"
+		for _, entry := range strings.Split(fields[cosmicSites], "|") {
+			site, n, ok := strings.Cut(entry, "=")
+			if !ok {
+				continue
+			}
+			count, _ := strconv.Atoi(n)
+			sites[site] += count
+		}
+	}
+
+	data.CancerTypes = topSites(sites, maxCancerTypes)
+	if len(data.CancerTypes) > 0 {
+		data.CancerAssociation = "Most frequent in " + strings.Join(data.CancerTypes, ", ")
+	} else {
+		data.CancerAssociation = "Somatic mutation recorded in COSMIC"
+	}
+	return data, nil
+}
+
+// GetStatistics returns the records held per source
+func (s *AnnotationStore) GetStatistics() map[string]interface{} {
+	records := make(map[string]uint64)
+	for source, table := range s.tables {
+		if table != nil {
+			records[AnnotationSource(source).String()] = table.records
+		}
+	}
+	return map[string]interface{}{
+		"records_by_source": records,
+		"protein_blocks":    len(s.proteins),
+	}
+}
+
+// first returns the fields of the first record matching an input
+func (s *AnnotationStore) first(source AnnotationSource, input VariantInput) ([]string, error) {
+	records, err := s.lookup(source, input, true)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// lookup returns the fields of records matching an input, resolving gene
+// and protein change through the COSMIC protein index when the input has
+// no coordinates
+func (s *AnnotationStore) lookup(source AnnotationSource, input VariantInput, firstOnly bool) ([][]string, error) {
+	if !s.Has(source) {
+		return nil, fmt.Errorf("%s: %w", source, ErrSourceNotLoaded)
+	}
+
+	var keys []annotationKey
+	switch {
+	case input.Chromosome != "" && input.Position > 0:
+		position := annotationKey{Chromosome: normalizeChromosome(input.Chromosome), Position: uint64(input.Position)}
+		keys = []annotationKey{withAlleles(position, input.RefAllele, input.AltAllele)}
+	case input.Gene != "" && input.Variant != "":
+		resolved, err := s.proteinKeys(proteinKey(input.Gene, input.Variant))
+		if err != nil {
+			return nil, err
+		}
+		// Alleles given with the protein change must agree with the
+		// resolved sites, and narrow COSMIC rows without genomic alleles
+		for _, key := range resolved {
+			query := withAlleles(annotationKey{Chromosome: key.Chromosome, Position: key.Position}, input.RefAllele, input.AltAllele)
+			switch {
+			case key.Ref == "" && key.Alt == "":
+				keys = append(keys, query)
+			case key.matches(query):
+				keys = append(keys, key)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("variant needs coordinates or a gene and protein change")
+	}
+
+	var records [][]string
+	for _, key := range keys {
+		found, err := s.find(source, key)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+		if firstOnly && len(records) > 0 {
+			break
+		}
+	}
+	return records, nil
+}
+
+// find returns the fields of every record in a source matching a key
+func (s *AnnotationStore) find(source AnnotationSource, key annotationKey) ([][]string, error) {
+	blocks := s.tables[source].chromosomes[key.Chromosome]
+	i := sort.Search(len(blocks), func(i int) bool { return blocks[i].First > key.Position }) - 1
+	if i < 0 {
+		return nil, nil
+	}
+	data, err := s.readBlock(blocks[i])
+	if err != nil {
+		return nil, err
+	}
+
+	var matches [][]string
+	r := &recordReader{data: data}
+	for !r.done() {
+		record := annotationKey{Chromosome: key.Chromosome, Position: r.uvarint()}
+		record.Ref, record.Alt = r.str(), r.str()
+		fields := r.fields()
+		if r.err != nil {
+			return nil, fmt.Errorf("corrupt %s block at offset %d: %w", source, blocks[i].Offset, r.err)
+		}
+		if record.Position > key.Position {
+			break
+		}
+		if record.matches(key) {
+			matches = append(matches, fields)
+		}
+	}
+	return matches, nil
+}
+
+// proteinKeys resolves a protein index key to genomic keys
+func (s *AnnotationStore) proteinKeys(key string) ([]annotationKey, error) {
+	i := sort.Search(len(s.proteins), func(i int) bool { return s.proteins[i].Key > key }) - 1
+	if i < 0 {
+		return nil, nil
+	}
+	data, err := s.readBlock(s.proteins[i])
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []annotationKey
+	r := &recordReader{data: data}
+	for !r.done() {
+		entry := r.str()
+		genomic := annotationKey{Chromosome: r.str(), Position: r.uvarint()}
+		genomic.Ref, genomic.Alt = r.str(), r.str()
+		if r.err != nil {
+			return nil, fmt.Errorf("corrupt protein index block at offset %d: %w", s.proteins[i].Offset, r.err)
+		}
+		if entry > key {
+			break
+		}
+		if entry == key {
+			keys = append(keys, genomic)
+		}
+	}
+	return keys, nil
+}
+
+// readBlock reads and inflates a block
+func (s *AnnotationStore) readBlock(block annotationBlock) ([]byte, error) {
+	compressed := make([]byte, block.Size)
+	if _, err := s.file.ReadAt(compressed, int64(block.Offset)); err != nil {
+		return nil, fmt.Errorf("failed to read annotation block: %w", err)
+	}
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inflate annotation block: %w", err)
+	}
+	return data, nil
+}
+
+// readIndex loads the block index from the footer
+func (s *AnnotationStore) readIndex() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size < int64(len(annotationMagic)+footerSize) {
+		return fmt.Errorf("file too short")
+	}
+
+	magic := make([]byte, len(annotationMagic))
+	footer := make([]byte, footerSize)
+	if _, err := s.file.ReadAt(magic, 0); err != nil {
+		return err
+	}
+	if _, err := s.file.ReadAt(footer, size-int64(footerSize)); err != nil {
+		return err
+	}
+	if string(magic) != annotationMagic || string(footer[8:]) != annotationMagic {
+		return fmt.Errorf("bad magic")
+	}
+	indexOffset := binary.LittleEndian.Uint64(footer)
+	if indexOffset > uint64(size-int64(footerSize)) {
+		return fmt.Errorf("corrupt index offset %d", indexOffset)
+	}
+
+	index := make([]byte, uint64(size-int64(footerSize))-indexOffset)
+	if _, err := s.file.ReadAt(index, int64(indexOffset)); err != nil {
+		return err
+	}
+
+	r := &recordReader{data: index}
+	for source := range s.tables {
+		if r.uvarint() == 0 {
+			continue
+		}
+		table := newAnnotationTable()
+		table.records = r.uvarint()
+		chromosomes := r.uvarint()
+		for c := uint64(0); c < chromosomes && r.err == nil; c++ {
+			name := r.str()
+			count := r.uvarint()
+			blocks := make([]annotationBlock, 0, min(count, 1<<20))
+			for b := uint64(0); b < count && r.err == nil; b++ {
+				blocks = append(blocks, annotationBlock{First: r.uvarint(), Offset: r.uvarint(), Size: uint32(r.uvarint())})
+			}
+			table.chromosomes[name] = blocks
+		}
+		s.tables[source] = table
+	}
+	count := r.uvarint()
+	for b := uint64(0); b < count && r.err == nil; b++ {
+		s.proteins = append(s.proteins, annotationBlock{Key: r.str(), Offset: r.uvarint(), Size: uint32(r.uvarint())})
+	}
+	if r.err != nil {
+		return fmt.Errorf("corrupt index: %w", r.err)
+	}
+	return nil
+}
+
+// topSites returns up to n primary sites by descending sample count
+func topSites(sites map[string]int, n int) []string {
+	names := make([]string, 0, len(sites))
+	for site := range sites {
+		names = append(names, site)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sites[names[i]] != sites[names[j]] {
+			return sites[names[i]] > sites[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	return names
+}
+
+// AnnotationStoreBuilder writes an annotation store. Ingest calls may be
+// repeated per source (e.g. one gnomAD VCF per chromosome), but each
+// chromosome must arrive in one position-sorted run per source. The file
+// appears at its path only when Close succeeds.
+type AnnotationStoreBuilder struct {
+	// HotspotSamples is the number of COSMIC samples mutated at a codon
+	// for its variants to be flagged as hotspots
+	HotspotSamples int
+
+	path   string
+	file   *os.File
+	w      *bufio.Writer
+	offset uint64
+	tables [numAnnotationSources]*annotationTable
+	cosmic map[annotationKey]*cosmicAggregate
+
+	proteinBlocks []annotationBlock
+}
+
+// cosmicAggregate accumulates the COSMIC rows of one variant
+type cosmicAggregate struct {
+	gene    string
+	protein string
+	samples map[string]struct{} // Distinct sample IDs (TSV)
+	count   int                 // CNT, or rows without sample IDs
+	sites   map[string]int
+}
+
+// CreateAnnotationStore starts building a store at path
+func CreateAnnotationStore(path string) (*AnnotationStoreBuilder, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create annotation store: %w", err)
+	}
+	b := &AnnotationStoreBuilder{
+		HotspotSamples: defaultHotspotSamples,
+		path:           path,
+		file:           file,
+		w:              bufio.NewWriterSize(file, 1<<20),
+		cosmic:         make(map[annotationKey]*cosmicAggregate),
+	}
+	if err := b.write([]byte(annotationMagic)); err != nil {
+		b.Discard()
+		return nil, fmt.Errorf("failed to write annotation store: %w", err)
+	}
+	return b, nil
+}
+
+// IngestFile loads a ClinVar, gnomAD or COSMIC file. VCFs (.vcf, .vcf.gz,
+// .vcf.bgz) are read with mutations.OpenVCF; other COSMIC files are read as
+// (optionally gzipped) TSV exports. Returns the number of records added.
+func (b *AnnotationStoreBuilder) IngestFile(source AnnotationSource, path string) (int, error) {
+	isVCF := strings.Contains(filepath.Base(path), ".vcf")
+	if source == SourceCOSMIC && !isVCF {
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open COSMIC export: %w", err)
+		}
+		defer file.Close()
+
+		var reader io.Reader = file
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				return 0, fmt.Errorf("failed to open gzip stream: %w", err)
+			}
+			defer gz.Close()
+			reader = gz
+		}
+		return b.IngestCOSMIC(reader)
+	}
+
+	vr, err := mutations.OpenVCF(path)
+	if err != nil {
+		return 0, err
+	}
+	defer vr.Close()
+
+	switch source {
+	case SourceClinVar:
+		return b.IngestClinVar(vr)
+	case SourceGnomAD:
+		return b.IngestGnomAD(vr)
+	case SourceCOSMIC:
+		return b.IngestCOSMICVCF(vr)
+	}
+	return 0, fmt.Errorf("unknown annotation source %d", source)
+}
+
+// IngestClinVar streams a position-sorted ClinVar VCF into the store
+func (b *AnnotationStoreBuilder) IngestClinVar(vr *mutations.VCFReader) (int, error) {
+	fileDate := ""
+	for _, meta := range vr.Header().Meta {
+		if date, ok := strings.CutPrefix(meta, "fileDate="); ok {
+			fileDate = date
+		}
+	}
+
+	return b.ingestSorted(SourceClinVar, vr, func(record *mutations.VCFRecord, altIndex int) []string {
+		significance := clinVarTerm(firstNonEmpty(record.Info["CLNSIG"], record.Info["CLNSIGINCL"]))
+		if significance == "" {
+			return nil
+		}
+		var conditions []string
+		for _, condition := range strings.Split(record.Info["CLNDN"], "|") {
+			condition = clinVarTerm(condition)
+			if condition != "" && condition != "not provided" && condition != "not specified" {
+				conditions = append(conditions, condition)
+			}
+		}
+
+		fields := make([]string, clinVarFields)
+		fields[clinVarSignificance] = significance
+		fields[clinVarReviewStatus] = clinVarTerm(record.Info["CLNREVSTAT"])
+		fields[clinVarConditions] = strings.Join(conditions, "|")
+		fields[clinVarFileDate] = fileDate
+		return fields
+	})
+}
+
+// clinVarTerm turns a ClinVar INFO value into display text:
+// "criteria_provided,_single_submitter" -> "criteria provided, single submitter"
+func clinVarTerm(value string) string {
+	return strings.TrimSpace(strings.ReplaceAll(value, "_", " "))
+}
+
+// IngestGnomAD streams a position-sorted gnomAD sites VCF into the store
+func (b *AnnotationStoreBuilder) IngestGnomAD(vr *mutations.VCFReader) (int, error) {
+	return b.ingestSorted(SourceGnomAD, vr, func(record *mutations.VCFRecord, altIndex int) []string {
+		af, err := strconv.ParseFloat(record.AltInfo("AF", altIndex), 64)
+		if err != nil {
+			return nil
+		}
+
+		maxAF, maxName := -1.0, ""
+		for _, suffix := range []string{"grpmax", "popmax"} {
+			if value, err := strconv.ParseFloat(record.AltInfo("AF_"+suffix, altIndex), 64); err == nil {
+				maxAF, maxName = value, record.AltInfo(suffix, altIndex)
+				break
+			}
+		}
+		if maxAF < 0 {
+			for _, population := range gnomADPopulations {
+				if value, err := strconv.ParseFloat(record.AltInfo("AF_"+population, altIndex), 64); err == nil && value > maxAF {
+					maxAF, maxName = value, population
+				}
+			}
+		}
+		if maxAF < 0 || maxName == "" || maxName == "." {
+			maxAF, maxName = 0, "Unknown"
+		}
+
+		fields := make([]string, gnomADFields)
+		fields[gnomADAlleleFrequency] = strconv.FormatFloat(af, 'g', -1, 64)
+		fields[gnomADPopMaxAF] = strconv.FormatFloat(maxAF, 'g', -1, 64)
+		fields[gnomADPopMaxName] = maxName
+		fields[gnomADHomozygotes] = firstNonEmpty(record.AltInfo("nhomalt", altIndex), "0")
+		return fields
+	})
+}
+
+// ingestSorted streams one record per ALT allele into a genomic table.
+// annotate returns the record's fields, or nil to skip the allele.
+func (b *AnnotationStoreBuilder) ingestSorted(source AnnotationSource, vr *mutations.VCFReader, annotate func(*mutations.VCFRecord, int) []string) (int, error) {
+	tw := b.tableWriter(source)
+	added := 0
+
+	// Trimming shared leading bases moves an allele past its POS, and so
+	// possibly past later records: alleles wait here, in trimmed order,
+	// until a record starts beyond them
+	var pending []pendingAllele
+	release := func(before uint64) error {
+		n := 0
+		for ; n < len(pending) && pending[n].key.Position < before; n++ {
+			if err := tw.add(pending[n].key, pending[n].fields); err != nil {
+				return err
+			}
+			added++
+		}
+		pending = append(pending[:0], pending[n:]...)
+		return nil
+	}
+
+	chromosome, last := "", uint64(0)
+	for {
+		record, err := vr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return added, fmt.Errorf("failed to read %s VCF: %w", source, err)
+		}
+
+		if normalized := normalizeChromosome(record.Chromosome); normalized != chromosome {
+			if err := release(math.MaxUint64); err != nil {
+				return added, err
+			}
+			chromosome = normalized
+		} else if record.Position < last {
+			return added, fmt.Errorf("%s input is not sorted at %s:%d (sort it with bcftools sort)", source, chromosome, record.Position)
+		} else if err := release(record.Position); err != nil {
+			return added, err
+		}
+		last = record.Position
+
+		for altIndex, alt := range record.Alts {
+			if alt == "." || alt == "*" || mutations.IsSymbolicAllele(alt) {
+				continue
+			}
+			fields := annotate(record, altIndex)
+			if fields == nil {
+				continue
+			}
+			key := newAnnotationKey(record.Chromosome, record.Position, record.Ref, alt)
+			i := sort.Search(len(pending), func(i int) bool { return pending[i].key.Position > key.Position })
+			pending = append(pending, pendingAllele{})
+			copy(pending[i+1:], pending[i:])
+			pending[i] = pendingAllele{key, fields}
+		}
+	}
+	if err := release(math.MaxUint64); err != nil {
+		return added, err
+	}
+	if err := tw.flush(); err != nil {
+		return added, err
+	}
+	return added, nil
+}
+
+// pendingAllele is a record held back by ingestSorted
+type pendingAllele struct {
+	key    annotationKey
+	fields []string
+}
+
+// COSMIC export column names: legacy CosmicMutantExport, then v99
+var cosmicColumns = map[string][]string{
+	"gene":       {"gene name", "gene_symbol"},
+	"sample":     {"id_sample", "cosmic_sample_id", "sample name", "sample_name"},
+	"protein":    {"mutation aa", "mutation_aa"},
+	"site":       {"primary site", "primary_site"},
+	"position":   {"mutation genome position"},
+	"chromosome": {"chromosome"},
+	"start":      {"genome_start"},
+	"ref":        {"genomic_wt_allele"},
+	"alt":        {"genomic_mut_allele"},
+	"hgvsg":      {"hgvsg"},
+}
+
+// hgvsgSubstitution matches a genomic HGVS substitution: "17:g.7675088C>T"
+var hgvsgSubstitution = regexp.MustCompile(`g\.(\d+)([ACGT])>([ACGT])$`)
+
+// IngestCOSMIC aggregates a COSMIC mutation TSV export. Rows are counted
+// once per distinct sample; rows without genomic alleles match any allele
+// at their position. Returns the number of rows used.
+func (b *AnnotationStoreBuilder) IngestCOSMIC(reader io.Reader) (int, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, fmt.Errorf("error reading COSMIC export: %w", err)
+		}
+		return 0, fmt.Errorf("empty COSMIC export")
+	}
+	columns := make(map[string]int)
+	for i, name := range strings.Split(scanner.Text(), "\t") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for column, aliases := range cosmicColumns {
+			if _, seen := columns[column]; !seen && indexOfString(aliases, name) >= 0 {
+				columns[column] = i
+			}
+		}
+	}
+	if _, ok := columns["gene"]; !ok {
+		return 0, fmt.Errorf("COSMIC export has no gene column")
+	}
+	_, hasPosition := columns["position"]
+	_, hasStart := columns["start"]
+	_, hasChromosome := columns["chromosome"]
+	if !hasPosition && !(hasStart && hasChromosome) {
+		return 0, fmt.Errorf("COSMIC export has no genome position columns")
+	}
+
+	used, lineNum := 0, 1
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Split(scanner.Text(), "\t")
+		column := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+
+		key, ok := cosmicRowKey(column)
+		if !ok {
+			continue
+		}
+		aggregate := b.cosmicAggregate(key, column("gene"), column("protein"))
+		if sample := column("sample"); sample != "" {
+			aggregate.samples[sample] = struct{}{}
+		} else {
+			aggregate.count++
+		}
+		if site := column("site"); site != "" && site != "NS" {
+			aggregate.sites[strings.ReplaceAll(site, "_", " ")]++
+		}
+		used++
+	}
+	if err := scanner.Err(); err != nil {
+		return used, fmt.Errorf("error reading COSMIC export line %d: %w", lineNum, err)
+	}
+	return used, nil
+}
+
+// cosmicRowKey builds the genomic key of a COSMIC export row
+func cosmicRowKey(column func(string) string) (annotationKey, bool) {
+	chromosome, position := column("chromosome"), column("start")
+	if location := column("position"); location != "" {
+		// Legacy "17:7578406-7578406"
+		var rest string
+		chromosome, rest, _ = strings.Cut(location, ":")
+		position, _, _ = strings.Cut(rest, "-")
+	}
+	start, err := strconv.ParseUint(position, 10, 64)
+	if err != nil || chromosome == "" {
+		return annotationKey{}, false
+	}
+	// COSMIC numbers X and Y as 23 and 24
+	switch chromosome {
+	case "23":
+		chromosome = "X"
+	case "24":
+		chromosome = "Y"
+	case "25":
+		chromosome = "MT"
+	}
+
+	ref, alt := column("ref"), column("alt")
+	if ref == "" || alt == "" {
+		if m := hgvsgSubstitution.FindStringSubmatch(column("hgvsg")); m != nil && m[1] == position {
+			ref, alt = m[2], m[3]
+		}
+	}
+	return newAnnotationKey(chromosome, start, ref, alt), true
+}
+
+// IngestCOSMICVCF aggregates a COSMIC VCF (CosmicCodingMuts), reading the
+// sample count from CNT, the gene from GENE and the protein change from AA
+func (b *AnnotationStoreBuilder) IngestCOSMICVCF(vr *mutations.VCFReader) (int, error) {
+	used := 0
+	for {
+		record, err := vr.Read()
+		if err == io.EOF {
+			return used, nil
+		}
+		if err != nil {
+			return used, fmt.Errorf("failed to read COSMIC VCF: %w", err)
+		}
+
+		for altIndex, alt := range record.Alts {
+			if alt == "." || mutations.IsSymbolicAllele(alt) {
+				continue
+			}
+			key := newAnnotationKey(record.Chromosome, record.Position, record.Ref, alt)
+			aggregate := b.cosmicAggregate(key, vcfGene(record.Info), record.AltInfo("AA", altIndex))
+			// The same variant is listed once per transcript
+			count, _ := strconv.Atoi(record.AltInfo("CNT", altIndex))
+			aggregate.count = max(aggregate.count, count, 1)
+			used++
+		}
+	}
+}
+
+// cosmicAggregate returns the aggregate for a variant, creating it
+func (b *AnnotationStoreBuilder) cosmicAggregate(key annotationKey, gene, protein string) *cosmicAggregate {
+	aggregate, ok := b.cosmic[key]
+	if !ok {
+		aggregate = &cosmicAggregate{samples: make(map[string]struct{}), sites: make(map[string]int)}
+		b.cosmic[key] = aggregate
+	}
+	if aggregate.gene == "" {
+		aggregate.gene, _, _ = strings.Cut(gene, "_")
+	}
+	if aggregate.protein == "" && protein != "" && protein != "p.?" && protein != "p.=" {
+		aggregate.protein = protein
+	}
+	return aggregate
+}
+
+// writeCOSMIC writes the aggregated COSMIC table and the protein index
+func (b *AnnotationStoreBuilder) writeCOSMIC() error {
+	if len(b.cosmic) == 0 {
+		return nil
+	}
+	keys := make([]annotationKey, 0, len(b.cosmic))
+	codons := make(map[string]int)
+	for key, aggregate := range b.cosmic {
+		keys = append(keys, key)
+		if codon := aggregate.codon(); codon != "" {
+			codons[codon] += aggregate.samplesMutated()
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, c := keys[i], keys[j]
+		if a.Chromosome != c.Chromosome {
+			return a.Chromosome < c.Chromosome
+		}
+		if a.Position != c.Position {
+			return a.Position < c.Position
+		}
+		if a.Ref != c.Ref {
+			return a.Ref < c.Ref
+		}
+		return a.Alt < c.Alt
+	})
+
+	type proteinEntry struct {
+		key     string
+		genomic annotationKey
+	}
+	var proteins []proteinEntry
+
+	tw := b.tableWriter(SourceCOSMIC)
+	for _, key := range keys {
+		aggregate := b.cosmic[key]
+
+		sites := make([]string, 0, len(aggregate.sites))
+		for _, site := range topSites(aggregate.sites, len(aggregate.sites)) {
+			sites = append(sites, fmt.Sprintf("%s=%d", site, aggregate.sites[site]))
+		}
+		fields := make([]string, cosmicFields)
+		fields[cosmicSamples] = strconv.Itoa(aggregate.samplesMutated())
+		fields[cosmicSites] = strings.Join(sites, "|")
+		if codon := aggregate.codon(); codon != "" && codons[codon] >= b.HotspotSamples {
+			fields[cosmicHotspot] = "1"
+		}
+		if err := tw.add(key, fields); err != nil {
+			return err
+		}
+
+		if aggregate.gene != "" && aggregate.protein != "" {
+			proteins = append(proteins, proteinEntry{proteinKey(aggregate.gene, aggregate.protein), key})
+		}
+	}
+	if err := tw.flush(); err != nil {
+		return err
+	}
+
+	// Protein index: "GENE CHANGE" -> genomic key, sorted by name
+	sort.SliceStable(proteins, func(i, j int) bool { return proteins[i].key < proteins[j].key })
+	var block []byte
+	first := ""
+	for i, entry := range proteins {
+		if len(block) == 0 {
+			first = entry.key
+		}
+		block = appendString(block, entry.key)
+		block = appendString(block, entry.genomic.Chromosome)
+		block = binary.AppendUvarint(block, entry.genomic.Position)
+		block = appendString(block, entry.genomic.Ref)
+		block = appendString(block, entry.genomic.Alt)
+
+		// Entries for one key stay in one block
+		last := i == len(proteins)-1
+		if last || (len(block) >= annotationBlockSize && proteins[i+1].key != entry.key) {
+			ref, err := b.writeBlock(block)
+			if err != nil {
+				return err
+			}
+			ref.Key = first
+			b.proteinBlocks = append(b.proteinBlocks, ref)
+			block = block[:0]
+		}
+	}
+	return nil
+}
+
+// samplesMutated returns the number of samples carrying a variant
+func (a *cosmicAggregate) samplesMutated() int {
+	return len(a.samples) + a.count
+}
+
+// codon returns the gene and reference residue of a protein change,
+// "TP53 R175", or "" for non-coding changes
+func (a *cosmicAggregate) codon() string {
+	if a.gene == "" || a.protein == "" {
+		return ""
+	}
+	change := mutations.ShortProteinChange(a.protein)
+	end := 1
+	for end < len(change) && change[end] >= '0' && change[end] <= '9' {
+		end++
+	}
+	if end == 1 {
+		return ""
+	}
+	return strings.ToUpper(a.gene) + " " + change[:end]
+}
+
+// Close writes the COSMIC table, protein index and block index, then moves
+// the store into place
+func (b *AnnotationStoreBuilder) Close() error {
+	if err := b.writeCOSMIC(); err != nil {
+		b.Discard()
+		return err
+	}
+
+	indexOffset := b.offset
+	var index []byte
+	for _, table := range b.tables {
+		if table == nil {
+			index = binary.AppendUvarint(index, 0)
+			continue
+		}
+		index = binary.AppendUvarint(index, 1)
+		index = binary.AppendUvarint(index, table.records)
+
+		names := make([]string, 0, len(table.chromosomes))
+		for name := range table.chromosomes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		index = binary.AppendUvarint(index, uint64(len(names)))
+		for _, name := range names {
+			blocks := table.chromosomes[name]
+			index = appendString(index, name)
+			index = binary.AppendUvarint(index, uint64(len(blocks)))
+			for _, block := range blocks {
+				index = binary.AppendUvarint(index, block.First)
+				index = binary.AppendUvarint(index, block.Offset)
+				index = binary.AppendUvarint(index, uint64(block.Size))
+			}
+		}
+	}
+	index = binary.AppendUvarint(index, uint64(len(b.proteinBlocks)))
+	for _, block := range b.proteinBlocks {
+		index = appendString(index, block.Key)
+		index = binary.AppendUvarint(index, block.Offset)
+		index = binary.AppendUvarint(index, uint64(block.Size))
+	}
+	index = binary.LittleEndian.AppendUint64(index, indexOffset)
+	index = append(index, annotationMagic...)
+
+	err := b.write(index)
+	if err == nil {
+		err = b.w.Flush()
+	}
+	if closeErr := b.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(b.file.Name())
+		return fmt.Errorf("failed to write annotation store: %w", err)
+	}
+	if err := os.Rename(b.file.Name(), b.path); err != nil {
+		os.Remove(b.file.Name())
+		return fmt.Errorf("failed to replace annotation store: %w", err)
+	}
+	return nil
+}
+
+// Discard abandons the build and removes the partial file
+func (b *AnnotationStoreBuilder) Discard() {
+	b.file.Close()
+	os.Remove(b.file.Name())
+}
+
+// write appends bytes to the store file
+func (b *AnnotationStoreBuilder) write(p []byte) error {
+	n, err := b.w.Write(p)
+	b.offset += uint64(n)
+	return err
+}
+
+// writeBlock compresses and appends a block
+func (b *AnnotationStoreBuilder) writeBlock(data []byte) (annotationBlock, error) {
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+	fw.Write(data)
+	if err := fw.Close(); err != nil {
+		return annotationBlock{}, fmt.Errorf("failed to compress annotation block: %w", err)
+	}
+
+	block := annotationBlock{Offset: b.offset, Size: uint32(compressed.Len())}
+	if err := b.write(compressed.Bytes()); err != nil {
+		return annotationBlock{}, fmt.Errorf("failed to write annotation store: %w", err)
+	}
+	return block, nil
+}
+
+// tableWriter packs position-sorted records of one source into blocks
+type tableWriter struct {
+	b      *AnnotationStoreBuilder
+	source AnnotationSource
+	table  *annotationTable
+	chrom  string
+	last   uint64
+	first  uint64
+	block  []byte
+}
+
+// tableWriter returns a writer appending to a source's table
+func (b *AnnotationStoreBuilder) tableWriter(source AnnotationSource) *tableWriter {
+	if b.tables[source] == nil {
+		b.tables[source] = newAnnotationTable()
+	}
+	return &tableWriter{b: b, source: source, table: b.tables[source]}
+}
+
+// add appends a record, starting a new block at chromosome changes and
+// once the current block is full
+func (tw *tableWriter) add(key annotationKey, fields []string) error {
+	switch {
+	case key.Chromosome != tw.chrom:
+		if err := tw.flush(); err != nil {
+			return err
+		}
+		if _, seen := tw.table.chromosomes[key.Chromosome]; seen {
+			return fmt.Errorf("%s input has chromosome %s in more than one run (sort it with bcftools sort)", tw.source, key.Chromosome)
+		}
+		tw.table.chromosomes[key.Chromosome] = nil
+		tw.chrom = key.Chromosome
+	case key.Position < tw.last:
+		return fmt.Errorf("%s input is not sorted at %s:%d (sort it with bcftools sort)", tw.source, key.Chromosome, key.Position)
+	case key.Position != tw.last && len(tw.block) >= annotationBlockSize:
+		if err := tw.flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(tw.block) == 0 {
+		tw.first = key.Position
+	}
+	tw.block = binary.AppendUvarint(tw.block, key.Position)
+	tw.block = appendString(tw.block, key.Ref)
+	tw.block = appendString(tw.block, key.Alt)
+	tw.block = binary.AppendUvarint(tw.block, uint64(len(fields)))
+	for _, field := range fields {
+		tw.block = appendString(tw.block, field)
+	}
+	tw.last = key.Position
+	tw.table.records++
+	return nil
+}
+
+// flush writes the pending block
+func (tw *tableWriter) flush() error {
+	if len(tw.block) == 0 {
+		return nil
+	}
+	block, err := tw.b.writeBlock(tw.block)
+	if err != nil {
+		return err
+	}
+	block.First = tw.first
+	tw.table.chromosomes[tw.chrom] = append(tw.table.chromosomes[tw.chrom], block)
+	tw.block = tw.block[:0]
+	return nil
+}
+
+// appendString appends a uvarint length and the bytes of s
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// recordReader decodes uvarints and strings, keeping the first error
+type recordReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *recordReader) done() bool {
+	return r.err != nil || r.pos >= len(r.data)
+}
+
+func (r *recordReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("truncated varint at %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return value
+}
+
+func (r *recordReader) str() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		r.err = fmt.Errorf("truncated string at %d", r.pos)
+		return ""
+	}
+	s := string(r.data[r.pos : r.pos+int(n)])
+	r.pos += int(n)
+	return s
+}
+
+func (r *recordReader) fields() []string {
+	count := r.uvarint()
+	if count > uint64(len(r.data)-r.pos) {
+		r.err = fmt.Errorf("corrupt field count %d", count)
+		return nil
+	}
+	fields := make([]string, count)
+	for i := range fields {
+		fields[i] = r.str()
+	}
+	return fields
+}
+
+// indexOfString returns the index of value in values, or -1
+func indexOfString(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
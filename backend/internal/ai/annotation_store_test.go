@@ -0,0 +1,325 @@
+/**
+ * Annotation Store Tests
+ *
+ * Builds a store from small ClinVar, gnomAD and COSMIC snapshots and
+ * retrieves variant context without network access
+ */
+
+package ai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"genomevedic/internal/mutations"
+)
+
+const testClinVarVCF = `##fileformat=VCFv4.1
+##fileDate=2024-05-12
+##INFO=<ID=CLNSIG,Number=.,Type=String,Description="Clinical significance">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+12	25245350	12582	C	T	.	.	CLNSIG=Pathogenic;CLNREVSTAT=criteria_provided,_multiple_submitters,_no_conflicts;CLNDN=Noonan_syndrome|not_provided
+17	7675088	12374	C	T	.	.	CLNSIG=Pathogenic/Likely_pathogenic;CLNREVSTAT=reviewed_by_expert_panel;CLNDN=Li-Fraumeni_syndrome|Hereditary_cancer-predisposing_syndrome
+17	7675088	376649	C	A	.	.	CLNSIG=Uncertain_significance;CLNREVSTAT=criteria_provided,_single_submitter;CLNDN=not_specified
+`
+
+const testGnomADVCF = `##fileformat=VCFv4.2
+##INFO=<ID=AF,Number=A,Type=Float,Description="Alternate allele frequency">
+##INFO=<ID=nhomalt,Number=A,Type=Integer,Description="Homozygotes">
+##INFO=<ID=AF_nfe,Number=A,Type=Float,Description="AF in nfe">
+##INFO=<ID=AF_afr,Number=A,Type=Float,Description="AF in afr">
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+chr17	7675088	.	C	A,T	.	PASS	AF=0.00002,0.000004;nhomalt=0,0;AF_nfe=0.00003,0.000006;AF_afr=0.00001,0
+chr17	7676154	.	CCT	CT	.	PASS	AF=0.3;nhomalt=4200;AF_nfe=0.28;AF_afr=0.45
+`
+
+const testCOSMICExport = "Gene name\tAccession Number\tID_sample\tPrimary site\tMutation CDS\tMutation AA\tMutation genome position\tHGVSG\n" +
+	"TP53_ENST00000269305\tENST00000269305\t1001\tlarge_intestine\tc.524G>A\tp.R175H\t17:7675088-7675088\t17:g.7675088C>T\n" +
+	"TP53_ENST00000269305\tENST00000269305\t1002\tlarge_intestine\tc.524G>A\tp.R175H\t17:7675088-7675088\t17:g.7675088C>T\n" +
+	"TP53\tENST00000269305\t1002\tlarge_intestine\tc.524G>A\tp.R175H\t17:7675088-7675088\t17:g.7675088C>T\n" +
+	"TP53\tENST00000269305\t1003\tbreast\tc.524G>A\tp.R175H\t17:7675088-7675088\t17:g.7675088C>T\n" +
+	"KRAS\tENST00000256078\t2001\tpancreas\tc.35G>A\tp.G12D\t12:25245350-25245350\t12:g.25245350C>T\n"
+
+// buildTestStore writes the test snapshots and builds a store from them
+func buildTestStore(t *testing.T) *AnnotationStore {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"clinvar.vcf": testClinVarVCF,
+		"gnomad.vcf":  testGnomADVCF,
+		"cosmic.tsv":  testCOSMICExport,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "annotations.gva")
+	builder, err := CreateAnnotationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.HotspotSamples = 3
+	for _, input := range []struct {
+		source AnnotationSource
+		name   string
+		want   int
+	}{
+		{SourceClinVar, "clinvar.vcf", 3},
+		{SourceGnomAD, "gnomad.vcf", 3},
+		{SourceCOSMIC, "cosmic.tsv", 5},
+	} {
+		count, err := builder.IngestFile(input.source, filepath.Join(dir, input.name))
+		if err != nil {
+			t.Fatalf("ingest %s: %v", input.name, err)
+		}
+		if count != input.want {
+			t.Errorf("ingest %s: %d records, want %d", input.name, count, input.want)
+		}
+	}
+	if err := builder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenAnnotationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestAnnotationStoreLookups checks each source by coordinates
+func TestAnnotationStoreLookups(t *testing.T) {
+	store := buildTestStore(t)
+	r175h := VariantInput{Gene: "TP53", Variant: "R175H", Chromosome: "chr17", Position: 7675088, RefAllele: "C", AltAllele: "T"}
+
+	clinVar, err := store.ClinVar(r175h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !clinVar.Found || clinVar.Pathogenicity != "Pathogenic/Likely pathogenic" ||
+		clinVar.ReviewStatus != "reviewed by expert panel" || clinVar.LastEvaluated != "2024-05-12" {
+		t.Errorf("ClinVar = %+v", clinVar)
+	}
+	if len(clinVar.Conditions) != 2 || clinVar.Conditions[0] != "Li-Fraumeni syndrome" {
+		t.Errorf("ClinVar conditions = %v", clinVar.Conditions)
+	}
+
+	gnomAD, err := store.GnomAD(r175h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gnomAD.Found || gnomAD.AlleleFrequency != 0.000004 || gnomAD.PopulationMaxName != "nfe" || gnomAD.PopulationMaxAF != 0.000006 {
+		t.Errorf("gnomAD = %+v", gnomAD)
+	}
+
+	// The padded gnomAD deletion CCT>CT is stored as CC>C
+	deletion, err := store.GnomAD(VariantInput{Chromosome: "17", Position: 7676154, RefAllele: "CC", AltAllele: "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deletion.Found || deletion.HomozygoteCount != 4200 || deletion.PopulationMaxName != "afr" {
+		t.Errorf("gnomAD deletion = %+v", deletion)
+	}
+
+	cosmic, err := store.COSMIC(r175h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cosmic.Found || cosmic.Frequency != 3 || !cosmic.IsHotspot {
+		t.Errorf("COSMIC = %+v", cosmic)
+	}
+	if len(cosmic.CancerTypes) != 2 || cosmic.CancerTypes[0] != "large intestine" {
+		t.Errorf("COSMIC cancer types = %v", cosmic.CancerTypes)
+	}
+
+	missing, err := store.ClinVar(VariantInput{Chromosome: "17", Position: 7675089, RefAllele: "G", AltAllele: "A"})
+	if err != nil || missing.Found {
+		t.Errorf("unknown variant = %+v, %v; want not found", missing, err)
+	}
+
+	// A lone ALT still selects the allele at a shared position
+	for alt, want := range map[string]string{"T": "Pathogenic/Likely pathogenic", "A": "Uncertain significance"} {
+		clinVar, err := store.ClinVar(VariantInput{Chromosome: "17", Position: 7675088, AltAllele: alt})
+		if err != nil || !clinVar.Found || clinVar.Pathogenicity != want {
+			t.Errorf("17:7675088 ALT %s ClinVar = %+v, %v; want %s", alt, clinVar, err, want)
+		}
+	}
+	if other, err := store.ClinVar(VariantInput{Chromosome: "17", Position: 7675088, AltAllele: "G"}); err != nil || other.Found {
+		t.Errorf("17:7675088 ALT G ClinVar = %+v, %v; want not found", other, err)
+	}
+}
+
+// TestAnnotationStoreProteinLookup resolves gene and protein change inputs
+func TestAnnotationStoreProteinLookup(t *testing.T) {
+	store := buildTestStore(t)
+
+	for _, variant := range []string{"G12D", "p.Gly12Asp"} {
+		input := VariantInput{Gene: "KRAS", Variant: variant}
+		clinVar, err := store.ClinVar(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !clinVar.Found || clinVar.Pathogenicity != "Pathogenic" {
+			t.Errorf("KRAS %s ClinVar = %+v", variant, clinVar)
+		}
+		cosmic, err := store.COSMIC(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cosmic.Found || cosmic.Frequency != 1 || cosmic.IsHotspot {
+			t.Errorf("KRAS %s COSMIC = %+v", variant, cosmic)
+		}
+	}
+
+	// Alleles given with a protein change must match the resolved site
+	for alt, found := range map[string]bool{"T": true, "A": false} {
+		clinVar, err := store.ClinVar(VariantInput{Gene: "KRAS", Variant: "G12D", RefAllele: "C", AltAllele: alt})
+		if err != nil || clinVar.Found != found {
+			t.Errorf("KRAS G12D C>%s ClinVar = %+v, %v; want found %v", alt, clinVar, err, found)
+		}
+	}
+
+	unknown, err := store.COSMIC(VariantInput{Gene: "KRAS", Variant: "Q61H"})
+	if err != nil || unknown.Found {
+		t.Errorf("KRAS Q61H = %+v, %v; want not found", unknown, err)
+	}
+}
+
+// TestAnnotationStoreUnsortedInput rejects VCFs that are not position-sorted
+func TestAnnotationStoreUnsortedInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotations.gva")
+	builder, err := CreateAnnotationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer builder.Discard()
+
+	unsorted := "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n" +
+		"1\t200\t.\tA\tG\t.\t.\tAF=0.1\n" +
+		"1\t100\t.\tA\tG\t.\t.\tAF=0.1\n"
+	vr, err := mutations.NewVCFReader(strings.NewReader(unsorted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.IngestGnomAD(vr); err == nil || !strings.Contains(err.Error(), "bcftools sort") {
+		t.Errorf("unsorted input error = %v", err)
+	}
+}
+
+// TestAnnotationStoreTrimmedOrder stores multi-allelic records whose
+// alleles trim to different positions
+func TestAnnotationStoreTrimmedOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotations.gva")
+	builder, err := CreateAnnotationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// AC>AT trims to 101 C>T, after AC>GC at 100 and CGT>CGA at 102
+	vcf := "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n" +
+		"1\t100\t.\tACGT\tACGA,GCGT\t.\t.\tAF=0.1,0.2\n" +
+		"1\t101\t.\tC\tA\t.\t.\tAF=0.3\n" +
+		"1\t100\t.\tAC\tAT\t.\t.\tAF=0.4\n"
+	vr, err := mutations.NewVCFReader(strings.NewReader(vcf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.IngestGnomAD(vr); err == nil {
+		t.Error("expected an error for a record before the previous POS")
+	}
+	builder.Discard()
+
+	builder, err = CreateAnnotationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vcf = "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n" +
+		"1\t100\t.\tAC\tAT,GC\t.\t.\tAF=0.1,0.2\n" +
+		"1\t100\t.\tACGT\tACGA\t.\t.\tAF=0.3\n" +
+		"1\t101\t.\tC\tA\t.\t.\tAF=0.4\n" +
+		"2\t50\t.\tGA\tGT\t.\t.\tAF=0.5\n"
+	vr, err = mutations.NewVCFReader(strings.NewReader(vcf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := builder.IngestGnomAD(vr)
+	if err != nil || count != 5 {
+		t.Fatalf("IngestGnomAD = %d, %v; want 5 records", count, err)
+	}
+	if err := builder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenAnnotationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, tc := range []struct {
+		chromosome string
+		position   int64
+		ref, alt   string
+		af         float64
+	}{
+		{"1", 100, "AC", "AT", 0.1},
+		{"1", 101, "C", "T", 0.1},
+		{"1", 100, "A", "G", 0.2},
+		{"1", 103, "T", "A", 0.3},
+		{"1", 101, "C", "A", 0.4},
+		{"2", 51, "A", "T", 0.5},
+	} {
+		gnomAD, err := store.GnomAD(VariantInput{Chromosome: tc.chromosome, Position: tc.position, RefAllele: tc.ref, AltAllele: tc.alt})
+		if err != nil || !gnomAD.Found || gnomAD.AlleleFrequency != tc.af {
+			t.Errorf("%s:%d %s>%s = %+v, %v; want AF %g", tc.chromosome, tc.position, tc.ref, tc.alt, gnomAD, err, tc.af)
+		}
+	}
+}
+
+// TestContextRetrieverLocal retrieves context from the store without
+// touching the network
+func TestContextRetrieverLocal(t *testing.T) {
+	store := buildTestStore(t)
+	retriever := NewContextRetriever("")
+	retriever.UseAnnotationStore(store, false)
+
+	variantCtx, err := retriever.GetVariantContext(context.Background(), VariantInput{
+		Gene: "TP53", Variant: "R175H", Chromosome: "17", Position: 7675088, RefAllele: "C", AltAllele: "T",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !variantCtx.ClinVar.Found || !variantCtx.GnomAD.Found || !variantCtx.COSMIC.Found {
+		t.Errorf("context = %+v %+v %+v", variantCtx.ClinVar, variantCtx.GnomAD, variantCtx.COSMIC)
+	}
+	if variantCtx.PubMed == nil || variantCtx.PubMed.Found {
+		t.Errorf("PubMed = %+v; want not found without remote access", variantCtx.PubMed)
+	}
+
+	// A store without a source reports it rather than going remote
+	path := filepath.Join(t.TempDir(), "empty.gva")
+	builder, err := CreateAnnotationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	empty, err := OpenAnnotationStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	if empty.Has(SourceCOSMIC) {
+		t.Error("empty store should not hold COSMIC")
+	}
+	if _, err := empty.GnomAD(VariantInput{Chromosome: "1", Position: 100}); !errors.Is(err, ErrSourceNotLoaded) {
+		t.Errorf("missing source error = %v, want ErrSourceNotLoaded", err)
+	}
+}
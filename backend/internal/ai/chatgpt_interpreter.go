@@ -1,12 +1,8 @@
 package ai
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 	"time"
 )
@@ -14,17 +10,32 @@ import (
 // ChatGPTInterpreter handles GPT-4 API calls for variant interpretation
 type ChatGPTInterpreter struct {
 	config           *Config
-	httpClient       *http.Client
+	provider         LLMProvider
 	contextRetriever *ContextRetriever
 	cacheManager     *CacheManager
+	acmg             *ACMGEngine
 }
 
-// NewChatGPTInterpreter creates a new ChatGPT interpreter
+// NewChatGPTInterpreter creates a new ChatGPT interpreter using the LLM
+// provider selected by config.LLMProvider
 func NewChatGPTInterpreter(config *Config) (*ChatGPTInterpreter, error) {
-	if config.OpenAIAPIKey == "" {
-		return nil, fmt.Errorf("OpenAI API key is required")
+	provider, err := NewLLMProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	retriever, err := NewContextRetrieverFromConfig(config)
+	if err != nil {
+		return nil, err
 	}
+	interpreter := NewChatGPTInterpreterWithProvider(config, provider)
+	interpreter.contextRetriever = retriever
+	return interpreter, nil
+}
 
+// NewChatGPTInterpreterWithProvider creates an interpreter that uses the given
+// LLM provider. Variant context comes from the external APIs until
+// SetContextRetriever is called.
+func NewChatGPTInterpreterWithProvider(config *Config, provider LLMProvider) *ChatGPTInterpreter {
 	// Create cache store
 	var cacheStore CacheStore
 	var err error
@@ -43,13 +54,101 @@ func NewChatGPTInterpreter(config *Config) (*ChatGPTInterpreter, error) {
 	}
 
 	return &ChatGPTInterpreter{
-		config: config,
-		httpClient: &http.Client{
-			Timeout: time.Duration(config.TimeoutSeconds) * time.Second,
-		},
-		contextRetriever: NewContextRetriever(""), // NCBI API key can be added here
+		config:           config,
+		provider:         provider,
+		contextRetriever: NewContextRetriever(config.NCBIAPIKey),
 		cacheManager:     NewCacheManager(cacheStore, config.CacheTTLDays),
-	}, nil
+		acmg:             NewACMGEngine(DefaultACMGOptions()),
+	}
+}
+
+// SetContextRetriever replaces the variant context source
+func (ci *ChatGPTInterpreter) SetContextRetriever(retriever *ContextRetriever) {
+	ci.contextRetriever = retriever
+}
+
+// SetACMGEngine replaces the ACMG/AMP engine used by ClassifyVariant
+func (ci *ChatGPTInterpreter) SetACMGEngine(engine *ACMGEngine) {
+	ci.acmg = engine
+}
+
+// ClassifyVariant classifies a variant with the deterministic ACMG/AMP
+// engine. With request.Narrative the LLM writes a narrative of the
+// structured evidence; it is told not to reclassify.
+func (ci *ChatGPTInterpreter) ClassifyVariant(ctx context.Context, request ClassificationRequest) (*ClassificationResponse, error) {
+	startTime := time.Now()
+	response, err := ClassifyVariant(ctx, ci.contextRetriever, ci.acmg, request)
+	if err != nil {
+		return nil, err
+	}
+	if !request.Narrative {
+		return response, nil
+	}
+
+	prompt := ci.buildNarrativePrompt(request.VariantInput, response.Classification)
+	llmResponse, err := ci.callLLM(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("%s LLM call failed: %w", ci.provider.Name(), err)
+	}
+	response.Narrative = strings.TrimSpace(llmResponse.Content)
+	response.TokensUsed = llmResponse.Usage.TotalTokens
+	response.CostUSD = llmCost(llmResponse.Usage)
+	response.ResponseTime = time.Since(startTime)
+	return response, nil
+}
+
+// buildNarrativePrompt asks for a report narrative of an ACMG result
+func (ci *ChatGPTInterpreter) buildNarrativePrompt(input VariantInput, result *ACMGResult) string {
+	var promptBuilder strings.Builder
+
+	promptBuilder.WriteString("You are writing the interpretation narrative of a clinical variant report.\n")
+	promptBuilder.WriteString("The classification below was made by a deterministic ACMG/AMP rule engine. ")
+	promptBuilder.WriteString("Do not change the classification, add criteria, or cite evidence that is not listed.\n\n")
+
+	promptBuilder.WriteString(fmt.Sprintf("Variant: %s %s", input.Gene, input.Variant))
+	if input.Chromosome != "" {
+		promptBuilder.WriteString(fmt.Sprintf(" (chr%s:%d %s>%s)",
+			normalizeChromosome(input.Chromosome), input.Position, input.RefAllele, input.AltAllele))
+	}
+	promptBuilder.WriteString("\n")
+	if result.Consequence != "" {
+		promptBuilder.WriteString(fmt.Sprintf("Consequence: %s\n", result.Consequence))
+	}
+	promptBuilder.WriteString(fmt.Sprintf("Classification: %s (rule: %s)\n", result.Classification, result.Rule))
+
+	promptBuilder.WriteString("\nCriteria met:\n")
+	if len(result.Criteria) == 0 {
+		promptBuilder.WriteString("- None\n")
+	}
+	for _, criterion := range result.Criteria {
+		promptBuilder.WriteString(fmt.Sprintf("- %s (%s): %s\n", criterion.Label(), criterion.Strength, criterion.Rationale))
+		for _, evidence := range criterion.Evidence {
+			promptBuilder.WriteString(fmt.Sprintf("  • %s: %s", evidence.Source, evidence.Detail))
+			if evidence.Reference != "" {
+				promptBuilder.WriteString(fmt.Sprintf(" [%s]", evidence.Reference))
+			}
+			promptBuilder.WriteString("\n")
+		}
+	}
+
+	if len(result.NotMet) > 0 {
+		promptBuilder.WriteString("\nCriteria evaluated but not met:\n")
+		for _, criterion := range result.NotMet {
+			promptBuilder.WriteString(fmt.Sprintf("- %s: %s\n", criterion.Code, criterion.Rationale))
+		}
+	}
+
+	if len(result.Literature) > 0 {
+		promptBuilder.WriteString("\nLiterature:\n")
+		for _, reference := range result.Literature {
+			promptBuilder.WriteString(fmt.Sprintf("- %s %s\n", reference.Reference, reference.Detail))
+		}
+	}
+
+	promptBuilder.WriteString("\nWrite a concise narrative (150 words max) explaining how the listed evidence ")
+	promptBuilder.WriteString("supports the classification, citing criteria codes and references in brackets.")
+
+	return promptBuilder.String()
 }
 
 // ExplainVariant generates a GPT-4 explanation for a variant
@@ -88,31 +187,33 @@ func (ci *ChatGPTInterpreter) generateExplanation(ctx context.Context, request E
 	// Build prompt
 	prompt := ci.buildPrompt(request.VariantInput, variantContext, request.IncludeReferences)
 
-	// Call OpenAI API
-	gptResponse, err := ci.callOpenAI(ctx, prompt)
+	// Call LLM provider
+	gptResponse, err := ci.callLLM(ctx, prompt)
 	if err != nil {
-		return nil, fmt.Errorf("OpenAI API call failed: %w", err)
+		return nil, fmt.Errorf("%s LLM call failed: %w", ci.provider.Name(), err)
 	}
 
-	// Calculate cost (GPT-4 Turbo pricing as of 2024)
-	// Input: $0.01 per 1K tokens, Output: $0.03 per 1K tokens
-	inputCost := float64(gptResponse.Usage.PromptTokens) / 1000.0 * 0.01
-	outputCost := float64(gptResponse.Usage.CompletionTokens) / 1000.0 * 0.03
-	totalCost := inputCost + outputCost
-
 	response := &ExplanationResponse{
-		Explanation:  strings.TrimSpace(gptResponse.Choices[0].Message.Content),
+		Explanation:  strings.TrimSpace(gptResponse.Content),
 		Context:      variantContext,
 		Cached:       false,
 		ResponseTime: time.Since(startTime),
 		TokensUsed:   gptResponse.Usage.TotalTokens,
-		CostUSD:      totalCost,
-		Quality:      ci.evaluateQuality(gptResponse.Choices[0].Message.Content, variantContext),
+		CostUSD:      llmCost(gptResponse.Usage),
+		Quality:      ci.evaluateQuality(gptResponse.Content, variantContext),
 	}
 
 	return response, nil
 }
 
+// llmCost estimates the cost of a call (GPT-4 Turbo pricing as of 2024)
+// Input: $0.01 per 1K tokens, Output: $0.03 per 1K tokens
+func llmCost(usage LLMUsage) float64 {
+	inputCost := float64(usage.PromptTokens) / 1000.0 * 0.01
+	outputCost := float64(usage.CompletionTokens) / 1000.0 * 0.03
+	return inputCost + outputCost
+}
+
 // buildPrompt constructs the GPT-4 prompt with variant context
 func (ci *ChatGPTInterpreter) buildPrompt(input VariantInput, context *VariantContext, includeRefs bool) string {
 	var promptBuilder strings.Builder
@@ -202,41 +303,11 @@ func (ci *ChatGPTInterpreter) buildPrompt(input VariantInput, context *VariantCo
 	return promptBuilder.String()
 }
 
-// OpenAI API request/response structures
-type openAIRequest struct {
-	Model       string      `json:"model"`
-	Messages    []message   `json:"messages"`
-	MaxTokens   int         `json:"max_tokens"`
-	Temperature float32     `json:"temperature"`
-}
-
-type message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type openAIResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Choices []struct {
-		Index        int     `json:"index"`
-		Message      message `json:"message"`
-		FinishReason string  `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
-}
-
-// callOpenAI makes the actual API call to OpenAI
-func (ci *ChatGPTInterpreter) callOpenAI(ctx context.Context, prompt string) (*openAIResponse, error) {
-	requestBody := openAIRequest{
+// callLLM sends the prompt to the configured LLM provider
+func (ci *ChatGPTInterpreter) callLLM(ctx context.Context, prompt string) (*LLMResponse, error) {
+	return ci.provider.Complete(ctx, LLMRequest{
 		Model: ci.config.OpenAIModel,
-		Messages: []message{
+		Messages: []LLMMessage{
 			{
 				Role:    "user",
 				Content: prompt,
@@ -244,47 +315,7 @@ func (ci *ChatGPTInterpreter) callOpenAI(ctx context.Context, prompt string) (*o
 		},
 		MaxTokens:   ci.config.MaxTokens,
 		Temperature: ci.config.Temperature,
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ci.config.OpenAIAPIKey))
-
-	resp, err := ci.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("OpenAI API error (status %d): %s", resp.StatusCode, string(body))
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var gptResponse openAIResponse
-	if err := json.Unmarshal(body, &gptResponse); err != nil {
-		return nil, err
-	}
-
-	if len(gptResponse.Choices) == 0 {
-		return nil, fmt.Errorf("no response from GPT-4")
-	}
-
-	return &gptResponse, nil
+	})
 }
 
 // evaluateQuality assigns a quality score to the explanation
@@ -0,0 +1,409 @@
+/**
+ * LLM Providers
+ *
+ * ChatGPTInterpreter and NLQueryEngine talk to language models through the
+ * LLMProvider interface instead of hard-coding the OpenAI wire format:
+ *
+ * - OpenAIProvider: any OpenAI-compatible chat completions endpoint
+ *   (api.openai.com, llama.cpp server, vLLM, ...) via a configurable base URL
+ * - MockProvider: deterministic canned responses for tests
+ * - ReplayProvider: serves responses recorded on disk, optionally recording
+ *   misses from an upstream provider
+ *
+ * The provider is selected through Config.LLMProvider (see NewLLMProvider).
+ */
+
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider names accepted in Config.LLMProvider
+const (
+	ProviderOpenAI = "openai"
+	ProviderMock   = "mock"
+	ProviderReplay = "replay"
+	ProviderRecord = "record"
+)
+
+// DefaultOpenAIBaseURL is the OpenAI API base URL
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// LLMMessage is a single chat message
+type LLMMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLMRequest is a chat completion request
+type LLMRequest struct {
+	Model       string       `json:"model"`
+	Messages    []LLMMessage `json:"messages"`
+	MaxTokens   int          `json:"max_tokens"`
+	Temperature float32      `json:"temperature"`
+}
+
+// LLMUsage reports token consumption
+type LLMUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// LLMResponse is a chat completion result
+type LLMResponse struct {
+	Content string   `json:"content"`
+	Model   string   `json:"model"`
+	Usage   LLMUsage `json:"usage"`
+}
+
+// LLMProvider generates chat completions
+type LLMProvider interface {
+	// Complete returns the model's reply to the request
+	Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error)
+
+	// Name identifies the provider (e.g. "openai", "mock", "replay")
+	Name() string
+}
+
+// NewLLMProvider creates the provider selected by config.LLMProvider.
+// An empty provider name means "openai".
+func NewLLMProvider(config *Config) (LLMProvider, error) {
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+
+	switch config.LLMProvider {
+	case "", ProviderOpenAI:
+		baseURL := config.LLMBaseURL
+		if baseURL == "" {
+			baseURL = DefaultOpenAIBaseURL
+		}
+		// Self-hosted OpenAI-compatible servers usually do not need a key
+		if config.OpenAIAPIKey == "" && baseURL == DefaultOpenAIBaseURL {
+			return nil, fmt.Errorf("OpenAI API key is required")
+		}
+		return NewOpenAIProvider(baseURL, config.OpenAIAPIKey, timeout), nil
+
+	case ProviderMock:
+		return NewMockProvider(""), nil
+
+	case ProviderReplay:
+		if config.LLMReplayDir == "" {
+			return nil, fmt.Errorf("LLM replay directory is required for provider %q", config.LLMProvider)
+		}
+		return NewReplayProvider(config.LLMReplayDir, nil), nil
+
+	case ProviderRecord:
+		if config.LLMReplayDir == "" {
+			return nil, fmt.Errorf("LLM replay directory is required for provider %q", config.LLMProvider)
+		}
+		upstream, err := NewLLMProvider(&Config{
+			OpenAIAPIKey:   config.OpenAIAPIKey,
+			LLMBaseURL:     config.LLMBaseURL,
+			TimeoutSeconds: config.TimeoutSeconds,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create upstream provider for recording: %w", err)
+		}
+		return NewReplayProvider(config.LLMReplayDir, upstream), nil
+	}
+
+	return nil, fmt.Errorf("unknown LLM provider %q", config.LLMProvider)
+}
+
+// LLMConfigured reports whether the config selects a usable LLM provider:
+// an OpenAI key, a self-hosted base URL, or a non-OpenAI provider
+func (c *Config) LLMConfigured() bool {
+	switch c.LLMProvider {
+	case "", ProviderOpenAI:
+		return c.OpenAIAPIKey != "" || (c.LLMBaseURL != "" && c.LLMBaseURL != DefaultOpenAIBaseURL)
+	}
+	return true
+}
+
+// OpenAIProvider calls an OpenAI-compatible chat completions endpoint
+type OpenAIProvider struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// OpenAI API request/response structures
+type openAIRequest struct {
+	Model       string       `json:"model"`
+	Messages    []LLMMessage `json:"messages"`
+	MaxTokens   int          `json:"max_tokens"`
+	Temperature float32      `json:"temperature"`
+}
+
+type openAIResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index        int        `json:"index"`
+		Message      LLMMessage `json:"message"`
+		FinishReason string     `json:"finish_reason"`
+	} `json:"choices"`
+	Usage LLMUsage `json:"usage"`
+}
+
+// NewOpenAIProvider creates a provider for the endpoint at baseURL
+// (e.g. "https://api.openai.com/v1" or "http://localhost:8000/v1").
+// apiKey may be empty for servers that do not require authentication.
+func NewOpenAIProvider(baseURL, apiKey string, timeout time.Duration) *OpenAIProvider {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &OpenAIProvider{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Name implements LLMProvider
+func (p *OpenAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+// Complete implements LLMProvider
+func (p *OpenAIProvider) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	jsonData, err := json.Marshal(openAIRequest(request))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call chat completions API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chat completions API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var completion openAIResponse
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in chat completions response")
+	}
+
+	return &LLMResponse{
+		Content: completion.Choices[0].Message.Content,
+		Model:   completion.Model,
+		Usage:   completion.Usage,
+	}, nil
+}
+
+// MockProvider returns canned responses without any network access.
+// Rules are matched in the order they were added against the content of
+// the last message; the fallback is returned when no rule matches.
+type MockProvider struct {
+	mu       sync.Mutex
+	rules    []mockRule
+	fallback string
+	requests []LLMRequest
+}
+
+type mockRule struct {
+	contains string
+	response string
+	err      error
+}
+
+// NewMockProvider creates a mock provider with the given fallback response
+func NewMockProvider(fallback string) *MockProvider {
+	return &MockProvider{fallback: fallback}
+}
+
+// On responds with response when the last message contains substring
+func (p *MockProvider) On(substring, response string) *MockProvider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = append(p.rules, mockRule{contains: substring, response: response})
+	return p
+}
+
+// OnError fails requests whose last message contains substring
+func (p *MockProvider) OnError(substring string, err error) *MockProvider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = append(p.rules, mockRule{contains: substring, err: err})
+	return p
+}
+
+// Requests returns the requests received so far
+func (p *MockProvider) Requests() []LLMRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]LLMRequest(nil), p.requests...)
+}
+
+// Name implements LLMProvider
+func (p *MockProvider) Name() string {
+	return ProviderMock
+}
+
+// Complete implements LLMProvider
+func (p *MockProvider) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, request)
+
+	last := ""
+	if len(request.Messages) > 0 {
+		last = request.Messages[len(request.Messages)-1].Content
+	}
+
+	content := p.fallback
+	for _, rule := range p.rules {
+		if strings.Contains(last, rule.contains) {
+			if rule.err != nil {
+				return nil, rule.err
+			}
+			content = rule.response
+			break
+		}
+	}
+
+	// Approximate token counts by whitespace-separated words
+	promptTokens := 0
+	for _, msg := range request.Messages {
+		promptTokens += len(strings.Fields(msg.Content))
+	}
+	completionTokens := len(strings.Fields(content))
+
+	return &LLMResponse{
+		Content: content,
+		Model:   request.Model,
+		Usage: LLMUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}, nil
+}
+
+// ReplayProvider serves responses recorded on disk, one JSON file per
+// request keyed by a hash of the request. With an upstream provider it runs
+// in record mode: misses are forwarded upstream and the result is saved.
+type ReplayProvider struct {
+	dir      string
+	upstream LLMProvider
+	mu       sync.Mutex
+}
+
+// replayRecord is the on-disk fixture format
+type replayRecord struct {
+	Request  LLMRequest  `json:"request"`
+	Response LLMResponse `json:"response"`
+}
+
+// NewReplayProvider creates a replay provider reading fixtures from dir.
+// If upstream is non-nil, missing fixtures are recorded from it.
+func NewReplayProvider(dir string, upstream LLMProvider) *ReplayProvider {
+	return &ReplayProvider{dir: dir, upstream: upstream}
+}
+
+// Name implements LLMProvider
+func (p *ReplayProvider) Name() string {
+	if p.upstream != nil {
+		return ProviderRecord
+	}
+	return ProviderReplay
+}
+
+// FixturePath returns the fixture file used for a request
+func (p *ReplayProvider) FixturePath(request LLMRequest) string {
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return filepath.Join(p.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// Complete implements LLMProvider
+func (p *ReplayProvider) Complete(ctx context.Context, request LLMRequest) (*LLMResponse, error) {
+	path := p.FixturePath(request)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var record replayRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+		}
+		return &record.Response, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read fixture %s: %w", path, err)
+	}
+
+	if p.upstream == nil {
+		return nil, fmt.Errorf("no recorded response for request (expected fixture %s)", path)
+	}
+
+	response, err := p.upstream.Complete(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.save(path, replayRecord{Request: request, Response: *response}); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// save writes a fixture atomically
+func (p *ReplayProvider) save(path string, record replayRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
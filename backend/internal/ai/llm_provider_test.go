@@ -0,0 +1,146 @@
+/**
+ * LLM Provider Tests
+ *
+ * Tests the OpenAI-compatible, mock and record/replay providers without
+ * network access
+ */
+
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// TestOpenAIProviderBaseURL tests requests go to a configurable OpenAI-compatible endpoint
+func TestOpenAIProviderBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Expected no Authorization header without a key, got %q", auth)
+		}
+
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.Model != "llama-3" || len(req.Messages) != 1 {
+			t.Errorf("Unexpected request: %+v", req)
+		}
+
+		w.Write([]byte(`{"model":"llama-3","choices":[{"message":{"role":"assistant","content":"hello"}}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.LLMBaseURL = server.URL + "/v1/"
+	if !config.LLMConfigured() {
+		t.Fatal("Expected a custom base URL to count as a configured provider")
+	}
+
+	provider, err := NewLLMProvider(config)
+	if err != nil {
+		t.Fatalf("NewLLMProvider failed: %v", err)
+	}
+
+	resp, err := provider.Complete(context.Background(), LLMRequest{
+		Model:    "llama-3",
+		Messages: []LLMMessage{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if resp.Content != "hello" || resp.Usage.TotalTokens != 4 {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+}
+
+// TestNewLLMProviderSelection tests provider selection through Config
+func TestNewLLMProviderSelection(t *testing.T) {
+	config := DefaultConfig()
+	if config.LLMConfigured() {
+		t.Error("Default config without a key should not be configured")
+	}
+	if _, err := NewLLMProvider(config); err == nil {
+		t.Error("Expected error for OpenAI without a key")
+	}
+
+	config.LLMProvider = ProviderMock
+	if provider, err := NewLLMProvider(config); err != nil || provider.Name() != ProviderMock {
+		t.Errorf("Expected mock provider, got %v, %v", provider, err)
+	}
+
+	config.LLMProvider = ProviderReplay
+	if _, err := NewLLMProvider(config); err == nil {
+		t.Error("Expected error for replay without a directory")
+	}
+
+	config.LLMProvider = "unknown"
+	if _, err := NewLLMProvider(config); err == nil {
+		t.Error("Expected error for unknown provider")
+	}
+}
+
+// TestReplayProviderRecordAndReplay tests recording misses and replaying them from disk
+func TestReplayProviderRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	request := LLMRequest{Model: "gpt-4", Messages: []LLMMessage{{Role: "user", Content: "Query: TP53"}}}
+
+	upstream := NewMockProvider("").On("TP53", "SELECT * FROM variants WHERE gene = 'TP53'")
+	recorder := NewReplayProvider(dir, upstream)
+	if _, err := recorder.Complete(context.Background(), request); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if _, err := os.Stat(recorder.FixturePath(request)); err != nil {
+		t.Fatalf("Expected fixture to be written: %v", err)
+	}
+
+	replay := NewReplayProvider(dir, nil)
+	resp, err := replay.Complete(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if resp.Content != "SELECT * FROM variants WHERE gene = 'TP53'" {
+		t.Errorf("Unexpected replayed content: %q", resp.Content)
+	}
+
+	request.Messages[0].Content = "Query: KRAS"
+	if _, err := replay.Complete(context.Background(), request); err == nil {
+		t.Error("Expected error for request without a fixture")
+	}
+}
+
+// TestNLQueryEngineWithMockProvider tests SQL generation through a provider and the offline fallback
+func TestNLQueryEngineWithMockProvider(t *testing.T) {
+	mock := NewMockProvider("").
+		On("Query: Show BRAF variants", "```sql\nSELECT * FROM variants WHERE gene = 'BRAF'\n```").
+		OnError("Query: Show me rare variants", errors.New("connection refused"))
+	engine := NewNLQueryEngineWithProvider(mock, "test-model")
+
+	result, err := engine.ConvertToSQL("user", "Show BRAF variants")
+	if err != nil {
+		t.Fatalf("ConvertToSQL failed: %v", err)
+	}
+	if result.GeneratedSQL != "SELECT * FROM variants WHERE gene = 'BRAF'" || result.Generator != ProviderMock {
+		t.Errorf("Unexpected result: %s (%s)", result.GeneratedSQL, result.Generator)
+	}
+	if requests := mock.Requests(); len(requests) != 1 || requests[0].Model != "test-model" {
+		t.Errorf("Unexpected requests: %+v", requests)
+	}
+
+	// Provider failure falls back to rule-based translation
+	result, err = engine.ConvertToSQL("user", "Show me rare variants")
+	if err != nil {
+		t.Fatalf("ConvertToSQL failed: %v", err)
+	}
+	if result.Generator != GeneratorRuleBased || result.GeneratedSQL != "SELECT * FROM variants WHERE af < 0.001" {
+		t.Errorf("Expected rule-based fallback, got %s (%s)", result.GeneratedSQL, result.Generator)
+	}
+}
@@ -1,7 +1,8 @@
 /**
  * Natural Language Query Engine
  *
- * Converts natural language queries to SQL using GPT-4
+ * Converts natural language queries to SQL using GPT-4, with an offline
+ * rule-based translator used when no API key is configured
  * Implements security validation and SQL injection prevention
  *
  * Security Features:
@@ -15,12 +16,9 @@
 package ai
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -28,23 +26,28 @@ import (
 
 // NLQueryEngine converts natural language to SQL
 type NLQueryEngine struct {
-	apiKey         string
-	model          string
-	rateLimiter    *RateLimiter
-	queryCache     *QueryCache
+	provider        LLMProvider // nil means offline rule-based translation only
+	model           string
+	rateLimiter     *RateLimiter
+	queryCache      *QueryCache
 	validationRules *ValidationRules
-	mu             sync.RWMutex
+	translator      *RuleBasedTranslator // Offline fallback when no API key or the API call fails
+	variantStore    *VariantStore
+	execLimits      ExecutionLimits
+	mu              sync.RWMutex
 }
 
 // QueryResult contains the SQL query and metadata
 type QueryResult struct {
-	OriginalQuery   string    `json:"original_query"`
-	GeneratedSQL    string    `json:"generated_sql"`
-	IsValid         bool      `json:"is_valid"`
-	ValidationError string    `json:"validation_error,omitempty"`
-	Explanation     string    `json:"explanation"`
-	Timestamp       time.Time `json:"timestamp"`
-	ExecutionTimeMs int64     `json:"execution_time_ms"`
+	OriginalQuery     string              `json:"original_query"`
+	GeneratedSQL      string              `json:"generated_sql"`
+	IsValid           bool                `json:"is_valid"`
+	ValidationError   string              `json:"validation_error,omitempty"`
+	ValidationDetails *SQLValidationError `json:"validation_details,omitempty"`
+	Explanation       string              `json:"explanation"`
+	Generator         string              `json:"generator"` // LLM provider name or "rule_based"
+	Timestamp         time.Time           `json:"timestamp"`
+	ExecutionTimeMs   int64               `json:"execution_time_ms"`
 }
 
 // ValidationRules defines security rules for SQL validation
@@ -55,6 +58,9 @@ type ValidationRules struct {
 	MaxQueryLength    int
 	AllowJoins        bool
 	AllowSubqueries   bool
+	AllowedColumns    map[string][]string // Per-table column whitelist; tables not listed are unrestricted
+	AllowedFunctions  []string            // nil means DefaultAllowedFunctions
+	MaxPredicateDepth int                 // Max AND/OR/NOT nesting in WHERE/HAVING; 0 means unlimited
 }
 
 // RateLimiter implements per-user rate limiting
@@ -72,13 +78,39 @@ type QueryCache struct {
 	mu    sync.RWMutex
 }
 
-// NewNLQueryEngine creates a new natural language query engine
+// NewNLQueryEngine creates a new natural language query engine backed by
+// OpenAI. An empty apiKey gives an offline engine using rule-based translation.
 func NewNLQueryEngine(apiKey string) *NLQueryEngine {
+	var provider LLMProvider
+	if apiKey != "" {
+		provider = NewOpenAIProvider(DefaultOpenAIBaseURL, apiKey, 30*time.Second)
+	}
+	return NewNLQueryEngineWithProvider(provider, "gpt-4") // Use GPT-4 for best accuracy
+}
+
+// NewNLQueryEngineFromConfig creates an engine using the LLM provider
+// selected by config. If no provider is configured the engine is offline.
+func NewNLQueryEngineFromConfig(config *Config) (*NLQueryEngine, error) {
+	if !config.LLMConfigured() {
+		return NewNLQueryEngineWithProvider(nil, ""), nil
+	}
+	provider, err := NewLLMProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewNLQueryEngineWithProvider(provider, config.OpenAIModel), nil
+}
+
+// NewNLQueryEngineWithProvider creates an engine using the given LLM provider
+// and model. A nil provider gives an offline engine.
+func NewNLQueryEngineWithProvider(provider LLMProvider, model string) *NLQueryEngine {
 	return &NLQueryEngine{
-		apiKey:      apiKey,
-		model:       "gpt-4", // Use GPT-4 for best accuracy
+		provider:    provider,
+		model:       model,
 		rateLimiter: NewRateLimiter(10, time.Minute), // 10 queries per minute
 		queryCache:  NewQueryCache(5 * time.Minute),
+		execLimits:  DefaultExecutionLimits(),
+		translator:  NewRuleBasedTranslator(),
 		validationRules: &ValidationRules{
 			AllowedKeywords: []string{
 				"SELECT", "FROM", "WHERE", "AND", "OR", "NOT",
@@ -98,11 +130,17 @@ func NewNLQueryEngine(apiKey string) *NLQueryEngine {
 			MaxQueryLength:  1000,
 			AllowJoins:      false, // No joins for security
 			AllowSubqueries: false, // No subqueries for security
+			AllowedColumns: map[string][]string{
+				"variants": VariantColumns,
+			},
+			AllowedFunctions:  DefaultAllowedFunctions,
+			MaxPredicateDepth: 8,
 		},
 	}
 }
 
-// ConvertToSQL converts natural language to SQL using GPT-4
+// ConvertToSQL converts natural language to SQL using GPT-4, or the
+// offline rule-based translator when no API key is configured
 func (nq *NLQueryEngine) ConvertToSQL(userID, naturalLanguageQuery string) (*QueryResult, error) {
 	startTime := time.Now()
 
@@ -117,23 +155,29 @@ func (nq *NLQueryEngine) ConvertToSQL(userID, naturalLanguageQuery string) (*Que
 		return cached, nil
 	}
 
-	// Generate SQL using GPT-4
-	sql, explanation, err := nq.generateSQL(naturalLanguageQuery)
+	// Generate SQL using GPT-4 (falls back to rule-based translation)
+	sql, explanation, generator, err := nq.generateSQL(naturalLanguageQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate SQL: %w", err)
 	}
 
 	// Validate SQL for security
-	isValid, validationError := nq.validateSQL(sql)
+	details := nq.validationRules.ValidateSQL(sql)
+	isValid, validationError := details == nil, ""
+	if details != nil {
+		validationError = details.Message
+	}
 
 	result := &QueryResult{
-		OriginalQuery:   naturalLanguageQuery,
-		GeneratedSQL:    sql,
-		IsValid:         isValid,
-		ValidationError: validationError,
-		Explanation:     explanation,
-		Timestamp:       time.Now(),
-		ExecutionTimeMs: time.Since(startTime).Milliseconds(),
+		OriginalQuery:     naturalLanguageQuery,
+		GeneratedSQL:      sql,
+		IsValid:           isValid,
+		ValidationError:   validationError,
+		ValidationDetails: details,
+		Explanation:       explanation,
+		Generator:         generator,
+		Timestamp:         time.Now(),
+		ExecutionTimeMs:   time.Since(startTime).Milliseconds(),
 	}
 
 	// Cache the result if valid
@@ -144,74 +188,55 @@ func (nq *NLQueryEngine) ConvertToSQL(userID, naturalLanguageQuery string) (*Que
 	return result, nil
 }
 
-// generateSQL uses GPT-4 to generate SQL from natural language
-func (nq *NLQueryEngine) generateSQL(query string) (sql, explanation string, err error) {
-	// Build prompt with schema documentation and examples
-	prompt := nq.buildPrompt(query)
+// GeneratorRuleBased is reported in QueryResult.Generator for offline translations
+const GeneratorRuleBased = "rule_based"
 
-	// Call OpenAI API
-	reqBody := map[string]interface{}{
-		"model": nq.model,
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "You are a SQL expert specializing in genomic data queries. Convert natural language to SQL queries for the GenomeVedic database. Return ONLY valid SQL queries without any markdown formatting or explanation prefixes.",
-			},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"temperature": 0.0, // Deterministic output
-		"max_tokens":  500,
+// generateSQL generates SQL with the LLM provider when one is configured,
+// falling back to the rule-based translator if there is none or the call fails
+func (nq *NLQueryEngine) generateSQL(query string) (sql, explanation, generator string, err error) {
+	if nq.provider == nil {
+		sql, explanation, err = nq.translator.Translate(query)
+		return sql, explanation, GeneratorRuleBased, err
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to marshal request: %w", err)
+	sql, explanation, err = nq.generateRemoteSQL(query)
+	if err == nil {
+		return sql, explanation, nq.provider.Name(), nil
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", "", fmt.Errorf("failed to create request: %w", err)
+	sql, explanation, fallbackErr := nq.translator.Translate(query)
+	if fallbackErr != nil {
+		return "", "", "", fmt.Errorf("%w (rule-based fallback: %v)", err, fallbackErr)
 	}
+	return sql, explanation + " [LLM provider unavailable]", GeneratorRuleBased, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+nq.apiKey)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to call OpenAI API: %w", err)
-	}
-	defer resp.Body.Close()
+// generateRemoteSQL uses the LLM provider to generate SQL from natural language
+func (nq *NLQueryEngine) generateRemoteSQL(query string) (sql, explanation string, err error) {
+	// Build prompt with schema documentation and examples
+	prompt := nq.buildPrompt(query)
 
-	body, err := io.ReadAll(resp.Body)
+	// Call LLM provider
+	completion, err := nq.provider.Complete(context.Background(), LLMRequest{
+		Model: nq.model,
+		Messages: []LLMMessage{
+			{
+				Role:    "system",
+				Content: "You are a SQL expert specializing in genomic data queries. Convert natural language to SQL queries for the GenomeVedic database. Return ONLY valid SQL queries without any markdown formatting or explanation prefixes.",
+			},
+			{
+				Role:    "user",
+				Content: prompt,
+			},
+		},
+		Temperature: 0.0, // Deterministic output
+		MaxTokens:   500,
+	})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("OpenAI API error (status %d): %s", resp.StatusCode, string(body))
-	}
-
-	var result struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", "", fmt.Errorf("failed to parse response: %w", err)
+		return "", "", fmt.Errorf("failed to call %s provider: %w", nq.provider.Name(), err)
 	}
 
-	if len(result.Choices) == 0 {
-		return "", "", fmt.Errorf("no response from OpenAI API")
-	}
-
-	response := strings.TrimSpace(result.Choices[0].Message.Content)
+	response := strings.TrimSpace(completion.Content)
 
 	// Clean up response (remove markdown formatting if present)
 	response = strings.TrimPrefix(response, "```sql")
@@ -273,73 +298,40 @@ func (nq *NLQueryEngine) buildPrompt(query string) string {
 
 // validateSQL validates SQL query for security
 func (nq *NLQueryEngine) validateSQL(sql string) (bool, string) {
-	sqlUpper := strings.ToUpper(sql)
-
-	// Check query length
-	if len(sql) > nq.validationRules.MaxQueryLength {
-		return false, "query exceeds maximum length"
-	}
-
-	// Check for forbidden keywords
-	for _, keyword := range nq.validationRules.ForbiddenKeywords {
-		if strings.Contains(sqlUpper, keyword) {
-			return false, fmt.Sprintf("forbidden keyword detected: %s", keyword)
-		}
-	}
-
-	// Must start with SELECT
-	if !strings.HasPrefix(sqlUpper, "SELECT") {
-		return false, "query must start with SELECT"
+	if err := nq.validationRules.ValidateSQL(sql); err != nil {
+		return false, err.Message
 	}
+	return true, ""
+}
 
-	// Check for allowed tables only
-	hasValidTable := false
-	for _, table := range nq.validationRules.AllowedTables {
-		if strings.Contains(sqlUpper, strings.ToUpper(table)) {
-			hasValidTable = true
-			break
-		}
-	}
-	if !hasValidTable {
-		return false, "query must reference allowed tables only (variants)"
-	}
+// AttachVariantStore sets the store that ExecuteQuery runs validated SQL against
+func (nq *NLQueryEngine) AttachVariantStore(store *VariantStore, limits ExecutionLimits) {
+	nq.mu.Lock()
+	defer nq.mu.Unlock()
+	nq.variantStore = store
+	nq.execLimits = limits
+}
 
-	// Check for joins if not allowed
-	if !nq.validationRules.AllowJoins {
-		if strings.Contains(sqlUpper, "JOIN") {
-			return false, "JOIN operations are not allowed"
-		}
-	}
+// ErrNoVariantStore is returned by ExecuteQuery when no variant store is
+// attached; the generated SQL is still valid
+var ErrNoVariantStore = errors.New("no variant store configured")
 
-	// Check for subqueries if not allowed
-	if !nq.validationRules.AllowSubqueries {
-		if strings.Count(sqlUpper, "SELECT") > 1 {
-			return false, "subqueries are not allowed"
-		}
+// ExecuteQuery runs a validated query against the attached variant store.
+// Results that failed validation are never executed.
+func (nq *NLQueryEngine) ExecuteQuery(ctx context.Context, result *QueryResult) (*QueryExecution, error) {
+	if !result.IsValid {
+		return nil, fmt.Errorf("refusing to execute invalid query: %s", result.ValidationError)
 	}
 
-	// Check for dangerous patterns
-	dangerousPatterns := []string{
-		`\bEXEC\b`,
-		`\bEXECUTE\b`,
-		`\bxp_\w+`,
-		`\bsp_\w+`,
-		`;\s*DROP`,
-		`;\s*DELETE`,
-		`--\s*$`,
-		`/\*.*\*/`,
-		`'\s*OR\s*'1'\s*=\s*'1`,
-		`'\s*OR\s*1\s*=\s*1`,
-	}
+	nq.mu.RLock()
+	store, limits := nq.variantStore, nq.execLimits
+	nq.mu.RUnlock()
 
-	for _, pattern := range dangerousPatterns {
-		matched, _ := regexp.MatchString(pattern, sqlUpper)
-		if matched {
-			return false, "query contains dangerous pattern"
-		}
+	if store == nil {
+		return nil, ErrNoVariantStore
 	}
 
-	return true, ""
+	return store.Execute(ctx, result.GeneratedSQL, limits)
 }
 
 // GetExamples returns example query mappings
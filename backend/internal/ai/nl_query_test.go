@@ -125,6 +125,93 @@ func TestValidateSQL(t *testing.T) {
 	}
 }
 
+// TestValidateSQLTokens tests cases keyword matching on raw text got wrong
+func TestValidateSQLTokens(t *testing.T) {
+	rules := &ValidationRules{
+		ForbiddenKeywords: []string{"DROP", "DELETE", "UPDATE", "INSERT", "SET", "UNION"},
+		AllowedTables:     []string{"variants"},
+		MaxQueryLength:    1000,
+	}
+
+	valid := []string{
+		"SELECT created_set, updated_at FROM variants",
+		"SELECT * FROM variants WHERE gene = 'DROP'",
+		"SELECT * FROM variants v WHERE v.gene = 'TP53';",
+	}
+	for _, sql := range valid {
+		if err := rules.ValidateSQL(sql); err != nil {
+			t.Errorf("Expected %q to be valid, got: %v", sql, err)
+		}
+	}
+
+	invalid := []struct {
+		sql      string
+		code     string
+		position int
+	}{
+		{"SELECT * FROM variants -- comment", ErrCodeComment, 23},
+		{"SELECT * FROM variants /* x */ WHERE gene = 'TP53'", ErrCodeComment, 23},
+		{"SELECT * FROM variants UNION SELECT * FROM variants", ErrCodeForbiddenKeyword, 23},
+		{"SELECT * FROM variants; DROP TABLE variants", ErrCodeForbiddenKeyword, 24},
+		{"SELECT * FROM variants WHERE", ErrCodeSyntax, 28},
+		{"SELECT * FROM variants, genes", ErrCodeJoin, 24},
+		{"SELECT * FROM variants WHERE 1 = 1", ErrCodeDangerous, 31},
+		{"SELECT * FROM variants x WHERE y.gene = 'TP53'", ErrCodeTable, 31},
+	}
+	for _, tt := range invalid {
+		err := rules.ValidateSQL(tt.sql)
+		if err == nil {
+			t.Errorf("Expected %q to be rejected", tt.sql)
+			continue
+		}
+		if err.Code != tt.code || err.Position != tt.position {
+			t.Errorf("%q: expected %s at %d, got %s at %d (%v)", tt.sql, tt.code, tt.position, err.Code, err.Position, err)
+		}
+	}
+}
+
+// TestValidateSQLDefaults tests the default engine rules (column and function whitelists, depth)
+func TestValidateSQLDefaults(t *testing.T) {
+	engine := NewNLQueryEngine("")
+	rules := engine.validationRules
+
+	// Every documented example must pass the default rules
+	for _, example := range ExampleMappings {
+		if err := rules.ValidateSQL(example.SQL); err != nil {
+			t.Errorf("Example %q rejected: %v", example.SQL, err)
+		}
+	}
+
+	tests := []struct {
+		sql   string
+		code  string
+		token string
+	}{
+		{"SELECT password FROM variants", ErrCodeColumn, "password"},
+		{"SELECT gene FROM variants ORDER BY secret", ErrCodeColumn, "secret"},
+		{"SELECT SLEEP(10) FROM variants", ErrCodeFunction, "SLEEP"},
+		{"SELECT * FROM variants WHERE (gene = 'A' OR (af > 0.1 AND (position > 1 OR (position < 5 AND (af < 0.5 OR (chromosome = '1' AND (gene = 'B' OR (af > 0.2 AND (position > 3 OR NOT (chromosome = '2'))))))))))", ErrCodeTooComplex, ""},
+	}
+	for _, tt := range tests {
+		err := rules.ValidateSQL(tt.sql)
+		if err == nil {
+			t.Errorf("Expected %q to be rejected", tt.sql)
+			continue
+		}
+		if err.Code != tt.code {
+			t.Errorf("%q: expected code %s, got %s (%v)", tt.sql, tt.code, err.Code, err)
+		}
+		if tt.token != "" && err.Token != tt.token {
+			t.Errorf("%q: expected token %q, got %q", tt.sql, tt.token, err.Token)
+		}
+	}
+
+	// Output aliases may be referenced later in the query
+	if err := rules.ValidateSQL("SELECT gene, COUNT(*) AS n FROM variants GROUP BY gene ORDER BY n DESC"); err != nil {
+		t.Errorf("Expected alias reference to be valid, got: %v", err)
+	}
+}
+
 // TestRateLimiter tests rate limiting logic
 func TestRateLimiter(t *testing.T) {
 	limiter := NewRateLimiter(3, time.Second)
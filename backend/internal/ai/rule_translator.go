@@ -0,0 +1,504 @@
+/**
+ * Rule-Based Natural Language to SQL Translator
+ *
+ * Deterministic, offline fallback for NLQueryEngine. It recognises the
+ * common query shapes documented in ExampleMappings (gene lookups, allele
+ * frequency thresholds, chromosome and region ranges, clinical significance,
+ * mutation type, hotspots and ordering) with a fixed set of phrase rules,
+ * so air-gapped installations can run natural language queries without an
+ * OpenAI key.
+ *
+ * The translator only ever emits SQL built from whitelisted columns and
+ * literals it constructed itself; its output still goes through the normal
+ * validator before execution.
+ */
+
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RuleBasedTranslator converts natural language to SQL using phrase rules
+type RuleBasedTranslator struct {
+	knownGenes map[string]bool
+}
+
+// geneRegion is a gene's locus on GRCh37, used for "TP53 region" style queries
+type geneRegion struct {
+	Chromosome string
+	Start      uint64
+	End        uint64
+}
+
+// knownGeneRegions lists GRCh37 coordinates for the genes in SchemaDocumentation
+var knownGeneRegions = map[string]geneRegion{
+	"TP53":   {"17", 7571720, 7590868},
+	"BRCA1":  {"17", 41196312, 41277500},
+	"BRCA2":  {"13", 32889611, 32973805},
+	"KRAS":   {"12", 25358180, 25403854},
+	"EGFR":   {"7", 55086725, 55324313},
+	"PTEN":   {"10", 89623195, 89728532},
+	"PIK3CA": {"3", 178866311, 178952497},
+	"APC":    {"5", 112043195, 112181936},
+	"BRAF":   {"7", 140433813, 140624564},
+}
+
+// geneGroups maps gene-set phrases to their member genes
+var geneGroups = []struct {
+	Pattern *regexp.Regexp
+	Name    string
+	Genes   []string
+}{
+	{regexp.MustCompile(`\btumou?r[- ]suppressors?(?: genes?)?\b`), "tumor suppressor genes", []string{"TP53", "BRCA1", "BRCA2", "PTEN", "APC"}},
+	{regexp.MustCompile(`\bdna[- ]repair(?: genes?)?\b`), "DNA repair genes", []string{"BRCA1", "BRCA2", "MLH1", "MSH2", "PTEN"}},
+	{regexp.MustCompile(`\boncogenes?\b`), "oncogenes", []string{"KRAS", "BRAF", "EGFR", "PIK3CA", "MYC"}},
+}
+
+// additionalGenes are recognised regardless of case, on top of knownGeneRegions
+var additionalGenes = []string{
+	"MLH1", "MSH2", "MSH6", "PMS2", "MYC", "NRAS", "HRAS", "IDH1", "IDH2", "ALK",
+	"RB1", "CDKN2A", "NF1", "ATM", "CHEK2", "PALB2", "ERBB2", "MET", "KIT", "JAK2",
+	"SMAD4", "CTNNB1", "FBXW7", "ARID1A", "VHL", "NOTCH1", "STK11", "KEAP1",
+}
+
+// geneStopwords are upper-case tokens that look like gene symbols but are not
+var geneStopwords = map[string]bool{
+	"SNP": true, "SNV": true, "SNPS": true, "SNVS": true, "CNV": true, "DNA": true, "RNA": true,
+	"VUS": true, "MAF": true, "VAF": true, "AF": true, "ID": true, "IDS": true, "COSMIC": true,
+	"SQL": true, "GRCH37": true, "GRCH38": true, "HG19": true, "HG38": true, "MT": true,
+}
+
+// Phrase rules (applied to the lower-cased query)
+var (
+	ruleCount         = regexp.MustCompile(`^\s*(?:how many|count(?: the| all)?)\b`)
+	ruleAggregate     = regexp.MustCompile(`\b(?:most (?:common|frequent|frequently mutated|mutated|recurrent)|top (?:\d+ )?(?:mutated )?genes)\b`)
+	ruleLimit         = regexp.MustCompile(`\b(?:top|first|limit(?: to)?)\s+(\d+)\b`)
+	ruleOrder         = regexp.MustCompile(`\b(?:order(?:ed)?|sort(?:ed)?|rank(?:ed)?)\s+by\s+(?:the\s+)?(allele frequency|frequency|maf|vaf|af|sample count|samples|sample_count|recurrence|position|location)(?:\s+(asc(?:ending)?|desc(?:ending)?))?\b`)
+	ruleRange         = regexp.MustCompile(`\b(?:chr)?([0-9]{1,2}|x|y|mt|m):([0-9][0-9,]*)\s*-\s*([0-9][0-9,]*)\b`)
+	ruleChromosome    = regexp.MustCompile(`\b(?:chromosome|chrom|chr)\s*([0-9]{1,2}|x|y|mt|m)\b`)
+	ruleSexChromosome = regexp.MustCompile(`\bsex chromosomes?\b`)
+	ruleMitochondrial = regexp.MustCompile(`\bmitochondri(?:al|a|on)\b`)
+	ruleBetween       = regexp.MustCompile(`\b(?:positions?\s+)?between\s+([0-9][0-9,]*)\s+(?:and|to)\s+([0-9][0-9,]*)\b`)
+	rulePosition      = regexp.MustCompile(`\b(?:position|pos)\s*(>=|<=|>|<|=|above|over|after|greater than|below|under|before|less than)\s*([0-9][0-9,]*)\b`)
+	ruleGeneRegion    = regexp.MustCompile(`\b(?:region|locus|loci)\b`)
+	ruleAF            = regexp.MustCompile(`\b(?:maf|vaf|af|allele frequency|frequency)\s*(?:of\s+|is\s+)?(>=|<=|>|<|=|above|over|greater than|more than|higher than|at least|below|under|less than|lower than|at most)\s*([0-9]*\.?[0-9]+)\s*(%)?`)
+	ruleHighFrequency = regexp.MustCompile(`\bhigh[- ]frequency\b`)
+	ruleRare          = regexp.MustCompile(`\b(?:rare|low[- ]frequency)\b`)
+	ruleCommon        = regexp.MustCompile(`\bcommon\b`)
+	ruleHotspot       = regexp.MustCompile(`\bhot ?spots?\b`)
+	ruleSamples       = regexp.MustCompile(`\b(?:sample[_ ]count\s*(>=|<=|>|<|=|above|over|greater than|more than|at least|below|under|less than|at most)|(?:in|seen in|found in|present in)\s+(more than|over|at least|fewer than|less than|under|at most))\s*([0-9]+)(?:\s+samples?)?\b`)
+	ruleCosmicID      = regexp.MustCompile(`\b(?:with|having|has)\s+(?:an?\s+)?cosmic(?:\s+ids?)?\b`)
+	ruleRSID          = regexp.MustCompile(`\b(?:with|having|has)\s+(?:an?\s+)?(?:rsids?|dbsnp(?:\s+ids?)?)\b`)
+	ruleAnyVariant    = regexp.MustCompile(`\b(?:variants?|mutations?|snvs?|snps?|indels?|alterations?)\b`)
+)
+
+// significanceRules map clinical significance phrases to pathogenicity values.
+// Longer phrases come first so "likely pathogenic" is not read as "pathogenic".
+var significanceRules = []struct {
+	Pattern *regexp.Regexp
+	Value   string
+}{
+	{regexp.MustCompile(`\blikely[- ]pathogenic\b`), "Likely Pathogenic"},
+	{regexp.MustCompile(`\blikely[- ]benign\b`), "Likely Benign"},
+	{regexp.MustCompile(`\b(?:vus|uncertain(?: significance)?|unknown significance)\b`), "Uncertain"},
+	{regexp.MustCompile(`\bpathogenic\b`), "Pathogenic"},
+	{regexp.MustCompile(`\bbenign\b`), "Benign"},
+}
+
+// mutationTypeRules map mutation type phrases to mutation_type values
+var mutationTypeRules = []struct {
+	Pattern *regexp.Regexp
+	Value   string
+}{
+	{regexp.MustCompile(`\bmissense\b`), "Missense"},
+	{regexp.MustCompile(`\b(?:nonsense|stop[- ]gain(?:ed)?)\b`), "Nonsense"},
+	{regexp.MustCompile(`\bframe[- ]?shift\b`), "Frameshift"},
+	{regexp.MustCompile(`\bsplic(?:e|ing)(?: site)?\b`), "Splice"},
+	{regexp.MustCompile(`\bin[- ]?frame\b`), "Inframe"},
+	{regexp.MustCompile(`\b(?:synonymous|silent)\b`), "Synonymous"},
+}
+
+// ruleQuery accumulates the clauses recognised in one query
+type ruleQuery struct {
+	text         string // Lower-cased query; matched phrases are blanked out
+	genes        []string
+	geneGroup    []string
+	chromosomes  []string
+	position     string
+	significance []string
+	mutationType []string
+	af           string
+	samples      string
+	extra        []string
+	descriptions []string
+	orderBy      string
+	limit        int
+	aggregate    bool
+	count        bool
+}
+
+// NewRuleBasedTranslator creates a rule-based translator
+func NewRuleBasedTranslator() *RuleBasedTranslator {
+	known := make(map[string]bool)
+	for gene := range knownGeneRegions {
+		known[gene] = true
+	}
+	for _, gene := range additionalGenes {
+		known[gene] = true
+	}
+	return &RuleBasedTranslator{knownGenes: known}
+}
+
+// Translate converts a natural language query into SQL and a short explanation
+func (t *RuleBasedTranslator) Translate(query string) (sql, explanation string, err error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", "", fmt.Errorf("empty query")
+	}
+
+	q := &ruleQuery{text: strings.ToLower(query)}
+
+	// Query shape
+	if q.take(ruleCount) != nil {
+		q.count = true
+	}
+	if q.take(ruleAggregate) != nil {
+		q.aggregate = true
+		q.limit = 10
+	}
+	if m := q.take(ruleLimit); m != nil {
+		q.limit, _ = strconv.Atoi(m[1])
+	}
+	if m := q.take(ruleOrder); m != nil {
+		q.setOrder(m[1], m[2])
+	}
+
+	// Genes: explicit symbols, gene sets, and gene loci
+	t.extractGenes(q, query)
+	for _, group := range geneGroups {
+		if q.take(group.Pattern) != nil {
+			q.geneGroup = append(q.geneGroup, group.Genes...)
+			q.describe("gene in %s", group.Name)
+		}
+	}
+
+	// Chromosome and position
+	if m := q.take(ruleRange); m != nil {
+		q.chromosomes = []string{normalizeRuleChromosome(m[1])}
+		q.position = fmt.Sprintf("position BETWEEN %s AND %s", stripCommas(m[2]), stripCommas(m[3]))
+		q.describe("region chr%s:%s-%s", q.chromosomes[0], stripCommas(m[2]), stripCommas(m[3]))
+	}
+	for m := q.take(ruleChromosome); m != nil; m = q.take(ruleChromosome) {
+		q.addChromosome(normalizeRuleChromosome(m[1]))
+	}
+	if q.take(ruleSexChromosome) != nil {
+		q.addChromosome("X")
+		q.addChromosome("Y")
+	}
+	if q.take(ruleMitochondrial) != nil {
+		q.addChromosome("MT")
+	}
+	if q.take(ruleGeneRegion) != nil && len(q.genes) == 1 {
+		if region, ok := knownGeneRegions[q.genes[0]]; ok && q.position == "" {
+			q.describe("%s locus", q.genes[0])
+			q.genes = nil
+			q.chromosomes = []string{region.Chromosome}
+			q.position = fmt.Sprintf("position BETWEEN %d AND %d", region.Start, region.End)
+		}
+	}
+	if m := q.take(ruleBetween); m != nil && q.position == "" {
+		q.position = fmt.Sprintf("position BETWEEN %s AND %s", stripCommas(m[1]), stripCommas(m[2]))
+		q.describe("position between %s and %s", stripCommas(m[1]), stripCommas(m[2]))
+	}
+	if m := q.take(rulePosition); m != nil && q.position == "" {
+		op := normalizeRuleOperator(m[1])
+		q.position = fmt.Sprintf("position %s %s", op, stripCommas(m[2]))
+		q.describe("position %s %s", op, stripCommas(m[2]))
+	}
+
+	// Clinical significance and mutation type
+	for _, rule := range significanceRules {
+		if q.take(rule.Pattern) != nil {
+			q.significance = append(q.significance, rule.Value)
+			q.describe("%s significance", rule.Value)
+		}
+	}
+	for _, rule := range mutationTypeRules {
+		if q.take(rule.Pattern) != nil {
+			q.mutationType = append(q.mutationType, rule.Value)
+			q.describe("%s mutations", rule.Value)
+		}
+	}
+
+	// Allele frequency
+	if m := q.take(ruleAF); m != nil {
+		value, _ := strconv.ParseFloat(m[2], 64)
+		if m[3] == "%" {
+			value /= 100
+		}
+		op := normalizeRuleOperator(m[1])
+		q.af = fmt.Sprintf("af %s %s", op, strconv.FormatFloat(value, 'f', -1, 64))
+		q.describe("allele frequency %s %s", op, strconv.FormatFloat(value, 'f', -1, 64))
+	} else if q.take(ruleHighFrequency) != nil {
+		q.af = "af > 0.005"
+		q.describe("high allele frequency (> 0.5%%)")
+	} else if q.take(ruleRare) != nil {
+		q.af = "af < 0.001"
+		q.describe("rare (allele frequency < 0.1%%)")
+	} else if q.take(ruleCommon) != nil {
+		q.af = "af > 0.01"
+		q.describe("common (allele frequency > 1%%)")
+	}
+
+	// Recurrence
+	if m := q.take(ruleSamples); m != nil {
+		op := m[1]
+		if op == "" {
+			op = m[2]
+		}
+		op = normalizeRuleOperator(op)
+		q.samples = fmt.Sprintf("sample_count %s %s", op, m[3])
+		q.describe("sample count %s %s", op, m[3])
+	}
+	if q.take(ruleHotspot) != nil {
+		if q.samples == "" {
+			q.samples = "sample_count > 100"
+		}
+		if q.orderBy == "" {
+			q.orderBy = "sample_count DESC"
+		}
+		q.describe("hotspots (sample count > 100)")
+	}
+
+	// Database identifiers
+	if q.take(ruleCosmicID) != nil {
+		q.extra = append(q.extra, "cosmic_id IS NOT NULL AND cosmic_id != ''")
+		q.describe("has a COSMIC ID")
+	}
+	if q.take(ruleRSID) != nil {
+		q.extra = append(q.extra, "rsid IS NOT NULL AND rsid != ''")
+		q.describe("has a dbSNP ID")
+	}
+
+	conditions := q.conditions()
+	if len(conditions) == 0 && !q.aggregate && !q.count && q.orderBy == "" && !ruleAnyVariant.MatchString(q.text) {
+		return "", "", fmt.Errorf("unable to translate query offline: no recognised filters in %q", query)
+	}
+
+	return q.build(conditions), q.explain(), nil
+}
+
+// extractGenes finds gene symbols in the original (case-preserving) query
+func (t *RuleBasedTranslator) extractGenes(q *ruleQuery, query string) {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+
+	seen := make(map[string]bool)
+	for _, word := range words {
+		symbol := strings.ToUpper(word)
+		if seen[symbol] || geneStopwords[symbol] {
+			continue
+		}
+		if !t.knownGenes[symbol] && !looksLikeGeneSymbol(word) {
+			continue
+		}
+		seen[symbol] = true
+		q.genes = append(q.genes, symbol)
+		q.blank(strings.ToLower(word))
+	}
+	if len(q.genes) > 0 {
+		q.describe("gene %s", strings.Join(q.genes, ", "))
+	}
+}
+
+// looksLikeGeneSymbol accepts upper-case alphanumeric tokens with a digit (e.g. CDK12)
+func looksLikeGeneSymbol(word string) bool {
+	if len(word) < 3 || len(word) > 10 || strings.ToUpper(word) != word || strings.HasPrefix(word, "CHR") {
+		return false
+	}
+	if word[0] < 'A' || word[0] > 'Z' {
+		return false
+	}
+	return strings.ContainsAny(word, "0123456789")
+}
+
+// take finds the first match of re, blanks it out, and returns the submatches
+func (q *ruleQuery) take(re *regexp.Regexp) []string {
+	loc := re.FindStringSubmatchIndex(q.text)
+	if loc == nil {
+		return nil
+	}
+	match := make([]string, len(loc)/2)
+	for i := range match {
+		if loc[2*i] >= 0 {
+			match[i] = q.text[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	q.text = q.text[:loc[0]] + strings.Repeat(" ", loc[1]-loc[0]) + q.text[loc[1]:]
+	return match
+}
+
+// blank removes a whole-word occurrence of word from the working text
+func (q *ruleQuery) blank(word string) {
+	re := regexp.MustCompile(`\b` + regexp.QuoteMeta(word) + `\b`)
+	q.text = re.ReplaceAllStringFunc(q.text, func(s string) string {
+		return strings.Repeat(" ", len(s))
+	})
+}
+
+// describe appends a clause to the explanation
+func (q *ruleQuery) describe(format string, args ...interface{}) {
+	q.descriptions = append(q.descriptions, fmt.Sprintf(format, args...))
+}
+
+// addChromosome records a chromosome filter once
+func (q *ruleQuery) addChromosome(chr string) {
+	for _, existing := range q.chromosomes {
+		if existing == chr {
+			return
+		}
+	}
+	q.chromosomes = append(q.chromosomes, chr)
+	q.describe("chromosome %s", chr)
+}
+
+// setOrder translates an "ordered by" phrase
+func (q *ruleQuery) setOrder(field, direction string) {
+	dir := "DESC"
+	if strings.HasPrefix(direction, "asc") {
+		dir = "ASC"
+	}
+	switch field {
+	case "sample count", "samples", "sample_count", "recurrence":
+		q.orderBy = "sample_count " + dir
+	case "position", "location":
+		if direction == "" {
+			dir = "ASC"
+		}
+		q.orderBy = "chromosome " + dir + ", position " + dir
+	default:
+		q.orderBy = "af " + dir
+	}
+	q.describe("ordered by %s", strings.ToLower(q.orderBy))
+}
+
+// conditions returns the WHERE clause terms in a stable order
+func (q *ruleQuery) conditions() []string {
+	var conds []string
+	if len(q.genes) > 0 {
+		conds = append(conds, inOrEquals("gene", q.genes))
+	}
+	if len(q.chromosomes) > 0 {
+		conds = append(conds, inOrEquals("chromosome", q.chromosomes))
+	}
+	if q.position != "" {
+		conds = append(conds, q.position)
+	}
+	if len(q.significance) > 0 {
+		conds = append(conds, inOrEquals("pathogenicity", q.significance))
+	}
+	if len(q.mutationType) > 0 {
+		conds = append(conds, inOrEquals("mutation_type", q.mutationType))
+	}
+	if len(q.geneGroup) > 0 {
+		conds = append(conds, inOrEquals("gene", q.geneGroup))
+	}
+	if q.af != "" {
+		conds = append(conds, q.af)
+	}
+	if q.samples != "" {
+		conds = append(conds, q.samples)
+	}
+	return append(conds, q.extra...)
+}
+
+// build assembles the final SQL statement
+func (q *ruleQuery) build(conditions []string) string {
+	var sql strings.Builder
+	switch {
+	case q.aggregate:
+		sql.WriteString("SELECT gene, COUNT(*) as count FROM variants")
+	case q.count:
+		sql.WriteString("SELECT COUNT(*) as count FROM variants")
+	default:
+		sql.WriteString("SELECT * FROM variants")
+	}
+
+	if len(conditions) > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(strings.Join(conditions, " AND "))
+	}
+
+	if q.aggregate {
+		sql.WriteString(" GROUP BY gene ORDER BY count DESC")
+	} else if q.orderBy != "" && !q.count {
+		sql.WriteString(" ORDER BY ")
+		sql.WriteString(q.orderBy)
+	}
+
+	if q.limit > 0 && !q.count {
+		sql.WriteString(fmt.Sprintf(" LIMIT %d", q.limit))
+	}
+	return sql.String()
+}
+
+// explain summarises the recognised clauses
+func (q *ruleQuery) explain() string {
+	subject := "variants"
+	switch {
+	case q.aggregate:
+		subject = "genes ranked by number of variants"
+	case q.count:
+		subject = "number of variants"
+	}
+	if len(q.descriptions) == 0 {
+		return "Offline translation: all " + subject
+	}
+	return fmt.Sprintf("Offline translation: %s (%s)", subject, strings.Join(q.descriptions, "; "))
+}
+
+// inOrEquals renders column = 'v' for one value and column IN (...) for several
+func inOrEquals(column string, values []string) string {
+	if len(values) == 1 {
+		return fmt.Sprintf("%s = '%s'", column, values[0])
+	}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	return fmt.Sprintf("%s IN (%s)", column, strings.Join(quoted, ", "))
+}
+
+// normalizeRuleChromosome maps a chromosome token to the schema's form
+func normalizeRuleChromosome(chr string) string {
+	chr = strings.ToUpper(chr)
+	if chr == "M" {
+		return "MT"
+	}
+	return strings.TrimLeft(chr, "0")
+}
+
+// normalizeRuleOperator maps a comparison phrase to a SQL operator
+func normalizeRuleOperator(op string) string {
+	switch op {
+	case "above", "over", "after", "greater than", "more than", "higher than":
+		return ">"
+	case "below", "under", "before", "less than", "lower than", "fewer than":
+		return "<"
+	case "at least":
+		return ">="
+	case "at most":
+		return "<="
+	}
+	return op
+}
+
+// stripCommas removes thousands separators from a number
+func stripCommas(s string) string {
+	return strings.ReplaceAll(s, ",", "")
+}
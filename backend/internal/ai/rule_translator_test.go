@@ -0,0 +1,94 @@
+/**
+ * Rule-Based Translator Tests
+ *
+ * Tests offline natural language to SQL translation
+ */
+
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestRuleBasedTranslatorExamples checks every documented example translates exactly
+func TestRuleBasedTranslatorExamples(t *testing.T) {
+	translator := NewRuleBasedTranslator()
+
+	for _, example := range ExampleMappings {
+		sql, _, err := translator.Translate(example.NaturalLanguage)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", example.NaturalLanguage, err)
+			continue
+		}
+		if sql != example.SQL {
+			t.Errorf("%q:\n  got:  %s\n  want: %s", example.NaturalLanguage, sql, example.SQL)
+		}
+	}
+}
+
+// TestRuleBasedTranslatorShapes tests query shapes beyond the examples
+func TestRuleBasedTranslatorShapes(t *testing.T) {
+	translator := NewRuleBasedTranslator()
+	rules := NewNLQueryEngine("").validationRules
+
+	tests := []struct {
+		query string
+		sql   string
+	}{
+		{"variants in tp53 with af >= 5%", "SELECT * FROM variants WHERE gene = 'TP53' AND af >= 0.05"},
+		{"show variants in chr7:55,086,725-55,324,313", "SELECT * FROM variants WHERE chromosome = '7' AND position BETWEEN 55086725 AND 55324313"},
+		{"likely pathogenic variants on chrX", "SELECT * FROM variants WHERE chromosome = 'X' AND pathogenicity = 'Likely Pathogenic'"},
+		{"How many missense mutations are in KRAS?", "SELECT COUNT(*) as count FROM variants WHERE gene = 'KRAS' AND mutation_type = 'Missense'"},
+		{"top 5 variants in BRAF sorted by sample count", "SELECT * FROM variants WHERE gene = 'BRAF' ORDER BY sample_count DESC LIMIT 5"},
+		{"mutations seen in more than 50 samples", "SELECT * FROM variants WHERE sample_count > 50"},
+		{"Find variants in the BRCA1 region", "SELECT * FROM variants WHERE chromosome = '17' AND position BETWEEN 41196312 AND 41277500"},
+		{"pathogenic or likely pathogenic variants in BRCA1 and BRCA2", "SELECT * FROM variants WHERE gene IN ('BRCA1', 'BRCA2') AND pathogenicity IN ('Likely Pathogenic', 'Pathogenic')"},
+	}
+
+	for _, tt := range tests {
+		sql, explanation, err := translator.Translate(tt.query)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.query, err)
+			continue
+		}
+		if sql != tt.sql {
+			t.Errorf("%q:\n  got:  %s\n  want: %s", tt.query, sql, tt.sql)
+		}
+		if explanation == "" {
+			t.Errorf("%q: expected an explanation", tt.query)
+		}
+		if verr := rules.ValidateSQL(sql); verr != nil {
+			t.Errorf("%q: generated SQL fails validation: %v", tt.query, verr)
+		}
+	}
+
+	if _, _, err := translator.Translate("what is the weather today"); err == nil {
+		t.Error("Expected untranslatable query to return an error")
+	}
+}
+
+// TestConvertToSQLWithoutAPIKey tests the engine uses the translator when no key is set
+func TestConvertToSQLWithoutAPIKey(t *testing.T) {
+	engine := NewNLQueryEngine("")
+
+	result, err := engine.ConvertToSQL("user", "Show me all TP53 mutations")
+	if err != nil {
+		t.Fatalf("ConvertToSQL failed: %v", err)
+	}
+	if result.Generator != GeneratorRuleBased {
+		t.Errorf("Expected generator %s, got %s", GeneratorRuleBased, result.Generator)
+	}
+	if !result.IsValid {
+		t.Errorf("Expected valid SQL, got error: %s", result.ValidationError)
+	}
+	if result.GeneratedSQL != "SELECT * FROM variants WHERE gene = 'TP53'" {
+		t.Errorf("Unexpected SQL: %s", result.GeneratedSQL)
+	}
+
+	// Without a variant store the SQL is valid but cannot run
+	if _, err := engine.ExecuteQuery(context.Background(), result); !errors.Is(err, ErrNoVariantStore) {
+		t.Errorf("Expected ErrNoVariantStore, got %v", err)
+	}
+}
@@ -0,0 +1,937 @@
+/**
+ * SQL Tokenizer and Parser
+ *
+ * Parses the read-only SELECT subset used by the natural language query
+ * engine into an AST that the variant store can execute.
+ *
+ * Supported grammar:
+ *   SELECT [DISTINCT] items FROM table [WHERE expr] [GROUP BY exprs]
+ *          [HAVING expr] [ORDER BY expr [ASC|DESC], ...] [LIMIT n [OFFSET n]]
+ */
+
+package ai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sqlTokenKind classifies a lexical token
+type sqlTokenKind int
+
+const (
+	tokEOF sqlTokenKind = iota
+	tokIdent
+	tokKeyword
+	tokString
+	tokNumber
+	tokOperator
+	tokLParen
+	tokRParen
+	tokComma
+	tokStar
+	tokDot
+	tokSemicolon
+)
+
+// sqlToken is a single lexical token with its byte offset in the query
+type sqlToken struct {
+	Kind sqlTokenKind
+	Text string // Keywords are upper-cased; strings are unquoted
+	Pos  int
+}
+
+// sqlKeywords are reserved words recognised by the tokenizer.
+// Function names (COUNT, AVG, ...) are deliberately not reserved so they can
+// also be used as aliases, e.g. "COUNT(*) AS count".
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true,
+	"ORDER": true, "GROUP": true, "BY": true, "HAVING": true, "LIMIT": true, "OFFSET": true,
+	"ASC": true, "DESC": true, "DISTINCT": true, "AS": true, "IN": true, "BETWEEN": true,
+	"LIKE": true, "IS": true, "NULL": true, "TRUE": true, "FALSE": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "OUTER": true, "CROSS": true, "ON": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true,
+	"INSERT": true, "UPDATE": true, "DELETE": true, "DROP": true, "ALTER": true, "CREATE": true,
+	"TRUNCATE": true, "REPLACE": true, "EXEC": true, "EXECUTE": true, "INTO": true, "SET": true,
+	"GRANT": true, "REVOKE": true, "VALUES": true, "ATTACH": true, "PRAGMA": true,
+}
+
+// tokenizeSQL splits a query into tokens
+func tokenizeSQL(sql string) ([]sqlToken, error) {
+	tokens := make([]sqlToken, 0, 32)
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-',
+			c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			return nil, newSQLError(ErrCodeComment, i, sql[i:i+2], "comments are not allowed")
+
+		case isIdentStart(c):
+			start := i
+			for i < len(sql) && isIdentPart(sql[i]) {
+				i++
+			}
+			word := sql[start:i]
+			upper := strings.ToUpper(word)
+			if sqlKeywords[upper] {
+				tokens = append(tokens, sqlToken{Kind: tokKeyword, Text: upper, Pos: start})
+			} else {
+				tokens = append(tokens, sqlToken{Kind: tokIdent, Text: strings.ToLower(word), Pos: start})
+			}
+
+		case c == '"' || c == '`':
+			// Quoted identifier
+			start := i
+			end := strings.IndexByte(sql[i+1:], c)
+			if end < 0 {
+				return nil, newSQLError(ErrCodeSyntax, start, string(c), "unterminated quoted identifier")
+			}
+			tokens = append(tokens, sqlToken{Kind: tokIdent, Text: strings.ToLower(sql[i+1 : i+1+end]), Pos: start})
+			i += end + 2
+
+		case c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(sql) {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						sb.WriteByte('\'') // Escaped quote
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteByte(sql[i])
+				i++
+			}
+			if !closed {
+				return nil, newSQLError(ErrCodeSyntax, start, "'", "unterminated string literal")
+			}
+			tokens = append(tokens, sqlToken{Kind: tokString, Text: sb.String(), Pos: start})
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			start := i
+			for i < len(sql) && (sql[i] >= '0' && sql[i] <= '9' || sql[i] == '.') {
+				i++
+			}
+			if i < len(sql) && (sql[i] == 'e' || sql[i] == 'E') {
+				i++
+				if i < len(sql) && (sql[i] == '+' || sql[i] == '-') {
+					i++
+				}
+				for i < len(sql) && sql[i] >= '0' && sql[i] <= '9' {
+					i++
+				}
+			}
+			tokens = append(tokens, sqlToken{Kind: tokNumber, Text: sql[start:i], Pos: start})
+
+		case c == '(':
+			tokens = append(tokens, sqlToken{Kind: tokLParen, Text: "(", Pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, sqlToken{Kind: tokRParen, Text: ")", Pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, sqlToken{Kind: tokComma, Text: ",", Pos: i})
+			i++
+		case c == '*':
+			tokens = append(tokens, sqlToken{Kind: tokStar, Text: "*", Pos: i})
+			i++
+		case c == '.':
+			tokens = append(tokens, sqlToken{Kind: tokDot, Text: ".", Pos: i})
+			i++
+		case c == ';':
+			tokens = append(tokens, sqlToken{Kind: tokSemicolon, Text: ";", Pos: i})
+			i++
+
+		case strings.IndexByte("=<>!+-/%", c) >= 0:
+			start := i
+			op := string(c)
+			if i+1 < len(sql) {
+				two := sql[i : i+2]
+				if two == "<=" || two == ">=" || two == "<>" || two == "!=" {
+					op = two
+				}
+			}
+			if op == "!" {
+				return nil, newSQLError(ErrCodeSyntax, start, "!", "unexpected character '!'")
+			}
+			i += len(op)
+			if op == "<>" {
+				op = "!="
+			}
+			tokens = append(tokens, sqlToken{Kind: tokOperator, Text: op, Pos: start})
+
+		default:
+			return nil, newSQLError(ErrCodeSyntax, i, string(c), fmt.Sprintf("unexpected character %q", c))
+		}
+	}
+
+	tokens = append(tokens, sqlToken{Kind: tokEOF, Pos: len(sql)})
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+// sqlExpr is a node in a parsed expression tree
+type sqlExpr interface {
+	position() int
+}
+
+// sqlColumnRef references a column, optionally qualified by a table name
+type sqlColumnRef struct {
+	Table string
+	Name  string
+	Pos   int
+}
+
+// sqlLiteral is a string, number, boolean or NULL constant
+type sqlLiteral struct {
+	Value interface{} // string, float64, bool or nil
+	Pos   int
+}
+
+// sqlBinaryExpr is a logical, comparison, LIKE or arithmetic operation
+type sqlBinaryExpr struct {
+	Op    string // AND, OR, =, !=, <, <=, >, >=, LIKE, +, -, *, /, %
+	Left  sqlExpr
+	Right sqlExpr
+	Pos   int
+}
+
+// sqlUnaryExpr is NOT or unary minus
+type sqlUnaryExpr struct {
+	Op   string
+	Expr sqlExpr
+	Pos  int
+}
+
+// sqlInExpr is expr [NOT] IN (list) or expr [NOT] IN (subquery)
+type sqlInExpr struct {
+	Expr     sqlExpr
+	List     []sqlExpr
+	Subquery *sqlSelect
+	Not      bool
+	Pos      int
+}
+
+// sqlBetweenExpr is expr [NOT] BETWEEN low AND high
+type sqlBetweenExpr struct {
+	Expr sqlExpr
+	Low  sqlExpr
+	High sqlExpr
+	Not  bool
+	Pos  int
+}
+
+// sqlIsNullExpr is expr IS [NOT] NULL
+type sqlIsNullExpr struct {
+	Expr sqlExpr
+	Not  bool
+	Pos  int
+}
+
+// sqlFuncCall is a function call such as COUNT(*) or AVG(af)
+type sqlFuncCall struct {
+	Name     string // Upper-cased
+	Args     []sqlExpr
+	Star     bool // COUNT(*)
+	Distinct bool // COUNT(DISTINCT gene)
+	Pos      int
+}
+
+// sqlSubquery is a parenthesised SELECT used as a scalar value
+type sqlSubquery struct {
+	Select *sqlSelect
+	Pos    int
+}
+
+func (e *sqlColumnRef) position() int   { return e.Pos }
+func (e *sqlLiteral) position() int     { return e.Pos }
+func (e *sqlBinaryExpr) position() int  { return e.Pos }
+func (e *sqlUnaryExpr) position() int   { return e.Pos }
+func (e *sqlInExpr) position() int      { return e.Pos }
+func (e *sqlBetweenExpr) position() int { return e.Pos }
+func (e *sqlIsNullExpr) position() int  { return e.Pos }
+func (e *sqlFuncCall) position() int    { return e.Pos }
+func (e *sqlSubquery) position() int    { return e.Pos }
+
+// sqlSelectItem is one entry of the SELECT list
+type sqlSelectItem struct {
+	Expr  sqlExpr // nil for *
+	Alias string
+	Star  bool
+	Pos   int
+}
+
+// sqlTableRef is a table in the FROM clause
+type sqlTableRef struct {
+	Name  string
+	Alias string
+	Pos   int
+}
+
+// sqlJoin is a JOIN clause
+type sqlJoin struct {
+	Table sqlTableRef
+	On    sqlExpr
+	Pos   int
+}
+
+// sqlOrderItem is one ORDER BY term
+type sqlOrderItem struct {
+	Expr sqlExpr
+	Desc bool
+}
+
+// sqlSelect is a parsed SELECT statement
+type sqlSelect struct {
+	Distinct bool
+	Items    []sqlSelectItem
+	From     []sqlTableRef
+	Joins    []sqlJoin
+	Where    sqlExpr
+	GroupBy  []sqlExpr
+	Having   sqlExpr
+	OrderBy  []sqlOrderItem
+	Limit    int // -1 when absent
+	Offset   int
+	Pos      int
+}
+
+// sqlParser is a recursive-descent parser over a token stream
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+// parseSQL parses a single SELECT statement (an optional trailing semicolon is allowed)
+func parseSQL(sql string) (*sqlSelect, error) {
+	tokens, err := tokenizeSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &sqlParser{tokens: tokens}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().Kind == tokSemicolon {
+		p.next()
+	}
+	if tok := p.peek(); tok.Kind != tokEOF {
+		return nil, p.errorAt(tok, "unexpected %s after end of statement", describeToken(tok))
+	}
+
+	return stmt, nil
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) next() sqlToken {
+	tok := p.tokens[p.pos]
+	if tok.Kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// acceptKeyword consumes the next token if it is the given keyword
+func (p *sqlParser) acceptKeyword(kw string) bool {
+	if tok := p.peek(); tok.Kind == tokKeyword && tok.Text == kw {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expectKeyword consumes the given keyword or fails
+func (p *sqlParser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		tok := p.peek()
+		return p.errorAt(tok, "expected %s, found %s", kw, describeToken(tok))
+	}
+	return nil
+}
+
+// expect consumes a token of the given kind or fails
+func (p *sqlParser) expect(kind sqlTokenKind, what string) (sqlToken, error) {
+	tok := p.peek()
+	if tok.Kind != kind {
+		return tok, p.errorAt(tok, "expected %s, found %s", what, describeToken(tok))
+	}
+	p.pos++
+	return tok, nil
+}
+
+func (p *sqlParser) errorAt(tok sqlToken, format string, args ...interface{}) error {
+	return newSQLError(ErrCodeSyntax, tok.Pos, tok.Text, fmt.Sprintf(format, args...))
+}
+
+// describeToken renders a token for error messages
+func describeToken(tok sqlToken) string {
+	switch tok.Kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return fmt.Sprintf("'%s'", tok.Text)
+	default:
+		return fmt.Sprintf("%q", tok.Text)
+	}
+}
+
+// parseSelect parses SELECT ... [LIMIT n]
+func (p *sqlParser) parseSelect() (*sqlSelect, error) {
+	start := p.peek()
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	stmt := &sqlSelect{Limit: -1, Pos: start.Pos}
+	stmt.Distinct = p.acceptKeyword("DISTINCT")
+
+	// SELECT list
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Items = append(stmt.Items, item)
+		if p.peek().Kind != tokComma {
+			break
+		}
+		p.next()
+	}
+
+	// FROM
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	for {
+		table, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.From = append(stmt.From, table)
+		if p.peek().Kind != tokComma {
+			break
+		}
+		p.next()
+	}
+
+	// JOINs
+	for {
+		tok := p.peek()
+		if tok.Kind != tokKeyword {
+			break
+		}
+		isJoin := false
+		switch tok.Text {
+		case "JOIN":
+			isJoin = true
+		case "INNER", "LEFT", "RIGHT", "CROSS":
+			isJoin = true
+			p.next()
+			p.acceptKeyword("OUTER")
+		}
+		if !isJoin {
+			break
+		}
+		if err := p.expectKeyword("JOIN"); err != nil {
+			return nil, err
+		}
+		table, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		join := sqlJoin{Table: table, Pos: tok.Pos}
+		if p.acceptKeyword("ON") {
+			if join.On, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		stmt.Joins = append(stmt.Joins, join)
+	}
+
+	var err error
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, expr)
+			if p.peek().Kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if p.acceptKeyword("HAVING") {
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := sqlOrderItem{Expr: expr}
+			if p.acceptKeyword("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+			if p.peek().Kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if stmt.Limit, err = p.parseCount("LIMIT"); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("OFFSET") {
+			if stmt.Offset, err = p.parseCount("OFFSET"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseCount parses a non-negative integer for LIMIT/OFFSET
+func (p *sqlParser) parseCount(clause string) (int, error) {
+	tok, err := p.expect(tokNumber, clause+" count")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(tok.Text)
+	if err != nil || n < 0 {
+		return 0, p.errorAt(tok, "invalid %s count %s", clause, tok.Text)
+	}
+	return n, nil
+}
+
+// parseSelectItem parses "*", "table.*" or "expr [AS alias]"
+func (p *sqlParser) parseSelectItem() (sqlSelectItem, error) {
+	tok := p.peek()
+	if tok.Kind == tokStar {
+		p.next()
+		return sqlSelectItem{Star: true, Pos: tok.Pos}, nil
+	}
+	if tok.Kind == tokIdent && p.tokens[p.pos+1].Kind == tokDot && p.tokens[p.pos+2].Kind == tokStar {
+		p.pos += 3
+		return sqlSelectItem{Star: true, Pos: tok.Pos}, nil
+	}
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return sqlSelectItem{}, err
+	}
+	item := sqlSelectItem{Expr: expr, Pos: tok.Pos}
+
+	if p.acceptKeyword("AS") {
+		alias, err := p.expect(tokIdent, "alias")
+		if err != nil {
+			return item, err
+		}
+		item.Alias = alias.Text
+	} else if p.peek().Kind == tokIdent {
+		item.Alias = p.next().Text
+	}
+
+	return item, nil
+}
+
+// parseTableRef parses "table [[AS] alias]"
+func (p *sqlParser) parseTableRef() (sqlTableRef, error) {
+	if tok := p.peek(); tok.Kind == tokLParen {
+		return sqlTableRef{}, p.errorAt(tok, "subqueries in FROM are not supported")
+	}
+	tok, err := p.expect(tokIdent, "table name")
+	if err != nil {
+		return sqlTableRef{}, err
+	}
+	ref := sqlTableRef{Name: tok.Text, Pos: tok.Pos}
+	if p.acceptKeyword("AS") {
+		alias, err := p.expect(tokIdent, "table alias")
+		if err != nil {
+			return ref, err
+		}
+		ref.Alias = alias.Text
+	} else if p.peek().Kind == tokIdent {
+		ref.Alias = p.next().Text
+	}
+	return ref, nil
+}
+
+// parseExpr parses an expression (lowest precedence: OR)
+func (p *sqlParser) parseExpr() (sqlExpr, error) {
+	return p.parseOr()
+}
+
+func (p *sqlParser) parseOr() (sqlExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if !p.acceptKeyword("OR") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpr{Op: "OR", Left: left, Right: right, Pos: tok.Pos}
+	}
+}
+
+func (p *sqlParser) parseAnd() (sqlExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if !p.acceptKeyword("AND") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpr{Op: "AND", Left: left, Right: right, Pos: tok.Pos}
+	}
+}
+
+func (p *sqlParser) parseNot() (sqlExpr, error) {
+	tok := p.peek()
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlUnaryExpr{Op: "NOT", Expr: expr, Pos: tok.Pos}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses comparisons, IS NULL, IN, BETWEEN and LIKE
+func (p *sqlParser) parseComparison() (sqlExpr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.Kind == tokOperator {
+		switch tok.Text {
+		case "=", "!=", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &sqlBinaryExpr{Op: tok.Text, Left: left, Right: right, Pos: tok.Pos}, nil
+		}
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &sqlIsNullExpr{Expr: left, Not: not, Pos: tok.Pos}, nil
+	}
+
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("IN"):
+		in := &sqlInExpr{Expr: left, Not: not, Pos: tok.Pos}
+		if _, err := p.expect(tokLParen, "'(' after IN"); err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next.Kind == tokKeyword && next.Text == "SELECT" {
+			if in.Subquery, err = p.parseSelect(); err != nil {
+				return nil, err
+			}
+		} else {
+			for {
+				item, err := p.parseAdditive()
+				if err != nil {
+					return nil, err
+				}
+				in.List = append(in.List, item)
+				if p.peek().Kind != tokComma {
+					break
+				}
+				p.next()
+			}
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return in, nil
+
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlBetweenExpr{Expr: left, Low: low, High: high, Not: not, Pos: tok.Pos}, nil
+
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		var expr sqlExpr = &sqlBinaryExpr{Op: "LIKE", Left: left, Right: pattern, Pos: tok.Pos}
+		if not {
+			expr = &sqlUnaryExpr{Op: "NOT", Expr: expr, Pos: tok.Pos}
+		}
+		return expr, nil
+	}
+
+	if not {
+		next := p.peek()
+		return nil, p.errorAt(next, "expected IN, BETWEEN or LIKE after NOT, found %s", describeToken(next))
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAdditive() (sqlExpr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.Kind != tokOperator || (tok.Text != "+" && tok.Text != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpr{Op: tok.Text, Left: left, Right: right, Pos: tok.Pos}
+	}
+}
+
+func (p *sqlParser) parseMultiplicative() (sqlExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		isOp := tok.Kind == tokStar || tok.Kind == tokOperator && (tok.Text == "/" || tok.Text == "%")
+		if !isOp {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpr{Op: tok.Text, Left: left, Right: right, Pos: tok.Pos}
+	}
+}
+
+func (p *sqlParser) parseUnary() (sqlExpr, error) {
+	tok := p.peek()
+	if tok.Kind == tokOperator && (tok.Text == "-" || tok.Text == "+") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Text == "+" {
+			return expr, nil
+		}
+		return &sqlUnaryExpr{Op: "-", Expr: expr, Pos: tok.Pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses literals, column references, function calls and parentheses
+func (p *sqlParser) parsePrimary() (sqlExpr, error) {
+	tok := p.next()
+	switch tok.Kind {
+	case tokString:
+		return &sqlLiteral{Value: tok.Text, Pos: tok.Pos}, nil
+
+	case tokNumber:
+		value, err := strconv.ParseFloat(tok.Text, 64)
+		if err != nil {
+			return nil, p.errorAt(tok, "invalid number %s", tok.Text)
+		}
+		return &sqlLiteral{Value: value, Pos: tok.Pos}, nil
+
+	case tokKeyword:
+		switch tok.Text {
+		case "NULL":
+			return &sqlLiteral{Value: nil, Pos: tok.Pos}, nil
+		case "TRUE":
+			return &sqlLiteral{Value: true, Pos: tok.Pos}, nil
+		case "FALSE":
+			return &sqlLiteral{Value: false, Pos: tok.Pos}, nil
+		}
+		return nil, p.errorAt(tok, "unexpected keyword %s", tok.Text)
+
+	case tokIdent:
+		if p.peek().Kind == tokLParen {
+			return p.parseFuncCall(tok)
+		}
+		if p.peek().Kind == tokDot {
+			p.next()
+			col, err := p.expect(tokIdent, "column name")
+			if err != nil {
+				return nil, err
+			}
+			return &sqlColumnRef{Table: tok.Text, Name: col.Text, Pos: tok.Pos}, nil
+		}
+		return &sqlColumnRef{Name: tok.Text, Pos: tok.Pos}, nil
+
+	case tokLParen:
+		if next := p.peek(); next.Kind == tokKeyword && next.Text == "SELECT" {
+			sub, err := p.parseSelect()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokRParen, "')'"); err != nil {
+				return nil, err
+			}
+			return &sqlSubquery{Select: sub, Pos: tok.Pos}, nil
+		}
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	return nil, p.errorAt(tok, "unexpected %s", describeToken(tok))
+}
+
+// parseFuncCall parses name(args), name(*) or name(DISTINCT arg)
+func (p *sqlParser) parseFuncCall(name sqlToken) (sqlExpr, error) {
+	p.next() // (
+	call := &sqlFuncCall{Name: strings.ToUpper(name.Text), Pos: name.Pos}
+
+	if p.peek().Kind == tokStar {
+		p.next()
+		call.Star = true
+	} else if p.peek().Kind != tokRParen {
+		call.Distinct = p.acceptKeyword("DISTINCT")
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if p.peek().Kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if _, err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// exprString renders an expression back to SQL, used for result column names
+func exprString(expr sqlExpr) string {
+	switch e := expr.(type) {
+	case *sqlColumnRef:
+		return e.Name
+	case *sqlLiteral:
+		switch v := e.Value.(type) {
+		case nil:
+			return "NULL"
+		case string:
+			return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			return strings.ToUpper(fmt.Sprint(v))
+		}
+	case *sqlFuncCall:
+		if e.Star {
+			return e.Name + "(*)"
+		}
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = exprString(arg)
+		}
+		prefix := ""
+		if e.Distinct {
+			prefix = "DISTINCT "
+		}
+		return e.Name + "(" + prefix + strings.Join(args, ", ") + ")"
+	case *sqlBinaryExpr:
+		return exprString(e.Left) + " " + e.Op + " " + exprString(e.Right)
+	case *sqlUnaryExpr:
+		if e.Op == "-" {
+			return "-" + exprString(e.Expr)
+		}
+		return "NOT " + exprString(e.Expr)
+	default:
+		return "expr"
+	}
+}
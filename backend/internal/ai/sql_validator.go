@@ -0,0 +1,412 @@
+/**
+ * SQL Validator
+ *
+ * Validates generated SQL against ValidationRules by tokenizing and parsing
+ * it into an AST, rather than matching keywords and regexes on raw text.
+ * Working on tokens means string literals and identifiers such as
+ * `created_set` are never mistaken for keywords, and comments cannot hide
+ * anything because they are rejected outright.
+ *
+ * Every failure is reported as a SQLValidationError pointing at the
+ * offending token.
+ */
+
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validation error codes
+const (
+	ErrCodeTooLong          = "query_too_long"
+	ErrCodeSyntax           = "syntax_error"
+	ErrCodeComment          = "comment_not_allowed"
+	ErrCodeForbiddenKeyword = "forbidden_keyword"
+	ErrCodeNotSelect        = "not_select"
+	ErrCodeJoin             = "join_not_allowed"
+	ErrCodeSubquery         = "subquery_not_allowed"
+	ErrCodeTable            = "table_not_allowed"
+	ErrCodeColumn           = "column_not_allowed"
+	ErrCodeFunction         = "function_not_allowed"
+	ErrCodeDangerous        = "dangerous_pattern"
+	ErrCodeTooComplex       = "predicate_too_deep"
+)
+
+// SQLValidationError describes why a query was rejected
+type SQLValidationError struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Token    string `json:"token,omitempty"` // Offending token text
+	Position int    `json:"position"`        // Byte offset of the token in the query
+}
+
+// Error implements the error interface
+func (e *SQLValidationError) Error() string {
+	if e.Token != "" {
+		return fmt.Sprintf("%s (position %d, near %q)", e.Message, e.Position, e.Token)
+	}
+	return fmt.Sprintf("%s (position %d)", e.Message, e.Position)
+}
+
+// newSQLError creates a validation error
+func newSQLError(code string, pos int, token, message string) *SQLValidationError {
+	return &SQLValidationError{Code: code, Message: message, Token: token, Position: pos}
+}
+
+// DefaultAllowedFunctions are the SQL functions the variant store can execute
+var DefaultAllowedFunctions = []string{
+	"COUNT", "SUM", "AVG", "MIN", "MAX", "UPPER", "LOWER", "LENGTH", "ABS", "ROUND",
+}
+
+// sqlValidator checks a parsed statement against ValidationRules
+type sqlValidator struct {
+	rules     *ValidationRules
+	sql       string
+	tables    map[string]bool            // Allowed table names (lower-case)
+	columns   map[string]map[string]bool // Allowed columns per table
+	functions map[string]bool
+}
+
+// ValidateSQL validates a query and returns nil if it is allowed
+func (rules *ValidationRules) ValidateSQL(sql string) *SQLValidationError {
+	v := &sqlValidator{
+		rules:     rules,
+		sql:       sql,
+		tables:    make(map[string]bool),
+		columns:   make(map[string]map[string]bool),
+		functions: make(map[string]bool),
+	}
+	for _, table := range rules.AllowedTables {
+		v.tables[strings.ToLower(table)] = true
+	}
+	for table, cols := range rules.AllowedColumns {
+		set := make(map[string]bool, len(cols))
+		for _, col := range cols {
+			set[strings.ToLower(col)] = true
+		}
+		v.columns[strings.ToLower(table)] = set
+	}
+	functions := rules.AllowedFunctions
+	if functions == nil {
+		functions = DefaultAllowedFunctions
+	}
+	for _, fn := range functions {
+		v.functions[strings.ToUpper(fn)] = true
+	}
+
+	return v.validate()
+}
+
+// validate runs the lexical, syntactic and semantic checks in order
+func (v *sqlValidator) validate() *SQLValidationError {
+	if v.rules.MaxQueryLength > 0 && len(v.sql) > v.rules.MaxQueryLength {
+		return newSQLError(ErrCodeTooLong, v.rules.MaxQueryLength, "",
+			fmt.Sprintf("query exceeds maximum length of %d characters", v.rules.MaxQueryLength))
+	}
+
+	tokens, err := tokenizeSQL(v.sql)
+	if err != nil {
+		return asSQLError(err)
+	}
+
+	// Forbidden keywords are checked on tokens, so they never match inside
+	// identifiers or string literals
+	forbidden := make(map[string]bool, len(v.rules.ForbiddenKeywords))
+	for _, kw := range v.rules.ForbiddenKeywords {
+		forbidden[strings.ToUpper(kw)] = true
+	}
+	for _, tok := range tokens {
+		if tok.Kind == tokKeyword && forbidden[tok.Text] {
+			return newSQLError(ErrCodeForbiddenKeyword, tok.Pos, tok.Text,
+				"forbidden keyword detected: "+tok.Text)
+		}
+	}
+
+	if first := tokens[0]; first.Kind != tokKeyword || first.Text != "SELECT" {
+		return newSQLError(ErrCodeNotSelect, first.Pos, first.Text, "query must start with SELECT")
+	}
+
+	stmt, err := parseSQL(v.sql)
+	if err != nil {
+		return asSQLError(err)
+	}
+
+	// Structural checks first (joins, subqueries), then the objects referenced
+	if verr := v.checkStructure(stmt); verr != nil {
+		return verr
+	}
+	return v.checkSelect(stmt)
+}
+
+// asSQLError converts a tokenizer/parser error to a validation error
+func asSQLError(err error) *SQLValidationError {
+	if verr, ok := err.(*SQLValidationError); ok {
+		return verr
+	}
+	return newSQLError(ErrCodeSyntax, 0, "", err.Error())
+}
+
+// checkStructure rejects joins and subqueries when the rules disallow them
+func (v *sqlValidator) checkStructure(stmt *sqlSelect) *SQLValidationError {
+	if !v.rules.AllowJoins {
+		if len(stmt.Joins) > 0 {
+			return newSQLError(ErrCodeJoin, stmt.Joins[0].Pos, v.tokenAt(stmt.Joins[0].Pos),
+				"JOIN operations are not allowed")
+		}
+		if len(stmt.From) > 1 {
+			return newSQLError(ErrCodeJoin, stmt.From[1].Pos, stmt.From[1].Name,
+				"JOIN operations are not allowed (implicit join via comma)")
+		}
+	}
+
+	var found *SQLValidationError
+	walkSelect(stmt, func(expr sqlExpr) {
+		if found != nil {
+			return
+		}
+		var sub *sqlSelect
+		switch e := expr.(type) {
+		case *sqlInExpr:
+			sub = e.Subquery
+		case *sqlSubquery:
+			sub = e.Select
+		}
+		if sub == nil {
+			return
+		}
+		if !v.rules.AllowSubqueries {
+			found = newSQLError(ErrCodeSubquery, sub.Pos, "SELECT", "subqueries are not allowed")
+			return
+		}
+		found = v.checkStructure(sub)
+	})
+	return found
+}
+
+// checkSelect validates tables, columns, functions, constant predicates and depth
+func (v *sqlValidator) checkSelect(stmt *sqlSelect) *SQLValidationError {
+	// Tables and their aliases
+	scope := make(map[string]string) // name or alias -> table
+	refs := append([]sqlTableRef{}, stmt.From...)
+	for _, join := range stmt.Joins {
+		refs = append(refs, join.Table)
+	}
+	for _, ref := range refs {
+		if !v.tables[ref.Name] {
+			return newSQLError(ErrCodeTable, ref.Pos, ref.Name,
+				fmt.Sprintf("query must reference allowed tables only (%s)", strings.Join(v.rules.AllowedTables, ", ")))
+		}
+		scope[ref.Name] = ref.Name
+		if ref.Alias != "" {
+			scope[ref.Alias] = ref.Name
+		}
+	}
+
+	// Output aliases may be referenced from ORDER BY / HAVING
+	aliases := make(map[string]bool)
+	for _, item := range stmt.Items {
+		if item.Alias != "" {
+			aliases[item.Alias] = true
+		}
+	}
+
+	var found *SQLValidationError
+	check := func(expr sqlExpr) {
+		if found != nil {
+			return
+		}
+		switch e := expr.(type) {
+		case *sqlColumnRef:
+			found = v.checkColumn(e, scope, aliases)
+		case *sqlFuncCall:
+			if !v.functions[e.Name] {
+				found = newSQLError(ErrCodeFunction, e.Pos, e.Name,
+					fmt.Sprintf("function %s is not allowed", e.Name))
+			}
+		case *sqlBinaryExpr:
+			if isComparison(e.Op) && isConstant(e.Left) && isConstant(e.Right) {
+				found = newSQLError(ErrCodeDangerous, e.Pos, e.Op,
+					"query contains dangerous pattern: comparison between constants")
+			}
+		case *sqlInExpr:
+			if e.Subquery != nil {
+				found = v.checkSelect(e.Subquery)
+			}
+		case *sqlSubquery:
+			found = v.checkSelect(e.Select)
+		}
+	}
+	walkSelect(stmt, check)
+	if found != nil {
+		return found
+	}
+
+	if v.rules.MaxPredicateDepth > 0 {
+		for _, pred := range []sqlExpr{stmt.Where, stmt.Having} {
+			if pred == nil {
+				continue
+			}
+			if depth, deepest := predicateDepth(pred); depth > v.rules.MaxPredicateDepth {
+				return newSQLError(ErrCodeTooComplex, deepest.position(), v.tokenAt(deepest.position()),
+					fmt.Sprintf("predicate nesting depth %d exceeds maximum of %d", depth, v.rules.MaxPredicateDepth))
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkColumn verifies a column reference against the column whitelist
+func (v *sqlValidator) checkColumn(ref *sqlColumnRef, scope map[string]string, aliases map[string]bool) *SQLValidationError {
+	if ref.Table != "" {
+		table, ok := scope[ref.Table]
+		if !ok {
+			return newSQLError(ErrCodeTable, ref.Pos, ref.Table,
+				fmt.Sprintf("unknown table or alias %q", ref.Table))
+		}
+		if allowed, restricted := v.columns[table]; restricted && !allowed[ref.Name] {
+			return newSQLError(ErrCodeColumn, ref.Pos, ref.Name,
+				fmt.Sprintf("column %q is not allowed on table %s", ref.Name, table))
+		}
+		return nil
+	}
+
+	if aliases[ref.Name] {
+		return nil
+	}
+	for _, table := range scope {
+		allowed, restricted := v.columns[table]
+		if !restricted || allowed[ref.Name] {
+			return nil
+		}
+	}
+	return newSQLError(ErrCodeColumn, ref.Pos, ref.Name, fmt.Sprintf("unknown column %q", ref.Name))
+}
+
+// tokenAt returns the source text of the token starting at pos
+func (v *sqlValidator) tokenAt(pos int) string {
+	if pos < 0 || pos >= len(v.sql) {
+		return ""
+	}
+	end := pos + 1
+	if isIdentStart(v.sql[pos]) {
+		for end < len(v.sql) && isIdentPart(v.sql[end]) {
+			end++
+		}
+	}
+	return v.sql[pos:end]
+}
+
+// walkSelect calls fn for every expression in the statement (not descending
+// into subqueries; callers recurse on sqlInExpr/sqlSubquery themselves)
+func walkSelect(stmt *sqlSelect, fn func(sqlExpr)) {
+	for _, item := range stmt.Items {
+		if item.Expr != nil {
+			walkExpr(item.Expr, fn)
+		}
+	}
+	for _, join := range stmt.Joins {
+		if join.On != nil {
+			walkExpr(join.On, fn)
+		}
+	}
+	if stmt.Where != nil {
+		walkExpr(stmt.Where, fn)
+	}
+	for _, expr := range stmt.GroupBy {
+		walkExpr(expr, fn)
+	}
+	if stmt.Having != nil {
+		walkExpr(stmt.Having, fn)
+	}
+	for _, item := range stmt.OrderBy {
+		walkExpr(item.Expr, fn)
+	}
+}
+
+// walkExpr visits expr and its children depth-first
+func walkExpr(expr sqlExpr, fn func(sqlExpr)) {
+	fn(expr)
+	switch e := expr.(type) {
+	case *sqlBinaryExpr:
+		walkExpr(e.Left, fn)
+		walkExpr(e.Right, fn)
+	case *sqlUnaryExpr:
+		walkExpr(e.Expr, fn)
+	case *sqlInExpr:
+		walkExpr(e.Expr, fn)
+		for _, item := range e.List {
+			walkExpr(item, fn)
+		}
+	case *sqlBetweenExpr:
+		walkExpr(e.Expr, fn)
+		walkExpr(e.Low, fn)
+		walkExpr(e.High, fn)
+	case *sqlIsNullExpr:
+		walkExpr(e.Expr, fn)
+	case *sqlFuncCall:
+		for _, arg := range e.Args {
+			walkExpr(arg, fn)
+		}
+	}
+}
+
+// predicateDepth returns the nesting depth of boolean operators (AND/OR/NOT)
+// in a predicate, and the deepest such node
+func predicateDepth(expr sqlExpr) (int, sqlExpr) {
+	switch e := expr.(type) {
+	case *sqlBinaryExpr:
+		if e.Op != "AND" && e.Op != "OR" {
+			return 0, expr
+		}
+		left, leftNode := predicateDepth(e.Left)
+		right, rightNode := predicateDepth(e.Right)
+		// Chains of the same operator (a AND b AND c) count as one level
+		if l, ok := e.Left.(*sqlBinaryExpr); ok && l.Op == e.Op {
+			left--
+		}
+		if r, ok := e.Right.(*sqlBinaryExpr); ok && r.Op == e.Op {
+			right--
+		}
+		if left >= right {
+			if left == 0 {
+				return 1, expr
+			}
+			return left + 1, leftNode
+		}
+		return right + 1, rightNode
+	case *sqlUnaryExpr:
+		if e.Op != "NOT" {
+			return 0, expr
+		}
+		depth, node := predicateDepth(e.Expr)
+		if depth == 0 {
+			return 1, expr
+		}
+		return depth + 1, node
+	}
+	return 0, expr
+}
+
+// isComparison reports whether op is a comparison operator
+func isComparison(op string) bool {
+	switch op {
+	case "=", "!=", "<", "<=", ">", ">=", "LIKE":
+		return true
+	}
+	return false
+}
+
+// isConstant reports whether an expression contains no column references
+func isConstant(expr sqlExpr) bool {
+	constant := true
+	walkExpr(expr, func(e sqlExpr) {
+		switch e.(type) {
+		case *sqlColumnRef, *sqlSubquery, *sqlFuncCall:
+			constant = false
+		}
+	})
+	return constant
+}
@@ -12,6 +12,12 @@ type VariantInput struct {
 	AltAllele  string `json:"alt_allele"`  // alternate allele
 }
 
+// HasCoordinates reports whether the input locates an allele: chromosome,
+// position, reference and alternate alleles
+func (v VariantInput) HasCoordinates() bool {
+	return v.Chromosome != "" && v.Position > 0 && v.RefAllele != "" && v.AltAllele != ""
+}
+
 // VariantContext holds all external data about a variant
 type VariantContext struct {
 	Gene       string
@@ -57,6 +63,7 @@ type GnomADData struct {
 	PopulationMaxName  string  `json:"population_max_name"` // Population with max AF
 	HomozygoteCount    int     `json:"homozygote_count"`    // Number of homozygotes
 	Found              bool    `json:"found"`               // Whether data was found in gnomAD
+	Queried            bool    `json:"queried"`             // Whether looked up by coordinates and alleles; Found is only meaningful then
 }
 
 // PubMedData holds relevant PubMed citations
@@ -93,6 +100,17 @@ type ExplanationResponse struct {
 	Error         string          `json:"error,omitempty"` // Error message if any
 }
 
+// ClassificationResponse is an ACMG/AMP classification, with an LLM
+// narrative of the evidence when requested
+type ClassificationResponse struct {
+	Classification *ACMGResult     `json:"classification"`
+	Narrative      string          `json:"narrative,omitempty"`
+	Context        *VariantContext `json:"context"`
+	ResponseTime   time.Duration   `json:"response_time"`
+	TokensUsed     int             `json:"tokens_used"`
+	CostUSD        float64         `json:"cost_usd"`
+}
+
 // CacheEntry represents a cached explanation
 type CacheEntry struct {
 	Explanation   string          `json:"explanation"`
@@ -115,6 +133,12 @@ type Config struct {
 	TimeoutSeconds   int     // default: 30
 	EnableCache      bool    // default: true
 	EnableBatching   bool    // default: true (Williams Optimizer)
+	LLMProvider      string  // "openai" (default), "mock", "replay" or "record"
+	LLMBaseURL       string  // OpenAI-compatible endpoint, default: https://api.openai.com/v1
+	LLMReplayDir     string  // Fixture directory for the replay/record providers
+	NCBIAPIKey       string  // Optional NCBI API key for ClinVar/PubMed rate limits
+	AnnotationPath   string  // Local ClinVar/gnomAD/COSMIC store (see cmd/annotation_index)
+	RemoteFallback   bool    // Query external APIs for data missing from the local store
 }
 
 // DefaultConfig returns default configuration
@@ -129,5 +153,6 @@ func DefaultConfig() *Config {
 		TimeoutSeconds: 30,
 		EnableCache:    true,
 		EnableBatching: true,
+		LLMProvider:    ProviderOpenAI,
 	}
 }
@@ -11,22 +11,51 @@ import (
 	"time"
 )
 
-// ContextRetriever fetches variant context from external APIs
+// ContextRetriever fetches variant context from a local annotation store
+// and/or external APIs
 type ContextRetriever struct {
 	httpClient *http.Client
-	ncbiAPIKey string // Optional NCBI API key for higher rate limits
+	ncbiAPIKey string           // Optional NCBI API key for higher rate limits
+	store      *AnnotationStore // Local ClinVar/gnomAD/COSMIC snapshot (optional)
+	remote     bool             // Whether external APIs may be called
 }
 
-// NewContextRetriever creates a new context retriever
+// NewContextRetriever creates a context retriever that queries the external APIs
 func NewContextRetriever(ncbiAPIKey string) *ContextRetriever {
 	return &ContextRetriever{
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 		ncbiAPIKey: ncbiAPIKey,
+		remote:     true,
 	}
 }
 
+// NewContextRetrieverFromConfig creates a context retriever for a config:
+// with AnnotationPath set, ClinVar, gnomAD and COSMIC come from the
+// local store and the external APIs are only used when RemoteFallback is set
+func NewContextRetrieverFromConfig(config *Config) (*ContextRetriever, error) {
+	retriever := NewContextRetriever(config.NCBIAPIKey)
+	if config.AnnotationPath == "" {
+		return retriever, nil
+	}
+	store, err := OpenAnnotationStore(config.AnnotationPath)
+	if err != nil {
+		return nil, err
+	}
+	retriever.UseAnnotationStore(store, config.RemoteFallback)
+	return retriever, nil
+}
+
+// UseAnnotationStore serves ClinVar, gnomAD and COSMIC from a local store.
+// With remoteFallback, sources missing from the store (and inputs it cannot
+// resolve) are fetched from the external APIs and PubMed stays available;
+// without it, no network requests are made.
+func (cr *ContextRetriever) UseAnnotationStore(store *AnnotationStore, remoteFallback bool) {
+	cr.store = store
+	cr.remote = remoteFallback
+}
+
 // GetVariantContext retrieves all context data for a variant
 func (cr *ContextRetriever) GetVariantContext(ctx context.Context, input VariantInput) (*VariantContext, error) {
 	variantCtx := &VariantContext{
@@ -40,7 +69,7 @@ func (cr *ContextRetriever) GetVariantContext(ctx context.Context, input Variant
 	errChan := make(chan error, 4)
 
 	go func() {
-		data, err := cr.getClinVarData(ctx, input)
+		data, err := cr.clinVar(ctx, input)
 		if err == nil {
 			variantCtx.ClinVar = data
 		}
@@ -48,7 +77,7 @@ func (cr *ContextRetriever) GetVariantContext(ctx context.Context, input Variant
 	}()
 
 	go func() {
-		data, err := cr.getCOSMICData(ctx, input)
+		data, err := cr.cosmic(ctx, input)
 		if err == nil {
 			variantCtx.COSMIC = data
 		}
@@ -56,7 +85,7 @@ func (cr *ContextRetriever) GetVariantContext(ctx context.Context, input Variant
 	}()
 
 	go func() {
-		data, err := cr.getGnomADData(ctx, input)
+		data, err := cr.gnomAD(ctx, input)
 		if err == nil {
 			variantCtx.GnomAD = data
 		}
@@ -64,7 +93,7 @@ func (cr *ContextRetriever) GetVariantContext(ctx context.Context, input Variant
 	}()
 
 	go func() {
-		data, err := cr.getPubMedData(ctx, input)
+		data, err := cr.pubMed(ctx, input)
 		if err == nil {
 			variantCtx.PubMed = data
 		}
@@ -87,6 +116,51 @@ func (cr *ContextRetriever) GetVariantContext(ctx context.Context, input Variant
 	return variantCtx, nil
 }
 
+// clinVar looks a variant up in the local store, falling back to ClinVar
+// E-utilities when allowed
+func (cr *ContextRetriever) clinVar(ctx context.Context, input VariantInput) (*ClinVarData, error) {
+	if cr.store != nil {
+		data, err := cr.store.ClinVar(input)
+		if err == nil || !cr.remote {
+			return data, err
+		}
+	}
+	return cr.getClinVarData(ctx, input)
+}
+
+// cosmic looks a variant up in the local store, falling back to the
+// Clinical Tables COSMIC API when allowed
+func (cr *ContextRetriever) cosmic(ctx context.Context, input VariantInput) (*COSMICData, error) {
+	if cr.store != nil {
+		data, err := cr.store.COSMIC(input)
+		if err == nil || !cr.remote {
+			return data, err
+		}
+	}
+	return cr.getCOSMICData(ctx, input)
+}
+
+// gnomAD looks a variant up in the local store, falling back to the gnomAD
+// GraphQL API when allowed
+func (cr *ContextRetriever) gnomAD(ctx context.Context, input VariantInput) (*GnomADData, error) {
+	if cr.store != nil {
+		data, err := cr.store.GnomAD(input)
+		if err == nil || !cr.remote {
+			return data, err
+		}
+	}
+	return cr.getGnomADData(ctx, input)
+}
+
+// pubMed searches PubMed when external APIs are allowed; there is no local
+// PubMed snapshot
+func (cr *ContextRetriever) pubMed(ctx context.Context, input VariantInput) (*PubMedData, error) {
+	if !cr.remote {
+		return &PubMedData{Found: false}, nil
+	}
+	return cr.getPubMedData(ctx, input)
+}
+
 // getClinVarData fetches data from ClinVar using E-utilities
 func (cr *ContextRetriever) getClinVarData(ctx context.Context, input VariantInput) (*ClinVarData, error) {
 	// Search for variant using E-search
@@ -242,6 +316,11 @@ func (cr *ContextRetriever) getGnomADData(ctx context.Context, input VariantInpu
 	// For simplicity, we'll use a REST-like query approach
 	// In production, you'd use a proper GraphQL client
 
+	// gnomAD is keyed by allele: without coordinates there is nothing to ask
+	if !input.HasCoordinates() {
+		return &GnomADData{Found: false, PopulationMaxName: "Unknown"}, nil
+	}
+
 	// Build variant ID (chr-pos-ref-alt format)
 	variantID := fmt.Sprintf("%s-%d-%s-%s", input.Chromosome, input.Position, input.RefAllele, input.AltAllele)
 
@@ -295,7 +374,7 @@ func (cr *ContextRetriever) getGnomADData(ctx context.Context, input VariantInpu
 
 	var gnomadResult struct {
 		Data struct {
-			Variant struct {
+			Variant *struct {
 				VariantID string `json:"variant_id"`
 				Genome    struct {
 					AF              float64 `json:"af"`
@@ -307,12 +386,27 @@ func (cr *ContextRetriever) getGnomADData(ctx context.Context, input VariantInpu
 				} `json:"genome"`
 			} `json:"variant"`
 		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
 	}
 
 	if err := json.Unmarshal(body, &gnomadResult); err != nil {
 		return &GnomADData{Found: false}, nil
 	}
 
+	// A null variant is absence only when gnomAD says it is not found;
+	// other errors (bad IDs, dataset problems) leave it unknown
+	if gnomadResult.Data.Variant == nil {
+		queried := true
+		for _, e := range gnomadResult.Errors {
+			if !strings.Contains(strings.ToLower(e.Message), "not found") {
+				queried = false
+			}
+		}
+		return &GnomADData{Found: false, Queried: queried, PopulationMaxName: "Unknown"}, nil
+	}
+
 	// Find max population AF
 	maxAF := 0.0
 	maxPop := "Unknown"
@@ -325,6 +419,7 @@ func (cr *ContextRetriever) getGnomADData(ctx context.Context, input VariantInpu
 
 	return &GnomADData{
 		Found:              true,
+		Queried:            true,
 		AlleleFrequency:    gnomadResult.Data.Variant.Genome.AF,
 		PopulationMaxAF:    maxAF,
 		PopulationMaxName:  maxPop,
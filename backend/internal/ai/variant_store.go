@@ -0,0 +1,1042 @@
+/**
+ * Embedded Variant Store
+ *
+ * Read-only, in-memory implementation of the `variants` table described in
+ * schema_docs.go. Loaded from COSMIC TSV and VCF files, it executes the
+ * validated SELECT queries produced by NLQueryEngine with row limits and
+ * timeouts so natural language queries return data.
+ */
+
+package ai
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"genomevedic/internal/mutations"
+)
+
+// VariantColumns lists the variants table columns in schema order
+var VariantColumns = []string{
+	"id", "gene", "chromosome", "position", "ref_allele", "alt_allele", "hgvs", "af",
+	"pathogenicity", "mutation_type", "sample_id", "sample_count", "cosmic_id", "rsid",
+}
+
+// VariantRecord is one row of the variants table
+type VariantRecord struct {
+	ID            string
+	Gene          string
+	Chromosome    string // Without "chr" prefix, as documented in the schema
+	Position      int64
+	RefAllele     string
+	AltAllele     string
+	HGVS          string
+	AF            *float64 // nil when unknown
+	Pathogenicity string
+	MutationType  string
+	SampleID      string
+	SampleCount   int
+	CosmicID      string
+	RSID          string
+}
+
+// column returns the SQL value of a column (empty optional text is NULL)
+func (v *VariantRecord) column(name string) (interface{}, bool) {
+	switch name {
+	case "id":
+		return v.ID, true
+	case "gene":
+		return nullIfEmpty(v.Gene), true
+	case "chromosome":
+		return v.Chromosome, true
+	case "position":
+		return float64(v.Position), true
+	case "ref_allele":
+		return v.RefAllele, true
+	case "alt_allele":
+		return v.AltAllele, true
+	case "hgvs":
+		return nullIfEmpty(v.HGVS), true
+	case "af":
+		if v.AF == nil {
+			return nil, true
+		}
+		return *v.AF, true
+	case "pathogenicity":
+		return nullIfEmpty(v.Pathogenicity), true
+	case "mutation_type":
+		return nullIfEmpty(v.MutationType), true
+	case "sample_id":
+		return nullIfEmpty(v.SampleID), true
+	case "sample_count":
+		return float64(v.SampleCount), true
+	case "cosmic_id":
+		return nullIfEmpty(v.CosmicID), true
+	case "rsid":
+		return nullIfEmpty(v.RSID), true
+	}
+	return nil, false
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// ExecutionLimits bounds the cost of a single query
+type ExecutionLimits struct {
+	MaxRows int           // Hard cap on returned rows, applied on top of LIMIT
+	Timeout time.Duration // Wall-clock budget per query
+}
+
+// DefaultExecutionLimits returns the limits used by the API server
+func DefaultExecutionLimits() ExecutionLimits {
+	return ExecutionLimits{
+		MaxRows: 1000,
+		Timeout: 5 * time.Second,
+	}
+}
+
+// QueryExecution holds the rows produced by executing a query
+type QueryExecution struct {
+	Columns         []string                 `json:"columns"`
+	Rows            []map[string]interface{} `json:"rows"`
+	RowCount        int                      `json:"row_count"`
+	Truncated       bool                     `json:"truncated"` // MaxRows cut the result short
+	ExecutionTimeMs int64                    `json:"execution_time_ms"`
+}
+
+// VariantStore is an embedded, read-only variants table
+type VariantStore struct {
+	records []*VariantRecord
+	mu      sync.RWMutex
+}
+
+// NewVariantStore creates an empty variant store
+func NewVariantStore() *VariantStore {
+	return &VariantStore{
+		records: make([]*VariantRecord, 0, 10000),
+	}
+}
+
+// Count returns the number of loaded variants
+func (vs *VariantStore) Count() int {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return len(vs.records)
+}
+
+// Add appends records to the store
+func (vs *VariantStore) Add(records ...*VariantRecord) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	vs.records = append(vs.records, records...)
+}
+
+// LoadFile loads a COSMIC TSV or VCF file, choosing the parser by extension
+// (.vcf / .vcf.gz are VCF, anything else is the COSMIC TSV format)
+func (vs *VariantStore) LoadFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open variants file: %w", err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		// bgzip output is a valid multi-member gzip stream
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	if strings.HasSuffix(path, ".vcf") || strings.HasSuffix(path, ".vcf.gz") {
+		return vs.LoadVCF(reader)
+	}
+	return vs.LoadCOSMIC(reader)
+}
+
+// LoadCOSMIC loads the tab-separated COSMIC format read by mutations.COSMICParser
+func (vs *VariantStore) LoadCOSMIC(reader io.Reader) (int, error) {
+	parser := mutations.NewCOSMICParser(math.MaxInt32)
+	if err := parser.ParseFile(reader); err != nil {
+		return 0, fmt.Errorf("failed to parse COSMIC file: %w", err)
+	}
+
+	muts := parser.GetMutations()
+	records := make([]*VariantRecord, 0, len(muts))
+	for _, mut := range muts {
+		record := &VariantRecord{
+			Gene:          mut.Gene,
+			Chromosome:    normalizeChromosome(mut.Chromosome),
+			Position:      int64(mut.Position),
+			RefAllele:     mut.RefAllele,
+			AltAllele:     mut.AltAllele,
+			Pathogenicity: significanceName(mut.Significance),
+			MutationType:  mutationTypeName(mut.MutationType),
+			SampleCount:   mut.SampleCount,
+		}
+		if mut.Frequency > 0 {
+			af := mut.Frequency
+			record.AF = &af
+		}
+		record.ID = variantID(record)
+		records = append(records, record)
+	}
+
+	vs.Add(records...)
+	return len(records), nil
+}
+
+// LoadVCF loads a VCF file. Multi-allelic sites produce one row per ALT.
+// Recognised INFO keys: GENE/GENEINFO/SYMBOL, AF, CLNSIG, CNT (COSMIC sample
+// count), HGVS/HGVSC/CDS, and MC/CONSEQUENCE/VC for the mutation type.
+// IDs starting with "rs" fill rsid; IDs starting with "COS" fill cosmic_id.
+func (vs *VariantStore) LoadVCF(reader io.Reader) (int, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+
+	records := make([]*VariantRecord, 0, 10000)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 {
+			return 0, fmt.Errorf("VCF line %d: expected at least 8 columns, got %d", lineNum, len(fields))
+		}
+		position, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("VCF line %d: invalid position: %w", lineNum, err)
+		}
+
+		info := parseVCFInfo(fields[7])
+		alts := strings.Split(fields[4], ",")
+		afs := strings.Split(info["AF"], ",")
+		sampleCount, _ := strconv.Atoi(info["CNT"])
+
+		for i, alt := range alts {
+			record := &VariantRecord{
+				Gene:          vcfGene(info),
+				Chromosome:    normalizeChromosome(fields[0]),
+				Position:      position,
+				RefAllele:     fields[3],
+				AltAllele:     alt,
+				HGVS:          firstNonEmpty(info["HGVS"], info["HGVSC"], info["CDS"]),
+				Pathogenicity: normalizePathogenicity(info["CLNSIG"]),
+				MutationType:  vcfMutationType(info),
+				SampleCount:   sampleCount,
+			}
+			for _, id := range strings.Split(fields[2], ";") {
+				switch {
+				case strings.HasPrefix(id, "rs"):
+					record.RSID = id
+				case strings.HasPrefix(id, "COS"):
+					record.CosmicID = id
+				}
+			}
+			if i < len(afs) {
+				if af, err := strconv.ParseFloat(afs[i], 64); err == nil {
+					record.AF = &af
+				}
+			}
+			record.ID = variantID(record)
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("error reading VCF: %w", err)
+	}
+
+	vs.Add(records...)
+	return len(records), nil
+}
+
+// parseVCFInfo splits an INFO column into key/value pairs (flags map to "")
+func parseVCFInfo(info string) map[string]string {
+	values := make(map[string]string)
+	if info == "." {
+		return values
+	}
+	for _, entry := range strings.Split(info, ";") {
+		key, value, _ := strings.Cut(entry, "=")
+		values[key] = value
+	}
+	return values
+}
+
+// vcfGene extracts the gene symbol from common INFO conventions
+func vcfGene(info map[string]string) string {
+	if gene := firstNonEmpty(info["GENE"], info["SYMBOL"]); gene != "" {
+		// COSMIC appends transcript IDs: "TP53_ENST00000269305"
+		gene, _, _ = strings.Cut(gene, "_")
+		return gene
+	}
+	if geneInfo := info["GENEINFO"]; geneInfo != "" {
+		// ClinVar: "TP53:7157|..."
+		symbol, _, _ := strings.Cut(geneInfo, ":")
+		return symbol
+	}
+	return ""
+}
+
+// vcfMutationType maps consequence annotations to schema mutation types
+func vcfMutationType(info map[string]string) string {
+	consequence := strings.ToLower(firstNonEmpty(info["MC"], info["CONSEQUENCE"], info["VC"]))
+	switch {
+	case consequence == "":
+		return ""
+	case strings.Contains(consequence, "missense"):
+		return "Missense"
+	case strings.Contains(consequence, "stop_gained"), strings.Contains(consequence, "nonsense"):
+		return "Nonsense"
+	case strings.Contains(consequence, "frameshift"):
+		return "Frameshift"
+	case strings.Contains(consequence, "splice"):
+		return "Splice"
+	case strings.Contains(consequence, "inframe"):
+		return "Inframe"
+	case strings.Contains(consequence, "synonymous"):
+		return "Synonymous"
+	}
+	return ""
+}
+
+// normalizePathogenicity maps ClinVar CLNSIG values to schema values
+func normalizePathogenicity(clnsig string) string {
+	switch strings.ToLower(strings.ReplaceAll(clnsig, "_", " ")) {
+	case "pathogenic":
+		return "Pathogenic"
+	case "likely pathogenic", "pathogenic/likely pathogenic":
+		return "Likely Pathogenic"
+	case "benign":
+		return "Benign"
+	case "likely benign", "benign/likely benign":
+		return "Likely Benign"
+	case "uncertain significance", "uncertain", "vus":
+		return "Uncertain"
+	}
+	return ""
+}
+
+// significanceName maps mutations.Significance to schema pathogenicity values
+func significanceName(s mutations.Significance) string {
+	if s == mutations.SignificanceUnknown {
+		return ""
+	}
+	return s.String()
+}
+
+// mutationTypeName maps mutations.MutationType to schema mutation types
+func mutationTypeName(mt mutations.MutationType) string {
+	if mt == mutations.MutationUnknown {
+		return ""
+	}
+	return mt.String()
+}
+
+// normalizeChromosome strips a "chr" prefix and maps M to MT
+func normalizeChromosome(chr string) string {
+	chr = strings.TrimPrefix(strings.TrimPrefix(chr, "chr"), "CHR")
+	if chr == "M" {
+		return "MT"
+	}
+	return chr
+}
+
+// variantID builds a stable identifier from the variant coordinates
+func variantID(v *VariantRecord) string {
+	return fmt.Sprintf("%s:%d:%s>%s", v.Chromosome, v.Position, v.RefAllele, v.AltAllele)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Execute parses and runs a SELECT statement against the store.
+// Callers are expected to have validated the SQL first; Execute still refuses
+// anything other than a single-table SELECT over variants.
+func (vs *VariantStore) Execute(ctx context.Context, sql string, limits ExecutionLimits) (*QueryExecution, error) {
+	startTime := time.Now()
+
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	stmt, err := parseSQL(sql)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SQL: %w", err)
+	}
+	if len(stmt.From) != 1 || len(stmt.Joins) > 0 || stmt.From[0].Name != "variants" {
+		return nil, fmt.Errorf("only single-table queries over variants are supported")
+	}
+
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	exec := &queryExecutor{ctx: ctx, stmt: stmt}
+	result, err := exec.run(vs.records, limits.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+
+	result.ExecutionTimeMs = time.Since(startTime).Milliseconds()
+	return result, nil
+}
+
+// queryExecutor evaluates a parsed SELECT over variant records
+type queryExecutor struct {
+	ctx     context.Context
+	stmt    *sqlSelect
+	checked int
+}
+
+// resultRow is an output row plus the data needed to evaluate ORDER BY
+type resultRow struct {
+	values []interface{}
+	source []*VariantRecord // One record, or every record in the group
+}
+
+// checkDeadline polls the context every 1024 rows
+func (qe *queryExecutor) checkDeadline() error {
+	qe.checked++
+	if qe.checked%1024 == 0 {
+		if err := qe.ctx.Err(); err != nil {
+			return fmt.Errorf("query cancelled: %w", err)
+		}
+	}
+	return nil
+}
+
+// run executes the statement
+func (qe *queryExecutor) run(records []*VariantRecord, maxRows int) (*QueryExecution, error) {
+	stmt := qe.stmt
+
+	// Resolve the SELECT list into output columns
+	columns := make([]string, 0, len(stmt.Items))
+	exprs := make([]sqlExpr, 0, len(stmt.Items))
+	for _, item := range stmt.Items {
+		if item.Star {
+			for _, col := range VariantColumns {
+				columns = append(columns, col)
+				exprs = append(exprs, &sqlColumnRef{Name: col})
+			}
+			continue
+		}
+		name := item.Alias
+		if name == "" {
+			name = exprString(item.Expr)
+		}
+		columns = append(columns, name)
+		exprs = append(exprs, item.Expr)
+	}
+
+	// WHERE
+	matched := make([]*VariantRecord, 0, 1024)
+	for _, record := range records {
+		if err := qe.checkDeadline(); err != nil {
+			return nil, err
+		}
+		if stmt.Where != nil {
+			value, err := qe.eval(stmt.Where, []*VariantRecord{record})
+			if err != nil {
+				return nil, err
+			}
+			if !isTrue(value) {
+				continue
+			}
+		}
+		matched = append(matched, record)
+	}
+
+	// Grouping: explicit GROUP BY, or a single group for bare aggregates
+	grouped := len(stmt.GroupBy) > 0 || stmt.Having != nil
+	for _, expr := range exprs {
+		if containsAggregate(expr) {
+			grouped = true
+		}
+	}
+
+	var groups [][]*VariantRecord
+	if grouped {
+		if len(stmt.GroupBy) == 0 {
+			groups = [][]*VariantRecord{matched}
+		} else {
+			index := make(map[string]int)
+			for _, record := range matched {
+				if err := qe.checkDeadline(); err != nil {
+					return nil, err
+				}
+				var key strings.Builder
+				for _, expr := range stmt.GroupBy {
+					value, err := qe.eval(expr, []*VariantRecord{record})
+					if err != nil {
+						return nil, err
+					}
+					fmt.Fprintf(&key, "%v\x00", value)
+				}
+				i, ok := index[key.String()]
+				if !ok {
+					i = len(groups)
+					index[key.String()] = i
+					groups = append(groups, nil)
+				}
+				groups[i] = append(groups[i], record)
+			}
+		}
+	} else {
+		groups = make([][]*VariantRecord, len(matched))
+		for i, record := range matched {
+			groups[i] = []*VariantRecord{record}
+		}
+	}
+
+	// Project (and apply HAVING)
+	rows := make([]resultRow, 0, len(groups))
+	for _, group := range groups {
+		if err := qe.checkDeadline(); err != nil {
+			return nil, err
+		}
+		if stmt.Having != nil {
+			value, err := qe.eval(stmt.Having, group)
+			if err != nil {
+				return nil, err
+			}
+			if !isTrue(value) {
+				continue
+			}
+		}
+		values := make([]interface{}, len(exprs))
+		for i, expr := range exprs {
+			value, err := qe.eval(expr, group)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		rows = append(rows, resultRow{values: values, source: group})
+	}
+
+	if stmt.Distinct {
+		seen := make(map[string]bool)
+		unique := rows[:0]
+		for _, row := range rows {
+			key := fmt.Sprint(row.values...)
+			if !seen[key] {
+				seen[key] = true
+				unique = append(unique, row)
+			}
+		}
+		rows = unique
+	}
+
+	// ORDER BY: output aliases take precedence over table columns
+	if len(stmt.OrderBy) > 0 {
+		keys := make([][]interface{}, len(rows))
+		for i, row := range rows {
+			keys[i] = make([]interface{}, len(stmt.OrderBy))
+			for j, item := range stmt.OrderBy {
+				value, err := qe.orderValue(item.Expr, row, columns)
+				if err != nil {
+					return nil, err
+				}
+				keys[i][j] = value
+			}
+		}
+		order := make([]int, len(rows))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			for j, item := range stmt.OrderBy {
+				c := compareValues(keys[order[a]][j], keys[order[b]][j])
+				if c == 0 {
+					continue
+				}
+				if item.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+		sorted := make([]resultRow, len(rows))
+		for i, idx := range order {
+			sorted[i] = rows[idx]
+		}
+		rows = sorted
+	}
+
+	// OFFSET / LIMIT / MaxRows
+	if stmt.Offset > 0 {
+		if stmt.Offset >= len(rows) {
+			rows = rows[:0]
+		} else {
+			rows = rows[stmt.Offset:]
+		}
+	}
+	if stmt.Limit >= 0 && stmt.Limit < len(rows) {
+		rows = rows[:stmt.Limit]
+	}
+	truncated := false
+	if maxRows > 0 && len(rows) > maxRows {
+		rows = rows[:maxRows]
+		truncated = true
+	}
+
+	result := &QueryExecution{
+		Columns:   columns,
+		Rows:      make([]map[string]interface{}, len(rows)),
+		RowCount:  len(rows),
+		Truncated: truncated,
+	}
+	for i, row := range rows {
+		out := make(map[string]interface{}, len(columns))
+		for j, col := range columns {
+			out[col] = jsonValue(row.values[j])
+		}
+		result.Rows[i] = out
+	}
+
+	return result, nil
+}
+
+// orderValue resolves an ORDER BY term against output aliases, then the source rows
+func (qe *queryExecutor) orderValue(expr sqlExpr, row resultRow, columns []string) (interface{}, error) {
+	if ref, ok := expr.(*sqlColumnRef); ok {
+		for i, col := range columns {
+			if col == ref.Name {
+				return row.values[i], nil
+			}
+		}
+	}
+	if lit, ok := expr.(*sqlLiteral); ok {
+		// ORDER BY 2 refers to the second output column
+		if n, ok := lit.Value.(float64); ok && n >= 1 && int(n) <= len(columns) {
+			return row.values[int(n)-1], nil
+		}
+	}
+	return qe.eval(expr, row.source)
+}
+
+// eval evaluates an expression over a group of records. Non-aggregate
+// expressions use the first record of the group.
+func (qe *queryExecutor) eval(expr sqlExpr, group []*VariantRecord) (interface{}, error) {
+	switch e := expr.(type) {
+	case *sqlLiteral:
+		return e.Value, nil
+
+	case *sqlColumnRef:
+		if len(group) == 0 {
+			return nil, nil
+		}
+		value, ok := group[0].column(e.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q (position %d)", e.Name, e.Pos)
+		}
+		return value, nil
+
+	case *sqlUnaryExpr:
+		value, err := qe.eval(e.Expr, group)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		if e.Op == "NOT" {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("NOT requires a boolean operand (position %d)", e.Pos)
+			}
+			return !b, nil
+		}
+		n, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("unary minus requires a number (position %d)", e.Pos)
+		}
+		return -n, nil
+
+	case *sqlBinaryExpr:
+		return qe.evalBinary(e, group)
+
+	case *sqlIsNullExpr:
+		value, err := qe.eval(e.Expr, group)
+		if err != nil {
+			return nil, err
+		}
+		return (value == nil) != e.Not, nil
+
+	case *sqlBetweenExpr:
+		value, err := qe.eval(e.Expr, group)
+		if err != nil {
+			return nil, err
+		}
+		low, err := qe.eval(e.Low, group)
+		if err != nil {
+			return nil, err
+		}
+		high, err := qe.eval(e.High, group)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil || low == nil || high == nil {
+			return nil, nil
+		}
+		in := compareValues(value, low) >= 0 && compareValues(value, high) <= 0
+		return in != e.Not, nil
+
+	case *sqlInExpr:
+		if e.Subquery != nil {
+			return nil, fmt.Errorf("subqueries are not supported (position %d)", e.Pos)
+		}
+		value, err := qe.eval(e.Expr, group)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		for _, item := range e.List {
+			candidate, err := qe.eval(item, group)
+			if err != nil {
+				return nil, err
+			}
+			if candidate != nil && compareValues(value, candidate) == 0 {
+				return !e.Not, nil
+			}
+		}
+		return e.Not, nil
+
+	case *sqlFuncCall:
+		return qe.evalFunc(e, group)
+
+	case *sqlSubquery:
+		return nil, fmt.Errorf("subqueries are not supported (position %d)", e.Pos)
+	}
+
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+// evalBinary evaluates logical, comparison, LIKE and arithmetic operators
+func (qe *queryExecutor) evalBinary(e *sqlBinaryExpr, group []*VariantRecord) (interface{}, error) {
+	left, err := qe.eval(e.Left, group)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit three-valued logic
+	switch e.Op {
+	case "AND":
+		if left == false {
+			return false, nil
+		}
+	case "OR":
+		if left == true {
+			return true, nil
+		}
+	}
+
+	right, err := qe.eval(e.Right, group)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Op {
+	case "AND":
+		if right == false {
+			return false, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return true, nil
+	case "OR":
+		if right == true {
+			return true, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return false, nil
+	}
+
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	switch e.Op {
+	case "=":
+		return compareValues(left, right) == 0, nil
+	case "!=":
+		return compareValues(left, right) != 0, nil
+	case "<":
+		return compareValues(left, right) < 0, nil
+	case "<=":
+		return compareValues(left, right) <= 0, nil
+	case ">":
+		return compareValues(left, right) > 0, nil
+	case ">=":
+		return compareValues(left, right) >= 0, nil
+	case "LIKE":
+		pattern, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("LIKE pattern must be a string (position %d)", e.Pos)
+		}
+		return likeMatch(fmt.Sprint(left), pattern), nil
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s requires numbers (position %d)", e.Op, e.Pos)
+	}
+	switch e.Op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, nil
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, nil
+		}
+		return math.Mod(l, r), nil
+	}
+
+	return nil, fmt.Errorf("unsupported operator %s (position %d)", e.Op, e.Pos)
+}
+
+// sqlAggregates are the supported aggregate functions
+var sqlAggregates = map[string]bool{
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+}
+
+// containsAggregate reports whether an expression uses an aggregate function
+func containsAggregate(expr sqlExpr) bool {
+	switch e := expr.(type) {
+	case *sqlFuncCall:
+		if sqlAggregates[e.Name] {
+			return true
+		}
+		for _, arg := range e.Args {
+			if containsAggregate(arg) {
+				return true
+			}
+		}
+	case *sqlBinaryExpr:
+		return containsAggregate(e.Left) || containsAggregate(e.Right)
+	case *sqlUnaryExpr:
+		return containsAggregate(e.Expr)
+	}
+	return false
+}
+
+// evalFunc evaluates aggregate and scalar functions
+func (qe *queryExecutor) evalFunc(e *sqlFuncCall, group []*VariantRecord) (interface{}, error) {
+	if sqlAggregates[e.Name] {
+		if e.Star {
+			if e.Name != "COUNT" {
+				return nil, fmt.Errorf("%s(*) is not supported (position %d)", e.Name, e.Pos)
+			}
+			return float64(len(group)), nil
+		}
+		if len(e.Args) != 1 {
+			return nil, fmt.Errorf("%s expects one argument (position %d)", e.Name, e.Pos)
+		}
+
+		values := make([]interface{}, 0, len(group))
+		seen := make(map[string]bool)
+		for _, record := range group {
+			value, err := qe.eval(e.Args[0], []*VariantRecord{record})
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				continue
+			}
+			if e.Distinct {
+				key := fmt.Sprint(value)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			values = append(values, value)
+		}
+
+		switch e.Name {
+		case "COUNT":
+			return float64(len(values)), nil
+		case "MIN", "MAX":
+			var best interface{}
+			for _, v := range values {
+				if best == nil ||
+					(e.Name == "MIN" && compareValues(v, best) < 0) ||
+					(e.Name == "MAX" && compareValues(v, best) > 0) {
+					best = v
+				}
+			}
+			return best, nil
+		default: // SUM, AVG
+			if len(values) == 0 {
+				return nil, nil
+			}
+			sum := 0.0
+			for _, v := range values {
+				n, ok := v.(float64)
+				if !ok {
+					return nil, fmt.Errorf("%s requires a numeric column (position %d)", e.Name, e.Pos)
+				}
+				sum += n
+			}
+			if e.Name == "AVG" {
+				return sum / float64(len(values)), nil
+			}
+			return sum, nil
+		}
+	}
+
+	args := make([]interface{}, len(e.Args))
+	for i, arg := range e.Args {
+		value, err := qe.eval(arg, group)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	switch e.Name {
+	case "UPPER", "LOWER", "LENGTH", "ABS", "ROUND":
+		if len(args) < 1 || args[0] == nil {
+			return nil, nil
+		}
+	}
+	switch e.Name {
+	case "UPPER":
+		return strings.ToUpper(fmt.Sprint(args[0])), nil
+	case "LOWER":
+		return strings.ToLower(fmt.Sprint(args[0])), nil
+	case "LENGTH":
+		return float64(len(fmt.Sprint(args[0]))), nil
+	case "ABS":
+		if n, ok := args[0].(float64); ok {
+			return math.Abs(n), nil
+		}
+	case "ROUND":
+		if n, ok := args[0].(float64); ok {
+			digits := 0.0
+			if len(args) > 1 {
+				digits, _ = args[1].(float64)
+			}
+			scale := math.Pow(10, digits)
+			return math.Round(n*scale) / scale, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported function %s (position %d)", e.Name, e.Pos)
+}
+
+// compareValues orders two non-NULL values: numbers numerically, everything else as text
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1 // NULLs sort first
+		default:
+			return 1
+		}
+	}
+
+	af, aNum := a.(float64)
+	bf, bNum := b.(float64)
+	if aNum && bNum {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+
+	as, bs := fmt.Sprint(a), fmt.Sprint(b)
+	if aNum {
+		as = strconv.FormatFloat(af, 'f', -1, 64)
+	}
+	if bNum {
+		bs = strconv.FormatFloat(bf, 'f', -1, 64)
+	}
+	return strings.Compare(as, bs)
+}
+
+// isTrue reports whether a predicate value is SQL TRUE (NULL counts as false)
+func isTrue(value interface{}) bool {
+	b, ok := value.(bool)
+	return ok && b
+}
+
+// likePatternCache avoids recompiling LIKE patterns per row
+var likePatternCache sync.Map
+
+// likeMatch implements case-insensitive SQL LIKE with % and _ wildcards
+func likeMatch(value, pattern string) bool {
+	var re *regexp.Regexp
+	if cached, ok := likePatternCache.Load(pattern); ok {
+		re = cached.(*regexp.Regexp)
+	} else {
+		var sb strings.Builder
+		sb.WriteString("(?is)^")
+		for _, r := range pattern {
+			switch r {
+			case '%':
+				sb.WriteString(".*")
+			case '_':
+				sb.WriteString(".")
+			default:
+				sb.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		sb.WriteString("$")
+		re = regexp.MustCompile(sb.String())
+		likePatternCache.Store(pattern, re)
+	}
+	return re.MatchString(value)
+}
+
+// jsonValue converts integral floats back to integers for cleaner JSON output
+func jsonValue(value interface{}) interface{} {
+	if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return value
+}
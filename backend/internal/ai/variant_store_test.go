@@ -0,0 +1,132 @@
+/**
+ * Variant Store Tests
+ *
+ * Executes example queries against a small in-memory variants table
+ */
+
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCOSMICData = `# Chromosome	Position	Ref	Alt	Type	Gene	Samples	Significance	Frequency
+17	7577120	C	T	Missense	TP53	1200	Pathogenic	0.002
+17	7578406	C	T	Nonsense	TP53	450	Pathogenic	0.0005
+12	25398284	C	T	Missense	KRAS	3000	Pathogenic	0.004
+17	41245466	G	A	Frameshift	BRCA1	80	Likely_Pathogenic	0.02
+7	55259515	T	G	Missense	EGFR	900	Pathogenic
+X	153296777	G	A	Synonymous	MECP2	3	Benign	0.15
+`
+
+const testVCFData = `##fileformat=VCFv4.2
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO
+chr13	32914438	rs80359550	T	TG,TGG	.	PASS	GENEINFO=BRCA2:675;CLNSIG=Pathogenic;AF=0.0001,0.0002;MC=SO:0001589|frameshift_variant
+chrM	3243	COSV1	A	G	.	PASS	GENE=MT-TL1_ENST0001;CNT=12
+`
+
+func newTestStore(t *testing.T) *VariantStore {
+	store := NewVariantStore()
+	if _, err := store.LoadCOSMIC(strings.NewReader(testCOSMICData)); err != nil {
+		t.Fatalf("LoadCOSMIC failed: %v", err)
+	}
+	if _, err := store.LoadVCF(strings.NewReader(testVCFData)); err != nil {
+		t.Fatalf("LoadVCF failed: %v", err)
+	}
+	return store
+}
+
+// TestVariantStoreExecute tests query execution over loaded variants
+func TestVariantStoreExecute(t *testing.T) {
+	store := newTestStore(t)
+	if store.Count() != 9 {
+		t.Fatalf("Expected 9 variants, got %d", store.Count())
+	}
+
+	tests := []struct {
+		name     string
+		sql      string
+		expected int
+	}{
+		{"Gene lookup", "SELECT * FROM variants WHERE gene = 'TP53'", 2},
+		{"AF threshold", "SELECT * FROM variants WHERE af > 0.01", 2},
+		{"Region", "SELECT * FROM variants WHERE chromosome = '17' AND position BETWEEN 7571720 AND 7590868", 2},
+		{"IN list", "SELECT * FROM variants WHERE chromosome IN ('X', 'Y')", 1},
+		{"IS NOT NULL", "SELECT * FROM variants WHERE rsid IS NOT NULL", 2},
+		{"Mitochondrial", "SELECT * FROM variants WHERE chromosome = 'MT'", 1},
+		{"LIKE", "SELECT gene FROM variants WHERE gene LIKE 'brc%'", 3},
+		{"Multi-allelic frameshift", "SELECT * FROM variants WHERE mutation_type = 'Frameshift'", 3},
+		{"Group by", "SELECT gene, COUNT(*) as count FROM variants GROUP BY gene ORDER BY count DESC LIMIT 10", 7},
+		{"LIMIT", "SELECT * FROM variants LIMIT 3", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := store.Execute(context.Background(), tt.sql, DefaultExecutionLimits())
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if result.RowCount != tt.expected {
+				t.Errorf("Expected %d rows, got %d: %v", tt.expected, result.RowCount, result.Rows)
+			}
+		})
+	}
+}
+
+// TestVariantStoreOrdering tests ORDER BY and aggregate values
+func TestVariantStoreOrdering(t *testing.T) {
+	store := newTestStore(t)
+
+	result, err := store.Execute(context.Background(),
+		"SELECT gene, sample_count FROM variants WHERE sample_count > 100 ORDER BY sample_count DESC",
+		DefaultExecutionLimits())
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.RowCount != 4 || result.Rows[0]["gene"] != "KRAS" || result.Rows[3]["gene"] != "TP53" {
+		t.Errorf("Unexpected ordering: %v", result.Rows)
+	}
+
+	result, err = store.Execute(context.Background(),
+		"SELECT gene, COUNT(*) AS n FROM variants GROUP BY gene ORDER BY n DESC, gene LIMIT 1",
+		DefaultExecutionLimits())
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Rows[0]["gene"] != "TP53" && result.Rows[0]["gene"] != "BRCA2" {
+		t.Errorf("Expected TP53 or BRCA2 first, got %v", result.Rows[0])
+	}
+	if result.Rows[0]["n"] != int64(2) {
+		t.Errorf("Expected count 2, got %v", result.Rows[0]["n"])
+	}
+}
+
+// TestVariantStoreLimits tests MaxRows truncation and timeouts
+func TestVariantStoreLimits(t *testing.T) {
+	store := newTestStore(t)
+
+	result, err := store.Execute(context.Background(), "SELECT * FROM variants",
+		ExecutionLimits{MaxRows: 2, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.RowCount != 2 || !result.Truncated {
+		t.Errorf("Expected 2 truncated rows, got %d (truncated=%v)", result.RowCount, result.Truncated)
+	}
+
+	for i := 0; i < 5000; i++ {
+		store.Add(&VariantRecord{ID: "filler", Chromosome: "1"})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := store.Execute(ctx, "SELECT * FROM variants", DefaultExecutionLimits()); err == nil {
+		t.Error("Expected cancelled context to abort the query")
+	}
+
+	if _, err := store.Execute(context.Background(), "SELECT * FROM genes", DefaultExecutionLimits()); err == nil {
+		t.Error("Expected error for unknown table")
+	}
+}
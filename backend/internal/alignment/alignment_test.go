@@ -0,0 +1,535 @@
+package alignment
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"genomevedic/internal/bgzf"
+)
+
+// testReferences are the references declared by the synthetic BAM
+var testReferences = []BAMReference{
+	{Name: "chr1", Length: 400000},
+	{Name: "chr2", Length: 150000},
+	{Name: "chr3", Length: 60000},
+}
+
+// testRead is an alignment to encode into the synthetic BAM
+type testRead struct {
+	name  string
+	refID int
+	pos   int64
+	flag  uint16
+	cigar string
+	seq   string
+	qual  []byte // nil is written as missing (0xff)
+}
+
+// end returns the exclusive reference end of the read
+func (r testRead) end() int64 {
+	ops, _ := parseCigar(r.cigar)
+	rec := BAMRecord{Pos: r.pos, Cigar: ops}
+	return rec.End()
+}
+
+// testReads generates coordinate-sorted reads over testReferences, including
+// spliced reads long enough to land in high-level bins, followed by unmapped reads
+func testReads() []testRead {
+	rng := rand.New(rand.NewSource(7))
+	var reads []testRead
+	for refID, ref := range testReferences {
+		var positions []int64
+		for i := 0; i < int(ref.Length/150); i++ {
+			positions = append(positions, rng.Int63n(ref.Length-50000))
+		}
+		sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+		for i, pos := range positions {
+			cigar := "50M"
+			if i%97 == 0 {
+				cigar = fmt.Sprintf("25M%dN25M", 1000+rng.Intn(40000))
+			}
+			reads = append(reads, testRead{
+				name:  fmt.Sprintf("r%d_%d", refID, i),
+				refID: refID,
+				pos:   pos,
+				cigar: cigar,
+				seq:   strings.Repeat("ACGTN", 10),
+				qual:  bytes.Repeat([]byte{30}, 50),
+			})
+		}
+	}
+	for i := 0; i < 5; i++ {
+		reads = append(reads, testRead{name: fmt.Sprintf("u%d", i), refID: -1, pos: -1, flag: FlagUnmapped, cigar: "*", seq: "ACGT"})
+	}
+	return reads
+}
+
+// encodeRead encodes one BAM alignment record, including block_size
+func encodeRead(r testRead) []byte {
+	le := binary.LittleEndian
+	ops, _ := parseCigar(r.cigar)
+	beg, end := r.pos, r.end()
+	if end <= beg {
+		end = beg + 1
+	}
+	bin := uint32(4680) // Bin of unplaced reads
+	if r.refID >= 0 {
+		bin = bgzf.RegionToBin(beg, end, baiMinShift, baiDepth)
+	}
+
+	var rec bytes.Buffer
+	put32 := func(v int32) { binary.Write(&rec, le, v) }
+	put32(int32(r.refID))
+	put32(int32(r.pos))
+	rec.WriteByte(byte(len(r.name) + 1))
+	rec.WriteByte(60)
+	binary.Write(&rec, le, uint16(bin))
+	binary.Write(&rec, le, uint16(len(ops)))
+	binary.Write(&rec, le, r.flag)
+	put32(int32(len(r.seq)))
+	put32(-1)
+	put32(-1)
+	put32(0)
+	rec.WriteString(r.name)
+	rec.WriteByte(0)
+	for _, op := range ops {
+		binary.Write(&rec, le, uint32(op.Len)<<4|uint32(strings.IndexByte(cigarOpChars, op.Op)))
+	}
+	packed := make([]byte, (len(r.seq)+1)/2)
+	for i := 0; i < len(r.seq); i++ {
+		code := byte(strings.IndexByte(bamSeqAlphabet, r.seq[i]))
+		if i%2 == 0 {
+			packed[i/2] = code << 4
+		} else {
+			packed[i/2] |= code
+		}
+	}
+	rec.Write(packed)
+	if r.qual != nil {
+		rec.Write(r.qual)
+	} else {
+		rec.Write(bytes.Repeat([]byte{0xff}, len(r.seq)))
+	}
+
+	out := make([]byte, 4, 4+rec.Len())
+	le.PutUint32(out, uint32(rec.Len()))
+	return append(out, rec.Bytes()...)
+}
+
+// writeBAM writes reads to path, starting a new BGZF block every few records,
+// and returns the virtual offset range of each record
+func writeBAM(t *testing.T, path string, reads []testRead) []bgzf.Chunk {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := bgzf.NewWriter(file)
+
+	le := binary.LittleEndian
+	text := "@HD\tVN:1.6\tSO:coordinate\n"
+	var header bytes.Buffer
+	header.WriteString("BAM\x01")
+	binary.Write(&header, le, int32(len(text)))
+	header.WriteString(text)
+	binary.Write(&header, le, int32(len(testReferences)))
+	for _, ref := range testReferences {
+		binary.Write(&header, le, int32(len(ref.Name)+1))
+		header.WriteString(ref.Name + "\x00")
+		binary.Write(&header, le, int32(ref.Length))
+	}
+	w.Write(header.Bytes())
+	w.Flush()
+
+	offsets := make([]bgzf.Chunk, len(reads))
+	for i, r := range reads {
+		offsets[i].Begin = w.VirtualOffset()
+		if _, err := w.Write(encodeRead(r)); err != nil {
+			t.Fatal(err)
+		}
+		offsets[i].End = w.VirtualOffset()
+		if i%7 == 6 {
+			w.Flush()
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return offsets
+}
+
+// writeIndex writes a BAI, or a BGZF-compressed CSI with the given depth,
+// for reads stored at offsets
+func writeIndex(t *testing.T, path string, format BAMIndexFormat, depth int, reads []testRead, offsets []bgzf.Chunk) {
+	t.Helper()
+	type bin struct {
+		loffset uint64
+		chunks  []bgzf.Chunk
+	}
+	minShift := baiMinShift
+	bins := make([]map[uint32]*bin, len(testReferences))
+	linear := make([][]uint64, len(testReferences))
+	for i := range bins {
+		bins[i] = make(map[uint32]*bin)
+	}
+	getBin := func(refID int, id uint32) *bin {
+		if bins[refID][id] == nil {
+			bins[refID][id] = &bin{loffset: ^uint64(0)}
+		}
+		return bins[refID][id]
+	}
+
+	for i, r := range reads {
+		if r.refID < 0 {
+			continue
+		}
+		beg, end := r.pos, r.end()
+		b := getBin(r.refID, bgzf.RegionToBin(beg, end, minShift, depth))
+		b.chunks = append(b.chunks, offsets[i])
+
+		// CSI loffset: smallest offset of any read overlapping the bin
+		for _, id := range bgzf.RegionToBins(beg, end, minShift, depth) {
+			if b := getBin(r.refID, id); offsets[i].Begin < b.loffset {
+				b.loffset = offsets[i].Begin
+			}
+		}
+		// BAI linear index: smallest offset of any read overlapping each 16 kb window
+		for window := beg >> baiMinShift; window <= (end-1)>>baiMinShift; window++ {
+			for int64(len(linear[r.refID])) <= window {
+				linear[r.refID] = append(linear[r.refID], 0)
+			}
+			if linear[r.refID][window] == 0 || offsets[i].Begin < linear[r.refID][window] {
+				linear[r.refID][window] = offsets[i].Begin
+			}
+		}
+	}
+
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	put := func(v interface{}) { binary.Write(&buf, le, v) }
+	if format == IndexFormatBAI {
+		buf.WriteString("BAI\x01")
+	} else {
+		buf.WriteString("CSI\x01")
+		put(int32(minShift))
+		put(int32(depth))
+		put(int32(0))
+	}
+	put(int32(len(testReferences)))
+	for refID := range testReferences {
+		var ids []uint32
+		for id, b := range bins[refID] {
+			if len(b.chunks) > 0 {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		put(int32(len(ids)))
+		for _, id := range ids {
+			b := bins[refID][id]
+			put(id)
+			if format == IndexFormatCSI {
+				put(b.loffset)
+			}
+			put(int32(len(b.chunks)))
+			for _, chunk := range b.chunks {
+				put(chunk.Begin)
+				put(chunk.End)
+			}
+		}
+		if format == IndexFormatBAI {
+			put(int32(len(linear[refID])))
+			for _, offset := range linear[refID] {
+				put(offset)
+			}
+		}
+	}
+
+	data := buf.Bytes()
+	if format == IndexFormatCSI {
+		var compressed bytes.Buffer
+		w := bgzf.NewWriter(&compressed)
+		w.Write(data)
+		w.Close()
+		data = compressed.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readNames drains a reader and returns the read names
+func readNames(t *testing.T, reader Reader) []string {
+	t.Helper()
+	var names []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, record.Name)
+	}
+}
+
+// overlapping lists by brute force the reads overlapping refID:[beg, end)
+func overlapping(reads []testRead, refID int, beg, end int64) []string {
+	var names []string
+	for _, r := range reads {
+		if r.refID == refID && r.pos < end && r.end() > beg {
+			names = append(names, r.name)
+		}
+	}
+	return names
+}
+
+// TestBAMDecoding checks header, record fields, missing qualities and
+// unmapped reads round-trip through the BAM reader
+func TestBAMDecoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reads.bam")
+	reads := []testRead{
+		{name: "a", refID: 0, pos: 99, flag: FlagPaired | FlagReverse, cigar: "5S10M2I3D8M", seq: strings.Repeat("ACGTN", 5), qual: bytes.Repeat([]byte{35}, 25)},
+		{name: "b", refID: 1, pos: 0, cigar: "7M", seq: "ACGTACG"},
+		{name: "c", refID: -1, pos: -1, flag: FlagUnmapped, cigar: "*", seq: "TTT"},
+	}
+	writeBAM(t, path, reads)
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.Format() != "BAM" || !strings.HasPrefix(reader.Header().Text, "@HD") || len(reader.Header().References) != 3 {
+		t.Fatalf("Unexpected header %+v (%s)", reader.Header(), reader.Format())
+	}
+
+	a, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "a" || a.RefName != "chr1" || a.Pos != 99 || !a.IsReverse() || a.CigarString() != "5S10M2I3D8M" ||
+		a.End() != 120 || a.Seq != reads[0].seq || a.AverageQuality() != 35 {
+		t.Errorf("Unexpected record %+v", a)
+	}
+
+	b, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.RefName != "chr2" || b.Seq != "ACGTACG" || b.Qual != nil {
+		t.Errorf("Expected odd-length sequence without qualities, got %+v", b)
+	}
+
+	c, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsUnmapped() || c.RefName != "" || c.Cigar != nil {
+		t.Errorf("Expected unmapped read, got %+v", c)
+	}
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+// TestSAMDecoding checks SAM parsing and that plain gzip is rejected
+func TestSAMDecoding(t *testing.T) {
+	dir := t.TempDir()
+	sam := "@HD\tVN:1.6\n" +
+		"@SQ\tSN:chr1\tLN:1000\n" +
+		"r1\t99\tchr1\t100\t60\t4M\t=\t200\t104\tACGT\tIIII\n" +
+		"r2\t4\t*\t0\t0\t*\t*\t0\t0\tAC\t*\n" +
+		"r3\t0\tchrX\t5\t60\t2M\t*\t0\t0\tAC\t##\n"
+	path := filepath.Join(dir, "reads.sam")
+	os.WriteFile(path, []byte(sam), 0644)
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.Format() != "SAM" || len(reader.Header().References) != 1 || reader.Header().References[0].Length != 1000 {
+		t.Fatalf("Unexpected header %+v", reader.Header())
+	}
+
+	r1, _ := reader.Read()
+	if r1.Pos != 99 || r1.NextRefID != 0 || r1.NextPos != 199 || r1.End() != 103 || r1.AverageQuality() != 40 {
+		t.Errorf("Unexpected record %+v", r1)
+	}
+	r2, _ := reader.Read()
+	if !r2.IsUnmapped() || r2.Qual != nil {
+		t.Errorf("Expected unmapped read without qualities, got %+v", r2)
+	}
+	r3, _ := reader.Read()
+	if r3.RefID != 1 || r3.RefName != "chrX" || r3.Qual[0] != 2 {
+		t.Errorf("Expected reference registered on the fly, got %+v", r3)
+	}
+
+	bad := filepath.Join(dir, "bad.sam")
+	os.WriteFile(bad, []byte("r1\t0\tchr1\t1\t60\t4Q\t*\t0\t0\tACGT\t*\n"), 0644)
+	if reader, err := Open(bad); err == nil {
+		if _, err := reader.Read(); err == nil || !strings.Contains(err.Error(), "invalid CIGAR") {
+			t.Errorf("Expected CIGAR error, got %v", err)
+		}
+		reader.Close()
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(sam))
+	zw.Close()
+	gzPath := filepath.Join(dir, "reads.sam.gz")
+	os.WriteFile(gzPath, gz.Bytes(), 0644)
+	if _, err := Open(gzPath); err == nil {
+		t.Error("Expected plain gzip to be rejected")
+	}
+}
+
+// TestIndexedRegions compares BAI and CSI region queries with a brute-force scan
+func TestIndexedRegions(t *testing.T) {
+	reads := testReads()
+	queries := []struct {
+		chr      string
+		beg, end int64
+	}{
+		{"chr1", 0, 400000},
+		{"chr1", 16000, 17000},
+		{"chr1", 131071, 131073},
+		{"chr1", 300000, 300001},
+		{"chr2", 0, 1},
+		{"chr2", 50000, 90000},
+		{"chr3", 9000, 1 << 20},
+	}
+
+	for _, tc := range []struct {
+		format BAMIndexFormat
+		depth  int
+		suffix string
+	}{
+		{IndexFormatBAI, baiDepth, ".bai"},
+		{IndexFormatCSI, 6, ".csi"},
+	} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "reads.bam")
+		offsets := writeBAM(t, path, reads)
+		writeIndex(t, path+tc.suffix, tc.format, tc.depth, reads, offsets)
+
+		for _, q := range queries {
+			reader, indexed, err := OpenRegion(path, q.chr, q.beg, q.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !indexed {
+				t.Fatalf("%s: index not used", tc.format)
+			}
+			got := readNames(t, reader)
+			reader.Close()
+
+			want := overlapping(reads, reader.Header().ReferenceID(q.chr), q.beg, q.end)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%s %s:%d-%d: got %d reads, want %d", tc.format, q.chr, q.beg, q.end, len(got), len(want))
+			}
+		}
+
+		if _, _, err := OpenRegion(path, "chrZ", 0, 100); err == nil {
+			t.Errorf("%s: expected error for unknown reference", tc.format)
+		}
+	}
+}
+
+// TestRegionReaderSkipsPrecedingReference reads a chunk that starts on an
+// earlier reference: its records are skipped rather than ending the query
+func TestRegionReaderSkipsPrecedingReference(t *testing.T) {
+	reads := testReads()
+	path := filepath.Join(t.TempDir(), "reads.bam")
+	offsets := writeBAM(t, path, reads)
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := &regionReader{
+		bam:    reader.(*bamReader),
+		refID:  1,
+		beg:    0,
+		end:    testReferences[1].Length,
+		chunks: []bgzf.Chunk{{Begin: offsets[0].Begin, End: offsets[len(offsets)-1].End}},
+	}
+	defer rr.Close()
+
+	got := readNames(t, rr)
+	want := overlapping(reads, 1, 0, testReferences[1].Length)
+	if len(want) == 0 || strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Got %d reads, want %d", len(got), len(want))
+	}
+}
+
+// TestUnusableIndexFallsBack scans the whole file when the index is corrupt,
+// stale or built for another BAM
+func TestUnusableIndexFallsBack(t *testing.T) {
+	reads := testReads()
+	want := overlapping(reads, 1, 20000, 60000)
+
+	for _, problem := range []string{"corrupt", "stale", "mismatched"} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "reads.bam")
+		offsets := writeBAM(t, path, reads)
+		index := path + ".bai"
+		writeIndex(t, index, IndexFormatBAI, baiDepth, reads, offsets)
+
+		switch problem {
+		case "corrupt":
+			data, _ := os.ReadFile(index)
+			os.WriteFile(index, data[:len(data)/2], 0644)
+		case "stale":
+			old := time.Now().Add(-time.Hour)
+			os.Chtimes(index, old, old)
+		case "mismatched":
+			os.WriteFile(index, []byte("BAI\x01\x00\x00\x00\x00"), 0644)
+		}
+
+		reader, indexed, err := OpenRegion(path, "chr2", 20000, 60000)
+		if err != nil {
+			t.Fatalf("%s index: %v", problem, err)
+		}
+		if indexed {
+			t.Errorf("%s index was used", problem)
+		}
+		got := readNames(t, reader)
+		reader.Close()
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s index: got %d reads, want %d", problem, len(got), len(want))
+		}
+	}
+}
+
+// TestSAMRegion filters SAM input by scanning
+func TestSAMRegion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reads.sam")
+	os.WriteFile(path, []byte("@SQ\tSN:chr1\tLN:1000\n@SQ\tSN:chr2\tLN:1000\n"+
+		"a\t0\tchr1\t1\t60\t10M\t*\t0\t0\t*\t*\n"+
+		"b\t0\tchr1\t50\t60\t10M\t*\t0\t0\t*\t*\n"+
+		"c\t0\tchr2\t50\t60\t10M\t*\t0\t0\t*\t*\n"), 0644)
+
+	reader, indexed, err := OpenRegion(path, "chr1", 40, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if got := readNames(t, reader); indexed || strings.Join(got, ",") != "b" {
+		t.Errorf("Got %v (indexed %v), want [b]", got, indexed)
+	}
+}
@@ -0,0 +1,422 @@
+package alignment
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"genomevedic/internal/bgzf"
+)
+
+// Index binning parameters (SAM specification section 5)
+const (
+	baiMinShift = 14 // 16 kb leaf bins
+	baiDepth    = 5
+)
+
+// BAMIndexFormat identifies the on-disk index flavour
+type BAMIndexFormat string
+
+const (
+	IndexFormatBAI BAMIndexFormat = "BAI"
+	IndexFormatCSI BAMIndexFormat = "CSI"
+)
+
+// bamIndexBin holds the chunks assigned to one bin
+type bamIndexBin struct {
+	loffset uint64 // CSI only: smallest virtual offset of reads starting in the bin
+	chunks  []bgzf.Chunk
+}
+
+// bamRefIndex is the index for a single reference sequence
+type bamRefIndex struct {
+	bins   map[uint32]*bamIndexBin
+	linear []uint64 // BAI only: smallest virtual offset per 16 kb window
+}
+
+// BAMIndex is a loaded BAI or CSI index
+type BAMIndex struct {
+	Path       string
+	Format     BAMIndexFormat
+	MinShift   int
+	Depth      int
+	references []bamRefIndex
+}
+
+// FindBAMIndex returns the path of an index file next to the BAM, or "" if none exists.
+// Checks <bam>.bai, <bam-without-.bam>.bai and <bam>.csi, in that order.
+func FindBAMIndex(bamPath string) string {
+	candidates := []string{bamPath + ".bai"}
+	if strings.HasSuffix(bamPath, ".bam") {
+		candidates = append(candidates, strings.TrimSuffix(bamPath, ".bam")+".bai")
+	}
+	candidates = append(candidates, bamPath+".csi")
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// LoadBAMIndex loads a BAI or CSI index, detecting the format from its magic.
+// CSI files are usually BGZF-compressed; BAI files are not.
+func LoadBAMIndex(path string) (*BAMIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open BAM index: %w", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = bufio.NewReaderSize(file, 256*1024)
+	peek, _ := r.(*bufio.Reader).Peek(bgzf.HeaderSize)
+	if bgzf.IsBGZF(peek) {
+		r = bgzf.NewReader(file)
+	}
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("failed to read BAM index magic: %w", err)
+	}
+
+	idx := &BAMIndex{Path: path}
+	switch {
+	case bytes.Equal(magic, []byte("BAI\x01")):
+		idx.Format = IndexFormatBAI
+		idx.MinShift = baiMinShift
+		idx.Depth = baiDepth
+		err = idx.readBAI(r)
+	case bytes.Equal(magic, []byte("CSI\x01")):
+		idx.Format = IndexFormatCSI
+		err = idx.readCSI(r)
+	default:
+		return nil, fmt.Errorf("not a BAI/CSI index: bad magic %q", magic)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s index %s: %w", idx.Format, path, err)
+	}
+
+	return idx, nil
+}
+
+// indexReader wraps little-endian reads with sticky error handling
+type indexReader struct {
+	r   io.Reader
+	buf [8]byte
+	err error
+}
+
+func (ir *indexReader) int32() int32 {
+	if ir.err != nil {
+		return 0
+	}
+	_, ir.err = io.ReadFull(ir.r, ir.buf[:4])
+	return int32(binary.LittleEndian.Uint32(ir.buf[:4]))
+}
+
+func (ir *indexReader) uint64() uint64 {
+	if ir.err != nil {
+		return 0
+	}
+	_, ir.err = io.ReadFull(ir.r, ir.buf[:8])
+	return binary.LittleEndian.Uint64(ir.buf[:8])
+}
+
+// count reads a non-negative int32 element count
+func (ir *indexReader) count(what string) int {
+	n := ir.int32()
+	if ir.err == nil && n < 0 {
+		ir.err = fmt.Errorf("negative %s count %d", what, n)
+	}
+	return int(n)
+}
+
+// readBAI parses the body of a BAI file (after the magic)
+func (idx *BAMIndex) readBAI(r io.Reader) error {
+	ir := &indexReader{r: r}
+	pseudoBin := maxBinID(idx.Depth) + 1
+
+	nRef := ir.count("reference")
+	idx.references = make([]bamRefIndex, 0, nRef)
+	for i := 0; i < nRef && ir.err == nil; i++ {
+		ref := bamRefIndex{bins: make(map[uint32]*bamIndexBin)}
+
+		nBin := ir.count("bin")
+		for j := 0; j < nBin && ir.err == nil; j++ {
+			binID := uint32(ir.int32())
+			chunks := readChunks(ir)
+			if binID == pseudoBin {
+				continue // Mapped/unmapped read counts, not alignment chunks
+			}
+			ref.bins[binID] = &bamIndexBin{chunks: chunks}
+		}
+
+		nIntv := ir.count("interval")
+		ref.linear = make([]uint64, 0, nIntv)
+		for j := 0; j < nIntv && ir.err == nil; j++ {
+			ref.linear = append(ref.linear, ir.uint64())
+		}
+
+		idx.references = append(idx.references, ref)
+	}
+
+	return ir.err
+}
+
+// readCSI parses the body of a CSI file (after the magic)
+func (idx *BAMIndex) readCSI(r io.Reader) error {
+	ir := &indexReader{r: r}
+	idx.MinShift = int(ir.int32())
+	idx.Depth = int(ir.int32())
+	if ir.err == nil && (idx.MinShift <= 0 || idx.Depth <= 0 || idx.MinShift+3*idx.Depth > 62) {
+		return fmt.Errorf("invalid CSI parameters min_shift=%d depth=%d", idx.MinShift, idx.Depth)
+	}
+	lAux := ir.count("aux byte")
+	if ir.err == nil {
+		_, ir.err = io.CopyN(io.Discard, r, int64(lAux))
+	}
+	pseudoBin := maxBinID(idx.Depth) + 1
+
+	nRef := ir.count("reference")
+	idx.references = make([]bamRefIndex, 0, nRef)
+	for i := 0; i < nRef && ir.err == nil; i++ {
+		ref := bamRefIndex{bins: make(map[uint32]*bamIndexBin)}
+
+		nBin := ir.count("bin")
+		for j := 0; j < nBin && ir.err == nil; j++ {
+			binID := uint32(ir.int32())
+			loffset := ir.uint64()
+			chunks := readChunks(ir)
+			if binID == pseudoBin {
+				continue
+			}
+			ref.bins[binID] = &bamIndexBin{loffset: loffset, chunks: chunks}
+		}
+
+		idx.references = append(idx.references, ref)
+	}
+
+	return ir.err
+}
+
+// readChunks reads an n_chunk-prefixed list of chunks
+func readChunks(ir *indexReader) []bgzf.Chunk {
+	nChunk := ir.count("chunk")
+	chunks := make([]bgzf.Chunk, 0, nChunk)
+	for k := 0; k < nChunk && ir.err == nil; k++ {
+		chunks = append(chunks, bgzf.Chunk{Begin: ir.uint64(), End: ir.uint64()})
+	}
+	return chunks
+}
+
+// maxBinID returns the largest real bin number for the given binning scheme
+func maxBinID(depth int) uint32 {
+	return uint32(((1 << ((depth + 1) * 3)) - 1) / 7)
+}
+
+// NumReferences returns the number of references covered by the index
+func (idx *BAMIndex) NumReferences() int {
+	return len(idx.references)
+}
+
+// Chunks returns the merged, sorted list of BGZF chunks that may hold
+// alignments on refID overlapping [beg, end)
+func (idx *BAMIndex) Chunks(refID int, beg, end int64) []bgzf.Chunk {
+	if refID < 0 || refID >= len(idx.references) {
+		return nil
+	}
+	if beg < 0 {
+		beg = 0
+	}
+	ref := idx.references[refID]
+
+	// Minimum virtual offset: reads starting before this cannot reach beg
+	var minOffset uint64
+	switch idx.Format {
+	case IndexFormatBAI:
+		window := int(beg >> baiMinShift)
+		if window < len(ref.linear) {
+			minOffset = ref.linear[window]
+		} else if len(ref.linear) > 0 {
+			minOffset = ref.linear[len(ref.linear)-1]
+		}
+	case IndexFormatCSI:
+		// Use the loffset of the deepest existing bin containing beg
+		bins := bgzf.RegionToBins(beg, beg+1, idx.MinShift, idx.Depth)
+		for i := len(bins) - 1; i >= 0; i-- {
+			if bin, ok := ref.bins[bins[i]]; ok {
+				minOffset = bin.loffset
+				break
+			}
+		}
+	}
+
+	var chunks []bgzf.Chunk
+	for _, binID := range bgzf.RegionToBins(beg, end, idx.MinShift, idx.Depth) {
+		bin, ok := ref.bins[binID]
+		if !ok {
+			continue
+		}
+		for _, chunk := range bin.chunks {
+			if chunk.End > minOffset {
+				chunks = append(chunks, chunk)
+			}
+		}
+	}
+
+	return bgzf.MergeChunks(chunks)
+}
+
+// regionReader yields only the alignments overlapping a region, seeking
+// through the BGZF chunks listed by the index instead of scanning the file
+type regionReader struct {
+	bam    *bamReader
+	refID  int
+	beg    int64
+	end    int64
+	chunks []bgzf.Chunk
+	next   int // Index of the next chunk to seek to
+	active bool
+}
+
+// Header returns the BAM header
+func (rr *regionReader) Header() *BAMHeader {
+	return rr.bam.Header()
+}
+
+// Format returns "BAM"
+func (rr *regionReader) Format() string {
+	return rr.bam.Format()
+}
+
+// Close closes the underlying BAM file
+func (rr *regionReader) Close() error {
+	return rr.bam.Close()
+}
+
+// Read returns the next alignment overlapping the region
+func (rr *regionReader) Read() (*BAMRecord, error) {
+	for {
+		if !rr.active || rr.bam.bgzf.VirtualOffset() >= rr.chunks[rr.next-1].End {
+			if rr.next >= len(rr.chunks) {
+				return nil, io.EOF
+			}
+			if err := rr.bam.bgzf.Seek(rr.chunks[rr.next].Begin); err != nil {
+				return nil, err
+			}
+			rr.next++
+			rr.active = true
+		}
+
+		record, err := rr.bam.Read()
+		if err == io.EOF {
+			rr.active = false
+			rr.next = len(rr.chunks)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Records are coordinate-sorted with unmapped reads (RefID -1) last:
+		// skip earlier references, stop once past the region
+		switch {
+		case record.RefID >= 0 && record.RefID < rr.refID:
+			continue
+		case record.RefID != rr.refID || record.Pos >= rr.end:
+			return nil, io.EOF
+		case record.End() <= rr.beg:
+			continue
+		}
+		return record, nil
+	}
+}
+
+// scanReader filters a full scan of an unindexed (or unsorted) file to the
+// alignments overlapping a region
+type scanReader struct {
+	Reader
+	chr      string
+	beg, end int64
+}
+
+// Read returns the next alignment overlapping the region
+func (sr *scanReader) Read() (*BAMRecord, error) {
+	for {
+		record, err := sr.Reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		if record.RefName == sr.chr && record.Pos < sr.end && record.End() > sr.beg {
+			return record, nil
+		}
+	}
+}
+
+// OpenRegion opens a BAM or SAM file restricted to the alignments
+// overlapping chr:[beg, end) (0-based, half-open). When a usable BAI/CSI
+// index is available the reader seeks straight to the overlapping bins;
+// without one, or when the index is unreadable, covers other references or
+// is older than the BAM, it falls back to scanning the whole file. The
+// returned flag reports whether the index was used.
+func OpenRegion(path, chr string, beg, end int64) (Reader, bool, error) {
+	reader, err := Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	scan := &scanReader{Reader: reader, chr: chr, beg: beg, end: end}
+
+	bam, ok := reader.(*bamReader)
+	if !ok {
+		return scan, false, nil // SAM has no index
+	}
+
+	indexPath := FindBAMIndex(path)
+	if indexPath == "" {
+		return scan, false, nil
+	}
+	idx, err := LoadBAMIndex(indexPath)
+	if err != nil {
+		log.Printf("Ignoring BAM index: %v", err)
+		return scan, false, nil
+	}
+	if problem := CheckIndex(path, idx, bam.Header()); problem != "" {
+		log.Printf("Ignoring BAM index %s: %s", indexPath, problem)
+		return scan, false, nil
+	}
+
+	refID := bam.Header().ReferenceID(chr)
+	if refID < 0 {
+		reader.Close()
+		return nil, false, fmt.Errorf("reference %q not found in BAM header", chr)
+	}
+
+	return &regionReader{
+		bam:    bam,
+		refID:  refID,
+		beg:    beg,
+		end:    end,
+		chunks: idx.Chunks(refID, beg, end),
+	}, true, nil
+}
+
+// CheckIndex reports why a loaded index cannot be used with the BAM at
+// bamPath (a different reference count, or an index older than the BAM),
+// or "" when it can
+func CheckIndex(bamPath string, idx *BAMIndex, header *BAMHeader) string {
+	if idx.NumReferences() != len(header.References) {
+		return fmt.Sprintf("index covers %d references but BAM declares %d", idx.NumReferences(), len(header.References))
+	}
+	bamInfo, bamErr := os.Stat(bamPath)
+	indexInfo, indexErr := os.Stat(idx.Path)
+	if bamErr == nil && indexErr == nil && indexInfo.ModTime().Before(bamInfo.ModTime()) {
+		return "index is older than BAM file"
+	}
+	return ""
+}
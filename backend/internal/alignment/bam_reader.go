@@ -0,0 +1,615 @@
+// Package alignment decodes SAM and BAM alignment files and answers region
+// queries through BAI/CSI indexes
+package alignment
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"genomevedic/internal/bgzf"
+)
+
+// SAM flag bits (SAM specification section 1.4)
+const (
+	FlagPaired        uint16 = 0x1
+	FlagProperPair    uint16 = 0x2
+	FlagUnmapped      uint16 = 0x4
+	FlagMateUnmapped  uint16 = 0x8
+	FlagReverse       uint16 = 0x10
+	FlagMateReverse   uint16 = 0x20
+	FlagRead1         uint16 = 0x40
+	FlagRead2         uint16 = 0x80
+	FlagSecondary     uint16 = 0x100
+	FlagQCFail        uint16 = 0x200
+	FlagDuplicate     uint16 = 0x400
+	FlagSupplementary uint16 = 0x800
+)
+
+// bamMagic is the magic string at the start of every decompressed BAM stream
+var bamMagic = []byte{'B', 'A', 'M', 1}
+
+// bamSeqAlphabet maps 4-bit encoded bases to IUPAC characters
+const bamSeqAlphabet = "=ACMGRSVTWYHKDBN"
+
+// cigarOpChars maps CIGAR op codes to their SAM characters
+const cigarOpChars = "MIDNSHP=X"
+
+// CigarOp is a single CIGAR operation (e.g. 50M)
+type CigarOp struct {
+	Op  byte // One of MIDNSHP=X
+	Len int
+}
+
+// ConsumesReference reports whether the operation advances along the reference
+func (c CigarOp) ConsumesReference() bool {
+	switch c.Op {
+	case 'M', 'D', 'N', '=', 'X':
+		return true
+	}
+	return false
+}
+
+// ConsumesQuery reports whether the operation advances along the read
+func (c CigarOp) ConsumesQuery() bool {
+	switch c.Op {
+	case 'M', 'I', 'S', '=', 'X':
+		return true
+	}
+	return false
+}
+
+// BAMReference is a reference sequence declared in the alignment header
+type BAMReference struct {
+	Name   string `json:"name"`
+	Length int64  `json:"length"`
+}
+
+// BAMHeader holds the SAM text header and reference dictionary
+type BAMHeader struct {
+	Text       string
+	References []BAMReference
+}
+
+// ReferenceID returns the index of a reference by name, or -1 if unknown
+func (h *BAMHeader) ReferenceID(name string) int {
+	for i, ref := range h.References {
+		if ref.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// BAMRecord is a decoded alignment record.
+// Pos is 0-based; unmapped reads have RefID -1 unless placed next to their mate.
+type BAMRecord struct {
+	Name      string
+	Flag      uint16
+	RefID     int
+	RefName   string
+	Pos       int64
+	MapQ      uint8
+	Cigar     []CigarOp
+	NextRefID int
+	NextPos   int64
+	TLen      int64
+	Seq       string
+	Qual      []byte // Raw Phred scores (no +33 offset), nil if absent
+}
+
+// IsUnmapped reports whether the read is unmapped
+func (r *BAMRecord) IsUnmapped() bool { return r.Flag&FlagUnmapped != 0 || r.RefID < 0 }
+
+// IsReverse reports whether the read is aligned to the reverse strand
+func (r *BAMRecord) IsReverse() bool { return r.Flag&FlagReverse != 0 }
+
+// IsDuplicate reports whether the read is marked as a PCR/optical duplicate
+func (r *BAMRecord) IsDuplicate() bool { return r.Flag&FlagDuplicate != 0 }
+
+// IsSecondary reports whether the record is a secondary or supplementary alignment
+func (r *BAMRecord) IsSecondary() bool {
+	return r.Flag&(FlagSecondary|FlagSupplementary) != 0
+}
+
+// ReferenceLength returns the number of reference bases covered by the alignment
+func (r *BAMRecord) ReferenceLength() int64 {
+	var length int64
+	for _, op := range r.Cigar {
+		if op.ConsumesReference() {
+			length += int64(op.Len)
+		}
+	}
+	return length
+}
+
+// End returns the 0-based exclusive end coordinate of the alignment
+func (r *BAMRecord) End() int64 {
+	refLen := r.ReferenceLength()
+	if refLen == 0 {
+		refLen = 1 // Unmapped or CIGAR-less reads occupy their start position
+	}
+	return r.Pos + refLen
+}
+
+// AverageQuality returns the mean base quality, or 0 if qualities are absent
+func (r *BAMRecord) AverageQuality() float64 {
+	if len(r.Qual) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, q := range r.Qual {
+		sum += int(q)
+	}
+	return float64(sum) / float64(len(r.Qual))
+}
+
+// CigarString renders the CIGAR in SAM text form
+func (r *BAMRecord) CigarString() string {
+	if len(r.Cigar) == 0 {
+		return "*"
+	}
+	var sb strings.Builder
+	for _, op := range r.Cigar {
+		sb.WriteString(strconv.Itoa(op.Len))
+		sb.WriteByte(op.Op)
+	}
+	return sb.String()
+}
+
+// Reader streams alignment records from a BAM or SAM file
+type Reader interface {
+	Header() *BAMHeader
+	Read() (*BAMRecord, error) // Returns io.EOF when exhausted
+	Format() string            // "BAM" or "SAM"
+	Close() error
+}
+
+// Open opens a BAM or SAM file, detecting the format from its magic bytes
+func Open(path string) (Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open alignment file: %w", err)
+	}
+
+	buffered := bufio.NewReaderSize(file, 256*1024)
+	magic, err := buffered.Peek(bgzf.HeaderSize)
+	if err != nil && err != io.EOF {
+		file.Close()
+		return nil, fmt.Errorf("failed to read alignment file header: %w", err)
+	}
+
+	if bgzf.IsBGZF(magic) {
+		reader, err := newBAMReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return reader, nil
+	}
+
+	if len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		file.Close()
+		return nil, fmt.Errorf("file is gzip-compressed but not BGZF; recompress with bgzip or samtools")
+	}
+
+	reader, err := newSAMReader(buffered, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// bamReader decodes binary BAM records from a BGZF stream
+type bamReader struct {
+	file   *os.File
+	bgzf   *bgzf.Reader
+	header *BAMHeader
+	buf    []byte
+}
+
+// newBAMReader reads the BAM header and returns a reader positioned at the first record
+func newBAMReader(file *os.File) (*bamReader, error) {
+	br := &bamReader{
+		file: file,
+		bgzf: bgzf.NewReader(file),
+		buf:  make([]byte, 0, 1024),
+	}
+
+	header, err := br.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	br.header = header
+	return br, nil
+}
+
+// readHeader parses the magic, SAM text header and binary reference dictionary
+func (br *bamReader) readHeader() (*BAMHeader, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(br.bgzf, magic); err != nil {
+		return nil, fmt.Errorf("failed to read BAM magic: %w", err)
+	}
+	if !bytes.Equal(magic, bamMagic) {
+		return nil, fmt.Errorf("not a BAM file: bad magic %q", magic)
+	}
+
+	textLen, err := br.readInt32()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read BAM header length: %w", err)
+	}
+	if textLen < 0 {
+		return nil, fmt.Errorf("invalid BAM header length: %d", textLen)
+	}
+	text := make([]byte, textLen)
+	if _, err := io.ReadFull(br.bgzf, text); err != nil {
+		return nil, fmt.Errorf("failed to read BAM header text: %w", err)
+	}
+
+	nRef, err := br.readInt32()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read BAM reference count: %w", err)
+	}
+	if nRef < 0 {
+		return nil, fmt.Errorf("invalid BAM reference count: %d", nRef)
+	}
+
+	header := &BAMHeader{
+		Text:       string(bytes.TrimRight(text, "\x00")),
+		References: make([]BAMReference, 0, nRef),
+	}
+	for i := int32(0); i < nRef; i++ {
+		nameLen, err := br.readInt32()
+		if err != nil || nameLen <= 0 {
+			return nil, fmt.Errorf("failed to read reference %d name length", i)
+		}
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(br.bgzf, name); err != nil {
+			return nil, fmt.Errorf("failed to read reference %d name: %w", i, err)
+		}
+		length, err := br.readInt32()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reference %d length: %w", i, err)
+		}
+		header.References = append(header.References, BAMReference{
+			Name:   string(bytes.TrimRight(name, "\x00")),
+			Length: int64(length),
+		})
+	}
+
+	return header, nil
+}
+
+// readInt32 reads a little-endian int32 from the decompressed stream
+func (br *bamReader) readInt32() (int32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(br.bgzf, b[:]); err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(b[:])), nil
+}
+
+// Header returns the BAM header
+func (br *bamReader) Header() *BAMHeader {
+	return br.header
+}
+
+// Format returns "BAM"
+func (br *bamReader) Format() string {
+	return "BAM"
+}
+
+// Close closes the underlying file
+func (br *bamReader) Close() error {
+	return br.file.Close()
+}
+
+// Read decodes the next alignment record
+func (br *bamReader) Read() (*BAMRecord, error) {
+	blockSize, err := br.readInt32()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read BAM record size: %w", err)
+	}
+	if blockSize < 32 {
+		return nil, fmt.Errorf("invalid BAM record size: %d", blockSize)
+	}
+
+	if cap(br.buf) < int(blockSize) {
+		br.buf = make([]byte, blockSize)
+	}
+	data := br.buf[:blockSize]
+	if _, err := io.ReadFull(br.bgzf, data); err != nil {
+		return nil, fmt.Errorf("truncated BAM record: %w", err)
+	}
+
+	return decodeBAMRecord(data, br.header)
+}
+
+// decodeBAMRecord decodes the fixed and variable-length fields of a BAM record
+// (the bytes following block_size)
+func decodeBAMRecord(data []byte, header *BAMHeader) (*BAMRecord, error) {
+	le := binary.LittleEndian
+
+	refID := int32(le.Uint32(data[0:4]))
+	pos := int32(le.Uint32(data[4:8]))
+	nameLen := int(data[8])
+	mapQ := data[9]
+	nCigar := int(le.Uint16(data[12:14]))
+	flag := le.Uint16(data[14:16])
+	seqLen := int(le.Uint32(data[16:20]))
+	nextRefID := int32(le.Uint32(data[20:24]))
+	nextPos := int32(le.Uint32(data[24:28]))
+	tlen := int32(le.Uint32(data[28:32]))
+
+	offset := 32
+	need := offset + nameLen + nCigar*4 + (seqLen+1)/2 + seqLen
+	if seqLen < 0 || need > len(data) {
+		return nil, fmt.Errorf("BAM record fields exceed record size (%d > %d)", need, len(data))
+	}
+
+	rec := &BAMRecord{
+		Name:      string(bytes.TrimRight(data[offset:offset+nameLen], "\x00")),
+		Flag:      flag,
+		RefID:     int(refID),
+		Pos:       int64(pos),
+		MapQ:      mapQ,
+		NextRefID: int(nextRefID),
+		NextPos:   int64(nextPos),
+		TLen:      int64(tlen),
+	}
+	offset += nameLen
+
+	if refID >= 0 && int(refID) < len(header.References) {
+		rec.RefName = header.References[refID].Name
+	}
+
+	if nCigar > 0 {
+		rec.Cigar = make([]CigarOp, nCigar)
+		for i := 0; i < nCigar; i++ {
+			packed := le.Uint32(data[offset : offset+4])
+			opCode := packed & 0xf
+			if int(opCode) >= len(cigarOpChars) {
+				return nil, fmt.Errorf("invalid CIGAR op code %d in read %s", opCode, rec.Name)
+			}
+			rec.Cigar[i] = CigarOp{Op: cigarOpChars[opCode], Len: int(packed >> 4)}
+			offset += 4
+		}
+	}
+
+	seq := make([]byte, seqLen)
+	for i := 0; i < seqLen; i++ {
+		packed := data[offset+i/2]
+		if i%2 == 0 {
+			seq[i] = bamSeqAlphabet[packed>>4]
+		} else {
+			seq[i] = bamSeqAlphabet[packed&0xf]
+		}
+	}
+	rec.Seq = string(seq)
+	offset += (seqLen + 1) / 2
+
+	// Missing qualities are stored as 0xff
+	if seqLen > 0 && data[offset] != 0xff {
+		rec.Qual = make([]byte, seqLen)
+		copy(rec.Qual, data[offset:offset+seqLen])
+	}
+
+	// Auxiliary tags (data[offset+seqLen:]) are not needed for particle conversion
+
+	return rec, nil
+}
+
+// samReader parses plain-text SAM records
+type samReader struct {
+	closer  io.Closer
+	scanner *bufio.Scanner
+	header  *BAMHeader
+	pending string // First alignment line read while consuming the header
+	lineNum int
+}
+
+// newSAMReader consumes the @-prefixed header lines and returns a reader
+// positioned at the first alignment
+func newSAMReader(r io.Reader, closer io.Closer) (*samReader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024) // Long reads can exceed the default limit
+
+	sr := &samReader{
+		closer:  closer,
+		scanner: scanner,
+		header:  &BAMHeader{},
+	}
+
+	var text strings.Builder
+	for scanner.Scan() {
+		sr.lineNum++
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "@") {
+			sr.pending = line
+			break
+		}
+		text.WriteString(line)
+		text.WriteByte('\n')
+
+		if strings.HasPrefix(line, "@SQ") {
+			ref := BAMReference{}
+			for _, field := range strings.Split(line, "\t")[1:] {
+				switch {
+				case strings.HasPrefix(field, "SN:"):
+					ref.Name = field[3:]
+				case strings.HasPrefix(field, "LN:"):
+					ref.Length, _ = strconv.ParseInt(field[3:], 10, 64)
+				}
+			}
+			if ref.Name == "" {
+				return nil, fmt.Errorf("@SQ line %d missing SN field", sr.lineNum)
+			}
+			sr.header.References = append(sr.header.References, ref)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading SAM header: %w", err)
+	}
+
+	sr.header.Text = text.String()
+	return sr, nil
+}
+
+// Header returns the SAM header
+func (sr *samReader) Header() *BAMHeader {
+	return sr.header
+}
+
+// Format returns "SAM"
+func (sr *samReader) Format() string {
+	return "SAM"
+}
+
+// Close closes the underlying file
+func (sr *samReader) Close() error {
+	if sr.closer != nil {
+		return sr.closer.Close()
+	}
+	return nil
+}
+
+// Read parses the next SAM alignment line
+func (sr *samReader) Read() (*BAMRecord, error) {
+	for {
+		var line string
+		if sr.pending != "" {
+			line = sr.pending
+			sr.pending = ""
+		} else {
+			if !sr.scanner.Scan() {
+				if err := sr.scanner.Err(); err != nil {
+					return nil, fmt.Errorf("error reading SAM: %w", err)
+				}
+				return nil, io.EOF
+			}
+			sr.lineNum++
+			line = sr.scanner.Text()
+		}
+
+		if line == "" {
+			continue
+		}
+		return parseSAMLine(line, sr.header, sr.lineNum)
+	}
+}
+
+// parseSAMLine parses the 11 mandatory SAM columns
+func parseSAMLine(line string, header *BAMHeader, lineNum int) (*BAMRecord, error) {
+	fields := strings.SplitN(line, "\t", 12)
+	if len(fields) < 11 {
+		return nil, fmt.Errorf("SAM line %d: expected at least 11 columns, got %d", lineNum, len(fields))
+	}
+
+	flag, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("SAM line %d: invalid FLAG %q", lineNum, fields[1])
+	}
+	pos, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("SAM line %d: invalid POS %q", lineNum, fields[3])
+	}
+	mapQ, err := strconv.ParseUint(fields[4], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("SAM line %d: invalid MAPQ %q", lineNum, fields[4])
+	}
+	cigar, err := parseCigar(fields[5])
+	if err != nil {
+		return nil, fmt.Errorf("SAM line %d: %w", lineNum, err)
+	}
+	nextPos, err := strconv.ParseInt(fields[7], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("SAM line %d: invalid PNEXT %q", lineNum, fields[7])
+	}
+	tlen, err := strconv.ParseInt(fields[8], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("SAM line %d: invalid TLEN %q", lineNum, fields[8])
+	}
+
+	rec := &BAMRecord{
+		Name:      fields[0],
+		Flag:      uint16(flag),
+		RefID:     -1,
+		Pos:       pos - 1, // SAM is 1-based
+		MapQ:      uint8(mapQ),
+		Cigar:     cigar,
+		NextRefID: -1,
+		NextPos:   nextPos - 1,
+		TLen:      tlen,
+	}
+
+	if fields[2] != "*" {
+		rec.RefName = fields[2]
+		rec.RefID = header.ReferenceID(fields[2])
+		if rec.RefID < 0 {
+			// Tolerate SAM files without @SQ lines by registering references on the fly
+			header.References = append(header.References, BAMReference{Name: fields[2]})
+			rec.RefID = len(header.References) - 1
+		}
+	}
+	switch fields[6] {
+	case "*":
+	case "=":
+		rec.NextRefID = rec.RefID
+	default:
+		rec.NextRefID = header.ReferenceID(fields[6])
+	}
+
+	if fields[9] != "*" {
+		rec.Seq = fields[9]
+	}
+	if fields[10] != "*" {
+		if len(fields[10]) != len(rec.Seq) {
+			return nil, fmt.Errorf("SAM line %d: quality length mismatch: seq=%d, qual=%d",
+				lineNum, len(rec.Seq), len(fields[10]))
+		}
+		rec.Qual = make([]byte, len(fields[10]))
+		for i := 0; i < len(fields[10]); i++ {
+			rec.Qual[i] = fields[10][i] - 33
+		}
+	}
+
+	return rec, nil
+}
+
+// parseCigar parses a SAM CIGAR string such as "10S90M2I48M"
+func parseCigar(s string) ([]CigarOp, error) {
+	if s == "*" {
+		return nil, nil
+	}
+
+	ops := make([]CigarOp, 0, 4)
+	n := 0
+	hasDigits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			n = n*10 + int(c-'0')
+			hasDigits = true
+			continue
+		}
+		if !hasDigits || strings.IndexByte(cigarOpChars, c) < 0 {
+			return nil, fmt.Errorf("invalid CIGAR %q", s)
+		}
+		ops = append(ops, CigarOp{Op: c, Len: n})
+		n = 0
+		hasDigits = false
+	}
+	if hasDigits {
+		return nil, fmt.Errorf("invalid CIGAR %q: trailing length without op", s)
+	}
+	return ops, nil
+}
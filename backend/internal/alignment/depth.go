@@ -0,0 +1,50 @@
+package alignment
+
+import (
+	"fmt"
+	"io"
+
+	"genomevedic/internal/copynumber"
+)
+
+// BinDepth adds the aligned bases of every primary, non-duplicate,
+// QC-passing read with mapping quality >= minMapQ to a copy-number binner.
+// Reference lengths are taken from the alignment header.
+func BinDepth(path string, binner *copynumber.Binner, minMapQ uint8) error {
+	reader, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, ref := range reader.Header().References {
+		binner.SetLength(ref.Name, uint64(ref.Length))
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read alignment: %w", err)
+		}
+		if record.IsUnmapped() || record.IsSecondary() || record.IsDuplicate() ||
+			record.Flag&FlagQCFail != 0 || record.MapQ < minMapQ {
+			continue
+		}
+
+		// Count only bases aligned to the reference (M, =, X)
+		position := uint64(record.Pos)
+		for _, op := range record.Cigar {
+			if !op.ConsumesReference() {
+				continue
+			}
+			end := position + uint64(op.Len)
+			if op.ConsumesQuery() {
+				binner.AddRead(record.RefName, position, end)
+			}
+			position = end
+		}
+	}
+}
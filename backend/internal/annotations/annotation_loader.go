@@ -0,0 +1,138 @@
+/**
+ * Annotation File Loader
+ *
+ * Reads GTF, GFF3 or BED annotations (optionally gzip-compressed) into a
+ * GTFParser, so GeneOverlay and other consumers see the same feature graph
+ * regardless of the input format.
+ */
+
+package annotations
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AnnotationFormat identifies an annotation file format
+type AnnotationFormat int
+
+const (
+	FormatUnknown AnnotationFormat = iota
+	FormatGTF
+	FormatGFF3
+	FormatBED
+)
+
+func (af AnnotationFormat) String() string {
+	switch af {
+	case FormatGTF:
+		return "GTF"
+	case FormatGFF3:
+		return "GFF3"
+	case FormatBED:
+		return "BED"
+	default:
+		return "Unknown"
+	}
+}
+
+// FormatFromPath guesses the format from the file extension
+// (.gtf, .gff, .gff3, .bed, with an optional .gz suffix)
+func FormatFromPath(path string) AnnotationFormat {
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(strings.ToLower(path), ".gz")))
+	switch ext {
+	case ".gtf":
+		return FormatGTF
+	case ".gff", ".gff3":
+		return FormatGFF3
+	case ".bed", ".bed12":
+		return FormatBED
+	default:
+		return FormatUnknown
+	}
+}
+
+// DetectFormat guesses the format from the first lines of a file
+func DetectFormat(header []byte) AnnotationFormat {
+	for _, line := range strings.Split(string(header), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "##gff-version 3"):
+			return FormatGFF3
+		case line == "", strings.HasPrefix(line, "#"),
+			strings.HasPrefix(line, "track"), strings.HasPrefix(line, "browser"):
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		switch {
+		case len(fields) == 9 && strings.Contains(fields[8], "gene_id \""):
+			return FormatGTF
+		case len(fields) == 9 && strings.Contains(fields[8], "="):
+			return FormatGFF3
+		case len(fields) >= 3 && len(fields) != 9:
+			return FormatBED
+		}
+		return FormatUnknown
+	}
+	return FormatUnknown
+}
+
+// Parse parses annotations in the given format
+func (gp *GTFParser) Parse(reader io.Reader, format AnnotationFormat) error {
+	switch format {
+	case FormatGTF:
+		return gp.ParseFile(reader)
+	case FormatGFF3:
+		return gp.ParseGFF3(reader)
+	case FormatBED:
+		return gp.ParseBED(reader)
+	default:
+		return fmt.Errorf("unsupported annotation format")
+	}
+}
+
+// LoadAnnotationFile parses a GTF, GFF3 or BED file (optionally gzipped).
+// The format comes from the extension, or from the file contents when the
+// extension is not recognised.
+func LoadAnnotationFile(path string, promoterRegion int) (*GTFParser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open annotation file: %w", err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	var reader io.Reader = buffered
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		// Handles plain gzip and bgzip (multi-member) files
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	format := FormatFromPath(path)
+	if format == FormatUnknown {
+		sniffer := bufio.NewReaderSize(reader, 64*1024)
+		header, _ := sniffer.Peek(64 * 1024)
+		format = DetectFormat(header)
+		reader = sniffer
+	}
+	if format == FormatUnknown {
+		return nil, fmt.Errorf("cannot determine annotation format of %s", path)
+	}
+
+	parser := NewGTFParser(promoterRegion)
+	if err := parser.Parse(reader, format); err != nil {
+		return nil, fmt.Errorf("failed to parse %s annotations: %w", format, err)
+	}
+	return parser, nil
+}
@@ -0,0 +1,92 @@
+package annotations
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// describeFeatures lists the features of one type, sorted, as
+// "start-end strand geneID geneName transcriptID". Introns are inferred in
+// map order.
+func describeFeatures(gp *GTFParser, featureType FeatureType) []string {
+	var described []string
+	for _, f := range gp.GetFeatures() {
+		if f.Type == featureType {
+			described = append(described, fmt.Sprintf("%d-%d %s %s %s %s",
+				f.Start, f.End, f.Strand, f.GeneID, f.GeneName, f.TranscriptID))
+		}
+	}
+	sort.Strings(described)
+	return described
+}
+
+// TestDetectFormat recognises formats from file contents and extensions
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   AnnotationFormat
+	}{
+		{"GFF3 directive", testGFF3, FormatGFF3},
+		{"GFF3 attributes", "# comment\nchr1\tsrc\tgene\t1\t10\t.\t+\t.\tID=g1\n", FormatGFF3},
+		{"GTF", "#!genome-build GRCh38\n1\thavana\tgene\t11869\t14409\t.\t+\t.\tgene_id \"ENSG00000223972\";\n", FormatGTF},
+		{"BED12", testBED, FormatBED},
+		{"BED3", "\nchr1\t0\t100\n", FormatBED},
+		{"FASTA", ">chr1\nACGT\n", FormatUnknown},
+		{"comments only", "# nothing\n\n", FormatUnknown},
+		{"empty", "", FormatUnknown},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat([]byte(tt.header)); got != tt.want {
+			t.Errorf("%s: detected %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	for path, want := range map[string]AnnotationFormat{
+		"gencode.v44.annotation.gtf.gz": FormatGTF,
+		"Homo_sapiens.GRCh38.GFF3":      FormatGFF3,
+		"refseq.gff":                    FormatGFF3,
+		"genes.bed12":                   FormatBED,
+		"genes.txt.gz":                  FormatUnknown,
+	} {
+		if got := FormatFromPath(path); got != want {
+			t.Errorf("%s: format %s, want %s", path, got, want)
+		}
+	}
+}
+
+// TestLoadAnnotationFile sniffs the format of gzipped files without a
+// recognised extension
+func TestLoadAnnotationFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "annotations.dat.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	gz.Write([]byte(testGFF3))
+	gz.Close()
+	file.Close()
+
+	gp, err := LoadAnnotationFile(path, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gp.GetGeneByName("TP53")) != 1 || len(describeFeatures(gp, FeatureExon)) != 5 {
+		t.Errorf("Unexpected annotations %v", gp.GetStatistics())
+	}
+
+	unknown := filepath.Join(dir, "genome.dat")
+	os.WriteFile(unknown, []byte(">chr1\nACGT\n"), 0644)
+	if _, err := LoadAnnotationFile(unknown, 0); err == nil {
+		t.Error("Expected error for an unrecognised file")
+	}
+	if _, err := LoadAnnotationFile(filepath.Join(dir, "missing.gtf"), 0); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+}
@@ -0,0 +1,221 @@
+/**
+ * BED Parser for Gene Annotations
+ *
+ * Parses BED12 gene models (UCSC, GENCODE, bedtools output) into the same
+ * feature graph as GTF: genes -> transcripts -> exons/CDS/UTRs
+ *
+ * BED12 Format (0-based, half-open):
+ * 1. chrom       4. name     7. thickStart  10. blockCount
+ * 2. chromStart  5. score    8. thickEnd    11. blockSizes
+ * 3. chromEnd    6. strand   9. itemRgb     12. blockStarts
+ *
+ * Each line is one transcript. thickStart/thickEnd mark the coding region,
+ * splitting exons into CDS and UTRs. Transcripts sharing a name on the same
+ * chromosome and strand are grouped into one gene. Lines with fewer than 12
+ * columns become single-exon transcripts.
+ */
+
+package annotations
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// bedGene accumulates the span of transcripts sharing a name
+type bedGene struct {
+	chromosome string
+	name       string
+	strand     string
+	start      uint64
+	end        uint64
+}
+
+// ParseBED parses a BED (BED3 to BED12) file
+func (gp *GTFParser) ParseBED(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+
+	genes := make([]*bedGene, 0, 10000)
+	geneByKey := make(map[string]*bedGene)
+	nameCounts := make(map[string]int)
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines, comments and UCSC track/browser lines
+		if line == "" || strings.HasPrefix(line, "#") ||
+			strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		transcript, features, err := parseBEDLine(fields)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		// Repeated names (e.g. UCSC refGene) need distinct transcript IDs
+		name := transcript.GeneName
+		nameCounts[name]++
+		transcriptID := name
+		if nameCounts[name] > 1 {
+			transcriptID = fmt.Sprintf("%s_%d", name, nameCounts[name])
+		}
+
+		key := transcript.Chromosome + "\t" + transcript.Strand + "\t" + name
+		gene, exists := geneByKey[key]
+		if !exists {
+			gene = &bedGene{
+				chromosome: transcript.Chromosome,
+				name:       name,
+				strand:     transcript.Strand,
+				start:      transcript.Start,
+				end:        transcript.End,
+			}
+			geneByKey[key] = gene
+			genes = append(genes, gene)
+		}
+		gene.start = min(gene.start, transcript.Start)
+		gene.end = max(gene.end, transcript.End)
+
+		for _, feature := range append([]*GenomicFeature{transcript}, features...) {
+			feature.TranscriptID = transcriptID
+			gp.addFeature(feature)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scanner error: %w", err)
+	}
+
+	for _, gene := range genes {
+		feature := NewGenomicFeature(FeatureGene, gene.chromosome, gene.start, gene.end, gene.strand)
+		feature.GeneID = gene.name
+		feature.GeneName = gene.name
+		gp.addFeature(feature)
+	}
+
+	// Post-processing: infer introns and promoters
+	gp.inferIntrons()
+	gp.inferPromoters()
+
+	return nil
+}
+
+// parseBEDLine parses one BED line into a transcript and its exon, CDS and
+// UTR features (coordinates converted to 0-based inclusive)
+func parseBEDLine(fields []string) (*GenomicFeature, []*GenomicFeature, error) {
+	if len(fields) < 3 {
+		return nil, nil, fmt.Errorf("expected at least 3 fields, got %d", len(fields))
+	}
+
+	chromStart, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid chromStart: %w", err)
+	}
+	chromEnd, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil || chromEnd <= chromStart {
+		return nil, nil, fmt.Errorf("invalid chromEnd %q", fields[2])
+	}
+
+	name := fmt.Sprintf("%s:%d-%d", fields[0], chromStart+1, chromEnd)
+	if len(fields) > 3 && fields[3] != "" && fields[3] != "." {
+		name = fields[3]
+	}
+	strand := "+"
+	if len(fields) > 5 && (fields[5] == "-" || fields[5] == "+") {
+		strand = fields[5]
+	}
+
+	transcript := NewGenomicFeature(FeatureTranscript, fields[0], chromStart, chromEnd-1, strand)
+	transcript.GeneID = name
+	transcript.GeneName = name
+	if len(fields) > 4 {
+		transcript.Attributes["score"] = fields[4]
+	}
+
+	// Exon blocks as half-open [start, end)
+	blocks := [][2]uint64{{chromStart, chromEnd}}
+	if len(fields) >= 12 {
+		if blocks, err = parseBEDBlocks(chromStart, chromEnd, fields[9], fields[10], fields[11]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Coding region; thickStart == thickEnd means non-coding
+	thickStart, thickEnd := chromEnd, chromEnd
+	if len(fields) >= 8 {
+		ts, errStart := strconv.ParseUint(fields[6], 10, 64)
+		te, errEnd := strconv.ParseUint(fields[7], 10, 64)
+		if errStart != nil || errEnd != nil || ts > te || ts < chromStart || te > chromEnd {
+			return nil, nil, fmt.Errorf("invalid thickStart/thickEnd %s-%s", fields[6], fields[7])
+		}
+		thickStart, thickEnd = ts, te
+	}
+
+	newFeature := func(featureType FeatureType, start, end uint64) *GenomicFeature {
+		feature := NewGenomicFeature(featureType, transcript.Chromosome, start, end-1, strand)
+		feature.GeneID = name
+		feature.GeneName = name
+		return feature
+	}
+
+	upstream, downstream := FeatureUTR5, FeatureUTR3
+	if strand == "-" {
+		upstream, downstream = FeatureUTR3, FeatureUTR5
+	}
+
+	features := make([]*GenomicFeature, 0, len(blocks)*2)
+	for _, block := range blocks {
+		features = append(features, newFeature(FeatureExon, block[0], block[1]))
+		if thickStart >= thickEnd {
+			continue
+		}
+
+		if block[0] < thickStart {
+			features = append(features, newFeature(upstream, block[0], min(block[1], thickStart)))
+		}
+		if cdsStart, cdsEnd := max(block[0], thickStart), min(block[1], thickEnd); cdsStart < cdsEnd {
+			features = append(features, newFeature(FeatureCDS, cdsStart, cdsEnd))
+		}
+		if block[1] > thickEnd {
+			features = append(features, newFeature(downstream, max(block[0], thickEnd), block[1]))
+		}
+	}
+
+	return transcript, features, nil
+}
+
+// parseBEDBlocks parses blockCount/blockSizes/blockStarts into absolute
+// half-open exon intervals
+func parseBEDBlocks(chromStart, chromEnd uint64, countStr, sizesStr, startsStr string) ([][2]uint64, error) {
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid blockCount %q", countStr)
+	}
+
+	sizes := strings.Split(strings.TrimSuffix(sizesStr, ","), ",")
+	starts := strings.Split(strings.TrimSuffix(startsStr, ","), ",")
+	if len(sizes) != count || len(starts) != count {
+		return nil, fmt.Errorf("blockCount %d does not match %d sizes and %d starts", count, len(sizes), len(starts))
+	}
+
+	blocks := make([][2]uint64, count)
+	for i := range blocks {
+		size, errSize := strconv.ParseUint(sizes[i], 10, 64)
+		offset, errStart := strconv.ParseUint(starts[i], 10, 64)
+		if errSize != nil || errStart != nil || size == 0 {
+			return nil, fmt.Errorf("invalid block %d (%s at %s)", i+1, sizes[i], starts[i])
+		}
+		blocks[i] = [2]uint64{chromStart + offset, chromStart + offset + size}
+		if blocks[i][1] > chromEnd || (i > 0 && blocks[i][0] < blocks[i-1][1]) {
+			return nil, fmt.Errorf("block %d outside chromStart-chromEnd or overlapping the previous block", i+1)
+		}
+	}
+	return blocks, nil
+}
@@ -0,0 +1,76 @@
+package annotations
+
+import (
+	"strings"
+	"testing"
+)
+
+// testBED holds a coding and a non-coding transcript of one plus-strand
+// gene, a three-exon minus-strand gene and a BED3 interval
+const testBED = "browser position chr1:1-3000\n" +
+	"track name=genes\n" +
+	"chr1\t1000\t2000\tGENE1\t0\t+\t1100\t1900\t0\t2\t300,400,\t0,600,\n" +
+	"chr1\t1000\t1500\tGENE1\t0\t+\t1000\t1000\t0\t1\t500,\t0,\n" +
+	"chr2\t5000\t6000\tGENE2\t0\t-\t5200\t5800\t0\t3\t100,200,300,\t0,300,700,\n" +
+	"chr3\t10\t20\n"
+
+// TestParseBED splits BED12 blocks into exons, CDS and strand-aware UTRs
+func TestParseBED(t *testing.T) {
+	gp := NewGTFParser(100)
+	if err := gp.ParseBED(strings.NewReader(testBED)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		featureType FeatureType
+		want        []string
+	}{
+		{FeatureGene, []string{"10-19 + chr3:11-20 chr3:11-20 ", "1000-1999 + GENE1 GENE1 ", "5000-5999 - GENE2 GENE2 "}},
+		{FeatureTranscript, []string{
+			"10-19 + chr3:11-20 chr3:11-20 chr3:11-20",
+			"1000-1499 + GENE1 GENE1 GENE1_2",
+			"1000-1999 + GENE1 GENE1 GENE1",
+			"5000-5999 - GENE2 GENE2 GENE2",
+		}},
+		{FeatureExon, []string{
+			"10-19 + chr3:11-20 chr3:11-20 chr3:11-20",
+			"1000-1299 + GENE1 GENE1 GENE1",
+			"1000-1499 + GENE1 GENE1 GENE1_2",
+			"1600-1999 + GENE1 GENE1 GENE1",
+			"5000-5099 - GENE2 GENE2 GENE2",
+			"5300-5499 - GENE2 GENE2 GENE2",
+			"5700-5999 - GENE2 GENE2 GENE2",
+		}},
+		{FeatureCDS, []string{
+			"1100-1299 + GENE1 GENE1 GENE1",
+			"1600-1899 + GENE1 GENE1 GENE1",
+			"5300-5499 - GENE2 GENE2 GENE2",
+			"5700-5799 - GENE2 GENE2 GENE2",
+		}},
+		{FeatureUTR5, []string{"1000-1099 + GENE1 GENE1 GENE1", "5800-5999 - GENE2 GENE2 GENE2"}},
+		{FeatureUTR3, []string{"1900-1999 + GENE1 GENE1 GENE1", "5000-5099 - GENE2 GENE2 GENE2"}},
+		{FeatureIntron, []string{
+			"1300-1599 + GENE1 GENE1 GENE1",
+			"5100-5299 - GENE2 GENE2 GENE2",
+			"5500-5699 - GENE2 GENE2 GENE2",
+		}},
+	}
+	for _, tt := range tests {
+		if got := describeFeatures(gp, tt.featureType); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s features:\n%s\nwant:\n%s", tt.featureType, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+
+	for _, bad := range []string{
+		"chr1\t100",
+		"chr1\t200\t100",
+		"chr1\t0\t100\tX\t0\t+\t0\t100\t0\t2\t50,\t0,",       // Block count mismatch
+		"chr1\t0\t100\tX\t0\t+\t0\t100\t0\t2\t50,50,\t0,40,", // Overlapping blocks
+		"chr1\t0\t100\tX\t0\t+\t0\t100\t0\t1\t150,\t0,",      // Block past chromEnd
+		"chr1\t0\t100\tX\t0\t+\t50\t150\t0\t1\t100,\t0,",     // thickEnd past chromEnd
+	} {
+		if err := NewGTFParser(0).ParseBED(strings.NewReader("track name=bad\n" + bad + "\n")); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+			t.Errorf("Expected a line 2 error for %q, got %v", bad, err)
+		}
+	}
+}
@@ -49,6 +49,9 @@ func NewGeneOverlay(parser *GTFParser) *GeneOverlay {
 	}
 }
 
+// particleStep is the particle spacing (bp) used when building the overlay
+const particleStep = uint64(10)
+
 // BuildOverlay builds the gene overlay for all particles
 func (go_ *GeneOverlay) BuildOverlay() error {
 	go_.mu.Lock()
@@ -57,56 +60,73 @@ func (go_ *GeneOverlay) BuildOverlay() error {
 	// Clear existing overlay
 	go_.particleAnnotations = make(map[string]*ParticleAnnotation)
 
-	// For each feature, annotate all positions within it
+	// Sample every 10 bp within each feature (for performance). Particles sit
+	// on a shared grid so overlapping features annotate the same particles;
+	// features shorter than the spacing get a particle at their start.
 	for _, feature := range go_.parser.GetFeatures() {
-		// Sample every 10 bp within the feature (for performance)
-		step := uint64(10)
-		for pos := feature.Start; pos <= feature.End; pos += step {
-			key := fmt.Sprintf("%s:%d", feature.Chromosome, pos)
-
-			pa, exists := go_.particleAnnotations[key]
-			if !exists {
-				pa = &ParticleAnnotation{
-					Position:   pos,
-					Chromosome: feature.Chromosome,
-					Features:   make([]*GenomicFeature, 0, 4),
-					GeneNames:  make([]string, 0, 2),
-				}
-				go_.particleAnnotations[key] = pa
-			}
+		first := (feature.Start + particleStep - 1) / particleStep * particleStep
+		if first > feature.End {
+			first = feature.Start
+		}
 
-			pa.Features = append(pa.Features, feature)
-
-			// Track feature types
-			switch feature.Type {
-			case FeatureGene:
-				pa.InGene = true
-				if feature.GeneName != "" && !contains(pa.GeneNames, feature.GeneName) {
-					pa.GeneNames = append(pa.GeneNames, feature.GeneName)
-				}
-			case FeatureExon:
-				pa.InExon = true
-			case FeatureCDS:
-				pa.InCDS = true
+		for pos := first; pos <= feature.End; pos += particleStep {
+			key := fmt.Sprintf("%s:%d", feature.Chromosome, pos)
+			if _, exists := go_.particleAnnotations[key]; exists {
+				continue
 			}
+			go_.particleAnnotations[key] = go_.annotate(feature.Chromosome, pos)
 		}
 	}
 
-	// Compute primary features and colors
-	for _, pa := range go_.particleAnnotations {
-		go_.computePrimaryFeature(pa)
+	return nil
+}
+
+// annotate collects every feature overlapping a position from the parser's
+// interval index
+func (go_ *GeneOverlay) annotate(chromosome string, position uint64) *ParticleAnnotation {
+	features := go_.parser.GetFeaturesAtPosition(chromosome, position)
+	if len(features) == 0 {
+		return nil
 	}
 
-	return nil
+	pa := &ParticleAnnotation{
+		Position:   position,
+		Chromosome: chromosome,
+		Features:   features,
+		GeneNames:  make([]string, 0, 2),
+	}
+
+	for _, feature := range features {
+		// Track feature types
+		switch feature.Type {
+		case FeatureGene:
+			pa.InGene = true
+			if feature.GeneName != "" && !contains(pa.GeneNames, feature.GeneName) {
+				pa.GeneNames = append(pa.GeneNames, feature.GeneName)
+			}
+		case FeatureExon:
+			pa.InExon = true
+		case FeatureCDS:
+			pa.InCDS = true
+		}
+	}
+
+	// Compute primary feature and color
+	go_.computePrimaryFeature(pa)
+	return pa
 }
 
-// GetParticleAnnotation returns annotation for a particle
+// GetParticleAnnotation returns annotation for a particle. Positions between
+// overlay particles are resolved directly from the interval index.
 func (go_ *GeneOverlay) GetParticleAnnotation(chromosome string, position uint64) *ParticleAnnotation {
 	go_.mu.RLock()
 	defer go_.mu.RUnlock()
 
 	key := fmt.Sprintf("%s:%d", chromosome, position)
-	return go_.particleAnnotations[key]
+	if pa, exists := go_.particleAnnotations[key]; exists {
+		return pa
+	}
+	return go_.annotate(chromosome, position)
 }
 
 // GetParticleColor returns the color for a particle based on annotations
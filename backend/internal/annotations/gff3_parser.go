@@ -0,0 +1,252 @@
+/**
+ * GFF3 Parser for Gene Annotations
+ *
+ * Parses General Feature Format version 3 (Ensembl, RefSeq, GENCODE)
+ * into the same feature graph as GTF: genes -> transcripts -> exons/CDS/UTRs
+ *
+ * GFF3 links features through ID/Parent attributes instead of repeating
+ * gene_id/transcript_id on every line, so the whole file is read before
+ * gene and transcript IDs are resolved up the Parent chain.
+ *
+ * Column 9 example:
+ *   ID=transcript:ENST00000269305;Parent=gene:ENSG00000141510;Name=TP53-201
+ */
+
+package annotations
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// gff3Record is one GFF3 line before hierarchy resolution
+type gff3Record struct {
+	chromosome  string
+	featureType FeatureType
+	start       uint64 // 0-based
+	end         uint64 // 0-based, inclusive
+	strand      string
+	id          string
+	parents     []string
+	attributes  map[string]string
+}
+
+// maxGFF3Depth bounds Parent chains (guards against cycles)
+const maxGFF3Depth = 16
+
+// ParseGFF3 parses a GFF3 file
+func (gp *GTFParser) ParseGFF3(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	lineNum := 0
+
+	records := make([]*gff3Record, 0, 100000)
+	byID := make(map[string]*gff3Record)
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Embedded sequences end the annotation section
+		if line == "##FASTA" {
+			break
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		record, err := parseGFF3Line(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		// Discontinuous features (e.g. CDS) repeat an ID on several lines
+		if record.id != "" && byID[record.id] == nil {
+			byID[record.id] = record
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scanner error: %w", err)
+	}
+
+	for _, record := range records {
+		if record.featureType == FeatureUnknown {
+			continue
+		}
+
+		switch record.featureType {
+		case FeatureGene:
+			feature := record.feature()
+			feature.GeneID, feature.GeneName = gff3GeneIdentity(record)
+			gp.addFeature(feature)
+
+		case FeatureTranscript:
+			feature := record.feature()
+			feature.TranscriptID = gff3TranscriptID(record)
+			if gene := gff3Ancestor(record, FeatureGene, byID); gene != nil {
+				feature.GeneID, feature.GeneName = gff3GeneIdentity(gene)
+			} else {
+				feature.GeneID, feature.GeneName = record.attributes["gene_id"], record.attributes["gene_name"]
+			}
+			gp.addFeature(feature)
+
+		default:
+			// Exons shared by several transcripts list every parent
+			parents := record.parents
+			if len(parents) == 0 {
+				parents = []string{""}
+			}
+			for _, parentID := range parents {
+				feature := record.feature()
+				if parent := byID[parentID]; parent != nil {
+					if transcript := gff3Ancestor(parent, FeatureTranscript, byID); transcript != nil {
+						feature.TranscriptID = gff3TranscriptID(transcript)
+					}
+					if gene := gff3Ancestor(parent, FeatureGene, byID); gene != nil {
+						feature.GeneID, feature.GeneName = gff3GeneIdentity(gene)
+					}
+				}
+				if feature.TranscriptID == "" {
+					feature.TranscriptID = record.attributes["transcript_id"]
+				}
+				if feature.GeneID == "" {
+					feature.GeneID, feature.GeneName = record.attributes["gene_id"], record.attributes["gene_name"]
+				}
+				gp.addFeature(feature)
+			}
+		}
+	}
+
+	// Post-processing: infer introns and promoters
+	gp.inferIntrons()
+	gp.inferPromoters()
+
+	return nil
+}
+
+// parseGFF3Line parses a single GFF3 line
+func parseGFF3Line(line string) (*gff3Record, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 9 {
+		return nil, fmt.Errorf("expected 9 fields, got %d", len(fields))
+	}
+
+	// GFF3 is 1-based, fully closed; convert to 0-based
+	start, err := strconv.ParseUint(fields[3], 10, 64)
+	if err != nil || start == 0 {
+		return nil, fmt.Errorf("invalid start position %q", fields[3])
+	}
+	end, err := strconv.ParseUint(fields[4], 10, 64)
+	if err != nil || end < start {
+		return nil, fmt.Errorf("invalid end position %q", fields[4])
+	}
+
+	record := &gff3Record{
+		chromosome:  unescapeGFF3(fields[0]),
+		featureType: gff3FeatureType(fields[2]),
+		start:       start - 1,
+		end:         end - 1,
+		strand:      fields[6],
+		attributes:  make(map[string]string),
+	}
+
+	for _, pair := range strings.Split(fields[8], ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || key == "" {
+			continue
+		}
+		values := strings.Split(value, ",")
+		for i := range values {
+			values[i] = unescapeGFF3(values[i])
+		}
+		record.attributes[key] = strings.Join(values, ",")
+		switch key {
+		case "ID":
+			record.id = values[0]
+		case "Parent":
+			record.parents = values
+		}
+	}
+
+	return record, nil
+}
+
+// gff3FeatureType maps Sequence Ontology types, including the non-coding
+// gene and transcript types used by Ensembl and RefSeq
+func gff3FeatureType(typeStr string) FeatureType {
+	if featureType := ParseFeatureType(typeStr); featureType != FeatureUnknown {
+		return featureType
+	}
+	switch {
+	case typeStr == "ncRNA_gene", typeStr == "pseudogene", typeStr == "transposable_element_gene":
+		return FeatureGene
+	case strings.HasSuffix(typeStr, "RNA"), strings.HasSuffix(typeStr, "_transcript"),
+		typeStr == "primary_transcript", typeStr == "V_gene_segment", typeStr == "C_gene_segment":
+		return FeatureTranscript
+	}
+	return FeatureUnknown
+}
+
+// unescapeGFF3 decodes GFF3 percent-encoding (%3B, %3D, %26, %2C, ...)
+func unescapeGFF3(value string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	if decoded, err := url.PathUnescape(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+// feature converts the record to a GenomicFeature without hierarchy IDs
+func (r *gff3Record) feature() *GenomicFeature {
+	feature := NewGenomicFeature(r.featureType, r.chromosome, r.start, r.end, r.strand)
+	for key, value := range r.attributes {
+		feature.Attributes[key] = value
+	}
+	return feature
+}
+
+// gff3Ancestor walks up the first-Parent chain (starting at record) to the
+// nearest record of the given type
+func gff3Ancestor(record *gff3Record, featureType FeatureType, byID map[string]*gff3Record) *gff3Record {
+	for depth := 0; record != nil && depth < maxGFF3Depth; depth++ {
+		if record.featureType == featureType {
+			return record
+		}
+		if len(record.parents) == 0 {
+			return nil
+		}
+		record = byID[record.parents[0]]
+	}
+	return nil
+}
+
+// gff3GeneIdentity returns the gene ID and name of a gene record, preferring
+// explicit gene_id attributes over prefixed GFF3 IDs ("gene:ENSG...")
+func gff3GeneIdentity(gene *gff3Record) (string, string) {
+	geneID := gene.attributes["gene_id"]
+	if geneID == "" {
+		geneID = gene.id
+	}
+	for _, key := range []string{"Name", "gene_name", "gene"} {
+		if name := gene.attributes[key]; name != "" {
+			return geneID, name
+		}
+	}
+	return geneID, ""
+}
+
+// gff3TranscriptID returns a transcript record's ID
+func gff3TranscriptID(transcript *gff3Record) string {
+	if id := transcript.attributes["transcript_id"]; id != "" {
+		return id
+	}
+	return transcript.id
+}
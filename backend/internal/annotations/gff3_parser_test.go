@@ -0,0 +1,79 @@
+package annotations
+
+import (
+	"strings"
+	"testing"
+)
+
+// testGFF3 holds a minus-strand coding gene with two transcripts sharing an
+// exon, and a non-coding gene with escaped attributes. The embedded FASTA
+// would fail to parse as features.
+const testGFF3 = "##gff-version 3\n" +
+	"##sequence-region chr17 1 1000\n" +
+	"chr17\tENSEMBL\tgene\t101\t500\t.\t-\t.\tID=gene:G1;Name=TP53;biotype=protein_coding\n" +
+	"chr17\tENSEMBL\tmRNA\t101\t500\t.\t-\t.\tID=transcript:T1;Parent=gene:G1;Name=TP53-201\n" +
+	"chr17\tENSEMBL\tmRNA\t151\t500\t.\t-\t.\tID=transcript:T2;Parent=gene:G1\n" +
+	"chr17\tENSEMBL\texon\t101\t200\t.\t-\t.\tParent=transcript:T1\n" +
+	"chr17\tENSEMBL\texon\t301\t500\t.\t-\t.\tParent=transcript:T1,transcript:T2\n" +
+	"chr17\tENSEMBL\texon\t151\t200\t.\t-\t.\tParent=transcript:T2\n" +
+	"chr17\tENSEMBL\tCDS\t121\t200\t.\t-\t0\tID=CDS:P1;Parent=transcript:T1\n" +
+	"chr17\tENSEMBL\tCDS\t301\t450\t.\t-\t1\tID=CDS:P1;Parent=transcript:T1\n" +
+	"chr17\tENSEMBL\tfive_prime_UTR\t451\t500\t.\t-\t.\tParent=transcript:T1\n" +
+	"chr17\tENSEMBL\tncRNA_gene\t601\t700\t.\t+\t.\tID=gene:G2;gene_id=ENSG2;Name=MIR%3B1\n" +
+	"chr17\tENSEMBL\tlnc_RNA\t601\t700\t.\t+\t.\tID=transcript:T3;Parent=gene:G2;transcript_id=ENST3\n" +
+	"chr17\tENSEMBL\texon\t601\t700\t.\t+\t.\tParent=transcript:T3\n" +
+	"chr17\tENSEMBL\tbiological_region\t800\t900\t.\t.\t.\tID=region\n" +
+	"##FASTA\n" +
+	">chr17\n" +
+	"ACGT\n"
+
+// TestParseGFF3 resolves the Parent hierarchy into gene and transcript IDs
+func TestParseGFF3(t *testing.T) {
+	gp := NewGTFParser(50)
+	if err := gp.ParseGFF3(strings.NewReader(testGFF3)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		featureType FeatureType
+		want        []string
+	}{
+		{FeatureGene, []string{"100-499 - gene:G1 TP53 ", "600-699 + ENSG2 MIR;1 "}},
+		{FeatureTranscript, []string{
+			"100-499 - gene:G1 TP53 transcript:T1",
+			"150-499 - gene:G1 TP53 transcript:T2",
+			"600-699 + ENSG2 MIR;1 ENST3",
+		}},
+		{FeatureExon, []string{
+			"100-199 - gene:G1 TP53 transcript:T1",
+			"150-199 - gene:G1 TP53 transcript:T2",
+			"300-499 - gene:G1 TP53 transcript:T1",
+			"300-499 - gene:G1 TP53 transcript:T2",
+			"600-699 + ENSG2 MIR;1 ENST3",
+		}},
+		{FeatureCDS, []string{"120-199 - gene:G1 TP53 transcript:T1", "300-449 - gene:G1 TP53 transcript:T1"}},
+		{FeatureUTR5, []string{"450-499 - gene:G1 TP53 transcript:T1"}},
+		{FeatureIntron, []string{"200-299 - gene:G1 TP53 transcript:T1", "200-299 - gene:G1 TP53 transcript:T2"}},
+		{FeaturePromoter, []string{"500-549 - gene:G1 TP53 ", "550-599 + ENSG2 MIR;1 "}},
+		{FeatureUnknown, nil},
+	}
+	for _, tt := range tests {
+		if got := describeFeatures(gp, tt.featureType); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s features:\n%s\nwant:\n%s", tt.featureType, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+
+	if genes := gp.GetGeneByName("TP53"); len(genes) != 1 || genes[0].Attributes["biotype"] != "protein_coding" {
+		t.Errorf("Unexpected TP53 genes %v", genes)
+	}
+
+	for _, bad := range []string{
+		"chr1\tsrc\tgene\t100\t200\t.\t+\t.\n",
+		"chr1\tsrc\tgene\t0\t200\t.\t+\t.\tID=g\n",
+		"chr1\tsrc\tgene\t300\t200\t.\t+\t.\tID=g\n",
+	} {
+		if err := NewGTFParser(0).ParseGFF3(strings.NewReader("##gff-version 3\n" + bad)); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+			t.Errorf("Expected a line 2 error for %q, got %v", bad, err)
+		}
+	}
+}
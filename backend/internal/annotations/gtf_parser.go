@@ -24,12 +24,14 @@ import (
 	"io"
 	"strconv"
 	"strings"
+
+	"genomevedic/internal/interval"
 )
 
 // GTFParser parses GTF/GFF3 annotation files
 type GTFParser struct {
 	features       []*GenomicFeature
-	featuresByPos  map[string][]*GenomicFeature // Key: "chr:position"
+	index          *interval.Index[*GenomicFeature]
 	genesByName    map[string][]*GenomicFeature
 	genesByID      map[string]*GenomicFeature
 	exonCount      int
@@ -41,7 +43,7 @@ type GTFParser struct {
 func NewGTFParser(promoterRegion int) *GTFParser {
 	return &GTFParser{
 		features:       make([]*GenomicFeature, 0, 100000),
-		featuresByPos:  make(map[string][]*GenomicFeature),
+		index:          interval.New[*GenomicFeature](),
 		genesByName:    make(map[string][]*GenomicFeature),
 		genesByID:      make(map[string]*GenomicFeature),
 		promoterRegion: promoterRegion,
@@ -193,11 +195,8 @@ func (gp *GTFParser) addFeature(feature *GenomicFeature) {
 		gp.exonCount++
 	}
 
-	// Index by position (every 1000 bp)
-	for pos := feature.Start; pos <= feature.End; pos += 1000 {
-		key := fmt.Sprintf("%s:%d", feature.Chromosome, pos)
-		gp.featuresByPos[key] = append(gp.featuresByPos[key], feature)
-	}
+	// Index by interval
+	gp.index.Add(feature.Chromosome, feature.Start, feature.End, feature)
 }
 
 // inferIntrons infers intron positions from exons
@@ -260,6 +259,9 @@ func (gp *GTFParser) inferPromoters() {
 		var promoterStart, promoterEnd uint64
 
 		if feature.Strand == "+" {
+			if feature.Start == 0 {
+				continue // No room upstream
+			}
 			// Positive strand: promoter is upstream (lower coordinates)
 			if feature.Start >= uint64(gp.promoterRegion) {
 				promoterStart = feature.Start - uint64(gp.promoterRegion)
@@ -294,23 +296,25 @@ func (gp *GTFParser) GetFeatures() []*GenomicFeature {
 
 // GetFeaturesAtPosition returns features overlapping a specific position
 func (gp *GTFParser) GetFeaturesAtPosition(chromosome string, position uint64) []*GenomicFeature {
-	// Check position and nearby positions (within 1000 bp)
-	results := make([]*GenomicFeature, 0, 10)
-	seen := make(map[*GenomicFeature]bool)
-
-	for offset := uint64(0); offset <= 1000; offset += 1000 {
-		key := fmt.Sprintf("%s:%d", chromosome, position-position%1000+offset)
-		features := gp.featuresByPos[key]
-
-		for _, feature := range features {
-			if !seen[feature] && feature.Contains(position) {
-				results = append(results, feature)
-				seen[feature] = true
-			}
-		}
-	}
+	return gp.index.At(chromosome, position)
+}
 
-	return results
+// GetFeaturesInRange returns features overlapping [start, end] (inclusive),
+// ordered by start position
+func (gp *GTFParser) GetFeaturesInRange(chromosome string, start, end uint64) []*GenomicFeature {
+	return gp.index.Overlapping(chromosome, start, end)
+}
+
+// GetNearestFeatures returns the features of a type closest to a position
+// (FeatureUnknown matches any type) and their distance in base pairs.
+// Features overlapping the position have distance 0.
+func (gp *GTFParser) GetNearestFeatures(chromosome string, position uint64, featureType FeatureType) ([]*GenomicFeature, uint64) {
+	var keep func(*GenomicFeature) bool
+	if featureType != FeatureUnknown {
+		keep = func(feature *GenomicFeature) bool { return feature.Type == featureType }
+	}
+	features, distance, _ := gp.index.Nearest(chromosome, position, keep)
+	return features, distance
 }
 
 // GetGeneByName returns a gene by name
@@ -9,22 +9,30 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"genomevedic/backend/internal/ai"
+	"genomevedic/backend/internal/annotations"
 	"genomevedic/backend/internal/crispr"
 	"genomevedic/backend/internal/integrations"
+	"genomevedic/backend/internal/mutations"
+	"genomevedic/backend/internal/reference"
 )
 
 // Server represents the API server
 type Server struct {
 	nlEngine           *ai.NLQueryEngine
 	variantInterpreter *ai.ChatGPTInterpreter
+	contextRetriever   *ai.ContextRetriever // ClinVar/gnomAD/COSMIC context for ACMG classification
+	acmgEngine         *ai.ACMGEngine
 	crisprHandler      *crispr.Handler
+	cohortHandler      *mutations.CohortHandler // nil without COHORT_STORE
 	galaxyHandlers     *integrations.GalaxyHandlers
 	port               int
 	mux                *http.ServeMux
@@ -32,25 +40,151 @@ type Server struct {
 
 // NewServer creates a new API server
 func NewServer(port int) (*Server, error) {
-	// Get OpenAI API key from environment
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	// LLM provider configuration from environment. Without a provider,
+	// natural language queries use the offline rule-based translator and
+	// variant explanations are disabled.
+	aiConfig := ai.DefaultConfig()
+	aiConfig.OpenAIAPIKey = os.Getenv("OPENAI_API_KEY")
+	aiConfig.LLMProvider = getEnvOrDefault("LLM_PROVIDER", ai.ProviderOpenAI)
+	aiConfig.LLMBaseURL = os.Getenv("LLM_BASE_URL")
+	aiConfig.LLMReplayDir = os.Getenv("LLM_REPLAY_DIR")
+	aiConfig.OpenAIModel = getEnvOrDefault("LLM_MODEL", aiConfig.OpenAIModel)
+	// Local ClinVar/gnomAD/COSMIC snapshot (see cmd/annotation_index); the
+	// remote APIs are only queried for missing data with ANNOTATION_REMOTE_FALLBACK=true
+	aiConfig.NCBIAPIKey = os.Getenv("NCBI_API_KEY")
+	aiConfig.AnnotationPath = os.Getenv("ANNOTATION_STORE")
+	aiConfig.RemoteFallback = os.Getenv("ANNOTATION_REMOTE_FALLBACK") == "true"
+	if !aiConfig.LLMConfigured() {
+		log.Println("No LLM provider configured (OPENAI_API_KEY / LLM_BASE_URL / LLM_PROVIDER): using offline rule-based query translation, variant explanations disabled")
 	}
 
-	nlEngine := ai.NewNLQueryEngine(apiKey)
+	nlEngine, err := ai.NewNLQueryEngineFromConfig(aiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create query engine: %w", err)
+	}
 
-	// Create ChatGPT interpreter for variant explanations
-	aiConfig := ai.DefaultConfig()
-	aiConfig.OpenAIAPIKey = apiKey
-	variantInterpreter, err := ai.NewChatGPTInterpreter(aiConfig)
+	// Load the embedded variants store (comma-separated COSMIC TSV / VCF paths)
+	if paths := os.Getenv("VARIANTS_DATA_PATHS"); paths != "" {
+		store := ai.NewVariantStore()
+		for _, path := range strings.Split(paths, ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			count, err := store.LoadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load variants from %s: %w", path, err)
+			}
+			log.Printf("Loaded %d variants from %s", count, path)
+		}
+		nlEngine.AttachVariantStore(store, ai.DefaultExecutionLimits())
+	}
+
+	// Variant context (local annotation store and/or remote APIs), shared by
+	// ACMG classification and the interpreter
+	contextRetriever, err := ai.NewContextRetrieverFromConfig(aiConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create variant interpreter: %w", err)
+		return nil, fmt.Errorf("failed to open annotation store: %w", err)
+	}
+	acmgEngine := ai.NewACMGEngine(ai.DefaultACMGOptions())
+
+	// Create ChatGPT interpreter for variant explanations
+	var variantInterpreter *ai.ChatGPTInterpreter
+	if aiConfig.LLMConfigured() {
+		provider, err := ai.NewLLMProvider(aiConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create variant interpreter: %w", err)
+		}
+		variantInterpreter = ai.NewChatGPTInterpreterWithProvider(aiConfig, provider)
+		variantInterpreter.SetContextRetriever(contextRetriever)
+		variantInterpreter.SetACMGEngine(acmgEngine)
 	}
 
 	// Create CRISPR handler
 	crisprHandler := crispr.NewHandler()
 
+	// Use a prebuilt genome FM-index for off-target search (see cmd/crispr_index)
+	if indexPath := os.Getenv("CRISPR_FM_INDEX"); indexPath != "" {
+		genomeIndex, err := crispr.LoadGenomeIndex(indexPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CRISPR genome index: %w", err)
+		}
+		crisprHandler.SetGenomeIndex(genomeIndex)
+		log.Printf("Loaded CRISPR off-target index from %s", indexPath)
+	}
+
+	// Extra on-target scoring models: comma-separated JSON weights files
+	if modelPaths := os.Getenv("CRISPR_SCORING_MODELS"); modelPaths != "" {
+		for _, path := range strings.Split(modelPaths, ",") {
+			scorer, err := crispr.LoadScoringModel(strings.TrimSpace(path))
+			if err != nil {
+				return nil, err
+			}
+			crisprHandler.RegisterScorer(scorer)
+			log.Printf("Loaded CRISPR scoring model %s from %s", scorer.Name(), path)
+		}
+	}
+
+	// Reference genome and gene annotations for coordinate/gene-name design
+	var ref *reference.FASTA
+	if fastaPath := os.Getenv("CRISPR_REFERENCE_FASTA"); fastaPath != "" {
+		ref, err = reference.Open(fastaPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open reference genome: %w", err)
+		}
+		crisprHandler.SetReference(ref)
+		log.Printf("Loaded reference genome %s (%d sequences)", fastaPath, len(ref.Sequences()))
+	}
+	// Population VCF (e.g., gnomAD, bgzip with tabix index) for variant-aware
+	// requests that supply no VCF of their own
+	if vcfPath := os.Getenv("CRISPR_POPULATION_VCF"); vcfPath != "" {
+		crisprHandler.SetPopulationVCF(vcfPath)
+		log.Printf("Using population variants from %s for CRISPR design", vcfPath)
+	}
+	// GTF, GFF3 or BED12 (CRISPR_ANNOTATIONS_GTF is the older name)
+	var genes *annotations.GTFParser
+	if annotationPath := getEnvOrDefault("CRISPR_ANNOTATIONS", os.Getenv("CRISPR_ANNOTATIONS_GTF")); annotationPath != "" {
+		genes, err = annotations.LoadAnnotationFile(annotationPath, 2000)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load gene annotations: %w", err)
+		}
+		crisprHandler.SetAnnotations(genes)
+		log.Printf("Loaded gene annotations from %s", annotationPath)
+	}
+
+	// Cohort store: COHORT_STORE is the store file, COHORT_VCFS optional
+	// comma-separated VCFs ingested (and saved) at startup
+	var cohortHandler *mutations.CohortHandler
+	if storePath := os.Getenv("COHORT_STORE"); storePath != "" {
+		store, err := mutations.OpenCohortStore(storePath)
+		if err != nil {
+			return nil, err
+		}
+		if ref != nil && genes != nil {
+			// Predict consequences/HGVS for unannotated VCFs
+			store.SetAnnotator(mutations.NewConsequenceAnnotator(genes, ref))
+		}
+		if paths := os.Getenv("COHORT_VCFS"); paths != "" {
+			for _, path := range strings.Split(paths, ",") {
+				path = strings.TrimSpace(path)
+				if path == "" {
+					continue
+				}
+				calls, err := store.IngestVCFFile(path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to ingest cohort VCF %s: %w", path, err)
+				}
+				log.Printf("Ingested %d cohort calls from %s", calls, path)
+			}
+			if err := store.Save(); err != nil {
+				return nil, err
+			}
+		}
+		cohortHandler = mutations.NewCohortHandler(store)
+		cohortHandler.SetAnnotations(genes)
+		log.Printf("Loaded cohort store %s (%d samples)", storePath, len(store.Samples()))
+	}
+
 	// Create Galaxy integration handlers
 	galaxyOAuthConfig := &integrations.GalaxyOAuthConfig{
 		ClientID:     os.Getenv("GALAXY_CLIENT_ID"),
@@ -64,7 +198,10 @@ func NewServer(port int) (*Server, error) {
 	server := &Server{
 		nlEngine:           nlEngine,
 		variantInterpreter: variantInterpreter,
+		contextRetriever:   contextRetriever,
+		acmgEngine:         acmgEngine,
 		crisprHandler:      crisprHandler,
+		cohortHandler:      cohortHandler,
 		galaxyHandlers:     galaxyHandlers,
 		port:               port,
 		mux:                http.NewServeMux(),
@@ -84,6 +221,7 @@ func (s *Server) registerRoutes() {
 	// Variant explanation routes
 	s.mux.HandleFunc("/api/v1/variants/explain", s.corsMiddleware(s.handleExplainVariant))
 	s.mux.HandleFunc("/api/v1/variants/batch-explain", s.corsMiddleware(s.handleBatchExplainVariants))
+	s.mux.HandleFunc("/api/v1/variants/classify", s.corsMiddleware(s.handleClassifyVariant))
 
 	// Cache and health routes
 	s.mux.HandleFunc("/api/v1/cache/stats", s.corsMiddleware(s.handleCacheStats))
@@ -92,6 +230,11 @@ func (s *Server) registerRoutes() {
 	// CRISPR design routes
 	s.crisprHandler.RegisterRoutes(s.mux, s.corsMiddleware)
 
+	// Cohort routes
+	if s.cohortHandler != nil {
+		s.cohortHandler.RegisterRoutes(s.mux, s.corsMiddleware)
+	}
+
 	// Galaxy integration routes
 	s.galaxyHandlers.RegisterRoutes(s.mux)
 }
@@ -126,8 +269,10 @@ type NaturalLanguageQueryResponse struct {
 	IsValid         bool                  `json:"is_valid"`
 	ValidationError string                `json:"validation_error,omitempty"`
 	Explanation     string                `json:"explanation"`
+	Executed        bool                  `json:"executed"` // False when no variant store is configured
 	Results         []map[string]interface{} `json:"results,omitempty"`
 	ResultCount     int                   `json:"result_count"`
+	Truncated       bool                  `json:"truncated,omitempty"` // Results were cut at the row limit
 	ExecutionTimeMs int64                 `json:"execution_time_ms"`
 	Error           string                `json:"error,omitempty"`
 }
@@ -163,9 +308,6 @@ func (s *Server) handleNaturalLanguageQuery(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Note: In a production system, you would execute the SQL query here
-	// against a real database and return results. For this implementation,
-	// we return the SQL query for transparency and validation.
 	response := NaturalLanguageQueryResponse{
 		Success:         result.IsValid,
 		OriginalQuery:   result.OriginalQuery,
@@ -173,14 +315,34 @@ func (s *Server) handleNaturalLanguageQuery(w http.ResponseWriter, r *http.Reque
 		IsValid:         result.IsValid,
 		ValidationError: result.ValidationError,
 		Explanation:     result.Explanation,
-		ResultCount:     0, // Would be populated from actual query execution
 		ExecutionTimeMs: result.ExecutionTimeMs,
 	}
 
 	if !result.IsValid {
 		response.Error = result.ValidationError
+		s.sendJSON(w, http.StatusOK, response)
+		return
 	}
 
+	// Execute the validated SQL against the variants store. Without a
+	// store the validated SQL is returned unexecuted.
+	execution, err := s.nlEngine.ExecuteQuery(r.Context(), result)
+	if errors.Is(err, ai.ErrNoVariantStore) {
+		s.sendJSON(w, http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		response.Success = false
+		response.Error = err.Error()
+		s.sendJSON(w, http.StatusOK, response)
+		return
+	}
+	response.Executed = true
+	response.Results = execution.Rows
+	response.ResultCount = execution.RowCount
+	response.Truncated = execution.Truncated
+	response.ExecutionTimeMs += execution.ExecutionTimeMs
+
 	s.sendJSON(w, http.StatusOK, response)
 }
 
@@ -225,6 +387,10 @@ func (s *Server) handleExplainVariant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.requireInterpreter(w) {
+		return
+	}
+
 	// Generate explanation
 	ctx := r.Context()
 	response, err := s.variantInterpreter.ExplainVariant(ctx, req)
@@ -237,6 +403,58 @@ func (s *Server) handleExplainVariant(w http.ResponseWriter, r *http.Request) {
 	s.sendJSON(w, http.StatusOK, response)
 }
 
+// handleClassifyVariant handles POST /api/v1/variants/classify: ACMG/AMP
+// classification, with an LLM narrative when "narrative" is true
+func (s *Server) handleClassifyVariant(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req ai.ClassificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// Validate required fields
+	if req.Gene == "" {
+		s.sendError(w, http.StatusBadRequest, "gene is required")
+		return
+	}
+	if req.Variant == "" && req.Consequence == "" {
+		s.sendError(w, http.StatusBadRequest, "variant or consequence is required")
+		return
+	}
+	// Population frequency (BA1/BS1/PM2) is looked up by allele; without
+	// coordinates the frequency criteria are reported as not evaluated
+	if req.Chromosome != "" || req.Position != 0 || req.RefAllele != "" || req.AltAllele != "" {
+		if !req.HasCoordinates() {
+			s.sendError(w, http.StatusBadRequest, "chromosome, position, ref_allele and alt_allele are all required to evaluate population frequency")
+			return
+		}
+	}
+
+	ctx := r.Context()
+	var response *ai.ClassificationResponse
+	var err error
+	if req.Narrative {
+		if !s.requireInterpreter(w) {
+			return
+		}
+		response, err = s.variantInterpreter.ClassifyVariant(ctx, req)
+	} else {
+		response, err = ai.ClassifyVariant(ctx, s.contextRetriever, s.acmgEngine, req)
+	}
+	if err != nil {
+		log.Printf("Error classifying variant: %v", err)
+		s.sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, response)
+}
+
 // handleBatchExplainVariants handles POST /api/v1/variants/batch-explain
 func (s *Server) handleBatchExplainVariants(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -255,6 +473,10 @@ func (s *Server) handleBatchExplainVariants(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if !s.requireInterpreter(w) {
+		return
+	}
+
 	// Generate explanations
 	ctx := r.Context()
 	responses, err := s.variantInterpreter.BatchExplainVariants(ctx, requests)
@@ -278,6 +500,10 @@ func (s *Server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.requireInterpreter(w) {
+		return
+	}
+
 	ctx := r.Context()
 	stats, err := s.variantInterpreter.GetCacheStats(ctx)
 	if err != nil {
@@ -309,6 +535,15 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.sendJSON(w, http.StatusOK, response)
 }
 
+// requireInterpreter sends 503 if variant explanations are disabled (no LLM provider)
+func (s *Server) requireInterpreter(w http.ResponseWriter) bool {
+	if s.variantInterpreter == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "variant explanations require an LLM provider (OPENAI_API_KEY or LLM_BASE_URL)")
+		return false
+	}
+	return true
+}
+
 // sendJSON sends a JSON response
 func (s *Server) sendJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,305 @@
+package bgzf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testData returns compressible data spanning several blocks
+func testData(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = "ACGT\n"[rng.Intn(5)]
+	}
+	return data
+}
+
+// TestRoundTrip tests that written files decode with both this package and compress/gzip
+func TestRoundTrip(t *testing.T) {
+	data := testData(200000)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got, err := io.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("BGZF round trip failed: %v (%d of %d bytes)", err, len(got), len(data))
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("gzip.NewReader failed: %v", err)
+	}
+	got, err = io.ReadAll(gz)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("gzip decoding failed: %v", err)
+	}
+}
+
+// TestGZISeek tests building the .gzi index and seeking by uncompressed offset
+func TestGZISeek(t *testing.T) {
+	data := testData(300000)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+
+	built, err := BuildGZI(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("BuildGZI failed: %v", err)
+	}
+	written := w.Index()
+	if len(built) != len(written) || len(built) < 4 {
+		t.Fatalf("Expected %d index entries, got %d", len(written), len(built))
+	}
+	for i := range built {
+		if built[i] != written[i] {
+			t.Errorf("Entry %d: built %+v, written %+v", i, built[i], written[i])
+		}
+	}
+
+	var encoded bytes.Buffer
+	if err := built.Write(&encoded); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	index, err := ReadGZI(&encoded)
+	if err != nil || len(index) != len(built) {
+		t.Fatalf("ReadGZI failed: %v", err)
+	}
+
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	for _, offset := range []int64{0, 1, blockDataSize - 1, blockDataSize, 123456, int64(len(data)) - 10} {
+		if err := r.Seek(index.VirtualOffset(offset)); err != nil {
+			t.Fatalf("Seek(%d) failed: %v", offset, err)
+		}
+		got := make([]byte, 10)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("Read at %d failed: %v", offset, err)
+		}
+		if !bytes.Equal(got, data[offset:offset+10]) {
+			t.Errorf("Read at %d = %q, want %q", offset, got, data[offset:offset+10])
+		}
+	}
+}
+
+// TestRoundTripEdgeCases covers empty input, explicit flushes, byte-at-a-time
+// reads, the EOF marker and corrupted blocks
+func TestRoundTripEdgeCases(t *testing.T) {
+	var empty bytes.Buffer
+	w := NewWriter(&empty)
+	w.Close()
+	if !bytes.Equal(empty.Bytes(), eofMarker) {
+		t.Errorf("Empty file should be just the EOF marker, got %d bytes", empty.Len())
+	}
+	if got, err := io.ReadAll(NewReader(bytes.NewReader(empty.Bytes()))); err != nil || len(got) != 0 {
+		t.Errorf("Empty round trip: %q, %v", got, err)
+	}
+
+	data := testData(150000)
+	var buf bytes.Buffer
+	w = NewWriter(&buf)
+	w.Write(data[:10])
+	w.Flush()
+	w.Flush() // No empty block
+	w.Write(data[10:])
+	w.Close()
+	if !bytes.HasSuffix(buf.Bytes(), eofMarker) || !IsBGZF(buf.Bytes()) {
+		t.Fatal("Expected a BGZF header and the EOF marker")
+	}
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("Expected error writing after Close")
+	}
+
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	var got []byte
+	one := make([]byte, 1)
+	for {
+		n, err := r.Read(one)
+		got = append(got, one[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Byte-at-a-time round trip returned %d of %d bytes", len(got), len(data))
+	}
+
+	// Flip the CRC of the first block
+	corrupt := append([]byte(nil), buf.Bytes()...)
+	bsize := int(binary.LittleEndian.Uint16(corrupt[16:18])) + 1
+	corrupt[bsize-FooterSize] ^= 0xff
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(corrupt))); err == nil || !strings.Contains(err.Error(), "CRC") {
+		t.Errorf("Expected a CRC error, got %v", err)
+	}
+
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	zw.Write(data)
+	zw.Close()
+	if IsBGZF(plain.Bytes()) {
+		t.Error("Plain gzip detected as BGZF")
+	}
+}
+
+// TestVirtualOffsets tests that writer and reader agree on record offsets,
+// and that seeking to a recorded offset resumes at that record
+func TestVirtualOffsets(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("record%d\t%s", i, strings.Repeat("ACGT", rng.Intn(60))))
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	offsets := make([]uint64, len(lines))
+	for i, line := range lines {
+		offsets[i] = w.VirtualOffset()
+		w.Write([]byte(line + "\n"))
+		if i%500 == 499 {
+			w.Flush()
+		}
+	}
+	w.Close()
+
+	blocks := 0
+	for i, offset := range offsets {
+		if offset&0xffff == 0 && i > 0 {
+			blocks++
+		}
+		if offset&0xffff >= blockDataSize {
+			t.Fatalf("Offset %d within block exceeds the block size", offset&0xffff)
+		}
+	}
+	if blocks < 5 {
+		t.Fatalf("Expected records spanning several blocks, got %d block starts", blocks)
+	}
+
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	for i := range lines {
+		if r.VirtualOffset() != offsets[i] {
+			t.Fatalf("Line %d: reader at %d:%d, writer wrote at %d:%d", i,
+				r.VirtualOffset()>>16, r.VirtualOffset()&0xffff, offsets[i]>>16, offsets[i]&0xffff)
+		}
+		line, err := r.ReadLine()
+		if err != nil || string(line) != lines[i] {
+			t.Fatalf("Line %d = %q, %v", i, line, err)
+		}
+	}
+	if _, err := r.ReadLine(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+
+	for _, i := range []int{4999, 0, 2500, 499, 500, 1234} {
+		if err := r.Seek(offsets[i]); err != nil {
+			t.Fatalf("Seek to line %d failed: %v", i, err)
+		}
+		line, err := r.ReadLine()
+		if err != nil || string(line) != lines[i] {
+			t.Errorf("After seeking to line %d read %q, %v", i, line, err)
+		}
+	}
+
+	if err := r.Seek(offsets[1]&^0xffff | 0xfff0); err == nil {
+		t.Error("Expected error seeking past the end of a block")
+	}
+	if err := r.Seek(uint64(buf.Len()+100) << 16); err != nil {
+		t.Fatalf("Seek past the file failed: %v", err)
+	}
+	if _, err := r.ReadLine(); err != io.EOF {
+		t.Errorf("Expected EOF past the file, got %v", err)
+	}
+}
+
+// TestTabixQuery tests that tabix chunks cover every record overlapping a region
+func TestTabixQuery(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	var sb strings.Builder
+	sb.WriteString("##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n")
+	type record struct {
+		chrom    string
+		beg, end int64
+	}
+	var records []record
+	for _, chrom := range []string{"chr1", "chr2"} {
+		pos := int64(1)
+		for i := 0; i < 20000; i++ {
+			pos += int64(rng.Intn(100))
+			ref := strings.Repeat("A", 1+rng.Intn(40))
+			fmt.Fprintf(&sb, "%s\t%d\t.\t%s\tG\t.\tPASS\t.\n", chrom, pos, ref)
+			records = append(records, record{chrom, pos, pos + int64(len(ref)) - 1})
+		}
+	}
+
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write([]byte(sb.String()))
+	w.Close()
+
+	built, err := BuildTabix(NewReader(bytes.NewReader(buf.Bytes())), VCFTabixConfig)
+	if err != nil {
+		t.Fatalf("BuildTabix failed: %v", err)
+	}
+	path := filepath.Join(dir, "test.vcf.gz.tbi")
+	file, _ := os.Create(path)
+	if err := built.Write(file); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	file.Close()
+
+	index, err := LoadTabix(path)
+	if err != nil {
+		t.Fatalf("LoadTabix failed: %v", err)
+	}
+	if len(index.Names) != 2 || !index.HasSequence("chr2") || index.Config.Format != TabixVCF {
+		t.Fatalf("Unexpected index header: %+v %v", index.Config, index.Names)
+	}
+
+	reader := NewReader(bytes.NewReader(buf.Bytes()))
+	for _, region := range []record{{"chr1", 1, 50}, {"chr1", 400000, 420000}, {"chr2", 123456, 123460}, {"chr2", 990000, 2000000}} {
+		found := map[int64]bool{}
+		for _, chunk := range index.Chunks(region.chrom, region.beg-1, region.end) {
+			if err := reader.Seek(chunk.Begin); err != nil {
+				t.Fatalf("Seek failed: %v", err)
+			}
+			for reader.VirtualOffset() < chunk.End {
+				line, err := reader.ReadLine()
+				if err != nil {
+					t.Fatalf("ReadLine failed: %v", err)
+				}
+				fields := strings.Split(string(line), "\t")
+				pos, _ := strconv.ParseInt(fields[1], 10, 64)
+				if fields[0] == region.chrom {
+					found[pos] = true
+				}
+			}
+		}
+
+		for _, rec := range records {
+			if rec.chrom == region.chrom && rec.beg <= region.end && rec.end >= region.beg && !found[rec.beg] {
+				t.Errorf("Region %s:%d-%d missed record at %d", region.chrom, region.beg, region.end, rec.beg)
+			}
+		}
+	}
+}
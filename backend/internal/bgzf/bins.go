@@ -0,0 +1,75 @@
+package bgzf
+
+import "sort"
+
+// Chunk is a range of virtual file offsets [Begin, End)
+type Chunk struct {
+	Begin uint64
+	End   uint64
+}
+
+// RegionToBin returns the smallest bin fully containing the 0-based
+// half-open interval [beg, end) in the binning scheme shared by tabix, BAI
+// (minShift 14, depth 5) and CSI indexes (SAM specification section 5.3)
+func RegionToBin(beg, end int64, minShift, depth int) uint32 {
+	if end <= beg {
+		end = beg + 1
+	}
+	end--
+	s := minShift
+	t := ((1 << (depth * 3)) - 1) / 7
+	for level := depth; level > 0; level-- {
+		if beg>>uint(s) == end>>uint(s) {
+			return uint32(t + int(beg>>uint(s)))
+		}
+		s += 3
+		t -= 1 << (uint(level-1) * 3)
+	}
+	return 0
+}
+
+// RegionToBins lists every bin that may contain records overlapping the
+// 0-based half-open interval [beg, end)
+func RegionToBins(beg, end int64, minShift, depth int) []uint32 {
+	maxPos := int64(1) << uint(minShift+depth*3)
+	if end > maxPos {
+		end = maxPos
+	}
+	if end <= beg {
+		end = beg + 1
+	}
+	end-- // Inclusive end for the bin arithmetic
+
+	bins := make([]uint32, 0, 32)
+	t := 0
+	s := minShift + depth*3
+	for level := 0; level <= depth; level++ {
+		for i := t + int(beg>>uint(s)); i <= t+int(end>>uint(s)); i++ {
+			bins = append(bins, uint32(i))
+		}
+		s -= 3
+		t += 1 << (uint(level) * 3)
+	}
+	return bins
+}
+
+// MergeChunks sorts chunks and coalesces overlapping or adjacent ranges
+func MergeChunks(chunks []Chunk) []Chunk {
+	if len(chunks) == 0 {
+		return nil
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Begin < chunks[j].Begin })
+
+	merged := chunks[:1]
+	for _, chunk := range chunks[1:] {
+		last := &merged[len(merged)-1]
+		if chunk.Begin <= last.End {
+			if chunk.End > last.End {
+				last.End = chunk.End
+			}
+			continue
+		}
+		merged = append(merged, chunk)
+	}
+	return merged
+}
@@ -0,0 +1,104 @@
+package bgzf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// GZIEntry maps the start of a block to its uncompressed offset
+type GZIEntry struct {
+	Compressed   int64
+	Uncompressed int64
+}
+
+// GZI is a bgzip .gzi index: the block start offsets, excluding the first
+// block (which always starts at 0/0), in increasing order
+type GZI []GZIEntry
+
+// ReadGZI parses a .gzi file (little-endian entry count followed by
+// compressed/uncompressed offset pairs)
+func ReadGZI(r io.Reader) (GZI, error) {
+	var count uint64
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("failed to read GZI entry count: %w", err)
+	}
+	if count > 1<<32 {
+		return nil, fmt.Errorf("implausible GZI entry count %d", count)
+	}
+
+	pairs := make([]uint64, 2*count)
+	if err := binary.Read(r, binary.LittleEndian, pairs); err != nil {
+		return nil, fmt.Errorf("failed to read GZI entries: %w", err)
+	}
+
+	index := make(GZI, count)
+	for i := range index {
+		index[i] = GZIEntry{Compressed: int64(pairs[2*i]), Uncompressed: int64(pairs[2*i+1])}
+		if i > 0 && index[i].Uncompressed < index[i-1].Uncompressed {
+			return nil, fmt.Errorf("GZI entries out of order at %d", i)
+		}
+	}
+	return index, nil
+}
+
+// Write writes the index in .gzi format
+func (g GZI) Write(w io.Writer) error {
+	pairs := make([]uint64, 0, 2*len(g)+1)
+	pairs = append(pairs, uint64(len(g)))
+	for _, e := range g {
+		pairs = append(pairs, uint64(e.Compressed), uint64(e.Uncompressed))
+	}
+	if err := binary.Write(w, binary.LittleEndian, pairs); err != nil {
+		return fmt.Errorf("failed to write GZI index: %w", err)
+	}
+	return nil
+}
+
+// BuildGZI scans the block headers of a BGZF file to build its index
+func BuildGZI(ra io.ReaderAt) (GZI, error) {
+	var index GZI
+	var header [HeaderSize]byte
+	var footer [FooterSize]byte
+	var addr, uncompressed int64
+
+	for {
+		bsize, _, err := readBlockHeader(ra, addr, header[:])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ra.ReadAt(footer[:], addr+int64(bsize)-FooterSize); err != nil {
+			return nil, fmt.Errorf("truncated BGZF block at offset %d: %w", addr, err)
+		}
+
+		isize := int64(binary.LittleEndian.Uint32(footer[4:8]))
+		addr += int64(bsize)
+		uncompressed += isize
+		if isize > 0 {
+			index = append(index, GZIEntry{Compressed: addr, Uncompressed: uncompressed})
+		}
+	}
+
+	// Drop the entry pointing past the last data block
+	if len(index) > 0 {
+		index = index[:len(index)-1]
+	}
+	return index, nil
+}
+
+// VirtualOffset converts an uncompressed offset to a virtual file offset
+func (g GZI) VirtualOffset(uncompressed int64) uint64 {
+	i := sort.Search(len(g), func(i int) bool {
+		return g[i].Uncompressed > uncompressed
+	}) - 1
+
+	block := GZIEntry{}
+	if i >= 0 {
+		block = g[i]
+	}
+	return uint64(block.Compressed)<<16 | uint64(uncompressed-block.Uncompressed)
+}
@@ -0,0 +1,208 @@
+// Package bgzf reads and writes the Blocked GNU Zip Format used by bgzip,
+// BAM, tabix-indexed VCF and faidx-indexed FASTA files.
+//
+// A BGZF file is a series of gzip members, each holding at most 64 KB of
+// uncompressed data. Positions are addressed with virtual file offsets
+// (compressed block address << 16 | offset within the uncompressed block),
+// which lets readers seek directly to the block holding a record.
+package bgzf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// BGZF constants (SAM/BAM specification section 4.1)
+const (
+	HeaderSize   = 18    // Fixed gzip header + 'BC' extra subfield
+	FooterSize   = 8     // CRC32 + ISIZE
+	MaxBlockSize = 65536 // Maximum compressed and uncompressed block size
+)
+
+// IsBGZF reports whether the given header bytes look like a BGZF block
+func IsBGZF(header []byte) bool {
+	return len(header) >= HeaderSize &&
+		header[0] == 0x1f && header[1] == 0x8b && header[2] == 8 &&
+		header[3]&4 != 0 && header[12] == 'B' && header[13] == 'C'
+}
+
+// Reader decompresses a BGZF file one block at a time. It reads through an
+// io.ReaderAt, so several Readers may share one open file.
+type Reader struct {
+	ra        io.ReaderAt
+	blockAddr int64  // Compressed offset of the current block
+	nextAddr  int64  // Compressed offset of the next block
+	block     []byte // Uncompressed contents of the current block
+	off       int    // Read position within block
+	header    [HeaderSize]byte
+	cdata     []byte
+	inflater  io.ReadCloser
+	line      []byte // Buffer reused by ReadLine
+	eof       bool
+}
+
+// NewReader creates a reader positioned at the start of the file
+func NewReader(ra io.ReaderAt) *Reader {
+	return &Reader{
+		ra:    ra,
+		block: make([]byte, 0, MaxBlockSize),
+		cdata: make([]byte, MaxBlockSize),
+	}
+}
+
+// Read implements io.Reader over the uncompressed stream
+func (r *Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if r.off >= len(r.block) {
+			if err := r.readBlock(); err != nil {
+				if n > 0 && err == io.EOF {
+					return n, nil
+				}
+				return n, err
+			}
+			continue
+		}
+		copied := copy(p[n:], r.block[r.off:])
+		r.off += copied
+		n += copied
+	}
+	return n, nil
+}
+
+// ReadLine returns the next line without its trailing newline. The returned
+// slice is only valid until the next call. It returns io.EOF when no data remains.
+func (r *Reader) ReadLine() ([]byte, error) {
+	r.line = r.line[:0]
+	for {
+		if r.off >= len(r.block) {
+			if err := r.readBlock(); err != nil {
+				if err == io.EOF && len(r.line) > 0 {
+					return r.line, nil
+				}
+				return nil, err
+			}
+			continue
+		}
+		if i := bytes.IndexByte(r.block[r.off:], '\n'); i >= 0 {
+			r.line = append(r.line, r.block[r.off:r.off+i]...)
+			r.off += i + 1
+			return bytes.TrimSuffix(r.line, []byte{'\r'}), nil
+		}
+		r.line = append(r.line, r.block[r.off:]...)
+		r.off = len(r.block)
+	}
+}
+
+// VirtualOffset returns the virtual file offset of the next byte to be read
+func (r *Reader) VirtualOffset() uint64 {
+	if r.off >= len(r.block) && len(r.block) > 0 {
+		// Current block exhausted: the next byte lives in the next block
+		return uint64(r.nextAddr) << 16
+	}
+	return uint64(r.blockAddr)<<16 | uint64(r.off)
+}
+
+// Seek positions the reader at a virtual file offset
+func (r *Reader) Seek(voffset uint64) error {
+	addr := int64(voffset >> 16)
+	within := int(voffset & 0xffff)
+
+	r.nextAddr = addr
+	r.block = r.block[:0]
+	r.off = 0
+	r.eof = false
+
+	if within == 0 {
+		return nil
+	}
+	if err := r.readBlock(); err != nil {
+		return fmt.Errorf("failed to seek to virtual offset %d:%d: %w", addr, within, err)
+	}
+	if r.blockAddr != addr || within > len(r.block) {
+		return fmt.Errorf("virtual offset %d:%d beyond block size %d", addr, within, len(r.block))
+	}
+	r.off = within
+	return nil
+}
+
+// readBlock reads and inflates the next BGZF block.
+// Empty blocks (such as the EOF marker) are skipped.
+func (r *Reader) readBlock() error {
+	for {
+		if r.eof {
+			return io.EOF
+		}
+
+		r.blockAddr = r.nextAddr
+		bsize, xlen, err := readBlockHeader(r.ra, r.blockAddr, r.header[:])
+		if err == io.EOF {
+			r.eof = true
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+
+		remaining := bsize - HeaderSize - (xlen - 6)
+		if remaining < FooterSize || remaining > len(r.cdata) {
+			return fmt.Errorf("invalid BGZF block size %d at offset %d", bsize, r.blockAddr)
+		}
+		dataAddr := r.blockAddr + int64(bsize-remaining)
+		if _, err := r.ra.ReadAt(r.cdata[:remaining], dataAddr); err != nil {
+			return fmt.Errorf("truncated BGZF block at offset %d: %w", r.blockAddr, err)
+		}
+		r.nextAddr = r.blockAddr + int64(bsize)
+
+		compressed := r.cdata[:remaining-FooterSize]
+		footer := r.cdata[remaining-FooterSize : remaining]
+		expectedCRC := binary.LittleEndian.Uint32(footer[0:4])
+		isize := int(binary.LittleEndian.Uint32(footer[4:8]))
+		if isize > MaxBlockSize {
+			return fmt.Errorf("invalid BGZF uncompressed size %d at offset %d", isize, r.blockAddr)
+		}
+
+		r.block = r.block[:isize]
+		r.off = 0
+		if isize == 0 {
+			continue
+		}
+
+		if r.inflater == nil {
+			r.inflater = flate.NewReader(bytes.NewReader(compressed))
+		} else if err := r.inflater.(flate.Resetter).Reset(bytes.NewReader(compressed), nil); err != nil {
+			return fmt.Errorf("failed to reset inflater: %w", err)
+		}
+		if _, err := io.ReadFull(r.inflater, r.block); err != nil {
+			return fmt.Errorf("failed to inflate BGZF block at offset %d: %w", r.blockAddr, err)
+		}
+		if crc32.ChecksumIEEE(r.block) != expectedCRC {
+			return fmt.Errorf("BGZF CRC mismatch at offset %d", r.blockAddr)
+		}
+
+		return nil
+	}
+}
+
+// readBlockHeader reads the header of the block at addr and returns its
+// total size and extra field length. It returns io.EOF at the end of the file.
+func readBlockHeader(ra io.ReaderAt, addr int64, header []byte) (int, int, error) {
+	n, err := ra.ReadAt(header[:HeaderSize], addr)
+	if n == 0 && err == io.EOF {
+		return 0, 0, io.EOF
+	}
+	if n < HeaderSize {
+		return 0, 0, fmt.Errorf("failed to read BGZF header at offset %d: %w", addr, io.ErrUnexpectedEOF)
+	}
+	if !IsBGZF(header) {
+		return 0, 0, fmt.Errorf("invalid BGZF block header at offset %d", addr)
+	}
+
+	xlen := int(binary.LittleEndian.Uint16(header[10:12]))
+	bsize := int(binary.LittleEndian.Uint16(header[16:18])) + 1
+	return bsize, xlen, nil
+}
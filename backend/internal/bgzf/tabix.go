@@ -0,0 +1,366 @@
+package bgzf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Tabix binning parameters (same scheme as BAI)
+const (
+	tabixMinShift  = 14 // 16 kb leaf bins
+	tabixDepth     = 5
+	tabixPseudoBin = 37450
+)
+
+// Tabix formats (the low 16 bits of the format field)
+const (
+	TabixGeneric = 0
+	TabixSAM     = 1
+	TabixVCF     = 2
+)
+
+// TabixConfig describes how to find coordinates in a tab-delimited file
+type TabixConfig struct {
+	Format int32 // TabixGeneric, TabixSAM or TabixVCF; bit 16 set for 0-based coordinates
+	ColSeq int32 // 1-based column of the sequence name
+	ColBeg int32 // 1-based column of the start position
+	ColEnd int32 // 1-based column of the end position (0 = same as start)
+	Meta   byte  // Comment/header line prefix
+	Skip   int32 // Lines to skip at the start of the file
+}
+
+// VCFTabixConfig is the tabix preset for VCF files
+var VCFTabixConfig = TabixConfig{Format: TabixVCF, ColSeq: 1, ColBeg: 2, ColEnd: 0, Meta: '#'}
+
+// tabixRef is the index for one sequence
+type tabixRef struct {
+	bins   map[uint32][]Chunk
+	linear []uint64 // Smallest virtual offset per 16 kb window
+}
+
+// Tabix is a loaded .tbi index
+type Tabix struct {
+	Config TabixConfig
+	Names  []string
+	refs   []tabixRef
+	byName map[string]int
+}
+
+// LoadTabix reads a .tbi file (a BGZF-compressed binary index)
+func LoadTabix(path string) (*Tabix, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tabix index: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress tabix index: %w", err)
+	}
+	return parseTabix(data)
+}
+
+// parseTabix decodes an uncompressed tabix index
+func parseTabix(data []byte) (*Tabix, error) {
+	r := bytes.NewReader(data)
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil || string(magic[:]) != "TBI\x01" {
+		return nil, fmt.Errorf("not a tabix index")
+	}
+
+	var header struct {
+		NRef   int32
+		Format int32
+		ColSeq int32
+		ColBeg int32
+		ColEnd int32
+		Meta   int32
+		Skip   int32
+		LNames int32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read tabix header: %w", err)
+	}
+	if header.NRef < 0 || header.LNames < 0 || int(header.LNames) > r.Len() {
+		return nil, fmt.Errorf("corrupt tabix header")
+	}
+
+	t := &Tabix{
+		Config: TabixConfig{
+			Format: header.Format,
+			ColSeq: header.ColSeq,
+			ColBeg: header.ColBeg,
+			ColEnd: header.ColEnd,
+			Meta:   byte(header.Meta),
+			Skip:   header.Skip,
+		},
+		byName: make(map[string]int),
+	}
+
+	names := make([]byte, header.LNames)
+	io.ReadFull(r, names)
+	for _, name := range bytes.Split(bytes.TrimRight(names, "\x00"), []byte{0}) {
+		t.byName[string(name)] = len(t.Names)
+		t.Names = append(t.Names, string(name))
+	}
+	if len(t.Names) != int(header.NRef) {
+		return nil, fmt.Errorf("tabix index lists %d names for %d sequences", len(t.Names), header.NRef)
+	}
+
+	var count int32
+	readCount := func(what string) (int, error) {
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return 0, fmt.Errorf("truncated tabix index reading %s count: %w", what, err)
+		}
+		if count < 0 || int(count) > r.Len() {
+			return 0, fmt.Errorf("invalid tabix %s count %d", what, count)
+		}
+		return int(count), nil
+	}
+
+	for i := 0; i < int(header.NRef); i++ {
+		ref := tabixRef{bins: make(map[uint32][]Chunk)}
+
+		nBin, err := readCount("bin")
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < nBin; j++ {
+			var bin uint32
+			if err := binary.Read(r, binary.LittleEndian, &bin); err != nil {
+				return nil, fmt.Errorf("truncated tabix bin: %w", err)
+			}
+			nChunk, err := readCount("chunk")
+			if err != nil {
+				return nil, err
+			}
+			chunks := make([]Chunk, nChunk)
+			if err := binary.Read(r, binary.LittleEndian, chunks); err != nil {
+				return nil, fmt.Errorf("truncated tabix chunks: %w", err)
+			}
+			if bin == tabixPseudoBin {
+				continue // Record counts, not chunks
+			}
+			ref.bins[bin] = chunks
+		}
+
+		nIntv, err := readCount("interval")
+		if err != nil {
+			return nil, err
+		}
+		ref.linear = make([]uint64, nIntv)
+		if err := binary.Read(r, binary.LittleEndian, ref.linear); err != nil {
+			return nil, fmt.Errorf("truncated tabix linear index: %w", err)
+		}
+
+		t.refs = append(t.refs, ref)
+	}
+
+	return t, nil
+}
+
+// HasSequence reports whether the index covers a sequence name
+func (t *Tabix) HasSequence(seq string) bool {
+	_, ok := t.byName[seq]
+	return ok
+}
+
+// Chunks returns the merged, sorted chunks that may hold records on seq
+// overlapping the 0-based half-open interval [beg, end)
+func (t *Tabix) Chunks(seq string, beg, end int64) []Chunk {
+	i, ok := t.byName[seq]
+	if !ok {
+		return nil
+	}
+	if beg < 0 {
+		beg = 0
+	}
+	ref := t.refs[i]
+
+	// Records starting before this offset cannot reach beg
+	var minOffset uint64
+	window := int(beg >> tabixMinShift)
+	if window < len(ref.linear) {
+		minOffset = ref.linear[window]
+	} else if len(ref.linear) > 0 {
+		minOffset = ref.linear[len(ref.linear)-1]
+	}
+
+	var chunks []Chunk
+	for _, bin := range RegionToBins(beg, end, tabixMinShift, tabixDepth) {
+		for _, chunk := range ref.bins[bin] {
+			if chunk.End > minOffset {
+				chunks = append(chunks, chunk)
+			}
+		}
+	}
+	return MergeChunks(chunks)
+}
+
+// Write writes the index in .tbi format (BGZF-compressed)
+func (t *Tabix) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("TBI\x01")
+
+	var names bytes.Buffer
+	for _, name := range t.Names {
+		names.WriteString(name)
+		names.WriteByte(0)
+	}
+	header := []int32{
+		int32(len(t.Names)), t.Config.Format, t.Config.ColSeq, t.Config.ColBeg,
+		t.Config.ColEnd, int32(t.Config.Meta), t.Config.Skip, int32(names.Len()),
+	}
+	binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(names.Bytes())
+
+	for _, ref := range t.refs {
+		bins := make([]uint32, 0, len(ref.bins))
+		for bin := range ref.bins {
+			bins = append(bins, bin)
+		}
+		sort.Slice(bins, func(i, j int) bool { return bins[i] < bins[j] })
+
+		binary.Write(&buf, binary.LittleEndian, int32(len(bins)))
+		for _, bin := range bins {
+			binary.Write(&buf, binary.LittleEndian, bin)
+			binary.Write(&buf, binary.LittleEndian, int32(len(ref.bins[bin])))
+			binary.Write(&buf, binary.LittleEndian, ref.bins[bin])
+		}
+		binary.Write(&buf, binary.LittleEndian, int32(len(ref.linear)))
+		binary.Write(&buf, binary.LittleEndian, ref.linear)
+	}
+
+	bw := NewWriter(w)
+	if _, err := bw.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return bw.Close()
+}
+
+// BuildTabix indexes a coordinate-sorted BGZF file of tab-delimited records
+func BuildTabix(r *Reader, config TabixConfig) (*Tabix, error) {
+	t := &Tabix{Config: config, byName: make(map[string]int)}
+	zeroBased := config.Format&0x10000 != 0
+
+	var current *tabixRef
+	var lastBeg int64
+	lineNum := 0
+
+	for {
+		offset := r.VirtualOffset()
+		line, err := r.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		lineNum++
+		if lineNum <= int(config.Skip) || len(line) == 0 || line[0] == config.Meta {
+			continue
+		}
+
+		seq, beg, end, err := recordInterval(line, config, zeroBased)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		refID, seen := t.byName[seq]
+		if !seen {
+			refID = len(t.Names)
+			t.byName[seq] = refID
+			t.Names = append(t.Names, seq)
+			t.refs = append(t.refs, tabixRef{bins: make(map[uint32][]Chunk)})
+			lastBeg = 0
+		} else if refID != len(t.refs)-1 || beg < lastBeg {
+			return nil, fmt.Errorf("line %d: file is not sorted by position", lineNum)
+		}
+		current = &t.refs[refID]
+		lastBeg = beg
+
+		chunk := Chunk{Begin: offset, End: r.VirtualOffset()}
+		bin := RegionToBin(beg, end, tabixMinShift, tabixDepth)
+		chunks := current.bins[bin]
+		if n := len(chunks); n > 0 && chunks[n-1].End == chunk.Begin {
+			chunks[n-1].End = chunk.End
+		} else {
+			current.bins[bin] = append(chunks, chunk)
+		}
+
+		for w := int(beg >> tabixMinShift); w <= int((end-1)>>tabixMinShift); w++ {
+			for len(current.linear) <= w {
+				current.linear = append(current.linear, 0)
+			}
+			if current.linear[w] == 0 {
+				current.linear[w] = offset
+			}
+		}
+	}
+
+	// Empty windows inherit the next non-empty offset to their left
+	for i := range t.refs {
+		linear := t.refs[i].linear
+		for w := 1; w < len(linear); w++ {
+			if linear[w] == 0 {
+				linear[w] = linear[w-1]
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// recordInterval extracts the sequence and 0-based half-open interval of a record
+func recordInterval(line []byte, config TabixConfig, zeroBased bool) (string, int64, int64, error) {
+	fields := bytes.Split(line, []byte{'\t'})
+	column := func(col int32) ([]byte, error) {
+		if col < 1 || int(col) > len(fields) {
+			return nil, fmt.Errorf("missing column %d", col)
+		}
+		return fields[col-1], nil
+	}
+
+	seq, err := column(config.ColSeq)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	begField, err := column(config.ColBeg)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	beg, err := strconv.ParseInt(string(begField), 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid start %q", begField)
+	}
+	if !zeroBased {
+		beg--
+	}
+	end := beg + 1
+
+	switch {
+	case config.Format&0xffff == TabixVCF:
+		// VCF records span the REF allele
+		if ref, err := column(4); err == nil && len(ref) > 1 {
+			end = beg + int64(len(ref))
+		}
+	case config.ColEnd > 0:
+		endField, err := column(config.ColEnd)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		if end, err = strconv.ParseInt(string(endField), 10, 64); err != nil {
+			return "", 0, 0, fmt.Errorf("invalid end %q", endField)
+		}
+	}
+	if end <= beg {
+		end = beg + 1
+	}
+	return string(seq), beg, end, nil
+}
@@ -0,0 +1,141 @@
+package bgzf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// blockDataSize is the uncompressed payload per block. It is kept below
+// 64 KB (as bgzip does) so that a stored block always fits MaxBlockSize.
+const blockDataSize = 0xff00
+
+// eofMarker is the empty block that terminates every BGZF file
+var eofMarker = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00,
+	0x42, 0x43, 0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00,
+}
+
+// Writer compresses data into BGZF blocks
+type Writer struct {
+	w         io.Writer
+	buf       []byte
+	blockAddr int64 // Compressed offset of the block being filled
+	written   int64 // Uncompressed bytes in completed blocks
+	index     GZI
+	level     int
+	closed    bool
+}
+
+// NewWriter creates a BGZF writer with the default compression level
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:     w,
+		buf:   make([]byte, 0, blockDataSize),
+		level: flate.DefaultCompression,
+	}
+}
+
+// Write buffers p, emitting a block whenever one fills up
+func (bw *Writer) Write(p []byte) (int, error) {
+	if bw.closed {
+		return 0, fmt.Errorf("write to closed BGZF writer")
+	}
+
+	n := 0
+	for len(p) > 0 {
+		space := blockDataSize - len(bw.buf)
+		chunk := p
+		if len(chunk) > space {
+			chunk = chunk[:space]
+		}
+		bw.buf = append(bw.buf, chunk...)
+		p = p[len(chunk):]
+		n += len(chunk)
+
+		if len(bw.buf) == blockDataSize {
+			if err := bw.Flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// VirtualOffset returns the virtual offset at which the next byte will be written
+func (bw *Writer) VirtualOffset() uint64 {
+	return uint64(bw.blockAddr)<<16 | uint64(len(bw.buf))
+}
+
+// Flush writes buffered data as a block, so the next write starts a new one
+func (bw *Writer) Flush() error {
+	if len(bw.buf) == 0 {
+		return nil
+	}
+
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, bw.level)
+	if err != nil {
+		return fmt.Errorf("failed to create deflater: %w", err)
+	}
+	if _, err := fw.Write(bw.buf); err != nil {
+		return fmt.Errorf("failed to deflate BGZF block: %w", err)
+	}
+	if err := fw.Close(); err != nil {
+		return fmt.Errorf("failed to deflate BGZF block: %w", err)
+	}
+
+	// Fall back to a stored block if compression expanded the data
+	if compressed.Len()+HeaderSize+FooterSize > MaxBlockSize {
+		compressed.Reset()
+		fw, _ = flate.NewWriter(&compressed, flate.NoCompression)
+		fw.Write(bw.buf)
+		fw.Close()
+	}
+
+	bsize := HeaderSize + compressed.Len() + FooterSize
+	block := make([]byte, 0, bsize)
+	block = append(block, 0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, 6, 0, 'B', 'C', 2, 0)
+	block = binary.LittleEndian.AppendUint16(block, uint16(bsize-1))
+	block = append(block, compressed.Bytes()...)
+	block = binary.LittleEndian.AppendUint32(block, crc32.ChecksumIEEE(bw.buf))
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(bw.buf)))
+
+	if _, err := bw.w.Write(block); err != nil {
+		return fmt.Errorf("failed to write BGZF block: %w", err)
+	}
+
+	bw.blockAddr += int64(bsize)
+	bw.written += int64(len(bw.buf))
+	bw.index = append(bw.index, GZIEntry{Compressed: bw.blockAddr, Uncompressed: bw.written})
+	bw.buf = bw.buf[:0]
+	return nil
+}
+
+// Index returns the .gzi index of the blocks written so far
+func (bw *Writer) Index() GZI {
+	if len(bw.index) == 0 {
+		return nil
+	}
+	// The last entry points past the final block
+	return append(GZI(nil), bw.index[:len(bw.index)-1]...)
+}
+
+// Close flushes remaining data and writes the EOF marker block
+func (bw *Writer) Close() error {
+	if bw.closed {
+		return nil
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	bw.closed = true
+	if _, err := bw.w.Write(eofMarker); err != nil {
+		return fmt.Errorf("failed to write BGZF EOF marker: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package copynumber
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// BigWig magic numbers (UCSC bbi format)
+const (
+	bigWigMagic    = 0x888FFC26
+	chromTreeMagic = 0x78CA8C91
+	rTreeMagic     = 0x2468ACE0
+)
+
+// BigWig section types
+const (
+	sectionBedGraph     = 1
+	sectionVariableStep = 2
+	sectionFixedStep    = 3
+)
+
+// bigWigFile reads the full-resolution data of a BigWig file
+type bigWigFile struct {
+	r             io.ReaderAt
+	order         binary.ByteOrder
+	chromTree     uint64
+	fullIndex     uint64
+	uncompressBuf uint32
+	chromosomes   map[uint32]string
+}
+
+// dataBlock is one R-tree leaf: a run of (possibly compressed) sections
+type dataBlock struct {
+	offset, size uint64
+}
+
+// ReadBigWig adds the full-resolution values of a BigWig file to a binner
+// and declares its chromosome lengths
+func ReadBigWig(path string, b *Binner) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open BigWig: %w", err)
+	}
+	defer file.Close()
+	return ReadBigWigFrom(file, b)
+}
+
+// ReadBigWigFrom reads BigWig data from r
+func ReadBigWigFrom(r io.ReaderAt, b *Binner) error {
+	bw := &bigWigFile{r: r, chromosomes: make(map[uint32]string)}
+	if err := bw.readHeader(); err != nil {
+		return err
+	}
+
+	lengths := make(map[uint32]uint64)
+	if err := bw.readChromTree(lengths); err != nil {
+		return err
+	}
+	for id, name := range bw.chromosomes {
+		b.SetLength(name, lengths[id])
+	}
+
+	var blocks []dataBlock
+	if err := bw.readIndexNode(bw.fullIndex+48, &blocks); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if err := bw.readBlock(block, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAt reads exactly n bytes at offset
+func (bw *bigWigFile) readAt(offset uint64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := bw.r.ReadAt(buf, int64(offset)); err != nil {
+		return nil, fmt.Errorf("failed to read BigWig at %d: %w", offset, err)
+	}
+	return buf, nil
+}
+
+// readHeader parses the 64-byte common header
+func (bw *bigWigFile) readHeader() error {
+	header, err := bw.readAt(0, 64)
+	if err != nil {
+		return err
+	}
+	switch {
+	case binary.LittleEndian.Uint32(header) == bigWigMagic:
+		bw.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == bigWigMagic:
+		bw.order = binary.BigEndian
+	default:
+		return fmt.Errorf("not a BigWig file")
+	}
+
+	bw.chromTree = bw.order.Uint64(header[8:])
+	bw.fullIndex = bw.order.Uint64(header[24:])
+	bw.uncompressBuf = bw.order.Uint32(header[52:])
+
+	index, err := bw.readAt(bw.fullIndex, 4)
+	if err != nil {
+		return err
+	}
+	if bw.order.Uint32(index) != rTreeMagic {
+		return fmt.Errorf("invalid BigWig R-tree index")
+	}
+	return nil
+}
+
+// readChromTree reads the chromosome B+ tree
+func (bw *bigWigFile) readChromTree(lengths map[uint32]uint64) error {
+	header, err := bw.readAt(bw.chromTree, 32)
+	if err != nil {
+		return err
+	}
+	if bw.order.Uint32(header) != chromTreeMagic {
+		return fmt.Errorf("invalid BigWig chromosome tree")
+	}
+	keySize := int(bw.order.Uint32(header[8:]))
+	return bw.readChromNode(bw.chromTree+32, keySize, lengths)
+}
+
+// readChromNode reads one B+ tree node and its children
+func (bw *bigWigFile) readChromNode(offset uint64, keySize int, lengths map[uint32]uint64) error {
+	nodeHeader, err := bw.readAt(offset, 4)
+	if err != nil {
+		return err
+	}
+	isLeaf := nodeHeader[0] == 1
+	count := int(bw.order.Uint16(nodeHeader[2:]))
+
+	itemSize := keySize + 8
+	items, err := bw.readAt(offset+4, count*itemSize)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		item := items[i*itemSize:]
+		if isLeaf {
+			name := string(bytes.TrimRight(item[:keySize], "\x00"))
+			id := bw.order.Uint32(item[keySize:])
+			bw.chromosomes[id] = name
+			lengths[id] = uint64(bw.order.Uint32(item[keySize+4:]))
+			continue
+		}
+		if err := bw.readChromNode(bw.order.Uint64(item[keySize:]), keySize, lengths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIndexNode collects the data blocks under an R-tree node
+func (bw *bigWigFile) readIndexNode(offset uint64, blocks *[]dataBlock) error {
+	nodeHeader, err := bw.readAt(offset, 4)
+	if err != nil {
+		return err
+	}
+	isLeaf := nodeHeader[0] == 1
+	count := int(bw.order.Uint16(nodeHeader[2:]))
+
+	itemSize := 24
+	if isLeaf {
+		itemSize = 32
+	}
+	items, err := bw.readAt(offset+4, count*itemSize)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		item := items[i*itemSize:]
+		if isLeaf {
+			*blocks = append(*blocks, dataBlock{
+				offset: bw.order.Uint64(item[16:]),
+				size:   bw.order.Uint64(item[24:]),
+			})
+			continue
+		}
+		if err := bw.readIndexNode(bw.order.Uint64(item[16:]), blocks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlock decodes the sections of one data block into the binner
+func (bw *bigWigFile) readBlock(block dataBlock, b *Binner) error {
+	data, err := bw.readAt(block.offset, int(block.size))
+	if err != nil {
+		return err
+	}
+	if bw.uncompressBuf > 0 {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to decompress BigWig block: %w", err)
+		}
+		data, err = io.ReadAll(zr)
+		zr.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decompress BigWig block: %w", err)
+		}
+	}
+
+	for len(data) >= 24 {
+		chromosome, ok := bw.chromosomes[bw.order.Uint32(data)]
+		if !ok {
+			return fmt.Errorf("BigWig section references unknown chromosome %d", bw.order.Uint32(data))
+		}
+		start := uint64(bw.order.Uint32(data[4:]))
+		step := uint64(bw.order.Uint32(data[12:]))
+		span := uint64(bw.order.Uint32(data[16:]))
+		kind := data[20]
+		count := int(bw.order.Uint16(data[22:]))
+		data = data[24:]
+
+		var itemSize int
+		switch kind {
+		case sectionBedGraph:
+			itemSize = 12
+		case sectionVariableStep:
+			itemSize = 8
+		case sectionFixedStep:
+			itemSize = 4
+		default:
+			return fmt.Errorf("unknown BigWig section type %d", kind)
+		}
+		if len(data) < count*itemSize {
+			return fmt.Errorf("truncated BigWig section")
+		}
+
+		for i := 0; i < count; i++ {
+			item := data[i*itemSize:]
+			switch kind {
+			case sectionBedGraph:
+				itemStart := uint64(bw.order.Uint32(item))
+				itemEnd := uint64(bw.order.Uint32(item[4:]))
+				b.AddInterval(chromosome, itemStart, itemEnd, bw.value(item[8:]))
+			case sectionVariableStep:
+				itemStart := uint64(bw.order.Uint32(item))
+				b.AddInterval(chromosome, itemStart, itemStart+span, bw.value(item[4:]))
+			case sectionFixedStep:
+				itemStart := start + uint64(i)*step
+				b.AddInterval(chromosome, itemStart, itemStart+span, bw.value(item))
+			}
+		}
+		data = data[count*itemSize:]
+	}
+	return nil
+}
+
+// value decodes a float32 item value
+func (bw *bigWigFile) value(b []byte) float64 {
+	return float64(math.Float32frombits(bw.order.Uint32(b)))
+}
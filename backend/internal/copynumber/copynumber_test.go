@@ -0,0 +1,303 @@
+package copynumber
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"genomevedic/internal/mutations"
+	"genomevedic/internal/reference"
+)
+
+// TestBedGraphBinning checks depth is averaged per base across bins
+func TestBedGraphBinning(t *testing.T) {
+	track := "track type=bedGraph\n" +
+		"chr1\t0\t50\t10\n" +
+		"chr1\t50\t150\t20\n" +
+		"chr2\t0\t100\t5\n"
+	b := NewBinner(100)
+	b.SetLength("chr1", 250)
+	if err := ReadBedGraph(strings.NewReader(track), b); err != nil {
+		t.Fatal(err)
+	}
+
+	bins := b.Bins()
+	want := []struct {
+		chromosome string
+		start, end uint64
+		depth      float64
+	}{
+		{"chr1", 1, 100, 15},
+		{"chr1", 101, 200, 10},
+		{"chr1", 201, 250, 0},
+		{"chr2", 1, 100, 5},
+	}
+	if len(bins) != len(want) {
+		t.Fatalf("got %d bins, want %d", len(bins), len(want))
+	}
+	for i, w := range want {
+		got := bins[i]
+		if got.Chromosome != w.chromosome || got.Start != w.start || got.End != w.end || got.Depth != w.depth {
+			t.Errorf("bin %d = %s:%d-%d depth %v, want %s:%d-%d depth %v",
+				i, got.Chromosome, got.Start, got.End, got.Depth, w.chromosome, w.start, w.end, w.depth)
+		}
+	}
+}
+
+// TestReadBigWig reads a minimal uncompressed BigWig with bedGraph and
+// fixedStep sections
+func TestReadBigWig(t *testing.T) {
+	b := NewBinner(100)
+	if err := ReadBigWigFrom(bytes.NewReader(buildBigWig()), b); err != nil {
+		t.Fatal(err)
+	}
+
+	bins := b.Bins()
+	if len(bins) != 3 {
+		t.Fatalf("got %d bins, want 3", len(bins))
+	}
+	// bedGraph 0-100 = 4; fixedStep 100-160 at 2, step 20 span 20 = 2 over 60 bp
+	if bins[0].Depth != 4 || math.Abs(bins[1].Depth-1.2) > 1e-9 || bins[2].Depth != 0 {
+		t.Errorf("depths = %v, %v, %v; want 4, 1.2, 0", bins[0].Depth, bins[1].Depth, bins[2].Depth)
+	}
+	if bins[2].End != 300 {
+		t.Errorf("last bin ends at %d, want chromosome length 300", bins[2].End)
+	}
+}
+
+// buildBigWig writes a one-chromosome BigWig with a single data block
+func buildBigWig() []byte {
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	put := func(v interface{}) { binary.Write(&buf, le, v) }
+
+	const chromTreeOffset = 64
+	const dataOffset = chromTreeOffset + 32 + 4 + 4 + 8
+
+	// Data block: a bedGraph section then a fixedStep section
+	var data bytes.Buffer
+	section := func(start, end, step, span uint32, kind uint8, count uint16) {
+		binary.Write(&data, le, []uint32{0, start, end, step, span})
+		binary.Write(&data, le, []uint8{kind, 0})
+		binary.Write(&data, le, count)
+	}
+	section(0, 100, 0, 0, sectionBedGraph, 1)
+	binary.Write(&data, le, []uint32{0, 100})
+	binary.Write(&data, le, float32(4))
+	section(100, 160, 20, 20, sectionFixedStep, 3)
+	binary.Write(&data, le, []float32{2, 2, 2})
+	indexOffset := uint64(dataOffset + 8 + data.Len())
+
+	// Header
+	put(uint32(bigWigMagic))
+	put(uint16(4))
+	put(uint16(0))
+	put(uint64(chromTreeOffset))
+	put(uint64(dataOffset))
+	put(indexOffset)
+	put([]uint16{0, 0})
+	put([]uint64{0, 0})
+	put(uint32(0)) // Uncompressed
+	put(uint64(0))
+
+	// Chromosome B+ tree with one leaf item
+	put([]uint32{chromTreeMagic, 1, 4, 8})
+	put([]uint64{1, 0})
+	put([]uint8{1, 0})
+	put(uint16(1))
+	buf.WriteString("chr1")
+	put([]uint32{0, 300})
+
+	// Data section
+	put(uint64(1))
+	blockOffset := uint64(buf.Len())
+	buf.Write(data.Bytes())
+
+	// R-tree index with one leaf
+	put([]uint32{rTreeMagic, 1})
+	put(uint64(1))
+	put([]uint32{0, 0, 0, 160})
+	put(uint64(0))
+	put([]uint32{1, 0})
+	put([]uint8{1, 0})
+	put(uint16(1))
+	put([]uint32{0, 0, 0, 160})
+	put([]uint64{blockOffset, uint64(data.Len())})
+	return buf.Bytes()
+}
+
+// TestSegmentBins recovers an arm loss and a focal amplification
+func TestSegmentBins(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	truth := make([]float64, 300)
+	for i := range truth {
+		switch {
+		case i < 120:
+			truth[i] = 0
+		case i < 200:
+			truth[i] = -1 // One copy lost
+		case i < 210:
+			truth[i] = math.Log2(8.0 / 2) // Focal amplification
+		default:
+			truth[i] = 0
+		}
+	}
+
+	bins := make([]*Bin, len(truth))
+	for i, v := range truth {
+		bins[i] = &Bin{
+			Chromosome: "chr8",
+			Start:      uint64(i)*1000 + 1,
+			End:        uint64(i+1) * 1000,
+			Log2:       v + rng.NormFloat64()*0.15,
+		}
+	}
+	bins[50].Masked = true
+
+	segments := SegmentBins(bins, DefaultSegmentOptions())
+	CallSegments(segments, DefaultCallOptions())
+
+	want := []struct {
+		start, end uint64
+		state      CopyState
+	}{
+		{1, 120000, StateNeutral},
+		{120001, 200000, StateLoss},
+		{200001, 210000, StateAmplification},
+		{210001, 300000, StateNeutral},
+	}
+	if len(segments) != len(want) {
+		for _, s := range segments {
+			t.Logf("%d-%d log2 %.2f %s", s.Start, s.End, s.Log2, s.State)
+		}
+		t.Fatalf("got %d segments, want %d", len(segments), len(want))
+	}
+	for i, w := range want {
+		s := segments[i]
+		if s.Start != w.start || s.End != w.end || s.State != w.state {
+			t.Errorf("segment %d = %d-%d %s, want %d-%d %s", i, s.Start, s.End, s.State, w.start, w.end, w.state)
+		}
+	}
+	if segments[0].Bins != 119 {
+		t.Errorf("first segment has %d bins, want 119 (one masked)", segments[0].Bins)
+	}
+}
+
+// TestCallSegmentsPurity checks copy numbers account for normal contamination
+func TestCallSegmentsPurity(t *testing.T) {
+	// One-copy loss at 50% purity: ratio (0.5×1 + 1) / 2 = 0.75
+	segments := []*Segment{{Log2: math.Log2(0.75)}}
+	CallSegments(segments, CallOptions{Ploidy: 2, Purity: 0.5})
+	if math.Abs(segments[0].CopyNumber-1) > 1e-9 || segments[0].State != StateLoss {
+		t.Errorf("got CN %v %s, want 1 loss", segments[0].CopyNumber, segments[0].State)
+	}
+}
+
+// TestGCCorrect removes a linear GC bias from depth
+func TestGCCorrect(t *testing.T) {
+	const binSize = 100
+	rng := rand.New(rand.NewSource(3))
+
+	var sequence strings.Builder
+	b := NewBinner(binSize)
+	for i := 0; i < 400; i++ {
+		gc := 0.3 + 0.4*rng.Float64()
+		gcBases := 0
+		for j := 0; j < binSize; j++ {
+			switch r := rng.Float64(); {
+			case r < gc/2:
+				sequence.WriteByte('G')
+				gcBases++
+			case r < gc:
+				sequence.WriteByte('C')
+				gcBases++
+			case r < gc+(1-gc)/2:
+				sequence.WriteByte('A')
+			default:
+				sequence.WriteByte('T')
+			}
+		}
+		// Depth doubles from 30% to 70% GC
+		depth := 30 * (1 + 2.5*(float64(gcBases)/binSize-0.3))
+		b.AddInterval("chr1", uint64(i*binSize), uint64((i+1)*binSize), depth)
+	}
+	// A final all-N bin
+	sequence.WriteString(strings.Repeat("N", binSize))
+	b.AddInterval("chr1", 400*binSize, 401*binSize, 30)
+
+	path := filepath.Join(t.TempDir(), "ref.fa")
+	if err := os.WriteFile(path, []byte(">chr1\n"+sequence.String()+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Close()
+
+	bins := b.Bins()
+	if err := GCCorrect(bins, ref); err != nil {
+		t.Fatal(err)
+	}
+	Normalize(bins)
+
+	if !bins[400].Masked {
+		t.Error("all-N bin should be masked")
+	}
+	before, after := spread(bins, func(b *Bin) float64 { return b.Depth }), spread(bins, func(b *Bin) float64 { return b.Corrected })
+	if after > before/4 {
+		t.Errorf("GC correction left depth spread %.3f (was %.3f)", after, before)
+	}
+	for _, bin := range bins[:400] {
+		if math.Abs(bin.Log2) > 0.3 {
+			t.Fatalf("bin %d log2 %.2f after correction", bin.Start, bin.Log2)
+		}
+	}
+}
+
+// spread returns the coefficient of variation over unmasked bins
+func spread(bins []*Bin, value func(*Bin) float64) float64 {
+	var values []float64
+	for _, bin := range bins {
+		if !bin.Masked {
+			values = append(values, value(bin))
+		}
+	}
+	mean := meanOf(values)
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance/float64(len(values))) / mean
+}
+
+// TestOverlay resolves positions across chromosome naming styles
+func TestOverlay(t *testing.T) {
+	segments := []*Segment{
+		{Chromosome: "chr17", Start: 1, End: 1000, Log2: 0},
+		{Chromosome: "chr17", Start: 1001, End: 2000, Log2: -1},
+		{Chromosome: "chr17", Start: 2001, End: 3000, Log2: 1.5},
+	}
+	CallSegments(segments, DefaultCallOptions())
+	overlay := NewOverlay(segments)
+
+	if _, ok := overlay.GetParticleColor("17", 500); ok {
+		t.Error("neutral segment should not be coloured")
+	}
+	if segment := overlay.SegmentAt("17", 1500); segment == nil || segment.State != StateLoss {
+		t.Errorf("SegmentAt(17, 1500) = %v, want loss", segment)
+	}
+	var scheme mutations.ColorScheme = overlay
+	color, ok := scheme.ColorFor(&mutations.Mutation{Chromosome: "17", Position: 2500})
+	if !ok || color.R < color.B {
+		t.Errorf("gain colour = %+v, %v; want reddish", color, ok)
+	}
+	if _, ok := overlay.GetParticleColor("17", 5000); ok {
+		t.Error("position outside segments should not be coloured")
+	}
+}
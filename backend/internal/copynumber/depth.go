@@ -0,0 +1,173 @@
+// Package copynumber infers somatic copy-number changes from read depth.
+//
+// Depth is accumulated into fixed-size bins from bedGraph or BigWig
+// coverage tracks or from aligned reads, corrected for GC bias against the
+// reference, converted to log2 ratios, segmented with circular binary
+// segmentation and called as losses, gains and amplifications:
+//
+//	binner := copynumber.NewBinner(100000)
+//	copynumber.ReadBigWig("tumour.bw", binner)
+//	bins := binner.Bins()
+//	copynumber.GCCorrect(bins, ref)
+//	copynumber.Normalize(bins)
+//	segments := copynumber.SegmentBins(bins, copynumber.DefaultSegmentOptions())
+//	copynumber.CallSegments(segments, copynumber.DefaultCallOptions())
+//	overlay := copynumber.NewOverlay(segments)
+package copynumber
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Bin is one fixed-size genomic window (1-based, inclusive)
+type Bin struct {
+	Chromosome string
+	Start      uint64
+	End        uint64
+	Depth      float64 // Mean per-base depth
+	GC         float64 // Reference GC fraction, NaN until GCCorrect
+	Corrected  float64 // GC-corrected depth
+	Log2       float64 // log2(corrected / genome median), NaN when masked
+	Masked     bool    // Excluded: no coverage or mostly N reference
+}
+
+// Binner accumulates per-base depth into fixed-size bins
+type Binner struct {
+	binSize uint64
+	order   []string
+	sums    map[string][]float64 // Depth × bases per bin
+	lengths map[string]uint64
+}
+
+// NewBinner creates a binner with the given bin size in bp
+func NewBinner(binSize uint64) *Binner {
+	if binSize == 0 {
+		binSize = 100000
+	}
+	return &Binner{
+		binSize: binSize,
+		sums:    make(map[string][]float64),
+		lengths: make(map[string]uint64),
+	}
+}
+
+// BinSize returns the bin size in bp
+func (b *Binner) BinSize() uint64 {
+	return b.binSize
+}
+
+// SetLength declares a chromosome's length so that trailing bins without
+// coverage are still reported
+func (b *Binner) SetLength(chromosome string, length uint64) {
+	b.chromosome(chromosome)
+	b.lengths[chromosome] = max(b.lengths[chromosome], length)
+}
+
+// chromosome returns a chromosome's bin sums, registering it if new
+func (b *Binner) chromosome(name string) []float64 {
+	sums, ok := b.sums[name]
+	if !ok {
+		b.order = append(b.order, name)
+		b.sums[name] = nil
+	}
+	return sums
+}
+
+// AddInterval adds depth value to every base of [start, end) (0-based,
+// half-open, as in bedGraph and BigWig)
+func (b *Binner) AddInterval(chromosome string, start, end uint64, value float64) {
+	if end <= start || value == 0 || math.IsNaN(value) {
+		return
+	}
+	sums := b.chromosome(chromosome)
+	if last := int((end - 1) / b.binSize); last >= len(sums) {
+		sums = append(sums, make([]float64, last+1-len(sums))...)
+	}
+
+	for position := start; position < end; {
+		bin := position / b.binSize
+		binEnd := min((bin+1)*b.binSize, end)
+		sums[bin] += value * float64(binEnd-position)
+		position = binEnd
+	}
+	b.sums[chromosome] = sums
+	b.lengths[chromosome] = max(b.lengths[chromosome], end)
+}
+
+// AddRead adds one aligned read covering [start, end) (0-based, half-open)
+func (b *Binner) AddRead(chromosome string, start, end uint64) {
+	b.AddInterval(chromosome, start, end, 1)
+}
+
+// Bins returns the mean depth of every bin, chromosome by chromosome in the
+// order they were first seen
+func (b *Binner) Bins() []*Bin {
+	var bins []*Bin
+	for _, chromosome := range b.order {
+		sums := b.sums[chromosome]
+		length := b.lengths[chromosome]
+		count := int((length + b.binSize - 1) / b.binSize)
+
+		for i := 0; i < count; i++ {
+			start := uint64(i) * b.binSize
+			end := min(start+b.binSize, length)
+			depth := 0.0
+			if i < len(sums) {
+				depth = sums[i] / float64(end-start)
+			}
+			bins = append(bins, &Bin{
+				Chromosome: chromosome,
+				Start:      start + 1,
+				End:        end,
+				Depth:      depth,
+				GC:         math.NaN(),
+				Corrected:  depth,
+				Log2:       math.NaN(),
+			})
+		}
+	}
+	return bins
+}
+
+// ReadBedGraph adds a bedGraph coverage track (chrom, start, end, value)
+// to a binner
+func ReadBedGraph(r io.Reader, b *Binner) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			return fmt.Errorf("bedGraph line %d: expected 4 columns, got %d", lineNum, len(fields))
+		}
+		start, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bedGraph line %d: invalid start: %w", lineNum, err)
+		}
+		end, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bedGraph line %d: invalid end: %w", lineNum, err)
+		}
+		value, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return fmt.Errorf("bedGraph line %d: invalid value: %w", lineNum, err)
+		}
+		b.AddInterval(fields[0], start, end, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read bedGraph: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package copynumber
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"genomevedic/internal/reference"
+	"genomevedic/internal/vedic"
+)
+
+const (
+	maxNFraction   = 0.5 // Bins with more reference N than this are masked
+	minStratumBins = 20  // Bins needed before a GC stratum median is trusted
+)
+
+// GCCorrect annotates bins with reference GC content and divides out GC
+// bias: each bin's depth is rescaled by the genome median over the median
+// depth of bins with similar GC (the stratum is widened one percentage
+// point at a time until it holds enough bins). Bins without coverage or
+// mostly N in the reference are masked.
+func GCCorrect(bins []*Bin, ref *reference.FASTA) error {
+	var usable []*Bin
+	for _, bin := range bins {
+		// Contigs absent from the reference (decoys, viral) are masked
+		length, ok := ref.Length(bin.Chromosome)
+		if !ok || int64(bin.Start) > length {
+			bin.Masked = true
+			continue
+		}
+		sequence, err := ref.Fetch(bin.Chromosome, int64(bin.Start-1), min(int64(bin.End), length))
+		if err != nil {
+			return fmt.Errorf("failed to fetch GC content for %s:%d-%d: %w", bin.Chromosome, bin.Start, bin.End, err)
+		}
+
+		acgt := strings.ReplaceAll(sequence, "N", "")
+		if len(sequence) == 0 || float64(len(sequence)-len(acgt))/float64(len(sequence)) > maxNFraction {
+			bin.Masked = true
+			continue
+		}
+		bin.GC = vedic.ComputeGCContent(acgt).Percent / 100
+		if bin.Depth <= 0 {
+			bin.Masked = true
+			continue
+		}
+		usable = append(usable, bin)
+	}
+	if len(usable) == 0 {
+		return fmt.Errorf("no bins with coverage and reference sequence")
+	}
+
+	// Depths by whole GC percentage point
+	strata := make([][]float64, 101)
+	all := make([]float64, 0, len(usable))
+	for _, bin := range usable {
+		strata[gcPercent(bin.GC)] = append(strata[gcPercent(bin.GC)], bin.Depth)
+		all = append(all, bin.Depth)
+	}
+	genomeMedian := median(all)
+
+	expected := make([]float64, 101)
+	for percent := range expected {
+		var depths []float64
+		for width := 0; width <= 100 && len(depths) < minStratumBins; width++ {
+			depths = depths[:0]
+			for p := max(percent-width, 0); p <= min(percent+width, 100); p++ {
+				depths = append(depths, strata[p]...)
+			}
+		}
+		expected[percent] = median(depths)
+	}
+
+	for _, bin := range usable {
+		if stratum := expected[gcPercent(bin.GC)]; stratum > 0 {
+			bin.Corrected = bin.Depth * genomeMedian / stratum
+		}
+	}
+	return nil
+}
+
+// gcPercent returns a GC fraction as a whole percentage
+func gcPercent(gc float64) int {
+	return min(max(int(math.Round(gc*100)), 0), 100)
+}
+
+// Normalize sets each bin's log2 ratio against the median corrected depth
+// of unmasked bins, masking bins without coverage
+func Normalize(bins []*Bin) {
+	var depths []float64
+	for _, bin := range bins {
+		if bin.Corrected <= 0 {
+			bin.Masked = true
+		}
+		if !bin.Masked {
+			depths = append(depths, bin.Corrected)
+		}
+	}
+	reference := median(depths)
+
+	for _, bin := range bins {
+		if bin.Masked || reference <= 0 {
+			bin.Log2 = math.NaN()
+			continue
+		}
+		bin.Log2 = math.Log2(bin.Corrected / reference)
+	}
+}
+
+// median returns the median of values (0 when empty)
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
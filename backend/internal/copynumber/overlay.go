@@ -0,0 +1,104 @@
+package copynumber
+
+import (
+	"math"
+	"strings"
+
+	"genomevedic/internal/interval"
+	"genomevedic/internal/mutations"
+)
+
+// Copy-state colours: blues for losses, reds for gains
+var StateColors = map[CopyState]mutations.MutationColor{
+	StateDeepLoss:      {R: 0.0, G: 0.1, B: 0.6, A: 1.0},
+	StateLoss:          {R: 0.3, G: 0.5, B: 1.0, A: 0.8},
+	StateNeutral:       {R: 0.7, G: 0.7, B: 0.7, A: 0.3},
+	StateGain:          {R: 1.0, G: 0.5, B: 0.4, A: 0.8},
+	StateAmplification: {R: 0.8, G: 0.0, B: 0.0, A: 1.0},
+}
+
+// Overlay colours particles by the copy state of the segment they fall in.
+// It also implements mutations.ColorScheme, so a MutationOverlay can colour
+// mutations by local copy number. Safe for concurrent use.
+type Overlay struct {
+	segments []*Segment
+	index    *interval.Index[*Segment]
+}
+
+// NewOverlay indexes called segments
+func NewOverlay(segments []*Segment) *Overlay {
+	index := interval.New[*Segment]()
+	for _, segment := range segments {
+		index.Add(overlayKey(segment.Chromosome), segment.Start, segment.End, segment)
+	}
+	index.Build()
+	return &Overlay{segments: segments, index: index}
+}
+
+// overlayKey makes "chr17" and "17" share index entries
+func overlayKey(chromosome string) string {
+	return strings.TrimPrefix(chromosome, "chr")
+}
+
+// Segments returns the overlay's segments
+func (o *Overlay) Segments() []*Segment {
+	return o.segments
+}
+
+// SegmentAt returns the segment containing a 1-based position, or nil
+func (o *Overlay) SegmentAt(chromosome string, position uint64) *Segment {
+	segments := o.index.At(overlayKey(chromosome), position)
+	if len(segments) == 0 {
+		return nil
+	}
+	return segments[0]
+}
+
+// GetParticleColor returns the copy-state colour of a particle; neutral or
+// unsegmented positions return false
+func (o *Overlay) GetParticleColor(chromosome string, position uint64) (mutations.MutationColor, bool) {
+	segment := o.SegmentAt(chromosome, position)
+	if segment == nil || segment.State == StateNeutral {
+		return mutations.MutationColor{}, false
+	}
+	color := StateColors[segment.State]
+
+	// Stronger changes are more opaque
+	color.A = float32(math.Min(float64(color.A)*(0.6+math.Abs(segment.Log2)), 1))
+	return color, true
+}
+
+// ColorFor colours a mutation by the copy state at its position
+func (o *Overlay) ColorFor(m *mutations.Mutation) (mutations.MutationColor, bool) {
+	return o.GetParticleColor(m.Chromosome, m.Position)
+}
+
+// GetStatistics returns overlay statistics
+func (o *Overlay) GetStatistics() map[string]interface{} {
+	states := make(map[string]int)
+	bases := make(map[string]uint64)
+	for _, segment := range o.segments {
+		states[segment.State.String()]++
+		bases[segment.State.String()] += segment.End - segment.Start + 1
+	}
+
+	// Fraction of the segmented genome altered
+	var total, altered uint64
+	for state, length := range bases {
+		total += length
+		if state != StateNeutral.String() {
+			altered += length
+		}
+	}
+	fraction := 0.0
+	if total > 0 {
+		fraction = float64(altered) / float64(total)
+	}
+
+	return map[string]interface{}{
+		"total_segments":          len(o.segments),
+		"segments_by_state":       states,
+		"bases_by_state":          bases,
+		"fraction_genome_altered": fraction,
+	}
+}
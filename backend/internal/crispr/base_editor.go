@@ -0,0 +1,371 @@
+package crispr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EditorType is the chemistry of a base editor
+type EditorType string
+
+const (
+	CytosineBaseEditor EditorType = "CBE" // C•G to T•A
+	AdenineBaseEditor  EditorType = "ABE" // A•T to G•C
+)
+
+// BaseEditor describes a deaminase fused to a Cas nickase. The editing
+// window is given in protospacer positions counted from the PAM-distal end
+// (position 1), with the PAM at positions 21-23 for SpCas9.
+type BaseEditor struct {
+	Name        string     `json:"name"`
+	Type        EditorType `json:"type"`
+	Enzyme      CasEnzyme  `json:"enzyme"`
+	WindowStart int        `json:"window_start"`
+	WindowEnd   int        `json:"window_end"`
+	Description string     `json:"description"`
+}
+
+// BaseEditors lists the supported editors
+// References: Koblan et al. 2018 (BE4max), Gaudelli et al. 2017 (ABE7.10),
+// Richter et al. 2020 (ABE8e), Komor et al. 2017 (SaBE4)
+var BaseEditors = []BaseEditor{
+	{Name: "BE4max", Type: CytosineBaseEditor, Enzyme: Cas9, WindowStart: 4, WindowEnd: 8, Description: "APOBEC1 cytosine base editor with two UGI domains"},
+	{Name: "ABE7.10", Type: AdenineBaseEditor, Enzyme: Cas9, WindowStart: 4, WindowEnd: 7, Description: "TadA adenine base editor"},
+	{Name: "ABE8e", Type: AdenineBaseEditor, Enzyme: Cas9, WindowStart: 4, WindowEnd: 8, Description: "Evolved TadA-8e adenine base editor (faster, slightly wider)"},
+	{Name: "SaBE4", Type: CytosineBaseEditor, Enzyme: SaCas9, WindowStart: 3, WindowEnd: 12, Description: "BE4 on SaCas9 nickase (NNGRRT PAM, wide window)"},
+}
+
+// BystanderEdit is a predicted unintended conversion inside the editing window
+type BystanderEdit struct {
+	Position            int     `json:"position"`             // Genomic position
+	ProtospacerPosition int     `json:"protospacer_position"` // 1 = PAM-distal
+	RefBase             string  `json:"ref_base"`             // Forward-strand bases
+	AltBase             string  `json:"alt_base"`
+	Probability         float64 `json:"probability"`
+}
+
+// BaseEditGuide is a guide that places the target base inside an editor's
+// window, with the predicted outcome
+type BaseEditGuide struct {
+	Guide             GuideRNA        `json:"guide"`
+	Editor            string          `json:"editor"`
+	EditorType        EditorType      `json:"editor_type"`
+	WindowStart       int             `json:"window_start"`
+	WindowEnd         int             `json:"window_end"`
+	TargetPosition    int             `json:"target_position"` // Protospacer position of the edit
+	Efficiency        float64         `json:"efficiency"`      // Relative editing of the target (0-1)
+	Bystanders        []BystanderEdit `json:"bystanders,omitempty"`
+	Purity            float64         `json:"purity"` // Probability that no bystander is edited
+	EditedProtospacer string          `json:"edited_protospacer"`
+	Score             float64         `json:"score"`
+}
+
+// targetEdit is a requested change in 0-based forward-strand indices of the
+// target sequence: sequence[start:end] (ref) becomes alt
+type targetEdit struct {
+	start int
+	end   int
+	ref   string
+	alt   string
+}
+
+// GetBaseEditor returns a base editor by name (case-insensitive)
+func GetBaseEditor(name string) (BaseEditor, bool) {
+	for _, editor := range BaseEditors {
+		if strings.EqualFold(editor.Name, name) {
+			return editor, true
+		}
+	}
+	return BaseEditor{}, false
+}
+
+// CompatibleWith reports whether the editor's nickase recognises the same
+// PAM and protospacer length as enzyme
+func (e BaseEditor) CompatibleWith(enzyme CasEnzyme) bool {
+	want, have := GetPAMSequence(e.Enzyme), GetPAMSequence(enzyme)
+	return want.IUPAC == have.IUPAC && want.GuideLength == have.GuideLength && have.Orientation == "3prime"
+}
+
+// conversion returns the protospacer-strand base the editor deaminates and
+// the base it becomes after repair
+func (e BaseEditor) conversion() (byte, byte) {
+	if e.Type == AdenineBaseEditor {
+		return 'A', 'G'
+	}
+	return 'C', 'T'
+}
+
+// activity estimates relative editing at a protospacer position: highest at
+// the window centre, half at its edges and a little one base outside. CBEs
+// built on APOBEC1 edit GpC poorly, so a preceding G halves the activity.
+func (e BaseEditor) activity(protospacer string, position int) float64 {
+	var activity float64
+	switch {
+	case position >= e.WindowStart && position <= e.WindowEnd:
+		center := float64(e.WindowStart+e.WindowEnd) / 2
+		half := float64(e.WindowEnd-e.WindowStart) / 2
+		activity = 1
+		if half > 0 {
+			distance := float64(position) - center
+			if distance < 0 {
+				distance = -distance
+			}
+			activity -= 0.5 * distance / half
+		}
+	case position == e.WindowStart-1 || position == e.WindowEnd+1:
+		activity = 0.2
+	default:
+		return 0
+	}
+
+	if e.Type == CytosineBaseEditor && position > 1 && protospacer[position-2] == 'G' {
+		activity *= 0.5
+	}
+	return activity
+}
+
+// resolveEdit checks the requested alleles against the target sequence and
+// trims bases shared by ref and alt
+func resolveEdit(req DesignRequest, sequence string, startPos int) (targetEdit, error) {
+	ref := strings.ToUpper(strings.TrimSpace(req.RefAllele))
+	alt := strings.ToUpper(strings.TrimSpace(req.AltAllele))
+	if ref == "-" {
+		ref = ""
+	}
+	if alt == "-" {
+		alt = ""
+	}
+	if req.AltAllele == "" {
+		return targetEdit{}, fmt.Errorf("alt_allele is required for %s design", req.Mode)
+	}
+	if !isValidDNA(alt) {
+		return targetEdit{}, fmt.Errorf("invalid alt_allele %q", req.AltAllele)
+	}
+
+	start := req.EditPosition - startPos
+	if ref == "" && req.RefAllele == "" && start >= 0 && start < len(sequence) {
+		ref = sequence[start : start+1]
+	}
+	if start < 0 || start+len(ref) > len(sequence) {
+		return targetEdit{}, fmt.Errorf("edit position %d lies outside the target region", req.EditPosition)
+	}
+	if sequence[start:start+len(ref)] != ref {
+		return targetEdit{}, fmt.Errorf("ref_allele %s does not match the reference (%s) at %d", ref, sequence[start:start+len(ref)], req.EditPosition)
+	}
+
+	end := start + len(ref)
+	for len(ref) > 0 && len(alt) > 0 && ref[0] == alt[0] {
+		ref, alt = ref[1:], alt[1:]
+		start++
+	}
+	for len(ref) > 0 && len(alt) > 0 && ref[len(ref)-1] == alt[len(alt)-1] {
+		ref, alt = ref[:len(ref)-1], alt[:len(alt)-1]
+		end--
+	}
+	if ref == "" && alt == "" {
+		return targetEdit{}, fmt.Errorf("ref_allele and alt_allele are identical")
+	}
+
+	return targetEdit{start: start, end: end, ref: ref, alt: alt}, nil
+}
+
+// protospacerIndex returns the 0-based protospacer index (from the
+// PAM-distal end) of a genomic position, or -1 outside the protospacer
+func protospacerIndex(guide GuideRNA, position int) int {
+	offset := position - guide.Position
+	if offset < 0 || offset >= len(guide.Sequence) {
+		return -1
+	}
+	if guide.Strand == "-" {
+		return len(guide.Sequence) - 1 - offset
+	}
+	return offset
+}
+
+// protospacerGenomic returns the genomic position of a protospacer index
+func protospacerGenomic(guide GuideRNA, index int) int {
+	if guide.Strand == "-" {
+		return guide.Position + len(guide.Sequence) - 1 - index
+	}
+	return guide.Position + index
+}
+
+// complementBase returns the Watson-Crick complement of a base
+func complementBase(base byte) byte {
+	switch base {
+	case 'A':
+		return 'T'
+	case 'T':
+		return 'A'
+	case 'G':
+		return 'C'
+	case 'C':
+		return 'G'
+	}
+	return 'N'
+}
+
+// forwardBase converts a protospacer-strand base to the forward strand
+func forwardBase(guide GuideRNA, base byte) string {
+	if guide.Strand == "-" {
+		base = complementBase(base)
+	}
+	return string(base)
+}
+
+// baseEditors returns the editors usable with this designer's enzyme that
+// perform the given conversion, optionally restricted to one by name
+func (d *Designer) baseEditors(name string, ref, alt byte) ([]BaseEditor, error) {
+	var editors []BaseEditor
+	for _, editor := range BaseEditors {
+		if name != "" && !strings.EqualFold(editor.Name, name) {
+			continue
+		}
+		if !editor.CompatibleWith(d.chopchop.enzyme) {
+			continue
+		}
+		from, to := editor.conversion()
+		if (ref == from && alt == to) || (ref == complementBase(from) && alt == complementBase(to)) {
+			editors = append(editors, editor)
+		}
+	}
+
+	if len(editors) == 0 {
+		if name != "" {
+			if _, ok := GetBaseEditor(name); !ok {
+				return nil, fmt.Errorf("unknown base editor %q", name)
+			}
+		}
+		return nil, fmt.Errorf("no %s base editor installs %c>%c; CBEs make C>T (G>A) and ABEs A>G (T>C), use prime_edit for other changes", d.chopchop.enzyme, ref, alt)
+	}
+	return editors, nil
+}
+
+// designBaseEdits finds guides whose editing window covers the target base
+// and predicts bystander edits. Quality filters are not applied: the window
+// leaves few candidates, so their scores are reported instead.
+func (d *Designer) designBaseEdits(req DesignRequest, sequence, chromosome string, startPos int, startTime time.Time) (*DesignResponse, error) {
+	sequence = strings.ToUpper(sequence)
+	edit, err := resolveEdit(req, sequence, startPos)
+	if err != nil {
+		return nil, err
+	}
+	if len(edit.ref) != 1 || len(edit.alt) != 1 {
+		return nil, fmt.Errorf("base editors install single-base substitutions; use prime_edit for %q>%q", edit.ref, edit.alt)
+	}
+
+	editors, err := d.baseEditors(req.BaseEditor, edit.ref[0], edit.alt[0])
+	if err != nil {
+		return nil, err
+	}
+
+	guides, err := d.chopchop.FindGuides(sequence, chromosome, startPos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find guides: %w", err)
+	}
+
+	target := startPos + edit.start
+	var candidates []GuideRNA
+	for _, guide := range guides {
+		if protospacerIndex(guide, target) >= 0 {
+			candidates = append(candidates, guide)
+		}
+	}
+	scorer, err := d.onTargetScorer(req.ScoringModel)
+	if err != nil {
+		return nil, err
+	}
+	candidates = d.scoreGuides(candidates, sequence, startPos, scorer)
+	candidates = d.findOffTargets(candidates, req.MaxBulges)
+	candidates = d.rankGuides(candidates)
+
+	var designs []BaseEditGuide
+	for _, guide := range candidates {
+		index := protospacerIndex(guide, target)
+		for _, editor := range editors {
+			from, to := editor.conversion()
+			if guide.Sequence[index] != from {
+				continue // The target base is on the other strand
+			}
+			efficiency := editor.activity(guide.Sequence, index+1)
+			if efficiency == 0 {
+				continue
+			}
+
+			design := BaseEditGuide{
+				Guide:          guide,
+				Editor:         editor.Name,
+				EditorType:     editor.Type,
+				WindowStart:    editor.WindowStart,
+				WindowEnd:      editor.WindowEnd,
+				TargetPosition: index + 1,
+				Efficiency:     efficiency,
+				Purity:         1,
+			}
+			design.Guide.ID = fmt.Sprintf("%s_%s", guide.ID, editor.Name)
+
+			edited := []byte(guide.Sequence)
+			edited[index] = to
+			design.EditedProtospacer = string(edited)
+
+			for i := range guide.Sequence {
+				if i == index || guide.Sequence[i] != from {
+					continue
+				}
+				probability := editor.activity(guide.Sequence, i+1)
+				if probability == 0 {
+					continue
+				}
+				design.Bystanders = append(design.Bystanders, BystanderEdit{
+					Position:            protospacerGenomic(guide, i),
+					ProtospacerPosition: i + 1,
+					RefBase:             forwardBase(guide, from),
+					AltBase:             forwardBase(guide, to),
+					Probability:         probability,
+				})
+				design.Purity *= 1 - probability
+			}
+			sort.Slice(design.Bystanders, func(i, j int) bool {
+				return design.Bystanders[i].Position < design.Bystanders[j].Position
+			})
+
+			// Composite score: clean on-target editing first, then specificity
+			// and predicted binding
+			design.Score = design.Efficiency*design.Purity*0.5 +
+				(guide.OffTargetScore/100.0)*0.3 + guide.DoenchScore*0.2
+
+			designs = append(designs, design)
+		}
+	}
+
+	sort.SliceStable(designs, func(i, j int) bool {
+		return designs[i].Score > designs[j].Score
+	})
+
+	maxGuides := req.MaxGuides
+	if maxGuides == 0 {
+		maxGuides = 10
+	}
+	if len(designs) > maxGuides {
+		designs = designs[:maxGuides]
+	}
+
+	response := &DesignResponse{
+		BaseEdits:      designs,
+		TotalFound:     len(designs),
+		Region:         fmt.Sprintf("%s:%d-%d", chromosome, startPos, startPos+len(sequence)),
+		ProcessingTime: float64(time.Since(startTime).Milliseconds()),
+	}
+
+	if len(designs) == 0 {
+		response.Warnings = append(response.Warnings,
+			fmt.Sprintf("No %s guide places position %d inside a base editor window. Try prime_edit or a PAM-relaxed enzyme.", d.chopchop.enzyme, target))
+	} else if best := designs[0]; best.Purity < 0.5 {
+		response.Warnings = append(response.Warnings,
+			fmt.Sprintf("Top design edits %d bystander base(s) with %.0f%% probability; check they are silent in the reading frame", len(best.Bystanders), (1-best.Purity)*100))
+	}
+
+	return response, nil
+}
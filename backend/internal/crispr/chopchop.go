@@ -43,8 +43,16 @@ func (d *CHOPCHOPDesigner) findPAMSites(sequence, chromosome string, startPos in
 	// Convert PAM pattern to regex
 	pamRegex := regexp.MustCompile(d.pam.Pattern)
 
-	// Find all PAM sites
-	matches := pamRegex.FindAllStringIndex(sequence, -1)
+	// Find all PAM sites, including overlapping ones (e.g., AGG and GGG in AGGG)
+	var matches [][]int
+	for i := 0; i < len(sequence); {
+		match := pamRegex.FindStringIndex(sequence[i:])
+		if match == nil {
+			break
+		}
+		matches = append(matches, []int{i + match[0], i + match[1]})
+		i += match[0] + 1
+	}
 
 	for _, match := range matches {
 		pamStart := match[0]
@@ -3,24 +3,100 @@ package crispr
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"time"
+
+	"genomevedic/internal/annotations"
+	"genomevedic/internal/reference"
 )
 
+// maxTargetRegion caps the size of a coordinate target region, and the
+// combined length of a gene's targeted exons (bp)
+const maxTargetRegion = 100000
+
+// maxGeneSpan caps the genomic span fetched for a gene-name request (bp),
+// enough for the largest human genes
+const maxGeneSpan = 2500000
+
+// maxReportedOffTargets caps the off-target sites kept on each guide
+const maxReportedOffTargets = 20
+
+// maxOffTargetBulges caps DesignRequest.MaxBulges; the search space grows
+// steeply with each bulge
+const maxOffTargetBulges = 2
+
+// editFlank is the sequence fetched either side of an edit site (bp), enough
+// for PE3 nicking guides up to 100 bp from the pegRNA nick
+const editFlank = 150
+
+// guideFlank is the sequence fetched beyond the furthest allowed cut site
+// (bp), enough for the longest protospacer and PAM
+const guideFlank = 40
+
 // Designer is the main CRISPR guide RNA designer
-// Integrates CHOPCHOP, Doench scoring, and off-target prediction
+// Integrates CHOPCHOP, on-target scoring, and off-target prediction
 type Designer struct {
 	chopchop      *CHOPCHOPDesigner
-	doenchScorer  *DoenchScorer
+	scorers       map[string]OnTargetScorer // On-target models by name
 	offTargetPred *OffTargetPredictor
+	reference     *reference.FASTA       // Reference genome for coordinate/gene requests
+	genes         *annotations.GTFParser // Gene annotations for gene-name requests
+	populationVCF string                 // Default VCF for variant-aware requests
 }
 
 // NewDesigner creates a new CRISPR designer
 func NewDesigner(enzyme CasEnzyme) *Designer {
-	return &Designer{
+	d := &Designer{
 		chopchop:      NewCHOPCHOPDesigner(enzyme),
-		doenchScorer:  NewDoenchScorer(),
+		scorers:       make(map[string]OnTargetScorer),
 		offTargetPred: NewOffTargetPredictor(3), // Allow up to 3 mismatches
 	}
+	for _, scorer := range builtinScorers() {
+		d.RegisterScorer(scorer)
+	}
+	return d
+}
+
+// RegisterScorer adds an on-target model, selectable by name in requests
+func (d *Designer) RegisterScorer(scorer OnTargetScorer) {
+	d.scorers[scorer.Name()] = scorer
+}
+
+// onTargetScorer returns the named on-target model, or the enzyme's
+// default when name is empty
+func (d *Designer) onTargetScorer(name string) (OnTargetScorer, error) {
+	if name == "" {
+		name = DefaultScoringModel(d.chopchop.enzyme)
+	}
+	scorer, ok := d.scorers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scoring model %q", name)
+	}
+	if !scorer.Supports(d.chopchop.enzyme) {
+		return nil, fmt.Errorf("scoring model %s does not support %s", name, d.chopchop.enzyme)
+	}
+	return scorer, nil
+}
+
+// SetGenomeIndex sets the genome searched for off-target sites
+func (d *Designer) SetGenomeIndex(index *GenomeIndex) {
+	d.offTargetPred.UseGenomeIndex(index)
+}
+
+// SetReference sets the reference genome used to fetch target regions
+func (d *Designer) SetReference(ref *reference.FASTA) {
+	d.reference = ref
+}
+
+// SetAnnotations sets the gene annotations used to resolve gene names
+func (d *Designer) SetAnnotations(genes *annotations.GTFParser) {
+	d.genes = genes
+}
+
+// SetPopulationVCF sets the VCF used by variant-aware requests that name
+// none, typically population frequencies such as gnomAD
+func (d *Designer) SetPopulationVCF(path string) {
+	d.populationVCF = path
 }
 
 // Design designs CRISPR guides for a given request
@@ -33,25 +109,51 @@ func (d *Designer) Design(req DesignRequest) (*DesignResponse, error) {
 	}
 
 	// Get target sequence
-	sequence, chromosome, startPos, err := d.getTargetSequence(req)
+	sequence, chromosome, startPos, exons, err := d.getTargetSequence(req)
 	if err != nil {
 		return nil, err
 	}
 
+	switch req.Mode {
+	case ModeBaseEdit:
+		return d.designBaseEdits(req, sequence, chromosome, startPos, startTime)
+	case ModePrimeEdit:
+		return d.designPrimeEdits(req, sequence, chromosome, startPos, startTime)
+	case ModePairedDeletion:
+		return d.designPairedDeletion(req, sequence, chromosome, startPos, startTime)
+	case ModeKnockIn:
+		return d.designKnockIn(req, sequence, chromosome, startPos, startTime)
+	}
+
 	// Find all potential guides using CHOPCHOP
 	guides, err := d.chopchop.FindGuides(sequence, chromosome, startPos)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find guides: %w", err)
 	}
 
+	// Gene-name requests fetch the whole gene but only target its exons
+	if exons != nil {
+		guides = d.exonGuides(guides, req.GeneName, exons)
+	}
+
 	// Apply quality filters
 	guides = d.chopchop.FilterGuides(guides, req)
 
-	// Score guides with Doench 2016
-	guides = d.scoreGuides(guides, sequence, startPos)
+	// Score on-target efficiency with the requested model
+	scorer, err := d.onTargetScorer(req.ScoringModel)
+	if err != nil {
+		return nil, err
+	}
+	guides = d.scoreGuides(guides, sequence, startPos, scorer)
+
+	// Flag or exclude guides overlapping known variants
+	guides, variantWarnings, err := d.applyVariants(req, guides, sequence, chromosome, startPos, scorer)
+	if err != nil {
+		return nil, err
+	}
 
 	// Find off-targets
-	guides = d.findOffTargets(guides)
+	guides = d.findOffTargets(guides, req.MaxBulges)
 
 	// Calculate final rank scores
 	guides = d.rankGuides(guides)
@@ -83,15 +185,41 @@ func (d *Designer) Design(req DesignRequest) (*DesignResponse, error) {
 	}
 
 	// Add warnings
-	response.Warnings = d.generateWarnings(guides, req)
+	response.Warnings = append(d.generateWarnings(guides, req), variantWarnings...)
 
 	return response, nil
 }
 
 // validateRequest validates the design request
 func (d *Designer) validateRequest(req DesignRequest) error {
+	switch req.Mode {
+	case "", ModeNuclease:
+	case ModeBaseEdit, ModePrimeEdit:
+		if req.AltAllele == "" {
+			return fmt.Errorf("%s design requires alt_allele", req.Mode)
+		}
+	case ModePairedDeletion:
+		if req.DeletionEnd < req.DeletionStart {
+			return fmt.Errorf("deletion_end %d precedes deletion_start %d", req.DeletionEnd, req.DeletionStart)
+		}
+	case ModeKnockIn:
+		if req.InsertSequence == "" {
+			return fmt.Errorf("knock_in design requires insert_sequence")
+		}
+		if !isValidDNA(strings.ToUpper(req.InsertSequence)) {
+			return fmt.Errorf("insert_sequence must contain only A, C, G and T")
+		}
+		if err := req.Donor.withDefaults().validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown design mode %q", req.Mode)
+	}
+
 	// Must specify either gene name or coordinates or sequence
-	if req.GeneName == "" && req.Sequence == "" && (req.Chromosome == "" || req.Start == 0 || req.End == 0) {
+	_, _, hasSite := siteRegion(req)
+	hasEditSite := hasSite && req.Chromosome != ""
+	if req.GeneName == "" && req.Sequence == "" && !hasEditSite && (req.Chromosome == "" || req.Start == 0 || req.End == 0) {
 		return fmt.Errorf("must specify gene_name, coordinates (chromosome/start/end), or sequence")
 	}
 
@@ -100,74 +228,282 @@ func (d *Designer) validateRequest(req DesignRequest) error {
 		return fmt.Errorf("must specify enzyme (e.g., SpCas9)")
 	}
 
+	if _, err := d.onTargetScorer(req.ScoringModel); err != nil {
+		return err
+	}
+
+	if req.MaxBulges < 0 || req.MaxBulges > maxOffTargetBulges {
+		return fmt.Errorf("max_bulges must be between 0 and %d", maxOffTargetBulges)
+	}
+
+	if req.Variants != nil {
+		if req.Mode == ModeBaseEdit || req.Mode == ModePrimeEdit {
+			return fmt.Errorf("variant-aware design is not supported in %s mode", req.Mode)
+		}
+		if req.Variants.AlleleSpecific && req.Mode == ModeKnockIn {
+			return fmt.Errorf("allele-specific guides are not supported in knock_in mode")
+		}
+		options := req.Variants.withDefaults()
+		if options.VCF == "" && d.populationVCF == "" {
+			return fmt.Errorf("variant-aware design requires an inline vcf; no population VCF is configured")
+		}
+		if err := options.validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// getTargetSequence retrieves the target sequence
-func (d *Designer) getTargetSequence(req DesignRequest) (string, string, int, error) {
+// getTargetSequence retrieves the target sequence. For gene-name requests
+// it also returns the exons to target; otherwise exons is nil.
+func (d *Designer) getTargetSequence(req DesignRequest) (sequence, chromosome string, startPos int, exons []geneExon, err error) {
 	// If sequence provided directly
 	if req.Sequence != "" {
-		return req.Sequence, "custom", 0, nil
+		return req.Sequence, "custom", 0, nil, nil
 	}
 
-	// If coordinates provided
+	// If coordinates provided (1-based, inclusive)
 	if req.Chromosome != "" && req.Start > 0 && req.End > 0 {
-		// In production, would fetch from genome database
-		// For now, return placeholder
-		return "PLACEHOLDER_SEQUENCE", req.Chromosome, req.Start, nil
+		sequence, chromosome, startPos, err = d.fetchRegion(req.Chromosome, req.Start, req.End, maxTargetRegion)
+		return sequence, chromosome, startPos, nil, err
+	}
+
+	// If only an edit site provided, fetch the sequence around it
+	if start, end, ok := siteRegion(req); ok && req.Chromosome != "" {
+		sequence, chromosome, startPos, err = d.fetchRegion(req.Chromosome, max(1, start), end, maxTargetRegion)
+		return sequence, chromosome, startPos, nil, err
 	}
 
-	// If gene name provided
+	// If gene name provided, fetch the gene and limit design to its exons
 	if req.GeneName != "" {
-		// In production, would look up gene coordinates and fetch sequence
-		// For now, return placeholder
-		return "PLACEHOLDER_SEQUENCE", "chr17", 7676154, nil
+		chromosome, start, end, exons, err := d.resolveGene(req.GeneName)
+		if err != nil {
+			return "", "", 0, nil, err
+		}
+		sequence, chromosome, startPos, err = d.fetchRegion(chromosome, start, end, maxGeneSpan)
+		return sequence, chromosome, startPos, exons, err
 	}
 
-	return "", "", 0, fmt.Errorf("could not determine target sequence")
+	return "", "", 0, nil, fmt.Errorf("could not determine target sequence")
 }
 
-// scoreGuides scores guides with Doench 2016
-func (d *Designer) scoreGuides(guides []GuideRNA, fullSeq string, seqStart int) []GuideRNA {
+// siteRegion returns the region around an editing mode's target site, used
+// when no explicit coordinates are given
+func siteRegion(req DesignRequest) (int, int, bool) {
+	switch req.Mode {
+	case ModeBaseEdit, ModePrimeEdit:
+		return req.EditPosition - editFlank, req.EditPosition + editFlank, req.EditPosition > 0
+	case ModeKnockIn:
+		options := req.Donor.withDefaults()
+		flank := options.HomologyArm + options.MaxCutDistance + guideFlank
+		return req.EditPosition - flank, req.EditPosition + flank, req.EditPosition > 0
+	case ModePairedDeletion:
+		flank := pairedCutOffset(req) + guideFlank
+		return req.DeletionStart - flank, req.DeletionEnd + flank, req.DeletionStart > 0
+	}
+	return 0, 0, false
+}
+
+// fetchRegion fetches a 1-based inclusive region of at most limit bp from
+// the reference genome
+func (d *Designer) fetchRegion(chromosome string, start, end, limit int) (string, string, int, error) {
+	if d.reference == nil {
+		return "", "", 0, fmt.Errorf("no reference genome configured; provide the target sequence directly")
+	}
+	if end < start {
+		return "", "", 0, fmt.Errorf("invalid region %s:%d-%d", chromosome, start, end)
+	}
+	if end-start+1 > limit {
+		return "", "", 0, fmt.Errorf("target region %s:%d-%d is %d bp; maximum is %d bp", chromosome, start, end, end-start+1, limit)
+	}
+
+	sequence, err := d.reference.Fetch(chromosome, int64(start-1), int64(end))
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to fetch target sequence: %w", err)
+	}
+
+	return sequence, chromosome, start, nil
+}
+
+// geneExon is an exon targeted by a gene-name request, in 1-based
+// inclusive genomic coordinates
+type geneExon struct {
+	number     int // 1-based, in transcription order
+	start, end int
+}
+
+// resolveGene looks up a gene's 1-based inclusive span in the annotations,
+// with the exons to target: the merged CDS of its transcripts, or their
+// exons for non-coding genes. The combined exon length is capped at
+// maxTargetRegion. Genes annotated without exons are targeted whole.
+func (d *Designer) resolveGene(name string) (string, int, int, []geneExon, error) {
+	if d.genes == nil {
+		return "", 0, 0, nil, fmt.Errorf("no gene annotations configured; specify coordinates or sequence")
+	}
+
+	features := d.genes.GetGeneByName(name)
+	if len(features) == 0 {
+		features = d.genes.GetGeneByName(strings.ToUpper(name))
+	}
+	if len(features) == 0 {
+		return "", 0, 0, nil, fmt.Errorf("gene %q not found in annotations", name)
+	}
+
+	// Prefer a copy on a chromosome present in the reference (skips alt contigs)
+	gene := features[0]
+	if d.reference != nil {
+		for _, feature := range features {
+			if _, ok := d.reference.ResolveName(feature.Chromosome); ok {
+				gene = feature
+				break
+			}
+		}
+	}
+
+	// Annotation coordinates are 0-based inclusive
+	start, end := int(gene.Start)+1, int(gene.End)+1
+	exons := d.geneExons(gene)
+	if exons == nil {
+		if end-start+1 > maxTargetRegion {
+			return "", 0, 0, nil, fmt.Errorf("gene %s spans %d bp without annotated exons; maximum is %d bp", name, end-start+1, maxTargetRegion)
+		}
+		return gene.Chromosome, start, end, nil, nil
+	}
+
+	exonic := 0
+	for _, exon := range exons {
+		exonic += exon.end - exon.start + 1
+	}
+	if exonic > maxTargetRegion {
+		return "", 0, 0, nil, fmt.Errorf("gene %s has %d bp of exons; maximum is %d bp", name, exonic, maxTargetRegion)
+	}
+	return gene.Chromosome, start, end, exons, nil
+}
+
+// geneExons merges the CDS (or, failing that, exon) features of a gene
+// into the exons to target, or returns nil if it has neither
+func (d *Designer) geneExons(gene *annotations.GenomicFeature) []geneExon {
+	features := d.genes.GetFeaturesInRange(gene.Chromosome, gene.Start, gene.End)
+	for _, featureType := range []annotations.FeatureType{annotations.FeatureCDS, annotations.FeatureExon} {
+		var exons []geneExon
+		for _, feature := range features {
+			sameGene := feature.GeneID == gene.GeneID
+			if gene.GeneID == "" {
+				sameGene = feature.GeneName == gene.GeneName
+			}
+			if feature.Type != featureType || !sameGene {
+				continue
+			}
+			start, end := int(feature.Start)+1, int(feature.End)+1
+			if last := len(exons) - 1; last >= 0 && start <= exons[last].end+1 {
+				exons[last].end = max(exons[last].end, end)
+				continue
+			}
+			exons = append(exons, geneExon{start: start, end: end})
+		}
+		if len(exons) == 0 {
+			continue
+		}
+
+		for i := range exons {
+			exons[i].number = i + 1
+			if gene.Strand == "-" {
+				exons[i].number = len(exons) - i
+			}
+		}
+		return exons
+	}
+	return nil
+}
+
+// exonGuides keeps the guides that cut inside an exon, recording the gene
+// and exon number on each
+func (d *Designer) exonGuides(guides []GuideRNA, geneName string, exons []geneExon) []GuideRNA {
+	kept := guides[:0]
+	for _, guide := range guides {
+		site := cutSite(guide, d.chopchop.pam)
+		i := sort.Search(len(exons), func(i int) bool { return exons[i].end >= site })
+		if i == len(exons) || site <= exons[i].start {
+			continue
+		}
+		guide.GeneName = geneName
+		guide.Exon = exons[i].number
+		kept = append(kept, guide)
+	}
+	return kept
+}
+
+// scoreGuides scores on-target efficiency with the given model, recording
+// the model on each guide
+func (d *Designer) scoreGuides(guides []GuideRNA, fullSeq string, seqStart int, scorer OnTargetScorer) []GuideRNA {
+	upstream, downstream := scorer.Flanks()
 	for i := range guides {
 		guide := &guides[i]
 
-		// Get 30bp context (4bp upstream + 20bp guide + 3bp PAM + 3bp downstream)
-		context := d.getContext(guide, fullSeq, seqStart)
+		// Get the model's context (30bp for Doench: 4bp upstream + 20bp guide + 3bp PAM + 3bp downstream)
+		context := d.getContext(guide, fullSeq, seqStart, upstream, downstream)
 
-		// Calculate Doench score
-		guide.DoenchScore = d.doenchScorer.Score(*guide, context)
+		guide.DoenchScore = scorer.Score(*guide, context)
+		guide.ScoringModel = scorer.Name()
 	}
 
 	return guides
 }
 
-// getContext gets 30bp context around guide for Doench scoring
-func (d *Designer) getContext(guide *GuideRNA, fullSeq string, seqStart int) string {
-	// Calculate position in sequence
-	relPos := guide.Position - seqStart
-
-	contextStart := relPos - 4
-	contextEnd := relPos + guide.PAMSequence + 3
+// getContext gets the scoring context of a guide on its own strand: the
+// target site (protospacer and PAM) with upstream bases 5' and downstream
+// bases 3' of it. Bases beyond the sequence are N.
+func (d *Designer) getContext(guide *GuideRNA, fullSeq string, seqStart, upstream, downstream int) string {
+	n := len(fullSeq)
+	siteStart := guideStart(*guide, n, seqStart)
+	if d.chopchop.pam.Orientation == "5prime" {
+		siteStart -= len(guide.PAMSequence)
+	}
+	from := siteStart - upstream
+	to := siteStart + len(guide.Sequence) + len(guide.PAMSequence) + downstream
 
-	if contextStart < 0 || contextEnd > len(fullSeq) {
-		return "" // Not enough context
+	if guide.Strand == "-" {
+		return reverseComplement(paddedSlice(fullSeq, n-to, n-from))
 	}
+	return paddedSlice(fullSeq, from, to)
+}
 
-	return fullSeq[contextStart:contextEnd]
+// paddedSlice returns seq[from:to] in upper case, padding with N outside
+// the sequence
+func paddedSlice(seq string, from, to int) string {
+	var b strings.Builder
+	for i := from; i < to; i++ {
+		if i < 0 || i >= len(seq) {
+			b.WriteByte('N')
+		} else {
+			b.WriteByte(seq[i])
+		}
+	}
+	return strings.ToUpper(b.String())
 }
 
-// findOffTargets finds off-targets for all guides
-func (d *Designer) findOffTargets(guides []GuideRNA) []GuideRNA {
+// findOffTargets finds off-targets for all guides, allowing up to bulges
+// DNA and RNA bulges each
+func (d *Designer) findOffTargets(guides []GuideRNA, bulges int) []GuideRNA {
 	for i := range guides {
 		guide := &guides[i]
 
 		// Find off-targets
-		offTargets := d.offTargetPred.FindOffTargets(*guide)
+		offTargets := d.offTargetPred.FindBulgedOffTargets(*guide, bulges, bulges)
 		guide.OffTargetCount = len(offTargets)
 
 		// Calculate specificity score
 		guide.OffTargetScore = d.offTargetPred.ScoreOffTargetSpecificity(*guide, offTargets)
+
+		// Keep the highest-scoring sites for reports
+		sort.Slice(offTargets, func(i, j int) bool {
+			return offTargets[i].Score > offTargets[j].Score
+		})
+		if len(offTargets) > maxReportedOffTargets {
+			offTargets = offTargets[:maxReportedOffTargets]
+		}
+		guide.OffTargets = offTargets
 	}
 
 	return guides
@@ -193,6 +529,18 @@ func (d *Designer) rankGuides(guides []GuideRNA) []GuideRNA {
 		}
 
 		guide.RankScore = doenchContribution + offTargetContribution + gcPenalty
+
+		// Known variants may stop the guide cutting some alleles
+		for _, variant := range guide.Variants {
+			if variant.Targeted {
+				continue
+			}
+			if variant.Region == regionDistal {
+				guide.RankScore *= 0.8
+			} else {
+				guide.RankScore *= 0.5
+			}
+		}
 	}
 
 	return guides
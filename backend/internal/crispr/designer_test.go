@@ -1,7 +1,14 @@
 package crispr
 
 import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"genomevedic/internal/annotations"
+	"genomevedic/internal/reference"
 )
 
 // TestCHOPCHOPDesigner tests the CHOPCHOP algorithm
@@ -46,6 +53,63 @@ func TestCHOPCHOPDesigner(t *testing.T) {
 	}
 }
 
+// TestGuidePAMAdjacency checks that guides end immediately 5' of a 3' PAM
+// and start immediately 3' of a 5' PAM, on both strands, and that
+// overlapping PAM sites each yield a guide
+func TestGuidePAMAdjacency(t *testing.T) {
+	// AGGG holds two overlapping NGG sites (AGG and GGG); TTTA is a TTTV site
+	sequence := "GACCATCGATCGTACATCACCTAGGGTCATCACTTTACCGATCGTACCATCAACTCACATC"
+	const startPos = 100
+
+	testCases := []struct {
+		enzyme CasEnzyme
+		plus   []string // Expected plus-strand guides with their PAMs, 5' to 3'
+	}{
+		{Cas9, []string{"CCATCGATCGTACATCACCT" + "AGG", "CATCGATCGTACATCACCTA" + "GGG"}},
+		{Cas12a, []string{"TTTA" + "CCGATCGTACCATCAACTCACAT"}},
+	}
+
+	for _, tc := range testCases {
+		pam := GetPAMSequence(tc.enzyme)
+		guides, err := NewCHOPCHOPDesigner(tc.enzyme).FindGuides(sequence, "chr1", startPos)
+		if err != nil {
+			t.Fatalf("%s: FindGuides failed: %v", tc.enzyme, err)
+		}
+
+		var plus []string
+		for _, guide := range guides {
+			strandSeq := sequence
+			offset := guide.Position - startPos
+			if guide.Strand == "-" {
+				strandSeq = reverseComplement(sequence)
+				offset = len(sequence) - offset - len(guide.Sequence)
+			}
+
+			// Read the guide and its PAM back off the strand they came from
+			want := guide.Sequence + guide.PAMSequence
+			begin := offset
+			if pam.Orientation == "5prime" {
+				want = guide.PAMSequence + guide.Sequence
+				begin -= len(guide.PAMSequence)
+			}
+			var site string
+			if begin >= 0 && begin+len(want) <= len(strandSeq) {
+				site = strandSeq[begin : begin+len(want)]
+			}
+			if site != want {
+				t.Errorf("%s guide %s (%s%d): strand reads %q, want %q", tc.enzyme, guide.Sequence, guide.Strand, guide.Position, site, want)
+			}
+			if guide.Strand == "+" {
+				plus = append(plus, want)
+			}
+		}
+
+		if strings.Join(plus, " ") != strings.Join(tc.plus, " ") {
+			t.Errorf("%s: plus-strand sites %v, want %v", tc.enzyme, plus, tc.plus)
+		}
+	}
+}
+
 // TestDoenchScorer tests Doench 2016 scoring
 func TestDoenchScorer(t *testing.T) {
 	scorer := NewDoenchScorer()
@@ -166,6 +230,195 @@ func TestDesigner(t *testing.T) {
 	}
 }
 
+// TestDesignFromReference tests coordinate and gene-name requests against an indexed FASTA
+func TestDesignFromReference(t *testing.T) {
+	tp53 := "ATGGAGGAGCCGCAGTCAGATCCTAGCGTCGAGCCCCCTCTGAGTCAGGAAACATTTTCAGACCTATGGAAACTACTTCCTGAAAACAACGTTCTGTCC"
+	chr17 := strings.Repeat("ACGTTGCA", 125) + tp53 + strings.Repeat("TTGACCAG", 125)
+
+	dir := t.TempDir()
+	fastaPath := filepath.Join(dir, "genome.fa")
+	var fasta strings.Builder
+	fasta.WriteString(">chr17\n")
+	for i := 0; i < len(chr17); i += 60 {
+		end := i + 60
+		if end > len(chr17) {
+			end = len(chr17)
+		}
+		fasta.WriteString(chr17[i:end] + "\n")
+	}
+	if err := os.WriteFile(fastaPath, []byte(fasta.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := reference.Open(fastaPath)
+	if err != nil {
+		t.Fatalf("reference.Open failed: %v", err)
+	}
+	defer ref.Close()
+
+	genes := annotations.NewGTFParser(2000)
+	gtf := "chr17\ttest\tgene\t1001\t1100\t.\t-\t.\tgene_id \"ENSG00000141510\"; gene_name \"TP53\";\n"
+	if err := genes.ParseFile(strings.NewReader(gtf)); err != nil {
+		t.Fatalf("ParseFile failed: %v", err)
+	}
+
+	designer := NewDesigner(Cas9)
+	req := DesignRequest{Enzyme: Cas9, MaxGuides: 50, MaxOffTarget: 100, GCMin: 20, GCMax: 80}
+
+	// Without a reference, coordinate requests fail instead of using a placeholder
+	req.Chromosome, req.Start, req.End = "chr17", 1001, 1100
+	if _, err := designer.Design(req); err == nil {
+		t.Error("Expected error without a reference genome")
+	}
+
+	designer.SetReference(ref)
+	designer.SetAnnotations(genes)
+
+	byCoords, err := designer.Design(req)
+	if err != nil {
+		t.Fatalf("Design by coordinates failed: %v", err)
+	}
+
+	req.Chromosome, req.Start, req.End = "", 0, 0
+	req.GeneName = "tp53"
+	byGene, err := designer.Design(req)
+	if err != nil {
+		t.Fatalf("Design by gene failed: %v", err)
+	}
+
+	direct, err := designer.Design(DesignRequest{Sequence: tp53, Enzyme: Cas9, MaxGuides: 50, MaxOffTarget: 100, GCMin: 20, GCMax: 80})
+	if err != nil {
+		t.Fatalf("Design by sequence failed: %v", err)
+	}
+
+	if byCoords.TotalFound == 0 || byCoords.TotalFound != direct.TotalFound || byGene.TotalFound != direct.TotalFound {
+		t.Errorf("Expected the same guides: coords=%d gene=%d sequence=%d", byCoords.TotalFound, byGene.TotalFound, direct.TotalFound)
+	}
+	for _, guide := range byGene.Guides {
+		if guide.Chromosome != "chr17" || guide.Position < 1001 || guide.Position > 1100 {
+			t.Errorf("Guide outside the gene: %s:%d", guide.Chromosome, guide.Position)
+		}
+	}
+
+	req.GeneName = "NOTAGENE"
+	if _, err := designer.Design(req); err == nil {
+		t.Error("Expected error for unknown gene")
+	}
+}
+
+// TestDesignGeneExons designs over the exons of a gene too long to target whole
+func TestDesignGeneExons(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	chr7 := make([]byte, 160000)
+	for i := range chr7 {
+		chr7[i] = "ACGT"[rng.Intn(4)]
+	}
+
+	dir := t.TempDir()
+	fastaPath := filepath.Join(dir, "genome.fa")
+	var fasta strings.Builder
+	fasta.WriteString(">chr7\n")
+	for i := 0; i < len(chr7); i += 60 {
+		fasta.WriteString(string(chr7[i:min(i+60, len(chr7))]) + "\n")
+	}
+	if err := os.WriteFile(fastaPath, []byte(fasta.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.Open(fastaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Close()
+
+	// A 150 kb gene on the minus strand with two coding exons, overlapping
+	// CDS from two transcripts in the second
+	attrs := "gene_id \"ENSG1\"; gene_name \"BIG\";"
+	genes := annotations.NewGTFParser(2000)
+	gtf := "chr7\ttest\tgene\t5001\t155000\t.\t-\t.\t" + attrs + "\n" +
+		"chr7\ttest\tCDS\t5101\t5300\t.\t-\t0\t" + attrs + " transcript_id \"T1\";\n" +
+		"chr7\ttest\tCDS\t150001\t150150\t.\t-\t0\t" + attrs + " transcript_id \"T1\";\n" +
+		"chr7\ttest\tCDS\t150100\t150200\t.\t-\t0\t" + attrs + " transcript_id \"T2\";\n"
+	if err := genes.ParseFile(strings.NewReader(gtf)); err != nil {
+		t.Fatal(err)
+	}
+
+	designer := NewDesigner(Cas9)
+	designer.SetReference(ref)
+	designer.SetAnnotations(genes)
+	response, err := designer.Design(DesignRequest{GeneName: "BIG", Enzyme: Cas9, MaxGuides: 500, MaxOffTarget: 100, GCMin: 20, GCMax: 80})
+	if err != nil {
+		t.Fatalf("Design by gene failed: %v", err)
+	}
+	if response.TotalFound == 0 {
+		t.Fatal("Expected guides in the exons")
+	}
+
+	exons := map[int]bool{}
+	for _, guide := range response.Guides {
+		site := cutSite(guide, designer.chopchop.pam)
+		switch {
+		case guide.GeneName != "BIG":
+			t.Errorf("%s: gene %q", guide.ID, guide.GeneName)
+		case guide.Exon == 2 && site > 5101 && site <= 5300:
+		case guide.Exon == 1 && site > 150001 && site <= 150200:
+		default:
+			t.Errorf("%s cuts at %d, outside exon %d", guide.ID, site, guide.Exon)
+		}
+		exons[guide.Exon] = true
+	}
+	if !exons[1] || !exons[2] {
+		t.Errorf("Expected guides in both exons, got %v", exons)
+	}
+}
+
+// TestDesignBulges tests that requests choose the off-target bulge budget
+func TestDesignBulges(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	region := "ATGGAGGAGCCGCAGTCAGATCCTAGCGTCGAGCCCCCTCTGAGTCAGGAAACATTTTCAGACCTATGGAAACTACTTCCTGAAAACAACGTTCTGTCC"
+	guide := "AGGAAACATTTTCAGACCTA" // + strand, PAM TGG
+	bulged := guide[:10] + "A" + guide[10:] + "TGG" // DNA bulge after position 9
+
+	designer := NewDesigner(Cas9)
+	genome := NewGenomeIndex()
+	genome.IndexSequence("chr1", randomDNA(rng, 300)+region+randomDNA(rng, 300)+bulged+randomDNA(rng, 300))
+	designer.SetGenomeIndex(genome)
+
+	req := DesignRequest{Sequence: region, Enzyme: Cas9, MaxGuides: 50, MinDoench: 1e-9, MaxOffTarget: 100, GCMin: 1, GCMax: 99}
+	bulgedSites := func(bulges int) int {
+		req.MaxBulges = bulges
+		response, err := designer.Design(req)
+		if err != nil {
+			t.Fatalf("Design with %d bulges failed: %v", bulges, err)
+		}
+		for _, g := range response.Guides {
+			if g.Sequence != guide {
+				continue
+			}
+			count := 0
+			for _, ot := range g.OffTargets {
+				if ot.DNABulges+ot.RNABulges > 0 {
+					count++
+				}
+			}
+			return count
+		}
+		t.Fatalf("Guide %s not designed", guide)
+		return 0
+	}
+
+	if n := bulgedSites(0); n != 0 {
+		t.Errorf("Expected no bulged off-targets by default, got %d", n)
+	}
+	if n := bulgedSites(1); n == 0 {
+		t.Error("Expected the bulged off-target with max_bulges 1")
+	}
+
+	req.MaxBulges = 3
+	if _, err := designer.Design(req); err == nil {
+		t.Error("Expected error for max_bulges above the limit")
+	}
+}
+
 // TestExporter tests export functionality
 func TestExporter(t *testing.T) {
 	exporter := NewExporter()
@@ -1,6 +1,7 @@
 package crispr
 
 import (
+	"fmt"
 	"math"
 	"strings"
 )
@@ -21,13 +22,34 @@ func NewDoenchScorer() *DoenchScorer {
 	}
 }
 
+// Name returns the model name
+func (ds *DoenchScorer) Name() string {
+	return ModelDoench2016
+}
+
+// Description summarises the model
+func (ds *DoenchScorer) Description() string {
+	return "Doench 2016 Rule Set 2 for U6-expressed SpCas9 guides (default)"
+}
+
+// Supports reports whether the model applies to an enzyme. It was trained
+// on SpCas9 and is used as an approximation for other 3' PAM nucleases.
+func (ds *DoenchScorer) Supports(enzyme CasEnzyme) bool {
+	return enzyme != Cas12a
+}
+
+// Flanks returns the 4bp upstream and 3bp downstream of the 30bp context
+func (ds *DoenchScorer) Flanks() (int, int) {
+	return 4, 3
+}
+
 // Score calculates the Doench 2016 on-target efficiency score
 // Input: 30bp context (4bp upstream + 20bp guide + 3bp PAM + 3bp downstream)
 // Output: Score from 0-1 (higher = better predicted efficiency)
 func (ds *DoenchScorer) Score(guide GuideRNA, context string) float64 {
 	// Ensure we have 30bp context
 	context = strings.ToUpper(context)
-	if len(context) < 30 {
+	if len(context) < 30 || strings.Contains(context, "N") {
 		// Use simplified scoring if context not available
 		return ds.scoreSimplified(guide.Sequence)
 	}
@@ -289,5 +311,3 @@ func (ds *DoenchScorer) AdjustForContext(baseScore float64, guide GuideRNA) floa
 	return score
 }
 
-// Add missing import
-import "fmt"
@@ -0,0 +1,143 @@
+package crispr
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestPairedDeletionDesign pairs guides either side of a PAM-free spacer
+func TestPairedDeletionDesign(t *testing.T) {
+	sequence := tp53Exon + strings.Repeat("ACAT", 25) + reverseComplement(tp53Exon)
+	start, end := len(tp53Exon), len(tp53Exon)+99
+
+	designer := NewDesigner(Cas9)
+	response, err := designer.Design(DesignRequest{
+		Sequence:      sequence,
+		Enzyme:        Cas9,
+		Mode:          ModePairedDeletion,
+		DeletionStart: start,
+		DeletionEnd:   end,
+		MaxGuides:     20,
+	})
+	if err != nil {
+		t.Fatalf("Design failed: %v", err)
+	}
+	if len(response.Pairs) != 20 {
+		t.Fatalf("Expected 20 pairs, got %d", len(response.Pairs))
+	}
+
+	for i, pair := range response.Pairs {
+		if pair.LeftCut > start || pair.RightCut <= end {
+			t.Errorf("%s: cuts %d and %d inside the deletion", pair.ID, pair.LeftCut, pair.RightCut)
+		}
+		if pair.DeletionSize != pair.RightCut-pair.LeftCut || pair.Excess != pair.DeletionSize-(end-start+1) {
+			t.Errorf("%s: size %d with excess %d", pair.ID, pair.DeletionSize, pair.Excess)
+		}
+		want := sequence[pair.LeftCut-junctionFlank:pair.LeftCut] + sequence[pair.RightCut:pair.RightCut+junctionFlank]
+		if pair.Junction != want {
+			t.Errorf("%s: junction %s, want %s", pair.ID, pair.Junction, want)
+		}
+		if i > 0 && pair.Score > response.Pairs[i-1].Score {
+			t.Errorf("%s: pairs not sorted by score", pair.ID)
+		}
+	}
+
+	// A tight offset leaves no pairs
+	response, err = designer.Design(DesignRequest{Sequence: sequence, Enzyme: Cas9, Mode: ModePairedDeletion, DeletionStart: start, DeletionEnd: end, MaxCutOffset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Pairs) != 0 || len(response.Warnings) == 0 {
+		t.Errorf("Expected a warning and no pairs, got %d pairs", len(response.Pairs))
+	}
+
+	if _, err := designer.Design(DesignRequest{Sequence: sequence, Enzyme: Cas9, Mode: ModePairedDeletion, DeletionStart: end, DeletionEnd: start}); err == nil {
+		t.Error("Expected error for an inverted deletion")
+	}
+}
+
+// TestKnockInDesign inserts a FLAG tag after the TP53 start codon
+func TestKnockInDesign(t *testing.T) {
+	const utr = "ACATTACATAACATTACATAACATTACATAACATTACATAACATTACATAACATTACATA"
+	const flag = "GACTACAAAGACGATGACGACAAG"
+	sequence := utr + tp53Exon
+	site := len(utr) + 3
+
+	tests := []struct {
+		name    string
+		options DonorOptions
+	}{
+		{"coding ssODN", DonorOptions{CodingStrand: "+", CodonStart: len(utr)}},
+		{"non-coding dsDNA", DonorOptions{Type: DonorDSDNA, HomologyArm: 50}},
+	}
+
+	designer := NewDesigner(Cas9)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			response, err := designer.Design(DesignRequest{
+				Sequence:       sequence,
+				Enzyme:         Cas9,
+				Mode:           ModeKnockIn,
+				EditPosition:   site,
+				InsertSequence: flag,
+				Donor:          &options,
+			})
+			if err != nil {
+				t.Fatalf("Design failed: %v", err)
+			}
+			if len(response.KnockIns) == 0 {
+				t.Fatal("Expected knock-in designs")
+			}
+
+			arm := options.withDefaults().HomologyArm
+			for _, design := range response.KnockIns {
+				if design.CutDistance > 10 {
+					t.Errorf("%s: cut %d bp from the insertion", design.ID, design.CutDistance)
+				}
+
+				donor := design.Donor
+				if design.DonorStrand == "-" {
+					donor = reverseComplement(donor)
+				}
+				if donor != design.LeftArm+flag+design.RightArm || len(design.LeftArm) != arm || len(design.RightArm) != arm {
+					t.Errorf("%s: malformed donor %s", design.ID, design.Donor)
+				}
+				if options.Type == DonorSSODN && design.DonorStrand == design.Guide.Strand {
+					t.Errorf("%s: ssODN on the non-target strand", design.ID)
+				}
+
+				// The repaired allele keeps the protein and escapes the guide
+				if !design.RecutBlocked {
+					t.Errorf("%s: donor is re-cut (%+v)", design.ID, design.Mutations)
+				}
+				guideSite := regexp.MustCompile(design.Guide.Sequence + "[ACGT]GG")
+				if guideSite.MatchString(donor) || guideSite.MatchString(reverseComplement(donor)) {
+					t.Errorf("%s: donor still contains the guide site", design.ID)
+				}
+				if options.CodingStrand == "" {
+					continue
+				}
+				repaired := sequence[:site-arm] + design.LeftArm + flag + design.RightArm + sequence[site+arm:]
+				if translateCodons(repaired[len(utr):]) != translateCodons(tp53Exon[:3]+flag+tp53Exon[3:]) {
+					t.Errorf("%s: donor mutations %+v change the protein", design.ID, design.Mutations)
+				}
+				for _, mutation := range design.Mutations {
+					if mutation.Codon == "" || mutation.AminoAcid == "" {
+						t.Errorf("%s: mutation %+v lacks its codon", design.ID, mutation)
+					}
+				}
+			}
+		})
+	}
+}
+
+// translateCodons translates a sequence with the standard genetic code
+func translateCodons(sequence string) string {
+	var protein []byte
+	for i := 0; i+3 <= len(sequence); i += 3 {
+		protein = append(protein, geneticCode[sequence[i:i+3]])
+	}
+	return string(protein)
+}
@@ -0,0 +1,211 @@
+package crispr
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// baseEditTarget holds one SpCas9 site (protospacer at offset 30, TGG PAM)
+// with adenines at protospacer positions 5 and 7, in flanks without PAMs
+const baseEditTarget = "ACATTACATAACATTACATAACATTACATA" + "GTCTACAGTCGTCGTCTTCG" + "TGG" + "ACATTACATAACATTACATAACATTACATA"
+
+// tp53Exon is the TP53 test sequence used by the designer tests
+const tp53Exon = "ATGGAGGAGCCGCAGTCAGATCCTAGCGTCGAGCCCCCTCTGAGTCAGGAAACATTTTCAGACCTATGGAAACTACTTCCTGAAAACAACGTTCTGTCC"
+
+// TestBaseEditDesign places the target in the window and predicts bystanders
+// on both strands
+func TestBaseEditDesign(t *testing.T) {
+	designer := NewDesigner(Cas9)
+
+	tests := []struct {
+		name      string
+		sequence  string
+		position  int
+		ref, alt  string
+		bystander int
+	}{
+		{"forward strand", baseEditTarget, 34, "A", "G", 36},
+		{"reverse strand", reverseComplement(baseEditTarget), 48, "T", "C", 46},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := designer.Design(DesignRequest{
+				Sequence:     tt.sequence,
+				Enzyme:       Cas9,
+				Mode:         ModeBaseEdit,
+				EditPosition: tt.position,
+				RefAllele:    tt.ref,
+				AltAllele:    tt.alt,
+			})
+			if err != nil {
+				t.Fatalf("Design failed: %v", err)
+			}
+			if len(response.BaseEdits) != 2 {
+				t.Fatalf("Expected ABE7.10 and ABE8e designs, got %d", len(response.BaseEdits))
+			}
+
+			for _, edit := range response.BaseEdits {
+				if edit.EditorType != AdenineBaseEditor || edit.TargetPosition != 5 {
+					t.Errorf("%s: type %s, target position %d", edit.Editor, edit.EditorType, edit.TargetPosition)
+				}
+				if edit.EditedProtospacer != "GTCTGCAGTCGTCGTCTTCG" {
+					t.Errorf("%s: edited protospacer %s", edit.Editor, edit.EditedProtospacer)
+				}
+				if len(edit.Bystanders) != 1 {
+					t.Fatalf("%s: expected one bystander, got %+v", edit.Editor, edit.Bystanders)
+				}
+				bystander := edit.Bystanders[0]
+				if bystander.Position != tt.bystander || bystander.ProtospacerPosition != 7 ||
+					bystander.RefBase != tt.ref || bystander.AltBase != tt.alt {
+					t.Errorf("%s: bystander %+v", edit.Editor, bystander)
+				}
+				if edit.Purity != 1-bystander.Probability {
+					t.Errorf("%s: purity %.3f with bystander probability %.3f", edit.Editor, edit.Purity, bystander.Probability)
+				}
+			}
+		})
+	}
+
+	// A>C is not a base editor conversion
+	if _, err := designer.Design(DesignRequest{Sequence: baseEditTarget, Enzyme: Cas9, Mode: ModeBaseEdit, EditPosition: 34, AltAllele: "C"}); err == nil {
+		t.Error("Expected error for A>C")
+	}
+	// The reference allele is checked
+	if _, err := designer.Design(DesignRequest{Sequence: baseEditTarget, Enzyme: Cas9, Mode: ModeBaseEdit, EditPosition: 34, RefAllele: "C", AltAllele: "T"}); err == nil {
+		t.Error("Expected error for a mismatched ref_allele")
+	}
+	// Edit sites need a reference genome
+	if _, err := designer.Design(DesignRequest{Chromosome: "chr17", Enzyme: Cas9, Mode: ModeBaseEdit, EditPosition: 7675088, AltAllele: "T"}); err == nil {
+		t.Error("Expected error without a reference genome")
+	}
+}
+
+// TestPrimeEditDesign checks pegRNA structure for substitutions and indels
+func TestPrimeEditDesign(t *testing.T) {
+	designer := NewDesigner(Cas9)
+
+	tests := []struct {
+		name     string
+		position int
+		ref, alt string
+	}{
+		{"substitution", 50, "A", "T"},
+		{"insertion", 50, "A", "AGAATTC"},
+		{"deletion", 50, "AACAT", "A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := designer.Design(DesignRequest{
+				Sequence:     tp53Exon,
+				Enzyme:       Cas9,
+				Mode:         ModePrimeEdit,
+				EditPosition: tt.position,
+				RefAllele:    tt.ref,
+				AltAllele:    tt.alt,
+				MaxGuides:    50,
+			})
+			if err != nil {
+				t.Fatalf("Design failed: %v", err)
+			}
+			if len(response.PegRNAs) == 0 {
+				t.Fatal("Expected pegRNAs")
+			}
+
+			edited := tp53Exon[:tt.position] + tt.alt + tp53Exon[tt.position+len(tt.ref):]
+			for _, peg := range response.PegRNAs {
+				original, product := tp53Exon, edited
+				if peg.Spacer.Strand == "-" {
+					original, product = reverseComplement(tp53Exon), reverseComplement(edited)
+				}
+
+				if peg.Sequence != peg.Spacer.Sequence+pegRNAScaffold+peg.Extension || peg.Extension != peg.RTTemplate+peg.PBS {
+					t.Errorf("%s: malformed pegRNA %s", peg.ID, peg.Sequence)
+				}
+				if pbs := reverseComplement(peg.PBS); !strings.HasSuffix(peg.Spacer.Sequence[:17], pbs) {
+					t.Errorf("%s: PBS %s does not bind 5' of the nick", peg.ID, peg.PBS)
+				}
+				// The flap primed at the nick templates the edited strand
+				flap := reverseComplement(peg.PBS) + reverseComplement(peg.RTTemplate)
+				if !strings.Contains(product, flap) || strings.Contains(original, flap) {
+					t.Errorf("%s: RT template %s does not install the edit", peg.ID, peg.RTTemplate)
+				}
+				if peg.EditDistance < 1 || peg.EditDistance > 20 || peg.Homology < 7 {
+					t.Errorf("%s: edit at %+d with %d nt homology", peg.ID, peg.EditDistance, peg.Homology)
+				}
+				for _, nicking := range peg.NickingGuides {
+					if nicking.Guide.Strand == peg.Spacer.Strand {
+						t.Errorf("%s: nicking guide on the pegRNA strand", peg.ID)
+					}
+					if !nicking.PE3b && (nicking.Distance < 40 || nicking.Distance > 100) {
+						t.Errorf("%s: PE3 nick %d bp away", peg.ID, nicking.Distance)
+					}
+				}
+			}
+		})
+	}
+
+	// Cas12a has no prime editor
+	cas12a := NewDesigner(Cas12a)
+	if _, err := cas12a.Design(DesignRequest{Sequence: tp53Exon, Enzyme: Cas12a, Mode: ModePrimeEdit, EditPosition: 50, AltAllele: "T"}); err == nil {
+		t.Error("Expected error for Cas12a prime editing")
+	}
+}
+
+// TestExportEdits exports base editor and prime editor designs
+func TestExportEdits(t *testing.T) {
+	designer := NewDesigner(Cas9)
+	exporter := NewExporter()
+
+	baseEdits, err := designer.Design(DesignRequest{Sequence: baseEditTarget, Enzyme: Cas9, Mode: ModeBaseEdit, EditPosition: 34, AltAllele: "G"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	primeEdits, err := designer.Design(DesignRequest{Sequence: tp53Exon, Enzyme: Cas9, Mode: ModePrimeEdit, EditPosition: 50, AltAllele: "T"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csvData, err := exporter.Export(ExportRequest{BaseEdits: baseEdits.BaseEdits, Format: ExportCSV})
+	if err != nil {
+		t.Fatalf("Base edit CSV export failed: %v", err)
+	}
+	if lines := strings.Count(string(csvData), "\n"); lines != len(baseEdits.BaseEdits)+1 {
+		t.Errorf("Base edit CSV has %d lines", lines)
+	}
+
+	csvData, err = exporter.Export(ExportRequest{PegRNAs: primeEdits.PegRNAs, Format: ExportCSV})
+	if err != nil {
+		t.Fatalf("pegRNA CSV export failed: %v", err)
+	}
+	if !strings.Contains(string(csvData), primeEdits.PegRNAs[0].Sequence) {
+		t.Error("pegRNA CSV lacks the pegRNA sequence")
+	}
+
+	gbData, err := exporter.Export(ExportRequest{PegRNAs: primeEdits.PegRNAs[:1], Format: ExportGenBank})
+	if err != nil {
+		t.Fatalf("pegRNA GenBank export failed: %v", err)
+	}
+	for _, want := range []string{"/label=\"spacer\"", "/label=\"RT template\"", "primer_bind", "//"} {
+		if !strings.Contains(string(gbData), want) {
+			t.Errorf("GenBank lacks %q", want)
+		}
+	}
+
+	jsonData, err := exporter.Export(ExportRequest{PegRNAs: primeEdits.PegRNAs, Format: ExportJSON})
+	if err != nil {
+		t.Fatalf("JSON export failed: %v", err)
+	}
+	var decoded struct {
+		PegRNAs []PegRNA `json:"peg_rnas"`
+	}
+	if err := json.Unmarshal(jsonData, &decoded); err != nil || len(decoded.PegRNAs) != len(primeEdits.PegRNAs) {
+		t.Errorf("JSON round trip: %v, %d pegRNAs", err, len(decoded.PegRNAs))
+	}
+
+	if _, err := exporter.Export(ExportRequest{BaseEdits: baseEdits.BaseEdits, PegRNAs: primeEdits.PegRNAs, Format: ExportPDF}); err != nil {
+		t.Errorf("PDF export failed: %v", err)
+	}
+}
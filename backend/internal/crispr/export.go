@@ -3,21 +3,35 @@ package crispr
 import (
 	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
+
+	"genomevedic/internal/annotations"
 )
 
 // Exporter handles exporting guide RNAs to various formats
-type Exporter struct{}
+type Exporter struct {
+	genes *annotations.GTFParser // Exons for the PDF locus diagram
+}
 
 // NewExporter creates a new exporter
 func NewExporter() *Exporter {
 	return &Exporter{}
 }
 
+// SetAnnotations sets the gene annotations drawn in PDF locus diagrams
+func (e *Exporter) SetAnnotations(genes *annotations.GTFParser) {
+	e.genes = genes
+}
+
 // Export exports guides to the specified format
 func (e *Exporter) Export(req ExportRequest) ([]byte, error) {
+	if len(req.BaseEdits) > 0 || len(req.PegRNAs) > 0 {
+		return e.exportEdits(req)
+	}
+
 	switch req.Format {
 	case ExportCSV:
 		return e.ExportCSV(req.Guides)
@@ -47,6 +61,8 @@ func (e *Exporter) ExportCSV(guides []GuideRNA) ([]byte, error) {
 		"PAM",
 		"Enzyme",
 		"Doench Score",
+		"Scoring Model",
+		"Known Variants",
 		"Off-Target Count",
 		"Off-Target Score",
 		"GC Content (%)",
@@ -69,6 +85,8 @@ func (e *Exporter) ExportCSV(guides []GuideRNA) ([]byte, error) {
 			guide.PAMSequence,
 			string(guide.Enzyme),
 			fmt.Sprintf("%.3f", guide.DoenchScore),
+			guide.ScoringModel,
+			variantSummary(guide),
 			fmt.Sprintf("%d", guide.OffTargetCount),
 			fmt.Sprintf("%.2f", guide.OffTargetScore),
 			fmt.Sprintf("%.1f", guide.GCContent),
@@ -116,6 +134,12 @@ func (e *Exporter) ExportGenBank(guides []GuideRNA, options map[string]interface
 		buf.WriteString(fmt.Sprintf("                     /label=\"guide_%d\"\n", i+1))
 		buf.WriteString(fmt.Sprintf("                     /note=\"sequence: %s\"\n", guide.Sequence))
 		buf.WriteString(fmt.Sprintf("                     /note=\"doench_score: %.3f\"\n", guide.DoenchScore))
+		if guide.ScoringModel != "" {
+			buf.WriteString(fmt.Sprintf("                     /note=\"scoring_model: %s\"\n", guide.ScoringModel))
+		}
+		if len(guide.Variants) > 0 {
+			buf.WriteString(fmt.Sprintf("                     /note=\"variants: %s\"\n", variantSummary(guide)))
+		}
 		buf.WriteString(fmt.Sprintf("                     /note=\"off_targets: %d\"\n", guide.OffTargetCount))
 		buf.WriteString(fmt.Sprintf("                     /note=\"target: %s:%d\"\n", guide.Chromosome, guide.Position))
 	}
@@ -146,85 +170,19 @@ func (e *Exporter) formatSequenceLine(seq string) string {
 	return strings.Join(parts, " ")
 }
 
-// ExportPDF exports guides as PDF report
+// ExportPDF exports guides as a PDF report with a ranking table, score
+// breakdowns, off-target sites and a locus diagram
 func (e *Exporter) ExportPDF(guides []GuideRNA, options map[string]interface{}) ([]byte, error) {
-	// For PDF generation, would use a library like gofpdf or chromedp
-	// Here we create a simple text-based report that could be converted to PDF
-
-	var buf bytes.Buffer
-
-	// Title
-	buf.WriteString("═══════════════════════════════════════════════════════════════\n")
-	buf.WriteString("              CRISPR GUIDE RNA DESIGN REPORT\n")
-	buf.WriteString("                   Generated by GenomeVedic\n")
-	buf.WriteString(fmt.Sprintf("                   Date: %s\n", time.Now().Format("2006-01-02 15:04:05")))
-	buf.WriteString("═══════════════════════════════════════════════════════════════\n\n")
-
-	// Summary
-	buf.WriteString("SUMMARY\n")
-	buf.WriteString("───────────────────────────────────────────────────────────────\n")
-	buf.WriteString(fmt.Sprintf("Total Guides: %d\n", len(guides)))
-
-	if len(guides) > 0 {
-		avgDoench := 0.0
-		avgOffTarget := 0.0
-		for _, g := range guides {
-			avgDoench += g.DoenchScore
-			avgOffTarget += float64(g.OffTargetCount)
-		}
-		avgDoench /= float64(len(guides))
-		avgOffTarget /= float64(len(guides))
-
-		buf.WriteString(fmt.Sprintf("Average Doench Score: %.3f\n", avgDoench))
-		buf.WriteString(fmt.Sprintf("Average Off-Target Count: %.1f\n", avgOffTarget))
-
-		if len(guides) > 0 {
-			buf.WriteString(fmt.Sprintf("Target Region: %s:%d\n", guides[0].Chromosome, guides[0].Position))
-			buf.WriteString(fmt.Sprintf("Enzyme: %s\n", guides[0].Enzyme))
-		}
+	title := "CRISPR Guide RNA Design Report"
+	if t, ok := options["title"].(string); ok && t != "" {
+		title = t
 	}
-	buf.WriteString("\n")
-
-	// Top guides
-	buf.WriteString("TOP RANKED GUIDES\n")
-	buf.WriteString("───────────────────────────────────────────────────────────────\n\n")
 
-	for i, guide := range guides {
-		if i >= 10 {
-			break // Show top 10
-		}
-
-		buf.WriteString(fmt.Sprintf("GUIDE #%d (Rank Score: %.3f)\n", i+1, guide.RankScore))
-		buf.WriteString(fmt.Sprintf("  Sequence:       5'-%s-%s-3'\n", guide.Sequence, guide.PAMSequence))
-		buf.WriteString(fmt.Sprintf("  Location:       %s:%d (%s)\n", guide.Chromosome, guide.Position, guide.Strand))
-		buf.WriteString(fmt.Sprintf("  Doench Score:   %.3f (%s)\n",
-			guide.DoenchScore, e.getEfficiencyLabel(guide.DoenchScore)))
-		buf.WriteString(fmt.Sprintf("  Off-Targets:    %d (Specificity: %.1f)\n",
-			guide.OffTargetCount, guide.OffTargetScore))
-		buf.WriteString(fmt.Sprintf("  GC Content:     %.1f%%\n", guide.GCContent))
-
-		// Visual representation of scores
-		buf.WriteString("  Scores:         ")
-		buf.WriteString(e.makeScoreBar("Efficiency", guide.DoenchScore))
-		buf.WriteString("\n                  ")
-		buf.WriteString(e.makeScoreBar("Specificity", guide.OffTargetScore/100.0))
-		buf.WriteString("\n\n")
+	data, err := e.guideReport(guides, title).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write PDF report: %w", err)
 	}
-
-	// Recommendations
-	buf.WriteString("RECOMMENDATIONS\n")
-	buf.WriteString("───────────────────────────────────────────────────────────────\n")
-	buf.WriteString("1. Validate top 3-5 guides experimentally\n")
-	buf.WriteString("2. Consider ordering synthetic guides from IDT or Genscript\n")
-	buf.WriteString("3. Clone guides into expression vector (e.g., lentiCRISPRv2)\n")
-	buf.WriteString("4. Perform off-target validation with GUIDE-seq or CIRCLE-seq\n")
-	buf.WriteString("5. Test in relevant cell line before in vivo experiments\n\n")
-
-	buf.WriteString("═══════════════════════════════════════════════════════════════\n")
-	buf.WriteString("End of Report\n")
-	buf.WriteString("═══════════════════════════════════════════════════════════════\n")
-
-	return buf.Bytes(), nil
+	return data, nil
 }
 
 // ExportJSON exports guides as JSON
@@ -244,6 +202,7 @@ func (e *Exporter) ExportJSON(guides []GuideRNA) ([]byte, error) {
 		buf.WriteString(fmt.Sprintf("      \"strand\": \"%s\",\n", guide.Strand))
 		buf.WriteString(fmt.Sprintf("      \"pam_sequence\": \"%s\",\n", guide.PAMSequence))
 		buf.WriteString(fmt.Sprintf("      \"doench_score\": %.3f,\n", guide.DoenchScore))
+		buf.WriteString(fmt.Sprintf("      \"scoring_model\": \"%s\",\n", guide.ScoringModel))
 		buf.WriteString(fmt.Sprintf("      \"off_target_count\": %d,\n", guide.OffTargetCount))
 		buf.WriteString(fmt.Sprintf("      \"off_target_score\": %.2f,\n", guide.OffTargetScore))
 		buf.WriteString(fmt.Sprintf("      \"rank_score\": %.3f\n", guide.RankScore))
@@ -273,16 +232,236 @@ func (e *Exporter) getEfficiencyLabel(score float64) string {
 	return "Very Low"
 }
 
-// makeScoreBar creates a visual score bar
-func (e *Exporter) makeScoreBar(label string, score float64) string {
-	barLength := 20
-	filled := int(score * float64(barLength))
-	if filled > barLength {
-		filled = barLength
+// exportEdits exports base editor or prime editor designs
+func (e *Exporter) exportEdits(req ExportRequest) ([]byte, error) {
+	switch req.Format {
+	case ExportCSV:
+		if len(req.BaseEdits) > 0 && len(req.PegRNAs) > 0 {
+			return nil, fmt.Errorf("export base edits and pegRNAs separately as CSV")
+		}
+		if len(req.BaseEdits) > 0 {
+			return e.ExportBaseEditsCSV(req.BaseEdits)
+		}
+		return e.ExportPegRNAsCSV(req.PegRNAs)
+	case ExportGenBank:
+		if len(req.PegRNAs) > 0 {
+			return e.ExportPegRNAGenBank(req.PegRNAs)
+		}
+		guides := make([]GuideRNA, len(req.BaseEdits))
+		for i, edit := range req.BaseEdits {
+			guides[i] = edit.Guide
+		}
+		return e.ExportGenBank(guides, req.Options)
+	case ExportPDF:
+		return e.ExportEditsPDF(req.BaseEdits, req.PegRNAs)
+	case ExportJSON:
+		return json.MarshalIndent(map[string]interface{}{
+			"base_edits": req.BaseEdits,
+			"peg_rnas":   req.PegRNAs,
+		}, "", "  ")
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", req.Format)
 	}
+}
+
+// ExportBaseEditsCSV exports base editor designs to CSV format
+func (e *Exporter) ExportBaseEditsCSV(edits []BaseEditGuide) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
 
-	bar := strings.Repeat("█", filled) + strings.Repeat("░", barLength-filled)
-	return fmt.Sprintf("%s [%s] %.0f%%", label, bar, score*100)
+	header := []string{
+		"ID",
+		"Editor",
+		"Type",
+		"Sequence",
+		"PAM",
+		"Chromosome",
+		"Position",
+		"Strand",
+		"Window",
+		"Target Position",
+		"Efficiency",
+		"Purity",
+		"Bystanders",
+		"Edited Protospacer",
+		"Doench Score",
+		"Off-Target Count",
+		"Score",
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, edit := range edits {
+		var bystanders []string
+		for _, b := range edit.Bystanders {
+			bystanders = append(bystanders, fmt.Sprintf("%d%s>%s(%.2f)", b.Position, b.RefBase, b.AltBase, b.Probability))
+		}
+		row := []string{
+			edit.Guide.ID,
+			edit.Editor,
+			string(edit.EditorType),
+			edit.Guide.Sequence,
+			edit.Guide.PAMSequence,
+			edit.Guide.Chromosome,
+			fmt.Sprintf("%d", edit.Guide.Position),
+			edit.Guide.Strand,
+			fmt.Sprintf("%d-%d", edit.WindowStart, edit.WindowEnd),
+			fmt.Sprintf("%d", edit.TargetPosition),
+			fmt.Sprintf("%.2f", edit.Efficiency),
+			fmt.Sprintf("%.2f", edit.Purity),
+			strings.Join(bystanders, ";"),
+			edit.EditedProtospacer,
+			fmt.Sprintf("%.3f", edit.Guide.DoenchScore),
+			fmt.Sprintf("%d", edit.Guide.OffTargetCount),
+			fmt.Sprintf("%.3f", edit.Score),
+		}
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ExportPegRNAsCSV exports pegRNAs to CSV format, one row per pegRNA with
+// its best nicking guide
+func (e *Exporter) ExportPegRNAsCSV(pegRNAs []PegRNA) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := []string{
+		"ID",
+		"Spacer",
+		"PAM",
+		"Chromosome",
+		"Strand",
+		"Nick Position",
+		"Edit Distance",
+		"PBS",
+		"PBS Length",
+		"RT Template",
+		"RTT Length",
+		"Homology",
+		"Extension",
+		"pegRNA",
+		"Blocks Re-nicking",
+		"Nicking Guide",
+		"Nicking Distance",
+		"PE3b",
+		"Score",
+		"Warnings",
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, peg := range pegRNAs {
+		nickingSeq, nickingDistance, pe3b := "", "", ""
+		if len(peg.NickingGuides) > 0 {
+			best := peg.NickingGuides[0]
+			nickingSeq = best.Guide.Sequence
+			nickingDistance = fmt.Sprintf("%d", best.Distance)
+			pe3b = fmt.Sprintf("%t", best.PE3b)
+		}
+		row := []string{
+			peg.ID,
+			peg.Spacer.Sequence,
+			peg.Spacer.PAMSequence,
+			peg.Spacer.Chromosome,
+			peg.Spacer.Strand,
+			fmt.Sprintf("%d", peg.NickPosition),
+			fmt.Sprintf("%+d", peg.EditDistance),
+			peg.PBS,
+			fmt.Sprintf("%d", len(peg.PBS)),
+			peg.RTTemplate,
+			fmt.Sprintf("%d", len(peg.RTTemplate)),
+			fmt.Sprintf("%d", peg.Homology),
+			peg.Extension,
+			peg.Sequence,
+			fmt.Sprintf("%t", peg.BlocksRenicking),
+			nickingSeq,
+			nickingDistance,
+			pe3b,
+			fmt.Sprintf("%.3f", peg.Score),
+			strings.Join(peg.Warnings, "; "),
+		}
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ExportPegRNAGenBank exports each pegRNA as an annotated GenBank record
+// (spacer, scaffold, RT template, PBS)
+func (e *Exporter) ExportPegRNAGenBank(pegRNAs []PegRNA) ([]byte, error) {
+	var buf bytes.Buffer
+	date := time.Now().Format("02-JAN-2006")
+
+	for i, peg := range pegRNAs {
+		seq := strings.ToLower(peg.Sequence)
+		spacerEnd := len(peg.Spacer.Sequence)
+		scaffoldEnd := spacerEnd + len(pegRNAScaffold)
+		rttEnd := scaffoldEnd + len(peg.RTTemplate)
+
+		buf.WriteString(fmt.Sprintf("LOCUS       %-16s %d bp    RNA     linear   SYN %s\n",
+			fmt.Sprintf("pegRNA_%d", i+1), len(seq), date))
+		buf.WriteString(fmt.Sprintf("DEFINITION  Prime editing guide RNA %s\n", peg.ID))
+		buf.WriteString("ACCESSION   .\n")
+		buf.WriteString("VERSION     .\n")
+		buf.WriteString("KEYWORDS    .\n")
+		buf.WriteString("SOURCE      synthetic RNA construct\n")
+		buf.WriteString("  ORGANISM  synthetic RNA construct\n")
+		buf.WriteString("FEATURES             Location/Qualifiers\n")
+		buf.WriteString(fmt.Sprintf("     misc_RNA        1..%d\n", spacerEnd))
+		buf.WriteString("                     /label=\"spacer\"\n")
+		buf.WriteString(fmt.Sprintf("                     /note=\"target: %s:%d (%s)\"\n", peg.Spacer.Chromosome, peg.Spacer.Position, peg.Spacer.Strand))
+		buf.WriteString(fmt.Sprintf("     misc_RNA        %d..%d\n", spacerEnd+1, scaffoldEnd))
+		buf.WriteString("                     /label=\"scaffold\"\n")
+		buf.WriteString(fmt.Sprintf("     misc_RNA        %d..%d\n", scaffoldEnd+1, rttEnd))
+		buf.WriteString("                     /label=\"RT template\"\n")
+		buf.WriteString(fmt.Sprintf("                     /note=\"edit at %+d, %d nt homology\"\n", peg.EditDistance, peg.Homology))
+		buf.WriteString(fmt.Sprintf("     primer_bind     %d..%d\n", rttEnd+1, len(seq)))
+		buf.WriteString("                     /label=\"PBS\"\n")
+		for _, nicking := range peg.NickingGuides {
+			kind := "PE3"
+			if nicking.PE3b {
+				kind = "PE3b"
+			}
+			buf.WriteString(fmt.Sprintf("                     /note=\"%s nicking guide: %s (%d bp)\"\n", kind, nicking.Guide.Sequence, nicking.Distance))
+		}
+
+		buf.WriteString("ORIGIN\n")
+		for start := 0; start < len(seq); start += 60 {
+			end := min(start+60, len(seq))
+			buf.WriteString(fmt.Sprintf("%9d %s\n", start+1, e.formatSequenceLine(seq[start:end])))
+		}
+		buf.WriteString("//\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ExportEditsPDF exports base editor and prime editor designs as a PDF
+// report
+func (e *Exporter) ExportEditsPDF(baseEdits []BaseEditGuide, pegRNAs []PegRNA) ([]byte, error) {
+	data, err := e.editReport(baseEdits, pegRNAs, "CRISPR Editing Design Report").Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write PDF report: %w", err)
+	}
+	return data, nil
 }
 
 // ExportToFile helper for writing to file system
@@ -0,0 +1,615 @@
+package crispr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"unsafe"
+
+	"genomevedic/internal/reference"
+)
+
+// FM-index symbol codes. Chromosomes are joined with N so that no match can
+// span two sequences; the text ends with the sentinel $.
+const (
+	fmSentinel = 0
+	fmA        = 1
+	fmC        = 2
+	fmG        = 3
+	fmT        = 4
+	fmN        = 5
+	fmSymbols  = 6
+)
+
+// FM-index file format constants
+const (
+	fmMagic              = "GVFMIDX2"
+	fmDefaultSARate      = 32 // Keep every 32nd suffix array entry
+	fmDefaultOccInterval = 64 // Occurrence checkpoint every 64 BWT rows
+)
+
+// fmPartLength caps the text of one index part. Suffix array positions and
+// occurrence counts are 32-bit, and SA-IS needs 8 bytes per base while a
+// part is built, so large genomes are split into parts of whole sequences.
+// 2^28 holds the longest human chromosome (chr1, 249 Mb).
+var fmPartLength = 1 << 28
+
+// fmCodeToBase decodes symbol codes back to bases
+var fmCodeToBase = [fmSymbols]byte{'$', 'A', 'C', 'G', 'T', 'N'}
+
+// fmBaseCode encodes a base as a symbol code (anything other than ACGT is N)
+func fmBaseCode(b byte) byte {
+	switch b {
+	case 'A', 'a':
+		return fmA
+	case 'C', 'c':
+		return fmC
+	case 'G', 'g':
+		return fmG
+	case 'T', 't', 'U', 'u':
+		return fmT
+	}
+	return fmN
+}
+
+// FMSequence is a named sequence (chromosome or contig) in an FM-index
+type FMSequence struct {
+	Name   string
+	Offset int64 // Start within the concatenated text of its index part
+	Length int64
+}
+
+// FMIndex is a BWT/FM-index over a set of sequences with a sampled suffix
+// array for locating matches. An index is built once (BuildFMIndex,
+// BuildFMIndexFromFASTA, WriteFMIndexFromFASTA), written to disk with Save,
+// and loaded with OpenFMIndex, which memory-maps the file instead of
+// reading it. Genomes longer than one part are indexed as several
+// independent parts, each holding whole sequences, and searched in turn.
+type FMIndex struct {
+	parts     []*fmPart
+	sequences []FMSequence
+	mapped    []byte // Memory-mapped file, nil if built in memory
+}
+
+// fmPart is a self-contained FM-index over some of the sequences
+type fmPart struct {
+	sequences   []FMSequence
+	first       int    // Index of sequences[0] among all sequences of the index
+	text        []byte // Symbol codes of the concatenated text (for extraction)
+	bwt         []byte // Burrows-Wheeler transform as symbol codes
+	c           [fmSymbols + 1]int64
+	occ         []uint32 // Checkpointed occurrence counts, fmSymbols per checkpoint
+	occInterval int
+	saSamples   []uint32 // SA values for rows that are multiples of saRate
+	saRate      int
+}
+
+// fmPartBuilder groups streamed sequences into parts of at most limit
+// symbols, handing each part to emit as soon as the next sequence does not
+// fit, so only one part is held in memory while building
+type fmPartBuilder struct {
+	limit     int
+	text      []int32
+	sequences []FMSequence
+	first     int
+	emit      func(*fmPart) error
+}
+
+// add appends a sequence to the pending part
+func (b *fmPartBuilder) add(name string, seq []byte) error {
+	// Room for a separator before and the sentinel after the sequence
+	if len(seq)+2 > b.limit {
+		return fmt.Errorf("sequence %s too long for an index part (%d bases, max %d)", name, len(seq), b.limit-2)
+	}
+	if len(b.sequences) > 0 && len(b.text)+len(seq)+2 > b.limit {
+		if err := b.flush(); err != nil {
+			return err
+		}
+	}
+
+	// Sequences are separated by N so that no match spans two of them
+	if len(b.sequences) > 0 {
+		b.text = append(b.text, fmN)
+	}
+	b.sequences = append(b.sequences, FMSequence{
+		Name:   name,
+		Offset: int64(len(b.text)),
+		Length: int64(len(seq)),
+	})
+	for _, base := range seq {
+		b.text = append(b.text, int32(fmBaseCode(base)))
+	}
+	return nil
+}
+
+// flush builds and emits the pending part, if any
+func (b *fmPartBuilder) flush() error {
+	if len(b.sequences) == 0 {
+		return nil
+	}
+
+	text := append(b.text, fmSentinel)
+	part := &fmPart{
+		sequences:   b.sequences,
+		first:       b.first,
+		occInterval: fmDefaultOccInterval,
+		saRate:      fmDefaultSARate,
+	}
+	part.build(text, buildSuffixArray(text, fmSymbols))
+
+	b.first += len(b.sequences)
+	b.text = b.text[:0]
+	b.sequences = nil
+	return b.emit(part)
+}
+
+// addPart appends a part to the index
+func (idx *FMIndex) addPart(part *fmPart) error {
+	part.first = len(idx.sequences)
+	idx.parts = append(idx.parts, part)
+	idx.sequences = append(idx.sequences, part.sequences...)
+	return nil
+}
+
+// BuildFMIndex builds an FM-index over the given named sequences
+func BuildFMIndex(names []string, sequences []string) (*FMIndex, error) {
+	if len(names) != len(sequences) {
+		return nil, fmt.Errorf("got %d names for %d sequences", len(names), len(sequences))
+	}
+
+	idx := &FMIndex{}
+	builder := &fmPartBuilder{limit: fmPartLength, emit: idx.addPart}
+	for i, seq := range sequences {
+		if err := builder.add(names[i], []byte(seq)); err != nil {
+			return nil, err
+		}
+	}
+	if err := builder.flush(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// BuildFMIndexFromFASTA builds an FM-index from a (optionally gzipped)
+// FASTA file, reading one sequence at a time. The whole index is kept in
+// memory; use WriteFMIndexFromFASTA for large genomes.
+func BuildFMIndexFromFASTA(path string) (*FMIndex, error) {
+	idx := &FMIndex{}
+	builder := &fmPartBuilder{limit: fmPartLength, emit: idx.addPart}
+	if err := reference.ReadSequences(path, builder.add); err != nil {
+		return nil, err
+	}
+	if err := builder.flush(); err != nil {
+		return nil, err
+	}
+	if len(idx.sequences) == 0 {
+		return nil, fmt.Errorf("no sequences found in %s", path)
+	}
+	return idx, nil
+}
+
+// WriteFMIndexFromFASTA indexes a (optionally gzipped) FASTA file straight
+// to outPath, writing each part as soon as it is built so that memory use
+// is bounded by one part rather than the genome. It returns the indexed
+// sequences; the file is loaded with OpenFMIndex.
+func WriteFMIndexFromFASTA(fastaPath, outPath string) ([]FMSequence, error) {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index file: %w", err)
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	cw := &countingWriter{w: w}
+	cw.Write([]byte(fmMagic))
+
+	var sequences []FMSequence
+	builder := &fmPartBuilder{limit: fmPartLength, emit: func(part *fmPart) error {
+		sequences = append(sequences, part.sequences...)
+		return part.writeTo(cw)
+	}}
+	err = reference.ReadSequences(fastaPath, builder.add)
+	if err == nil {
+		err = builder.flush()
+	}
+	if err == nil && len(sequences) == 0 {
+		err = fmt.Errorf("no sequences found in %s", fastaPath)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(outPath)
+		return nil, err
+	}
+	return sequences, f.Close()
+}
+
+// build derives the BWT, occurrence checkpoints and SA samples from the suffix array
+func (p *fmPart) build(text []int32, sa []int32) {
+	n := len(text)
+	p.text = make([]byte, n)
+	p.bwt = make([]byte, n)
+
+	var counts [fmSymbols]int64
+	for i, c := range text {
+		p.text[i] = byte(c)
+		counts[c]++
+	}
+	for c := 0; c < fmSymbols; c++ {
+		p.c[c+1] = p.c[c] + counts[c]
+	}
+
+	checkpoints := n/p.occInterval + 1
+	p.occ = make([]uint32, checkpoints*fmSymbols)
+	p.saSamples = make([]uint32, (n+p.saRate-1)/p.saRate)
+
+	var running [fmSymbols]uint32
+	for i := 0; i < n; i++ {
+		if i%p.occInterval == 0 {
+			copy(p.occ[(i/p.occInterval)*fmSymbols:], running[:])
+		}
+		if i%p.saRate == 0 {
+			p.saSamples[i/p.saRate] = uint32(sa[i])
+		}
+
+		sym := byte(fmSentinel)
+		if sa[i] > 0 {
+			sym = byte(text[sa[i]-1])
+		}
+		p.bwt[i] = sym
+		running[sym]++
+	}
+	if n%p.occInterval == 0 {
+		copy(p.occ[(n/p.occInterval)*fmSymbols:], running[:])
+	}
+}
+
+// Sequences returns the sequences in the index
+func (idx *FMIndex) Sequences() []FMSequence {
+	return idx.sequences
+}
+
+// Len returns the length of the indexed text, including separators
+func (idx *FMIndex) Len() int {
+	n := 0
+	for _, part := range idx.parts {
+		n += len(part.bwt)
+	}
+	return n
+}
+
+// occurrences returns the number of symbol c in bwt[0:i]
+func (p *fmPart) occurrences(c byte, i int) int {
+	cp := i / p.occInterval
+	count := int(p.occ[cp*fmSymbols+int(c)])
+	for j := cp * p.occInterval; j < i; j++ {
+		if p.bwt[j] == c {
+			count++
+		}
+	}
+	return count
+}
+
+// extend narrows the row range [lo, hi) to suffixes preceded by symbol c
+func (p *fmPart) extend(c byte, lo, hi int) (int, int) {
+	base := int(p.c[c])
+	return base + p.occurrences(c, lo), base + p.occurrences(c, hi)
+}
+
+// fullRange returns the row range matching the empty string
+func (p *fmPart) fullRange() (int, int) {
+	return 0, len(p.bwt)
+}
+
+// locate returns the text position of the suffix at the given row
+func (p *fmPart) locate(row int) int {
+	steps := 0
+	for row%p.saRate != 0 {
+		c := p.bwt[row]
+		if c == fmSentinel {
+			return steps // Suffix starting at text position 0
+		}
+		row = int(p.c[c]) + p.occurrences(c, row)
+		steps++
+	}
+	return int(p.saSamples[row/p.saRate]) + steps
+}
+
+// Count returns the number of exact occurrences of pattern
+func (idx *FMIndex) Count(pattern string) int {
+	count := 0
+	for _, part := range idx.parts {
+		count += part.count(pattern)
+	}
+	return count
+}
+
+// count returns the number of exact occurrences of pattern in the part
+func (p *fmPart) count(pattern string) int {
+	lo, hi := p.fullRange()
+	for i := len(pattern) - 1; i >= 0 && lo < hi; i-- {
+		c := fmBaseCode(pattern[i])
+		if c == fmN {
+			return 0
+		}
+		lo, hi = p.extend(c, lo, hi)
+	}
+	return hi - lo
+}
+
+// resolve maps a text position to a sequence index within the part and offset within it
+func (p *fmPart) resolve(pos int64) (int, int64, bool) {
+	i := sort.Search(len(p.sequences), func(i int) bool {
+		return p.sequences[i].Offset > pos
+	}) - 1
+	if i < 0 || pos >= p.sequences[i].Offset+p.sequences[i].Length {
+		return 0, 0, false
+	}
+	return i, pos - p.sequences[i].Offset, true
+}
+
+// Extract returns length bases of the named sequence starting at start (0-based)
+func (idx *FMIndex) Extract(name string, start, length int64) (string, error) {
+	for _, part := range idx.parts {
+		for _, seq := range part.sequences {
+			if seq.Name != name {
+				continue
+			}
+			if start < 0 || length < 0 || start+length > seq.Length {
+				return "", fmt.Errorf("range %d-%d outside %s (length %d)", start, start+length, name, seq.Length)
+			}
+			return part.decode(seq.Offset+start, length), nil
+		}
+	}
+	return "", fmt.Errorf("sequence %q not in index", name)
+}
+
+// decode converts a text range back to bases
+func (p *fmPart) decode(pos, length int64) string {
+	out := make([]byte, length)
+	for i := range out {
+		out[i] = fmCodeToBase[p.text[pos+int64(i)]]
+	}
+	return string(out)
+}
+
+// Save writes the index to path
+func (idx *FMIndex) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create index file: %w", err)
+	}
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	if _, err := idx.WriteTo(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write index file: %w", err)
+	}
+	return f.Close()
+}
+
+// WriteTo serializes the index. All sections are 8-byte aligned so the
+// file can be memory-mapped and used in place.
+//
+// Layout (little-endian): magic[8] followed by one record per part, to the
+// end of the file:
+//
+//	saRate:u32 occInterval:u32 n:u64 numSeqs:u32
+//	numSeqs × (nameLen:u32 name offset:u64 length:u64)   pad to 8
+//	C[7]:u64
+//	text[n]      pad to 8
+//	bwt[n]       pad to 8
+//	occ[(n/occInterval+1)*6]:u32   pad to 8
+//	saSamples[ceil(n/saRate)]:u32  pad to 8
+func (idx *FMIndex) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	cw.Write([]byte(fmMagic))
+	for _, part := range idx.parts {
+		if err := part.writeTo(cw); err != nil {
+			return cw.n, err
+		}
+	}
+	if cw.err != nil {
+		return cw.n, fmt.Errorf("failed to write index: %w", cw.err)
+	}
+	return cw.n, nil
+}
+
+// writeTo serializes one part record
+func (p *fmPart) writeTo(cw *countingWriter) error {
+	le := binary.LittleEndian
+
+	var header bytes.Buffer
+	binary.Write(&header, le, uint32(p.saRate))
+	binary.Write(&header, le, uint32(p.occInterval))
+	binary.Write(&header, le, uint64(len(p.bwt)))
+	binary.Write(&header, le, uint32(len(p.sequences)))
+	for _, seq := range p.sequences {
+		binary.Write(&header, le, uint32(len(seq.Name)))
+		header.WriteString(seq.Name)
+		binary.Write(&header, le, uint64(seq.Offset))
+		binary.Write(&header, le, uint64(seq.Length))
+	}
+	cw.Write(header.Bytes())
+	cw.pad()
+
+	for _, c := range p.c {
+		binary.Write(cw, le, uint64(c))
+	}
+	cw.Write(p.text)
+	cw.pad()
+	cw.Write(p.bwt)
+	cw.pad()
+	binary.Write(cw, le, p.occ)
+	cw.pad()
+	binary.Write(cw, le, p.saSamples)
+	cw.pad()
+
+	if cw.err != nil {
+		return fmt.Errorf("failed to write index: %w", cw.err)
+	}
+	return nil
+}
+
+// OpenFMIndex memory-maps an index written by Save or WriteFMIndexFromFASTA
+func OpenFMIndex(path string) (*FMIndex, error) {
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map index %s: %w", path, err)
+	}
+
+	idx, err := parseFMIndex(data)
+	if err != nil {
+		unmapFile(data)
+		return nil, fmt.Errorf("invalid index %s: %w", path, err)
+	}
+	idx.mapped = data
+	return idx, nil
+}
+
+// Close releases the memory mapping, if any. The index must not be used afterwards.
+func (idx *FMIndex) Close() error {
+	if idx.mapped == nil {
+		return nil
+	}
+	data := idx.mapped
+	idx.mapped = nil
+	idx.parts = nil
+	return unmapFile(data)
+}
+
+// parseFMIndex decodes an index from serialized bytes, referencing data in place
+func parseFMIndex(data []byte) (*FMIndex, error) {
+	r := &sliceReader{data: data}
+	if string(r.next(len(fmMagic))) != fmMagic {
+		return nil, fmt.Errorf("bad magic")
+	}
+
+	idx := &FMIndex{}
+	for r.err == nil && r.off < len(data) {
+		part, err := parseFMPart(r)
+		if err != nil {
+			return nil, err
+		}
+		idx.addPart(part)
+	}
+	if len(idx.parts) == 0 {
+		return nil, fmt.Errorf("no index parts")
+	}
+	return idx, nil
+}
+
+// parseFMPart decodes one part record
+func parseFMPart(r *sliceReader) (*fmPart, error) {
+	le := binary.LittleEndian
+	p := &fmPart{
+		saRate:      int(le.Uint32(r.next(4))),
+		occInterval: int(le.Uint32(r.next(4))),
+	}
+	n := int(le.Uint64(r.next(8)))
+	numSeqs := int(le.Uint32(r.next(4)))
+	if r.err != nil || p.saRate <= 0 || p.occInterval <= 0 || n <= 0 || n > math.MaxInt32 {
+		return nil, fmt.Errorf("corrupt part header at offset %d", r.off)
+	}
+
+	for i := 0; i < numSeqs && r.err == nil; i++ {
+		nameLen := int(le.Uint32(r.next(4)))
+		name := string(r.next(nameLen))
+		offset := int64(le.Uint64(r.next(8)))
+		length := int64(le.Uint64(r.next(8)))
+		p.sequences = append(p.sequences, FMSequence{Name: name, Offset: offset, Length: length})
+	}
+	r.align()
+
+	for i := range p.c {
+		p.c[i] = int64(le.Uint64(r.next(8)))
+	}
+	p.text = r.next(n)
+	r.align()
+	p.bwt = r.next(n)
+	r.align()
+	p.occ = r.uint32s((n/p.occInterval + 1) * fmSymbols)
+	r.align()
+	p.saSamples = r.uint32s((n + p.saRate - 1) / p.saRate)
+	r.align()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return p, nil
+}
+
+// countingWriter tracks bytes written and the first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// pad writes zero bytes up to the next 8-byte boundary
+func (cw *countingWriter) pad() {
+	if rem := cw.n % 8; rem != 0 {
+		cw.Write(make([]byte, 8-rem))
+	}
+}
+
+// sliceReader reads consecutive fields from a byte slice without copying
+type sliceReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *sliceReader) next(n int) []byte {
+	if r.err != nil || n < 0 || r.off+n > len(r.data) {
+		if r.err == nil {
+			r.err = fmt.Errorf("truncated index at offset %d", r.off)
+		}
+		return make([]byte, max(n, 0))
+	}
+	b := r.data[r.off : r.off+n : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *sliceReader) align() {
+	if rem := r.off % 8; rem != 0 {
+		r.next(8 - rem)
+	}
+}
+
+// uint32s returns count little-endian uint32 values, in place when the host
+// is little-endian and the data is aligned
+func (r *sliceReader) uint32s(count int) []uint32 {
+	b := r.next(count * 4)
+	if r.err != nil || count == 0 {
+		return nil
+	}
+	if binary.NativeEndian.Uint16([]byte{1, 0}) == 1 && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), count)
+	}
+	out := make([]uint32, count)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return out
+}
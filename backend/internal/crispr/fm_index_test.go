@@ -0,0 +1,333 @@
+package crispr
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// randomDNA returns a reproducible random sequence
+func randomDNA(rng *rand.Rand, n int) string {
+	bases := []byte("ACGT")
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = bases[rng.Intn(4)]
+	}
+	return string(out)
+}
+
+// TestSuffixArray compares SA-IS against a naive sort
+func TestSuffixArray(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for trial := 0; trial < 50; trial++ {
+		n := 1 + rng.Intn(300)
+		text := make([]int32, n+1)
+		for i := 0; i < n; i++ {
+			// Low-entropy texts exercise the recursive step
+			text[i] = int32(1 + rng.Intn(1+trial%4))
+		}
+
+		sa := buildSuffixArray(text, fmSymbols)
+
+		naive := make([]int32, len(text))
+		for i := range naive {
+			naive[i] = int32(i)
+		}
+		sort.Slice(naive, func(a, b int) bool {
+			x, y := text[naive[a]:], text[naive[b]:]
+			for i := 0; i < len(x) && i < len(y); i++ {
+				if x[i] != y[i] {
+					return x[i] < y[i]
+				}
+			}
+			return len(x) < len(y)
+		})
+
+		for i := range sa {
+			if sa[i] != naive[i] {
+				t.Fatalf("Trial %d: suffix array differs at %d: got %d, want %d", trial, i, sa[i], naive[i])
+			}
+		}
+	}
+}
+
+// TestFMIndexCountAndExtract tests exact counting, locating and extraction
+func TestFMIndexCountAndExtract(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	chr1 := randomDNA(rng, 2000)
+	chr2 := randomDNA(rng, 1500)
+
+	idx, err := BuildFMIndex([]string{"chr1", "chr2"}, []string{chr1, chr2})
+	if err != nil {
+		t.Fatalf("BuildFMIndex failed: %v", err)
+	}
+
+	for _, pattern := range []string{chr1[100:112], chr2[700:708], "ACGT", "GATTACA"} {
+		// Count overlapping occurrences
+		want := 0
+		for _, seq := range []string{chr1, chr2} {
+			for i := 0; i+len(pattern) <= len(seq); i++ {
+				if seq[i:i+len(pattern)] == pattern {
+					want++
+				}
+			}
+		}
+		if got := idx.Count(pattern); got != want {
+			t.Errorf("Count(%s) = %d, want %d", pattern, got, want)
+		}
+	}
+
+	// A match must not span the boundary between two sequences
+	if got := idx.Count(chr1[1990:] + chr2[:10]); got != 0 {
+		t.Errorf("Expected no match across sequences, got %d", got)
+	}
+
+	got, err := idx.Extract("chr2", 1490, 10)
+	if err != nil || got != chr2[1490:] {
+		t.Errorf("Extract = %q, %v", got, err)
+	}
+	if _, err := idx.Extract("chr2", 1495, 10); err == nil {
+		t.Error("Expected error for range past the end")
+	}
+}
+
+// TestFMIndexSaveOpen tests the on-disk format round trip
+func TestFMIndexSaveOpen(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	chr := randomDNA(rng, 5000)
+
+	built, err := BuildFMIndex([]string{"chrX"}, []string{chr})
+	if err != nil {
+		t.Fatalf("BuildFMIndex failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "genome.fmi")
+	if err := built.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	opened, err := OpenFMIndex(path)
+	if err != nil {
+		t.Fatalf("OpenFMIndex failed: %v", err)
+	}
+	defer opened.Close()
+
+	if opened.Len() != built.Len() || len(opened.Sequences()) != 1 || opened.Sequences()[0].Name != "chrX" {
+		t.Fatalf("Unexpected index header: %d bases, %+v", opened.Len(), opened.Sequences())
+	}
+
+	pattern := chr[4321:4341]
+	guide := GuideRNA{Sequence: pattern, Chromosome: "chrX", Position: 4321, Enzyme: Cas9}
+	builtHits := built.SearchSite(guide.Sequence, "NNN", true, FMSearchOptions{MaxMismatches: 2})
+	openedHits := opened.SearchSite(guide.Sequence, "NNN", true, FMSearchOptions{MaxMismatches: 2})
+	if len(builtHits) == 0 || len(builtHits) != len(openedHits) {
+		t.Fatalf("Expected identical hits, got %d and %d", len(builtHits), len(openedHits))
+	}
+	for i := range builtHits {
+		if builtHits[i].Start != openedHits[i].Start || builtHits[i].Strand != openedHits[i].Strand {
+			t.Errorf("Hit %d differs: %+v vs %+v", i, builtHits[i], openedHits[i])
+		}
+	}
+}
+
+// TestFMOffTargetSearch tests mismatches, bulges and reverse-strand sites
+func TestFMOffTargetSearch(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	guide := "GACGCATAAAGATGAGACGC"
+
+	// Variants of the guide planted at known positions
+	mismatch := "GACGCATAAAGATGTGACGC"  // Mismatch at position 14
+	dnaBulge := "GACGCATAAAGAATGAGACGC" // Extra A after position 11
+	rnaBulge := "GACGCATAAGATGAGACGC"   // Position 9 (A) missing
+
+	segments := []string{
+		randomDNA(rng, 300), guide + "TGG",
+		randomDNA(rng, 300), mismatch + "AGG",
+		randomDNA(rng, 300), reverseComplement(guide + "CGG"),
+		randomDNA(rng, 300), dnaBulge + "GGG",
+		randomDNA(rng, 300), rnaBulge + "TGG",
+		randomDNA(rng, 300), guide + "TCC", // No PAM
+		randomDNA(rng, 300),
+	}
+	genome := strings.Join(segments, "")
+	position := func(site string) int {
+		return strings.Index(genome, site)
+	}
+
+	predictor := NewOffTargetPredictor(2)
+	predictor.SetBulges(1, 1)
+	predictor.genomeIndex.IndexSequence("chr1", genome)
+
+	onTarget := position(guide + "TGG")
+	offTargets := predictor.FindOffTargets(GuideRNA{
+		Sequence:   guide,
+		Chromosome: "chr1",
+		Position:   onTarget,
+		Enzyme:     Cas9,
+	})
+
+	found := make(map[int]OffTargetSite)
+	for _, ot := range offTargets {
+		found[ot.Position] = ot
+		t.Logf("Off-target %s:%d%s %s (%d mm, %d/%d bulges, CFD %.3f)",
+			ot.Chromosome, ot.Position, ot.Strand, ot.Sequence, ot.Mismatches, ot.DNABulges, ot.RNABulges, ot.Score)
+	}
+
+	if _, exists := found[onTarget]; exists {
+		t.Error("On-target site should be excluded")
+	}
+	if _, exists := found[position(guide+"TCC")]; exists {
+		t.Error("Site without a PAM should be excluded")
+	}
+
+	if ot, exists := found[position(mismatch)]; !exists || ot.Mismatches != 1 || len(ot.MismatchPos) != 1 || ot.MismatchPos[0] != 14 || ot.Strand != "+" {
+		t.Errorf("Mismatch site not reported correctly: %+v", ot)
+	}
+
+	reversePos := position(reverseComplement(guide+"CGG")) + 3
+	if ot, exists := found[reversePos]; !exists || ot.Strand != "-" || ot.Mismatches != 0 || ot.Sequence != guide {
+		t.Errorf("Reverse-strand site not reported correctly: %+v", ot)
+	}
+
+	if ot, exists := found[position(dnaBulge)]; !exists || ot.DNABulges != 1 || ot.Mismatches != 0 || ot.Sequence != dnaBulge {
+		t.Errorf("DNA bulge site not reported correctly: %+v", ot)
+	}
+
+	if ot, exists := found[position(rnaBulge)]; !exists || ot.RNABulges != 1 || ot.Mismatches != 0 || ot.Sequence != rnaBulge {
+		t.Errorf("RNA bulge site not reported correctly: %+v", ot)
+	}
+
+	// Without bulges only the mismatch and reverse-strand sites remain
+	predictor.SetBulges(0, 0)
+	for _, ot := range predictor.FindOffTargets(GuideRNA{Sequence: guide, Chromosome: "chr1", Position: onTarget, Enzyme: Cas9}) {
+		if ot.DNABulges != 0 || ot.RNABulges != 0 {
+			t.Errorf("Unexpected bulged site with bulges disabled: %+v", ot)
+		}
+	}
+}
+
+// TestFMSearch5PrimePAM tests enzymes with the PAM upstream of the protospacer
+func TestFMSearch5PrimePAM(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	guide := "GACGCATAAAGATGAGACGCTGA" // 23bp Cas12a guide
+
+	genome := randomDNA(rng, 200) + reverseComplement("TTTA"+guide) + randomDNA(rng, 200)
+	idx, err := BuildFMIndex([]string{"chr1"}, []string{genome})
+	if err != nil {
+		t.Fatalf("BuildFMIndex failed: %v", err)
+	}
+
+	pam := GetPAMSequence(Cas12a)
+	hits := idx.SearchSite(guide, pam.IUPAC, pam.Orientation == "3prime", FMSearchOptions{})
+	if len(hits) != 1 {
+		t.Fatalf("Expected one hit, got %+v", hits)
+	}
+	if hits[0].Strand != "-" || hits[0].Start != 200 || hits[0].PAM != "TTTA" || hits[0].Protospacer != guide {
+		t.Errorf("Unexpected hit: %+v", hits[0])
+	}
+}
+
+// TestFMIndexParts tests that an index split into parts matches a single
+// index, in memory and when streamed from a FASTA file
+func TestFMIndexParts(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	guide := "GACGCATAAAGATGAGACGC"
+	names := []string{"chr1", "chr2", "chr3", "chrM"}
+	var sequences []string
+	var fasta strings.Builder
+	for i, name := range names {
+		seq := randomDNA(rng, 900+300*i) + guide + "AGG" + randomDNA(rng, 200) + reverseComplement(guide+"TGG")
+		sequences = append(sequences, seq)
+		fasta.WriteString(">" + name + " test\n")
+		for j := 0; j < len(seq); j += 60 {
+			fasta.WriteString(seq[j:min(j+60, len(seq))] + "\n")
+		}
+	}
+
+	single, err := BuildFMIndex(names, sequences)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(length int) { fmPartLength = length }(fmPartLength)
+	fmPartLength = 3000
+	split, err := BuildFMIndex(names, sequences)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single.parts) != 1 || len(split.parts) != 3 || split.Len() != single.Len() {
+		t.Fatalf("Expected 1 and 3 parts, got %d and %d (%d vs %d bases)", len(single.parts), len(split.parts), single.Len(), split.Len())
+	}
+	if _, err := BuildFMIndex([]string{"big"}, []string{randomDNA(rng, 3000)}); err == nil {
+		t.Error("Expected error for a sequence longer than a part")
+	}
+
+	dir := t.TempDir()
+	fastaPath := filepath.Join(dir, "genome.fa")
+	if err := os.WriteFile(fastaPath, []byte(fasta.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(dir, "genome.fmi")
+	written, err := WriteFMIndexFromFASTA(fastaPath, indexPath)
+	if err != nil || len(written) != len(names) {
+		t.Fatalf("WriteFMIndexFromFASTA = %v, %v", written, err)
+	}
+	streamed, err := OpenFMIndex(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer streamed.Close()
+
+	for _, idx := range []*FMIndex{split, streamed} {
+		for i, seq := range idx.Sequences() {
+			if seq.Name != names[i] || seq.Length != int64(len(sequences[i])) {
+				t.Errorf("Sequence %d = %+v", i, seq)
+			}
+			if got, err := idx.Extract(seq.Name, 100, 50); err != nil || got != sequences[i][100:150] {
+				t.Errorf("Extract(%s) = %q, %v", seq.Name, got, err)
+			}
+		}
+		for _, pattern := range []string{guide, "ACGTA", sequences[3][500:520]} {
+			if got, want := idx.Count(pattern), single.Count(pattern); got != want {
+				t.Errorf("Count(%s) = %d, want %d", pattern, got, want)
+			}
+		}
+
+		want := single.SearchSite(guide, "NGG", true, FMSearchOptions{MaxMismatches: 2, MaxDNABulges: 1})
+		got := idx.SearchSite(guide, "NGG", true, FMSearchOptions{MaxMismatches: 2, MaxDNABulges: 1})
+		if len(want) < 2*len(names) || len(got) != len(want) {
+			t.Fatalf("Expected %d hits, got %d", len(want), len(got))
+		}
+		for i := range want {
+			if got[i].Sequence != want[i].Sequence || got[i].Start != want[i].Start || got[i].Strand != want[i].Strand || got[i].Protospacer != want[i].Protospacer {
+				t.Errorf("Hit %d = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+}
+
+// TestFMSearchStrandBudget tests that MaxHits is applied to each strand
+func TestFMSearchStrandBudget(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	guide := "GACGCATAAAGATGAGACGC"
+	var segments []string
+	for i := 0; i < 5; i++ {
+		segments = append(segments, randomDNA(rng, 100), guide+"TGG", randomDNA(rng, 100), reverseComplement(guide+"AGG"))
+	}
+	idx, err := BuildFMIndex([]string{"chr1"}, []string{strings.Join(segments, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strands := map[string]int{}
+	for _, hit := range idx.SearchSite(guide, "NGG", true, FMSearchOptions{MaxHits: 3}) {
+		strands[hit.Strand]++
+	}
+	if strands["+"] < 3 || strands["-"] < 3 {
+		t.Errorf("Expected at least 3 hits on each strand, got %v", strands)
+	}
+}
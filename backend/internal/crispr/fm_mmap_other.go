@@ -0,0 +1,15 @@
+//go:build !unix
+
+package crispr
+
+import "os"
+
+// mapFile reads the whole file on platforms without mmap support
+func mapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// unmapFile is a no-op for files read into memory
+func unmapFile(data []byte) error {
+	return nil
+}
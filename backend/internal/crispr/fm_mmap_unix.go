@@ -0,0 +1,37 @@
+//go:build unix
+
+package crispr
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile memory-maps a file read-only
+func mapFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("file too large to map (%d bytes)", size)
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile releases a mapping created by mapFile
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
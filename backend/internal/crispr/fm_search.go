@@ -0,0 +1,354 @@
+package crispr
+
+import (
+	"sort"
+)
+
+// FMSearchOptions bounds an approximate guide+PAM search
+type FMSearchOptions struct {
+	MaxMismatches int // Mismatches allowed in the guide (never in the PAM)
+	MaxDNABulges  int // Extra genomic bases with no guide partner
+	MaxRNABulges  int // Guide bases with no genomic partner
+	MaxHits       int // Stop after this many candidate sites per strand (default 10000)
+}
+
+// FMHit is a genomic site matching a guide and PAM
+type FMHit struct {
+	Sequence    string // Chromosome / contig name
+	Start       int64  // 0-based start of the protospacer on the + strand (PAM excluded)
+	End         int64  // Exclusive end of the protospacer
+	Strand      string // "+" or "-"
+	Protospacer string // Genomic protospacer in guide orientation
+	PAM         string // Genomic PAM in guide orientation
+	Aligned     string // Genomic base paired with each guide position ('-' for RNA bulges)
+	Mismatches  int
+	MismatchPos []int // Guide positions (0-based) of mismatches
+	DNABulges   int
+	RNABulges   int
+	BulgePos    []int // Guide positions of bulges
+}
+
+// Edits returns the total number of mismatches and bulged bases
+func (h FMHit) Edits() int {
+	return h.Mismatches + h.DNABulges + h.RNABulges
+}
+
+// fmPatternBase is one position of a search pattern in text orientation
+type fmPatternBase struct {
+	mask     uint8 // Allowed symbol codes as a bit set
+	guidePos int   // Position in the guide, -1 for PAM bases
+}
+
+// fmEdit is one step of an alignment, recorded right to left
+type fmEdit struct {
+	kind     byte // 'M' match, 'X' mismatch, 'D' DNA bulge, 'R' RNA bulge
+	guidePos int
+	base     byte // Genomic symbol code (0 for RNA bulges)
+}
+
+// fmRawHit is a row range reached by one alignment
+type fmRawHit struct {
+	lo, hi int
+	edits  []fmEdit
+}
+
+// fmSearcher runs a backtracking backward search for one strand of an index part
+type fmSearcher struct {
+	part    *fmPart
+	pattern []fmPatternBase
+	opts    FMSearchOptions
+	edits   []fmEdit
+	results []fmRawHit
+	rows    int
+}
+
+// iupacMask returns the symbol set for an IUPAC nucleotide code
+func iupacMask(b byte) uint8 {
+	const a, c, g, t = 1 << fmA, 1 << fmC, 1 << fmG, 1 << fmT
+	switch b {
+	case 'A':
+		return a
+	case 'C':
+		return c
+	case 'G':
+		return g
+	case 'T', 'U':
+		return t
+	case 'R':
+		return a | g
+	case 'Y':
+		return c | t
+	case 'S':
+		return c | g
+	case 'W':
+		return a | t
+	case 'K':
+		return g | t
+	case 'M':
+		return a | c
+	case 'B':
+		return c | g | t
+	case 'D':
+		return a | g | t
+	case 'H':
+		return a | c | t
+	case 'V':
+		return a | c | g
+	}
+	return a | c | g | t // N and anything unknown
+}
+
+// complementMask swaps A<->T and C<->G in a symbol set
+func complementMask(m uint8) uint8 {
+	var out uint8
+	pairs := [][2]uint8{{fmA, fmT}, {fmT, fmA}, {fmC, fmG}, {fmG, fmC}}
+	for _, p := range pairs {
+		if m&(1<<p[0]) != 0 {
+			out |= 1 << p[1]
+		}
+	}
+	return out
+}
+
+// complementCode complements a symbol code
+func complementCode(c byte) byte {
+	switch c {
+	case fmA:
+		return fmT
+	case fmT:
+		return fmA
+	case fmC:
+		return fmG
+	case fmG:
+		return fmC
+	}
+	return c
+}
+
+// SearchSite finds sites on both strands matching guide with the PAM (IUPAC)
+// on its 3' side (pamThreePrime, e.g. SpCas9 NGG) or 5' side (e.g. Cas12a TTTV),
+// allowing mismatches and DNA/RNA bulges in the guide. The PAM must match exactly.
+func (idx *FMIndex) SearchSite(guide, pam string, pamThreePrime bool, opts FMSearchOptions) []FMHit {
+	if opts.MaxHits <= 0 {
+		opts.MaxHits = 10000
+	}
+
+	// Pattern in guide orientation (= text orientation for the + strand)
+	var forward []fmPatternBase
+	guideBases := make([]fmPatternBase, len(guide))
+	for i := 0; i < len(guide); i++ {
+		guideBases[i] = fmPatternBase{mask: iupacMask(toUpperBase(guide[i])), guidePos: i}
+	}
+	pamBases := make([]fmPatternBase, len(pam))
+	for i := 0; i < len(pam); i++ {
+		pamBases[i] = fmPatternBase{mask: iupacMask(toUpperBase(pam[i])), guidePos: -1}
+	}
+	if pamThreePrime {
+		forward = append(append(forward, guideBases...), pamBases...)
+	} else {
+		forward = append(append(forward, pamBases...), guideBases...)
+	}
+
+	// The - strand site appears in the text as the reverse complement
+	reverse := make([]fmPatternBase, len(forward))
+	for i, p := range forward {
+		reverse[len(forward)-1-i] = fmPatternBase{mask: complementMask(p.mask), guidePos: p.guidePos}
+	}
+
+	type candidate struct {
+		hit      FMHit
+		seqIdx   int
+		pamStart int64
+	}
+	var candidates []candidate
+
+	// Each strand has its own MaxHits budget, shared by the index parts
+	for _, strand := range []string{"+", "-"} {
+		pattern := forward
+		if strand == "-" {
+			pattern = reverse
+		}
+
+		rows := 0
+		for _, part := range idx.parts {
+			s := &fmSearcher{part: part, pattern: pattern, opts: opts, rows: rows}
+			lo, hi := part.fullRange()
+			s.search(len(pattern)-1, lo, hi, 0, 0, 0, 0)
+			rows = s.rows
+
+			for _, raw := range s.results {
+				for row := raw.lo; row < raw.hi; row++ {
+					hit, seqIdx, pamStart, ok := part.buildHit(raw.edits, part.locate(row), len(guide), len(pam), pamThreePrime, strand)
+					if ok {
+						candidates = append(candidates, candidate{hit, part.first + seqIdx, pamStart})
+					}
+				}
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].hit, candidates[j].hit
+		if betterHit(a, b) != betterHit(b, a) {
+			return betterHit(a, b)
+		}
+		if a.Sequence != b.Sequence {
+			return a.Sequence < b.Sequence
+		}
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		return a.Strand < b.Strand
+	})
+
+	// Alignments sharing a PAM or a protospacer start are the same site
+	// shifted by a bulge; keep only the one with the fewest edits
+	type siteKey struct {
+		seq    int
+		pos    int64
+		strand string
+		pam    bool
+	}
+	claimed := make(map[siteKey]bool)
+	var hits []FMHit
+	for _, c := range candidates {
+		pamKey := siteKey{c.seqIdx, c.pamStart, c.hit.Strand, true}
+		startKey := siteKey{c.seqIdx, c.hit.Start, c.hit.Strand, false}
+		if claimed[pamKey] || claimed[startKey] {
+			continue
+		}
+		claimed[pamKey] = true
+		claimed[startKey] = true
+		hits = append(hits, c.hit)
+	}
+	return hits
+}
+
+// betterHit prefers fewer edits, then fewer bulges
+func betterHit(a, b FMHit) bool {
+	if a.Edits() != b.Edits() {
+		return a.Edits() < b.Edits()
+	}
+	return a.DNABulges+a.RNABulges < b.DNABulges+b.RNABulges
+}
+
+// search extends the alignment of pattern[0..j] leftwards from row range [lo, hi)
+func (s *fmSearcher) search(j, lo, hi, mm, dna, rna int, last byte) {
+	if s.rows >= s.opts.MaxHits {
+		return
+	}
+	if j < 0 {
+		s.results = append(s.results, fmRawHit{lo: lo, hi: hi, edits: append([]fmEdit(nil), s.edits...)})
+		s.rows += hi - lo
+		return
+	}
+
+	p := s.pattern[j]
+	editable := p.guidePos >= 0
+	// Bulges are only placed between two guide bases
+	interiorRight := j+1 < len(s.pattern) && s.pattern[j+1].guidePos >= 0
+	interiorLeft := j > 0 && s.pattern[j-1].guidePos >= 0
+
+	for c := byte(fmA); c <= fmT; c++ {
+		nlo, nhi := s.part.extend(c, lo, hi)
+		if nlo >= nhi {
+			continue
+		}
+
+		if p.mask&(1<<c) != 0 {
+			s.edits = append(s.edits, fmEdit{kind: 'M', guidePos: p.guidePos, base: c})
+			s.search(j-1, nlo, nhi, mm, dna, rna, 'M')
+			s.edits = s.edits[:len(s.edits)-1]
+		} else if editable && mm < s.opts.MaxMismatches {
+			s.edits = append(s.edits, fmEdit{kind: 'X', guidePos: p.guidePos, base: c})
+			s.search(j-1, nlo, nhi, mm+1, dna, rna, 'X')
+			s.edits = s.edits[:len(s.edits)-1]
+		}
+
+		// DNA bulge: genomic base c sits between pattern[j] and pattern[j+1]
+		if editable && interiorRight && dna < s.opts.MaxDNABulges && last != 'R' {
+			s.edits = append(s.edits, fmEdit{kind: 'D', guidePos: p.guidePos, base: c})
+			s.search(j, nlo, nhi, mm, dna+1, rna, 'D')
+			s.edits = s.edits[:len(s.edits)-1]
+		}
+	}
+
+	// RNA bulge: guide base j has no genomic partner
+	if editable && interiorLeft && interiorRight && rna < s.opts.MaxRNABulges && last != 'D' {
+		s.edits = append(s.edits, fmEdit{kind: 'R', guidePos: p.guidePos})
+		s.search(j-1, lo, hi, mm, dna, rna+1, 'R')
+		s.edits = s.edits[:len(s.edits)-1]
+	}
+}
+
+// buildHit converts an alignment at text position pos into an FMHit,
+// also returning the sequence index within the part and PAM start
+func (p *fmPart) buildHit(edits []fmEdit, pos, guideLen, pamLen int, pamThreePrime bool, strand string) (FMHit, int, int64, bool) {
+	hit := FMHit{Strand: strand}
+	aligned := make([]byte, guideLen)
+
+	for _, e := range edits {
+		if e.guidePos < 0 {
+			continue
+		}
+		switch e.kind {
+		case 'M', 'X':
+			base := e.base
+			if strand == "-" {
+				base = complementCode(base)
+			}
+			aligned[e.guidePos] = fmCodeToBase[base]
+			if e.kind == 'X' {
+				hit.Mismatches++
+				hit.MismatchPos = append(hit.MismatchPos, e.guidePos)
+			}
+		case 'D':
+			hit.DNABulges++
+			hit.BulgePos = append(hit.BulgePos, e.guidePos)
+		case 'R':
+			aligned[e.guidePos] = '-'
+			hit.RNABulges++
+			hit.BulgePos = append(hit.BulgePos, e.guidePos)
+		}
+	}
+	sort.Ints(hit.MismatchPos)
+	sort.Ints(hit.BulgePos)
+	hit.Aligned = string(aligned)
+
+	siteLen := int64(guideLen + pamLen + hit.DNABulges - hit.RNABulges)
+	seqIdx, offset, ok := p.resolve(int64(pos))
+	if !ok || offset+siteLen > p.sequences[seqIdx].Length {
+		return hit, 0, 0, false
+	}
+	hit.Sequence = p.sequences[seqIdx].Name
+
+	// The PAM lies at the 3' end of the site in guide orientation when
+	// pamThreePrime; on the - strand guide orientation is reversed
+	pamAtRight := pamThreePrime == (strand == "+")
+	protoStart, protoLen := offset, siteLen-int64(pamLen)
+	pamStart := offset + protoLen
+	if !pamAtRight {
+		protoStart = offset + int64(pamLen)
+		pamStart = offset
+	}
+
+	seqOffset := p.sequences[seqIdx].Offset
+	hit.Start = protoStart
+	hit.End = protoStart + protoLen
+	hit.Protospacer = p.decode(seqOffset+protoStart, protoLen)
+	hit.PAM = p.decode(seqOffset+pamStart, int64(pamLen))
+	if strand == "-" {
+		hit.Protospacer = reverseComplement(hit.Protospacer)
+		hit.PAM = reverseComplement(hit.PAM)
+	}
+
+	return hit, seqIdx, pamStart, true
+}
+
+// toUpperBase upper-cases an ASCII base
+func toUpperBase(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - 'a' + 'A'
+	}
+	return b
+}
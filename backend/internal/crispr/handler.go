@@ -4,12 +4,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"genomevedic/internal/annotations"
+	"genomevedic/internal/reference"
 )
 
 // Handler handles HTTP requests for CRISPR design
 type Handler struct {
-	designers map[CasEnzyme]*Designer
-	exporter  *Exporter
+	designers     map[CasEnzyme]*Designer
+	exporter      *Exporter
+	genomeIndex   *GenomeIndex // Shared off-target index, nil for per-designer indexes
+	reference     *reference.FASTA
+	genes         *annotations.GTFParser
+	scorers       []OnTargetScorer // User-loaded on-target models
+	populationVCF string           // Default VCF for variant-aware requests
 }
 
 // NewHandler creates a new CRISPR handler
@@ -28,6 +36,67 @@ func NewHandler() *Handler {
 	}
 }
 
+// SetGenomeIndex makes every designer search the given genome for off-targets
+func (h *Handler) SetGenomeIndex(index *GenomeIndex) {
+	h.genomeIndex = index
+	for _, designer := range h.designers {
+		designer.SetGenomeIndex(index)
+	}
+}
+
+// SetReference makes every designer fetch coordinate and gene targets from ref
+func (h *Handler) SetReference(ref *reference.FASTA) {
+	h.reference = ref
+	for _, designer := range h.designers {
+		designer.SetReference(ref)
+	}
+}
+
+// RegisterScorer makes an on-target model selectable by every designer
+func (h *Handler) RegisterScorer(scorer OnTargetScorer) {
+	h.scorers = append(h.scorers, scorer)
+	for _, designer := range h.designers {
+		designer.RegisterScorer(scorer)
+	}
+}
+
+// SetPopulationVCF makes every designer use the VCF at path for
+// variant-aware requests that name none
+func (h *Handler) SetPopulationVCF(path string) {
+	h.populationVCF = path
+	for _, designer := range h.designers {
+		designer.SetPopulationVCF(path)
+	}
+}
+
+// SetAnnotations makes every designer resolve gene names with genes
+func (h *Handler) SetAnnotations(genes *annotations.GTFParser) {
+	h.genes = genes
+	h.exporter.SetAnnotations(genes)
+	for _, designer := range h.designers {
+		designer.SetAnnotations(genes)
+	}
+}
+
+// getDesigner returns the designer for an enzyme, creating it if needed
+func (h *Handler) getDesigner(enzyme CasEnzyme) *Designer {
+	designer, exists := h.designers[enzyme]
+	if !exists {
+		designer = NewDesigner(enzyme)
+		if h.genomeIndex != nil {
+			designer.SetGenomeIndex(h.genomeIndex)
+		}
+		designer.SetReference(h.reference)
+		designer.SetAnnotations(h.genes)
+		designer.SetPopulationVCF(h.populationVCF)
+		for _, scorer := range h.scorers {
+			designer.RegisterScorer(scorer)
+		}
+		h.designers[enzyme] = designer
+	}
+	return designer
+}
+
 // HandleDesign handles POST /api/v1/crispr/design
 func (h *Handler) HandleDesign(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -47,11 +116,7 @@ func (h *Handler) HandleDesign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get or create designer for enzyme
-	designer, exists := h.designers[req.Enzyme]
-	if !exists {
-		designer = NewDesigner(req.Enzyme)
-		h.designers[req.Enzyme] = designer
-	}
+	designer := h.getDesigner(req.Enzyme)
 
 	// Design guides
 	response, err := designer.Design(req)
@@ -88,11 +153,7 @@ func (h *Handler) HandleBatchDesign(w http.ResponseWriter, r *http.Request) {
 			req.Enzyme = Cas9
 		}
 
-		designer, exists := h.designers[req.Enzyme]
-		if !exists {
-			designer = NewDesigner(req.Enzyme)
-			h.designers[req.Enzyme] = designer
-		}
+		designer := h.getDesigner(req.Enzyme)
 
 		response, err := designer.Design(req)
 		if err != nil {
@@ -123,7 +184,7 @@ func (h *Handler) HandleExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.Guides) == 0 {
+	if len(req.Guides) == 0 && len(req.BaseEdits) == 0 && len(req.PegRNAs) == 0 {
 		h.sendError(w, http.StatusBadRequest, "no guides to export")
 		return
 	}
@@ -140,21 +201,27 @@ func (h *Handler) HandleExport(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set appropriate content type
+	name := "guides"
+	if len(req.PegRNAs) > 0 {
+		name = "pegrnas"
+	} else if len(req.BaseEdits) > 0 {
+		name = "base_edits"
+	}
 	contentType := "text/csv"
-	filename := "guides.csv"
+	filename := name + ".csv"
 	switch req.Format {
 	case ExportCSV:
 		contentType = "text/csv"
-		filename = "guides.csv"
+		filename = name + ".csv"
 	case ExportGenBank:
 		contentType = "text/plain"
-		filename = "guides.gb"
+		filename = name + ".gb"
 	case ExportPDF:
 		contentType = "application/pdf"
-		filename = "guides.pdf"
+		filename = name + ".pdf"
 	case ExportJSON:
 		contentType = "application/json"
-		filename = "guides.json"
+		filename = name + ".json"
 	}
 
 	w.Header().Set("Content-Type", contentType)
@@ -216,6 +283,58 @@ func (h *Handler) HandleGetEnzymes(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// HandleGetEditors handles GET /api/v1/crispr/editors
+func (h *Handler) HandleGetEditors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"base_editors": BaseEditors,
+		"prime_editing": map[string]interface{}{
+			"enzymes":  []CasEnzyme{Cas9, Cas9HF1, xCas9},
+			"defaults": DefaultPrimeEditOptions(),
+		},
+	})
+}
+
+// HandleGetScoringModels handles GET /api/v1/crispr/scoring-models
+func (h *Handler) HandleGetScoringModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	enzymes := []CasEnzyme{Cas9, Cas9HF1, xCas9, Cas12a, SaCas9, NmeCas9}
+	var models []map[string]interface{}
+	for _, scorer := range append(builtinScorers(), h.scorers...) {
+		supported := []CasEnzyme{}
+		defaultFor := []CasEnzyme{}
+		for _, enzyme := range enzymes {
+			if scorer.Supports(enzyme) {
+				supported = append(supported, enzyme)
+				if DefaultScoringModel(enzyme) == scorer.Name() {
+					defaultFor = append(defaultFor, enzyme)
+				}
+			}
+		}
+		models = append(models, map[string]interface{}{
+			"name":        scorer.Name(),
+			"description": scorer.Description(),
+			"enzymes":     supported,
+			"default_for": defaultFor,
+		})
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"models":  models,
+		"count":   len(models),
+	})
+}
+
 // sendJSON sends a JSON response
 func (h *Handler) sendJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -237,4 +356,6 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux, corsMiddleware func(http.Ha
 	mux.HandleFunc("/api/v1/crispr/design/batch", corsMiddleware(h.HandleBatchDesign))
 	mux.HandleFunc("/api/v1/crispr/export", corsMiddleware(h.HandleExport))
 	mux.HandleFunc("/api/v1/crispr/enzymes", corsMiddleware(h.HandleGetEnzymes))
+	mux.HandleFunc("/api/v1/crispr/editors", corsMiddleware(h.HandleGetEditors))
+	mux.HandleFunc("/api/v1/crispr/scoring-models", corsMiddleware(h.HandleGetScoringModels))
 }
@@ -0,0 +1,343 @@
+package crispr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DonorType is the form of an HDR donor template
+type DonorType string
+
+const (
+	DonorSSODN DonorType = "ssODN" // Single-stranded oligo, for short insertions
+	DonorDSDNA DonorType = "dsDNA" // Double-stranded plasmid or PCR donor
+)
+
+// maxSSODNLength is the longest ssODN routinely synthesised (nt)
+const maxSSODNLength = 200
+
+// blockingSeedMutations is how many seed mutations block re-cutting when
+// the PAM cannot be mutated (Paquet et al., Nature 2016)
+const blockingSeedMutations = 2
+
+// maxRecutMismatches is the most protospacer mismatches at which a donor
+// site is still considered cleavable
+const maxRecutMismatches = 3
+
+// seedLength is the PAM-proximal protospacer region where mismatches stop
+// cleavage
+const seedLength = 10
+
+// DonorOptions configures the knock-in donor template
+type DonorOptions struct {
+	Type           DonorType `json:"type"`                    // "ssODN" (default) or "dsDNA"
+	HomologyArm    int       `json:"homology_arm"`            // Arm length either side (default 40 for ssODN, 800 for dsDNA)
+	MaxCutDistance int       `json:"max_cut_distance"`        // Max cut-to-insertion distance (default 10)
+	CodingStrand   string    `json:"coding_strand,omitempty"` // "+" or "-" when the arms are coding sequence
+	CodonStart     int       `json:"codon_start,omitempty"`   // Position of the first base of any codon in frame
+}
+
+// withDefaults fills unset options with their defaults
+func (o *DonorOptions) withDefaults() DonorOptions {
+	var options DonorOptions
+	if o != nil {
+		options = *o
+	}
+	if options.Type == "" {
+		options.Type = DonorSSODN
+	}
+	if options.HomologyArm <= 0 {
+		options.HomologyArm = 40
+		if options.Type == DonorDSDNA {
+			options.HomologyArm = 800
+		}
+	}
+	if options.MaxCutDistance <= 0 {
+		options.MaxCutDistance = 10
+	}
+	return options
+}
+
+// validate checks the donor options
+func (o DonorOptions) validate() error {
+	if o.Type != DonorSSODN && o.Type != DonorDSDNA {
+		return fmt.Errorf("unknown donor type %q; use ssODN or dsDNA", o.Type)
+	}
+	if o.CodingStrand != "" && o.CodingStrand != "+" && o.CodingStrand != "-" {
+		return fmt.Errorf("coding_strand must be \"+\" or \"-\"")
+	}
+	return nil
+}
+
+// DonorMutation is a change made to the donor arms to stop the guide
+// cutting the repaired allele
+type DonorMutation struct {
+	Position  int    `json:"position"` // Forward-strand coordinate
+	Ref       string `json:"ref"`      // Forward-strand bases
+	Alt       string `json:"alt"`
+	Region    string `json:"region"`               // "PAM" or "seed"
+	Codon     string `json:"codon,omitempty"`      // Reference>donor codon on the coding strand
+	AminoAcid string `json:"amino_acid,omitempty"` // Preserved amino acid
+}
+
+// KnockInDesign is a guide with the donor template that inserts a sequence
+// at its cut site
+type KnockInDesign struct {
+	ID           string          `json:"id"`
+	Guide        GuideRNA        `json:"guide"`
+	CutSite      int             `json:"cut_site"`
+	CutDistance  int             `json:"cut_distance"` // Cut to insertion site (bp)
+	DonorType    DonorType       `json:"donor_type"`
+	DonorStrand  string          `json:"donor_strand"` // Strand the donor sequence is written on
+	Donor        string          `json:"donor"`
+	LeftArm      string          `json:"left_arm"` // Forward strand, including mutations
+	RightArm     string          `json:"right_arm"`
+	Insert       string          `json:"insert"`
+	Mutations    []DonorMutation `json:"mutations,omitempty"`
+	RecutBlocked bool            `json:"recut_blocked"`
+	Score        float64         `json:"score"`
+	Warnings     []string        `json:"warnings,omitempty"`
+}
+
+// geneticCode is the standard genetic code
+var geneticCode = func() map[string]byte {
+	const bases = "TCAG"
+	const aminoAcids = "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"
+	table := make(map[string]byte, 64)
+	for i := 0; i < 64; i++ {
+		codon := string([]byte{bases[i/16], bases[i/4%4], bases[i%4]})
+		table[codon] = aminoAcids[i]
+	}
+	return table
+}()
+
+// designKnockIn selects guides cutting near the insertion site and builds a
+// donor for each, with silent mutations where the donor would be re-cut
+func (d *Designer) designKnockIn(req DesignRequest, sequence, chromosome string, startPos int, startTime time.Time) (*DesignResponse, error) {
+	sequence = strings.ToUpper(sequence)
+	options := req.Donor.withDefaults()
+	insert := strings.ToUpper(req.InsertSequence)
+
+	site := req.EditPosition - startPos
+	if site-options.HomologyArm < 0 || site+options.HomologyArm > len(sequence) {
+		return nil, fmt.Errorf("target sequence is too short for %d bp homology arms around position %d", options.HomologyArm, req.EditPosition)
+	}
+
+	guides, variantWarnings, err := d.cuttingGuides(req, sequence, chromosome, startPos)
+	if err != nil {
+		return nil, err
+	}
+
+	var designs []KnockInDesign
+	for _, guide := range guides {
+		cut := cutSite(guide, d.chopchop.pam)
+		distance := abs(cut - req.EditPosition)
+		if distance > options.MaxCutDistance {
+			continue
+		}
+
+		design := d.buildDonor(guide, sequence, startPos, site, insert, options)
+		design.CutSite = cut
+		design.CutDistance = distance
+
+		// HDR efficiency falls steeply with cut-to-insertion distance
+		proximity := 1 - float64(distance)/float64(options.MaxCutDistance+1)
+		design.Score = proximity*0.45 + guide.DoenchScore*0.3 + guide.OffTargetScore/100*0.25
+		if !design.RecutBlocked {
+			design.Score *= 0.5
+		}
+		designs = append(designs, design)
+	}
+
+	sort.SliceStable(designs, func(i, j int) bool {
+		return designs[i].Score > designs[j].Score
+	})
+
+	maxGuides := req.MaxGuides
+	if maxGuides == 0 {
+		maxGuides = 10
+	}
+	if len(designs) > maxGuides {
+		designs = designs[:maxGuides]
+	}
+	for i := range designs {
+		designs[i].ID = fmt.Sprintf("knockin_%d", i+1)
+	}
+
+	response := &DesignResponse{
+		KnockIns:       designs,
+		TotalFound:     len(designs),
+		Region:         fmt.Sprintf("%s:%d-%d", chromosome, startPos, startPos+len(sequence)),
+		ProcessingTime: float64(time.Since(startTime).Milliseconds()),
+	}
+
+	if len(designs) == 0 {
+		response.Warnings = append(response.Warnings,
+			fmt.Sprintf("No guides cut within %d bp of the insertion site. Try increasing max_cut_distance.", options.MaxCutDistance))
+	}
+	if options.CodingStrand == "" {
+		response.Warnings = append(response.Warnings, "No reading frame given; donor mutations are not checked for silence")
+	}
+	response.Warnings = append(response.Warnings, variantWarnings...)
+
+	return response, nil
+}
+
+// buildDonor builds the donor for one guide. If the guide site survives the
+// insertion, the PAM is mutated, falling back to seed mutations when no PAM
+// change is silent.
+func (d *Designer) buildDonor(guide GuideRNA, sequence string, startPos, site int, insert string, options DonorOptions) KnockInDesign {
+	pam := d.chopchop.pam
+	armStart, armEnd := site-options.HomologyArm, site+options.HomologyArm
+	donor := []byte(sequence)
+
+	pamRegex := regexp.MustCompile("^" + pam.Pattern + "$")
+	pamIndex := len(guide.Sequence)
+	if pam.Orientation == "5prime" {
+		pamIndex = -len(pam.IUPAC)
+	}
+	build := func() string {
+		return string(donor[armStart:site]) + insert + string(donor[site:armEnd])
+	}
+	recut := func() bool {
+		template := build()
+		return hasGuideSite(template, guide.Sequence, pam, pamRegex) ||
+			hasGuideSite(reverseComplement(template), guide.Sequence, pam, pamRegex)
+	}
+
+	design := KnockInDesign{Guide: guide, DonorType: options.Type, Insert: insert}
+
+	// mutate tries each alternative base at a guide site index, keeping the
+	// first that is silent and, in the PAM, stops the guide cutting
+	mutate := func(index int, region string) bool {
+		i := protospacerGenomic(guide, index) - startPos
+		if i < armStart || i >= armEnd {
+			return false
+		}
+		ref := donor[i]
+		for _, alt := range []byte("CTAG") {
+			if guide.Strand == "-" {
+				alt = complementBase(alt)
+			}
+			if alt == ref {
+				continue
+			}
+			donor[i] = alt
+			mutation := DonorMutation{Position: i + startPos, Ref: string(ref), Alt: string(alt), Region: region}
+			silent := options.CodingStrand == "" || silentChange(sequence, string(donor), i, site, startPos, options, &mutation)
+			if silent && (region != "PAM" || !recut()) {
+				design.Mutations = append(design.Mutations, mutation)
+				return true
+			}
+			donor[i] = ref
+		}
+		return false
+	}
+
+	// A site split by the insertion needs no mutations; otherwise mutate the
+	// PAM, then the seed from the PAM-proximal end
+	if recut() {
+		for k := 0; k < len(pam.IUPAC); k++ {
+			if pam.IUPAC[k] != 'N' && mutate(pamIndex+k, "PAM") {
+				break
+			}
+		}
+		for k := 0; k < seedLength && recut(); k++ {
+			index := len(guide.Sequence) - 1 - k
+			if pam.Orientation == "5prime" {
+				index = k
+			}
+			mutate(index, "seed")
+		}
+	}
+	design.RecutBlocked = !recut()
+	if !design.RecutBlocked {
+		design.Warnings = append(design.Warnings, "No silent PAM or seed mutations found; the donor may be re-cut after repair")
+	}
+
+	design.LeftArm = string(donor[armStart:site])
+	design.RightArm = string(donor[site:armEnd])
+	design.Donor = build()
+	design.DonorStrand = "+"
+
+	// ssODNs complementary to the non-target strand give the highest HDR
+	// rates (Richardson et al., Nat Biotechnol 2016)
+	if options.Type == DonorSSODN {
+		if guide.Strand == "+" {
+			design.Donor = reverseComplement(design.Donor)
+			design.DonorStrand = "-"
+		}
+		if len(design.Donor) > maxSSODNLength {
+			design.Warnings = append(design.Warnings,
+				fmt.Sprintf("ssODN is %d nt; consider a dsDNA donor above %d nt", len(design.Donor), maxSSODNLength))
+		}
+	}
+
+	return design
+}
+
+// hasGuideSite reports whether a sequence holds a site the guide could still
+// cut: an intact PAM with at most maxRecutMismatches protospacer
+// mismatches, fewer than blockingSeedMutations of them in the seed
+func hasGuideSite(sequence, protospacer string, pam PAMSequence, pamRegex *regexp.Regexp) bool {
+	guideLength, pamLength := len(protospacer), len(pam.IUPAC)
+	for start := 0; start+guideLength+pamLength <= len(sequence); start++ {
+		guideAt, pamAt := start, start+guideLength
+		if pam.Orientation == "5prime" {
+			guideAt, pamAt = start+pamLength, start
+		}
+		if !pamRegex.MatchString(sequence[pamAt : pamAt+pamLength]) {
+			continue
+		}
+
+		mismatches, seed := 0, 0
+		for i := 0; i < guideLength; i++ {
+			if sequence[guideAt+i] == protospacer[i] {
+				continue
+			}
+			mismatches++
+			fromPAM := guideLength - 1 - i
+			if pam.Orientation == "5prime" {
+				fromPAM = i
+			}
+			if fromPAM < seedLength {
+				seed++
+			}
+		}
+		if mismatches <= maxRecutMismatches && seed < blockingSeedMutations {
+			return true
+		}
+	}
+	return false
+}
+
+// silentChange reports whether the donor change at sequence index i keeps
+// the encoded amino acid, recording the codon change on the mutation.
+// Codons split by the insertion site are never silent.
+func silentChange(reference, donor string, i, site, startPos int, options DonorOptions, mutation *DonorMutation) bool {
+	shift := 0
+	if options.CodingStrand == "-" {
+		// CodonStart is the codon's 5' base, its highest forward coordinate
+		shift = 1
+	}
+	frame := ((i+startPos-options.CodonStart-shift)%3 + 3) % 3
+	lo := i - frame
+	if lo < 0 || lo+3 > len(reference) || (lo < site && lo+3 > site) {
+		return false
+	}
+
+	before, after := reference[lo:lo+3], donor[lo:lo+3]
+	if options.CodingStrand == "-" {
+		before, after = reverseComplement(before), reverseComplement(after)
+	}
+	aa, ok := geneticCode[before]
+	if !ok || geneticCode[after] != aa {
+		return false
+	}
+	mutation.Codon = before + ">" + after
+	mutation.AminoAcid = string(aa)
+	return true
+}
@@ -4,28 +4,31 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 )
 
 // OffTargetPredictor implements GuideScan2-inspired off-target prediction
-// Uses BWT-based genome indexing for fast off-target detection
+// Uses an FM-index over the genome to enumerate every site within the
+// mismatch and bulge budget on both strands
 type OffTargetPredictor struct {
 	maxMismatches int
+	maxDNABulges  int
+	maxRNABulges  int
 	genomeIndex   *GenomeIndex
 	cfdScores     map[string]float64 // Cutting Frequency Determination scores
 }
 
-// GenomeIndex represents a simplified BWT-based genome index
-// In production, would use actual BWT/FM-index implementation
-type GenomeIndex struct {
-	sequences map[string]string // chromosome -> sequence
-	kmers     map[string][]GenomicLocation
-}
+// bulgePenalty is the CFD-style multiplier applied per bulged base
+const bulgePenalty = 0.3
 
-// GenomicLocation represents a location in the genome
-type GenomicLocation struct {
-	Chromosome string
-	Position   int
-	Strand     string
+// GenomeIndex is the genome searched for off-targets. It is backed by an
+// FM-index that is either loaded from disk (LoadGenomeIndex) or built in
+// memory from sequences added with IndexSequence.
+type GenomeIndex struct {
+	mu           sync.Mutex
+	fm           *FMIndex
+	pending      map[string]string // chromosome -> sequence not yet in fm
+	pendingNames []string
 }
 
 // NewOffTargetPredictor creates a new off-target predictor
@@ -37,220 +40,152 @@ func NewOffTargetPredictor(maxMismatches int) *OffTargetPredictor {
 	}
 }
 
-// NewGenomeIndex creates a new genome index
-func NewGenomeIndex() *GenomeIndex {
-	return &GenomeIndex{
-		sequences: make(map[string]string),
-		kmers:     make(map[string][]GenomicLocation),
-	}
+// SetBulges sets the number of DNA and RNA bulges allowed in off-target sites
+func (otp *OffTargetPredictor) SetBulges(dnaBulges, rnaBulges int) {
+	otp.maxDNABulges = dnaBulges
+	otp.maxRNABulges = rnaBulges
 }
 
-// IndexSequence adds a sequence to the genome index
-func (gi *GenomeIndex) IndexSequence(chromosome, sequence string) {
-	sequence = strings.ToUpper(sequence)
-	gi.sequences[chromosome] = sequence
-
-	// Build k-mer index for fast lookup (k=10 for seed region)
-	kmerSize := 10
-	for i := 0; i <= len(sequence)-kmerSize; i++ {
-		kmer := sequence[i : i+kmerSize]
-		loc := GenomicLocation{
-			Chromosome: chromosome,
-			Position:   i,
-			Strand:     "+",
-		}
-		gi.kmers[kmer] = append(gi.kmers[kmer], loc)
-	}
+// UseGenomeIndex replaces the genome searched for off-targets
+func (otp *OffTargetPredictor) UseGenomeIndex(index *GenomeIndex) {
+	otp.genomeIndex = index
 }
 
-// FindOffTargets finds potential off-target sites for a guide RNA
-func (otp *OffTargetPredictor) FindOffTargets(guide GuideRNA) []OffTargetSite {
-	var offTargets []OffTargetSite
-
-	// Use seed-and-extend approach
-	// Seed: PAM-proximal 12bp (most critical for binding)
-	seedSize := 12
-	guideSeq := guide.Sequence
-
-	if len(guideSeq) < seedSize {
-		return offTargets
-	}
-
-	// Extract seed region (last 12bp before PAM)
-	seed := guideSeq[len(guideSeq)-seedSize:]
-
-	// Find all seed matches in genome
-	seedMatches := otp.findSeedMatches(seed)
-
-	// Extend and score each seed match
-	for _, match := range seedMatches {
-		// Skip the on-target site
-		if match.Chromosome == guide.Chromosome &&
-		   math.Abs(float64(match.Position-guide.Position)) < 5 {
-			continue
-		}
-
-		// Get full sequence at this location
-		targetSeq := otp.getSequenceAt(match, len(guideSeq))
-		if targetSeq == "" {
-			continue
-		}
-
-		// Count mismatches
-		mismatches, mismatchPos := otp.countMismatches(guideSeq, targetSeq)
-
-		if mismatches <= otp.maxMismatches {
-			// Check PAM sequence
-			pamSeq := otp.getPAMAt(match, guide.Enzyme)
-			if !otp.isValidPAM(pamSeq, guide.Enzyme) {
-				continue // Skip if PAM not valid
-			}
-
-			// Calculate CFD score
-			cfdScore := otp.calculateCFDScore(guideSeq, targetSeq, mismatchPos)
-
-			offTarget := OffTargetSite{
-				Chromosome:  match.Chromosome,
-				Position:    match.Position,
-				Sequence:    targetSeq,
-				Mismatches:  mismatches,
-				MismatchPos: mismatchPos,
-				Score:       cfdScore,
-			}
-
-			offTargets = append(offTargets, offTarget)
-		}
+// NewGenomeIndex creates a new, empty genome index
+func NewGenomeIndex() *GenomeIndex {
+	return &GenomeIndex{
+		pending: make(map[string]string),
 	}
-
-	return offTargets
 }
 
-// findSeedMatches finds all genome locations matching the seed
-func (otp *OffTargetPredictor) findSeedMatches(seed string) []GenomicLocation {
-	var matches []GenomicLocation
+// NewGenomeIndexFromFM wraps an existing FM-index
+func NewGenomeIndexFromFM(fm *FMIndex) *GenomeIndex {
+	gi := NewGenomeIndex()
+	gi.fm = fm
+	return gi
+}
 
-	// Use k-mer index for fast initial search
-	kmerSize := 10
-	if len(seed) < kmerSize {
-		return matches
+// LoadGenomeIndex memory-maps an FM-index written by FMIndex.Save
+func LoadGenomeIndex(path string) (*GenomeIndex, error) {
+	fm, err := OpenFMIndex(path)
+	if err != nil {
+		return nil, err
 	}
+	return NewGenomeIndexFromFM(fm), nil
+}
 
-	searchKmer := seed[:kmerSize]
-
-	// Find exact k-mer matches
-	if locs, exists := otp.genomeIndex.kmers[searchKmer]; exists {
-		matches = append(matches, locs...)
-	}
+// IndexSequence adds a sequence to the genome index. The FM-index is
+// rebuilt lazily on the next search, so sequences can be added in bulk.
+func (gi *GenomeIndex) IndexSequence(chromosome, sequence string) {
+	gi.mu.Lock()
+	defer gi.mu.Unlock()
 
-	// Also search with 1 mismatch in k-mer (seed-and-extend)
-	variants := otp.generateKmerVariants(searchKmer, 1)
-	for _, variant := range variants {
-		if locs, exists := otp.genomeIndex.kmers[variant]; exists {
-			matches = append(matches, locs...)
-		}
+	if _, exists := gi.pending[chromosome]; !exists {
+		gi.pendingNames = append(gi.pendingNames, chromosome)
 	}
-
-	return matches
+	gi.pending[chromosome] = strings.ToUpper(sequence)
 }
 
-// generateKmerVariants generates k-mer variants with up to n mismatches
-func (otp *OffTargetPredictor) generateKmerVariants(kmer string, maxMM int) []string {
-	if maxMM == 0 {
-		return []string{kmer}
-	}
+// FMIndex returns the FM-index, building it first if sequences were added
+func (gi *GenomeIndex) FMIndex() (*FMIndex, error) {
+	gi.mu.Lock()
+	defer gi.mu.Unlock()
 
-	variants := make(map[string]bool)
-	bases := []byte{'A', 'T', 'G', 'C'}
+	if len(gi.pendingNames) == 0 {
+		return gi.fm, nil
+	}
 
-	// Generate single-mismatch variants
-	for i := 0; i < len(kmer); i++ {
-		for _, base := range bases {
-			if base != kmer[i] {
-				variant := kmer[:i] + string(base) + kmer[i+1:]
-				variants[variant] = true
+	var names, sequences []string
+	if gi.fm != nil {
+		for _, seq := range gi.fm.Sequences() {
+			if _, replaced := gi.pending[seq.Name]; replaced {
+				continue
+			}
+			bases, err := gi.fm.Extract(seq.Name, 0, seq.Length)
+			if err != nil {
+				return nil, err
 			}
+			names = append(names, seq.Name)
+			sequences = append(sequences, bases)
 		}
 	}
-
-	result := make([]string, 0, len(variants))
-	for v := range variants {
-		result = append(result, v)
-	}
-
-	return result
-}
-
-// getSequenceAt retrieves sequence at a genomic location
-func (otp *OffTargetPredictor) getSequenceAt(loc GenomicLocation, length int) string {
-	seq, exists := otp.genomeIndex.sequences[loc.Chromosome]
-	if !exists {
-		return ""
+	for _, name := range gi.pendingNames {
+		names = append(names, name)
+		sequences = append(sequences, gi.pending[name])
 	}
 
-	if loc.Position+length > len(seq) {
-		return ""
+	fm, err := BuildFMIndex(names, sequences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build genome index: %w", err)
 	}
 
-	return seq[loc.Position : loc.Position+length]
+	gi.fm = fm
+	gi.pending = make(map[string]string)
+	gi.pendingNames = nil
+	return gi.fm, nil
 }
 
-// getPAMAt gets PAM sequence at a location
-func (otp *OffTargetPredictor) getPAMAt(loc GenomicLocation, enzyme CasEnzyme) string {
-	pamConfig := GetPAMSequence(enzyme)
-	seq, exists := otp.genomeIndex.sequences[loc.Chromosome]
-	if !exists {
-		return ""
-	}
-
-	pamStart := loc.Position + pamConfig.GuideLength
-	pamEnd := pamStart + 3 // NGG is 3bp
+// Close releases a memory-mapped index
+func (gi *GenomeIndex) Close() error {
+	gi.mu.Lock()
+	defer gi.mu.Unlock()
 
-	if pamStart < 0 || pamEnd > len(seq) {
-		return ""
+	if gi.fm == nil {
+		return nil
 	}
+	return gi.fm.Close()
+}
 
-	return seq[pamStart:pamEnd]
+// FindOffTargets finds potential off-target sites for a guide RNA,
+// allowing the bulges set with SetBulges
+func (otp *OffTargetPredictor) FindOffTargets(guide GuideRNA) []OffTargetSite {
+	return otp.FindBulgedOffTargets(guide, otp.maxDNABulges, otp.maxRNABulges)
 }
 
-// isValidPAM checks if PAM sequence is valid
-func (otp *OffTargetPredictor) isValidPAM(pamSeq string, enzyme CasEnzyme) bool {
-	if pamSeq == "" {
-		return false
-	}
+// FindBulgedOffTargets finds potential off-target sites for a guide RNA
+// with up to dnaBulges extra genomic bases and rnaBulges unpaired guide bases
+func (otp *OffTargetPredictor) FindBulgedOffTargets(guide GuideRNA, dnaBulges, rnaBulges int) []OffTargetSite {
+	var offTargets []OffTargetSite
 
-	switch enzyme {
-	case Cas9, Cas9HF1:
-		// NGG
-		return len(pamSeq) == 3 && pamSeq[1:] == "GG"
-	case xCas9:
-		// NG[ATGC]
-		return len(pamSeq) == 3 && pamSeq[0] != 'N' && pamSeq[1] == 'G'
-	case Cas12a:
-		// TTTV
-		return len(pamSeq) >= 3 && pamSeq[:3] == "TTT"
-	default:
-		return true
+	fm, err := otp.genomeIndex.FMIndex()
+	if err != nil || fm == nil || guide.Sequence == "" {
+		return offTargets
 	}
-}
 
-// countMismatches counts mismatches between guide and target
-func (otp *OffTargetPredictor) countMismatches(guide, target string) (int, []int) {
-	mismatches := 0
-	var positions []int
+	pamConfig := GetPAMSequence(guide.Enzyme)
+	guideSeq := strings.ToUpper(guide.Sequence)
 
-	minLen := len(guide)
-	if len(target) < minLen {
-		minLen = len(target)
-	}
+	hits := fm.SearchSite(guideSeq, pamConfig.IUPAC, pamConfig.Orientation == "3prime", FMSearchOptions{
+		MaxMismatches: otp.maxMismatches,
+		MaxDNABulges:  dnaBulges,
+		MaxRNABulges:  rnaBulges,
+	})
 
-	for i := 0; i < minLen; i++ {
-		if guide[i] != target[i] {
-			mismatches++
-			positions = append(positions, i)
+	for _, hit := range hits {
+		// Skip the on-target site
+		if hit.Edits() == 0 && hit.Sequence == guide.Chromosome &&
+			math.Abs(float64(int(hit.Start)-guide.Position)) < 5 {
+			continue
 		}
+
+		// Calculate CFD score, penalising each bulged base
+		cfdScore := otp.calculateCFDScore(guideSeq, hit.Aligned, hit.MismatchPos)
+		cfdScore *= math.Pow(bulgePenalty, float64(hit.DNABulges+hit.RNABulges))
+
+		offTargets = append(offTargets, OffTargetSite{
+			Chromosome:  hit.Sequence,
+			Position:    int(hit.Start),
+			Sequence:    hit.Protospacer,
+			Mismatches:  hit.Mismatches,
+			MismatchPos: hit.MismatchPos,
+			Score:       cfdScore,
+			Strand:      hit.Strand,
+			DNABulges:   hit.DNABulges,
+			RNABulges:   hit.RNABulges,
+		})
 	}
 
-	return mismatches, positions
+	return offTargets
 }
 
 // calculateCFDScore calculates Cutting Frequency Determination score
@@ -0,0 +1,167 @@
+package crispr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultMaxCutOffset is how far outside the requested deletion a cut may
+// fall (bp)
+const defaultMaxCutOffset = 200
+
+// cas12aCutOffset is the protospacer base after which Cas12a cuts the
+// non-target strand, leaving a 5' overhang (Zetsche et al., Cell 2015)
+const cas12aCutOffset = 18
+
+// junctionFlank is the sequence reported either side of a deletion junction
+const junctionFlank = 10
+
+// GuidePair is two guides whose cuts excise the sequence between them
+type GuidePair struct {
+	ID           string   `json:"id"`
+	Left         GuideRNA `json:"left"`
+	Right        GuideRNA `json:"right"`
+	LeftCut      int      `json:"left_cut"`  // First deleted base
+	RightCut     int      `json:"right_cut"` // First retained base after the deletion
+	DeletionSize int      `json:"deletion_size"`
+	Excess       int      `json:"excess"`      // Deleted bases outside the requested span
+	Junction     string   `json:"junction"`    // Expected sequence across the rejoined ends
+	Efficiency   float64  `json:"efficiency"`  // Chance both guides cut (product of Doench scores)
+	Specificity  float64  `json:"specificity"` // Weaker guide's specificity, 0-1
+	Proximity    float64  `json:"proximity"`   // 1 when both cuts sit on the deletion boundaries
+	Score        float64  `json:"score"`
+}
+
+// pairedCutOffset returns the maximum cut offset for a paired deletion
+func pairedCutOffset(req DesignRequest) int {
+	if req.MaxCutOffset > 0 {
+		return req.MaxCutOffset
+	}
+	return defaultMaxCutOffset
+}
+
+// cutSite returns the genomic position of the base 3' of a guide's cut, in
+// forward-strand coordinates. Cas9-family nucleases cut bluntly 3 bp from
+// the PAM; Cas12a is placed at its PAM-distal non-target strand cut.
+func cutSite(guide GuideRNA, pam PAMSequence) int {
+	if pam.Orientation == "5prime" {
+		if guide.Strand == "-" {
+			return guide.Position + len(guide.Sequence) - cas12aCutOffset
+		}
+		return guide.Position + cas12aCutOffset
+	}
+	return nickSite(guide)
+}
+
+// cuttingGuides finds, scores and ranks every guide in the target, applying
+// the request's known variants. Quality filters are not applied since cut
+// position constrains the choice.
+func (d *Designer) cuttingGuides(req DesignRequest, sequence, chromosome string, startPos int) ([]GuideRNA, []string, error) {
+	if d.chopchop.pam.Pattern == "" {
+		return nil, nil, fmt.Errorf("%s does not cut DNA", d.chopchop.enzyme)
+	}
+
+	guides, err := d.chopchop.FindGuides(sequence, chromosome, startPos)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find guides: %w", err)
+	}
+	scorer, err := d.onTargetScorer(req.ScoringModel)
+	if err != nil {
+		return nil, nil, err
+	}
+	guides = d.scoreGuides(guides, sequence, startPos, scorer)
+	guides, warnings, err := d.applyVariants(req, guides, sequence, chromosome, startPos, scorer)
+	if err != nil {
+		return nil, nil, err
+	}
+	guides = d.findOffTargets(guides, req.MaxBulges)
+	return d.rankGuides(guides), warnings, nil
+}
+
+// designPairedDeletion pairs guides cutting just outside each end of the
+// deletion, scoring pairs jointly on efficiency, specificity and how
+// closely the cuts match the requested boundaries
+func (d *Designer) designPairedDeletion(req DesignRequest, sequence, chromosome string, startPos int, startTime time.Time) (*DesignResponse, error) {
+	sequence = strings.ToUpper(sequence)
+	if req.DeletionStart < startPos || req.DeletionEnd >= startPos+len(sequence) {
+		return nil, fmt.Errorf("deletion %d-%d lies outside the target sequence", req.DeletionStart, req.DeletionEnd)
+	}
+
+	guides, variantWarnings, err := d.cuttingGuides(req, sequence, chromosome, startPos)
+	if err != nil {
+		return nil, err
+	}
+
+	// Left cuts fall at or before the first deleted base, right cuts after
+	// the last one
+	offset := pairedCutOffset(req)
+	var left, right []GuideRNA
+	for _, guide := range guides {
+		cut := cutSite(guide, d.chopchop.pam)
+		switch {
+		case cut <= req.DeletionStart && cut >= req.DeletionStart-offset:
+			left = append(left, guide)
+		case cut > req.DeletionEnd && cut <= req.DeletionEnd+1+offset:
+			right = append(right, guide)
+		}
+	}
+
+	var pairs []GuidePair
+	for _, l := range left {
+		for _, r := range right {
+			leftCut, rightCut := cutSite(l, d.chopchop.pam), cutSite(r, d.chopchop.pam)
+			excess := (req.DeletionStart - leftCut) + (rightCut - req.DeletionEnd - 1)
+
+			i, j := leftCut-startPos, rightCut-startPos
+			pair := GuidePair{
+				Left:         l,
+				Right:        r,
+				LeftCut:      leftCut,
+				RightCut:     rightCut,
+				DeletionSize: rightCut - leftCut,
+				Excess:       excess,
+				Junction:     sequence[max(0, i-junctionFlank):i] + sequence[j:min(len(sequence), j+junctionFlank)],
+				Efficiency:   l.DoenchScore * r.DoenchScore,
+				Specificity:  min(l.OffTargetScore, r.OffTargetScore) / 100,
+				Proximity:    1 - float64(excess)/float64(2*offset),
+			}
+			pair.Score = pair.Efficiency*0.4 + pair.Specificity*0.4 + pair.Proximity*0.2
+			pairs = append(pairs, pair)
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Score > pairs[j].Score
+	})
+
+	maxGuides := req.MaxGuides
+	if maxGuides == 0 {
+		maxGuides = 10
+	}
+	if len(pairs) > maxGuides {
+		pairs = pairs[:maxGuides]
+	}
+	for i := range pairs {
+		pairs[i].ID = fmt.Sprintf("pair_%d", i+1)
+	}
+
+	response := &DesignResponse{
+		Pairs:          pairs,
+		TotalFound:     len(pairs),
+		Region:         fmt.Sprintf("%s:%d-%d", chromosome, startPos, startPos+len(sequence)),
+		ProcessingTime: float64(time.Since(startTime).Milliseconds()),
+	}
+
+	switch {
+	case len(left) == 0 || len(right) == 0:
+		response.Warnings = append(response.Warnings,
+			fmt.Sprintf("No guides cut within %d bp of both deletion boundaries. Try increasing max_cut_offset.", offset))
+	case pairs[0].Efficiency < 0.1:
+		response.Warnings = append(response.Warnings, "Low predicted efficiency for the top pair; expect few cells with both cuts")
+	}
+	response.Warnings = append(response.Warnings, variantWarnings...)
+
+	return response, nil
+}
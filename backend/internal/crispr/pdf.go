@@ -0,0 +1,290 @@
+package crispr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A4 page size and margin in points
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+	pdfMargin     = 40.0
+)
+
+// pdfFont is one of the standard Type 1 fonts every PDF reader provides,
+// so no font data is embedded
+type pdfFont int
+
+const (
+	fontRegular pdfFont = iota
+	fontBold
+	fontMono
+)
+
+// pdfFontNames are the base font names, in resource order (/F1, /F2, /F3)
+var pdfFontNames = []string{"Helvetica", "Helvetica-Bold", "Courier"}
+
+// pdfColor is an RGB colour with components in [0, 1]
+type pdfColor struct {
+	R, G, B float64
+}
+
+// Report colours
+var (
+	colorBlack  = pdfColor{0, 0, 0}
+	colorGray   = pdfColor{0.45, 0.45, 0.45}
+	colorLight  = pdfColor{0.93, 0.94, 0.96}
+	colorRule   = pdfColor{0.75, 0.77, 0.8}
+	colorAccent = pdfColor{0.16, 0.35, 0.62}
+	colorGood   = pdfColor{0.2, 0.62, 0.33}
+	colorFair   = pdfColor{0.93, 0.65, 0.15}
+	colorPoor   = pdfColor{0.82, 0.25, 0.22}
+	colorExon   = pdfColor{0.3, 0.45, 0.7}
+)
+
+// pdfDocument writes a multi-page PDF 1.4 file using only vector text and
+// graphics. Drawing methods take top-left based coordinates in points and
+// the cursor y tracks the next free line on the current page.
+type pdfDocument struct {
+	title string
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+// newPDFDocument creates a document with one empty page
+func newPDFDocument(title string) *pdfDocument {
+	doc := &pdfDocument{title: title}
+	doc.AddPage()
+	return doc
+}
+
+// AddPage starts a new page and resets the cursor to the top margin
+func (p *pdfDocument) AddPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+	p.y = pdfMargin
+}
+
+// Ensure starts a new page unless height points fit above the bottom margin
+func (p *pdfDocument) Ensure(height float64) {
+	if p.y+height > pdfPageHeight-pdfMargin {
+		p.AddPage()
+	}
+}
+
+// Text draws a single line of text with its baseline at (x, y)
+func (p *pdfDocument) Text(x, y float64, font pdfFont, size float64, color pdfColor, text string) {
+	fmt.Fprintf(p.page, "BT /F%d %.1f Tf %.3f %.3f %.3f rg %.2f %.2f Td (%s) Tj ET\n",
+		font+1, size, color.R, color.G, color.B, x, pdfPageHeight-y, pdfEscape(text))
+}
+
+// Rect draws a filled rectangle whose top-left corner is at (x, y)
+func (p *pdfDocument) Rect(x, y, width, height float64, color pdfColor) {
+	fmt.Fprintf(p.page, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n",
+		color.R, color.G, color.B, x, pdfPageHeight-y-height, width, height)
+}
+
+// StrokeRect outlines a rectangle whose top-left corner is at (x, y)
+func (p *pdfDocument) StrokeRect(x, y, width, height, lineWidth float64, color pdfColor) {
+	fmt.Fprintf(p.page, "%.3f %.3f %.3f RG %.2f w %.2f %.2f %.2f %.2f re S\n",
+		color.R, color.G, color.B, lineWidth, x, pdfPageHeight-y-height, width, height)
+}
+
+// Line draws a straight line
+func (p *pdfDocument) Line(x1, y1, x2, y2, lineWidth float64, color pdfColor) {
+	fmt.Fprintf(p.page, "%.3f %.3f %.3f RG %.2f w %.2f %.2f m %.2f %.2f l S\n",
+		color.R, color.G, color.B, lineWidth, x1, pdfPageHeight-y1, x2, pdfPageHeight-y2)
+}
+
+// Triangle draws a filled triangle
+func (p *pdfDocument) Triangle(x1, y1, x2, y2, x3, y3 float64, color pdfColor) {
+	fmt.Fprintf(p.page, "%.3f %.3f %.3f rg %.2f %.2f m %.2f %.2f l %.2f %.2f l h f\n",
+		color.R, color.G, color.B, x1, pdfPageHeight-y1, x2, pdfPageHeight-y2, x3, pdfPageHeight-y3)
+}
+
+// Heading writes a section heading with a rule beneath it
+func (p *pdfDocument) Heading(text string) {
+	p.Ensure(40)
+	p.y += 14
+	p.Text(pdfMargin, p.y, fontBold, 13, colorAccent, text)
+	p.y += 5
+	p.Line(pdfMargin, p.y, pdfPageWidth-pdfMargin, p.y, 0.8, colorAccent)
+	p.y += 12
+}
+
+// Paragraph writes lines of body text
+func (p *pdfDocument) Paragraph(lines ...string) {
+	for _, line := range lines {
+		p.Ensure(12)
+		p.Text(pdfMargin, p.y, fontRegular, 9, colorBlack, line)
+		p.y += 12
+	}
+}
+
+// pdfColumn is a table column; mono columns use Courier for sequences
+type pdfColumn struct {
+	Title string
+	Width float64
+	Mono  bool
+}
+
+// Table writes a table with a shaded header, repeating the header after
+// page breaks
+func (p *pdfDocument) Table(columns []pdfColumn, rows [][]string) {
+	const rowHeight = 13.0
+
+	header := func() {
+		p.Rect(pdfMargin, p.y, pdfPageWidth-2*pdfMargin, rowHeight, colorAccent)
+		x := pdfMargin + 3
+		for _, column := range columns {
+			p.Text(x, p.y+9.5, fontBold, 7.5, pdfColor{1, 1, 1}, column.Title)
+			x += column.Width
+		}
+		p.y += rowHeight
+	}
+
+	p.Ensure(2 * rowHeight)
+	header()
+	for i, row := range rows {
+		if p.y+rowHeight > pdfPageHeight-pdfMargin {
+			p.AddPage()
+			header()
+		}
+		if i%2 == 1 {
+			p.Rect(pdfMargin, p.y, pdfPageWidth-2*pdfMargin, rowHeight, colorLight)
+		}
+		x := pdfMargin + 3
+		for j, column := range columns {
+			if j >= len(row) {
+				break
+			}
+			font, size := fontRegular, 7.5
+			if column.Mono {
+				font, size = fontMono, 7
+			}
+			p.Text(x, p.y+9.5, font, size, colorBlack, pdfFit(row[j], column.Width-4, size, column.Mono))
+			x += column.Width
+		}
+		p.y += rowHeight
+	}
+	p.Line(pdfMargin, p.y, pdfPageWidth-pdfMargin, p.y, 0.5, colorRule)
+	p.y += 10
+}
+
+// Bytes serialises the document. Each page gets a footer with the title
+// and page number.
+func (p *pdfDocument) Bytes() ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Object numbers: 1 catalog, 2 page tree, 3 info, 4-6 fonts, then a
+	// page and a content stream per page
+	firstPage := 4 + len(pdfFontNames)
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object(fmt.Sprintf("<< /Title (%s) /Producer (GenomeVedic) /CreationDate (D:%s) >>",
+		pdfEscape(p.title), time.Now().UTC().Format("20060102150405Z")))
+
+	var fonts []string
+	for i, name := range pdfFontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fonts = append(fonts, fmt.Sprintf("/F%d %d 0 R", i+1, 4+i))
+	}
+	resources := fmt.Sprintf("<< /Font << %s >> >>", strings.Join(fonts, " "))
+
+	for i, page := range p.pages {
+		footer := fmt.Sprintf("BT /F1 7.0 Tf 0.450 0.450 0.450 rg %.2f %.2f Td (%s) Tj ET\n",
+			pdfMargin, pdfMargin/2, pdfEscape(fmt.Sprintf("%s  -  page %d of %d", p.title, i+1, len(p.pages))))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to compress page %d: %w", i+1, err)
+		}
+		if _, err := zw.Write([]byte(footer)); err != nil {
+			return nil, fmt.Errorf("failed to compress page %d: %w", i+1, err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress page %d: %w", i+1, err)
+		}
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, resources, firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes(), nil
+}
+
+// pdfWinAnsi maps the non-Latin-1 characters used in reports to WinAnsi
+var pdfWinAnsi = map[rune]byte{
+	'•': 149,
+	'–': 150,
+	'—': 151,
+	'‘': 145,
+	'’': 146,
+	'“': 147,
+	'”': 148,
+	'…': 133,
+}
+
+// pdfEscape encodes text as the body of a WinAnsi PDF string literal
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			b.WriteByte(byte(r))
+		default:
+			if c, ok := pdfWinAnsi[r]; ok {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+// pdfFit truncates text to fit a width, estimating Helvetica at 0.55 em
+// per character and Courier at its fixed 0.6 em
+func pdfFit(text string, width, size float64, mono bool) string {
+	perChar := 0.55 * size
+	if mono {
+		perChar = 0.6 * size
+	}
+	limit := int(width / perChar)
+	runes := []rune(text)
+	if len(runes) <= limit || limit < 2 {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
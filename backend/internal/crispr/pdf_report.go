@@ -0,0 +1,508 @@
+package crispr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"genomevedic/internal/annotations"
+)
+
+// reportGuideLimit caps the guides given a score breakdown and off-target
+// table in reports
+const reportGuideLimit = 10
+
+// locusGuide is a guide drawn on the locus diagram with its report label
+type locusGuide struct {
+	guide GuideRNA
+	label string
+}
+
+// guideReport lays out the nuclease guide report
+func (e *Exporter) guideReport(guides []GuideRNA, title string) *pdfDocument {
+	doc := newPDFDocument(title)
+	e.reportHeader(doc, title)
+
+	summary := []string{fmt.Sprintf("Total guides: %d", len(guides))}
+	if len(guides) > 0 {
+		avgDoench, avgOffTarget := 0.0, 0.0
+		for _, g := range guides {
+			avgDoench += g.DoenchScore
+			avgOffTarget += float64(g.OffTargetCount)
+		}
+		summary = append(summary,
+			fmt.Sprintf("Enzyme: %s    Target: %s    On-target model: %s", guides[0].Enzyme, guideRegion(guides), scoringModels(guides)),
+			fmt.Sprintf("Average Doench score: %.3f    Average off-target count: %.1f",
+				avgDoench/float64(len(guides)), avgOffTarget/float64(len(guides))))
+	}
+	doc.Heading("Summary")
+	doc.Paragraph(summary...)
+
+	doc.Heading("Guide ranking")
+	rows := make([][]string, len(guides))
+	for i, g := range guides {
+		rows[i] = []string{
+			fmt.Sprintf("%d", i+1),
+			g.Sequence + " " + g.PAMSequence,
+			fmt.Sprintf("%s:%d (%s)", g.Chromosome, g.Position, g.Strand),
+			fmt.Sprintf("%.3f", g.DoenchScore),
+			fmt.Sprintf("%.1f", g.GCContent),
+			fmt.Sprintf("%.0f", g.SelfCompScore),
+			fmt.Sprintf("%d", g.OffTargetCount),
+			fmt.Sprintf("%.1f", g.OffTargetScore),
+			fmt.Sprintf("%.3f", g.RankScore),
+		}
+	}
+	doc.Table([]pdfColumn{
+		{Title: "#", Width: 18},
+		{Title: "Protospacer + PAM", Width: 110, Mono: true},
+		{Title: "Location", Width: 100},
+		{Title: "Doench", Width: 40},
+		{Title: "GC %", Width: 35},
+		{Title: "Self-comp", Width: 45},
+		{Title: "Off-targets", Width: 50},
+		{Title: "Specificity", Width: 55},
+		{Title: "Rank", Width: 45},
+	}, rows)
+
+	locus := make([]locusGuide, len(guides))
+	for i, g := range guides {
+		locus[i] = locusGuide{guide: g, label: fmt.Sprintf("%d", i+1)}
+	}
+	e.locusDiagram(doc, locus, 0)
+
+	doc.Heading("Score breakdown")
+	for i, g := range guides {
+		if i >= reportGuideLimit {
+			doc.Paragraph(fmt.Sprintf("Breakdown shown for the top %d guides.", reportGuideLimit))
+			break
+		}
+		e.scoreBreakdown(doc, i+1, g)
+	}
+
+	doc.Heading("Off-target sites")
+	var offTargetRows [][]string
+	for i, g := range guides {
+		if i >= reportGuideLimit {
+			break
+		}
+		for _, site := range g.OffTargets {
+			offTargetRows = append(offTargetRows, []string{
+				fmt.Sprintf("%d", i+1),
+				fmt.Sprintf("%s:%d", site.Chromosome, site.Position),
+				site.Strand,
+				site.Sequence,
+				fmt.Sprintf("%d", site.Mismatches),
+				fmt.Sprintf("%d/%d", site.DNABulges, site.RNABulges),
+				fmt.Sprintf("%.3f", site.Score),
+			})
+		}
+	}
+	if len(offTargetRows) == 0 {
+		doc.Paragraph("No off-target sites were found within the mismatch and bulge budget",
+			"(or no genome index was configured for the search).")
+	} else {
+		doc.Table([]pdfColumn{
+			{Title: "Guide", Width: 35},
+			{Title: "Site", Width: 110},
+			{Title: "Strand", Width: 40},
+			{Title: "Sequence", Width: 150, Mono: true},
+			{Title: "Mismatches", Width: 55},
+			{Title: "Bulges (DNA/RNA)", Width: 75},
+			{Title: "CFD", Width: 45},
+		}, offTargetRows)
+	}
+
+	doc.Heading("Recommendations")
+	doc.Paragraph(
+		"1. Validate top 3-5 guides experimentally",
+		"2. Consider ordering synthetic guides from IDT or Genscript",
+		"3. Clone guides into expression vector (e.g., lentiCRISPRv2)",
+		"4. Perform off-target validation with GUIDE-seq or CIRCLE-seq",
+		"5. Test in relevant cell line before in vivo experiments",
+	)
+
+	return doc
+}
+
+// editReport lays out the base editor and prime editor report
+func (e *Exporter) editReport(baseEdits []BaseEditGuide, pegRNAs []PegRNA, title string) *pdfDocument {
+	doc := newPDFDocument(title)
+	e.reportHeader(doc, title)
+
+	var locus []locusGuide
+	marker := 0
+
+	if len(baseEdits) > 0 {
+		best := baseEdits[0]
+		marker = protospacerGenomic(best.Guide, best.TargetPosition-1)
+
+		doc.Heading("Base editor guides")
+		rows := make([][]string, len(baseEdits))
+		for i, edit := range baseEdits {
+			var bystanders []string
+			for _, b := range edit.Bystanders {
+				bystanders = append(bystanders, fmt.Sprintf("%d%s>%s", b.Position, b.RefBase, b.AltBase))
+			}
+			rows[i] = []string{
+				fmt.Sprintf("%d", i+1),
+				edit.Editor,
+				edit.Guide.Sequence + " " + edit.Guide.PAMSequence,
+				fmt.Sprintf("%s:%d (%s)", edit.Guide.Chromosome, edit.Guide.Position, edit.Guide.Strand),
+				fmt.Sprintf("%d (%d-%d)", edit.TargetPosition, edit.WindowStart, edit.WindowEnd),
+				fmt.Sprintf("%.2f", edit.Efficiency),
+				fmt.Sprintf("%.2f", edit.Purity),
+				strings.Join(bystanders, " "),
+				fmt.Sprintf("%.3f", edit.Score),
+			}
+			locus = append(locus, locusGuide{guide: edit.Guide, label: fmt.Sprintf("B%d", i+1)})
+		}
+		doc.Table([]pdfColumn{
+			{Title: "#", Width: 18},
+			{Title: "Editor", Width: 42},
+			{Title: "Protospacer + PAM", Width: 110, Mono: true},
+			{Title: "Location", Width: 90},
+			{Title: "Target (window)", Width: 60},
+			{Title: "Efficiency", Width: 45},
+			{Title: "Purity", Width: 35},
+			{Title: "Bystanders", Width: 75},
+			{Title: "Score", Width: 35},
+		}, rows)
+	}
+
+	if len(pegRNAs) > 0 {
+		if marker == 0 {
+			marker = pegEditPosition(pegRNAs[0])
+		}
+
+		doc.Heading("Prime editing guides")
+		rows := make([][]string, len(pegRNAs))
+		for i, peg := range pegRNAs {
+			nicking := "-"
+			if len(peg.NickingGuides) > 0 {
+				best := peg.NickingGuides[0]
+				nicking = fmt.Sprintf("%d bp", best.Distance)
+				if best.PE3b {
+					nicking += " (3b)"
+				}
+			}
+			rows[i] = []string{
+				fmt.Sprintf("%d", i+1),
+				peg.Spacer.Sequence,
+				fmt.Sprintf("%d (%s)", peg.NickPosition, peg.Spacer.Strand),
+				fmt.Sprintf("%+d", peg.EditDistance),
+				peg.PBS,
+				peg.RTTemplate,
+				fmt.Sprintf("%d", peg.Homology),
+				nicking,
+				fmt.Sprintf("%.3f", peg.Score),
+			}
+			locus = append(locus, locusGuide{guide: peg.Spacer, label: fmt.Sprintf("P%d", i+1)})
+		}
+		doc.Table([]pdfColumn{
+			{Title: "#", Width: 18},
+			{Title: "Spacer", Width: 92, Mono: true},
+			{Title: "Nick", Width: 55},
+			{Title: "Edit", Width: 25},
+			{Title: "PBS", Width: 72, Mono: true},
+			{Title: "RT template", Width: 115, Mono: true},
+			{Title: "Homology", Width: 40},
+			{Title: "Nicking", Width: 50},
+			{Title: "Score", Width: 35},
+		}, rows)
+
+		doc.Heading("pegRNA sequences")
+		for i, peg := range pegRNAs {
+			doc.Ensure(30)
+			doc.Text(pdfMargin, doc.y, fontBold, 8, colorBlack, fmt.Sprintf("#%d %s", i+1, peg.ID))
+			doc.y += 10
+			for start := 0; start < len(peg.Sequence); start += 90 {
+				doc.Ensure(10)
+				doc.Text(pdfMargin+8, doc.y, fontMono, 7, colorBlack, peg.Sequence[start:min(start+90, len(peg.Sequence))])
+				doc.y += 9
+			}
+			for _, nicking := range peg.NickingGuides {
+				kind := "PE3"
+				if nicking.PE3b {
+					kind = "PE3b"
+				}
+				doc.Ensure(10)
+				doc.Text(pdfMargin+8, doc.y, fontRegular, 7, colorGray, fmt.Sprintf("%s nicking guide %s (%d bp)", kind, nicking.Guide.Sequence, nicking.Distance))
+				doc.y += 9
+			}
+			for _, warning := range peg.Warnings {
+				doc.Ensure(10)
+				doc.Text(pdfMargin+8, doc.y, fontRegular, 7, colorPoor, "Warning: "+warning)
+				doc.y += 9
+			}
+			doc.y += 4
+		}
+	}
+
+	e.locusDiagram(doc, locus, marker)
+	return doc
+}
+
+// reportHeader writes the report title block
+func (e *Exporter) reportHeader(doc *pdfDocument, title string) {
+	doc.Rect(0, 0, pdfPageWidth, 70, colorAccent)
+	doc.Text(pdfMargin, 38, fontBold, 20, pdfColor{1, 1, 1}, title)
+	doc.Text(pdfMargin, 56, fontRegular, 9, pdfColor{0.85, 0.9, 1},
+		"Generated by GenomeVedic on "+time.Now().Format("2006-01-02 15:04:05"))
+	doc.y = 80
+}
+
+// scoreBreakdown draws one guide's score components as bars
+func (e *Exporter) scoreBreakdown(doc *pdfDocument, rank int, g GuideRNA) {
+	doc.Ensure(78)
+	doc.Text(pdfMargin, doc.y+8, fontBold, 9, colorBlack, fmt.Sprintf("#%d", rank))
+	doc.Text(pdfMargin+22, doc.y+8, fontMono, 8, colorBlack, g.Sequence+" "+g.PAMSequence)
+	doc.Text(pdfMargin+200, doc.y+8, fontRegular, 8, colorGray,
+		fmt.Sprintf("%s:%d (%s)   rank score %.3f", g.Chromosome, g.Position, g.Strand, g.RankScore))
+	doc.y += 14
+
+	doench := colorPoor
+	if g.DoenchScore >= 0.6 {
+		doench = colorGood
+	} else if g.DoenchScore >= 0.4 {
+		doench = colorFair
+	}
+	scoreBar(doc, "Doench efficiency", g.DoenchScore, doench,
+		fmt.Sprintf("%.3f (%s)", g.DoenchScore, e.getEfficiencyLabel(g.DoenchScore)), nil)
+
+	gc := colorPoor
+	if g.GCContent >= 40 && g.GCContent <= 60 {
+		gc = colorGood
+	} else if g.GCContent >= 30 && g.GCContent <= 70 {
+		gc = colorFair
+	}
+	scoreBar(doc, "GC content", g.GCContent/100, gc, fmt.Sprintf("%.1f%% (optimal 40-60%%)", g.GCContent), []float64{0.4, 0.6})
+
+	selfComp := colorPoor
+	if g.SelfCompScore <= 4 {
+		selfComp = colorGood
+	} else if g.SelfCompScore <= 10 {
+		selfComp = colorFair
+	}
+	scoreBar(doc, "Self-complementarity", math.Min(g.SelfCompScore/20, 1), selfComp,
+		fmt.Sprintf("%.0f (lower is better)", g.SelfCompScore), nil)
+
+	specificity := colorPoor
+	if g.OffTargetScore >= 80 {
+		specificity = colorGood
+	} else if g.OffTargetScore >= 50 {
+		specificity = colorFair
+	}
+	scoreBar(doc, "Off-target specificity", g.OffTargetScore/100, specificity,
+		fmt.Sprintf("%.1f (%d sites)", g.OffTargetScore, g.OffTargetCount), nil)
+
+	doc.y += 6
+}
+
+// scoreBar draws a labelled horizontal bar for a value in [0, 1], with an
+// optional shaded optimal band
+func scoreBar(doc *pdfDocument, label string, value float64, color pdfColor, text string, band []float64) {
+	const (
+		barX     = pdfMargin + 120
+		barWidth = 220.0
+	)
+	value = math.Max(0, math.Min(value, 1))
+
+	doc.Text(pdfMargin+22, doc.y+7, fontRegular, 8, colorBlack, label)
+	doc.Rect(barX, doc.y, barWidth, 9, colorLight)
+	if band != nil {
+		doc.Rect(barX+band[0]*barWidth, doc.y, (band[1]-band[0])*barWidth, 9, pdfColor{0.82, 0.92, 0.84})
+	}
+	doc.Rect(barX, doc.y+2, value*barWidth, 5, color)
+	doc.StrokeRect(barX, doc.y, barWidth, 9, 0.4, colorRule)
+	doc.Text(barX+barWidth+8, doc.y+7, fontRegular, 8, colorGray, text)
+	doc.y += 13
+}
+
+// locusDiagram draws guide positions relative to annotated exons on the
+// top guide's chromosome, with optional edit site marker
+func (e *Exporter) locusDiagram(doc *pdfDocument, guides []locusGuide, marker int) {
+	if len(guides) == 0 {
+		return
+	}
+	chromosome := guides[0].guide.Chromosome
+
+	var onChromosome []locusGuide
+	lo, hi := math.MaxInt, 0
+	for _, lg := range guides {
+		if lg.guide.Chromosome != chromosome {
+			continue
+		}
+		onChromosome = append(onChromosome, lg)
+		lo = min(lo, lg.guide.Position)
+		hi = max(hi, lg.guide.Position+len(lg.guide.Sequence)+len(lg.guide.PAMSequence))
+	}
+	if marker > 0 {
+		lo, hi = min(lo, marker), max(hi, marker+1)
+	}
+	pad := max((hi-lo)/10, 20)
+	lo, hi = max(lo-pad, 0), hi+pad
+
+	exons, genes := e.exonSpans(chromosome, lo, hi)
+
+	doc.Heading("Locus")
+	const (
+		laneHeight = 11.0
+		lanes      = 4
+	)
+	doc.Ensure(2*lanes*laneHeight + 70)
+
+	left, right := pdfMargin+10, pdfPageWidth-pdfMargin-10
+	scale := (right - left) / float64(hi-lo)
+	xOf := func(position int) float64 { return left + float64(position-lo)*scale }
+
+	axis := doc.y + lanes*laneHeight + 14
+	top := doc.y
+
+	// Axis with coordinate ticks
+	doc.Line(left, axis, right, axis, 1, colorGray)
+	for i := 0; i <= 4; i++ {
+		position := lo + (hi-lo)*i/4
+		x := xOf(position)
+		doc.Line(x, axis+8, x, axis+12, 0.5, colorGray)
+		doc.Text(x-15, axis+lanes*laneHeight+30, fontRegular, 7, colorGray, fmt.Sprintf("%d", position))
+	}
+
+	for _, exon := range exons {
+		x1, x2 := xOf(exon[0]), xOf(exon[1]+1)
+		doc.Rect(x1, axis-5, math.Max(x2-x1, 1), 10, colorExon)
+	}
+
+	// Guides: forward strand above the axis pointing right, reverse strand
+	// below pointing left, stacked into lanes to avoid overlaps
+	laneEnds := map[string][]float64{"+": make([]float64, lanes), "-": make([]float64, lanes)}
+	for _, lg := range onChromosome {
+		g := lg.guide
+		x1 := xOf(g.Position)
+		x2 := math.Max(xOf(g.Position+len(g.Sequence)), x1+2)
+
+		ends := laneEnds[g.Strand]
+		if ends == nil {
+			ends = laneEnds["+"]
+		}
+		lane := lanes - 1
+		for i, end := range ends {
+			if end == 0 || x1 > end+4 {
+				lane = i
+				break
+			}
+		}
+		ends[lane] = x2 + float64(len(lg.label))*4
+
+		color := colorAccent
+		if g.Strand == "-" {
+			color = colorFair
+			y := axis + 10 + float64(lane)*laneHeight
+			doc.Rect(x1, y, x2-x1, 4, color)
+			doc.Triangle(x1, y-1, x1, y+5, x1-4, y+2, color)
+			doc.Text(x2+2, y+5, fontRegular, 6, colorBlack, lg.label)
+		} else {
+			y := axis - 14 - float64(lane)*laneHeight
+			doc.Rect(x1, y, x2-x1, 4, color)
+			doc.Triangle(x2, y-1, x2, y+5, x2+4, y+2, color)
+			doc.Text(x2+6, y+5, fontRegular, 6, colorBlack, lg.label)
+		}
+	}
+
+	if marker > 0 {
+		x := xOf(marker)
+		doc.Line(x, top, x, axis+lanes*laneHeight+14, 0.8, colorPoor)
+		doc.Text(x+2, top+6, fontBold, 7, colorPoor, "edit")
+	}
+
+	doc.y = axis + lanes*laneHeight + 40
+	legend := fmt.Sprintf("%s:%d-%d. Blue: forward-strand guides; orange: reverse-strand guides", chromosome, lo, hi)
+	if len(exons) > 0 {
+		legend += "; boxes: exons of " + strings.Join(genes, ", ")
+	} else if e.genes == nil {
+		legend += "; no gene annotations loaded"
+	} else {
+		legend += "; no annotated exons in view"
+	}
+	doc.Paragraph(legend)
+	if len(onChromosome) < len(guides) {
+		doc.Paragraph(fmt.Sprintf("%d guide(s) on other chromosomes are not shown.", len(guides)-len(onChromosome)))
+	}
+}
+
+// exonSpans returns merged 1-based inclusive exon spans overlapping
+// [lo, hi] and the names of their genes
+func (e *Exporter) exonSpans(chromosome string, lo, hi int) ([][2]int, []string) {
+	if e.genes == nil || hi <= 0 {
+		return nil, nil
+	}
+
+	// Annotation coordinates are 0-based inclusive
+	var spans [][2]int
+	names := make(map[string]bool)
+	for _, feature := range e.genes.GetFeaturesInRange(chromosome, uint64(max(lo-1, 0)), uint64(hi-1)) {
+		if feature.Type != annotations.FeatureExon {
+			continue
+		}
+		spans = append(spans, [2]int{int(feature.Start) + 1, int(feature.End) + 1})
+		if feature.GeneName != "" {
+			names[feature.GeneName] = true
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var merged [][2]int
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span[0] <= merged[n-1][1]+1 {
+			merged[n-1][1] = max(merged[n-1][1], span[1])
+			continue
+		}
+		merged = append(merged, span)
+	}
+
+	genes := make([]string, 0, len(names))
+	for name := range names {
+		genes = append(genes, name)
+	}
+	sort.Strings(genes)
+	return merged, genes
+}
+
+// scoringModels lists the on-target models that scored the guides
+func scoringModels(guides []GuideRNA) string {
+	var models []string
+	seen := make(map[string]bool)
+	for _, g := range guides {
+		if g.ScoringModel != "" && !seen[g.ScoringModel] {
+			seen[g.ScoringModel] = true
+			models = append(models, g.ScoringModel)
+		}
+	}
+	if len(models) == 0 {
+		return "not recorded"
+	}
+	return strings.Join(models, ", ")
+}
+
+// guideRegion describes the span covered by guides on the top guide's
+// chromosome
+func guideRegion(guides []GuideRNA) string {
+	lo, hi := math.MaxInt, 0
+	for _, g := range guides {
+		if g.Chromosome == guides[0].Chromosome {
+			lo, hi = min(lo, g.Position), max(hi, g.Position+len(g.Sequence))
+		}
+	}
+	return fmt.Sprintf("%s:%d-%d", guides[0].Chromosome, lo, hi)
+}
+
+// pegEditPosition returns the genomic position of a pegRNA's first edited
+// base
+func pegEditPosition(peg PegRNA) int {
+	if peg.Spacer.Strand == "-" {
+		return peg.NickPosition - peg.EditDistance
+	}
+	return peg.NickPosition + peg.EditDistance - 1
+}
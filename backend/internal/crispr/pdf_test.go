@@ -0,0 +1,157 @@
+package crispr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"genomevedic/internal/annotations"
+)
+
+// readPDF checks the cross-reference table of a PDF and returns its page
+// count and the decompressed text of all content streams
+func readPDF(t *testing.T, data []byte) (int, string) {
+	t.Helper()
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+
+	// startxref points at the xref table, whose entries point at objects
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if match == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(data[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i+1, data[offset:offset+10])
+		}
+	}
+
+	count := regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`).FindSubmatch(data)
+	if count == nil {
+		t.Fatal("missing page tree")
+	}
+	pages, _ := strconv.Atoi(string(count[1]))
+
+	var text strings.Builder
+	streams := regexp.MustCompile(`(?s)/Length (\d+) /Filter /FlateDecode >>\nstream\n`)
+	for _, loc := range streams.FindAllSubmatchIndex(data, -1) {
+		length, _ := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		body := data[loc[1] : loc[1]+length]
+		if !bytes.HasPrefix(data[loc[1]+length:], []byte("\nendstream")) {
+			t.Fatal("stream length does not match endstream")
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text.Write(content)
+	}
+	return pages, text.String()
+}
+
+// TestExportPDFReport checks the guide report's structure and sections
+func TestExportPDFReport(t *testing.T) {
+	genes := annotations.NewGTFParser(2000)
+	gtf := "chr17\ttest\texon\t1010\t1040\t.\t-\t.\tgene_id \"ENSG00000141510\"; gene_name \"TP53\"; exon_number \"5\";\n" +
+		"chr17\ttest\texon\t1070\t1090\t.\t-\t.\tgene_id \"ENSG00000141510\"; gene_name \"TP53\"; exon_number \"6\";\n"
+	if err := genes.ParseFile(strings.NewReader(gtf)); err != nil {
+		t.Fatal(err)
+	}
+	exporter := NewExporter()
+	exporter.SetAnnotations(genes)
+
+	var guides []GuideRNA
+	for i := 0; i < 30; i++ {
+		guides = append(guides, GuideRNA{
+			ID:             fmt.Sprintf("guide_%d", i+1),
+			Sequence:       "GGAGGAGCCGCAGTCAGATC",
+			Chromosome:     "chr17",
+			Position:       1000 + 3*i,
+			Strand:         []string{"+", "-"}[i%2],
+			PAMSequence:    "CGG",
+			Enzyme:         Cas9,
+			DoenchScore:    0.8 - 0.02*float64(i),
+			GCContent:      60,
+			SelfCompScore:  8,
+			OffTargetCount: 1,
+			OffTargetScore: 99.5,
+			RankScore:      0.9 - 0.01*float64(i),
+			OffTargets: []OffTargetSite{
+				{Chromosome: "chr2", Position: 5000 + i, Sequence: "GGAGGAGCCGCAGTCTGATCTGG", Mismatches: 1, Score: 0.42, Strand: "+"},
+			},
+		})
+	}
+
+	data, err := exporter.ExportPDF(guides, map[string]interface{}{"title": "TP53 (exon 5) guides"})
+	if err != nil {
+		t.Fatalf("PDF export failed: %v", err)
+	}
+	pages, text := readPDF(t, data)
+	if pages < 2 {
+		t.Errorf("expected the report to span pages, got %d", pages)
+	}
+	for _, want := range []string{
+		"(TP53 \\(exon 5\\) guides)",
+		"(Guide ranking)", "(Score breakdown)", "(Off-target sites)", "(Locus)",
+		"(GGAGGAGCCGCAGTCAGATC CGG)", "(chr2:5000)", "(Doench efficiency)",
+		"boxes: exons of TP53", "page 2 of",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report lacks %s", want)
+		}
+	}
+
+	// Without annotations or off-targets the report says so
+	guides[0].OffTargets = nil
+	data, err = NewExporter().ExportPDF(guides[:1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, text = readPDF(t, data)
+	for _, want := range []string{"no gene annotations loaded", "No off-target sites were found"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("single-guide report lacks %q", want)
+		}
+	}
+}
+
+// TestExportEditsPDFReport checks the editing report
+func TestExportEditsPDFReport(t *testing.T) {
+	designer := NewDesigner(Cas9)
+	baseEdits, err := designer.Design(DesignRequest{Sequence: baseEditTarget, Enzyme: Cas9, Mode: ModeBaseEdit, EditPosition: 34, AltAllele: "G"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	primeEdits, err := designer.Design(DesignRequest{Sequence: tp53Exon, Enzyme: Cas9, Mode: ModePrimeEdit, EditPosition: 50, AltAllele: "T"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := NewExporter().Export(ExportRequest{BaseEdits: baseEdits.BaseEdits, PegRNAs: primeEdits.PegRNAs, Format: ExportPDF})
+	if err != nil {
+		t.Fatalf("PDF export failed: %v", err)
+	}
+	_, text := readPDF(t, data)
+	for _, want := range []string{"(Base editor guides)", "(Prime editing guides)", "(pegRNA sequences)", "(ABE8e)", "(edit)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("editing report lacks %s", want)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package crispr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pegRNAScaffold is the SpCas9 sgRNA scaffold between spacer and extension
+const pegRNAScaffold = "GTTTTAGAGCTAGAAATAGCAAGTTAAAATAAGGCTAGTCCGTTATCAACTTGAAAAAGTGGCACCGAGTCGGTGC"
+
+// nickOffset is the distance of the Cas9 nick from the PAM: the nickase cuts
+// the PAM strand between protospacer positions 17 and 18
+const nickOffset = 3
+
+// pegRNAsPerSpacer limits how many PBS/RT template combinations are kept
+// for each spacer, so results cover several spacers
+const pegRNAsPerSpacer = 3
+
+// PrimeEditOptions bounds the pegRNA search
+// Defaults follow Anzalone et al., Nature 2019 and PrimeDesign
+type PrimeEditOptions struct {
+	PBSMin          int `json:"pbs_min"`           // Primer binding site length (default 10)
+	PBSMax          int `json:"pbs_max"`           // (default 15)
+	RTTMin          int `json:"rtt_min"`           // Reverse transcription template length (default 10)
+	RTTMax          int `json:"rtt_max"`           // (default 25)
+	MinHomology     int `json:"min_homology"`      // RT template bases 3' of the edit (default 7)
+	MaxEditDistance int `json:"max_edit_distance"` // Furthest edit from the nick, +1 = adjacent (default 20)
+	NickingMin      int `json:"nicking_min"`       // PE3 nick-to-nick distance (default 40)
+	NickingMax      int `json:"nicking_max"`       // (default 100)
+}
+
+// DefaultPrimeEditOptions returns the default pegRNA search bounds
+func DefaultPrimeEditOptions() PrimeEditOptions {
+	return PrimeEditOptions{
+		PBSMin:          10,
+		PBSMax:          15,
+		RTTMin:          10,
+		RTTMax:          25,
+		MinHomology:     7,
+		MaxEditDistance: 20,
+		NickingMin:      40,
+		NickingMax:      100,
+	}
+}
+
+// withDefaults fills unset options with their defaults
+func (o *PrimeEditOptions) withDefaults() PrimeEditOptions {
+	defaults := DefaultPrimeEditOptions()
+	if o == nil {
+		return defaults
+	}
+	options := *o
+	for _, field := range []struct{ value, fallback *int }{
+		{&options.PBSMin, &defaults.PBSMin},
+		{&options.PBSMax, &defaults.PBSMax},
+		{&options.RTTMin, &defaults.RTTMin},
+		{&options.RTTMax, &defaults.RTTMax},
+		{&options.MinHomology, &defaults.MinHomology},
+		{&options.MaxEditDistance, &defaults.MaxEditDistance},
+		{&options.NickingMin, &defaults.NickingMin},
+		{&options.NickingMax, &defaults.NickingMax},
+	} {
+		if *field.value <= 0 {
+			*field.value = *field.fallback
+		}
+	}
+	return options
+}
+
+// NickingGuide is a second-strand nicking guide for PE3. PE3b guides only
+// match the edited sequence, so they nick after the edit is installed.
+type NickingGuide struct {
+	Guide    GuideRNA `json:"guide"`
+	Distance int      `json:"distance"` // Nick-to-nick distance (bp)
+	PE3b     bool     `json:"pe3b"`
+}
+
+// PegRNA is a prime editing guide: spacer, scaffold and a 3' extension made
+// of the reverse transcription template followed by the primer binding site.
+// PBS, RTTemplate and Extension are written 5'->3' as DNA.
+type PegRNA struct {
+	ID              string         `json:"id"`
+	Spacer          GuideRNA       `json:"spacer"`
+	NickPosition    int            `json:"nick_position"` // Genomic position of the base 3' of the nick (forward strand)
+	EditDistance    int            `json:"edit_distance"` // First edited base relative to the nick (+1 = adjacent)
+	PBS             string         `json:"pbs"`
+	PBSGC           float64        `json:"pbs_gc"`
+	RTTemplate      string         `json:"rt_template"`
+	Homology        int            `json:"homology"` // RT template bases 3' of the edit
+	Extension       string         `json:"extension"`
+	Sequence        string         `json:"sequence"` // Spacer + scaffold + extension
+	BlocksRenicking bool           `json:"blocks_renicking"`
+	NickingGuides   []NickingGuide `json:"nicking_guides,omitempty"`
+	Warnings        []string       `json:"warnings,omitempty"`
+	Score           float64        `json:"score"`
+}
+
+// strandTarget is a target sequence and edit read 5'->3' on one strand
+type strandTarget struct {
+	sequence string
+	edited   string
+	start    int // Edit span in sequence
+	end      int
+	alt      string
+}
+
+// onStrand returns the target and edit as seen from a guide's strand
+func onStrand(sequence string, edit targetEdit, strand string) strandTarget {
+	if strand == "-" {
+		n := len(sequence)
+		rc := reverseComplement(sequence)
+		alt := reverseComplement(edit.alt)
+		start, end := n-edit.end, n-edit.start
+		return strandTarget{sequence: rc, edited: rc[:start] + alt + rc[end:], start: start, end: end, alt: alt}
+	}
+	return strandTarget{
+		sequence: sequence,
+		edited:   sequence[:edit.start] + edit.alt + sequence[edit.end:],
+		start:    edit.start,
+		end:      edit.end,
+		alt:      edit.alt,
+	}
+}
+
+// guideStart returns the index of a guide's protospacer in the strand
+// sequence it was found on
+func guideStart(guide GuideRNA, seqLen, startPos int) int {
+	if guide.Strand == "-" {
+		return seqLen - (guide.Position - startPos) - len(guide.Sequence)
+	}
+	return guide.Position - startPos
+}
+
+// nickSite returns the genomic position of the base 3' of a guide's nick,
+// in forward-strand coordinates
+func nickSite(guide GuideRNA) int {
+	if guide.Strand == "-" {
+		return guide.Position + nickOffset
+	}
+	return guide.Position + len(guide.Sequence) - nickOffset
+}
+
+// designPrimeEdits builds pegRNAs for every spacer whose nick lies 5' of the
+// edit, pairing each with PE3/PE3b nicking guides
+func (d *Designer) designPrimeEdits(req DesignRequest, sequence, chromosome string, startPos int, startTime time.Time) (*DesignResponse, error) {
+	pam := d.chopchop.pam
+	if pam.Orientation != "3prime" || pam.GuideLength != 20 {
+		return nil, fmt.Errorf("prime editing requires an SpCas9-derived nickase; %s is not supported", d.chopchop.enzyme)
+	}
+
+	sequence = strings.ToUpper(sequence)
+	edit, err := resolveEdit(req, sequence, startPos)
+	if err != nil {
+		return nil, err
+	}
+	options := req.PrimeEdit.withDefaults()
+
+	guides, err := d.chopchop.FindGuides(sequence, chromosome, startPos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find guides: %w", err)
+	}
+	scorer, err := d.onTargetScorer(req.ScoringModel)
+	if err != nil {
+		return nil, err
+	}
+	guides = d.scoreGuides(guides, sequence, startPos, scorer)
+	guides = d.findOffTargets(guides, req.MaxBulges)
+	guides = d.rankGuides(guides)
+
+	nicking := d.nickingCandidates(guides, sequence, chromosome, startPos, edit, scorer, req.MaxBulges)
+	pamRegex := regexp.MustCompile("^" + pam.Pattern + "$")
+
+	var pegRNAs []PegRNA
+	for _, spacer := range guides {
+		target := onStrand(sequence, edit, spacer.Strand)
+		protospacer := guideStart(spacer, len(sequence), startPos)
+		nick := protospacer + len(spacer.Sequence) - nickOffset
+		if target.start < nick || target.start-nick+1 > options.MaxEditDistance {
+			continue
+		}
+
+		// The pegRNA spacer no longer matches once the PAM or the protospacer
+		// 3' of the nick is edited, which prevents re-nicking
+		pamStart := protospacer + len(spacer.Sequence)
+		pamEnd := pamStart + len(spacer.PAMSequence)
+		blocks := pamEnd > len(target.edited) ||
+			target.edited[protospacer:pamStart] != spacer.Sequence ||
+			!pamRegex.MatchString(target.edited[pamStart:pamEnd])
+
+		var candidates []PegRNA
+		for pbsLength := options.PBSMin; pbsLength <= options.PBSMax && pbsLength <= nick; pbsLength++ {
+			pbs := reverseComplement(target.sequence[nick-pbsLength : nick])
+			for rttLength := options.RTTMin; rttLength <= options.RTTMax && nick+rttLength <= len(target.edited); rttLength++ {
+				homology := rttLength - (target.start - nick) - len(target.alt)
+				if homology < options.MinHomology {
+					continue
+				}
+				rtt := reverseComplement(target.edited[nick : nick+rttLength])
+
+				peg := PegRNA{
+					ID:              fmt.Sprintf("%s_peg_%d_%d", spacer.ID, pbsLength, rttLength),
+					Spacer:          spacer,
+					NickPosition:    nickSite(spacer),
+					EditDistance:    target.start - nick + 1,
+					PBS:             pbs,
+					PBSGC:           calculateGCContent(pbs),
+					RTTemplate:      rtt,
+					Homology:        homology,
+					Extension:       rtt + pbs,
+					Sequence:        spacer.Sequence + pegRNAScaffold + rtt + pbs,
+					BlocksRenicking: blocks,
+				}
+				peg.Score = scorePegRNA(&peg, options)
+				candidates = append(candidates, peg)
+			}
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Score > candidates[j].Score
+		})
+		if len(candidates) > pegRNAsPerSpacer {
+			candidates = candidates[:pegRNAsPerSpacer]
+		}
+
+		nickers := selectNickingGuides(spacer, nicking, options)
+		for i := range candidates {
+			candidates[i].NickingGuides = nickers
+		}
+		pegRNAs = append(pegRNAs, candidates...)
+	}
+
+	sort.SliceStable(pegRNAs, func(i, j int) bool {
+		return pegRNAs[i].Score > pegRNAs[j].Score
+	})
+
+	maxGuides := req.MaxGuides
+	if maxGuides == 0 {
+		maxGuides = 10
+	}
+	if len(pegRNAs) > maxGuides {
+		pegRNAs = pegRNAs[:maxGuides]
+	}
+
+	response := &DesignResponse{
+		PegRNAs:        pegRNAs,
+		TotalFound:     len(pegRNAs),
+		Region:         fmt.Sprintf("%s:%d-%d", chromosome, startPos, startPos+len(sequence)),
+		ProcessingTime: float64(time.Since(startTime).Milliseconds()),
+	}
+
+	if len(pegRNAs) == 0 {
+		response.Warnings = append(response.Warnings,
+			fmt.Sprintf("No spacer nicks within %d bp 5' of the edit. Try increasing max_edit_distance or rtt_max.", options.MaxEditDistance))
+	} else if len(pegRNAs[0].NickingGuides) == 0 {
+		response.Warnings = append(response.Warnings, "No PE3 nicking guide found for the top pegRNA; PE2 only")
+	}
+
+	return response, nil
+}
+
+// scorePegRNA ranks a pegRNA by edit distance, PBS and RT template quality,
+// spacer efficiency and specificity, recording design warnings
+func scorePegRNA(peg *PegRNA, options PrimeEditOptions) float64 {
+	// Editing falls off with distance from the nick
+	distance := 1.0
+	if options.MaxEditDistance > 1 {
+		distance -= 0.7 * float64(peg.EditDistance-1) / float64(options.MaxEditDistance-1)
+	}
+
+	// ~13 nt PBS with moderate GC anneals best
+	pbs := 1 - 0.08*float64(abs(len(peg.PBS)-13))
+	if peg.PBSGC < 30 || peg.PBSGC > 70 {
+		pbs *= 0.6
+	} else if peg.PBSGC < 40 || peg.PBSGC > 60 {
+		pbs *= 0.85
+	}
+
+	// 10-16 nt of 3' homology is a good compromise
+	rtt := 1.0
+	if peg.Homology < 10 {
+		rtt = 0.8
+	} else if peg.Homology > 16 {
+		rtt = 0.9
+	}
+
+	score := distance*0.35 + pbs*0.2 + rtt*0.15 +
+		peg.Spacer.DoenchScore*0.15 + (peg.Spacer.OffTargetScore/100.0)*0.15
+
+	// A C templating the first extension base disrupts the scaffold fold
+	if strings.HasPrefix(peg.Extension, "C") {
+		score *= 0.7
+		peg.Warnings = append(peg.Warnings, "extension starts with C, which can disrupt the scaffold")
+	}
+	// TTTT terminates U6 (Pol III) transcription
+	if strings.Contains(peg.Spacer.Sequence+peg.Extension, "TTTT") {
+		score *= 0.5
+		peg.Warnings = append(peg.Warnings, "contains TTTT, a Pol III terminator")
+	}
+	if peg.BlocksRenicking {
+		score = min(score+0.05, 1)
+	}
+
+	return score
+}
+
+// nickingCandidates returns guides that can serve as PE3 nicking guides:
+// all guides in the target, plus PE3b guides found only in the edited sequence
+func (d *Designer) nickingCandidates(guides []GuideRNA, sequence, chromosome string, startPos int, edit targetEdit, scorer OnTargetScorer, bulges int) []NickingGuide {
+	candidates := make([]NickingGuide, 0, len(guides))
+	for _, guide := range guides {
+		candidates = append(candidates, NickingGuide{Guide: guide})
+	}
+
+	edited := sequence[:edit.start] + edit.alt + sequence[edit.end:]
+	editedGuides, err := d.chopchop.FindGuides(edited, chromosome, startPos)
+	if err != nil {
+		return candidates
+	}
+	reverse := reverseComplement(sequence)
+
+	var pe3b []GuideRNA
+	for _, guide := range editedGuides {
+		original := sequence
+		if guide.Strand == "-" {
+			original = reverse
+		}
+		if !strings.Contains(original, guide.Sequence+guide.PAMSequence) {
+			pe3b = append(pe3b, guide)
+		}
+	}
+	pe3b = d.scoreGuides(pe3b, edited, startPos, scorer)
+	pe3b = d.findOffTargets(pe3b, bulges)
+	for _, guide := range pe3b {
+		candidates = append(candidates, NickingGuide{Guide: guide, PE3b: true})
+	}
+
+	return candidates
+}
+
+// selectNickingGuides picks nicking guides on the strand opposite a pegRNA
+// spacer: PE3b guides first, then PE3 guides in the distance range
+func selectNickingGuides(spacer GuideRNA, candidates []NickingGuide, options PrimeEditOptions) []NickingGuide {
+	var selected []NickingGuide
+	for _, candidate := range candidates {
+		if candidate.Guide.Strand == spacer.Strand {
+			continue
+		}
+		candidate.Distance = abs(nickSite(candidate.Guide) - nickSite(spacer))
+		if candidate.PE3b || (candidate.Distance >= options.NickingMin && candidate.Distance <= options.NickingMax) {
+			selected = append(selected, candidate)
+		}
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		if selected[i].PE3b != selected[j].PE3b {
+			return selected[i].PE3b
+		}
+		return selected[i].Distance < selected[j].Distance
+	})
+	if len(selected) > 3 {
+		selected = selected[:3]
+	}
+	return selected
+}
+
+// abs returns the absolute value of an int
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
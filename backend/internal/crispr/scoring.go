@@ -0,0 +1,321 @@
+package crispr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Built-in on-target scoring models
+const (
+	ModelDoench2016      = "doench2016"
+	ModelIVTHeuristic    = "ivt_heuristic"
+	ModelCas12aHeuristic = "cas12a_heuristic"
+)
+
+// OnTargetScorer predicts a guide's on-target cleavage efficiency
+type OnTargetScorer interface {
+	// Name identifies the model in requests and on scored guides
+	Name() string
+	// Description summarises the model and when to use it
+	Description() string
+	// Supports reports whether the model applies to an enzyme
+	Supports(enzyme CasEnzyme) bool
+	// Flanks returns the bases the model reads 5' and 3' of the target site
+	Flanks() (int, int)
+	// Score returns the efficiency from 0-1. The context is the target site
+	// (protospacer and PAM) on the guide strand with the model's flanks;
+	// flank bases beyond the target sequence are N.
+	Score(guide GuideRNA, context string) float64
+}
+
+// builtinScorers returns the models every designer provides
+func builtinScorers() []OnTargetScorer {
+	return []OnTargetScorer{NewDoenchScorer(), NewIVTHeuristicScorer(), NewCas12aHeuristicScorer()}
+}
+
+// DefaultScoringModel returns the model used when a request names none
+func DefaultScoringModel(enzyme CasEnzyme) string {
+	if enzyme == Cas12a {
+		return ModelCas12aHeuristic
+	}
+	return ModelDoench2016
+}
+
+// spCas9Family reports whether an enzyme uses a 20 nt spacer with an NGG
+// or relaxed NG PAM, as in the SpCas9 training data
+func spCas9Family(enzyme CasEnzyme) bool {
+	return enzyme == Cas9 || enzyme == Cas9HF1 || enzyme == xCas9
+}
+
+// IVTHeuristicScorer scores guides transcribed in vitro from a T7 promoter
+// and injected as RNA. It is a hand-tuned approximation of the trends
+// reported for CRISPRscan (Moreno-Mateos et al., Nature Methods 2015), not
+// that model: guanine-rich guides, especially PAM-proximal, are stable and
+// active, adenine-rich ones are not. The published CRISPRscan weights can
+// be loaded as a WeightsScorer.
+type IVTHeuristicScorer struct{}
+
+// NewIVTHeuristicScorer creates an in vitro transcription heuristic scorer
+func NewIVTHeuristicScorer() *IVTHeuristicScorer {
+	return &IVTHeuristicScorer{}
+}
+
+// Name returns the model name
+func (s *IVTHeuristicScorer) Name() string { return ModelIVTHeuristic }
+
+// Description summarises the model
+func (s *IVTHeuristicScorer) Description() string {
+	return "Heuristic for in vitro transcribed guides (e.g. zebrafish injections) after CRISPRscan trends; not the published model"
+}
+
+// Supports reports whether the model applies to an enzyme
+func (s *IVTHeuristicScorer) Supports(enzyme CasEnzyme) bool { return spCas9Family(enzyme) }
+
+// Flanks returns no flanks: only the protospacer is read
+func (s *IVTHeuristicScorer) Flanks() (int, int) { return 0, 0 }
+
+// Score calculates the efficiency score
+func (s *IVTHeuristicScorer) Score(guide GuideRNA, context string) float64 {
+	protospacer := strings.ToUpper(guide.Sequence)
+	if len(protospacer) != 20 {
+		return 0.0
+	}
+
+	score := -0.4
+	for i := 0; i < 20; i++ {
+		switch protospacer[i] {
+		case 'G':
+			score += 0.06
+			if i >= 14 {
+				score += 0.06 // PAM-proximal guanines
+			}
+		case 'A':
+			score -= 0.05
+		case 'T':
+			if i >= 14 {
+				score -= 0.04
+			}
+		}
+	}
+	if protospacer[19] == 'G' {
+		score += 0.2
+	}
+	// T7 starts transcription at GG; other guides gain mismatched 5' bases
+	if strings.HasPrefix(protospacer, "GG") {
+		score += 0.25
+	} else if protospacer[0] == 'G' {
+		score += 0.1
+	}
+
+	gc := calculateGCContent(protospacer)
+	if gc < 30 || gc > 85 {
+		score -= 0.4
+	} else if gc >= 45 && gc <= 75 {
+		score += 0.2
+	}
+
+	return 1.0 / (1.0 + math.Exp(-2*score))
+}
+
+// Cas12aHeuristicScorer scores AsCas12a/LbCas12a guides. It is a
+// hand-tuned approximation of sequence features reported alongside DeepCpf1
+// (Kim et al., Nature Biotechnology 2018), not that model: the PAM's
+// variable base, moderate GC content, seed composition and the absence of
+// poly-T runs and hairpins.
+type Cas12aHeuristicScorer struct{}
+
+// NewCas12aHeuristicScorer creates a Cas12a heuristic scorer
+func NewCas12aHeuristicScorer() *Cas12aHeuristicScorer {
+	return &Cas12aHeuristicScorer{}
+}
+
+// Name returns the model name
+func (s *Cas12aHeuristicScorer) Name() string { return ModelCas12aHeuristic }
+
+// Description summarises the model
+func (s *Cas12aHeuristicScorer) Description() string {
+	return "Heuristic for Cas12a (Cpf1) guides after DeepCpf1 sequence features; not the published model"
+}
+
+// Supports reports whether the model applies to an enzyme
+func (s *Cas12aHeuristicScorer) Supports(enzyme CasEnzyme) bool { return enzyme == Cas12a }
+
+// Flanks returns no flanks: only the protospacer and PAM are read
+func (s *Cas12aHeuristicScorer) Flanks() (int, int) { return 0, 0 }
+
+// Score calculates the efficiency score
+func (s *Cas12aHeuristicScorer) Score(guide GuideRNA, context string) float64 {
+	protospacer := strings.ToUpper(guide.Sequence)
+	if len(protospacer) < 20 {
+		return 0.0
+	}
+
+	score := 0.0
+
+	// TTTA and TTTC PAMs outperform TTTG; TTTT is barely active
+	if pam := strings.ToUpper(guide.PAMSequence); len(pam) == 4 {
+		switch pam[3] {
+		case 'A', 'C':
+			score += 0.2
+		case 'T':
+			score -= 1.0
+		}
+	}
+
+	// Seed (PAM-proximal 6 nt): C and G help, T hurts
+	for i := 0; i < 6; i++ {
+		switch protospacer[i] {
+		case 'C', 'G':
+			score += 0.05
+		case 'T':
+			score -= 0.08
+		}
+	}
+	// The PAM-distal end tolerates, and slightly favours, A and T
+	for i := 17; i < 20; i++ {
+		if protospacer[i] == 'A' || protospacer[i] == 'T' {
+			score += 0.04
+		}
+	}
+
+	gc := calculateGCContent(protospacer[:20])
+	switch {
+	case gc >= 35 && gc <= 60:
+		score += 0.3
+	case gc < 20 || gc > 75:
+		score -= 0.5
+	}
+
+	if strings.Contains(protospacer, "TTTT") {
+		score -= 0.6 // Terminates U6 transcription of the crRNA
+	}
+	if guide.SelfCompScore > 8 {
+		score -= 0.3
+	}
+
+	return 1.0 / (1.0 + math.Exp(-2*score))
+}
+
+// WeightsFeature is a nucleotide (or dinucleotide) at a 1-based position
+// of the scoring context
+type WeightsFeature struct {
+	Position int     `json:"position"`
+	Sequence string  `json:"sequence"`
+	Weight   float64 `json:"weight"`
+}
+
+// WeightsScorer is a position-specific nucleotide model loaded from a JSON
+// weights file, in the form of Rule Set 1 and CRISPRscan: the intercept,
+// plus the weight of every matching feature, plus a GC term weighted per
+// base of protospacer GC below (gc_low) or above (gc_high) half its length,
+// optionally passed through a logistic function
+type WeightsScorer struct {
+	ModelName  string           `json:"name"`
+	About      string           `json:"description"`
+	Enzymes    []CasEnzyme      `json:"enzymes"`
+	Upstream   int              `json:"upstream"`
+	Downstream int              `json:"downstream"`
+	Intercept  float64          `json:"intercept"`
+	Features   []WeightsFeature `json:"features"`
+	GCLow      float64          `json:"gc_low"`
+	GCHigh     float64          `json:"gc_high"`
+	Logistic   bool             `json:"logistic"`
+}
+
+// LoadScoringModel loads a weights file
+func LoadScoringModel(path string) (*WeightsScorer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scoring model: %w", err)
+	}
+	defer f.Close()
+
+	scorer, err := ParseScoringModel(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scoring model %s: %w", path, err)
+	}
+	return scorer, nil
+}
+
+// ParseScoringModel parses and validates a weights file
+func ParseScoringModel(r io.Reader) (*WeightsScorer, error) {
+	var scorer WeightsScorer
+	if err := json.NewDecoder(r).Decode(&scorer); err != nil {
+		return nil, fmt.Errorf("failed to parse weights: %w", err)
+	}
+
+	if scorer.ModelName == "" {
+		return nil, fmt.Errorf("model has no name")
+	}
+	for _, builtin := range builtinScorers() {
+		if scorer.ModelName == builtin.Name() {
+			return nil, fmt.Errorf("model name %q is reserved", scorer.ModelName)
+		}
+	}
+	if len(scorer.Enzymes) == 0 {
+		return nil, fmt.Errorf("model %s lists no enzymes", scorer.ModelName)
+	}
+	if scorer.Upstream < 0 || scorer.Downstream < 0 {
+		return nil, fmt.Errorf("model %s has negative flanks", scorer.ModelName)
+	}
+	for i, feature := range scorer.Features {
+		feature.Sequence = strings.ToUpper(feature.Sequence)
+		if feature.Position < 1 || feature.Sequence == "" || !isValidDNA(feature.Sequence) {
+			return nil, fmt.Errorf("model %s feature %d: need a position from 1 and a DNA sequence", scorer.ModelName, i+1)
+		}
+		scorer.Features[i] = feature
+	}
+	return &scorer, nil
+}
+
+// Name returns the model name
+func (s *WeightsScorer) Name() string { return s.ModelName }
+
+// Description summarises the model
+func (s *WeightsScorer) Description() string {
+	if s.About != "" {
+		return s.About
+	}
+	return "User-supplied weights"
+}
+
+// Supports reports whether the model lists an enzyme
+func (s *WeightsScorer) Supports(enzyme CasEnzyme) bool {
+	for _, e := range s.Enzymes {
+		if e == enzyme {
+			return true
+		}
+	}
+	return false
+}
+
+// Flanks returns the flanks given in the weights file
+func (s *WeightsScorer) Flanks() (int, int) { return s.Upstream, s.Downstream }
+
+// Score calculates the efficiency score
+func (s *WeightsScorer) Score(guide GuideRNA, context string) float64 {
+	score := s.Intercept
+	for _, feature := range s.Features {
+		start := feature.Position - 1
+		if start+len(feature.Sequence) <= len(context) && context[start:start+len(feature.Sequence)] == feature.Sequence {
+			score += feature.Weight
+		}
+	}
+
+	protospacer := strings.ToUpper(guide.Sequence)
+	gc := strings.Count(protospacer, "G") + strings.Count(protospacer, "C")
+	if half := len(protospacer) / 2; gc < half {
+		score += s.GCLow * float64(half-gc)
+	} else {
+		score += s.GCHigh * float64(gc-half)
+	}
+
+	if s.Logistic {
+		return 1.0 / (1.0 + math.Exp(-score))
+	}
+	return math.Max(0, math.Min(1, score))
+}
@@ -0,0 +1,131 @@
+package crispr
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestScoringContext checks that contexts read the site on the guide strand
+func TestScoringContext(t *testing.T) {
+	for _, enzyme := range []CasEnzyme{Cas9, Cas12a} {
+		designer := NewDesigner(enzyme)
+		guides, err := designer.chopchop.FindGuides(tp53Exon, "custom", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, guide := range guides {
+			context := designer.getContext(&guide, tp53Exon, 0, 4, 3)
+			site := guide.Sequence + guide.PAMSequence
+			if enzyme == Cas12a {
+				site = guide.PAMSequence + guide.Sequence
+			}
+			if len(context) != len(site)+7 || context[4:4+len(site)] != site {
+				t.Errorf("%s %s guide %s: context %s", enzyme, guide.Strand, guide.Sequence, context)
+			}
+		}
+	}
+}
+
+// TestScoringModelSelection picks models per request and records them
+func TestScoringModelSelection(t *testing.T) {
+	tests := []struct {
+		enzyme CasEnzyme
+		model  string
+		want   string
+	}{
+		{Cas9, "", ModelDoench2016},
+		{Cas9, ModelIVTHeuristic, ModelIVTHeuristic},
+		{Cas12a, "", ModelCas12aHeuristic},
+	}
+
+	for _, tt := range tests {
+		response, err := NewDesigner(tt.enzyme).Design(DesignRequest{
+			Sequence:     tp53Exon,
+			Enzyme:       tt.enzyme,
+			ScoringModel: tt.model,
+			GCMin:        20,
+			GCMax:        80,
+			MinDoench:    0.01,
+		})
+		if err != nil {
+			t.Fatalf("%s/%q: %v", tt.enzyme, tt.model, err)
+		}
+		if len(response.Guides) == 0 {
+			t.Fatalf("%s/%q: no guides", tt.enzyme, tt.model)
+		}
+		for _, guide := range response.Guides {
+			if guide.ScoringModel != tt.want || guide.DoenchScore <= 0 || guide.DoenchScore >= 1 {
+				t.Errorf("%s/%q: %s scored %.3f by %q", tt.enzyme, tt.model, guide.ID, guide.DoenchScore, guide.ScoringModel)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		enzyme CasEnzyme
+		model  string
+	}{
+		{Cas12a, ModelDoench2016},
+		{Cas9, ModelCas12aHeuristic},
+		{Cas9, "rule_set_9"},
+	} {
+		if _, err := NewDesigner(tt.enzyme).Design(DesignRequest{Sequence: tp53Exon, Enzyme: tt.enzyme, ScoringModel: tt.model}); err == nil {
+			t.Errorf("Expected error for %s with %s", tt.enzyme, tt.model)
+		}
+	}
+}
+
+// TestWeightsScorer loads a weights file and exports its scores
+func TestWeightsScorer(t *testing.T) {
+	weights := `{
+		"name": "lab_v1",
+		"enzymes": ["SpCas9"],
+		"upstream": 4,
+		"downstream": 3,
+		"intercept": 0.2,
+		"features": [
+			{"position": 5, "sequence": "g", "weight": 0.3},
+			{"position": 25, "sequence": "AGG", "weight": 0.1}
+		],
+		"gc_high": -0.05
+	}`
+	scorer, err := ParseScoringModel(strings.NewReader(weights))
+	if err != nil {
+		t.Fatalf("ParseScoringModel failed: %v", err)
+	}
+
+	// 4 nt + protospacer + PAM + 3 nt; G at 5, AGG PAM and 13 GC bases
+	context := "ACGT" + "GGAGGAGCCGCAGTCAGATC" + "AGG" + "TTA"
+	if score := scorer.Score(GuideRNA{Sequence: "GGAGGAGCCGCAGTCAGATC"}, context); math.Abs(score-(0.2+0.3+0.1-0.05*3)) > 1e-9 {
+		t.Errorf("score %.3f, want 0.45", score)
+	}
+
+	designer := NewDesigner(Cas9)
+	designer.RegisterScorer(scorer)
+	response, err := designer.Design(DesignRequest{Sequence: tp53Exon, Enzyme: Cas9, ScoringModel: "lab_v1", MinDoench: 0.01})
+	if err != nil {
+		t.Fatalf("Design failed: %v", err)
+	}
+	if len(response.Guides) == 0 || response.Guides[0].ScoringModel != "lab_v1" {
+		t.Fatalf("Guides not scored by lab_v1: %+v", response.Guides)
+	}
+
+	csvData, err := NewExporter().ExportCSV(response.Guides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(csvData), "Scoring Model") || !strings.Contains(string(csvData), ",lab_v1,") {
+		t.Error("CSV export does not record the scoring model")
+	}
+
+	for _, bad := range []string{
+		`{"name": "doench2016", "enzymes": ["SpCas9"]}`,
+		`{"name": "no_enzymes"}`,
+		`{"name": "bad_feature", "enzymes": ["SpCas9"], "features": [{"position": 0, "sequence": "A"}]}`,
+	} {
+		if _, err := ParseScoringModel(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package crispr
+
+// buildSuffixArray returns the suffix array of text using SA-IS
+// (Nong, Zhang & Chan 2009), which runs in linear time and needs no
+// per-suffix comparison. The last symbol of text must be a unique
+// sentinel 0; all other symbols must lie in [1, alphabetSize).
+func buildSuffixArray(text []int32, alphabetSize int) []int32 {
+	sa := make([]int32, len(text))
+	sais(text, sa, alphabetSize)
+	return sa
+}
+
+// sais fills sa with the suffix array of t
+func sais(t []int32, sa []int32, k int) {
+	n := len(t)
+	if n == 1 {
+		sa[0] = 0
+		return
+	}
+
+	// Classify suffixes: S-type if smaller than the following suffix
+	isS := make([]bool, n)
+	isS[n-1] = true
+	for i := n - 2; i >= 0; i-- {
+		isS[i] = t[i] < t[i+1] || (t[i] == t[i+1] && isS[i+1])
+	}
+	isLMS := func(i int) bool {
+		return i > 0 && isS[i] && !isS[i-1]
+	}
+
+	counts := make([]int32, k)
+	for _, c := range t {
+		counts[c]++
+	}
+	bkt := make([]int32, k)
+	bucketEnds := func() {
+		var sum int32
+		for c := 0; c < k; c++ {
+			sum += counts[c]
+			bkt[c] = sum
+		}
+	}
+	bucketStarts := func() {
+		var sum int32
+		for c := 0; c < k; c++ {
+			bkt[c] = sum
+			sum += counts[c]
+		}
+	}
+	induce := func() {
+		bucketStarts()
+		for i := 0; i < n; i++ {
+			if j := sa[i] - 1; sa[i] > 0 && !isS[j] {
+				sa[bkt[t[j]]] = j
+				bkt[t[j]]++
+			}
+		}
+		bucketEnds()
+		for i := n - 1; i >= 0; i-- {
+			if j := sa[i] - 1; sa[i] > 0 && isS[j] {
+				bkt[t[j]]--
+				sa[bkt[t[j]]] = j
+			}
+		}
+	}
+
+	// Step 1: sort LMS substrings by placing LMS suffixes at bucket ends and inducing
+	for i := range sa {
+		sa[i] = -1
+	}
+	bucketEnds()
+	for i := 1; i < n; i++ {
+		if isLMS(i) {
+			bkt[t[i]]--
+			sa[bkt[t[i]]] = int32(i)
+		}
+	}
+	induce()
+
+	// Step 2: compact the sorted LMS positions and name the LMS substrings
+	m := 0
+	for i := 0; i < n; i++ {
+		if isLMS(int(sa[i])) {
+			sa[m] = sa[i]
+			m++
+		}
+	}
+	for i := m; i < n; i++ {
+		sa[i] = -1
+	}
+
+	names := 0
+	prev := -1
+	for i := 0; i < m; i++ {
+		pos := int(sa[i])
+		diff := false
+		for d := 0; d < n; d++ {
+			if prev == -1 || t[pos+d] != t[prev+d] || isS[pos+d] != isS[prev+d] {
+				diff = true
+				break
+			}
+			if d > 0 && (isLMS(pos+d) || isLMS(prev+d)) {
+				break
+			}
+		}
+		if diff {
+			names++
+			prev = pos
+		}
+		sa[m+pos/2] = int32(names - 1)
+	}
+	j := n - 1
+	for i := n - 1; i >= m; i-- {
+		if sa[i] >= 0 {
+			sa[j] = sa[i]
+			j--
+		}
+	}
+
+	// Step 3: sort the reduced problem, recursing if names are not unique
+	s1 := append([]int32(nil), sa[n-m:]...)
+	sa1 := sa[:m]
+	if names < m {
+		sais(s1, sa1, names)
+	} else {
+		for i := 0; i < m; i++ {
+			sa1[s1[i]] = int32(i)
+		}
+	}
+
+	// Step 4: place sorted LMS suffixes and induce the full suffix array
+	j = 0
+	for i := 1; i < n; i++ {
+		if isLMS(i) {
+			s1[j] = int32(i)
+			j++
+		}
+	}
+	for i := 0; i < m; i++ {
+		sa1[i] = s1[sa1[i]]
+	}
+	for i := m; i < n; i++ {
+		sa[i] = -1
+	}
+	bucketEnds()
+	for i := m - 1; i >= 0; i-- {
+		p := sa[i]
+		sa[i] = -1
+		bkt[t[p]]--
+		sa[bkt[t[p]]] = p
+	}
+	induce()
+}
@@ -19,7 +19,8 @@ const (
 type PAMSequence struct {
 	Enzyme       CasEnzyme
 	Pattern      string   // Regex pattern for PAM
-	Offset       int      // Offset from guide sequence (-3 for NGG)
+	IUPAC        string   // PAM as IUPAC codes (e.g., "NGG"), used by the FM-index search
+	Offset       int      // Guide start relative to the PAM start (3prime) or end (5prime)
 	GuideLength  int      // Length of guide RNA (20 for Cas9, 23 for Cas12a)
 	Orientation  string   // "3prime" or "5prime"
 }
@@ -35,11 +36,17 @@ type GuideRNA struct {
 	Enzyme          CasEnzyme `json:"enzyme"`
 
 	// Scoring metrics
-	DoenchScore     float64   `json:"doench_score"`    // On-target efficiency (0-1)
+	DoenchScore     float64   `json:"doench_score"`    // On-target efficiency (0-1) from ScoringModel
+	ScoringModel    string    `json:"scoring_model,omitempty"` // On-target model that produced DoenchScore
 	GCContent       float64   `json:"gc_content"`      // GC percentage (0-100)
 	SelfCompScore   float64   `json:"self_comp_score"` // Self-complementarity
 	OffTargetCount  int       `json:"off_target_count"`// Number of off-targets
 	OffTargetScore  float64   `json:"off_target_score"`// Off-target specificity (0-100)
+	OffTargets      []OffTargetSite `json:"off_targets,omitempty"` // Highest-scoring off-target sites
+
+	// Variant-aware design
+	Variants        []GuideVariant `json:"variants,omitempty"`        // Known variants in the protospacer or PAM
+	AlleleSpecific  bool      `json:"allele_specific,omitempty"` // Matches an ALT allele, not the reference
 
 	// Composite score
 	RankScore       float64   `json:"rank_score"`      // Final ranking score
@@ -63,14 +70,50 @@ type DesignRequest struct {
 	Enzyme      CasEnzyme `json:"enzyme"`
 	MaxGuides   int       `json:"max_guides"`   // Number of guides to return (default: 10)
 	MinDoench   float64   `json:"min_doench"`   // Minimum Doench score (default: 0.2)
+	ScoringModel string   `json:"scoring_model,omitempty"` // On-target model (default: doench2016, cas12a_heuristic for Cas12a)
 	MaxOffTarget int      `json:"max_off_target"` // Max allowed off-targets (default: 5)
+	MaxBulges    int      `json:"max_bulges,omitempty"` // DNA and RNA bulges allowed in off-target sites (default: 0, max: 2)
 
 	// Optional filters
 	GCMin       float64   `json:"gc_min,omitempty"` // Min GC% (default: 40)
 	GCMax       float64   `json:"gc_max,omitempty"` // Max GC% (default: 60)
 	ExcludePolyT bool     `json:"exclude_poly_t"`   // Exclude TTTT runs
+
+	// Editing modes: the target variant, in the same coordinates as
+	// GuideRNA.Position (1-based genomic, or 0-based offsets into Sequence)
+	Mode         DesignMode `json:"mode,omitempty"`          // "nuclease" (default), "base_edit", "prime_edit", "paired_deletion" or "knock_in"
+	EditPosition int        `json:"edit_position,omitempty"` // Position of the first reference base
+	RefAllele    string     `json:"ref_allele,omitempty"`    // Defaults to the reference base at EditPosition
+	AltAllele    string     `json:"alt_allele,omitempty"`    // Desired allele ("" or "-" for deletions)
+	BaseEditor   string     `json:"base_editor,omitempty"`   // Restrict to one editor (e.g., "ABE8e")
+	PrimeEdit    *PrimeEditOptions `json:"prime_edit,omitempty"`
+
+	// Paired deletion: the first and last deleted base, in the same
+	// coordinates as EditPosition
+	DeletionStart int `json:"deletion_start,omitempty"`
+	DeletionEnd   int `json:"deletion_end,omitempty"`
+	MaxCutOffset  int `json:"max_cut_offset,omitempty"` // Max cut distance outside the deletion (default: 200)
+
+	// Knock-in: InsertSequence goes immediately before EditPosition
+	InsertSequence string        `json:"insert_sequence,omitempty"`
+	Donor          *DonorOptions `json:"donor,omitempty"`
+
+	// Known variants to flag, exclude or target (nuclease, paired_deletion
+	// and knock_in modes)
+	Variants *VariantOptions `json:"variants,omitempty"`
 }
 
+// DesignMode selects what a design request produces
+type DesignMode string
+
+const (
+	ModeNuclease       DesignMode = "nuclease"        // Cutting guides (default)
+	ModeBaseEdit       DesignMode = "base_edit"       // Cytosine/adenine base editor guides
+	ModePrimeEdit      DesignMode = "prime_edit"      // pegRNAs and nicking guides
+	ModePairedDeletion DesignMode = "paired_deletion" // Guide pairs flanking a deletion
+	ModeKnockIn        DesignMode = "knock_in"        // Guide and HDR donor template
+)
+
 // DesignResponse represents the CRISPR design output
 type DesignResponse struct {
 	Guides        []GuideRNA `json:"guides"`
@@ -78,6 +121,12 @@ type DesignResponse struct {
 	Region        string     `json:"region"`
 	ProcessingTime float64   `json:"processing_time_ms"`
 	Warnings      []string   `json:"warnings,omitempty"`
+
+	// Editing modes
+	BaseEdits     []BaseEditGuide `json:"base_edits,omitempty"`
+	PegRNAs       []PegRNA        `json:"peg_rnas,omitempty"`
+	Pairs         []GuidePair     `json:"pairs,omitempty"`
+	KnockIns      []KnockInDesign `json:"knock_ins,omitempty"`
 }
 
 // OffTargetSite represents a potential off-target binding site
@@ -90,6 +139,9 @@ type OffTargetSite struct {
 	InGene        bool    `json:"in_gene"`
 	GeneName      string  `json:"gene_name,omitempty"`
 	Score         float64 `json:"score"`          // CFD score or similar
+	Strand        string  `json:"strand,omitempty"`
+	DNABulges     int     `json:"dna_bulges,omitempty"` // Extra genomic bases
+	RNABulges     int     `json:"rna_bulges,omitempty"` // Unpaired guide bases
 }
 
 // ExportFormat represents export file formats
@@ -104,9 +156,11 @@ const (
 
 // ExportRequest represents an export request
 type ExportRequest struct {
-	Guides  []GuideRNA   `json:"guides"`
-	Format  ExportFormat `json:"format"`
-	Options map[string]interface{} `json:"options,omitempty"`
+	Guides    []GuideRNA      `json:"guides"`
+	BaseEdits []BaseEditGuide `json:"base_edits,omitempty"`
+	PegRNAs   []PegRNA        `json:"peg_rnas,omitempty"`
+	Format    ExportFormat    `json:"format"`
+	Options   map[string]interface{} `json:"options,omitempty"`
 }
 
 // GetPAMSequence returns PAM configuration for a given enzyme
@@ -116,7 +170,8 @@ func GetPAMSequence(enzyme CasEnzyme) PAMSequence {
 		return PAMSequence{
 			Enzyme:      enzyme,
 			Pattern:     "[ACGT]GG",  // NGG
-			Offset:      -3,
+			IUPAC:       "NGG",
+			Offset:      -20,
 			GuideLength: 20,
 			Orientation: "3prime",
 		}
@@ -124,7 +179,8 @@ func GetPAMSequence(enzyme CasEnzyme) PAMSequence {
 		return PAMSequence{
 			Enzyme:      enzyme,
 			Pattern:     "[ACGT]G[ACGT]",  // NGA, NGC, NGT
-			Offset:      -3,
+			IUPAC:       "NGN",
+			Offset:      -20,
 			GuideLength: 20,
 			Orientation: "3prime",
 		}
@@ -132,7 +188,8 @@ func GetPAMSequence(enzyme CasEnzyme) PAMSequence {
 		return PAMSequence{
 			Enzyme:      enzyme,
 			Pattern:     "TTT[ACGT]",  // TTTV
-			Offset:      4,
+			IUPAC:       "TTTN",
+			Offset:      0,
 			GuideLength: 23,
 			Orientation: "5prime",
 		}
@@ -140,6 +197,7 @@ func GetPAMSequence(enzyme CasEnzyme) PAMSequence {
 		return PAMSequence{
 			Enzyme:      enzyme,
 			Pattern:     "",  // No strict PAM for Cas13
+			IUPAC:       "",
 			Offset:      0,
 			GuideLength: 28,
 			Orientation: "5prime",
@@ -147,16 +205,18 @@ func GetPAMSequence(enzyme CasEnzyme) PAMSequence {
 	case SaCas9:
 		return PAMSequence{
 			Enzyme:      enzyme,
-			Pattern:     "[ACGT][ACGT]GRRT",  // NNGRRT
-			Offset:      -6,
+			Pattern:     "[ACGT][ACGT]G[AG][AG]T",  // NNGRRT
+			IUPAC:       "NNGRRT",
+			Offset:      -21,
 			GuideLength: 21,
 			Orientation: "3prime",
 		}
 	case NmeCas9:
 		return PAMSequence{
 			Enzyme:      enzyme,
-			Pattern:     "[ACGT]{8}G[ACGT]TT",  // NNNNGATT
-			Offset:      -8,
+			Pattern:     "[ACGT]{4}GATT",  // NNNNGATT
+			IUPAC:       "NNNNGATT",
+			Offset:      -24,
 			GuideLength: 24,
 			Orientation: "3prime",
 		}
@@ -165,7 +225,8 @@ func GetPAMSequence(enzyme CasEnzyme) PAMSequence {
 		return PAMSequence{
 			Enzyme:      Cas9,
 			Pattern:     "[ACGT]GG",
-			Offset:      -3,
+			IUPAC:       "NGG",
+			Offset:      -20,
 			GuideLength: 20,
 			Orientation: "3prime",
 		}
@@ -0,0 +1,428 @@
+package crispr
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"genomevedic/internal/mutations"
+)
+
+// defaultMinAlleleFrequency is the population frequency from which a
+// variant counts as common
+const defaultMinAlleleFrequency = 0.01
+
+// Variant actions for guides overlapping a known variant
+const (
+	VariantActionFlag    = "flag"
+	VariantActionExclude = "exclude"
+)
+
+// Where a variant falls within a guide's target site
+const (
+	regionPAM    = "PAM"
+	regionSeed   = "seed"
+	regionDistal = "distal"
+)
+
+// VariantOptions makes guide design aware of known variants. Variants come
+// from an inline VCF or, without one, the server's population VCF, and are
+// compared with each guide's protospacer and PAM. Requests cannot name
+// server files.
+//
+// With a sample (or a single-sample VCF) the variants are the alleles that
+// sample carries; otherwise they are the sites with INFO AF at or above
+// MinAlleleFrequency, or without AF. For Sequence input, VCF positions are
+// 1-based positions in the sequence and CHROM is ignored.
+type VariantOptions struct {
+	VCF                string  `json:"vcf,omitempty"`                  // Inline VCF text
+	Sample             string  `json:"sample,omitempty"`               // Patient or cell line sample column
+	MinAlleleFrequency float64 `json:"min_allele_frequency,omitempty"` // Common variant threshold (default: 0.01)
+	Action             string  `json:"action,omitempty"`               // "flag" (default) or "exclude" guides overlapping variants
+	AlleleSpecific     bool    `json:"allele_specific,omitempty"`      // Also design guides that only match ALT alleles
+}
+
+// withDefaults returns the options with defaults filled in
+func (o VariantOptions) withDefaults() VariantOptions {
+	if o.MinAlleleFrequency == 0 {
+		o.MinAlleleFrequency = defaultMinAlleleFrequency
+	}
+	if o.Action == "" {
+		o.Action = VariantActionFlag
+	}
+	return o
+}
+
+// validate checks the options
+func (o VariantOptions) validate() error {
+	if o.MinAlleleFrequency < 0 || o.MinAlleleFrequency > 1 {
+		return fmt.Errorf("min_allele_frequency must be between 0 and 1")
+	}
+	if o.Action != VariantActionFlag && o.Action != VariantActionExclude {
+		return fmt.Errorf("unknown variant action %q; use flag or exclude", o.Action)
+	}
+	return nil
+}
+
+// KnownVariant is a VCF allele in the target region, trimmed to its
+// minimal representation
+type KnownVariant struct {
+	ID              string  `json:"id,omitempty"`
+	Chromosome      string  `json:"chromosome"`
+	Position        int     `json:"position"` // Same coordinates as GuideRNA.Position
+	Ref             string  `json:"ref"`
+	Alt             string  `json:"alt"`
+	AlleleFrequency float64 `json:"allele_frequency,omitempty"` // INFO AF
+	Genotype        string  `json:"genotype,omitempty"`         // Sample genotype (e.g., "0/1")
+}
+
+// String formats the variant as chromosome:position ref>alt
+func (v KnownVariant) String() string {
+	return fmt.Sprintf("%s:%d %s>%s", v.Chromosome, v.Position, v.Ref, v.Alt)
+}
+
+// refSpan returns the reference bases the variant changes. Insertions
+// change no base but split the two around them, so a site must contain
+// the whole span (spanning).
+func (v KnownVariant) refSpan() (from, to int, spanning bool) {
+	switch {
+	case len(v.Ref) == len(v.Alt):
+		return v.Position, v.Position + len(v.Ref), false
+	case len(v.Ref) > len(v.Alt):
+		return v.Position + 1, v.Position + len(v.Ref), false
+	}
+	return v.Position, v.Position + 2, true
+}
+
+// altSpan returns the bases the variant changes on the ALT haplotype,
+// where a deletion leaves a junction between its anchor and the next base
+func (v KnownVariant) altSpan() (from, to int, spanning bool) {
+	switch {
+	case len(v.Ref) == len(v.Alt):
+		return v.Position, v.Position + len(v.Alt), false
+	case len(v.Alt) > len(v.Ref):
+		return v.Position + 1, v.Position + len(v.Alt), false
+	}
+	return v.Position, v.Position + 2, true
+}
+
+// GuideVariant is a known variant inside a guide's protospacer or PAM
+type GuideVariant struct {
+	KnownVariant
+	Region   string `json:"region"`             // "PAM", "seed" or "distal"
+	Targeted bool   `json:"targeted,omitempty"` // The guide matches the ALT allele
+}
+
+// loadVariants reads the variants overlapping the target sequence
+func (d *Designer) loadVariants(options VariantOptions, chromosome string, startPos, length int) ([]KnownVariant, error) {
+	var reader *mutations.VCFReader
+	var err error
+	if options.VCF != "" {
+		reader, err = mutations.NewVCFReader(strings.NewReader(options.VCF))
+	} else {
+		reader, err = mutations.OpenVCF(d.populationVCF)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read variants: %w", err)
+	}
+	defer reader.Close()
+
+	sample := -1
+	samples := reader.Header().Samples
+	switch {
+	case options.Sample != "":
+		for i, name := range samples {
+			if name == options.Sample {
+				sample = i
+			}
+		}
+		if sample < 0 {
+			return nil, fmt.Errorf("sample %q is not in the VCF", options.Sample)
+		}
+	case len(samples) == 1:
+		sample = 0
+	}
+
+	// VCF positions are 1-based; Sequence input uses 0-based offsets
+	custom := chromosome == "custom"
+	offset := 0
+	if custom {
+		offset = 1
+	}
+	first, last := startPos+offset, startPos+length-1+offset
+	if reader.Indexed() && !custom {
+		if err := reader.Query(chromosome, uint64(first), uint64(last)); err != nil {
+			return nil, fmt.Errorf("failed to query variants: %w", err)
+		}
+	}
+
+	var variants []KnownVariant
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read variants: %w", err)
+		}
+		if !custom && strings.TrimPrefix(record.Chromosome, "chr") != strings.TrimPrefix(chromosome, "chr") {
+			continue
+		}
+		if int(record.End()) < first || int(record.Position) > last || !record.Passed() {
+			continue
+		}
+
+		for i, alt := range record.Alts {
+			alt = strings.ToUpper(alt)
+			if mutations.IsSymbolicAllele(alt) {
+				continue
+			}
+			position, ref, trimmed := mutations.TrimAlleles(record.Position, strings.ToUpper(record.Ref), alt)
+			variant := KnownVariant{
+				Chromosome: chromosome,
+				Position:   int(position) - offset,
+				Ref:        ref,
+				Alt:        trimmed,
+			}
+			if len(record.IDs) > 0 {
+				variant.ID = record.IDs[0]
+			}
+			af, err := strconv.ParseFloat(record.AltInfo("AF", i), 64)
+			if err == nil {
+				variant.AlleleFrequency = af
+			}
+
+			if sample >= 0 && sample < len(record.Genotypes) {
+				genotype := record.Genotypes[sample]
+				if !genotype.Carries(i + 1) {
+					continue
+				}
+				variant.Genotype = formatGenotype(genotype)
+			} else if err == nil && af < options.MinAlleleFrequency {
+				continue
+			}
+			variants = append(variants, variant)
+		}
+	}
+	return variants, nil
+}
+
+// formatGenotype writes a genotype's alleles as in the GT field
+func formatGenotype(genotype mutations.VCFGenotype) string {
+	separator := "/"
+	if genotype.Phased {
+		separator = "|"
+	}
+	alleles := make([]string, len(genotype.Alleles))
+	for i, allele := range genotype.Alleles {
+		alleles[i] = "."
+		if allele >= 0 {
+			alleles[i] = strconv.Itoa(allele)
+		}
+	}
+	return strings.Join(alleles, separator)
+}
+
+// pamSpan returns the forward-strand span of a guide's PAM
+func pamSpan(guide GuideRNA, pam PAMSequence) (int, int) {
+	length := len(guide.PAMSequence)
+	if (pam.Orientation == "3prime") == (guide.Strand == "+") {
+		end := guide.Position + len(guide.Sequence)
+		return end, end + length
+	}
+	return guide.Position - length, guide.Position
+}
+
+// variantRegion returns where the bases from-to fall in a guide's target
+// site, the most disruptive region first, or "" when they miss the site.
+// A spanning change must lie wholly within the site.
+func variantRegion(guide GuideRNA, pam PAMSequence, from, to int, spanning bool) string {
+	pamStart, pamEnd := pamSpan(guide, pam)
+	siteStart := min(guide.Position, pamStart)
+	siteEnd := max(guide.Position+len(guide.Sequence), pamEnd)
+	if spanning && (from < siteStart || to > siteEnd) {
+		return ""
+	}
+
+	region := ""
+	for x := max(from, siteStart); x < min(to, siteEnd); x++ {
+		if x >= pamStart && x < pamEnd {
+			return regionPAM
+		}
+		index := x - guide.Position
+		if guide.Strand == "-" {
+			index = guide.Position + len(guide.Sequence) - 1 - x
+		}
+		fromPAM := index
+		if pam.Orientation == "3prime" {
+			fromPAM = len(guide.Sequence) - 1 - index
+		}
+		if fromPAM < seedLength {
+			region = regionSeed
+		} else if region == "" {
+			region = regionDistal
+		}
+	}
+	return region
+}
+
+// applyVariants annotates guides with the known variants in their target
+// sites, excluding them if requested, and adds allele-specific guides.
+// Allele-specific guides are scored on the ALT haplotype; quality filters
+// are not applied since the variant position constrains the choice.
+func (d *Designer) applyVariants(req DesignRequest, guides []GuideRNA, sequence, chromosome string, startPos int, scorer OnTargetScorer) ([]GuideRNA, []string, error) {
+	if req.Variants == nil {
+		return guides, nil, nil
+	}
+	options := req.Variants.withDefaults()
+	sequence = strings.ToUpper(sequence)
+
+	loaded, err := d.loadVariants(options, chromosome, startPos, len(sequence))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Drop variants whose REF disagrees with the target, e.g. from another
+	// genome build
+	var warnings []string
+	var variants []KnownVariant
+	for _, variant := range loaded {
+		i := variant.Position - startPos
+		if i >= 0 && i+len(variant.Ref) <= len(sequence) && sequence[i:i+len(variant.Ref)] == variant.Ref {
+			variants = append(variants, variant)
+		}
+	}
+	if mismatched := len(loaded) - len(variants); mismatched > 0 {
+		warnings = append(warnings, fmt.Sprintf("Ignored %d variants whose REF does not match the target sequence; check the genome build", mismatched))
+	}
+	if len(variants) == 0 {
+		return guides, append(warnings, "No variants found in the target region"), nil
+	}
+
+	if options.AlleleSpecific {
+		specific, err := d.alleleSpecificGuides(variants, sequence, chromosome, startPos, scorer)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(specific) == 0 {
+			warnings = append(warnings, "No allele-specific guides: no variant changes the seed or PAM of a guide")
+		}
+		guides = append(guides, specific...)
+	}
+
+	var kept []GuideRNA
+	overlapping := 0
+	for _, guide := range guides {
+		for _, variant := range variants {
+			if len(guide.Variants) > 0 && guide.Variants[0].Targeted && guide.Variants[0].KnownVariant == variant {
+				continue
+			}
+			from, to, spanning := variant.refSpan()
+			if region := variantRegion(guide, d.chopchop.pam, from, to, spanning); region != "" {
+				guide.Variants = append(guide.Variants, GuideVariant{KnownVariant: variant, Region: region})
+			}
+		}
+		if untargetedVariants(guide) > 0 {
+			overlapping++
+			if options.Action == VariantActionExclude {
+				continue
+			}
+		}
+		kept = append(kept, guide)
+	}
+
+	if overlapping > 0 {
+		if options.Action == VariantActionExclude {
+			warnings = append(warnings, fmt.Sprintf("Excluded %d guides overlapping known variants", overlapping))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%d guides overlap known variants in the protospacer or PAM and may not cut every allele", overlapping))
+		}
+	}
+	return kept, warnings, nil
+}
+
+// untargetedVariants counts the variants a guide does not match
+func untargetedVariants(guide GuideRNA) int {
+	count := 0
+	for _, variant := range guide.Variants {
+		if !variant.Targeted {
+			count++
+		}
+	}
+	return count
+}
+
+// alleleSpecificGuides finds guides on each variant's ALT haplotype that
+// do not exist on the reference. Only changes in the PAM or seed are kept,
+// since Cas nucleases tolerate PAM-distal mismatches and would also cut the
+// reference allele. Nearby variants are not phased, so each haplotype
+// carries one variant.
+func (d *Designer) alleleSpecificGuides(variants []KnownVariant, sequence, chromosome string, startPos int, scorer OnTargetScorer) ([]GuideRNA, error) {
+	pam := d.chopchop.pam
+	var specific []GuideRNA
+
+	for _, variant := range variants {
+		i := variant.Position - startPos
+		w0 := max(0, i-guideFlank)
+		w1 := min(len(sequence), i+len(variant.Ref)+guideFlank)
+		haplotype := sequence[w0:i] + variant.Alt + sequence[i+len(variant.Ref):w1]
+
+		refGuides, err := d.chopchop.FindGuides(sequence[w0:w1], chromosome, startPos+w0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find guides: %w", err)
+		}
+		onReference := make(map[string]bool)
+		for _, guide := range refGuides {
+			onReference[guide.Strand+guide.Sequence] = true
+		}
+
+		candidates, err := d.chopchop.FindGuides(haplotype, chromosome, startPos+w0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find guides: %w", err)
+		}
+
+		var found []GuideRNA
+		from, to, spanning := variant.altSpan()
+		for _, guide := range candidates {
+			if onReference[guide.Strand+guide.Sequence] {
+				continue
+			}
+			region := variantRegion(guide, pam, from, to, spanning)
+			if region != regionPAM && region != regionSeed {
+				continue
+			}
+			guide.AlleleSpecific = true
+			guide.Variants = []GuideVariant{{KnownVariant: variant, Region: region, Targeted: true}}
+			found = append(found, guide)
+		}
+		found = d.scoreGuides(found, haplotype, startPos+w0, scorer)
+
+		// Report positions in reference coordinates
+		shift := len(variant.Alt) - len(variant.Ref)
+		for k := range found {
+			guide := &found[k]
+			switch {
+			case guide.Position >= variant.Position+len(variant.Alt):
+				guide.Position -= shift
+			case guide.Position > variant.Position && shift > 0:
+				guide.Position = variant.Position + 1 // Starts inside an insertion
+			}
+			guide.ID = fmt.Sprintf("%s_%s_%d_%s_alt%d", chromosome, guide.Strand, guide.Position, guide.Enzyme, variant.Position)
+		}
+		specific = append(specific, found...)
+	}
+	return specific, nil
+}
+
+// variantSummary lists a guide's known variants for exports
+func variantSummary(guide GuideRNA) string {
+	parts := make([]string, len(guide.Variants))
+	for i, variant := range guide.Variants {
+		parts[i] = fmt.Sprintf("%s (%s)", variant.KnownVariant, variant.Region)
+		if variant.Targeted {
+			parts[i] = fmt.Sprintf("%s (%s, targeted)", variant.KnownVariant, variant.Region)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
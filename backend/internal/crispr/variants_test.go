@@ -0,0 +1,172 @@
+package crispr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// variantVCF builds a VCF over tp53Exon (1-based positions in the sequence)
+func variantVCF(samples []string, records ...string) string {
+	header := "##fileformat=VCFv4.2\n" +
+		"##INFO=<ID=AF,Number=A,Type=Float,Description=\"Allele frequency\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO"
+	if len(samples) > 0 {
+		header += "\tFORMAT\t" + strings.Join(samples, "\t")
+	}
+	return header + "\n" + strings.Join(records, "\n") + "\n"
+}
+
+// variantDesign designs nuclease guides over tp53Exon with the given options
+func variantDesign(t *testing.T, options VariantOptions) *DesignResponse {
+	t.Helper()
+	response, err := NewDesigner(Cas9).Design(DesignRequest{
+		Sequence:  tp53Exon,
+		Enzyme:    Cas9,
+		MaxGuides: 50,
+		MinDoench: 0.01,
+		GCMin:     20,
+		GCMax:     80,
+		Variants:  &options,
+	})
+	if err != nil {
+		t.Fatalf("Design failed: %v", err)
+	}
+	return response
+}
+
+// TestVariantFlagging flags and excludes guides overlapping common variants
+func TestVariantFlagging(t *testing.T) {
+	// A common SNV at offset 46: the seed of the - guide at 37, PAM-distal
+	// for the - guide at 36 and the + guide at 46. A rare SNV in the PAM of
+	// the + guide at 26 is ignored.
+	vcf := variantVCF(nil,
+		fmt.Sprintf("custom\t47\trs1\t%c\tC\t.\tPASS\tAF=0.2", tp53Exon[46]),
+		"custom\t48\trs2\tG\tA\t.\tPASS\tAF=0.001",
+	)
+
+	response := variantDesign(t, VariantOptions{VCF: vcf})
+	regions := make(map[string]string)
+	for _, guide := range response.Guides {
+		for _, variant := range guide.Variants {
+			if variant.ID != "rs1" || variant.Position != 46 || variant.AlleleFrequency != 0.2 || variant.Targeted {
+				t.Errorf("%s: unexpected variant %+v", guide.ID, variant)
+			}
+			regions[guide.ID] = variant.Region
+		}
+	}
+	if regions["custom_-_37_SpCas9"] != regionSeed || regions["custom_-_36_SpCas9"] != regionDistal || regions["custom_+_46_SpCas9"] != regionDistal {
+		t.Errorf("Unexpected variant regions %v", regions)
+	}
+	if len(response.Warnings) == 0 {
+		t.Error("Expected a warning for guides overlapping variants")
+	}
+
+	response = variantDesign(t, VariantOptions{VCF: vcf, Action: VariantActionExclude})
+	for _, guide := range response.Guides {
+		if _, flagged := regions[guide.ID]; flagged || len(guide.Variants) > 0 {
+			t.Errorf("%s overlaps a common variant but was kept", guide.ID)
+		}
+	}
+
+	// A variant from another build is ignored with a warning
+	response = variantDesign(t, VariantOptions{VCF: variantVCF(nil, "custom\t1\t.\tC\tT\t.\tPASS\tAF=0.3")})
+	if len(response.Warnings) == 0 || !strings.Contains(strings.Join(response.Warnings, " "), "REF does not match") {
+		t.Errorf("Expected a REF mismatch warning, got %v", response.Warnings)
+	}
+}
+
+// TestAlleleSpecificGuides designs guides that only match a patient's ALT
+// allele
+func TestAlleleSpecificGuides(t *testing.T) {
+	// Heterozygous G>A at offset 47 breaks the AGG PAM of the + guide at 26
+	// and changes the seed of - guides reading through it
+	vcf := variantVCF([]string{"patient", "control"},
+		"custom\t48\t.\tG\tA\t.\tPASS\t.\tGT\t0/1\t0/0",
+		"custom\t41\t.\tT\tC\t.\tPASS\t.\tGT\t0/0\t0/1",
+	)
+	haplotype := tp53Exon[:47] + "A" + tp53Exon[48:]
+
+	response := variantDesign(t, VariantOptions{VCF: vcf, Sample: "patient", AlleleSpecific: true})
+	specific := 0
+	for _, guide := range response.Guides {
+		if !guide.AlleleSpecific {
+			for _, variant := range guide.Variants {
+				if variant.Position != 47 || variant.Genotype != "0/1" {
+					t.Errorf("%s: unexpected variant %+v", guide.ID, variant)
+				}
+			}
+			continue
+		}
+		specific++
+
+		variant := guide.Variants[0]
+		if !variant.Targeted || variant.Position != 47 || (variant.Region != regionPAM && variant.Region != regionSeed) {
+			t.Errorf("%s: targets %+v", guide.ID, variant)
+		}
+		site := guide.Sequence + guide.PAMSequence
+		if strings.Contains(tp53Exon, site) || strings.Contains(reverseComplement(tp53Exon), site) {
+			t.Errorf("%s: %s also matches the reference allele", guide.ID, site)
+		}
+		if !strings.Contains(haplotype, site) && !strings.Contains(reverseComplement(haplotype), site) {
+			t.Errorf("%s: %s does not match the ALT allele", guide.ID, site)
+		}
+		if guide.DoenchScore <= 0 {
+			t.Errorf("%s: not scored", guide.ID)
+		}
+	}
+	if specific == 0 {
+		t.Fatal("Expected allele-specific guides")
+	}
+
+	for _, req := range []DesignRequest{
+		{Sequence: tp53Exon, Enzyme: Cas9, Variants: &VariantOptions{VCF: vcf, Sample: "nobody"}},
+		{Sequence: tp53Exon, Enzyme: Cas9, Variants: &VariantOptions{}},
+		{Sequence: tp53Exon, Enzyme: Cas9, Variants: &VariantOptions{VCF: vcf, Action: "ignore"}},
+		{Sequence: tp53Exon, Enzyme: Cas9, Mode: ModeBaseEdit, EditPosition: 40, AltAllele: "T", Variants: &VariantOptions{VCF: vcf}},
+	} {
+		if _, err := NewDesigner(Cas9).Design(req); err == nil {
+			t.Errorf("Expected error for %+v", req.Variants)
+		}
+	}
+}
+
+// TestPopulationVCF reads the configured population VCF when a request has
+// no inline VCF, and never a path named by the request
+func TestPopulationVCF(t *testing.T) {
+	vcf := variantVCF(nil, fmt.Sprintf("custom\t47\trs1\t%c\tC\t.\tPASS\tAF=0.2", tp53Exon[46]))
+	path := filepath.Join(t.TempDir(), "population.vcf")
+	if err := os.WriteFile(path, []byte(vcf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var req DesignRequest
+	body := fmt.Sprintf(`{"sequence": %q, "enzyme": "SpCas9", "max_guides": 50, "min_doench": 0.01, "gc_min": 20, "gc_max": 80, "variants": {"vcf_path": %q}}`, tp53Exon, path)
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDesigner(Cas9).Design(req); err == nil || !strings.Contains(err.Error(), "no population VCF") {
+		t.Errorf("Expected vcf_path to be ignored, got %v", err)
+	}
+
+	designer := NewDesigner(Cas9)
+	designer.SetPopulationVCF(path)
+	response, err := designer.Design(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flagged := 0
+	for _, guide := range response.Guides {
+		for _, variant := range guide.Variants {
+			if variant.ID == "rs1" {
+				flagged++
+			}
+		}
+	}
+	if flagged == 0 {
+		t.Error("Expected guides flagged from the population VCF")
+	}
+}
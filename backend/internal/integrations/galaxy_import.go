@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"genomevedic/backend/pkg/types"
+	"genomevedic/internal/alignment"
 )
 
 // GalaxyImportRequest represents a BAM import request from Galaxy
@@ -56,6 +60,7 @@ type ImportStats struct {
 	TotalReads       int64   `json:"total_reads"`
 	MappedReads      int64   `json:"mapped_reads"`
 	UnmappedReads    int64   `json:"unmapped_reads"`
+	QCFailReads      int64   `json:"qc_fail_reads"`
 	DuplicateReads   int64   `json:"duplicate_reads"`
 	LowQualityReads  int64   `json:"low_quality_reads"`
 	AverageQuality   float64 `json:"average_quality"`
@@ -125,6 +130,7 @@ func (bi *BAMImporter) ImportBAM(ctx context.Context, req GalaxyImportRequest) (
 			"total_reads":        session.Stats.TotalReads,
 			"mapped_reads":       session.Stats.MappedReads,
 			"unmapped_reads":     session.Stats.UnmappedReads,
+			"qc_fail_reads":      session.Stats.QCFailReads,
 			"duplicate_reads":    session.Stats.DuplicateReads,
 			"low_quality_reads":  session.Stats.LowQualityReads,
 			"average_quality":    session.Stats.AverageQuality,
@@ -143,85 +149,81 @@ func (bi *BAMImporter) ImportBAM(ctx context.Context, req GalaxyImportRequest) (
 
 // processBAM processes the BAM file and converts reads to particles
 func (bi *BAMImporter) processBAM(ctx context.Context, session *ImportSession, req GalaxyImportRequest) error {
-	// NOTE: In production, this would use github.com/biogo/hts/bam
-	// For this implementation, we'll simulate BAM processing using the existing
-	// FASTQ patterns from the loader package
-
 	log.Printf("Processing BAM file: %s (region: %s, quality: %d)",
 		req.BAMPath, req.Region, req.QualityThreshold)
 
-	// Parse region if specified
-	var regionChr string
-	var regionStart, regionEnd int64
-	if req.Region != "" {
-		var err error
-		regionChr, regionStart, regionEnd, err = parseRegion(req.Region)
-		if err != nil {
-			return fmt.Errorf("invalid region: %w", err)
-		}
-		log.Printf("Filtering to region: %s:%d-%d", regionChr, regionStart, regionEnd)
+	reader, regionChr, regionStart, regionEnd, err := openImportReader(req)
+	if err != nil {
+		return err
 	}
+	defer reader.Close()
 
-	// In production, this would open the BAM file using biogo/hts
-	// For demonstration, we'll simulate the processing pipeline:
-	// 1. Stream BAM records
-	// 2. Filter by quality and region
+	// Pipeline:
+	// 1. Stream BAM/SAM records (restricted to the region, if any)
+	// 2. Filter by flags and mapping quality
 	// 3. Convert to particles
 	// 4. Apply Vedic color mapping
-
-	// Simulated BAM processing (replace with actual biogo/hts implementation)
 	particleID := int64(0)
 	qualitySum := 0.0
 	lengthSum := 0.0
+	alignedBases := int64(0)
 
-	// Example: Process simulated reads
-	// In production: reader, err := bam.NewReader(bamFile, threads)
-	for i := 0; i < 10000; i++ { // Simulate processing reads
+	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		// Simulate read processing
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read alignment record %d: %w", session.Stats.TotalReads+1, err)
+		}
+
+		// Secondary/supplementary records describe reads already counted
+		if record.IsSecondary() {
+			continue
+		}
+
 		session.Stats.TotalReads++
 
-		// Check quality threshold
-		simulatedQuality := 30 // In production: read.MapQ
-		if simulatedQuality < req.QualityThreshold {
+		if record.IsUnmapped() {
+			session.Stats.UnmappedReads++
+			continue
+		}
+		if record.Flag&alignment.FlagQCFail != 0 {
+			session.Stats.QCFailReads++
+			continue
+		}
+		if record.IsDuplicate() {
+			session.Stats.DuplicateReads++
+			continue
+		}
+		if int(record.MapQ) < req.QualityThreshold {
 			session.Stats.LowQualityReads++
 			continue
 		}
 
 		session.Stats.MappedReads++
+		qualitySum += float64(record.MapQ)
+		lengthSum += float64(len(record.Seq))
+		alignedBases += record.ReferenceLength()
 
-		// Convert read to particle
-		particle := &types.Particle{
-			ID:       particleID,
-			X:        float32(i % 1000),
-			Y:        float32((i / 1000) % 1000),
-			Z:        float32(i / 1000000),
-			VX:       0,
-			VY:       0,
-			VZ:       0,
-			ColorR:   uint8((i * 37) % 256),
-			ColorG:   uint8((i * 73) % 256),
-			ColorB:   uint8((i * 137) % 256),
-			Size:     1.0,
-			Mass:     1.0,
-			Metadata: fmt.Sprintf("read_%d_q%d", i, simulatedQuality),
+		// Particle limit reached: keep counting statistics but stop allocating
+		if int64(len(session.Particles)) >= bi.maxParticles {
+			continue
 		}
 
+		particle := ConvertReadToParticle(particleID, record.RefName, record.Pos,
+			record.Seq, int(record.MapQ), record.IsReverse())
 		session.Particles = append(session.Particles, particle)
 		particleID++
 
-		qualitySum += float64(simulatedQuality)
-		lengthSum += 150.0 // Simulate 150bp reads
-
-		// Check particle limit
-		if int64(len(session.Particles)) >= bi.maxParticles {
+		if int64(len(session.Particles)) == bi.maxParticles {
 			log.Printf("Reached particle limit: %d", bi.maxParticles)
-			break
 		}
 	}
 
@@ -233,7 +235,18 @@ func (bi *BAMImporter) processBAM(ctx context.Context, session *ImportSession, r
 		session.Stats.AverageLength = lengthSum / float64(session.Stats.MappedReads)
 	}
 
-	session.Stats.ParticlesDensity = float64(len(session.Particles)) / 1.0 // Per MB
+	// Coverage is measured against the queried region, or every reference in the header
+	targetLength := regionEnd - regionStart
+	if regionChr == "" {
+		targetLength = 0
+		for _, ref := range reader.Header().References {
+			targetLength += ref.Length
+		}
+	}
+	if targetLength > 0 {
+		session.Stats.GenomeCoverage = float64(alignedBases) / float64(targetLength)
+		session.Stats.ParticlesDensity = float64(len(session.Particles)) / (float64(targetLength) / 1e6)
+	}
 
 	log.Printf("BAM processing complete: %d reads -> %d particles",
 		session.Stats.TotalReads, len(session.Particles))
@@ -241,21 +254,75 @@ func (bi *BAMImporter) processBAM(ctx context.Context, session *ImportSession, r
 	return nil
 }
 
-// parseRegion parses a genomic region string (e.g., "chr1:1000-2000")
+// openImportReader opens the request's alignment file, restricted to its
+// region if one is given. With a BAI/CSI index only the overlapping BGZF
+// chunks are read. Open-ended regions (e.g. "chr1") are clamped to the
+// reference length; without a region, regionChr is "".
+func openImportReader(req GalaxyImportRequest) (reader alignment.Reader, regionChr string, regionStart, regionEnd int64, err error) {
+	if req.Region == "" {
+		reader, err = alignment.Open(req.BAMPath)
+		return reader, "", 0, 0, err
+	}
+
+	regionChr, regionStart, regionEnd, err = parseRegion(req.Region)
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("invalid region: %w", err)
+	}
+	log.Printf("Filtering to region: %s:%d-%d", regionChr, regionStart, regionEnd)
+
+	reader, indexed, err := alignment.OpenRegion(req.BAMPath, regionChr, regionStart, regionEnd)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	if !indexed {
+		log.Printf("No usable BAM index for %s, scanning whole file for region", req.BAMPath)
+	}
+
+	if refID := reader.Header().ReferenceID(regionChr); refID >= 0 {
+		if refLen := reader.Header().References[refID].Length; refLen > 0 && regionEnd > refLen {
+			regionEnd = refLen
+		}
+	}
+	return reader, regionChr, regionStart, regionEnd, nil
+}
+
+// parseRegion parses a samtools-style region string (e.g., "chr1:1,000-2,000",
+// "chr1:1000" or "chr1"). Input coordinates are 1-based and inclusive; the result
+// is 0-based and half-open so it can be compared directly with BAM positions.
 func parseRegion(region string) (chr string, start, end int64, err error) {
-	// Simple parser for region strings
-	// In production, use a more robust parser
-	var startInt, endInt int
-	n, err := fmt.Sscanf(region, "%[^:]:%d-%d", &chr, &startInt, &endInt)
-	if err != nil || n != 3 {
+	region = strings.TrimSpace(region)
+	colon := strings.LastIndex(region, ":")
+	if colon < 0 {
+		if region == "" {
+			return "", 0, 0, fmt.Errorf("invalid region format: expected 'chr:start-end', got '%s'", region)
+		}
+		return region, 0, math.MaxInt32, nil // Whole chromosome
+	}
+
+	chr = region[:colon]
+	coords := strings.ReplaceAll(region[colon+1:], ",", "")
+	if chr == "" || coords == "" {
 		return "", 0, 0, fmt.Errorf("invalid region format: expected 'chr:start-end', got '%s'", region)
 	}
 
-	if startInt < 0 || endInt < startInt {
+	startStr, endStr, hasEnd := strings.Cut(coords, "-")
+	startInt, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid region format: expected 'chr:start-end', got '%s'", region)
+	}
+	endInt := int64(math.MaxInt32)
+	if hasEnd {
+		endInt, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("invalid region format: expected 'chr:start-end', got '%s'", region)
+		}
+	}
+
+	if startInt < 1 || endInt < startInt {
 		return "", 0, 0, fmt.Errorf("invalid coordinates: start=%d, end=%d", startInt, endInt)
 	}
 
-	return chr, int64(startInt), int64(endInt), nil
+	return chr, startInt - 1, endInt, nil
 }
 
 // GetSessionProgress returns the progress of an active import session
@@ -283,44 +350,40 @@ func (bi *BAMImporter) StreamBAMToParticles(ctx context.Context, req GalaxyImpor
 
 	defer close(particleChan)
 
-	// In production, this would use:
-	// reader, err := bam.NewReader(bamFile, runtime.NumCPU())
-	// for {
-	//     record, err := reader.Read()
-	//     if err == io.EOF { break }
-	//     particle := convertReadToParticle(record)
-	//     particleChan <- particle
-	// }
-
-	// Simulated streaming
-	for i := 0; i < 1000000; i++ {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+	reader, _, _, _, err := openImportReader(req)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	particleID := int64(0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read alignment record: %w", err)
 		}
 
-		particle := &types.Particle{
-			ID:       int64(i),
-			X:        float32(i % 1000),
-			Y:        float32((i / 1000) % 1000),
-			Z:        float32(i / 1000000),
-			ColorR:   uint8((i * 37) % 256),
-			ColorG:   uint8((i * 73) % 256),
-			ColorB:   uint8((i * 137) % 256),
-			Size:     1.0,
-			Mass:     1.0,
-			Metadata: fmt.Sprintf("read_%d", i),
+		if record.IsUnmapped() || record.IsSecondary() || record.IsDuplicate() ||
+			record.Flag&alignment.FlagQCFail != 0 || int(record.MapQ) < req.QualityThreshold {
+			continue
 		}
 
-		particleChan <- particle
-	}
+		particle := ConvertReadToParticle(particleID, record.RefName, record.Pos,
+			record.Seq, int(record.MapQ), record.IsReverse())
+		particleID++
 
-	return nil
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case particleChan <- particle:
+		}
+	}
 }
 
 // ConvertReadToParticle converts a BAM read to a GenomeVedic particle
-// In production, this would take a *bam.Record parameter
 func ConvertReadToParticle(readID int64, chrom string, pos int64, seq string,
 	quality int, isReverse bool) *types.Particle {
 
@@ -425,21 +488,60 @@ func calculateVedicColor(sequence string) Color {
 	return colors[digitalRoot]
 }
 
-// ValidateBAMFile validates that a BAM file is properly formatted
-func ValidateBAMFile(bamPath string) error {
-	// In production, this would:
-	// 1. Check file exists
-	// 2. Verify BAM magic header
-	// 3. Check for BAI index file
-	// 4. Validate first few records
+// BAMValidation reports the outcome of ValidateBAMFile
+type BAMValidation struct {
+	Format       string                   `json:"format"` // "BAM" or "SAM"
+	References   int                      `json:"references"`
+	IndexPath    string                   `json:"index_path,omitempty"`
+	IndexFormat  alignment.BAMIndexFormat `json:"index_format,omitempty"`
+	IndexUsable  bool                     `json:"index_usable"`
+	IndexProblem string                   `json:"index_problem,omitempty"`
+}
 
-	// For now, basic check
+// ValidateBAMFile validates that a BAM (or SAM) file is properly formatted:
+// the file must exist, carry a valid header and decode at least its first record.
+// It also reports whether a BAI/CSI index is present and consistent with the header;
+// a missing or unusable index is not an error, since imports fall back to a full scan.
+func ValidateBAMFile(bamPath string) (*BAMValidation, error) {
 	if bamPath == "" {
-		return fmt.Errorf("BAM path is empty")
+		return nil, fmt.Errorf("BAM path is empty")
 	}
 
-	// Additional checks would go here
-	return nil
+	reader, err := alignment.Open(bamPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if _, err := reader.Read(); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid alignment record: %w", err)
+	}
+
+	result := &BAMValidation{
+		Format:     reader.Format(),
+		References: len(reader.Header().References),
+	}
+	if result.Format == "SAM" {
+		result.IndexProblem = "SAM files cannot be indexed"
+		return result, nil
+	}
+
+	result.IndexPath = alignment.FindBAMIndex(bamPath)
+	if result.IndexPath == "" {
+		result.IndexProblem = "no .bai or .csi index found"
+		return result, nil
+	}
+
+	idx, err := alignment.LoadBAMIndex(result.IndexPath)
+	if err != nil {
+		result.IndexProblem = err.Error()
+		return result, nil
+	}
+	result.IndexFormat = idx.Format
+	result.IndexProblem = alignment.CheckIndex(bamPath, idx, reader.Header())
+	result.IndexUsable = result.IndexProblem == ""
+
+	return result, nil
 }
 
 // EstimateProcessingTime estimates how long BAM import will take
@@ -0,0 +1,267 @@
+// Package interval provides a per-chromosome index of closed genomic
+// intervals supporting point, range and nearest-neighbour queries.
+//
+// Each chromosome is stored as an implicit augmented interval tree (the
+// cgranges layout): intervals sorted by start in a flat array, where the
+// array position determines the tree shape and each node records the
+// maximum end in its subtree. This costs one extra integer per interval and
+// no pointers, so whole-genome annotation sets stay compact.
+package interval
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// entry is one indexed interval. Ends are stored half-open internally.
+type entry[T any] struct {
+	start  uint64
+	end    uint64 // Exclusive
+	maxEnd uint64 // Largest end in this node's subtree
+	value  T
+}
+
+// chromTree is the implicit interval tree for one chromosome
+type chromTree[T any] struct {
+	entries   []entry[T]
+	rootLevel int
+	maxEnd    uint64
+}
+
+// Index maps chromosomes to interval trees. Add is not safe for concurrent
+// use; queries are safe once all intervals have been added.
+type Index[T any] struct {
+	trees map[string]*chromTree[T]
+	count int
+	dirty atomic.Bool
+	mu    sync.Mutex
+}
+
+// New creates an empty index
+func New[T any]() *Index[T] {
+	return &Index[T]{trees: make(map[string]*chromTree[T])}
+}
+
+// Add inserts the closed interval [start, end] on a chromosome
+func (ix *Index[T]) Add(chromosome string, start, end uint64, value T) {
+	if end < start {
+		start, end = end, start
+	}
+	tree, ok := ix.trees[chromosome]
+	if !ok {
+		tree = &chromTree[T]{}
+		ix.trees[chromosome] = tree
+	}
+	tree.entries = append(tree.entries, entry[T]{start: start, end: end + 1, value: value})
+	ix.count++
+	ix.dirty.Store(true)
+}
+
+// Len returns the number of indexed intervals
+func (ix *Index[T]) Len() int {
+	return ix.count
+}
+
+// Chromosomes returns the indexed chromosome names (unordered)
+func (ix *Index[T]) Chromosomes() []string {
+	names := make([]string, 0, len(ix.trees))
+	for name := range ix.trees {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Build sorts and augments the trees. Queries call it automatically after
+// Add, so explicit calls are only needed to control when the work happens.
+func (ix *Index[T]) Build() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.dirty.Load() {
+		return
+	}
+	for _, tree := range ix.trees {
+		tree.build()
+	}
+	ix.dirty.Store(false)
+}
+
+// tree returns the built tree for a chromosome, or nil
+func (ix *Index[T]) tree(chromosome string) *chromTree[T] {
+	if ix.dirty.Load() {
+		ix.Build()
+	}
+	return ix.trees[chromosome]
+}
+
+// At returns values whose intervals contain position, ordered by start
+func (ix *Index[T]) At(chromosome string, position uint64) []T {
+	return ix.Overlapping(chromosome, position, position)
+}
+
+// Overlapping returns values whose intervals overlap the closed range
+// [start, end], ordered by start
+func (ix *Index[T]) Overlapping(chromosome string, start, end uint64) []T {
+	var results []T
+	ix.Each(chromosome, start, end, func(value T) bool {
+		results = append(results, value)
+		return true
+	})
+	return results
+}
+
+// Each calls fn for every value overlapping [start, end] in start order,
+// stopping early when fn returns false
+func (ix *Index[T]) Each(chromosome string, start, end uint64, fn func(T) bool) {
+	tree := ix.tree(chromosome)
+	if tree == nil || end < start {
+		return
+	}
+	tree.overlap(start, end+1, func(e *entry[T]) bool { return fn(e.value) })
+}
+
+// Nearest returns the values closest to position among those accepted by
+// keep (nil accepts all). Overlapping intervals have distance zero; ties
+// are all returned. The second result is the distance in base pairs.
+func (ix *Index[T]) Nearest(chromosome string, position uint64, keep func(T) bool) ([]T, uint64, bool) {
+	tree := ix.tree(chromosome)
+	if tree == nil || len(tree.entries) == 0 {
+		return nil, 0, false
+	}
+
+	// Widen a window around position until it contains a match. Any
+	// interval closer than the best match found lies inside the window.
+	limit := max(tree.maxEnd, position+1)
+	for radius := uint64(1024); ; radius *= 2 {
+		lo := uint64(0)
+		if position > radius {
+			lo = position - radius
+		}
+		hi := position + radius + 1
+
+		var best []T
+		bestDistance := uint64(0)
+		tree.overlap(lo, hi, func(e *entry[T]) bool {
+			if keep != nil && !keep(e.value) {
+				return true
+			}
+			distance := uint64(0)
+			switch {
+			case position < e.start:
+				distance = e.start - position
+			case position >= e.end:
+				distance = position - (e.end - 1)
+			}
+			switch {
+			case best == nil || distance < bestDistance:
+				best, bestDistance = []T{e.value}, distance
+			case distance == bestDistance:
+				best = append(best, e.value)
+			}
+			return true
+		})
+
+		if best != nil && bestDistance <= radius {
+			return best, bestDistance, true
+		}
+		if lo == 0 && hi > limit {
+			return best, bestDistance, best != nil
+		}
+	}
+}
+
+// build sorts entries by start and computes subtree maximum ends
+func (t *chromTree[T]) build() {
+	entries := t.entries
+	sort.Slice(entries, func(i, j int) bool { return entries[i].start < entries[j].start })
+
+	n := len(entries)
+	t.rootLevel = 0
+	t.maxEnd = 0
+	if n == 0 {
+		return
+	}
+
+	// Leaves are the even positions
+	var lastIndex int
+	var last uint64
+	for i := 0; i < n; i += 2 {
+		lastIndex, last = i, entries[i].end
+		entries[i].maxEnd = entries[i].end
+	}
+
+	level := 1
+	for ; 1<<level <= n; level++ {
+		x := 1 << (level - 1)
+		first, step := (x<<1)-1, x<<2
+		for i := first; i < n; i += step {
+			// The right child may be past the end: use the last subtree's max
+			right := last
+			if i+x < n {
+				right = entries[i+x].maxEnd
+			}
+			entries[i].maxEnd = max(entries[i].end, entries[i-x].maxEnd, right)
+		}
+		if lastIndex>>level&1 != 0 {
+			lastIndex -= x
+		} else {
+			lastIndex += x
+		}
+		if lastIndex < n && entries[lastIndex].maxEnd > last {
+			last = entries[lastIndex].maxEnd
+		}
+	}
+	t.rootLevel = level - 1
+
+	for i := range entries {
+		t.maxEnd = max(t.maxEnd, entries[i].end)
+	}
+}
+
+// overlap visits entries overlapping the half-open range [start, end) in
+// start order
+func (t *chromTree[T]) overlap(start, end uint64, fn func(*entry[T]) bool) {
+	entries := t.entries
+	n := len(entries)
+	if n == 0 {
+		return
+	}
+
+	type frame struct {
+		x, level int
+		leftDone bool
+	}
+	stack := make([]frame, 0, 64)
+	stack = append(stack, frame{x: (1 << t.rootLevel) - 1, level: t.rootLevel})
+
+	for len(stack) > 0 {
+		z := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch {
+		case z.level <= 3:
+			// Small subtree: scan it linearly
+			i0 := z.x >> z.level << z.level
+			i1 := min(i0+(1<<(z.level+1))-1, n)
+			for i := i0; i < i1 && entries[i].start < end; i++ {
+				if start < entries[i].end && !fn(&entries[i]) {
+					return
+				}
+			}
+
+		case !z.leftDone:
+			// Revisit this node after its left subtree
+			stack = append(stack, frame{x: z.x, level: z.level, leftDone: true})
+			left := z.x - (1 << (z.level - 1))
+			if left >= n || entries[left].maxEnd > start {
+				stack = append(stack, frame{x: left, level: z.level - 1})
+			}
+
+		case z.x < n && entries[z.x].start < end:
+			if start < entries[z.x].end && !fn(&entries[z.x]) {
+				return
+			}
+			stack = append(stack, frame{x: z.x + (1 << (z.level - 1)), level: z.level - 1})
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package interval
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type testInterval struct {
+	id         int
+	start, end uint64
+}
+
+// TestOverlapMatchesBruteForce compares tree queries with a linear scan
+func TestOverlapMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, n := range []int{0, 1, 2, 3, 7, 8, 9, 100, 1000, 4097} {
+		ix := New[int]()
+		intervals := make([]testInterval, n)
+		for i := range intervals {
+			start := uint64(rng.Intn(1000000))
+			// Mostly short intervals with a few gene-sized ones
+			length := uint64(rng.Intn(500))
+			if rng.Intn(20) == 0 {
+				length = uint64(rng.Intn(200000))
+			}
+			intervals[i] = testInterval{i, start, start + length}
+			ix.Add("chr1", start, start+length, i)
+		}
+		ix.Add("chr2", 10, 20, -1)
+
+		for q := 0; q < 300; q++ {
+			start := uint64(rng.Intn(1100000))
+			end := start + uint64(rng.Intn(5000))
+			if q%3 == 0 {
+				end = start
+			}
+
+			var want []int
+			for _, iv := range intervals {
+				if iv.start <= end && iv.end >= start {
+					want = append(want, iv.id)
+				}
+			}
+			got := ix.Overlapping("chr1", start, end)
+
+			sort.Ints(want)
+			sorted := append([]int(nil), got...)
+			sort.Ints(sorted)
+			if len(sorted) != len(want) {
+				t.Fatalf("n=%d [%d,%d]: got %d intervals, want %d", n, start, end, len(sorted), len(want))
+			}
+			for i := range want {
+				if sorted[i] != want[i] {
+					t.Fatalf("n=%d [%d,%d]: got %v, want %v", n, start, end, sorted, want)
+				}
+			}
+			for i := 1; i < len(got); i++ {
+				if intervals[got[i]].start < intervals[got[i-1]].start {
+					t.Fatalf("n=%d: results not ordered by start", n)
+				}
+			}
+		}
+	}
+}
+
+// TestNearest tests nearest-interval queries with and without a filter
+func TestNearest(t *testing.T) {
+	ix := New[string]()
+	ix.Add("chr1", 100, 200, "a")
+	ix.Add("chr1", 5000, 6000, "b")
+	ix.Add("chr1", 5500, 5600, "c")
+	ix.Add("chr1", 9000000, 9000100, "far")
+
+	tests := []struct {
+		position uint64
+		keep     func(string) bool
+		want     []string
+		distance uint64
+	}{
+		{150, nil, []string{"a"}, 0},
+		{300, nil, []string{"a"}, 100},
+		{4000, nil, []string{"b"}, 1000},
+		{5550, nil, []string{"b", "c"}, 0},
+		{5550, func(s string) bool { return s != "b" && s != "c" }, []string{"a"}, 5350},
+		{8000000, nil, []string{"far"}, 1000000},
+		{0, func(s string) bool { return s == "far" }, []string{"far"}, 9000000},
+	}
+
+	for _, tt := range tests {
+		got, distance, ok := ix.Nearest("chr1", tt.position, tt.keep)
+		if !ok || distance != tt.distance || len(got) != len(tt.want) {
+			t.Errorf("Nearest(%d) = %v, %d, %v; want %v, %d", tt.position, got, distance, ok, tt.want, tt.distance)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Nearest(%d) = %v, want %v", tt.position, got, tt.want)
+			}
+		}
+	}
+
+	if _, _, ok := ix.Nearest("chr2", 10, nil); ok {
+		t.Error("Expected no result on an empty chromosome")
+	}
+	if _, _, ok := ix.Nearest("chr1", 10, func(string) bool { return false }); ok {
+		t.Error("Expected no result when the filter rejects everything")
+	}
+}
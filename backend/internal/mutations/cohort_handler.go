@@ -0,0 +1,355 @@
+/**
+ * Cohort HTTP Handler
+ *
+ * Exposes CohortStore queries and cohort hotspot detection:
+ *
+ * GET  /api/v1/cohort/stats
+ * GET  /api/v1/cohort/burden?territory_mb=30
+ * GET  /api/v1/cohort/sample?name=TCGA-01
+ * POST /api/v1/cohort/query          {"all": ["KRAS G12D", "TP53 R175H"], "any": [...]}
+ * POST /api/v1/cohort/cooccurrence   {"a": "KRAS", "b": "BRAF"} or {"selectors": [...]}
+ * GET  /api/v1/cohort/hotspots?window=100&min_mutations=3&min_samples=5&background=true&fdr=0.05
+ */
+
+package mutations
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"genomevedic/internal/annotations"
+)
+
+// CohortHandler handles HTTP requests for cohort queries
+type CohortHandler struct {
+	store *CohortStore
+	genes *annotations.GTFParser // Per-gene hotspot background, optional
+}
+
+// CohortQueryRequest selects samples by carried variants
+type CohortQueryRequest struct {
+	All []string `json:"all"` // Samples must carry every selector
+	Any []string `json:"any"` // ...and at least one of these
+}
+
+// CoOccurrenceRequest asks for one pair (A, B) or all pairs of Selectors
+type CoOccurrenceRequest struct {
+	A         string   `json:"a"`
+	B         string   `json:"b"`
+	Selectors []string `json:"selectors"`
+}
+
+// NewCohortHandler creates a cohort handler over a store
+func NewCohortHandler(store *CohortStore) *CohortHandler {
+	return &CohortHandler{store: store}
+}
+
+// SetAnnotations enables per-gene background rates for hotspot requests
+func (h *CohortHandler) SetAnnotations(genes *annotations.GTFParser) {
+	h.genes = genes
+}
+
+// HandleStats handles GET /api/v1/cohort/stats
+func (h *CohortHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"stats":   h.store.GetStatistics(),
+	})
+}
+
+// HandleBurden handles GET /api/v1/cohort/burden
+func (h *CohortHandler) HandleBurden(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	territory := 0.0
+	if value := r.URL.Query().Get("territory_mb"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			h.sendError(w, http.StatusBadRequest, "invalid territory_mb")
+			return
+		}
+		territory = parsed
+	}
+
+	burdens := h.store.Burden(territory)
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"count":   len(burdens),
+		"burden":  burdens,
+	})
+}
+
+// HandleSample handles GET /api/v1/cohort/sample
+func (h *CohortHandler) HandleSample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		h.sendError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	variants, err := h.store.SampleVariants(name)
+	if err != nil {
+		h.sendError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"sample":   name,
+		"count":    len(variants),
+		"variants": variantsJSON(variants),
+	})
+}
+
+// HandleQuery handles POST /api/v1/cohort/query
+func (h *CohortHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req CohortQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.All) == 0 && len(req.Any) == 0 {
+		h.sendError(w, http.StatusBadRequest, "at least one variant selector required")
+		return
+	}
+
+	var samples []string
+	if len(req.All) > 0 {
+		all, err := h.store.SamplesWithAll(req.All...)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		samples = all
+	}
+	if len(req.Any) > 0 {
+		anyOf, err := h.store.SamplesWithAny(req.Any...)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(req.All) == 0 {
+			samples = anyOf
+		} else {
+			samples = intersectSorted(samples, anyOf)
+		}
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"samples":       samples,
+		"count":         len(samples),
+		"cohort_size":   len(h.store.Samples()),
+		"selectors_all": req.All,
+		"selectors_any": req.Any,
+	})
+}
+
+// HandleCoOccurrence handles POST /api/v1/cohort/cooccurrence
+func (h *CohortHandler) HandleCoOccurrence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req CoOccurrenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var pairs [][2]string
+	switch {
+	case len(req.Selectors) >= 2:
+		for i := range req.Selectors {
+			for j := i + 1; j < len(req.Selectors); j++ {
+				pairs = append(pairs, [2]string{req.Selectors[i], req.Selectors[j]})
+			}
+		}
+	case req.A != "" && req.B != "":
+		pairs = append(pairs, [2]string{req.A, req.B})
+	default:
+		h.sendError(w, http.StatusBadRequest, "a and b, or at least two selectors, are required")
+		return
+	}
+
+	tests := make([]*PairTest, 0, len(pairs))
+	for _, pair := range pairs {
+		test, err := h.store.CoOccurrence(pair[0], pair[1])
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		tests = append(tests, test)
+	}
+
+	// Benjamini-Hochberg across pairs, per direction
+	coP := make([]float64, len(tests))
+	exP := make([]float64, len(tests))
+	for i, test := range tests {
+		coP[i], exP[i] = test.CoOccurrenceP, test.ExclusivityP
+	}
+	coQ, exQ := benjaminiHochberg(coP), benjaminiHochberg(exP)
+	results := make([]map[string]interface{}, len(tests))
+	for i, test := range tests {
+		results[i] = map[string]interface{}{
+			"test":           test,
+			"cooccurrence_q": coQ[i],
+			"exclusivity_q":  exQ[i],
+		}
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"count":       len(results),
+		"results":     results,
+		"cohort_size": len(h.store.Samples()),
+	})
+}
+
+// HandleHotspots handles GET /api/v1/cohort/hotspots
+func (h *CohortHandler) HandleHotspots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	intParam := func(name string, fallback int) (int, bool) {
+		value := query.Get(name)
+		if value == "" {
+			return fallback, true
+		}
+		parsed, err := strconv.Atoi(value)
+		return parsed, err == nil && parsed >= 0
+	}
+	window, ok1 := intParam("window", 100)
+	minMutations, ok2 := intParam("min_mutations", 3)
+	minSamples, ok3 := intParam("min_samples", 3)
+	limit, ok4 := intParam("limit", 50)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		h.sendError(w, http.StatusBadRequest, "invalid numeric parameter")
+		return
+	}
+
+	detector := NewHotspotDetector(h.store.Parser(minSamples), uint64(window), minMutations, minSamples)
+	detector.SetCohort(h.store)
+	if background, _ := strconv.ParseBool(query.Get("background")); background {
+		fdr, _ := strconv.ParseFloat(query.Get("fdr"), 64)
+		detector.SetBackgroundModel(h.genes, 0, fdr)
+	}
+
+	hotspots, err := detector.DetectHotspots()
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	hotspots = detector.GetTopHotspots(hotspots, limit)
+
+	results := make([]map[string]interface{}, len(hotspots))
+	for i, hs := range hotspots {
+		result := map[string]interface{}{
+			"chromosome":     hs.Chromosome,
+			"start":          hs.StartPosition,
+			"end":            hs.EndPosition,
+			"gene":           hs.PrimaryGene,
+			"mutations":      hs.MutationCount,
+			"samples":        hs.TotalSamples,
+			"sample_names":   hs.Samples,
+			"significance":   hs.SignificanceScore,
+			"clinical_score": hs.ClinicalScore,
+		}
+		if hs.Background != "" {
+			result["p_value"] = hs.PValue
+			result["q_value"] = hs.QValue
+			result["expected_events"] = hs.ExpectedEvents
+			result["background"] = hs.Background
+		}
+		results[i] = result
+	}
+
+	h.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"count":      len(results),
+		"hotspots":   results,
+		"statistics": detector.GetStatistics(hotspots),
+	})
+}
+
+// variantsJSON converts mutations to response objects
+func variantsJSON(variants []*Mutation) []map[string]interface{} {
+	results := make([]map[string]interface{}, len(variants))
+	for i, v := range variants {
+		results[i] = map[string]interface{}{
+			"chromosome":   v.Chromosome,
+			"position":     v.Position,
+			"ref":          v.RefAllele,
+			"alt":          v.AltAllele,
+			"gene":         v.Gene,
+			"type":         v.MutationType.String(),
+			"significance": v.Significance.String(),
+			"hgvsc":        v.HGVSc,
+			"hgvsp":        v.HGVSp,
+			"samples":      v.SampleCount,
+		}
+	}
+	return results
+}
+
+// intersectSorted intersects two sample lists, keeping the order of a
+func intersectSorted(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+	}
+	result := make([]string, 0, len(a))
+	for _, s := range a {
+		if inB[s] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// sendJSON sends a JSON response
+func (h *CohortHandler) sendJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+// sendError sends an error response
+func (h *CohortHandler) sendError(w http.ResponseWriter, statusCode int, message string) {
+	h.sendJSON(w, statusCode, map[string]interface{}{
+		"success": false,
+		"error":   message,
+	})
+}
+
+// RegisterRoutes registers cohort routes with a mux
+func (h *CohortHandler) RegisterRoutes(mux *http.ServeMux, corsMiddleware func(http.HandlerFunc) http.HandlerFunc) {
+	mux.HandleFunc("/api/v1/cohort/stats", corsMiddleware(h.HandleStats))
+	mux.HandleFunc("/api/v1/cohort/burden", corsMiddleware(h.HandleBurden))
+	mux.HandleFunc("/api/v1/cohort/sample", corsMiddleware(h.HandleSample))
+	mux.HandleFunc("/api/v1/cohort/query", corsMiddleware(h.HandleQuery))
+	mux.HandleFunc("/api/v1/cohort/cooccurrence", corsMiddleware(h.HandleCoOccurrence))
+	mux.HandleFunc("/api/v1/cohort/hotspots", corsMiddleware(h.HandleHotspots))
+}
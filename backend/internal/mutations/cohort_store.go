@@ -0,0 +1,977 @@
+/**
+ * Cohort Store
+ *
+ * Tracks which samples carry which variants across a cohort of per-sample
+ * (or multi-sample) VCFs. The sample × variant matrix is kept sparse: each
+ * variant stores the sorted IDs of its carrier samples and their allele
+ * fractions. The store persists to a single binary file.
+ *
+ * Queries:
+ * - Samples carrying all/any of a set of variants ("KRAS G12D", "TP53 R175H")
+ * - Co-occurrence / mutual exclusivity (Fisher's exact test)
+ * - Per-sample mutation burden
+ *
+ * Variant selectors:
+ * - Genomic: "12:25245350:C>T", "chr12:25245350 C>T", "chr12-25245350-C-T"
+ * - Protein: "KRAS G12D", "KRAS p.Gly12Asp", "KRAS:p.G12D"
+ * - Coding:  "KRAS c.35G>A"
+ * - Gene:    "TP53" (any variant in the gene)
+ */
+
+package mutations
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const cohortMagic = "GVCOHRT1"
+
+// CohortStore is a persisted sample × variant matrix
+type CohortStore struct {
+	path         string
+	samples      []string
+	sampleIndex  map[string]uint32
+	variants     []*Mutation    // SampleCount is the number of carriers
+	variantIndex map[string]int // Key: "chrom:pos:ref>alt"
+	carriers     [][]uint32     // Per variant: sorted sample IDs
+	fractions    [][]float32    // Per variant: allele fraction per carrier (NaN if unknown)
+	annotator    *ConsequenceAnnotator
+	mu           sync.RWMutex
+
+	annotationFailures int    // Ingested variants the annotator rejected
+	annotationError    string // First annotation failure
+}
+
+// PairTest is the result of a co-occurrence / mutual exclusivity test
+type PairTest struct {
+	A             string  `json:"a"`
+	B             string  `json:"b"`
+	Both          int     `json:"both"`            // Samples carrying A and B
+	OnlyA         int     `json:"only_a"`          // Samples carrying A but not B
+	OnlyB         int     `json:"only_b"`          // Samples carrying B but not A
+	Neither       int     `json:"neither"`         // Samples carrying neither
+	LogOddsRatio  float64 `json:"log2_odds_ratio"` // Haldane-corrected; > 0 co-occurring
+	CoOccurrenceP float64 `json:"cooccurrence_p"`  // One-sided Fisher p-value for co-occurrence
+	ExclusivityP  float64 `json:"exclusivity_p"`   // One-sided Fisher p-value for mutual exclusivity
+	Tendency      string  `json:"tendency"`        // "co-occurrence", "mutual exclusivity" or "none"
+}
+
+// SampleBurden is the mutation burden of one sample
+type SampleBurden struct {
+	Sample         string  `json:"sample"`
+	Variants       int     `json:"variants"`         // All variants carried
+	CodingNonSyn   int     `json:"coding_nonsyn"`    // Missense, nonsense, frameshift, splice, inframe, stop/start lost
+	MutationsPerMb float64 `json:"mutations_per_mb"` // Variants per Mb of territory (0 when no territory given)
+}
+
+// NewCohortStore creates an empty, unpersisted cohort store
+func NewCohortStore() *CohortStore {
+	return &CohortStore{
+		sampleIndex:  make(map[string]uint32),
+		variantIndex: make(map[string]int),
+	}
+}
+
+// OpenCohortStore loads the store at path, or creates an empty store that
+// Save will write to path if the file does not exist yet
+func OpenCohortStore(path string) (*CohortStore, error) {
+	cs := NewCohortStore()
+	cs.path = path
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cohort store: %w", err)
+	}
+	defer f.Close()
+
+	if err := cs.readFrom(bufio.NewReaderSize(f, 1<<20)); err != nil {
+		return nil, fmt.Errorf("failed to read cohort store %s: %w", path, err)
+	}
+	return cs, nil
+}
+
+// SetAnnotator predicts consequences and HGVS notation for ingested
+// variants that arrive without them, so protein selectors can match
+func (cs *CohortStore) SetAnnotator(annotator *ConsequenceAnnotator) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.annotator = annotator
+}
+
+// IngestVCFFile adds the PASS calls of a (optionally bgzipped) VCF. Samples
+// come from the header; a sites-only VCF is one sample named after the file.
+func (cs *CohortStore) IngestVCFFile(path string) (int, error) {
+	vr, err := OpenVCF(path)
+	if err != nil {
+		return 0, err
+	}
+	defer vr.Close()
+
+	name := filepath.Base(path)
+	for _, suffix := range []string{".gz", ".bgz", ".vcf"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return cs.IngestVCF(vr, name)
+}
+
+// cohortBatchRecords is the number of VCF records read (and annotated)
+// between write-lock acquisitions while ingesting
+const cohortBatchRecords = 4096
+
+// cohortSite is one ALT allele of a VCF record and the samples carrying it
+type cohortSite struct {
+	mutation  *Mutation
+	samples   []uint32
+	fractions []float32
+}
+
+// IngestVCF adds the PASS calls of an open VCF and returns the number of
+// sample-variant calls added. sampleName names the sample of a sites-only
+// VCF. Re-ingesting a sample adds its calls idempotently. Records are read
+// and annotated in batches, so queries are only blocked while a batch is
+// added.
+func (cs *CohortStore) IngestVCF(vr *VCFReader, sampleName string) (int, error) {
+	header := vr.Header()
+	sitesOnly := len(header.Samples) == 0
+	if sitesOnly && sampleName == "" {
+		return 0, fmt.Errorf("sites-only VCF requires a sample name")
+	}
+
+	cs.mu.Lock()
+	annotator := cs.annotator
+	sampleIDs := make([]uint32, 0, len(header.Samples))
+	for _, name := range header.Samples {
+		sampleIDs = append(sampleIDs, cs.addSample(name))
+	}
+	if sitesOnly {
+		sampleIDs = append(sampleIDs, cs.addSample(sampleName))
+	}
+	cs.mu.Unlock()
+
+	added, records := 0, 0
+	var batch []cohortSite
+	for {
+		record, err := vr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			added += cs.addBatch(batch, annotator)
+			return added, fmt.Errorf("failed to read VCF record: %w", err)
+		}
+		if !record.Passed() {
+			continue
+		}
+
+		mutations := record.Mutations()
+		altIndexes := make([]int, 0, len(mutations))
+		for i, alt := range record.Alts {
+			alt = strings.ToUpper(alt)
+			if alt != "*" && alt != "<*>" && alt != "<NON_REF>" {
+				altIndexes = append(altIndexes, i)
+			}
+		}
+
+		for m, mutation := range mutations {
+			altIndex := altIndexes[m]
+			site := cohortSite{mutation: mutation}
+
+			if sitesOnly {
+				fraction := float32(math.NaN())
+				if af, err := strconv.ParseFloat(record.AltInfo("AF", altIndex), 64); err == nil {
+					fraction = float32(af)
+				}
+				site.samples = append(site.samples, sampleIDs[0])
+				site.fractions = append(site.fractions, fraction)
+				batch = append(batch, site)
+				continue
+			}
+
+			for s := range record.Genotypes {
+				if s >= len(sampleIDs) || !record.Genotypes[s].Carries(altIndex+1) {
+					continue
+				}
+				fraction := float32(math.NaN())
+				if af, ok := record.AlleleFraction(s, altIndex); ok {
+					fraction = float32(af)
+				}
+				site.samples = append(site.samples, sampleIDs[s])
+				site.fractions = append(site.fractions, fraction)
+			}
+			batch = append(batch, site)
+		}
+
+		if records++; records%cohortBatchRecords == 0 {
+			added += cs.addBatch(batch, annotator)
+			batch = batch[:0]
+		}
+	}
+
+	added += cs.addBatch(batch, annotator)
+	return added, nil
+}
+
+// addBatch annotates the batch's new variants without holding the lock,
+// then adds its calls under the write lock. Annotation failures are
+// counted in the statistics; the variant is kept without annotation.
+func (cs *CohortStore) addBatch(batch []cohortSite, annotator *ConsequenceAnnotator) int {
+	if len(batch) == 0 {
+		return 0
+	}
+
+	failures := 0
+	var firstErr error
+	if annotator != nil {
+		var pending []*Mutation
+		cs.mu.RLock()
+		for _, site := range batch {
+			m := site.mutation
+			if m.MutationType != MutationUnknown && m.HGVSp != "" || IsSymbolicAllele(m.AltAllele) {
+				continue
+			}
+			if _, known := cs.variantIndex[variantKey(m)]; !known {
+				pending = append(pending, m)
+			}
+		}
+		cs.mu.RUnlock()
+
+		for _, m := range pending {
+			if _, err := annotator.Annotate(m); err != nil {
+				failures++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to annotate %s:%d: %w", m.Chromosome, m.Position, err)
+				}
+			}
+		}
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.annotationFailures += failures
+	if firstErr != nil && cs.annotationError == "" {
+		cs.annotationError = firstErr.Error()
+	}
+
+	added := 0
+	for _, site := range batch {
+		variant := cs.addVariant(site.mutation)
+		for i, sample := range site.samples {
+			if cs.addCall(variant, sample, site.fractions[i]) {
+				added++
+			}
+		}
+	}
+	return added
+}
+
+// addSample returns the ID of a sample, registering it if new
+func (cs *CohortStore) addSample(name string) uint32 {
+	if id, ok := cs.sampleIndex[name]; ok {
+		return id
+	}
+	id := uint32(len(cs.samples))
+	cs.samples = append(cs.samples, name)
+	cs.sampleIndex[name] = id
+	return id
+}
+
+// variantKey identifies a variant independently of "chr" prefixes
+func variantKey(m *Mutation) string {
+	return fmt.Sprintf("%s:%d:%s>%s", strings.TrimPrefix(m.Chromosome, "chr"), m.Position,
+		strings.ToUpper(m.RefAllele), strings.ToUpper(m.AltAllele))
+}
+
+// addVariant returns the index of a variant, registering it if new
+func (cs *CohortStore) addVariant(m *Mutation) int {
+	key := variantKey(m)
+	if i, ok := cs.variantIndex[key]; ok {
+		existing := cs.variants[i]
+		// Keep the first annotation seen, fill gaps from later files
+		if existing.Gene == "" {
+			existing.Gene = m.Gene
+		}
+		if existing.MutationType == MutationUnknown {
+			existing.MutationType = m.MutationType
+		}
+		if existing.HGVSc == "" {
+			existing.HGVSc = m.HGVSc
+		}
+		if existing.HGVSp == "" {
+			existing.HGVSp = m.HGVSp
+		}
+		if existing.Significance == SignificanceUnknown {
+			existing.Significance = m.Significance
+		}
+		return i
+	}
+
+	variant := *m
+	variant.SampleCount = 0
+	variant.Frequency = 0
+
+	i := len(cs.variants)
+	cs.variants = append(cs.variants, &variant)
+	cs.variantIndex[key] = i
+	cs.carriers = append(cs.carriers, nil)
+	cs.fractions = append(cs.fractions, nil)
+	return i
+}
+
+// addCall records that a sample carries a variant; false if already known
+func (cs *CohortStore) addCall(variant int, sample uint32, fraction float32) bool {
+	carriers := cs.carriers[variant]
+	pos := sort.Search(len(carriers), func(i int) bool { return carriers[i] >= sample })
+	if pos < len(carriers) && carriers[pos] == sample {
+		return false
+	}
+
+	cs.carriers[variant] = append(carriers, 0)
+	copy(cs.carriers[variant][pos+1:], cs.carriers[variant][pos:])
+	cs.carriers[variant][pos] = sample
+
+	fractions := append(cs.fractions[variant], 0)
+	copy(fractions[pos+1:], fractions[pos:])
+	fractions[pos] = fraction
+	cs.fractions[variant] = fractions
+
+	cs.variants[variant].SampleCount = len(cs.carriers[variant])
+	return true
+}
+
+// Samples returns the sample names in ingestion order
+func (cs *CohortStore) Samples() []string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return append([]string(nil), cs.samples...)
+}
+
+// Variants returns every variant; SampleCount is the number of carriers and
+// Frequency the carrier fraction of the cohort
+func (cs *CohortStore) Variants() []*Mutation {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	variants := make([]*Mutation, len(cs.variants))
+	for i, v := range cs.variants {
+		variant := *v
+		if len(cs.samples) > 0 {
+			variant.Frequency = float64(variant.SampleCount) / float64(len(cs.samples))
+		}
+		variants[i] = &variant
+	}
+	return variants
+}
+
+// Parser returns a COSMICParser over the cohort's variants, for use with
+// HotspotDetector and MutationOverlay
+func (cs *CohortStore) Parser(hotspotThreshold int) *COSMICParser {
+	parser := NewCOSMICParser(hotspotThreshold)
+	for _, variant := range cs.Variants() {
+		parser.addMutation(variant)
+	}
+	parser.identifyHotspots()
+	return parser
+}
+
+// CarriersOf returns the samples carrying a variant, with allele fractions
+// (NaN when unknown)
+func (cs *CohortStore) CarriersOf(m *Mutation) ([]string, []float64) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	i, ok := cs.variantIndex[variantKey(m)]
+	if !ok {
+		return nil, nil
+	}
+	names := make([]string, len(cs.carriers[i]))
+	fractions := make([]float64, len(cs.carriers[i]))
+	for j, id := range cs.carriers[i] {
+		names[j] = cs.samples[id]
+		fractions[j] = float64(cs.fractions[i][j])
+	}
+	return names, fractions
+}
+
+// FindVariants returns the variants matching a selector
+func (cs *CohortStore) FindVariants(selector string) ([]*Mutation, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	indexes, err := cs.match(selector)
+	if err != nil {
+		return nil, err
+	}
+	variants := make([]*Mutation, len(indexes))
+	for i, index := range indexes {
+		variant := *cs.variants[index]
+		variants[i] = &variant
+	}
+	return variants, nil
+}
+
+// SamplesWithAll returns samples carrying every selector (each selector is
+// satisfied by any of the variants it matches)
+func (cs *CohortStore) SamplesWithAll(selectors ...string) ([]string, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	var result map[uint32]bool
+	for _, selector := range selectors {
+		carriers, err := cs.carrierSet(selector)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = carriers
+			continue
+		}
+		for id := range result {
+			if !carriers[id] {
+				delete(result, id)
+			}
+		}
+	}
+	return cs.sampleNames(result), nil
+}
+
+// SamplesWithAny returns samples carrying at least one selector
+func (cs *CohortStore) SamplesWithAny(selectors ...string) ([]string, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	result := make(map[uint32]bool)
+	for _, selector := range selectors {
+		carriers, err := cs.carrierSet(selector)
+		if err != nil {
+			return nil, err
+		}
+		for id := range carriers {
+			result[id] = true
+		}
+	}
+	return cs.sampleNames(result), nil
+}
+
+// CoOccurrence tests whether two selectors co-occur or are mutually
+// exclusive across the cohort's samples
+func (cs *CohortStore) CoOccurrence(a, b string) (*PairTest, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	carriersA, err := cs.carrierSet(a)
+	if err != nil {
+		return nil, err
+	}
+	carriersB, err := cs.carrierSet(b)
+	if err != nil {
+		return nil, err
+	}
+
+	test := &PairTest{A: a, B: b}
+	for id := range carriersA {
+		if carriersB[id] {
+			test.Both++
+		} else {
+			test.OnlyA++
+		}
+	}
+	test.OnlyB = len(carriersB) - test.Both
+	test.Neither = len(cs.samples) - test.Both - test.OnlyA - test.OnlyB
+
+	test.LogOddsRatio = math.Log2(
+		(float64(test.Both) + 0.5) * (float64(test.Neither) + 0.5) /
+			((float64(test.OnlyA) + 0.5) * (float64(test.OnlyB) + 0.5)))
+	test.CoOccurrenceP, test.ExclusivityP = fisherExact(test.Both, test.OnlyA, test.OnlyB, test.Neither)
+
+	switch {
+	case test.CoOccurrenceP < 0.05 && test.LogOddsRatio > 0:
+		test.Tendency = "co-occurrence"
+	case test.ExclusivityP < 0.05 && test.LogOddsRatio < 0:
+		test.Tendency = "mutual exclusivity"
+	default:
+		test.Tendency = "none"
+	}
+	return test, nil
+}
+
+// Burden returns the mutation burden of every sample. territoryMb is the
+// callable territory in megabases (e.g. ~30 for an exome); 0 skips the
+// per-Mb rate.
+func (cs *CohortStore) Burden(territoryMb float64) []SampleBurden {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	burdens := make([]SampleBurden, len(cs.samples))
+	for i, name := range cs.samples {
+		burdens[i].Sample = name
+	}
+	for v, carriers := range cs.carriers {
+		coding := isNonSynonymous(cs.variants[v].MutationType)
+		for _, id := range carriers {
+			burdens[id].Variants++
+			if coding {
+				burdens[id].CodingNonSyn++
+			}
+		}
+	}
+	if territoryMb > 0 {
+		for i := range burdens {
+			burdens[i].MutationsPerMb = float64(burdens[i].Variants) / territoryMb
+		}
+	}
+	return burdens
+}
+
+// SampleVariants returns the variants carried by a sample
+func (cs *CohortStore) SampleVariants(sample string) ([]*Mutation, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	id, ok := cs.sampleIndex[sample]
+	if !ok {
+		return nil, fmt.Errorf("unknown sample: %s", sample)
+	}
+	var variants []*Mutation
+	for v, carriers := range cs.carriers {
+		pos := sort.Search(len(carriers), func(i int) bool { return carriers[i] >= id })
+		if pos < len(carriers) && carriers[pos] == id {
+			variant := *cs.variants[v]
+			variants = append(variants, &variant)
+		}
+	}
+	return variants, nil
+}
+
+// GetStatistics returns cohort statistics
+func (cs *CohortStore) GetStatistics() map[string]interface{} {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	calls := 0
+	for _, carriers := range cs.carriers {
+		calls += len(carriers)
+	}
+	density := 0.0
+	if len(cs.samples) > 0 && len(cs.variants) > 0 {
+		density = float64(calls) / (float64(len(cs.samples)) * float64(len(cs.variants)))
+	}
+
+	stats := map[string]interface{}{
+		"samples":        len(cs.samples),
+		"variants":       len(cs.variants),
+		"calls":          calls,
+		"matrix_density": density,
+		"path":           cs.path,
+	}
+	if cs.annotationFailures > 0 {
+		stats["annotation_failures"] = cs.annotationFailures
+		stats["annotation_error"] = cs.annotationError
+	}
+	return stats
+}
+
+// isNonSynonymous reports whether a mutation type alters the protein
+func isNonSynonymous(mt MutationType) bool {
+	switch mt {
+	case MutationMissense, MutationNonsense, MutationFrameshift, MutationSplice, MutationInframe,
+		MutationStopLost, MutationStartLost:
+		return true
+	}
+	return false
+}
+
+// carrierSet returns the IDs of samples carrying any variant matching a selector
+func (cs *CohortStore) carrierSet(selector string) (map[uint32]bool, error) {
+	indexes, err := cs.match(selector)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[uint32]bool)
+	for _, i := range indexes {
+		for _, id := range cs.carriers[i] {
+			set[id] = true
+		}
+	}
+	return set, nil
+}
+
+// sampleNames converts a sample ID set to names in ingestion order
+func (cs *CohortStore) sampleNames(set map[uint32]bool) []string {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = cs.samples[id]
+	}
+	return names
+}
+
+// match returns the indexes of variants matching a selector
+func (cs *CohortStore) match(selector string) ([]int, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return nil, fmt.Errorf("empty variant selector")
+	}
+
+	// Genomic: chrom:pos:ref>alt, chrom:pos ref>alt, chrom-pos-ref-alt
+	if m, ok := parseGenomicSelector(selector); ok {
+		if i, found := cs.variantIndex[variantKey(m)]; found {
+			return []int{i}, nil
+		}
+		return nil, nil
+	}
+
+	gene, change := selector, ""
+	if i := strings.IndexAny(selector, " :\t"); i >= 0 {
+		gene, change = selector[:i], strings.TrimSpace(selector[i+1:])
+	}
+
+	var indexes []int
+	for i, variant := range cs.variants {
+		if !strings.EqualFold(variant.Gene, gene) {
+			continue
+		}
+		switch {
+		case change == "":
+			indexes = append(indexes, i)
+		case strings.HasPrefix(change, "c."):
+			if hgvsChange(variant.HGVSc) == change {
+				indexes = append(indexes, i)
+			}
+		default:
+			if variant.HGVSp != "" && ShortProteinChange(variant.HGVSp) == ShortProteinChange(change) {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// parseGenomicSelector parses chrom:pos:ref>alt style selectors
+func parseGenomicSelector(selector string) (*Mutation, bool) {
+	fields := strings.FieldsFunc(selector, func(r rune) bool {
+		return r == ':' || r == '-' || r == '>' || r == ' ' || r == '\t'
+	})
+	if len(fields) != 4 {
+		return nil, false
+	}
+	position, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	for _, allele := range fields[2:] {
+		if strings.Trim(strings.ToUpper(allele), "ACGTN") != "" {
+			return nil, false
+		}
+	}
+	trimmedPos, ref, alt := TrimAlleles(position, strings.ToUpper(fields[2]), strings.ToUpper(fields[3]))
+	return &Mutation{Chromosome: fields[0], Position: trimmedPos, RefAllele: ref, AltAllele: alt}, true
+}
+
+// hgvsChange strips the reference sequence prefix from an HGVS string
+func hgvsChange(hgvs string) string {
+	if i := strings.LastIndex(hgvs, ":"); i >= 0 {
+		return hgvs[i+1:]
+	}
+	return hgvs
+}
+
+// ShortProteinChange normalises a protein change to one-letter codes
+// without the "p." prefix or parentheses: "p.(Gly12Asp)" -> "G12D"
+func ShortProteinChange(change string) string {
+	change = strings.TrimPrefix(hgvsChange(change), "p.")
+	change = strings.Trim(change, "()")
+
+	var sb strings.Builder
+	for i := 0; i < len(change); {
+		if i+3 <= len(change) {
+			if code, ok := aminoAcidCodes[change[i:i+3]]; ok {
+				sb.WriteByte(code)
+				i += 3
+				continue
+			}
+		}
+		c := change[i]
+		if c == 'X' {
+			c = '*'
+		}
+		sb.WriteByte(c)
+		i++
+	}
+	return sb.String()
+}
+
+// aminoAcidCodes maps HGVS three-letter codes to one-letter codes
+var aminoAcidCodes = func() map[string]byte {
+	codes := make(map[string]byte, len(aminoAcidNames))
+	for code, name := range aminoAcidNames {
+		codes[name] = code
+	}
+	return codes
+}()
+
+// fisherExact returns the one-sided Fisher exact p-values P(X >= a) and
+// P(X <= a) for the 2×2 table [[a, b], [c, d]]
+func fisherExact(a, b, c, d int) (float64, float64) {
+	row1, col1, n := a+b, a+c, a+b+c+d
+	lo, hi := max(0, col1-(n-row1)), min(row1, col1)
+
+	logChoose := func(n, k int) float64 {
+		ln, _ := math.Lgamma(float64(n + 1))
+		lk, _ := math.Lgamma(float64(k + 1))
+		lnk, _ := math.Lgamma(float64(n - k + 1))
+		return ln - lk - lnk
+	}
+	denominator := logChoose(n, col1)
+	probability := func(x int) float64 {
+		return math.Exp(logChoose(row1, x) + logChoose(n-row1, col1-x) - denominator)
+	}
+
+	greater, less := 0.0, 0.0
+	for x := lo; x <= hi; x++ {
+		p := probability(x)
+		if x >= a {
+			greater += p
+		}
+		if x <= a {
+			less += p
+		}
+	}
+	return math.Min(greater, 1), math.Min(less, 1)
+}
+
+// Save writes the store to the path it was opened from
+func (cs *CohortStore) Save() error {
+	cs.mu.RLock()
+	path := cs.path
+	cs.mu.RUnlock()
+	if path == "" {
+		return fmt.Errorf("cohort store has no path")
+	}
+	return cs.writeFile(path)
+}
+
+// SaveTo writes the store to path, replacing any existing file atomically.
+// Later Save calls write to path.
+func (cs *CohortStore) SaveTo(path string) error {
+	if err := cs.writeFile(path); err != nil {
+		return err
+	}
+	cs.mu.Lock()
+	cs.path = path
+	cs.mu.Unlock()
+	return nil
+}
+
+// writeFile serializes the store to a temporary file and renames it
+func (cs *CohortStore) writeFile(path string) error {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create cohort store file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriterSize(tmp, 1<<20)
+	if err := cs.writeTo(w); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cohort store: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cohort store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cohort store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace cohort store: %w", err)
+	}
+	return nil
+}
+
+// writeTo serializes the store.
+//
+// Layout (little-endian, strings are u32 length + bytes):
+//
+//	magic[8] numSamples:u32 numVariants:u32
+//	numSamples × name
+//	numVariants × (chrom pos:u64 ref alt gene hgvsc hgvsp type:u8 significance:u8
+//	               carriers:u32 carriers×sample:u32 carriers×fraction:f32)
+func (cs *CohortStore) writeTo(w io.Writer) error {
+	le := binary.LittleEndian
+	ew := &errWriter{w: w}
+
+	ew.write([]byte(cohortMagic))
+	ew.value(le, uint32(len(cs.samples)))
+	ew.value(le, uint32(len(cs.variants)))
+	for _, name := range cs.samples {
+		ew.str(le, name)
+	}
+	for i, v := range cs.variants {
+		ew.str(le, v.Chromosome)
+		ew.value(le, v.Position)
+		ew.str(le, v.RefAllele)
+		ew.str(le, v.AltAllele)
+		ew.str(le, v.Gene)
+		ew.str(le, v.HGVSc)
+		ew.str(le, v.HGVSp)
+		ew.value(le, uint8(v.MutationType))
+		ew.value(le, uint8(v.Significance))
+		ew.value(le, uint32(len(cs.carriers[i])))
+		ew.value(le, cs.carriers[i])
+		ew.value(le, cs.fractions[i])
+	}
+	return ew.err
+}
+
+// readFrom decodes a store written by writeTo
+func (cs *CohortStore) readFrom(r io.Reader) error {
+	le := binary.LittleEndian
+	er := &errReader{r: r}
+
+	if magic := er.bytes(len(cohortMagic)); string(magic) != cohortMagic {
+		if er.err != nil {
+			return er.err
+		}
+		return fmt.Errorf("bad magic")
+	}
+	numSamples := er.uint32(le)
+	numVariants := er.uint32(le)
+	if er.err != nil {
+		return er.err
+	}
+
+	for i := uint32(0); i < numSamples && er.err == nil; i++ {
+		cs.addSample(er.str(le))
+	}
+	for i := uint32(0); i < numVariants && er.err == nil; i++ {
+		v := &Mutation{Chromosome: er.str(le)}
+		v.Position = er.uint64(le)
+		v.RefAllele = er.str(le)
+		v.AltAllele = er.str(le)
+		v.Gene = er.str(le)
+		v.HGVSc = er.str(le)
+		v.HGVSp = er.str(le)
+		v.MutationType = MutationType(er.uint8())
+		v.Significance = Significance(er.uint8())
+
+		count := er.uint32(le)
+		if er.err != nil || count > numSamples {
+			return fmt.Errorf("corrupt variant record %d", i)
+		}
+		carriers := make([]uint32, count)
+		fractions := make([]float32, count)
+		er.value(le, carriers)
+		er.value(le, fractions)
+		for _, id := range carriers {
+			if id >= numSamples {
+				return fmt.Errorf("corrupt variant record %d", i)
+			}
+		}
+		v.SampleCount = int(count)
+
+		cs.variantIndex[variantKey(v)] = len(cs.variants)
+		cs.variants = append(cs.variants, v)
+		cs.carriers = append(cs.carriers, carriers)
+		cs.fractions = append(cs.fractions, fractions)
+	}
+	return er.err
+}
+
+// errWriter writes binary fields, keeping the first error
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) write(p []byte) {
+	if ew.err == nil {
+		_, ew.err = ew.w.Write(p)
+	}
+}
+
+func (ew *errWriter) value(order binary.ByteOrder, data interface{}) {
+	if ew.err == nil {
+		ew.err = binary.Write(ew.w, order, data)
+	}
+}
+
+func (ew *errWriter) str(order binary.ByteOrder, s string) {
+	ew.value(order, uint32(len(s)))
+	ew.write([]byte(s))
+}
+
+// errReader reads binary fields, keeping the first error
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (er *errReader) bytes(n int) []byte {
+	if er.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(er.r, buf); err != nil {
+		er.err = fmt.Errorf("truncated cohort store: %w", err)
+		return nil
+	}
+	return buf
+}
+
+func (er *errReader) value(order binary.ByteOrder, data interface{}) {
+	if er.err == nil {
+		if err := binary.Read(er.r, order, data); err != nil {
+			er.err = fmt.Errorf("truncated cohort store: %w", err)
+		}
+	}
+}
+
+func (er *errReader) uint8() uint8 {
+	var v uint8
+	er.value(binary.LittleEndian, &v)
+	return v
+}
+
+func (er *errReader) uint32(order binary.ByteOrder) uint32 {
+	var v uint32
+	er.value(order, &v)
+	return v
+}
+
+func (er *errReader) uint64(order binary.ByteOrder) uint64 {
+	var v uint64
+	er.value(order, &v)
+	return v
+}
+
+func (er *errReader) str(order binary.ByteOrder) string {
+	n := er.uint32(order)
+	if er.err != nil || n > 1<<20 {
+		if er.err == nil {
+			er.err = fmt.Errorf("corrupt string length %d", n)
+		}
+		return ""
+	}
+	return string(er.bytes(int(n)))
+}
@@ -0,0 +1,229 @@
+package mutations
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"genomevedic/internal/annotations"
+)
+
+// cohortVCF is a four-sample VEP-annotated VCF. The MANE, canonical and
+// picked transcripts are never the first CSQ entry.
+const cohortVCF = "##fileformat=VCFv4.2\n" +
+	"##INFO=<ID=CSQ,Number=.,Type=String,Description=\"Consequence annotations from Ensembl VEP. Format: Allele|Consequence|SYMBOL|Feature|HGVSc|HGVSp|CANONICAL|MANE_SELECT|PICK\">\n" +
+	"##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">\n" +
+	"##FORMAT=<ID=AD,Number=R,Type=Integer,Description=\"Allelic depths\">\n" +
+	"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\ts1\ts2\ts3\ts4\n" +
+	"chr7\t140753336\t.\tA\tT\t.\tPASS\tCSQ=" +
+	"T|missense_variant|BRAF|ENST00000644969|ENST00000644969.2:c.1919T>A|ENSP00000493543.1:p.Val640Glu|||," +
+	"T|missense_variant|BRAF|ENST00000646891|ENST00000646891.2:c.1799T>A|ENSP00000493543.1:p.Val600Glu|||1" +
+	"\tGT:AD\t0/0:10,0\t0/0:10,0\t0/0:10,0\t0/1:5,5\n" +
+	"chr12\t25245350\t.\tC\tT\t.\tPASS\tCSQ=" +
+	"T|missense_variant|KRAS|ENST00000311936|ENST00000311936.8:c.35G>A|ENSP00000308495.3:p.Gly12Asp|||," +
+	"T|missense_variant|KRAS|ENST00000256078|ENST00000256078.10:c.35G>A|ENSP00000256078.5:p.Gly12Asp|YES||" +
+	"\tGT:AD\t0/0:10,0\t0/1:7,3\t1/1:0,8\t./.\n" +
+	"chr17\t7675088\t.\tC\tT\t.\tPASS\tCSQ=" +
+	"T|missense_variant|TP53|ENST00000610292|ENST00000610292.4:c.407G>A|ENSP00000478219.1:p.Arg136His|YES||," +
+	"T|missense_variant|TP53|ENST00000269305|ENST00000269305.9:c.524G>A|ENSP00000269305.4:p.Arg175His|YES|NM_000546.6|" +
+	"\tGT:AD\t0/1:6,4\t0/1:5,5\t0/0:9,0\t0/0:9,0\n" +
+	"chr17\t7676000\t.\tG\tA\t.\tLowQual\t.\tGT:AD\t0/1:5,5\t0/0:9,0\t0/0:9,0\t0/0:9,0\n"
+
+// ingestString ingests a VCF held in memory
+func ingestString(t *testing.T, store *CohortStore, vcf, sampleName string) int {
+	t.Helper()
+	reader, err := NewVCFReader(strings.NewReader(vcf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := store.IngestVCF(reader, sampleName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return added
+}
+
+// TestCohortIngest ingests genotypes and resolves protein, coding,
+// genomic and gene selectors against the preferred transcript
+func TestCohortIngest(t *testing.T) {
+	store := NewCohortStore()
+	if added := ingestString(t, store, cohortVCF, ""); added != 5 {
+		t.Fatalf("Expected 5 calls, got %d", added)
+	}
+	if added := ingestString(t, store, cohortVCF, ""); added != 0 {
+		t.Errorf("Re-ingest added %d calls", added)
+	}
+	if strings.Join(store.Samples(), ",") != "s1,s2,s3,s4" || len(store.Variants()) != 3 {
+		t.Fatalf("Unexpected store: %v, %d variants", store.Samples(), len(store.Variants()))
+	}
+
+	variants, err := store.FindVariants("TP53 R175H")
+	if err != nil || len(variants) != 1 || variants[0].HGVSp != "ENSP00000269305.4:p.Arg175His" {
+		t.Fatalf("TP53 R175H did not resolve to the MANE transcript: %v %v", variants, err)
+	}
+	if variants[0].SampleCount != 2 || variants[0].MutationType != MutationMissense {
+		t.Errorf("Unexpected TP53 variant %+v", variants[0])
+	}
+
+	for _, tc := range []struct {
+		selectors []string
+		all       bool
+		want      string
+	}{
+		{[]string{"TP53 R175H", "KRAS G12D"}, true, "s2"},
+		{[]string{"TP53 p.Arg175His", "KRAS:p.G12D"}, true, "s2"},
+		{[]string{"KRAS c.35G>A", "BRAF V600E"}, false, "s2,s3,s4"},
+		{[]string{"chr12-25245350-C-T"}, true, "s2,s3"},
+		{[]string{"17:7675088:C>T"}, false, "s1,s2"},
+		{[]string{"TP53"}, true, "s1,s2"},
+		{[]string{"TP53 R136H"}, false, ""},
+		{[]string{"BRAF V640E"}, false, ""},
+	} {
+		var samples []string
+		if tc.all {
+			samples, err = store.SamplesWithAll(tc.selectors...)
+		} else {
+			samples, err = store.SamplesWithAny(tc.selectors...)
+		}
+		if err != nil || strings.Join(samples, ",") != tc.want {
+			t.Errorf("%v (all=%v) = %v, %v; want %q", tc.selectors, tc.all, samples, err, tc.want)
+		}
+	}
+	if _, err := store.SamplesWithAll(" "); err == nil {
+		t.Error("Expected error for an empty selector")
+	}
+
+	names, fractions := store.CarriersOf(&Mutation{Chromosome: "17", Position: 7675088, RefAllele: "C", AltAllele: "T"})
+	if strings.Join(names, ",") != "s1,s2" || math.Abs(fractions[0]-0.4) > 1e-6 || math.Abs(fractions[1]-0.5) > 1e-6 {
+		t.Errorf("Unexpected carriers %v %v", names, fractions)
+	}
+
+	test, err := store.CoOccurrence("TP53", "KRAS")
+	if err != nil || test.Both != 1 || test.OnlyA != 1 || test.OnlyB != 1 || test.Neither != 1 || test.Tendency != "none" {
+		t.Errorf("Unexpected co-occurrence %+v, %v", test, err)
+	}
+
+	burden := store.Burden(2)
+	if burden[1].Sample != "s2" || burden[1].Variants != 2 || burden[1].CodingNonSyn != 2 || burden[1].MutationsPerMb != 1 {
+		t.Errorf("Unexpected burden %+v", burden)
+	}
+	if sample, err := store.SampleVariants("s4"); err != nil || len(sample) != 1 || sample[0].Gene != "BRAF" {
+		t.Errorf("Unexpected s4 variants %v, %v", sample, err)
+	}
+}
+
+// TestCohortSitesOnly ingests sites-only VCFs as one named sample, across
+// several ingest batches, and records annotation failures
+func TestCohortSitesOnly(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n")
+	n := 2*cohortBatchRecords + 7
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "chr1\t%d\t.\tA\tG\t.\tPASS\tAF=0.25\n", 1000+i)
+	}
+
+	store := NewCohortStore()
+	store.SetAnnotator(NewConsequenceAnnotator(annotations.NewGTFParser(0), nil))
+	reader, _ := NewVCFReader(strings.NewReader(sb.String()))
+	if _, err := store.IngestVCF(reader, ""); err == nil {
+		t.Error("Expected error for an unnamed sites-only VCF")
+	}
+	if added := ingestString(t, store, sb.String(), "tumor"); added != n {
+		t.Fatalf("Expected %d calls, got %d", n, added)
+	}
+
+	stats := store.GetStatistics()
+	if stats["variants"] != n || stats["samples"] != 1 {
+		t.Errorf("Unexpected statistics %v", stats)
+	}
+	// The annotator has no reference, so every new variant fails once
+	if stats["annotation_failures"] != n || !strings.Contains(stats["annotation_error"].(string), "reference") {
+		t.Errorf("Expected %d recorded annotation failures, got %v", n, stats)
+	}
+	names, fractions := store.CarriersOf(&Mutation{Chromosome: "chr1", Position: 1000, RefAllele: "A", AltAllele: "G"})
+	if len(names) != 1 || names[0] != "tumor" || fractions[0] != 0.25 {
+		t.Errorf("Unexpected carriers %v %v", names, fractions)
+	}
+}
+
+// TestCohortPersistence round-trips the store through its file format
+func TestCohortPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cohort.gvc")
+	store, err := OpenCohortStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingestString(t, store, cohortVCF, "")
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenCohortStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := reopened.SamplesWithAll("TP53 R175H", "KRAS G12D")
+	if err != nil || strings.Join(samples, ",") != "s2" {
+		t.Errorf("Reopened store query = %v, %v", samples, err)
+	}
+	_, fractions := reopened.CarriersOf(&Mutation{Chromosome: "chr12", Position: 25245350, RefAllele: "C", AltAllele: "T"})
+	if len(fractions) != 2 || math.Abs(fractions[0]-0.3) > 1e-6 || fractions[1] != 1 {
+		t.Errorf("Unexpected fractions after reload %v", fractions)
+	}
+
+	if _, err := OpenCohortStore("cohort_store.go"); err == nil {
+		t.Error("Expected error opening a file that is not a cohort store")
+	}
+}
+
+// TestCohortHandler exercises the query and co-occurrence endpoints
+func TestCohortHandler(t *testing.T) {
+	store := NewCohortStore()
+	ingestString(t, store, cohortVCF, "")
+	mux := http.NewServeMux()
+	NewCohortHandler(store).RegisterRoutes(mux, func(h http.HandlerFunc) http.HandlerFunc { return h })
+
+	do := func(method, url, body string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		var response map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q", method, url, rec.Body.String())
+		}
+		return rec.Code, response
+	}
+
+	code, response := do(http.MethodPost, "/api/v1/cohort/query", `{"all": ["TP53 R175H"], "any": ["KRAS G12D", "BRAF V600E"]}`)
+	if code != http.StatusOK || fmt.Sprint(response["samples"]) != "[s2]" || response["cohort_size"] != 4.0 {
+		t.Errorf("Query: %d %v", code, response)
+	}
+	code, response = do(http.MethodPost, "/api/v1/cohort/query", `{}`)
+	if code != http.StatusBadRequest || response["success"] != false {
+		t.Errorf("Empty query: %d %v", code, response)
+	}
+
+	code, response = do(http.MethodPost, "/api/v1/cohort/cooccurrence", `{"selectors": ["TP53", "KRAS", "BRAF"]}`)
+	if code != http.StatusOK || response["count"] != 3.0 {
+		t.Fatalf("Co-occurrence: %d %v", code, response)
+	}
+	first := response["results"].([]interface{})[0].(map[string]interface{})["test"].(map[string]interface{})
+	if first["a"] != "TP53" || first["b"] != "KRAS" || first["both"] != 1.0 {
+		t.Errorf("Unexpected first pair %v", first)
+	}
+
+	code, response = do(http.MethodGet, "/api/v1/cohort/sample?name=s3", "")
+	if code != http.StatusOK || response["count"] != 1.0 {
+		t.Errorf("Sample: %d %v", code, response)
+	}
+	if code, _ = do(http.MethodGet, "/api/v1/cohort/sample?name=missing", ""); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown sample, got %d", code)
+	}
+	if code, _ = do(http.MethodGet, "/api/v1/cohort/query", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", code)
+	}
+}
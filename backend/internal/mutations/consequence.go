@@ -0,0 +1,1041 @@
+/**
+ * Variant Consequence Annotator
+ *
+ * Predicts the effect of mutations on transcripts from gene annotations
+ * (GTF, GFF3 or BED12) and the reference genome, for VCFs that arrive
+ * without VEP/snpEff annotation.
+ *
+ * Consequences use Sequence Ontology terms, ranked by Ensembl VEP severity:
+ *   splice_acceptor/donor > stop_gained > frameshift > stop_lost > start_lost
+ *   > inframe indel > missense > splice_region > synonymous > UTR > intron
+ *   > upstream/downstream > intergenic
+ *
+ * HGVS notation is produced at the coding (c.) and protein (p.) level.
+ * Indels are shifted to their most 3' position in the transcript, as HGVS
+ * requires, before both classification and notation.
+ */
+
+package mutations
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"genomevedic/internal/annotations"
+	"genomevedic/internal/interval"
+	"genomevedic/internal/reference"
+)
+
+// consequenceSeverity lists SO terms from most to least severe
+var consequenceSeverity = []string{
+	"splice_acceptor_variant",
+	"splice_donor_variant",
+	"stop_gained",
+	"frameshift_variant",
+	"stop_lost",
+	"start_lost",
+	"inframe_insertion",
+	"inframe_deletion",
+	"missense_variant",
+	"coding_sequence_variant",
+	"splice_region_variant",
+	"stop_retained_variant",
+	"synonymous_variant",
+	"5_prime_UTR_variant",
+	"3_prime_UTR_variant",
+	"non_coding_transcript_exon_variant",
+	"intron_variant",
+	"upstream_gene_variant",
+	"downstream_gene_variant",
+	"intergenic_variant",
+}
+
+// consequenceRank maps SO terms to their severity rank
+var consequenceRank = func() map[string]int {
+	ranks := make(map[string]int, len(consequenceSeverity))
+	for i, term := range consequenceSeverity {
+		ranks[term] = i
+	}
+	return ranks
+}()
+
+// Annotation parameters
+const (
+	flankingDistance = 5000 // Upstream/downstream reporting distance (bp)
+	shiftWindow      = 500  // Reference bases fetched around a variant for 3' shifting
+)
+
+// VariantEffect is the predicted effect of a mutation on one transcript
+type VariantEffect struct {
+	TranscriptID    string
+	GeneID          string
+	GeneName        string
+	Strand          string
+	Consequences    []string // SO terms, most severe first
+	MutationType    MutationType
+	HGVSc           string // e.g. "c.524G>A"
+	HGVSp           string // e.g. "p.Arg175His"
+	CDSPosition     int    // 1-based; 0 when outside the CDS
+	ProteinPosition int    // 1-based; 0 when outside the CDS
+	Distance        uint64 // Distance to the transcript for upstream/downstream variants
+}
+
+// Consequence returns the most severe consequence term
+func (ve *VariantEffect) Consequence() string {
+	if len(ve.Consequences) == 0 {
+		return ""
+	}
+	return ve.Consequences[0]
+}
+
+// transcriptModel is a transcript's exon and CDS structure
+// (0-based, inclusive, ascending genomic order)
+type transcriptModel struct {
+	id         string
+	geneID     string
+	geneName   string
+	chromosome string
+	strand     string
+	start      uint64
+	end        uint64
+	exons      [][2]uint64
+	cds        [][2]uint64 // Includes the stop codon
+
+	cdsOnce sync.Once
+	cdsSeq  string // Coding sequence in transcript orientation
+	cdsErr  error
+}
+
+// ConsequenceAnnotator predicts variant consequences over annotated transcripts
+type ConsequenceAnnotator struct {
+	reference   *reference.FASTA
+	transcripts *interval.Index[*transcriptModel]
+	chromosomes map[string]bool
+}
+
+// NewConsequenceAnnotator builds transcript models from parsed annotations
+func NewConsequenceAnnotator(genes *annotations.GTFParser, ref *reference.FASTA) *ConsequenceAnnotator {
+	ca := &ConsequenceAnnotator{
+		reference:   ref,
+		transcripts: interval.New[*transcriptModel](),
+		chromosomes: make(map[string]bool),
+	}
+
+	models := make(map[string]*transcriptModel)
+	order := make([]string, 0, 1000)
+	model := func(feature *annotations.GenomicFeature) *transcriptModel {
+		tx, ok := models[feature.TranscriptID]
+		if !ok {
+			tx = &transcriptModel{
+				id:         feature.TranscriptID,
+				chromosome: feature.Chromosome,
+				strand:     feature.Strand,
+				start:      feature.Start,
+				end:        feature.End,
+			}
+			models[feature.TranscriptID] = tx
+			order = append(order, feature.TranscriptID)
+		}
+		if tx.geneID == "" {
+			tx.geneID = feature.GeneID
+		}
+		if tx.geneName == "" {
+			tx.geneName = feature.GeneName
+		}
+		return tx
+	}
+
+	for _, feature := range genes.GetFeatures() {
+		if feature.TranscriptID == "" {
+			continue
+		}
+		switch feature.Type {
+		case annotations.FeatureTranscript:
+			tx := model(feature)
+			tx.start, tx.end = min(tx.start, feature.Start), max(tx.end, feature.End)
+		case annotations.FeatureExon:
+			tx := model(feature)
+			tx.exons = append(tx.exons, [2]uint64{feature.Start, feature.End})
+		case annotations.FeatureCDS, annotations.FeatureStartCodon, annotations.FeatureStopCodon:
+			tx := model(feature)
+			tx.cds = append(tx.cds, [2]uint64{feature.Start, feature.End})
+		}
+	}
+
+	for _, id := range order {
+		tx := models[id]
+		if len(tx.exons) == 0 {
+			// CDS-only annotations: coding segments are the exons
+			tx.exons = append(tx.exons, tx.cds...)
+		}
+		if len(tx.exons) == 0 {
+			continue
+		}
+		tx.exons = mergeSegments(tx.exons)
+		tx.cds = mergeSegments(tx.cds)
+		tx.start = min(tx.start, tx.exons[0][0])
+		tx.end = max(tx.end, tx.exons[len(tx.exons)-1][1])
+
+		ca.transcripts.Add(tx.chromosome, tx.start, tx.end, tx)
+		ca.chromosomes[tx.chromosome] = true
+	}
+
+	return ca
+}
+
+// mergeSegments sorts segments and merges overlapping or adjacent ones
+func mergeSegments(segments [][2]uint64) [][2]uint64 {
+	if len(segments) == 0 {
+		return nil
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i][0] < segments[j][0] })
+
+	merged := segments[:1]
+	for _, segment := range segments[1:] {
+		last := &merged[len(merged)-1]
+		if segment[0] <= last[1]+1 {
+			last[1] = max(last[1], segment[1])
+			continue
+		}
+		merged = append(merged, segment)
+	}
+	return merged
+}
+
+// resolveChromosome maps a mutation's chromosome to the annotation naming
+func (ca *ConsequenceAnnotator) resolveChromosome(name string) string {
+	return matchChromosome(name, ca.chromosomes)
+}
+
+// matchChromosome returns the spelling of a chromosome name used in known,
+// trying with and without the "chr" prefix
+func matchChromosome(name string, known map[string]bool) string {
+	candidates := []string{name, "chr" + name, strings.TrimPrefix(name, "chr")}
+	if name == "MT" || name == "chrM" || name == "M" {
+		candidates = append(candidates, "chrM", "MT")
+	}
+	for _, candidate := range candidates {
+		if known[candidate] {
+			return candidate
+		}
+	}
+	return name
+}
+
+// Predict returns the effect of a mutation on every transcript it overlaps
+// or lies within 5 kb of, most severe first. Variants away from all
+// transcripts yield a single intergenic effect.
+func (ca *ConsequenceAnnotator) Predict(m *Mutation) ([]*VariantEffect, error) {
+	if ca.reference == nil {
+		return nil, fmt.Errorf("consequence prediction requires a reference genome")
+	}
+	if IsSymbolicAllele(m.AltAllele) || m.Position == 0 {
+		return nil, fmt.Errorf("cannot predict consequences for %s:%d %s>%s", m.Chromosome, m.Position, m.RefAllele, m.AltAllele)
+	}
+
+	v, err := ca.newVariant(m)
+	if err != nil {
+		return nil, err
+	}
+
+	chromosome := ca.resolveChromosome(m.Chromosome)
+	lo := uint64(0)
+	if v.start > flankingDistance {
+		lo = v.start - flankingDistance
+	}
+	nearby := ca.transcripts.Overlapping(chromosome, lo, v.end+flankingDistance)
+	if len(nearby) == 0 {
+		return []*VariantEffect{{
+			Consequences: []string{"intergenic_variant"},
+			MutationType: MutationIntergenic,
+		}}, nil
+	}
+
+	effects := make([]*VariantEffect, 0, len(nearby))
+	for _, tx := range nearby {
+		effect, err := ca.predictTranscript(tx, v)
+		if err != nil {
+			return nil, err
+		}
+		effects = append(effects, effect)
+	}
+
+	sort.SliceStable(effects, func(i, j int) bool {
+		ri, rj := consequenceRank[effects[i].Consequence()], consequenceRank[effects[j].Consequence()]
+		if ri != rj {
+			return ri < rj
+		}
+		return effects[i].TranscriptID < effects[j].TranscriptID
+	})
+	return effects, nil
+}
+
+// Annotate predicts the most severe effect and records it on the mutation:
+// MutationType, HGVS notation and (when missing) the gene name
+func (ca *ConsequenceAnnotator) Annotate(m *Mutation) (*VariantEffect, error) {
+	effects, err := ca.Predict(m)
+	if err != nil {
+		return nil, err
+	}
+
+	effect := effects[0]
+	m.MutationType = effect.MutationType
+	if m.Gene == "" {
+		m.Gene = effect.GeneName
+	}
+	m.HGVSc, m.HGVSp = "", ""
+	if effect.HGVSc != "" {
+		m.HGVSc = effect.TranscriptID + ":" + effect.HGVSc
+	}
+	if effect.HGVSp != "" {
+		m.HGVSp = effect.TranscriptID + ":" + effect.HGVSp
+	}
+	return effect, nil
+}
+
+// AnnotateMutations annotates mutations whose type is unknown, continuing
+// past failures. It returns the number annotated and the first error.
+func (ca *ConsequenceAnnotator) AnnotateMutations(mutations []*Mutation) (int, error) {
+	annotated := 0
+	var firstErr error
+	for _, m := range mutations {
+		if m.MutationType != MutationUnknown {
+			continue
+		}
+		if _, err := ca.Annotate(m); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to annotate %s:%d: %w", m.Chromosome, m.Position, err)
+			}
+			continue
+		}
+		annotated++
+	}
+	return annotated, firstErr
+}
+
+// variant is a mutation reduced to its changed bases (0-based, half-open).
+// Insertions have start == end: the new bases go before start.
+type variant struct {
+	chromosome  string
+	start       uint64
+	end         uint64
+	ref         string
+	alt         string
+	windowStart uint64 // Reference context used for shifting
+	window      string
+}
+
+// newVariant trims bases shared by REF and ALT, checks REF against the
+// reference and fetches flanking context
+func (ca *ConsequenceAnnotator) newVariant(m *Mutation) (*variant, error) {
+	ref, alt := strings.ToUpper(m.RefAllele), strings.ToUpper(m.AltAllele)
+	if ref == "-" {
+		ref = ""
+	}
+	if alt == "-" {
+		alt = ""
+	}
+	start := m.Position - 1
+
+	for len(ref) > 0 && len(alt) > 0 && ref[len(ref)-1] == alt[len(alt)-1] {
+		ref, alt = ref[:len(ref)-1], alt[:len(alt)-1]
+	}
+	for len(ref) > 0 && len(alt) > 0 && ref[0] == alt[0] {
+		ref, alt = ref[1:], alt[1:]
+		start++
+	}
+	if ref == "" && alt == "" {
+		return nil, fmt.Errorf("REF and ALT are identical at %s:%d", m.Chromosome, m.Position)
+	}
+
+	// The reference may name chromosomes "17" or "chr17"
+	chromosome, ok := ca.reference.ResolveName(m.Chromosome)
+	if !ok {
+		return nil, fmt.Errorf("chromosome %s not in reference", m.Chromosome)
+	}
+	length, _ := ca.reference.Length(chromosome)
+	v := &variant{chromosome: chromosome, start: start, end: start + uint64(len(ref)), ref: ref, alt: alt}
+
+	if v.end > uint64(length) {
+		return nil, fmt.Errorf("%s:%d lies beyond the end of the reference", m.Chromosome, m.Position)
+	}
+	if v.start > shiftWindow {
+		v.windowStart = v.start - shiftWindow
+	}
+	windowEnd := min(v.end+shiftWindow, uint64(length))
+	window, err := ca.reference.Fetch(chromosome, int64(v.windowStart), int64(windowEnd))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reference context: %w", err)
+	}
+	v.window = window
+
+	if got := v.refBases(v.start, v.end); got != ref {
+		return nil, fmt.Errorf("REF %s does not match reference %s at %s:%d", ref, got, m.Chromosome, v.start+1)
+	}
+	return v, nil
+}
+
+// refBases returns reference bases [start, end) from the context window
+func (v *variant) refBases(start, end uint64) string {
+	if start < v.windowStart || end > v.windowStart+uint64(len(v.window)) || start > end {
+		return ""
+	}
+	return v.window[start-v.windowStart : end-v.windowStart]
+}
+
+// isInsertion reports whether the variant only adds bases
+func (v *variant) isInsertion() bool {
+	return v.start == v.end
+}
+
+// overlaps reports whether the variant touches [a, b] (inclusive). An
+// insertion touches a region holding either flanking base.
+func (v *variant) overlaps(a, b uint64) bool {
+	if v.isInsertion() {
+		return (v.start > 0 && v.start-1 >= a && v.start-1 <= b) || (v.start >= a && v.start <= b)
+	}
+	return v.start <= b && v.end-1 >= a
+}
+
+// within reports whether the variant lies entirely inside [a, b]. An
+// insertion must have both flanking bases inside.
+func (v *variant) within(a, b uint64) bool {
+	if v.isInsertion() {
+		return v.start > a && v.start <= b
+	}
+	return v.start >= a && v.end-1 <= b
+}
+
+// shift moves a pure insertion or deletion towards the 3' end of the
+// transcript (right on +, left on -) while staying inside [lo, hi]
+func (v *variant) shift(strand string, lo, hi uint64) *variant {
+	if v.ref != "" && v.alt != "" {
+		return v
+	}
+	shifted := *v
+	seq := v.ref + v.alt // The deleted or inserted bases
+	windowEnd := v.windowStart + uint64(len(v.window))
+	base := func(pos uint64) byte { return v.window[pos-v.windowStart] }
+
+	if strand == "-" {
+		for {
+			// An insertion point needs both flanking bases inside the region
+			if (shifted.isInsertion() && shifted.start-1 <= lo) || (!shifted.isInsertion() && shifted.start <= lo) {
+				break
+			}
+			if shifted.start-1 < v.windowStart || base(shifted.start-1) != seq[len(seq)-1] {
+				break
+			}
+			seq = seq[len(seq)-1:] + seq[:len(seq)-1]
+			shifted.start--
+			shifted.end--
+		}
+	} else {
+		for {
+			if (shifted.isInsertion() && shifted.start >= hi) || (!shifted.isInsertion() && shifted.end > hi) {
+				break
+			}
+			if shifted.end >= windowEnd || base(shifted.end) != seq[0] {
+				break
+			}
+			seq = seq[1:] + seq[:1]
+			shifted.start++
+			shifted.end++
+		}
+	}
+
+	if v.ref != "" {
+		shifted.ref = seq
+	} else {
+		shifted.alt = seq
+	}
+	return &shifted
+}
+
+// predictTranscript classifies a variant against one transcript
+func (ca *ConsequenceAnnotator) predictTranscript(tx *transcriptModel, v *variant) (*VariantEffect, error) {
+	effect := &VariantEffect{
+		TranscriptID: tx.id,
+		GeneID:       tx.geneID,
+		GeneName:     tx.geneName,
+		Strand:       tx.strand,
+	}
+
+	// Outside the transcript: upstream or downstream
+	if !v.overlaps(tx.start, tx.end) {
+		before := v.start < tx.start
+		if before {
+			effect.Distance = tx.start - v.start
+		} else {
+			effect.Distance = v.start - tx.end
+		}
+		if before == (tx.strand != "-") {
+			effect.Consequences = []string{"upstream_gene_variant"}
+		} else {
+			effect.Consequences = []string{"downstream_gene_variant"}
+		}
+		effect.MutationType = MutationIntergenic
+		return effect, nil
+	}
+
+	// Shift indels 3' within the exon or intron that holds them
+	for i, exon := range tx.exons {
+		if v.within(exon[0], exon[1]) {
+			v = v.shift(tx.strand, exon[0], exon[1])
+			break
+		}
+		if i+1 < len(tx.exons) && v.within(exon[1]+1, tx.exons[i+1][0]-1) {
+			v = v.shift(tx.strand, exon[1]+1, tx.exons[i+1][0]-1)
+			break
+		}
+	}
+
+	terms := make(map[string]bool)
+	ca.classifySplicing(tx, v, terms)
+
+	withinExon := false
+	for _, exon := range tx.exons {
+		if v.within(exon[0], exon[1]) {
+			withinExon = true
+			break
+		}
+	}
+
+	switch {
+	case withinExon && len(tx.cds) > 0:
+		if err := ca.classifyExonic(tx, v, effect, terms); err != nil {
+			return nil, err
+		}
+	case withinExon:
+		terms["non_coding_transcript_exon_variant"] = true
+	case overlapsAny(v, tx.cds):
+		// Spans an exon boundary: the protein change cannot be predicted
+		terms["coding_sequence_variant"] = true
+		terms["intron_variant"] = true
+		effect.HGVSp = "p.?"
+	case overlapsAny(v, tx.exons):
+		terms["intron_variant"] = true
+		if len(tx.cds) > 0 {
+			terms[ca.utrTerm(tx, v)] = true
+		} else {
+			terms["non_coding_transcript_exon_variant"] = true
+		}
+	default:
+		terms["intron_variant"] = true
+	}
+
+	for _, term := range consequenceSeverity {
+		if terms[term] {
+			effect.Consequences = append(effect.Consequences, term)
+		}
+	}
+	effect.MutationType = consequenceMutationType(effect.Consequence())
+	effect.HGVSc = ca.hgvsCoding(tx, v)
+	return effect, nil
+}
+
+// classifySplicing adds splice site and splice region terms. Donor sites are
+// the first two intronic bases in transcript orientation, acceptors the last
+// two; splice regions cover 3 exonic and 3-8 intronic bases.
+func (ca *ConsequenceAnnotator) classifySplicing(tx *transcriptModel, v *variant, terms map[string]bool) {
+	for i := 0; i+1 < len(tx.exons); i++ {
+		intronStart, intronEnd := tx.exons[i][1]+1, tx.exons[i+1][0]-1
+		if intronEnd < intronStart+3 {
+			continue // Too short to be a real intron
+		}
+
+		leftSite, rightSite := "splice_donor_variant", "splice_acceptor_variant"
+		if tx.strand == "-" {
+			leftSite, rightSite = rightSite, leftSite
+		}
+
+		// Insertions only disrupt a site when placed between its two bases
+		if v.isInsertion() {
+			terms[leftSite] = terms[leftSite] || v.start == intronStart+1
+			terms[rightSite] = terms[rightSite] || v.start == intronEnd
+		} else {
+			terms[leftSite] = terms[leftSite] || v.overlaps(intronStart, intronStart+1)
+			terms[rightSite] = terms[rightSite] || v.overlaps(intronEnd-1, intronEnd)
+		}
+
+		regions := [][2]uint64{
+			{intronStart - min(3, intronStart), intronStart - 1}, // Exonic
+			{intronEnd + 1, intronEnd + 3},
+			{intronStart + 2, min(intronStart+7, intronEnd)}, // Intronic
+			{max(intronEnd-7, intronStart), intronEnd - 2},
+		}
+		for _, region := range regions {
+			if v.overlaps(region[0], region[1]) {
+				terms["splice_region_variant"] = true
+			}
+		}
+	}
+}
+
+// overlapsAny reports whether the variant touches any segment
+func overlapsAny(v *variant, segments [][2]uint64) bool {
+	for _, segment := range segments {
+		if v.overlaps(segment[0], segment[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// utrTerm returns the UTR term for a variant outside the CDS
+func (ca *ConsequenceAnnotator) utrTerm(tx *transcriptModel, v *variant) string {
+	beforeCDS := v.start < tx.cds[0][0]
+	if beforeCDS == (tx.strand != "-") {
+		return "5_prime_UTR_variant"
+	}
+	return "3_prime_UTR_variant"
+}
+
+// classifyExonic handles variants inside one exon of a coding transcript
+func (ca *ConsequenceAnnotator) classifyExonic(tx *transcriptModel, v *variant, effect *VariantEffect, terms map[string]bool) error {
+	inCDS := false
+	for _, segment := range tx.cds {
+		if v.within(segment[0], segment[1]) {
+			inCDS = true
+			break
+		}
+	}
+	if !inCDS {
+		if overlapsAny(v, tx.cds) {
+			// Straddles the start or stop codon boundary
+			terms["coding_sequence_variant"] = true
+			effect.HGVSp = "p.?"
+		}
+		terms[ca.utrTerm(tx, v)] = true
+		return nil
+	}
+
+	cds, err := ca.codingSequence(tx)
+	if err != nil {
+		return err
+	}
+
+	// Apply the variant to the CDS in genomic orientation
+	genomic := cds
+	if tx.strand == "-" {
+		genomic = reverseComplement(cds)
+	}
+	offset := cdsOffset(tx.cds, v.start)
+	if v.isInsertion() {
+		offset = cdsOffset(tx.cds, v.start-1) + 1
+	}
+	mutated := genomic[:offset] + v.alt + genomic[offset+len(v.ref):]
+
+	// First affected base in transcript orientation
+	first := offset
+	if tx.strand == "-" {
+		mutated = reverseComplement(mutated)
+		first = len(cds) - offset - len(v.ref)
+	}
+	if v.isInsertion() && tx.strand == "-" {
+		first = len(cds) - offset
+	}
+	effect.CDSPosition = first + 1
+	effect.ProteinPosition = first/3 + 1
+
+	refProtein := translate(cds)
+	altProtein := translate(mutated)
+	if stop := strings.IndexByte(refProtein, '*'); stop >= 0 {
+		refProtein = refProtein[:stop+1]
+	}
+	if stop := strings.IndexByte(altProtein, '*'); stop >= 0 {
+		altProtein = altProtein[:stop+1]
+	}
+
+	delta := len(v.alt) - len(v.ref)
+	prefix := commonPrefix(refProtein, altProtein)
+
+	// Stop codon indexes; without a stop the protein runs off the CDS end
+	refStop, altStop := len(refProtein), len(altProtein)
+	if strings.HasSuffix(refProtein, "*") {
+		refStop--
+	}
+	if strings.HasSuffix(altProtein, "*") {
+		altStop--
+	}
+	expectedStop := refStop + delta/3
+
+	switch {
+	case delta%3 != 0:
+		terms["frameshift_variant"] = true
+		effect.HGVSp = hgvsFrameshift(refProtein, altProtein, prefix)
+		return nil
+
+	case refProtein == altProtein:
+		if strings.HasSuffix(refProtein, "*") && first >= len(refProtein)*3-3 {
+			terms["stop_retained_variant"] = true
+		} else {
+			terms["synonymous_variant"] = true
+		}
+		position := min(effect.ProteinPosition, len(refProtein))
+		effect.HGVSp = fmt.Sprintf("p.%s%d=", aminoAcidName(refProtein[position-1]), position)
+		return nil
+
+	case prefix == 0 && len(refProtein) > 0 && refProtein[0] == 'M':
+		terms["start_lost"] = true
+		effect.HGVSp = "p.Met1?"
+		return nil
+
+	case strings.HasSuffix(altProtein, "*") && altStop < expectedStop:
+		terms["stop_gained"] = true
+
+	case strings.HasSuffix(refProtein, "*") && (!strings.HasSuffix(altProtein, "*") || altStop > expectedStop):
+		terms["stop_lost"] = true
+
+	case delta > 0:
+		terms["inframe_insertion"] = true
+	case delta < 0:
+		terms["inframe_deletion"] = true
+	default:
+		terms["missense_variant"] = true
+	}
+
+	effect.HGVSp = hgvsProtein(refProtein, altProtein, prefix)
+	return nil
+}
+
+// codingSequence fetches and caches a transcript's CDS in transcript orientation
+func (ca *ConsequenceAnnotator) codingSequence(tx *transcriptModel) (string, error) {
+	tx.cdsOnce.Do(func() {
+		var sb strings.Builder
+		for _, segment := range tx.cds {
+			seq, err := ca.reference.Fetch(tx.chromosome, int64(segment[0]), int64(segment[1]+1))
+			if err != nil {
+				tx.cdsErr = fmt.Errorf("failed to fetch CDS of %s: %w", tx.id, err)
+				return
+			}
+			sb.WriteString(seq)
+		}
+		tx.cdsSeq = sb.String()
+		if tx.strand == "-" {
+			tx.cdsSeq = reverseComplement(tx.cdsSeq)
+		}
+	})
+	return tx.cdsSeq, tx.cdsErr
+}
+
+// cdsOffset returns the offset of a genomic position within the
+// concatenated CDS segments in genomic order
+func cdsOffset(segments [][2]uint64, position uint64) int {
+	offset := 0
+	for _, segment := range segments {
+		if position <= segment[1] {
+			return offset + int(position-segment[0])
+		}
+		offset += int(segment[1] - segment[0] + 1)
+	}
+	return offset
+}
+
+// hgvsFrameshift formats p.Arg97ProfsTer23 (or p.Arg97Ter when the first
+// changed residue is a stop)
+func hgvsFrameshift(refProtein, altProtein string, prefix int) string {
+	if prefix >= len(refProtein) || prefix >= len(altProtein) {
+		return "p.?"
+	}
+	position := prefix + 1
+	if altProtein[prefix] == '*' {
+		return fmt.Sprintf("p.%s%dTer", aminoAcidName(refProtein[prefix]), position)
+	}
+	length := "?"
+	if stop := strings.IndexByte(altProtein[prefix:], '*'); stop >= 0 {
+		length = strconv.Itoa(stop + 1)
+	}
+	return fmt.Sprintf("p.%s%d%sfsTer%s", aminoAcidName(refProtein[prefix]), position, aminoAcidName(altProtein[prefix]), length)
+}
+
+// hgvsProtein formats in-frame protein changes: substitutions, nonsense,
+// deletions, duplications, insertions, delins and stop-loss extensions
+func hgvsProtein(refProtein, altProtein string, prefix int) string {
+	if prefix >= len(refProtein) {
+		return "p.?"
+	}
+
+	// Stop gained at the first changed residue
+	if prefix < len(altProtein) && altProtein[prefix] == '*' {
+		return fmt.Sprintf("p.%s%dTer", aminoAcidName(refProtein[prefix]), prefix+1)
+	}
+
+	// Stop lost: the protein extends to the next in-frame stop
+	if refProtein[prefix] == '*' {
+		extension := "?"
+		if stop := strings.IndexByte(altProtein[prefix:], '*'); stop >= 0 {
+			extension = strconv.Itoa(stop)
+		}
+		next := "?"
+		if prefix < len(altProtein) {
+			next = aminoAcidName(altProtein[prefix])
+		}
+		return fmt.Sprintf("p.Ter%d%sextTer%s", prefix+1, next, extension)
+	}
+
+	// Trim the shared C-terminal part (shifts changes 3')
+	refEnd, altEnd := len(refProtein), len(altProtein)
+	for refEnd > prefix && altEnd > prefix && refProtein[refEnd-1] == altProtein[altEnd-1] {
+		refEnd--
+		altEnd--
+	}
+	deleted, inserted := refProtein[prefix:refEnd], altProtein[prefix:altEnd]
+
+	span := func(start, end int) string {
+		if end-start == 1 {
+			return fmt.Sprintf("%s%d", aminoAcidName(refProtein[start]), start+1)
+		}
+		return fmt.Sprintf("%s%d_%s%d", aminoAcidName(refProtein[start]), start+1, aminoAcidName(refProtein[end-1]), end)
+	}
+
+	switch {
+	case len(deleted) == 1 && len(inserted) == 1:
+		return fmt.Sprintf("p.%s%d%s", aminoAcidName(deleted[0]), prefix+1, aminoAcidName(inserted[0]))
+	case len(inserted) == 0:
+		return "p." + span(prefix, refEnd) + "del"
+	case len(deleted) == 0:
+		if prefix >= len(inserted) && refProtein[prefix-len(inserted):prefix] == inserted {
+			return "p." + span(prefix-len(inserted), prefix) + "dup"
+		}
+		if prefix == 0 {
+			return "p.?"
+		}
+		return "p." + span(prefix-1, prefix+1) + "ins" + proteinName(inserted)
+	default:
+		return "p." + span(prefix, refEnd) + "delins" + proteinName(inserted)
+	}
+}
+
+// hgvsCoding formats the c. (or n. for non-coding transcripts) notation
+func (ca *ConsequenceAnnotator) hgvsCoding(tx *transcriptModel, v *variant) string {
+	prefix := "c."
+	if len(tx.cds) == 0 {
+		prefix = "n."
+	}
+
+	ref, alt := v.ref, v.alt
+	if tx.strand == "-" {
+		ref, alt = reverseComplement(ref), reverseComplement(alt)
+	}
+
+	// Positions in transcript orientation
+	position := func(g uint64) string { return transcriptPosition(tx, g) }
+	rangeOf := func(first, last uint64) string {
+		if first == last {
+			return position(first)
+		}
+		if tx.strand == "-" {
+			first, last = last, first
+		}
+		return position(first) + "_" + position(last)
+	}
+
+	switch {
+	case v.isInsertion():
+		if v.start == 0 {
+			return ""
+		}
+		// Duplication of the bases immediately 5' in the transcript
+		length := uint64(len(v.alt))
+		dupStart := v.start
+		if tx.strand != "-" {
+			dupStart = max(v.start, length) - length
+		}
+		if v.refBases(dupStart, dupStart+length) == v.alt {
+			return prefix + rangeOf(dupStart, dupStart+length-1) + "dup"
+		}
+		return prefix + rangeOf(v.start-1, v.start) + "ins" + alt
+	case v.alt == "":
+		return prefix + rangeOf(v.start, v.end-1) + "del"
+	case len(ref) == 1 && len(alt) == 1:
+		return prefix + position(v.start) + ref + ">" + alt
+	default:
+		return prefix + rangeOf(v.start, v.end-1) + "delins" + alt
+	}
+}
+
+// transcriptPosition maps a genomic position inside a transcript to HGVS
+// c./n. coordinates: 123, -15 (5' UTR), *40 (3' UTR), 88+5 / 89-12 (intron)
+func transcriptPosition(tx *transcriptModel, g uint64) string {
+	// Exonic offset from the transcript's 5' end
+	exonicIndex := func(g uint64) (int, bool) {
+		index := 0
+		for _, exon := range tx.exons {
+			if g >= exon[0] && g <= exon[1] {
+				return index + int(g-exon[0]), true
+			}
+			index += int(exon[1] - exon[0] + 1)
+		}
+		return 0, false
+	}
+	total := 0
+	for _, exon := range tx.exons {
+		total += int(exon[1] - exon[0] + 1)
+	}
+
+	format := func(g uint64) string {
+		index, _ := exonicIndex(g)
+		if tx.strand == "-" {
+			index = total - 1 - index
+		}
+		if len(tx.cds) == 0 {
+			return strconv.Itoa(index + 1)
+		}
+
+		cdsStartGenomic, cdsEndGenomic := tx.cds[0][0], tx.cds[len(tx.cds)-1][1]
+		if tx.strand == "-" {
+			cdsStartGenomic, cdsEndGenomic = cdsEndGenomic, cdsStartGenomic
+		}
+		cdsStart, _ := exonicIndex(cdsStartGenomic)
+		cdsEnd, _ := exonicIndex(cdsEndGenomic)
+		if tx.strand == "-" {
+			cdsStart, cdsEnd = total-1-cdsStart, total-1-cdsEnd
+		}
+
+		switch {
+		case index < cdsStart:
+			return "-" + strconv.Itoa(cdsStart-index)
+		case index > cdsEnd:
+			return "*" + strconv.Itoa(index-cdsEnd)
+		}
+		return strconv.Itoa(index - cdsStart + 1)
+	}
+
+	if _, ok := exonicIndex(g); ok {
+		return format(g)
+	}
+
+	// Intronic: offset from the nearest exon boundary, in transcript orientation
+	for i := 0; i+1 < len(tx.exons); i++ {
+		left, right := tx.exons[i][1], tx.exons[i+1][0]
+		if g <= left || g >= right {
+			continue
+		}
+		fromLeft, fromRight := g-left, right-g
+		if tx.strand == "-" {
+			if fromRight <= fromLeft {
+				return format(right) + "+" + strconv.FormatUint(fromRight, 10)
+			}
+			return format(left) + "-" + strconv.FormatUint(fromLeft, 10)
+		}
+		if fromLeft <= fromRight {
+			return format(left) + "+" + strconv.FormatUint(fromLeft, 10)
+		}
+		return format(right) + "-" + strconv.FormatUint(fromRight, 10)
+	}
+	return "?"
+}
+
+// consequenceMutationType maps an SO term to the MutationType enum
+func consequenceMutationType(term string) MutationType {
+	switch term {
+	case "missense_variant":
+		return MutationMissense
+	case "stop_lost":
+		return MutationStopLost
+	case "start_lost":
+		return MutationStartLost
+	case "stop_gained":
+		return MutationNonsense
+	case "frameshift_variant":
+		return MutationFrameshift
+	case "splice_acceptor_variant", "splice_donor_variant", "splice_region_variant":
+		return MutationSplice
+	case "inframe_insertion", "inframe_deletion":
+		return MutationInframe
+	case "synonymous_variant", "stop_retained_variant":
+		return MutationSynonymous
+	case "5_prime_UTR_variant", "3_prime_UTR_variant":
+		return MutationUTR
+	case "intron_variant":
+		return MutationIntronic
+	case "upstream_gene_variant", "downstream_gene_variant", "intergenic_variant":
+		return MutationIntergenic
+	default:
+		return MutationUnknown
+	}
+}
+
+// commonPrefix returns the length of the shared prefix
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// codonTable is the standard genetic code
+var codonTable = func() map[string]byte {
+	const bases = "TCAG"
+	const aminoAcids = "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"
+	table := make(map[string]byte, 64)
+	for i := 0; i < 64; i++ {
+		codon := string([]byte{bases[i/16], bases[i/4%4], bases[i%4]})
+		table[codon] = aminoAcids[i]
+	}
+	return table
+}()
+
+// translate translates complete codons; unknown codons become 'X'
+func translate(seq string) string {
+	protein := make([]byte, 0, len(seq)/3)
+	for i := 0; i+3 <= len(seq); i += 3 {
+		aa, ok := codonTable[seq[i:i+3]]
+		if !ok {
+			aa = 'X'
+		}
+		protein = append(protein, aa)
+	}
+	return string(protein)
+}
+
+// aminoAcidNames maps one-letter codes to HGVS three-letter codes
+var aminoAcidNames = map[byte]string{
+	'A': "Ala", 'R': "Arg", 'N': "Asn", 'D': "Asp", 'C': "Cys", 'Q': "Gln", 'E': "Glu",
+	'G': "Gly", 'H': "His", 'I': "Ile", 'L': "Leu", 'K': "Lys", 'M': "Met", 'F': "Phe",
+	'P': "Pro", 'S': "Ser", 'T': "Thr", 'W': "Trp", 'Y': "Tyr", 'V': "Val", '*': "Ter",
+}
+
+// aminoAcidName returns the three-letter code of an amino acid
+func aminoAcidName(aa byte) string {
+	if name, ok := aminoAcidNames[aa]; ok {
+		return name
+	}
+	return "Xaa"
+}
+
+// proteinName converts a one-letter peptide to three-letter codes
+func proteinName(peptide string) string {
+	var sb strings.Builder
+	for i := 0; i < len(peptide); i++ {
+		sb.WriteString(aminoAcidName(peptide[i]))
+	}
+	return sb.String()
+}
+
+// reverseComplement returns the reverse complement of a DNA sequence
+func reverseComplement(seq string) string {
+	rc := make([]byte, len(seq))
+	for i := 0; i < len(seq); i++ {
+		var c byte
+		switch seq[len(seq)-1-i] {
+		case 'A':
+			c = 'T'
+		case 'T':
+			c = 'A'
+		case 'G':
+			c = 'C'
+		case 'C':
+			c = 'G'
+		default:
+			c = 'N'
+		}
+		rc[i] = c
+	}
+	return string(rc)
+}
@@ -0,0 +1,159 @@
+package mutations
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"genomevedic/internal/annotations"
+	"genomevedic/internal/reference"
+)
+
+// Test transcript: a 10 nt 5' UTR, a 45 nt CDS split c.20/c.21 by a
+// 100 nt intron, and a 21 nt 3' UTR
+//
+//	ATG GAA CGC AAA TGG CTG GGT CAG TTC GAC CCA TAC AGC CTG TAA
+//	Met Glu Arg Lys Trp Leu Gly Gln Phe Asp Pro Tyr Ser Leu Ter
+const (
+	testCDS    = "ATGGAACGCAAATGGCTGGGTCAGTTCGACCCATACAGCCTGTAA"
+	testUTR3   = "GGCTTCTGACCCGGGAAATTT"
+	testLength = 400
+)
+
+// testFeature is a GTF feature of the test transcript (1-based, inclusive)
+type testFeature struct {
+	feature    string
+	start, end int
+}
+
+// testGenome builds a chromosome holding the test transcript on the plus
+// strand (exons at 1-based 101-130 and 231-276) and its GTF features
+func testGenome() (string, []testFeature) {
+	rng := rand.New(rand.NewSource(3))
+	random := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "ACGT"[rng.Intn(4)]
+		}
+		return string(b)
+	}
+
+	seq := random(100) + random(10) + testCDS[:20] + "GT" + random(96) + "AG" + testCDS[20:] + testUTR3
+	seq += random(testLength - len(seq))
+
+	return seq, []testFeature{
+		{"transcript", 101, 276},
+		{"exon", 101, 130},
+		{"exon", 231, 276},
+		{"CDS", 111, 130},
+		{"CDS", 231, 252},
+		{"stop_codon", 253, 255},
+	}
+}
+
+// testAnnotator writes the transcript on chromosome 1 (plus strand) and
+// mirrored on chromosome 2 (minus strand). The FASTA names them "chr1"
+// and "2", the GTF "1" and "chr2".
+func testAnnotator(t *testing.T) *ConsequenceAnnotator {
+	t.Helper()
+	seq, features := testGenome()
+
+	dir := t.TempDir()
+	fasta := ">chr1\n" + seq + "\n>2\n" + reverseComplement(seq) + "\n"
+	path := filepath.Join(dir, "genome.fa")
+	if err := os.WriteFile(path, []byte(fasta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ref.Close() })
+
+	var gtf strings.Builder
+	attributes := "gene_id \"G%[4]d\"; transcript_id \"T%[4]d\"; gene_name \"GENE%[4]d\";"
+	for _, f := range features {
+		fmt.Fprintf(&gtf, "1\ttest\t%s\t%d\t%d\t.\t+\t.\t"+attributes+"\n", f.feature, f.start, f.end, 1)
+		fmt.Fprintf(&gtf, "chr2\ttest\t%s\t%d\t%d\t.\t-\t.\t"+attributes+"\n",
+			f.feature, testLength+1-f.end, testLength+1-f.start, 2)
+	}
+	genes := annotations.NewGTFParser(0)
+	if err := genes.ParseFile(strings.NewReader(gtf.String())); err != nil {
+		t.Fatal(err)
+	}
+	return NewConsequenceAnnotator(genes, ref)
+}
+
+// TestConsequencePrediction classifies and names coding changes on both
+// strands, given chromosome names with or without the "chr" prefix
+func TestConsequencePrediction(t *testing.T) {
+	annotator := testAnnotator(t)
+
+	tests := []struct {
+		name     string
+		position uint64 // Plus-strand VCF coordinates
+		ref, alt string
+		hgvsc    string
+		hgvsp    string
+		term     string
+		kind     MutationType
+	}{
+		{"missense", 117, "C", "T", "c.7C>T", "p.Arg3Cys", "missense_variant", MutationMissense},
+		{"frameshift", 114, "GA", "G", "c.6del", "p.Glu2AspfsTer?", "frameshift_variant", MutationFrameshift},
+		{"stop gained", 125, "G", "A", "c.15G>A", "p.Trp5Ter", "stop_gained", MutationNonsense},
+		{"duplication", 122, "A", "AAAA", "c.10_12dup", "p.Lys4dup", "inframe_insertion", MutationInframe},
+		{"stop lost", 253, "T", "C", "c.43T>C", "p.Ter15GlnextTer?", "stop_lost", MutationStopLost},
+		{"start lost", 112, "T", "C", "c.2T>C", "p.Met1?", "start_lost", MutationStartLost},
+		{"synonymous", 119, "C", "T", "c.9C>T", "p.Arg3=", "synonymous_variant", MutationSynonymous},
+	}
+
+	for _, tt := range tests {
+		// Mirror the change onto the minus-strand copy
+		minus := &Mutation{
+			Chromosome: "chr2",
+			Position:   testLength - tt.position - uint64(len(tt.ref)) + 2,
+			RefAllele:  reverseComplement(tt.ref),
+			AltAllele:  reverseComplement(tt.alt),
+		}
+		plus := &Mutation{Chromosome: "1", Position: tt.position, RefAllele: tt.ref, AltAllele: tt.alt}
+		if tt.position%2 == 0 { // Alternate spellings
+			plus.Chromosome, minus.Chromosome = "chr1", "2"
+		}
+
+		for strand, m := range map[string]*Mutation{"+": plus, "-": minus} {
+			effects, err := annotator.Predict(m)
+			if err != nil {
+				t.Errorf("%s (%s): %v", tt.name, strand, err)
+				continue
+			}
+			effect := effects[0]
+			if effect.HGVSc != tt.hgvsc || effect.HGVSp != tt.hgvsp || effect.Consequence() != tt.term || effect.MutationType != tt.kind {
+				t.Errorf("%s (%s): got %s %s %s %s, want %s %s %s %s", tt.name, strand,
+					effect.HGVSc, effect.HGVSp, effect.Consequence(), effect.MutationType,
+					tt.hgvsc, tt.hgvsp, tt.term, tt.kind)
+			}
+			if effect.Strand != strand || effect.GeneName == "" {
+				t.Errorf("%s (%s): unexpected transcript %+v", tt.name, strand, effect)
+			}
+		}
+	}
+
+	// Annotate records the most severe effect on the mutation
+	m := &Mutation{Chromosome: "chr1", Position: 117, RefAllele: "C", AltAllele: "T"}
+	if _, err := annotator.Annotate(m); err != nil || m.HGVSp != "T1:p.Arg3Cys" || m.Gene != "GENE1" {
+		t.Errorf("Annotate: %+v, %v", m, err)
+	}
+
+	for _, bad := range []*Mutation{
+		{Chromosome: "chr1", Position: 117, RefAllele: "G", AltAllele: "T"}, // REF mismatch
+		{Chromosome: "chr3", Position: 117, RefAllele: "C", AltAllele: "T"}, // Unknown chromosome
+		{Chromosome: "1", Position: 400, RefAllele: "AC", AltAllele: "A"},   // Past the end
+	} {
+		if _, err := annotator.Predict(bad); err == nil {
+			t.Errorf("Expected error for %s:%d %s>%s", bad.Chromosome, bad.Position, bad.RefAllele, bad.AltAllele)
+		}
+	}
+}
@@ -16,6 +16,8 @@ import (
 	"io"
 	"strconv"
 	"strings"
+
+	"genomevedic/internal/interval"
 )
 
 // MutationType represents the type of genomic mutation
@@ -29,6 +31,11 @@ const (
 	MutationSplice
 	MutationInframe
 	MutationSynonymous
+	MutationUTR
+	MutationIntronic
+	MutationIntergenic
+	MutationStopLost
+	MutationStartLost
 )
 
 func (mt MutationType) String() string {
@@ -45,6 +52,16 @@ func (mt MutationType) String() string {
 		return "Inframe"
 	case MutationSynonymous:
 		return "Synonymous"
+	case MutationUTR:
+		return "UTR"
+	case MutationIntronic:
+		return "Intronic"
+	case MutationIntergenic:
+		return "Intergenic"
+	case MutationStopLost:
+		return "Stop Lost"
+	case MutationStartLost:
+		return "Start Lost"
 	default:
 		return "Unknown"
 	}
@@ -90,12 +107,22 @@ type Mutation struct {
 	SampleCount  int
 	Significance Significance
 	Frequency    float64 // Frequency in population (0.0-1.0)
+	HGVSc        string  // e.g. "ENST00000269305:c.524G>A" (set by ConsequenceAnnotator)
+	HGVSp        string  // e.g. "ENST00000269305:p.Arg175His"
+}
+
+// End returns the last reference position covered by the mutation
+func (m *Mutation) End() uint64 {
+	if len(m.RefAllele) <= 1 || strings.HasPrefix(m.AltAllele, "<") {
+		return m.Position
+	}
+	return m.Position + uint64(len(m.RefAllele)) - 1
 }
 
 // COSMICParser parses COSMIC mutation database files
 type COSMICParser struct {
 	mutations      []*Mutation
-	mutationByPos  map[string][]*Mutation // Key: "chr:position"
+	index          *interval.Index[*Mutation] // Spans the reference allele
 	hotspots       []*Mutation
 	hotspotThresh  int // Minimum sample count for hotspot
 }
@@ -104,7 +131,7 @@ type COSMICParser struct {
 func NewCOSMICParser(hotspotThreshold int) *COSMICParser {
 	return &COSMICParser{
 		mutations:     make([]*Mutation, 0, 100000),
-		mutationByPos: make(map[string][]*Mutation),
+		index:         interval.New[*Mutation](),
 		hotspots:      make([]*Mutation, 0, 1000),
 		hotspotThresh: hotspotThreshold,
 	}
@@ -142,6 +169,36 @@ func (cp *COSMICParser) ParseFile(reader io.Reader) error {
 	return nil
 }
 
+// ParseVCF parses a VCF stream (COSMIC, ClinVar or caller output).
+// Multi-allelic records yield one mutation per ALT allele.
+func (cp *COSMICParser) ParseVCF(reader io.Reader) error {
+	vr, err := NewVCFReader(reader)
+	if err != nil {
+		return err
+	}
+	return cp.LoadVCF(vr)
+}
+
+// LoadVCF adds every remaining record of an open VCF reader, such as one
+// restricted to a region with Query
+func (cp *COSMICParser) LoadVCF(vr *VCFReader) error {
+	for {
+		record, err := vr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for _, mutation := range record.Mutations() {
+			cp.addMutation(mutation)
+		}
+	}
+
+	cp.identifyHotspots()
+	return nil
+}
+
 // parseLine parses a single line from COSMIC database
 // Format: Chromosome\tPosition\tRef\tAlt\tType\tGene\tSamples\tSignificance\tFrequency
 func (cp *COSMICParser) parseLine(line string, lineNum int) (*Mutation, error) {
@@ -194,9 +251,8 @@ func (cp *COSMICParser) parseLine(line string, lineNum int) (*Mutation, error) {
 func (cp *COSMICParser) addMutation(mut *Mutation) {
 	cp.mutations = append(cp.mutations, mut)
 
-	// Add to position index
-	key := fmt.Sprintf("%s:%d", mut.Chromosome, mut.Position)
-	cp.mutationByPos[key] = append(cp.mutationByPos[key], mut)
+	// Add to interval index (deletions cover every deleted base)
+	cp.index.Add(mut.Chromosome, mut.Position, mut.End(), mut)
 }
 
 // identifyHotspots identifies mutation hotspots (high sample count)
@@ -225,10 +281,22 @@ func (cp *COSMICParser) GetHotspots() []*Mutation {
 	return cp.hotspots
 }
 
-// GetMutationsAtPosition returns mutations at a specific position
+// GetMutationsAtPosition returns mutations overlapping a specific position
 func (cp *COSMICParser) GetMutationsAtPosition(chromosome string, position uint64) []*Mutation {
-	key := fmt.Sprintf("%s:%d", chromosome, position)
-	return cp.mutationByPos[key]
+	return cp.index.At(chromosome, position)
+}
+
+// GetMutationsInRange returns mutations overlapping [start, end] (inclusive),
+// ordered by position
+func (cp *COSMICParser) GetMutationsInRange(chromosome string, start, end uint64) []*Mutation {
+	return cp.index.Overlapping(chromosome, start, end)
+}
+
+// GetNearestMutations returns the mutations closest to a position and their
+// distance in base pairs
+func (cp *COSMICParser) GetNearestMutations(chromosome string, position uint64) ([]*Mutation, uint64) {
+	mutations, distance, _ := cp.index.Nearest(chromosome, position, nil)
+	return mutations, distance
 }
 
 // GetStatistics returns mutation statistics
@@ -275,12 +343,22 @@ func parseMutationType(typeStr string) MutationType {
 		return MutationNonsense
 	case "frameshift", "frameshift_variant":
 		return MutationFrameshift
-	case "splice", "splice_site":
+	case "splice", "splice_site", "splice_acceptor_variant", "splice_donor_variant":
 		return MutationSplice
 	case "inframe", "inframe_insertion", "inframe_deletion":
 		return MutationInframe
 	case "synonymous", "synonymous_variant":
 		return MutationSynonymous
+	case "utr", "5_prime_utr_variant", "3_prime_utr_variant":
+		return MutationUTR
+	case "intronic", "intron_variant":
+		return MutationIntronic
+	case "intergenic", "intergenic_variant", "upstream_gene_variant", "downstream_gene_variant":
+		return MutationIntergenic
+	case "stop_lost", "nonstop_extension":
+		return MutationStopLost
+	case "start_lost", "start_codon_lost":
+		return MutationStartLost
 	default:
 		return MutationUnknown
 	}
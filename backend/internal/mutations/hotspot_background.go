@@ -0,0 +1,414 @@
+/**
+ * Background-Aware Hotspot Scan
+ *
+ * The fixed-window detector compares every window against one genome-wide
+ * Poisson rate, so long or highly mutated genes look "significant" simply
+ * because they collect more mutations. This mode instead:
+ *
+ * 1. Assigns each mutation to a background unit: the gene it falls in (when
+ *    annotations are supplied) or a fixed-size genomic block
+ * 2. Scans windows of doubling width (1 bp up to the detector window size)
+ *    anchored at every mutated position
+ * 3. Tests each window against its unit's own rate: given n events in a unit
+ *    of length L, one of them at the anchor, the count of the other n-1 in a
+ *    window of width w is Binomial(n-1, w/L). The anchor placed the window,
+ *    so counting it as evidence would make every pair of nearby mutations
+ *    look significant.
+ * 4. Adjusts all window p-values with Benjamini-Hochberg and keeps the best
+ *    non-overlapping windows below the FDR threshold
+ *
+ * Events are mutation sample counts (at least one per mutation), so a
+ * recurrent position counts once per sample.
+ */
+
+package mutations
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"genomevedic/internal/annotations"
+)
+
+const (
+	defaultBackgroundBlock = 1000000
+	defaultFDR             = 0.05
+)
+
+// backgroundUnit is a gene or genomic block with its own mutation rate
+type backgroundUnit struct {
+	name       string
+	gene       string
+	chromosome string
+	start      uint64 // 1-based inclusive
+	end        uint64
+	mutations  []*Mutation
+	events     int
+}
+
+// windowTest is one scanned window and its test result
+type windowTest struct {
+	unit       *backgroundUnit
+	start, end uint64
+	first      int // Index range into unit.mutations
+	last       int
+	events     int
+	expected   float64
+	pvalue     float64
+	qvalue     float64
+}
+
+// SetBackgroundModel switches DetectHotspots to the background-aware scan.
+// Mutations inside a gene of genes use that gene's rate; the rest (or all
+// mutations, when genes is nil) use blocks of blockSize bp. Hotspots are
+// reported when their Benjamini-Hochberg q-value is at most fdr. Zero
+// blockSize or fdr selects the defaults (1 Mb, 0.05).
+func (hd *HotspotDetector) SetBackgroundModel(genes *annotations.GTFParser, blockSize uint64, fdr float64) {
+	if blockSize == 0 {
+		blockSize = defaultBackgroundBlock
+	}
+	if fdr <= 0 || fdr > 1 {
+		fdr = defaultFDR
+	}
+	hd.genes = genes
+	hd.blockSize = blockSize
+	hd.fdr = fdr
+	hd.backgroundMode = true
+
+	hd.geneChromosomes = make(map[string]bool)
+	if genes != nil {
+		for _, feature := range genes.GetFeatures() {
+			if feature.Type == annotations.FeatureGene {
+				hd.geneChromosomes[feature.Chromosome] = true
+			}
+		}
+	}
+}
+
+// detectWithBackground runs the background-aware scan
+func (hd *HotspotDetector) detectWithBackground() []*Hotspot {
+	units := hd.assignBackgroundUnits()
+
+	var tests []*windowTest
+	for _, unit := range units {
+		tests = append(tests, hd.scanUnit(unit)...)
+	}
+	adjustBenjaminiHochberg(tests)
+
+	// Best windows first; drop any overlapping a better one
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].qvalue != tests[j].qvalue {
+			return tests[i].qvalue < tests[j].qvalue
+		}
+		if tests[i].pvalue != tests[j].pvalue {
+			return tests[i].pvalue < tests[j].pvalue
+		}
+		return tests[i].end-tests[i].start < tests[j].end-tests[j].start
+	})
+
+	accepted := make(map[string][]*windowTest)
+	hotspots := make([]*Hotspot, 0, 10)
+	for _, test := range tests {
+		if test.qvalue > hd.fdr {
+			break
+		}
+		windowMutations := test.unit.mutations[test.first : test.last+1]
+		totalSamples := hd.countSamples(windowMutations)
+		if len(windowMutations) < hd.minMutations || totalSamples < hd.minSamples {
+			continue
+		}
+
+		chrom := test.unit.chromosome
+		overlaps := false
+		for _, other := range accepted[chrom] {
+			if test.start <= other.end && other.start <= test.end {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		accepted[chrom] = append(accepted[chrom], test)
+
+		primaryGene := test.unit.gene
+		if primaryGene == "" {
+			primaryGene = hd.findPrimaryGene(windowMutations)
+		}
+		hotspots = append(hotspots, &Hotspot{
+			Chromosome:        chrom,
+			StartPosition:     test.start,
+			EndPosition:       test.end,
+			MutationCount:     len(windowMutations),
+			TotalSamples:      totalSamples,
+			PrimaryGene:       primaryGene,
+			Mutations:         windowMutations,
+			SignificanceScore: math.Min(-math.Log10(math.Max(test.qvalue, math.SmallestNonzeroFloat64)), 10), // Cap at 10
+			PValue:            test.pvalue,
+			QValue:            test.qvalue,
+			ExpectedEvents:    test.expected,
+			Background:        test.unit.name,
+		})
+	}
+
+	hd.testedWindows = len(tests)
+	return hotspots
+}
+
+// assignBackgroundUnits groups mutations by gene or genomic block
+func (hd *HotspotDetector) assignBackgroundUnits() []*backgroundUnit {
+	units := make(map[string]*backgroundUnit)
+	var order []string
+
+	for _, mut := range hd.parser.GetMutations() {
+		if mut.Position == 0 {
+			continue
+		}
+
+		var unit *backgroundUnit
+		if gene := hd.backgroundGene(mut); gene != nil {
+			key := "gene:" + gene.Chromosome + ":" + gene.GeneID + ":" + gene.GeneName
+			if unit = units[key]; unit == nil {
+				name := gene.GeneName
+				if name == "" {
+					name = gene.GeneID
+				}
+				unit = &backgroundUnit{
+					name:       name,
+					gene:       name,
+					chromosome: mut.Chromosome,
+					start:      gene.Start,
+					end:        gene.End,
+				}
+				units[key] = unit
+				order = append(order, key)
+			}
+		} else {
+			start := (mut.Position-1)/hd.blockSize*hd.blockSize + 1
+			key := fmt.Sprintf("block:%s:%d", mut.Chromosome, start)
+			if unit = units[key]; unit == nil {
+				unit = &backgroundUnit{
+					name:       fmt.Sprintf("%s:%d-%d", mut.Chromosome, start, start+hd.blockSize-1),
+					chromosome: mut.Chromosome,
+					start:      start,
+					end:        start + hd.blockSize - 1,
+				}
+				units[key] = unit
+				order = append(order, key)
+			}
+		}
+
+		unit.mutations = append(unit.mutations, mut)
+		unit.events += mutationEvents(mut)
+	}
+
+	result := make([]*backgroundUnit, 0, len(order))
+	for _, key := range order {
+		unit := units[key]
+		sort.Slice(unit.mutations, func(i, j int) bool {
+			return unit.mutations[i].Position < unit.mutations[j].Position
+		})
+		result = append(result, unit)
+	}
+	return result
+}
+
+// backgroundGene returns the gene whose rate applies to a mutation: the
+// overlapping gene named by the mutation if any, else the shortest one
+func (hd *HotspotDetector) backgroundGene(mut *Mutation) *annotations.GenomicFeature {
+	if hd.genes == nil {
+		return nil
+	}
+	chromosome := matchChromosome(mut.Chromosome, hd.geneChromosomes)
+
+	var best *annotations.GenomicFeature
+	for _, feature := range hd.genes.GetFeaturesAtPosition(chromosome, mut.Position) {
+		if feature.Type != annotations.FeatureGene {
+			continue
+		}
+		if mut.Gene != "" && (feature.GeneName == mut.Gene || feature.GeneID == mut.Gene) {
+			return feature
+		}
+		if best == nil || feature.End-feature.Start < best.End-best.Start {
+			best = feature
+		}
+	}
+	return best
+}
+
+// scanUnit tests windows of doubling width anchored at each mutated position
+func (hd *HotspotDetector) scanUnit(unit *backgroundUnit) []*windowTest {
+	length := float64(unit.end - unit.start + 1)
+	if unit.events == 0 {
+		return nil
+	}
+
+	maxWidth := max(hd.windowSize, 1)
+	var widths []uint64
+	for width := uint64(1); ; width *= 2 {
+		width = min(width, maxWidth)
+		widths = append(widths, width)
+		if width == maxWidth {
+			break
+		}
+	}
+
+	tests := make([]*windowTest, 0, len(unit.mutations)*len(widths))
+	for first, mut := range unit.mutations {
+		if first > 0 && unit.mutations[first-1].Position == mut.Position {
+			continue
+		}
+		for _, width := range widths {
+			start := mut.Position
+			end := min(start+width-1, unit.end)
+
+			events, last := 0, first
+			for j := first; j < len(unit.mutations) && unit.mutations[j].Position <= end; j++ {
+				events += mutationEvents(unit.mutations[j])
+				last = j
+			}
+
+			// Condition on the anchor event: only the others are evidence
+			fraction := math.Min(float64(end-start+1)/length, 1)
+			tests = append(tests, &windowTest{
+				unit:     unit,
+				start:    start,
+				end:      end,
+				first:    first,
+				last:     last,
+				events:   events,
+				expected: 1 + float64(unit.events-1)*fraction,
+				pvalue:   binomialUpperTail(events-1, unit.events-1, fraction),
+			})
+
+			if end == unit.end {
+				break
+			}
+		}
+	}
+	return tests
+}
+
+// mutationEvents is the number of observations a mutation contributes
+func mutationEvents(mut *Mutation) int {
+	return max(mut.SampleCount, 1)
+}
+
+// adjustBenjaminiHochberg sets q-values from p-values across all tests
+func adjustBenjaminiHochberg(tests []*windowTest) {
+	pvalues := make([]float64, len(tests))
+	for i, test := range tests {
+		pvalues[i] = test.pvalue
+	}
+	for i, q := range benjaminiHochberg(pvalues) {
+		tests[i].qvalue = q
+	}
+}
+
+// benjaminiHochberg returns the BH-adjusted q-value of each p-value:
+// q(i) = min over ranks j >= rank(i) of p(j) * m / j
+func benjaminiHochberg(pvalues []float64) []float64 {
+	m := len(pvalues)
+	order := make([]int, m)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return pvalues[order[i]] < pvalues[order[j]] })
+
+	qvalues := make([]float64, m)
+	running := 1.0
+	for rank := m - 1; rank >= 0; rank-- {
+		i := order[rank]
+		running = math.Min(running, pvalues[i]*float64(m)/float64(rank+1))
+		qvalues[i] = running
+	}
+	return qvalues
+}
+
+// binomialUpperTail returns P(X >= k) for X ~ Binomial(n, p)
+func binomialUpperTail(k, n int, p float64) float64 {
+	switch {
+	case k <= 0:
+		return 1
+	case k > n || p <= 0:
+		return 0
+	case p >= 1:
+		return 1
+	}
+	return regularizedBeta(p, float64(k), float64(n-k+1))
+}
+
+// regularizedBeta evaluates the regularized incomplete beta function I_x(a, b)
+func regularizedBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log1p(-x))
+
+	// The continued fraction converges fastest below the mean
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+// betaContinuedFraction evaluates the incomplete beta continued fraction
+// with the modified Lentz method
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		// Even step
+		numerator := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		// Odd step
+		numerator = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,106 @@
+package mutations
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// uniformDetector scatters n single-sample mutations uniformly over 1 Mb
+// of chr1, plus any planted ones, in a background-aware detector
+func uniformDetector(rng *rand.Rand, n int, planted ...uint64) *HotspotDetector {
+	parser := NewCOSMICParser(10)
+	add := func(position uint64) {
+		parser.addMutation(&Mutation{Chromosome: "chr1", Position: position, RefAllele: "C", AltAllele: "T", SampleCount: 1})
+	}
+	for i := 0; i < n; i++ {
+		add(uint64(1 + rng.Intn(1000000)))
+	}
+	for _, position := range planted {
+		add(position)
+	}
+
+	detector := NewHotspotDetector(parser, 100, 2, 1)
+	detector.SetBackgroundModel(nil, 0, 0.05)
+	return detector
+}
+
+// TestBackgroundNullCalibration checks that uniformly scattered mutations
+// rarely yield hotspots: the anchor of each window is not evidence
+func TestBackgroundNullCalibration(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	const runs = 40
+	withHotspots := 0
+	for run := 0; run < runs; run++ {
+		hotspots, err := uniformDetector(rng, 300).DetectHotspots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hotspots) > 0 {
+			withHotspots++
+		}
+	}
+	// Under the global null the FDR bounds the chance of any discovery
+	if withHotspots > 4 {
+		t.Errorf("%d of %d null runs reported hotspots", withHotspots, runs)
+	}
+}
+
+// TestBackgroundPlantedHotspot recovers a dense cluster among uniform noise
+func TestBackgroundPlantedHotspot(t *testing.T) {
+	rng := rand.New(rand.NewSource(12))
+	planted := []uint64{500010, 500012, 500012, 500015, 500020, 500021, 500030, 500040}
+	hotspots, err := uniformDetector(rng, 300, planted...).DetectHotspots()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Strong discoveries relax the BH threshold, so a stray pair may pass
+	// at q < 0.05, but never ahead of the planted cluster
+	var found *Hotspot
+	spurious := 0
+	for _, hs := range hotspots {
+		if hs.StartPosition <= 500040 && hs.EndPosition >= 500010 {
+			found = hs
+			continue
+		}
+		spurious++
+		if found == nil {
+			t.Errorf("Spurious hotspot %d-%d (q=%g) ranked above the planted one", hs.StartPosition, hs.EndPosition, hs.QValue)
+		}
+	}
+	if found == nil {
+		t.Fatalf("Planted hotspot not found among %d hotspots", len(hotspots))
+	}
+	if spurious > 1 {
+		t.Errorf("%d spurious hotspots alongside the planted one", spurious)
+	}
+	if found.MutationCount < 6 || found.QValue > 0.05 || found.Background != "chr1:1-1000000" {
+		t.Errorf("Unexpected hotspot %+v", found)
+	}
+	if found.SignificanceScore > 10 || found.SignificanceScore != math.Min(-math.Log10(found.QValue), 10) {
+		t.Errorf("Significance score %g not capped -log10(q) for q=%g", found.SignificanceScore, found.QValue)
+	}
+}
+
+// TestBinomialUpperTail checks the tail against direct summation
+func TestBinomialUpperTail(t *testing.T) {
+	for _, tc := range []struct {
+		k, n int
+		p    float64
+	}{{1, 299, 1e-4}, {3, 20, 0.1}, {7, 8, 0.5}, {0, 5, 0.3}, {6, 5, 0.3}} {
+		want := 0.0
+		for x := tc.k; x <= tc.n; x++ {
+			lc, _ := math.Lgamma(float64(tc.n + 1))
+			lx, _ := math.Lgamma(float64(x + 1))
+			ly, _ := math.Lgamma(float64(tc.n - x + 1))
+			want += math.Exp(lc - lx - ly + float64(x)*math.Log(tc.p) + float64(tc.n-x)*math.Log1p(-tc.p))
+		}
+		if tc.k <= 0 {
+			want = 1
+		}
+		if got := binomialUpperTail(tc.k, tc.n, tc.p); math.Abs(got-want) > 1e-10*math.Max(want, 1e-3) {
+			t.Errorf("P(X >= %d | %d, %g) = %g, want %g", tc.k, tc.n, tc.p, got, want)
+		}
+	}
+}
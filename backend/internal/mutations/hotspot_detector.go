@@ -8,6 +8,9 @@
  * 1. Window-based clustering (sliding window)
  * 2. Statistical significance (Poisson distribution)
  * 3. Rank by clinical impact score
+ *
+ * SetBackgroundModel enables per-gene / per-block background rates with
+ * variable-width windows and Benjamini-Hochberg q-values (hotspot_background.go).
  */
 
 package mutations
@@ -16,6 +19,8 @@ import (
 	"fmt"
 	"math"
 	"sort"
+
+	"genomevedic/internal/annotations"
 )
 
 // Hotspot represents a mutation hotspot region
@@ -27,8 +32,17 @@ type Hotspot struct {
 	TotalSamples    int
 	PrimaryGene     string
 	Mutations       []*Mutation
-	SignificanceScore float64 // Statistical significance (p-value)
+	SignificanceScore float64 // -log10 p-value, or -log10 BH q-value in background mode
 	ClinicalScore   float64 // Clinical impact score (0.0-1.0)
+
+	// Background mode only
+	PValue         float64 // Binomial p-value against the unit's own rate
+	QValue         float64 // Benjamini-Hochberg adjusted p-value
+	ExpectedEvents float64 // Expected sample events in the window
+	Background     string  // Gene or block supplying the background rate
+
+	// Cohort mode only: distinct samples carrying a mutation in the window
+	Samples []string
 }
 
 // HotspotDetector detects mutation hotspots
@@ -38,6 +52,16 @@ type HotspotDetector struct {
 	minMutations  int     // Minimum mutations for hotspot
 	minSamples    int     // Minimum total samples for hotspot
 	baselineRate  float64 // Baseline mutation rate (mutations per bp)
+
+	// Background-aware mode (see SetBackgroundModel)
+	backgroundMode  bool
+	genes           *annotations.GTFParser
+	geneChromosomes map[string]bool
+	blockSize       uint64  // Background block size when no gene applies
+	fdr             float64 // q-value threshold
+	testedWindows   int     // Windows tested in the last scan
+
+	cohort *CohortStore // Counts distinct carrier samples when set
 }
 
 // NewHotspotDetector creates a new hotspot detector
@@ -51,11 +75,62 @@ func NewHotspotDetector(parser *COSMICParser, windowSize uint64, minMutations in
 	}
 }
 
+// SetCohort makes hotspot sample counts the number of distinct cohort
+// samples carrying a mutation in the window (instead of the sum of
+// per-mutation counts) and lists those samples in Hotspot.Samples.
+// The detector's parser should come from cohort.Parser.
+func (hd *HotspotDetector) SetCohort(cohort *CohortStore) {
+	hd.cohort = cohort
+}
+
+// countSamples returns the sample support of a set of mutations
+func (hd *HotspotDetector) countSamples(mutations []*Mutation) int {
+	if hd.cohort == nil {
+		total := 0
+		for _, mut := range mutations {
+			total += mut.SampleCount
+		}
+		return total
+	}
+	return len(hd.carrierSamples(mutations))
+}
+
+// carrierSamples returns the distinct cohort samples carrying any mutation
+func (hd *HotspotDetector) carrierSamples(mutations []*Mutation) []string {
+	seen := make(map[string]bool)
+	samples := make([]string, 0, len(mutations))
+	for _, mut := range mutations {
+		carriers, _ := hd.cohort.CarriersOf(mut)
+		for _, sample := range carriers {
+			if !seen[sample] {
+				seen[sample] = true
+				samples = append(samples, sample)
+			}
+		}
+	}
+	sort.Strings(samples)
+	return samples
+}
+
 // DetectHotspots detects mutation hotspots
 func (hd *HotspotDetector) DetectHotspots() ([]*Hotspot, error) {
 	// Calculate baseline mutation rate
 	hd.computeBaselineRate()
 
+	if hd.backgroundMode {
+		hotspots := hd.detectWithBackground()
+		for _, hs := range hotspots {
+			if hd.cohort != nil {
+				hs.Samples = hd.carrierSamples(hs.Mutations)
+			}
+			hd.computeClinicalScore(hs)
+		}
+		sort.Slice(hotspots, func(i, j int) bool {
+			return hotspots[i].ClinicalScore > hotspots[j].ClinicalScore
+		})
+		return hotspots, nil
+	}
+
 	// Group mutations by chromosome
 	mutsByChrom := hd.groupMutationsByChromosome()
 
@@ -75,6 +150,9 @@ func (hd *HotspotDetector) DetectHotspots() ([]*Hotspot, error) {
 
 	// Compute statistical significance and clinical scores
 	for _, hs := range allHotspots {
+		if hd.cohort != nil {
+			hs.Samples = hd.carrierSamples(hs.Mutations)
+		}
 		hd.computeSignificance(hs)
 		hd.computeClinicalScore(hs)
 	}
@@ -128,12 +206,11 @@ func (hd *HotspotDetector) detectInChromosome(chrom string, mutations []*Mutatio
 
 		// Collect mutations in window
 		windowMutations := make([]*Mutation, 0, 20)
-		totalSamples := 0
 
 		for j := i; j < len(mutations) && mutations[j].Position <= windowEnd; j++ {
 			windowMutations = append(windowMutations, mutations[j])
-			totalSamples += mutations[j].SampleCount
 		}
+		totalSamples := hd.countSamples(windowMutations)
 
 		// Check if this is a hotspot
 		if len(windowMutations) >= hd.minMutations && totalSamples >= hd.minSamples {
@@ -249,6 +326,21 @@ func (hd *HotspotDetector) GetTopHotspots(hotspots []*Hotspot, n int) []*Hotspot
 
 // FormatHotspot returns a human-readable string for a hotspot
 func (hd *HotspotDetector) FormatHotspot(hs *Hotspot) string {
+	if hd.backgroundMode {
+		return fmt.Sprintf(
+			"Hotspot: %s:%d-%d | Gene: %s | Mutations: %d | Samples: %d | Clinical Score: %.3f | p-value: %.2e | q-value: %.2e | Background: %s",
+			hs.Chromosome,
+			hs.StartPosition,
+			hs.EndPosition,
+			hs.PrimaryGene,
+			hs.MutationCount,
+			hs.TotalSamples,
+			hs.ClinicalScore,
+			hs.PValue,
+			hs.QValue,
+			hs.Background,
+		)
+	}
 	return fmt.Sprintf(
 		"Hotspot: %s:%d-%d | Gene: %s | Mutations: %d | Samples: %d | Clinical Score: %.3f | p-value: %.2e",
 		hs.Chromosome,
@@ -283,6 +375,22 @@ func (hd *HotspotDetector) GetStatistics(hotspots []*Hotspot) map[string]interfa
 
 	avgClinicalScore /= float64(len(hotspots))
 
+	if hd.backgroundMode {
+		return map[string]interface{}{
+			"total_hotspots":     len(hotspots),
+			"total_mutations":    totalMutations,
+			"total_samples":      totalSamples,
+			"avg_clinical_score": avgClinicalScore,
+			"max_window_size":    hd.windowSize,
+			"min_mutations":      hd.minMutations,
+			"min_samples":        hd.minSamples,
+			"background_block":   hd.blockSize,
+			"gene_background":    hd.genes != nil,
+			"fdr":                hd.fdr,
+			"tested_windows":     hd.testedWindows,
+		}
+	}
+
 	return map[string]interface{}{
 		"total_hotspots":      len(hotspots),
 		"total_mutations":     totalMutations,
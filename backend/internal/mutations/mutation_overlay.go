@@ -10,6 +10,9 @@
  * - Yellow (Uncertain significance)
  * - Green (Benign)
  * - Default (No mutation)
+ *
+ * A ColorScheme (e.g. SBS6ColorScheme, SignatureColorScheme) replaces the
+ * significance colours for non-hotspot particles.
  */
 
 package mutations
@@ -35,6 +38,12 @@ var (
 	ColorHotspot           = MutationColor{R: 1.0, G: 0.0, B: 0.0, A: 1.0} // Bright Red (hotspot)
 )
 
+// ColorScheme assigns colours to individual mutations; false leaves the
+// significance colour in place
+type ColorScheme interface {
+	ColorFor(m *Mutation) (MutationColor, bool)
+}
+
 // ParticleMutation represents mutation data for a single particle
 type ParticleMutation struct {
 	Position     uint64
@@ -51,6 +60,7 @@ type MutationOverlay struct {
 	parser           *COSMICParser
 	particleMutations map[string]*ParticleMutation // Key: "chr:position"
 	hotspotRadius    uint64                        // Radius around hotspot to color
+	colorScheme      ColorScheme                   // Optional per-mutation colouring
 	mu               sync.RWMutex
 }
 
@@ -63,6 +73,14 @@ func NewMutationOverlay(parser *COSMICParser, hotspotRadius uint64) *MutationOve
 	}
 }
 
+// SetColorScheme colours non-hotspot particles with scheme (nil restores
+// significance colours). Takes effect on the next BuildOverlay.
+func (mo *MutationOverlay) SetColorScheme(scheme ColorScheme) {
+	mo.mu.Lock()
+	defer mo.mu.Unlock()
+	mo.colorScheme = scheme
+}
+
 // BuildOverlay builds the mutation overlay for all particles
 func (mo *MutationOverlay) BuildOverlay() error {
 	mo.mu.Lock()
@@ -108,13 +126,29 @@ func (mo *MutationOverlay) BuildOverlay() error {
 	return nil
 }
 
-// GetParticleMutation returns mutation data for a particle
+// GetParticleMutation returns mutation data for a particle. Positions inside
+// multi-base mutations (e.g. deletions) are resolved from the interval index.
 func (mo *MutationOverlay) GetParticleMutation(chromosome string, position uint64) *ParticleMutation {
 	mo.mu.RLock()
 	defer mo.mu.RUnlock()
 
 	key := fmt.Sprintf("%s:%d", chromosome, position)
-	return mo.particleMutations[key]
+	if pm, exists := mo.particleMutations[key]; exists {
+		return pm
+	}
+
+	overlapping := mo.parser.GetMutationsAtPosition(chromosome, position)
+	if len(overlapping) == 0 {
+		return nil
+	}
+	pm := &ParticleMutation{
+		Position:    position,
+		Chromosome:  chromosome,
+		HasMutation: true,
+		Mutations:   overlapping,
+	}
+	mo.computeParticleColor(pm)
+	return pm
 }
 
 // GetParticleColor returns the color for a particle based on mutations
@@ -168,6 +202,16 @@ func (mo *MutationOverlay) computeParticleColor(pm *ParticleMutation) {
 		default:
 			pm.Color = ColorUncertain
 		}
+
+		// Colour scheme: use the best-supported mutation it can colour
+		if mo.colorScheme != nil {
+			bestSamples := -1
+			for _, mut := range pm.Mutations {
+				if color, ok := mo.colorScheme.ColorFor(mut); ok && mut.SampleCount > bestSamples {
+					pm.Color, bestSamples = color, mut.SampleCount
+				}
+			}
+		}
 	}
 
 	// Adjust alpha based on sample count (higher sample count = more opaque)
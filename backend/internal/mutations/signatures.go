@@ -0,0 +1,922 @@
+/**
+ * Mutational Signatures (SBS96)
+ *
+ * Single-base substitutions are classified into the 96 trinucleotide
+ * channels used by COSMIC: six pyrimidine-referenced substitution classes
+ * (C>A, C>G, C>T, T>A, T>C, T>G) × 4 five-prime × 4 three-prime bases.
+ * Purine reference alleles are reverse-complemented with their context.
+ *
+ * - ComputeSpectrum / CohortStore.Spectra: per-sample 96-channel counts
+ * - FitSignatures: non-negative least squares refit of a spectrum against a
+ *   known signature matrix (e.g. COSMIC_v3.4_SBS_GRCh38.txt)
+ * - ExtractSignatures: de novo extraction with NMF (KL-divergence
+ *   multiplicative updates, best of several restarts)
+ * - SBS6ColorScheme / SignatureColorScheme: overlay colouring by
+ *   substitution class or by most likely signature
+ */
+
+package mutations
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"genomevedic/internal/reference"
+)
+
+// SBS96Channels are the channel labels in COSMIC order ("A[C>A]A", ...)
+var SBS96Channels = func() [96]string {
+	var labels [96]string
+	for i := range labels {
+		sub := sbs6Classes[i/16]
+		labels[i] = fmt.Sprintf("%c[%s]%c", "ACGT"[i/4%4], sub, "ACGT"[i%4])
+	}
+	return labels
+}()
+
+// sbs6Classes are the pyrimidine-referenced substitution classes
+var sbs6Classes = [6]string{"C>A", "C>G", "C>T", "T>A", "T>C", "T>G"}
+
+// Spectrum is the SBS96 mutation count profile of one sample
+type Spectrum struct {
+	Sample  string
+	Counts  [96]float64
+	Skipped int // Non-SNV mutations or SNVs without reference context
+}
+
+// Total returns the number of counted substitutions
+func (s *Spectrum) Total() float64 {
+	total := 0.0
+	for _, c := range s.Counts {
+		total += c
+	}
+	return total
+}
+
+// SBS6 collapses the spectrum to the six substitution classes
+func (s *Spectrum) SBS6() [6]float64 {
+	var classes [6]float64
+	for i, c := range s.Counts {
+		classes[i/16] += c
+	}
+	return classes
+}
+
+// SBS96Channel returns the channel index of a single-base substitution,
+// reading its trinucleotide context from ref
+func SBS96Channel(ref *reference.FASTA, m *Mutation) (int, error) {
+	if len(m.RefAllele) != 1 || len(m.AltAllele) != 1 {
+		return -1, fmt.Errorf("not a single-base substitution: %s:%d %s>%s", m.Chromosome, m.Position, m.RefAllele, m.AltAllele)
+	}
+	if m.Position < 2 {
+		return -1, fmt.Errorf("no trinucleotide context at %s:%d", m.Chromosome, m.Position)
+	}
+	context, err := ref.Fetch(m.Chromosome, int64(m.Position)-2, int64(m.Position)+1)
+	if err != nil {
+		return -1, fmt.Errorf("failed to fetch context for %s:%d: %w", m.Chromosome, m.Position, err)
+	}
+	refBase, altBase := strings.ToUpper(m.RefAllele)[0], strings.ToUpper(m.AltAllele)[0]
+	if len(context) != 3 || context[1] != refBase {
+		return -1, fmt.Errorf("REF %s does not match reference %s at %s:%d", m.RefAllele, context, m.Chromosome, m.Position)
+	}
+	return channelIndex(context, altBase)
+}
+
+// channelIndex maps a reference trinucleotide and alt base to a channel
+func channelIndex(context string, alt byte) (int, error) {
+	if context[1] == 'A' || context[1] == 'G' {
+		context = reverseComplement(context)
+		alt = reverseComplement(string(alt))[0]
+	}
+	five, three := strings.IndexByte("ACGT", context[0]), strings.IndexByte("ACGT", context[2])
+	class := -1
+	for i, sub := range sbs6Classes {
+		if sub[0] == context[1] && sub[2] == alt {
+			class = i
+		}
+	}
+	if five < 0 || three < 0 || class < 0 {
+		return -1, fmt.Errorf("invalid substitution %s>%c", context, alt)
+	}
+	return class*16 + five*4 + three, nil
+}
+
+// ComputeSpectrum counts the SNVs of one sample into SBS96 channels. Each
+// mutation counts once; others are tallied in Skipped.
+func ComputeSpectrum(sample string, mutations []*Mutation, ref *reference.FASTA) (*Spectrum, error) {
+	if ref == nil {
+		return nil, fmt.Errorf("SBS96 spectra require a reference genome")
+	}
+	spectrum := &Spectrum{Sample: sample}
+	for _, m := range mutations {
+		channel, err := SBS96Channel(ref, m)
+		if err != nil {
+			spectrum.Skipped++
+			continue
+		}
+		spectrum.Counts[channel]++
+	}
+	return spectrum, nil
+}
+
+// Spectra computes the SBS96 spectrum of every sample in the cohort
+func (cs *CohortStore) Spectra(ref *reference.FASTA) ([]*Spectrum, error) {
+	if ref == nil {
+		return nil, fmt.Errorf("SBS96 spectra require a reference genome")
+	}
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	spectra := make([]*Spectrum, len(cs.samples))
+	for i, name := range cs.samples {
+		spectra[i] = &Spectrum{Sample: name}
+	}
+	for v, carriers := range cs.carriers {
+		channel, err := SBS96Channel(ref, cs.variants[v])
+		for _, id := range carriers {
+			if err != nil {
+				spectra[id].Skipped++
+				continue
+			}
+			spectra[id].Counts[channel]++
+		}
+	}
+	return spectra, nil
+}
+
+// SignatureMatrix holds mutational signatures as SBS96 probability vectors
+type SignatureMatrix struct {
+	Names   []string
+	Weights [][96]float64 // Per signature, sums to 1
+}
+
+// LoadSignatureMatrix reads a signature matrix file (see ParseSignatureMatrix)
+func LoadSignatureMatrix(path string) (*SignatureMatrix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open signature matrix: %w", err)
+	}
+	defer f.Close()
+
+	matrix, err := ParseSignatureMatrix(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature matrix %s: %w", path, err)
+	}
+	return matrix, nil
+}
+
+// ParseSignatureMatrix reads a tab-separated signature matrix with one row
+// per channel and one column per signature. Channels are either a single
+// "A[C>A]A" column (COSMIC v3 "Type" column) or the COSMIC v2
+// "Substitution Type" + "Trinucleotide" column pair.
+func ParseSignatureMatrix(reader io.Reader) (*SignatureMatrix, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1<<20), 1<<24)
+
+	var header []string
+	var rows [][]string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if header == nil {
+			header = fields
+			continue
+		}
+		rows = append(rows, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read signature matrix: %w", err)
+	}
+	if header == nil || len(rows) == 0 {
+		return nil, fmt.Errorf("empty signature matrix")
+	}
+
+	// Label columns hold text, signature columns numbers
+	subCol, triCol, labelCol := -1, -1, -1
+	var sigCols []int
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		switch {
+		case strings.EqualFold(name, "Substitution Type"):
+			subCol = i
+		case strings.EqualFold(name, "Trinucleotide"):
+			triCol = i
+		case i < len(rows[0]) && isNumber(rows[0][i]):
+			sigCols = append(sigCols, i)
+		case labelCol < 0 && i < len(rows[0]) && strings.Contains(rows[0][i], "["):
+			labelCol = i
+		}
+	}
+	if len(sigCols) == 0 {
+		return nil, fmt.Errorf("no signature columns")
+	}
+
+	channels := make(map[string]int, 96)
+	for i, label := range SBS96Channels {
+		channels[label] = i
+	}
+
+	matrix := &SignatureMatrix{Weights: make([][96]float64, len(sigCols))}
+	for _, col := range sigCols {
+		matrix.Names = append(matrix.Names, strings.TrimSpace(header[col]))
+	}
+	seen := make([]bool, 96)
+	for line, row := range rows {
+		var label string
+		switch {
+		case subCol >= 0 && triCol >= 0 && subCol < len(row) && triCol < len(row):
+			sub, tri := strings.TrimSpace(row[subCol]), strings.TrimSpace(row[triCol])
+			if len(tri) != 3 {
+				return nil, fmt.Errorf("row %d: invalid trinucleotide %q", line+2, tri)
+			}
+			label = fmt.Sprintf("%c[%s]%c", tri[0], sub, tri[2])
+		case labelCol >= 0 && labelCol < len(row):
+			label = strings.TrimSpace(row[labelCol])
+		default:
+			return nil, fmt.Errorf("row %d: missing channel label", line+2)
+		}
+
+		channel, ok := channels[strings.ToUpper(label)]
+		if !ok {
+			return nil, fmt.Errorf("row %d: unknown SBS96 channel %q", line+2, label)
+		}
+		seen[channel] = true
+		for s, col := range sigCols {
+			if col >= len(row) {
+				return nil, fmt.Errorf("row %d: missing value for %s", line+2, matrix.Names[s])
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(row[col]), 64)
+			if err != nil || value < 0 {
+				return nil, fmt.Errorf("row %d: invalid value %q for %s", line+2, row[col], matrix.Names[s])
+			}
+			matrix.Weights[s][channel] = value
+		}
+	}
+	for channel, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("missing channel %s", SBS96Channels[channel])
+		}
+	}
+
+	for s := range matrix.Weights {
+		if !normalize(&matrix.Weights[s]) {
+			return nil, fmt.Errorf("signature %s is all zero", matrix.Names[s])
+		}
+	}
+	return matrix, nil
+}
+
+// Subset returns the named signatures, in the given order
+func (sm *SignatureMatrix) Subset(names []string) (*SignatureMatrix, error) {
+	subset := &SignatureMatrix{}
+	for _, name := range names {
+		i := indexOf(sm.Names, name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown signature: %s", name)
+		}
+		subset.Names = append(subset.Names, name)
+		subset.Weights = append(subset.Weights, sm.Weights[i])
+	}
+	return subset, nil
+}
+
+// WriteTo writes the matrix in COSMIC v3 TSV layout
+func (sm *SignatureMatrix) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	sb.WriteString("Type")
+	for _, name := range sm.Names {
+		sb.WriteString("\t" + name)
+	}
+	sb.WriteString("\n")
+	for channel, label := range SBS96Channels {
+		sb.WriteString(label)
+		for s := range sm.Names {
+			sb.WriteString("\t" + strconv.FormatFloat(sm.Weights[s][channel], 'g', 8, 64))
+		}
+		sb.WriteString("\n")
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// SignatureFit is the refit of one spectrum against known signatures
+type SignatureFit struct {
+	Sample           string
+	Signatures       []string
+	Exposures        []float64 // Mutations attributed to each signature
+	Contributions    []float64 // Exposure fractions (sum to 1)
+	Reconstructed    [96]float64
+	CosineSimilarity float64 // Between observed and reconstructed spectra
+	Residual         float64 // L2 norm of observed - reconstructed
+}
+
+// FitSignatures finds non-negative exposures minimising the squared error
+// between a spectrum and a combination of the matrix's signatures
+func FitSignatures(spectrum *Spectrum, matrix *SignatureMatrix) (*SignatureFit, error) {
+	if len(matrix.Names) == 0 {
+		return nil, fmt.Errorf("signature matrix is empty")
+	}
+
+	exposures := nnls(matrix.Weights, spectrum.Counts[:])
+	fit := &SignatureFit{
+		Sample:        spectrum.Sample,
+		Signatures:    append([]string(nil), matrix.Names...),
+		Exposures:     exposures,
+		Contributions: make([]float64, len(exposures)),
+	}
+
+	total := 0.0
+	for s, e := range exposures {
+		total += e
+		for c := range fit.Reconstructed {
+			fit.Reconstructed[c] += e * matrix.Weights[s][c]
+		}
+	}
+	if total > 0 {
+		for s, e := range exposures {
+			fit.Contributions[s] = e / total
+		}
+	}
+
+	residual := 0.0
+	for c, observed := range spectrum.Counts {
+		d := observed - fit.Reconstructed[c]
+		residual += d * d
+	}
+	fit.Residual = math.Sqrt(residual)
+	fit.CosineSimilarity = cosineSimilarity(spectrum.Counts[:], fit.Reconstructed[:])
+	return fit, nil
+}
+
+// nnls solves min ||A x - b|| subject to x >= 0 with the Lawson-Hanson
+// active-set method. Columns of A are the given 96-channel vectors.
+func nnls(columns [][96]float64, b []float64) []float64 {
+	k := len(columns)
+
+	// Normal equations: AtA (k×k) and Atb
+	ata := make([][]float64, k)
+	atb := make([]float64, k)
+	for i := range columns {
+		ata[i] = make([]float64, k)
+		for j := range columns {
+			for c := 0; c < 96; c++ {
+				ata[i][j] += columns[i][c] * columns[j][c]
+			}
+		}
+		for c := 0; c < 96; c++ {
+			atb[i] += columns[i][c] * b[c]
+		}
+	}
+
+	x := make([]float64, k)
+	passive := make([]bool, k)
+	gradient := func() []float64 {
+		w := make([]float64, k)
+		for i := range w {
+			w[i] = atb[i]
+			for j := range x {
+				w[i] -= ata[i][j] * x[j]
+			}
+		}
+		return w
+	}
+
+	const tolerance = 1e-10
+	for iteration := 0; iteration < 3*k+10; iteration++ {
+		w := gradient()
+		best, bestW := -1, tolerance
+		for i := range w {
+			if !passive[i] && w[i] > bestW {
+				best, bestW = i, w[i]
+			}
+		}
+		if best < 0 {
+			break
+		}
+		passive[best] = true
+
+		for inner := 0; inner < 3*k+10; inner++ {
+			s := solvePassive(ata, atb, passive)
+			feasible := true
+			for i := range s {
+				if passive[i] && s[i] <= tolerance {
+					feasible = false
+				}
+			}
+			if feasible {
+				copy(x, s)
+				break
+			}
+
+			// Step towards s until the first passive variable hits zero
+			alpha := math.Inf(1)
+			for i := range s {
+				if passive[i] && s[i] <= tolerance && x[i]-s[i] > 0 {
+					alpha = math.Min(alpha, x[i]/(x[i]-s[i]))
+				}
+			}
+			if math.IsInf(alpha, 1) {
+				alpha = 0
+			}
+			for i := range x {
+				x[i] += alpha * (s[i] - x[i])
+				if passive[i] && x[i] <= tolerance {
+					passive[i], x[i] = false, 0
+				}
+			}
+		}
+	}
+	return x
+}
+
+// solvePassive solves the normal equations restricted to passive variables
+// (others fixed at zero) by Gaussian elimination with partial pivoting
+func solvePassive(ata [][]float64, atb []float64, passive []bool) []float64 {
+	var vars []int
+	for i, p := range passive {
+		if p {
+			vars = append(vars, i)
+		}
+	}
+	n := len(vars)
+	m := make([][]float64, n)
+	for r, i := range vars {
+		m[r] = make([]float64, n+1)
+		for c, j := range vars {
+			m[r][c] = ata[i][j]
+		}
+		m[r][r] += 1e-12 // Guards against collinear signatures
+		m[r][n] = atb[i]
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		if m[col][col] == 0 {
+			continue
+		}
+		for r := col + 1; r < n; r++ {
+			f := m[r][col] / m[col][col]
+			for c := col; c <= n; c++ {
+				m[r][c] -= f * m[col][c]
+			}
+		}
+	}
+
+	solution := make([]float64, len(passive))
+	values := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		sum := m[r][n]
+		for c := r + 1; c < n; c++ {
+			sum -= m[r][c] * values[c]
+		}
+		if m[r][r] != 0 {
+			values[r] = sum / m[r][r]
+		}
+	}
+	for r, i := range vars {
+		solution[i] = values[r]
+	}
+	return solution
+}
+
+// NMFOptions controls de novo signature extraction
+type NMFOptions struct {
+	MaxIterations int     // Per restart
+	Restarts      int     // Random initialisations; the best fit is kept
+	Tolerance     float64 // Relative KL-divergence change for convergence
+	Seed          int64
+}
+
+// DefaultNMFOptions returns the default extraction settings
+func DefaultNMFOptions() NMFOptions {
+	return NMFOptions{
+		MaxIterations: 5000,
+		Restarts:      10,
+		Tolerance:     1e-7,
+		Seed:          1,
+	}
+}
+
+// SignatureExtraction is the result of de novo extraction
+type SignatureExtraction struct {
+	Signatures *SignatureMatrix // Named SBS96A, SBS96B, ...
+	Samples    []string
+	Exposures  [][]float64 // [sample][signature], in mutations
+	Divergence float64     // KL divergence of the reconstruction
+	Iterations int         // Iterations of the kept restart
+}
+
+// ExtractSignatures factorises the spectra into k signatures and their
+// per-sample exposures using non-negative matrix factorisation
+func ExtractSignatures(spectra []*Spectrum, k int, options NMFOptions) (*SignatureExtraction, error) {
+	n := len(spectra)
+	if k <= 0 || n == 0 {
+		return nil, fmt.Errorf("extraction needs at least one spectrum and one signature")
+	}
+	if options.MaxIterations <= 0 {
+		options.MaxIterations = DefaultNMFOptions().MaxIterations
+	}
+	options.Restarts = max(options.Restarts, 1)
+
+	// V: 96 × n observed counts
+	v := make([][]float64, 96)
+	for c := range v {
+		v[c] = make([]float64, n)
+		for j, spectrum := range spectra {
+			v[c][j] = spectrum.Counts[c]
+		}
+	}
+
+	rng := rand.New(rand.NewSource(options.Seed))
+	var bestW, bestH [][]float64
+	bestDivergence, bestIterations := math.Inf(1), 0
+	for restart := 0; restart < options.Restarts; restart++ {
+		w, h, divergence, iterations := nmfKL(v, k, options, rng)
+		if divergence < bestDivergence {
+			bestW, bestH, bestDivergence, bestIterations = w, h, divergence, iterations
+		}
+	}
+
+	// Scale signatures to sum 1, moving the mass into the exposures
+	extraction := &SignatureExtraction{
+		Signatures: &SignatureMatrix{Weights: make([][96]float64, k)},
+		Exposures:  make([][]float64, n),
+		Divergence: bestDivergence,
+		Iterations: bestIterations,
+	}
+	for j := range extraction.Exposures {
+		extraction.Exposures[j] = make([]float64, k)
+	}
+	for s := 0; s < k; s++ {
+		total := 0.0
+		for c := 0; c < 96; c++ {
+			total += bestW[c][s]
+		}
+		for c := 0; c < 96; c++ {
+			if total > 0 {
+				extraction.Signatures.Weights[s][c] = bestW[c][s] / total
+			}
+		}
+		for j := 0; j < n; j++ {
+			extraction.Exposures[j][s] = bestH[s][j] * total
+		}
+	}
+
+	// Order signatures by total exposure
+	order := make([]int, k)
+	totals := make([]float64, k)
+	for s := range order {
+		order[s] = s
+		for j := 0; j < n; j++ {
+			totals[s] += extraction.Exposures[j][s]
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return totals[order[a]] > totals[order[b]] })
+
+	weights := make([][96]float64, k)
+	for rank, s := range order {
+		weights[rank] = extraction.Signatures.Weights[s]
+		extraction.Signatures.Names = append(extraction.Signatures.Names, deNovoName(rank))
+	}
+	extraction.Signatures.Weights = weights
+	for j := range extraction.Exposures {
+		sorted := make([]float64, k)
+		for rank, s := range order {
+			sorted[rank] = extraction.Exposures[j][s]
+		}
+		extraction.Exposures[j] = sorted
+	}
+	for _, spectrum := range spectra {
+		extraction.Samples = append(extraction.Samples, spectrum.Sample)
+	}
+	return extraction, nil
+}
+
+// deNovoName names extracted signatures SBS96A..SBS96Z, SBS96AA, ...
+func deNovoName(i int) string {
+	suffix := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		suffix = string(rune('A'+(i-1)%26)) + suffix
+	}
+	return "SBS96" + suffix
+}
+
+// nmfKL runs one restart of Lee-Seung multiplicative updates minimising the
+// generalised KL divergence D(V || WH)
+func nmfKL(v [][]float64, k int, options NMFOptions, rng *rand.Rand) ([][]float64, [][]float64, float64, int) {
+	const epsilon = 1e-12
+	rows, cols := len(v), len(v[0])
+
+	mean := 0.0
+	for c := range v {
+		for j := range v[c] {
+			mean += v[c][j]
+		}
+	}
+	mean /= float64(rows * cols)
+	scale := math.Sqrt(mean/float64(k)) + epsilon
+
+	w := make([][]float64, rows)
+	for c := range w {
+		w[c] = make([]float64, k)
+		for s := range w[c] {
+			w[c][s] = scale * (0.5 + rng.Float64())
+		}
+	}
+	h := make([][]float64, k)
+	for s := range h {
+		h[s] = make([]float64, cols)
+		for j := range h[s] {
+			h[s][j] = scale * (0.5 + rng.Float64())
+		}
+	}
+
+	wh := make([][]float64, rows)
+	for c := range wh {
+		wh[c] = make([]float64, cols)
+	}
+	product := func() {
+		for c := 0; c < rows; c++ {
+			for j := 0; j < cols; j++ {
+				sum := 0.0
+				for s := 0; s < k; s++ {
+					sum += w[c][s] * h[s][j]
+				}
+				wh[c][j] = sum + epsilon
+			}
+		}
+	}
+	divergence := func() float64 {
+		d := 0.0
+		for c := 0; c < rows; c++ {
+			for j := 0; j < cols; j++ {
+				if v[c][j] > 0 {
+					d += v[c][j] * math.Log(v[c][j]/wh[c][j])
+				}
+				d += wh[c][j] - v[c][j]
+			}
+		}
+		return d
+	}
+
+	product()
+	previous := divergence()
+	iteration := 0
+	for iteration = 1; iteration <= options.MaxIterations; iteration++ {
+		// H <- H * (W^T (V / WH)) / (W^T 1)
+		for s := 0; s < k; s++ {
+			colSum := 0.0
+			for c := 0; c < rows; c++ {
+				colSum += w[c][s]
+			}
+			for j := 0; j < cols; j++ {
+				numerator := 0.0
+				for c := 0; c < rows; c++ {
+					numerator += w[c][s] * v[c][j] / wh[c][j]
+				}
+				h[s][j] *= numerator / (colSum + epsilon)
+			}
+		}
+		product()
+
+		// W <- W * ((V / WH) H^T) / (1 H^T)
+		for s := 0; s < k; s++ {
+			rowSum := 0.0
+			for j := 0; j < cols; j++ {
+				rowSum += h[s][j]
+			}
+			for c := 0; c < rows; c++ {
+				numerator := 0.0
+				for j := 0; j < cols; j++ {
+					numerator += h[s][j] * v[c][j] / wh[c][j]
+				}
+				w[c][s] *= numerator / (rowSum + epsilon)
+			}
+		}
+		product()
+
+		if iteration%10 == 0 {
+			current := divergence()
+			if math.Abs(previous-current) <= options.Tolerance*math.Max(previous, epsilon) {
+				previous = current
+				break
+			}
+			previous = current
+		}
+	}
+	return w, h, divergence(), min(iteration, options.MaxIterations)
+}
+
+// SignatureMatch pairs a signature with its most similar reference signature
+type SignatureMatch struct {
+	Signature        string
+	BestMatch        string
+	CosineSimilarity float64
+}
+
+// MatchSignatures finds, for each signature in sm, the most similar
+// signature in known (e.g. de novo signatures against COSMIC)
+func (sm *SignatureMatrix) MatchSignatures(known *SignatureMatrix) []SignatureMatch {
+	matches := make([]SignatureMatch, len(sm.Names))
+	for s, name := range sm.Names {
+		matches[s].Signature = name
+		for r, knownName := range known.Names {
+			similarity := cosineSimilarity(sm.Weights[s][:], known.Weights[r][:])
+			if similarity > matches[s].CosineSimilarity {
+				matches[s].BestMatch, matches[s].CosineSimilarity = knownName, similarity
+			}
+		}
+	}
+	return matches
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors
+func cosineSimilarity(a, b []float64) float64 {
+	dot, normA, normB := 0.0, 0.0, 0.0
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// normalize scales a vector to sum 1; false if it is all zero
+func normalize(values *[96]float64) bool {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	if total == 0 {
+		return false
+	}
+	for i := range values {
+		values[i] /= total
+	}
+	return true
+}
+
+// isNumber reports whether a field parses as a float
+func isNumber(field string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+	return err == nil
+}
+
+// SBS6Colors are the conventional COSMIC substitution class colours
+var SBS6Colors = [6]MutationColor{
+	{R: 0.01, G: 0.74, B: 0.93, A: 1.0}, // C>A blue
+	{R: 0.00, G: 0.00, B: 0.00, A: 1.0}, // C>G black
+	{R: 0.89, G: 0.16, B: 0.15, A: 1.0}, // C>T red
+	{R: 0.79, G: 0.79, B: 0.79, A: 1.0}, // T>A grey
+	{R: 0.63, G: 0.81, B: 0.39, A: 1.0}, // T>C green
+	{R: 0.93, G: 0.78, B: 0.77, A: 1.0}, // T>G pink
+}
+
+// SignaturePalette returns n well-separated colours (golden-angle hues)
+func SignaturePalette(n int) []MutationColor {
+	palette := make([]MutationColor, n)
+	for i := range palette {
+		hue := math.Mod(float64(i)*137.508, 360) / 60
+		x := float32(1 - math.Abs(math.Mod(hue, 2)-1))
+		switch int(hue) {
+		case 0:
+			palette[i] = MutationColor{R: 1, G: x, B: 0, A: 1}
+		case 1:
+			palette[i] = MutationColor{R: x, G: 1, B: 0, A: 1}
+		case 2:
+			palette[i] = MutationColor{R: 0, G: 1, B: x, A: 1}
+		case 3:
+			palette[i] = MutationColor{R: 0, G: x, B: 1, A: 1}
+		case 4:
+			palette[i] = MutationColor{R: x, G: 0, B: 1, A: 1}
+		default:
+			palette[i] = MutationColor{R: 1, G: 0, B: x, A: 1}
+		}
+	}
+	return palette
+}
+
+// channelCache memoises SBS96 channels of mutations (-1 for non-SNVs)
+type channelCache struct {
+	reference *reference.FASTA
+	channels  map[*Mutation]int
+	mu        sync.Mutex
+}
+
+func (cc *channelCache) channel(m *Mutation) int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if channel, ok := cc.channels[m]; ok {
+		return channel
+	}
+	channel, err := SBS96Channel(cc.reference, m)
+	if err != nil {
+		channel = -1
+	}
+	cc.channels[m] = channel
+	return channel
+}
+
+// SBS6ColorScheme colours SNVs by substitution class
+type SBS6ColorScheme struct {
+	cache *channelCache
+}
+
+// NewSBS6ColorScheme creates a substitution class colour scheme
+func NewSBS6ColorScheme(ref *reference.FASTA) *SBS6ColorScheme {
+	return &SBS6ColorScheme{cache: &channelCache{reference: ref, channels: make(map[*Mutation]int)}}
+}
+
+// ColorFor returns the class colour of an SNV
+func (s *SBS6ColorScheme) ColorFor(m *Mutation) (MutationColor, bool) {
+	channel := s.cache.channel(m)
+	if channel < 0 {
+		return MutationColor{}, false
+	}
+	return SBS6Colors[channel/16], true
+}
+
+// SignatureColorScheme colours each SNV by the signature most likely to
+// have produced it: argmax over s of exposure(s) × P(channel | s)
+type SignatureColorScheme struct {
+	cache     *channelCache
+	matrix    *SignatureMatrix
+	exposures []float64
+	colors    []MutationColor
+}
+
+// NewSignatureColorScheme creates a colour scheme from signatures and
+// their exposures (e.g. a SignatureFit of the loaded mutation set)
+func NewSignatureColorScheme(ref *reference.FASTA, matrix *SignatureMatrix, exposures []float64) (*SignatureColorScheme, error) {
+	if len(exposures) != len(matrix.Names) {
+		return nil, fmt.Errorf("got %d exposures for %d signatures", len(exposures), len(matrix.Names))
+	}
+	return &SignatureColorScheme{
+		cache:     &channelCache{reference: ref, channels: make(map[*Mutation]int)},
+		matrix:    matrix,
+		exposures: exposures,
+		colors:    SignaturePalette(len(matrix.Names)),
+	}, nil
+}
+
+// Colors returns the colour assigned to each signature
+func (s *SignatureColorScheme) Colors() map[string]MutationColor {
+	colors := make(map[string]MutationColor, len(s.colors))
+	for i, name := range s.matrix.Names {
+		colors[name] = s.colors[i]
+	}
+	return colors
+}
+
+// Assign returns the most likely signature of an SNV and its posterior
+// probability
+func (s *SignatureColorScheme) Assign(m *Mutation) (string, float64, bool) {
+	channel := s.cache.channel(m)
+	if channel < 0 {
+		return "", 0, false
+	}
+	best, bestWeight, total := -1, 0.0, 0.0
+	for i, exposure := range s.exposures {
+		weight := exposure * s.matrix.Weights[i][channel]
+		total += weight
+		if weight > bestWeight {
+			best, bestWeight = i, weight
+		}
+	}
+	if best < 0 {
+		return "", 0, false
+	}
+	return s.matrix.Names[best], bestWeight / total, true
+}
+
+// ColorFor returns the colour of an SNV's most likely signature, with
+// alpha scaled by the assignment's posterior probability
+func (s *SignatureColorScheme) ColorFor(m *Mutation) (MutationColor, bool) {
+	name, posterior, ok := s.Assign(m)
+	if !ok {
+		return MutationColor{}, false
+	}
+	color := s.colors[indexOf(s.matrix.Names, name)]
+	color.A = float32(0.4 + 0.6*posterior)
+	return color, true
+}
@@ -0,0 +1,171 @@
+package mutations
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// syntheticSignatures returns k random sparse-ish SBS96 signatures
+func syntheticSignatures(rng *rand.Rand, k int) *SignatureMatrix {
+	matrix := &SignatureMatrix{Weights: make([][96]float64, k)}
+	for s := range matrix.Weights {
+		matrix.Names = append(matrix.Names, deNovoName(s))
+		for c := range matrix.Weights[s] {
+			// Exponentially distributed weights give peaked signatures
+			matrix.Weights[s][c] = rng.ExpFloat64() * rng.ExpFloat64()
+		}
+		normalize(&matrix.Weights[s])
+	}
+	return matrix
+}
+
+// syntheticSpectrum mixes signatures with the given exposures
+func syntheticSpectrum(sample string, matrix *SignatureMatrix, exposures []float64) *Spectrum {
+	spectrum := &Spectrum{Sample: sample}
+	for s, e := range exposures {
+		for c := range spectrum.Counts {
+			spectrum.Counts[c] += e * matrix.Weights[s][c]
+		}
+	}
+	return spectrum
+}
+
+// TestFitSignaturesExact recovers known exposures, including zeros, from
+// noise-free catalogues
+func TestFitSignaturesExact(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	matrix := syntheticSignatures(rng, 8)
+
+	for trial, exposures := range [][]float64{
+		{500, 0, 1200, 0, 300, 0, 0, 40},
+		{0, 0, 0, 0, 0, 0, 0, 10000},
+		{1, 2, 3, 4, 5, 6, 7, 8},
+		{0, 2500, 0, 0, 0, 800, 0, 0},
+	} {
+		fit, err := FitSignatures(syntheticSpectrum("sample", matrix, exposures), matrix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0.0
+		for _, e := range exposures {
+			total += e
+		}
+		for s, want := range exposures {
+			if math.Abs(fit.Exposures[s]-want) > 1.5e-7*total {
+				t.Errorf("Trial %d: %s exposure %.9g, want %g", trial, matrix.Names[s], fit.Exposures[s], want)
+			}
+			if math.Abs(fit.Contributions[s]-want/total) > 1.5e-7 {
+				t.Errorf("Trial %d: %s contribution %.9g, want %g", trial, matrix.Names[s], fit.Contributions[s], want/total)
+			}
+		}
+		if fit.CosineSimilarity < 1-1e-12 || fit.Residual > 1e-6*total {
+			t.Errorf("Trial %d: cosine %.15f, residual %g", trial, fit.CosineSimilarity, fit.Residual)
+		}
+	}
+
+	// A spectrum outside the cone of the signatures still gets a
+	// non-negative least-squares fit
+	var counts [96]float64
+	counts[0] = 100
+	fit, _ := FitSignatures(&Spectrum{Counts: counts}, matrix)
+	for s, e := range fit.Exposures {
+		if e < 0 {
+			t.Errorf("Negative exposure %g for %s", e, matrix.Names[s])
+		}
+	}
+
+	if _, err := FitSignatures(&Spectrum{}, &SignatureMatrix{}); err == nil {
+		t.Error("Expected error for an empty matrix")
+	}
+}
+
+// TestSignatureMatrixRoundTrip writes and re-reads a matrix
+func TestSignatureMatrixRoundTrip(t *testing.T) {
+	matrix := syntheticSignatures(rand.New(rand.NewSource(22)), 3)
+	var buf bytes.Buffer
+	if _, err := matrix.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSignatureMatrix(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s := range matrix.Weights {
+		if cosineSimilarity(parsed.Weights[s][:], matrix.Weights[s][:]) < 1-1e-12 {
+			t.Errorf("Signature %s changed in the round trip", matrix.Names[s])
+		}
+	}
+
+	subset, err := parsed.Subset([]string{"SBS96C", "SBS96A"})
+	if err != nil || subset.Names[0] != "SBS96C" || subset.Weights[1] != parsed.Weights[0] {
+		t.Errorf("Unexpected subset %v, %v", subset, err)
+	}
+	if _, err := parsed.Subset([]string{"SBS1"}); err == nil {
+		t.Error("Expected error for an unknown signature")
+	}
+}
+
+// TestExtractSignatures recovers planted signatures and exposures from
+// noise-free catalogues by NMF
+func TestExtractSignatures(t *testing.T) {
+	rng := rand.New(rand.NewSource(23))
+	planted := syntheticSignatures(rng, 3)
+
+	// NMF is only unique up to rotations inside the cone of the data, so
+	// give each signature channels of its own and each sample a missing
+	// signature
+	for s := range planted.Weights {
+		for c := range planted.Weights[s] {
+			if c%3 != s && rng.Intn(2) == 0 {
+				planted.Weights[s][c] = 0
+			}
+		}
+		for c := s * 4; c < 96; c += 12 {
+			for other := range planted.Weights {
+				if other != s {
+					planted.Weights[other][c] = 0
+				}
+			}
+		}
+	}
+	for s := range planted.Weights {
+		normalize(&planted.Weights[s])
+	}
+
+	var spectra []*Spectrum
+	var exposures [][]float64
+	for j := 0; j < 24; j++ {
+		e := []float64{600 + 1000*rng.Float64(), 300 + 600*rng.Float64(), 100 + 200*rng.Float64()}
+		e[j%3] = 0
+		exposures = append(exposures, e)
+		spectra = append(spectra, syntheticSpectrum(deNovoName(j), planted, e))
+	}
+
+	options := DefaultNMFOptions()
+	options.Restarts = 2
+	extraction, err := ExtractSignatures(spectra, 3, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Extracted signatures come ordered by total exposure, as planted
+	for s, match := range extraction.Signatures.MatchSignatures(planted) {
+		if match.BestMatch != planted.Names[s] || match.CosineSimilarity < 0.99 {
+			t.Errorf("%s matched %s at %.4f, want %s", match.Signature, match.BestMatch, match.CosineSimilarity, planted.Names[s])
+		}
+	}
+	for j, want := range exposures {
+		total := want[0] + want[1] + want[2]
+		for s := range want {
+			if got := extraction.Exposures[j][s]; math.Abs(got-want[s]) > 0.01*total {
+				t.Errorf("Sample %d %s exposure %.1f, want %.1f", j, extraction.Signatures.Names[s], got, want[s])
+			}
+		}
+	}
+
+	if _, err := ExtractSignatures(spectra, 0, options); err == nil {
+		t.Error("Expected error for k = 0")
+	}
+}
@@ -0,0 +1,426 @@
+/**
+ * Structural Variants
+ *
+ * Two-ended genomic rearrangements read from VCF:
+ * - Symbolic alleles with SVTYPE/END/SVLEN: <DEL>, <DUP>, <DUP:TANDEM>,
+ *   <INV>, <INS>
+ * - SVTYPE=TRA records with CHR2/POS2 (Delly, Lumpy)
+ * - BND records in bracket notation (G]17:198982], [13:123456[T), with
+ *   mate pairs (MATEID) collapsed into one variant. Breakends joining
+ *   different chromosomes are translocations.
+ *
+ * Breakend orientation is recorded as two strands: "+" when the retained
+ * sequence lies left of (ends at) the breakpoint, "-" when it lies right.
+ */
+
+package mutations
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"genomevedic/internal/interval"
+)
+
+// SVType represents the class of a structural variant
+type SVType int
+
+const (
+	SVUnknown SVType = iota
+	SVDeletion
+	SVDuplication
+	SVInversion
+	SVInsertion
+	SVTranslocation
+	SVBreakend // Intra-chromosomal or single breakend of unresolved class
+)
+
+func (t SVType) String() string {
+	switch t {
+	case SVDeletion:
+		return "DEL"
+	case SVDuplication:
+		return "DUP"
+	case SVInversion:
+		return "INV"
+	case SVInsertion:
+		return "INS"
+	case SVTranslocation:
+		return "TRA"
+	case SVBreakend:
+		return "BND"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// parseSVType maps SVTYPE values and symbolic ALTs (without brackets)
+func parseSVType(value string) SVType {
+	value = strings.ToUpper(value)
+	if base, _, found := strings.Cut(value, ":"); found {
+		value = base // DUP:TANDEM, DEL:ME:ALU, INS:ME
+	}
+	switch value {
+	case "DEL":
+		return SVDeletion
+	case "DUP":
+		return SVDuplication
+	case "INV":
+		return SVInversion
+	case "INS":
+		return SVInsertion
+	case "TRA", "CTX":
+		return SVTranslocation
+	case "BND":
+		return SVBreakend
+	}
+	return SVUnknown
+}
+
+// StructuralVariant is a rearrangement with two breakpoints. For
+// intra-chromosomal events (DEL, DUP, INV, INS) the mate is the END
+// position on the same chromosome; single breakends have no mate.
+type StructuralVariant struct {
+	ID             string
+	Type           SVType
+	Chromosome     string
+	Position       uint64 // First breakpoint (1-based)
+	MateChromosome string
+	MatePosition   uint64
+	Strands        string   // Orientation of both ends, e.g. "+-"; "" when unknown
+	Length         int64    // SVLEN (negative for deletions), 0 when unknown
+	ConfidencePos  [2]int64 // CIPOS
+	ConfidenceEnd  [2]int64 // CIEND
+	Imprecise      bool
+	Quality        float64
+	Gene           string
+	SampleCount    int
+	mateID         string
+}
+
+// IsInterChromosomal reports whether the breakpoints lie on different
+// chromosomes
+func (sv *StructuralVariant) IsInterChromosomal() bool {
+	return sv.MateChromosome != "" && sv.MateChromosome != sv.Chromosome
+}
+
+// HasMate reports whether the second breakpoint is known
+func (sv *StructuralVariant) HasMate() bool {
+	return sv.MateChromosome != "" && sv.MatePosition > 0
+}
+
+// Span returns the affected interval of an intra-chromosomal variant.
+// Translocations and single breakends have no span.
+func (sv *StructuralVariant) Span() (uint64, uint64, bool) {
+	if !sv.HasMate() || sv.IsInterChromosomal() {
+		return 0, 0, false
+	}
+	return min(sv.Position, sv.MatePosition), max(sv.Position, sv.MatePosition), true
+}
+
+// String returns a compact description, e.g. "DEL 1:1000-5000" or
+// "TRA 9:133589268 -> 22:23632600"
+func (sv *StructuralVariant) String() string {
+	if start, end, ok := sv.Span(); ok {
+		return fmt.Sprintf("%s %s:%d-%d", sv.Type, sv.Chromosome, start, end)
+	}
+	if sv.HasMate() {
+		return fmt.Sprintf("%s %s:%d -> %s:%d", sv.Type, sv.Chromosome, sv.Position, sv.MateChromosome, sv.MatePosition)
+	}
+	return fmt.Sprintf("%s %s:%d", sv.Type, sv.Chromosome, sv.Position)
+}
+
+// bracketAllele matches VCF breakend notation: t[p[, t]p], ]p]t, [p[t
+var bracketAllele = regexp.MustCompile(`^([A-Za-z]*)([\[\]])([^:\[\]]+):(\d+)([\[\]])([A-Za-z]*)$`)
+
+// StructuralVariants converts the record's structural ALT alleles. Records
+// without symbolic, breakend or SVTYPE alleles return nil.
+func (r *VCFRecord) StructuralVariants() []*StructuralVariant {
+	svType := parseSVType(r.Info["SVTYPE"])
+
+	var variants []*StructuralVariant
+	for i, raw := range r.Alts {
+		alt := strings.ToUpper(raw)
+		if alt == "*" || alt == "<*>" || alt == "<NON_REF>" {
+			continue
+		}
+
+		sv := &StructuralVariant{
+			Type:        svType,
+			Chromosome:  r.Chromosome,
+			Position:    r.Position,
+			Quality:     r.Qual,
+			Gene:        vcfGeneSymbol(r.Info),
+			SampleCount: r.sampleCount(i),
+			Imprecise:   hasFlag(r.Info, "IMPRECISE"),
+			mateID:      r.Info["MATEID"],
+		}
+		if len(r.IDs) > 0 {
+			sv.ID = r.IDs[0]
+		}
+		sv.ConfidencePos = parseInterval(r.Info["CIPOS"])
+		sv.ConfidenceEnd = parseInterval(r.Info["CIEND"])
+		if length, err := strconv.ParseInt(r.AltInfo("SVLEN", i), 10, 64); err == nil {
+			sv.Length = length
+		}
+
+		switch match := bracketAllele.FindStringSubmatch(raw); {
+		case match != nil:
+			// Breakend: t[p[ and t]p] keep sequence left of POS
+			matePosition, _ := strconv.ParseUint(match[4], 10, 64)
+			sv.MateChromosome, sv.MatePosition = match[3], matePosition
+			first := "-"
+			if match[1] != "" {
+				first = "+"
+			}
+			second := "+"
+			if match[2] == "[" {
+				second = "-"
+			}
+			sv.Strands = first + second
+			sv.Type = SVBreakend
+			if sv.IsInterChromosomal() {
+				sv.Type = SVTranslocation
+			}
+
+		case strings.HasPrefix(alt, "<") && strings.HasSuffix(alt, ">"):
+			if symbolic := parseSVType(alt[1 : len(alt)-1]); symbolic != SVUnknown {
+				sv.Type = symbolic
+			}
+			r.setSVMate(sv)
+
+		case strings.HasPrefix(alt, ".") || strings.HasSuffix(alt, "."):
+			sv.Type = SVBreakend // Single breakend
+
+		case svType != SVUnknown:
+			// Sequence-resolved SV with SVTYPE (e.g. long-read insertions)
+			r.setSVMate(sv)
+
+		default:
+			continue
+		}
+		if sv.Type == SVUnknown {
+			continue // e.g. <CNV>; copy number is handled separately
+		}
+		variants = append(variants, sv)
+	}
+	return variants
+}
+
+// setSVMate sets the second breakpoint of a symbolic or SVTYPE record from
+// END (or SVLEN), or CHR2/POS2 for TRA records
+func (r *VCFRecord) setSVMate(sv *StructuralVariant) {
+	if chr2 := r.Info["CHR2"]; chr2 != "" && chr2 != r.Chromosome {
+		position, err := strconv.ParseUint(r.Info["POS2"], 10, 64)
+		if err != nil {
+			position, _ = strconv.ParseUint(r.Info["END"], 10, 64)
+		}
+		sv.MateChromosome, sv.MatePosition = chr2, position
+		sv.Type = SVTranslocation
+		sv.Strands = strandsFromInfo(r.Info)
+		return
+	}
+
+	sv.MateChromosome = r.Chromosome
+	switch {
+	case r.Info["END"] != "":
+		sv.MatePosition = r.End()
+	case sv.Length != 0 && sv.Type != SVInsertion:
+		length := sv.Length
+		if length < 0 {
+			length = -length
+		}
+		sv.MatePosition = r.Position + uint64(length)
+	default:
+		sv.MatePosition = r.Position
+	}
+	sv.Strands = strandsFromInfo(r.Info)
+}
+
+// strandsFromInfo reads orientation from STRANDS ("+-:5") or Delly CT
+// ("3to5" = "+-")
+func strandsFromInfo(info map[string]string) string {
+	if strands := info["STRANDS"]; len(strands) >= 2 {
+		return strands[:2]
+	}
+	switch info["CT"] {
+	case "3to5":
+		return "+-"
+	case "5to3":
+		return "-+"
+	case "3to3":
+		return "++"
+	case "5to5":
+		return "--"
+	}
+	return ""
+}
+
+// hasFlag reports whether an INFO flag is set
+func hasFlag(info map[string]string, key string) bool {
+	_, ok := info[key]
+	return ok
+}
+
+// parseInterval parses a "-10,10" confidence interval
+func parseInterval(value string) [2]int64 {
+	var result [2]int64
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return result
+	}
+	result[0], _ = strconv.ParseInt(parts[0], 10, 64)
+	result[1], _ = strconv.ParseInt(parts[1], 10, 64)
+	return result
+}
+
+// StructuralVariantSet holds structural variants indexed by the spans and
+// breakpoints they affect
+type StructuralVariantSet struct {
+	variants    []*StructuralVariant
+	index       *interval.Index[*StructuralVariant]
+	chromosomes map[string]bool
+}
+
+// NewStructuralVariantSet creates an empty set
+func NewStructuralVariantSet() *StructuralVariantSet {
+	return &StructuralVariantSet{
+		index:       interval.New[*StructuralVariant](),
+		chromosomes: make(map[string]bool),
+	}
+}
+
+// LoadStructuralVariants reads the structural variants of a VCF file
+func LoadStructuralVariants(path string, passOnly bool) (*StructuralVariantSet, error) {
+	vr, err := OpenVCF(path)
+	if err != nil {
+		return nil, err
+	}
+	defer vr.Close()
+
+	set := NewStructuralVariantSet()
+	if _, err := set.LoadVCF(vr, passOnly); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// LoadVCF adds the structural variants of every record, collapsing BND
+// mate pairs, and returns how many were added
+func (s *StructuralVariantSet) LoadVCF(vr *VCFReader, passOnly bool) (int, error) {
+	seen := make(map[string]bool) // IDs of added breakends and pair keys
+	added := 0
+
+	for {
+		record, err := vr.Read()
+		if err == io.EOF {
+			return added, nil
+		}
+		if err != nil {
+			return added, fmt.Errorf("failed to read VCF record: %w", err)
+		}
+		if passOnly && !record.Passed() {
+			continue
+		}
+
+		for _, sv := range record.StructuralVariants() {
+			if sv.mateID != "" && seen[sv.mateID] {
+				continue
+			}
+			if sv.Type == SVBreakend || sv.Type == SVTranslocation {
+				key := breakendPairKey(sv)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			if sv.ID != "" {
+				seen[sv.ID] = true
+			}
+			s.Add(sv)
+			added++
+		}
+	}
+}
+
+// breakendPairKey identifies a breakend pair regardless of which end was
+// written first
+func breakendPairKey(sv *StructuralVariant) string {
+	ends := []string{
+		fmt.Sprintf("%s:%d", sv.Chromosome, sv.Position),
+		fmt.Sprintf("%s:%d", sv.MateChromosome, sv.MatePosition),
+	}
+	sort.Strings(ends)
+	return "pair:" + ends[0] + "|" + ends[1]
+}
+
+// Add indexes a variant: its whole span when intra-chromosomal, otherwise
+// each breakpoint
+func (s *StructuralVariantSet) Add(sv *StructuralVariant) {
+	s.variants = append(s.variants, sv)
+	s.chromosomes[sv.Chromosome] = true
+
+	if start, end, ok := sv.Span(); ok {
+		s.index.Add(sv.Chromosome, start, end, sv)
+		return
+	}
+	s.index.Add(sv.Chromosome, sv.Position, sv.Position, sv)
+	if sv.HasMate() {
+		s.chromosomes[sv.MateChromosome] = true
+		s.index.Add(sv.MateChromosome, sv.MatePosition, sv.MatePosition, sv)
+	}
+}
+
+// Variants returns all variants in load order
+func (s *StructuralVariantSet) Variants() []*StructuralVariant {
+	return s.variants
+}
+
+// Overlapping returns the variants whose span or breakpoints overlap
+// [start, end] (inclusive). "chr17" and "17" naming are interchangeable.
+func (s *StructuralVariantSet) Overlapping(chromosome string, start, end uint64) []*StructuralVariant {
+	found := s.index.Overlapping(matchChromosome(chromosome, s.chromosomes), start, end)
+
+	// A same-variant pair of breakpoints can both overlap
+	unique := found[:0]
+	seen := make(map[*StructuralVariant]bool, len(found))
+	for _, sv := range found {
+		if !seen[sv] {
+			seen[sv] = true
+			unique = append(unique, sv)
+		}
+	}
+	return unique
+}
+
+// ByType returns the variants of one class
+func (s *StructuralVariantSet) ByType(svType SVType) []*StructuralVariant {
+	var result []*StructuralVariant
+	for _, sv := range s.variants {
+		if sv.Type == svType {
+			result = append(result, sv)
+		}
+	}
+	return result
+}
+
+// GetStatistics returns counts by class
+func (s *StructuralVariantSet) GetStatistics() map[string]interface{} {
+	byType := make(map[string]int)
+	interChromosomal := 0
+	for _, sv := range s.variants {
+		byType[sv.Type.String()]++
+		if sv.IsInterChromosomal() {
+			interChromosomal++
+		}
+	}
+	return map[string]interface{}{
+		"total_variants":    len(s.variants),
+		"by_type":           byType,
+		"inter_chromosomal": interChromosomal,
+	}
+}
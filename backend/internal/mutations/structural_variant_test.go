@@ -0,0 +1,136 @@
+package mutations
+
+import (
+	"strings"
+	"testing"
+)
+
+// testBreakends is the breakend example of the VCF 4.3 specification
+// (section 5.4): three rearrangements written as six mated breakends, one
+// in each bracket form
+const testBreakends = "2\t321681\tbnd_W\tG\tG]17:198982]\t6\tPASS\tSVTYPE=BND;MATEID=bnd_Y\n" +
+	"2\t321682\tbnd_V\tT\t]13:123456]T\t6\tPASS\tSVTYPE=BND;MATEID=bnd_U\n" +
+	"13\t123456\tbnd_U\tC\tC[2:321682[\t6\tPASS\tSVTYPE=BND;MATEID=bnd_V\n" +
+	"13\t123457\tbnd_X\tA\t[17:198983[A\t6\tPASS\tSVTYPE=BND;MATEID=bnd_Z\n" +
+	"17\t198982\tbnd_Y\tA\tA]2:321681]\t6\tPASS\tSVTYPE=BND;MATEID=bnd_W\n" +
+	"17\t198983\tbnd_Z\tC\t[13:123457[C\t6\tPASS\tSVTYPE=BND;MATEID=bnd_X\n"
+
+// testSVHeader is a sites-only header
+const testSVHeader = "##fileformat=VCFv4.3\n" +
+	"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n"
+
+// TestBreakendForms converts each bracket form to its mate and strands
+func TestBreakendForms(t *testing.T) {
+	reader, err := NewVCFReader(strings.NewReader(testSVHeader + testBreakends +
+		"1\t1000\tbnd_A\tN\tN[1:5000[\t.\tPASS\tSVTYPE=BND\n" +
+		"1\t2000\tbnd_S\tG\tG.\t.\tPASS\tSVTYPE=BND\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id       string
+		mate     string
+		position uint64
+		strands  string
+		svType   SVType
+	}{
+		{"bnd_W", "17", 198982, "++", SVTranslocation}, // t]p]
+		{"bnd_V", "13", 123456, "-+", SVTranslocation}, // ]p]t
+		{"bnd_U", "2", 321682, "+-", SVTranslocation},  // t[p[
+		{"bnd_X", "17", 198983, "--", SVTranslocation}, // [p[t
+		{"bnd_Y", "2", 321681, "++", SVTranslocation},
+		{"bnd_Z", "13", 123457, "--", SVTranslocation},
+		{"bnd_A", "1", 5000, "+-", SVBreakend}, // Same chromosome
+		{"bnd_S", "", 0, "", SVBreakend},       // Single breakend
+	}
+	records := readAll(t, reader)
+	if len(records) != len(tests) {
+		t.Fatalf("Read %d records, want %d", len(records), len(tests))
+	}
+	for i, tt := range tests {
+		variants := records[i].StructuralVariants()
+		if len(variants) != 1 {
+			t.Errorf("%s: %d variants, want 1", tt.id, len(variants))
+			continue
+		}
+		sv := variants[0]
+		if sv.ID != tt.id || sv.MateChromosome != tt.mate || sv.MatePosition != tt.position ||
+			sv.Strands != tt.strands || sv.Type != tt.svType {
+			t.Errorf("%s: got %s %s:%d %q %s, want %s:%d %q %s", tt.id, sv.ID,
+				sv.MateChromosome, sv.MatePosition, sv.Strands, sv.Type,
+				tt.mate, tt.position, tt.strands, tt.svType)
+		}
+	}
+
+	// Intra-chromosomal breakends span their breakpoints
+	if start, end, ok := records[6].StructuralVariants()[0].Span(); !ok || start != 1000 || end != 5000 {
+		t.Errorf("Unexpected span %d-%d (%v)", start, end, ok)
+	}
+}
+
+// TestBreakendMates collapses mate pairs, by MATEID or by position when
+// MATEID is missing, and finds translocations from either end
+func TestBreakendMates(t *testing.T) {
+	reader, err := NewVCFReader(strings.NewReader(testSVHeader + testBreakends +
+		"1\t1000\tbnd_A\tN\tN[1:5000[\t.\tPASS\tSVTYPE=BND\n" +
+		"1\t5000\tbnd_B\tN\t]1:1000]N\t.\tPASS\tSVTYPE=BND\n" +
+		"1\t8000\tdel_1\tN\t<DEL>\t.\tPASS\tSVTYPE=DEL;END=9000\n" +
+		"1\t9500\tlow_1\tN\t<DEL>\t.\tLowQual\tSVTYPE=DEL;END=9600\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := NewStructuralVariantSet()
+	added, err := set.LoadVCF(reader, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, sv := range set.Variants() {
+		ids = append(ids, sv.ID)
+	}
+	if added != 5 || strings.Join(ids, ",") != "bnd_W,bnd_V,bnd_X,bnd_A,del_1" {
+		t.Errorf("Added %d variants %v, want bnd_W,bnd_V,bnd_X,bnd_A,del_1", added, ids)
+	}
+	if stats := set.GetStatistics(); stats["inter_chromosomal"] != 3 {
+		t.Errorf("Unexpected statistics %v", stats)
+	}
+
+	// Both ends of a translocation are indexed, under either naming
+	for _, query := range []struct {
+		chromosome string
+		position   uint64
+		want       string
+	}{
+		{"2", 321681, "bnd_W"},
+		{"chr17", 198982, "bnd_W"},
+		{"13", 123456, "bnd_V"},
+		{"chr13", 123457, "bnd_X"},
+		{"1", 3000, "bnd_A"},
+	} {
+		found := set.Overlapping(query.chromosome, query.position, query.position)
+		if len(found) != 1 || found[0].ID != query.want {
+			t.Errorf("%s:%d overlaps %v, want %s", query.chromosome, query.position, found, query.want)
+		}
+	}
+
+	overlay := NewSVOverlay(set, 10)
+	color, ok := overlay.GetParticleColor("chr17", 198972)
+	if !ok || color.R != SVColors[SVTranslocation].R || color.A >= SVColors[SVTranslocation].A {
+		t.Errorf("Unexpected colour near the mate breakpoint: %+v %v", color, ok)
+	}
+	if _, ok := overlay.GetParticleColor("17", 198950); ok {
+		t.Error("Expected no colour outside the breakend radius")
+	}
+
+	highlights := overlay.Highlights("17", 198900, 199100)
+	if len(highlights) != 2 {
+		t.Fatalf("Got %d highlights, want one per breakpoint", len(highlights))
+	}
+	for _, h := range highlights {
+		if !h.Breakpoint || h.End-h.Start != 20 {
+			t.Errorf("Unexpected highlight %+v", h)
+		}
+	}
+}
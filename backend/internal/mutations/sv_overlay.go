@@ -0,0 +1,235 @@
+/**
+ * Structural Variant Overlay
+ *
+ * Highlights the genomic spans affected by structural variants and builds
+ * arcs linking their breakpoints in the 3D helix:
+ *
+ * - Particles inside a deletion, duplication or inversion take the
+ *   variant's colour at reduced opacity
+ * - Particles within breakendRadius of a breakpoint take the full colour,
+ *   fading with distance
+ * - Arcs are quadratic Bézier curves between the two breakpoints' helix
+ *   positions (navigation.CoordinateSystem.GenomicTo3D), lifted away from
+ *   the helix axis so translocations stand out from the chromatin
+ *
+ * Color Scheme:
+ * - Blue (Deletion), Red (Duplication), Green (Inversion),
+ *   Yellow (Insertion), Magenta (Translocation), Cyan (Breakend)
+ */
+
+package mutations
+
+import (
+	"math"
+	"strings"
+
+	"genomevedic/internal/navigation"
+)
+
+// Structural variant colours
+var SVColors = map[SVType]MutationColor{
+	SVDeletion:      {R: 0.2, G: 0.4, B: 1.0, A: 0.9},
+	SVDuplication:   {R: 1.0, G: 0.3, B: 0.2, A: 0.9},
+	SVInversion:     {R: 0.2, G: 0.8, B: 0.3, A: 0.9},
+	SVInsertion:     {R: 1.0, G: 0.9, B: 0.2, A: 0.9},
+	SVTranslocation: {R: 0.9, G: 0.2, B: 0.9, A: 1.0},
+	SVBreakend:      {R: 0.2, G: 0.9, B: 0.9, A: 0.9},
+}
+
+// spanOpacity scales colours inside an affected span
+const spanOpacity = 0.4
+
+// SVHighlight is a coloured interval for rendering: an affected span or
+// the neighbourhood of a breakpoint
+type SVHighlight struct {
+	Variant    *StructuralVariant
+	Chromosome string
+	Start      uint64
+	End        uint64
+	Breakpoint bool
+	Color      MutationColor
+}
+
+// SVArc is a polyline joining the two breakpoints of a variant in 3D
+type SVArc struct {
+	Variant *StructuralVariant
+	Points  [][3]float32
+	Color   MutationColor
+}
+
+// SVOverlay colours particles by structural variant
+type SVOverlay struct {
+	set            *StructuralVariantSet
+	breakendRadius uint64
+}
+
+// NewSVOverlay creates an overlay over a variant set
+func NewSVOverlay(set *StructuralVariantSet, breakendRadius uint64) *SVOverlay {
+	return &SVOverlay{set: set, breakendRadius: breakendRadius}
+}
+
+// breakpoints returns a variant's breakpoint positions on a chromosome
+func (sv *StructuralVariant) breakpoints(chromosome string) []uint64 {
+	var positions []uint64
+	if sv.Chromosome == chromosome {
+		positions = append(positions, sv.Position)
+	}
+	if sv.HasMate() && sv.MateChromosome == chromosome {
+		positions = append(positions, sv.MatePosition)
+	}
+	return positions
+}
+
+// GetParticleColor returns the most prominent structural variant colour at
+// a position
+func (o *SVOverlay) GetParticleColor(chromosome string, position uint64) (MutationColor, bool) {
+	chromosome = matchChromosome(chromosome, o.set.chromosomes)
+	start := position - min(position, o.breakendRadius)
+
+	best, found := MutationColor{}, false
+	for _, sv := range o.set.Overlapping(chromosome, start, position+o.breakendRadius) {
+		base := SVColors[sv.Type]
+		strength := 0.0
+
+		for _, breakpoint := range sv.breakpoints(chromosome) {
+			distance := float64(max(breakpoint, position) - min(breakpoint, position))
+			if distance <= float64(o.breakendRadius) {
+				strength = math.Max(strength, 1-distance/float64(o.breakendRadius+1))
+			}
+		}
+		if spanStart, spanEnd, ok := sv.Span(); ok && position >= spanStart && position <= spanEnd {
+			strength = math.Max(strength, spanOpacity)
+		}
+
+		if strength > 0 && (!found || float32(strength)*base.A > best.A) {
+			best = base
+			best.A = base.A * float32(strength)
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Highlights returns the affected spans and breakpoint neighbourhoods
+// overlapping a view window, for drawing as bands
+func (o *SVOverlay) Highlights(chromosome string, start, end uint64) []*SVHighlight {
+	chromosome = matchChromosome(chromosome, o.set.chromosomes)
+	from := start - min(start, o.breakendRadius)
+
+	var highlights []*SVHighlight
+	for _, sv := range o.set.Overlapping(chromosome, from, end+o.breakendRadius) {
+		color := SVColors[sv.Type]
+
+		if spanStart, spanEnd, ok := sv.Span(); ok && spanEnd >= start && spanStart <= end {
+			spanColor := color
+			spanColor.A *= spanOpacity
+			highlights = append(highlights, &SVHighlight{
+				Variant:    sv,
+				Chromosome: chromosome,
+				Start:      max(spanStart, start),
+				End:        min(spanEnd, end),
+				Color:      spanColor,
+			})
+		}
+		for _, breakpoint := range sv.breakpoints(chromosome) {
+			bandStart := breakpoint - min(breakpoint, o.breakendRadius)
+			bandEnd := breakpoint + o.breakendRadius
+			if bandEnd < start || bandStart > end {
+				continue
+			}
+			highlights = append(highlights, &SVHighlight{
+				Variant:    sv,
+				Chromosome: chromosome,
+				Start:      max(bandStart, start),
+				End:        min(bandEnd, end),
+				Breakpoint: true,
+				Color:      color,
+			})
+		}
+	}
+	return highlights
+}
+
+// Arcs builds a curve of segments+1 points for every variant with two
+// breakpoints on chromosomes known to the coordinate system. With
+// interChromosomalOnly, only translocations are drawn. Breakpoints the
+// coordinate system cannot place (unplaced contigs, chrM) are skipped.
+func (o *SVOverlay) Arcs(cs *navigation.CoordinateSystem, segments int, interChromosomalOnly bool) []*SVArc {
+	segments = max(segments, 1)
+
+	var arcs []*SVArc
+	for _, sv := range o.set.Variants() {
+		if !sv.HasMate() || (interChromosomalOnly && !sv.IsInterChromosomal()) {
+			continue
+		}
+		if sv.Position == sv.MatePosition && !sv.IsInterChromosomal() {
+			continue // Insertions have nothing to join
+		}
+
+		from, err := cs.GenomicTo3D(helixChromosome(sv.Chromosome), sv.Position)
+		if err != nil {
+			continue
+		}
+		to, err := cs.GenomicTo3D(helixChromosome(sv.MateChromosome), sv.MatePosition)
+		if err != nil {
+			continue
+		}
+
+		arcs = append(arcs, &SVArc{
+			Variant: sv,
+			Points:  bezierArc(from, to, segments),
+			Color:   SVColors[sv.Type],
+		})
+	}
+	return arcs
+}
+
+// helixChromosome maps a chromosome to the coordinate system's "chrN"
+// naming
+func helixChromosome(name string) string {
+	if strings.HasPrefix(name, "chr") {
+		return name
+	}
+	return "chr" + name
+}
+
+// bezierArc samples a quadratic Bézier from a to b whose control point is
+// the midpoint pushed radially away from the helix (y) axis by half the
+// chord length
+func bezierArc(a, b [3]float32, segments int) [][3]float32 {
+	var mid, chord [3]float64
+	for k := 0; k < 3; k++ {
+		mid[k] = (float64(a[k]) + float64(b[k])) / 2
+		chord[k] = float64(b[k]) - float64(a[k])
+	}
+	length := math.Sqrt(chord[0]*chord[0] + chord[1]*chord[1] + chord[2]*chord[2])
+
+	// Radial direction of the midpoint; straight up when on the axis
+	direction := [3]float64{mid[0], 0, mid[2]}
+	if norm := math.Hypot(mid[0], mid[2]); norm > 1e-9 {
+		direction[0], direction[2] = mid[0]/norm, mid[2]/norm
+	} else {
+		direction = [3]float64{0, 1, 0}
+	}
+	var control [3]float64
+	for k := 0; k < 3; k++ {
+		control[k] = mid[k] + direction[k]*length/2
+	}
+
+	points := make([][3]float32, segments+1)
+	for i := range points {
+		t := float64(i) / float64(segments)
+		for k := 0; k < 3; k++ {
+			value := (1-t)*(1-t)*float64(a[k]) + 2*(1-t)*t*control[k] + t*t*float64(b[k])
+			points[i][k] = float32(value)
+		}
+	}
+	return points
+}
+
+// GetStatistics returns overlay statistics
+func (o *SVOverlay) GetStatistics() map[string]interface{} {
+	stats := o.set.GetStatistics()
+	stats["breakend_radius"] = o.breakendRadius
+	return stats
+}
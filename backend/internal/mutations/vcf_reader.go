@@ -0,0 +1,888 @@
+/**
+ * VCF 4.2/4.3 Reader
+ *
+ * Streams variant records from plain, gzip or bgzip-compressed VCF files.
+ * bgzip files with a tabix index (.tbi) support region queries that seek
+ * directly to the relevant blocks.
+ *
+ * Columns: CHROM, POS, ID, REF, ALT, QUAL, FILTER, INFO, [FORMAT, samples...]
+ *
+ * Records convert to Mutation values (one per ALT allele), so VCF input
+ * feeds COSMICParser, MutationOverlay and HotspotDetector unchanged.
+ */
+
+package mutations
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"genomevedic/internal/bgzf"
+)
+
+// VCFFieldDef is an INFO or FORMAT definition from the header
+type VCFFieldDef struct {
+	ID          string
+	Number      string // Integer, "A" (per ALT), "R" (per allele), "G" (per genotype) or "."
+	Type        string
+	Description string
+}
+
+// VCFHeader holds the meta-information lines and sample names
+type VCFHeader struct {
+	FileFormat string   // e.g. "VCFv4.2"
+	Meta       []string // All "##" lines, without the prefix
+	Info       map[string]*VCFFieldDef
+	Format     map[string]*VCFFieldDef
+	Contigs    map[string]int64 // Contig lengths (0 when not declared)
+	Samples    []string
+}
+
+// VCFGenotype is one sample's FORMAT data
+type VCFGenotype struct {
+	Alleles []int // Allele indexes (0 = REF), -1 for missing
+	Phased  bool
+	Fields  map[string]string // All FORMAT values by key, including GT
+}
+
+// VCFRecord is a single VCF data line
+type VCFRecord struct {
+	Chromosome string
+	Position   uint64 // 1-based
+	IDs        []string
+	Ref        string
+	Alts       []string
+	Qual       float64           // NaN when missing
+	Filters    []string          // Empty when missing ("."), ["PASS"] when passed
+	Info       map[string]string // Flags map to ""
+	Format     []string
+	Genotypes  []VCFGenotype
+	header     *VCFHeader
+}
+
+// lineSource yields lines without trailing newlines
+type lineSource interface {
+	ReadLine() ([]byte, error)
+}
+
+// scannerLines adapts bufio.Scanner to lineSource
+type scannerLines struct {
+	scanner *bufio.Scanner
+}
+
+func (sl *scannerLines) ReadLine() ([]byte, error) {
+	if sl.scanner.Scan() {
+		return sl.scanner.Bytes(), nil
+	}
+	if err := sl.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// vcfRegion tracks a tabix region query
+type vcfRegion struct {
+	chrom  string
+	start  uint64 // 1-based inclusive
+	end    uint64
+	chunks []bgzf.Chunk
+	next   int
+	active bool
+}
+
+// VCFReader streams records from a VCF file
+type VCFReader struct {
+	header  *VCFHeader
+	lines   lineSource
+	bgzf    *bgzf.Reader // Non-nil for bgzip input
+	closer  io.Closer
+	index   *bgzf.Tabix
+	region  *vcfRegion
+	lineNum int
+}
+
+// NewVCFReader reads the header from an uncompressed VCF stream
+func NewVCFReader(reader io.Reader) (*VCFReader, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+
+	vr := &VCFReader{lines: &scannerLines{scanner: scanner}}
+	if err := vr.readHeader(); err != nil {
+		return nil, err
+	}
+	return vr, nil
+}
+
+// OpenVCF opens a plain, gzip or bgzip VCF file. A tabix index next to a
+// bgzip file (<path>.tbi) is loaded automatically for Query.
+func OpenVCF(path string) (*VCFReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open VCF: %w", err)
+	}
+
+	magic := make([]byte, bgzf.HeaderSize)
+	n, _ := file.ReadAt(magic, 0)
+	magic = magic[:n]
+
+	vr := &VCFReader{closer: file}
+	switch {
+	case bgzf.IsBGZF(magic):
+		vr.bgzf = bgzf.NewReader(file)
+		vr.lines = vr.bgzf
+		if _, err := os.Stat(path + ".tbi"); err == nil {
+			index, err := bgzf.LoadTabix(path + ".tbi")
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+			vr.index = index
+		}
+
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		scanner := bufio.NewScanner(gz)
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		vr.lines = &scannerLines{scanner: scanner}
+
+	default:
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		vr.lines = &scannerLines{scanner: scanner}
+	}
+
+	if err := vr.readHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return vr, nil
+}
+
+// Header returns the parsed header
+func (vr *VCFReader) Header() *VCFHeader {
+	return vr.header
+}
+
+// Indexed reports whether region queries are available
+func (vr *VCFReader) Indexed() bool {
+	return vr.index != nil
+}
+
+// Close closes the underlying file
+func (vr *VCFReader) Close() error {
+	if vr.closer == nil {
+		return nil
+	}
+	return vr.closer.Close()
+}
+
+// readHeader parses "##" meta lines and the "#CHROM" column header
+func (vr *VCFReader) readHeader() error {
+	header := &VCFHeader{
+		Info:    make(map[string]*VCFFieldDef),
+		Format:  make(map[string]*VCFFieldDef),
+		Contigs: make(map[string]int64),
+	}
+
+	for {
+		line, err := vr.lines.ReadLine()
+		if err == io.EOF {
+			return fmt.Errorf("VCF header has no #CHROM line")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read VCF header: %w", err)
+		}
+		vr.lineNum++
+
+		text := string(line)
+		switch {
+		case strings.HasPrefix(text, "##"):
+			meta := text[2:]
+			header.Meta = append(header.Meta, meta)
+			key, value, _ := strings.Cut(meta, "=")
+			switch key {
+			case "fileformat":
+				header.FileFormat = value
+			case "INFO", "FORMAT":
+				def := parseFieldDef(value)
+				if def.ID == "" {
+					return fmt.Errorf("line %d: %s definition without ID", vr.lineNum, key)
+				}
+				if key == "INFO" {
+					header.Info[def.ID] = def
+				} else {
+					header.Format[def.ID] = def
+				}
+			case "contig":
+				attrs := parseStructuredMeta(value)
+				length, _ := strconv.ParseInt(attrs["length"], 10, 64)
+				header.Contigs[attrs["ID"]] = length
+			}
+
+		case strings.HasPrefix(text, "#CHROM"):
+			columns := strings.Split(text, "\t")
+			if len(columns) < 8 {
+				return fmt.Errorf("line %d: expected at least 8 header columns, got %d", vr.lineNum, len(columns))
+			}
+			if len(columns) > 9 {
+				header.Samples = columns[9:]
+			}
+			vr.header = header
+			return nil
+
+		default:
+			return fmt.Errorf("line %d: data line before #CHROM header", vr.lineNum)
+		}
+	}
+}
+
+// parseStructuredMeta parses "<ID=x,Number=1,Description="a, b">" values
+func parseStructuredMeta(value string) map[string]string {
+	attrs := make(map[string]string)
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+
+	for len(value) > 0 {
+		key, rest, found := strings.Cut(value, "=")
+		if !found {
+			break
+		}
+		var val string
+		if strings.HasPrefix(rest, "\"") {
+			// Quoted value: runs to the next unescaped quote
+			end := 1
+			for end < len(rest) && (rest[end] != '"' || rest[end-1] == '\\') {
+				end++
+			}
+			val = strings.ReplaceAll(rest[1:min(end, len(rest))], "\\\"", "\"")
+			rest = rest[min(end+1, len(rest)):]
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+		attrs[strings.TrimSpace(key)] = val
+		value = strings.TrimPrefix(rest, ",")
+	}
+	return attrs
+}
+
+// parseFieldDef parses an INFO or FORMAT definition
+func parseFieldDef(value string) *VCFFieldDef {
+	attrs := parseStructuredMeta(value)
+	return &VCFFieldDef{
+		ID:          attrs["ID"],
+		Number:      attrs["Number"],
+		Type:        attrs["Type"],
+		Description: attrs["Description"],
+	}
+}
+
+// Query restricts subsequent Read calls to records overlapping
+// chromosome:start-end (1-based, inclusive) using the tabix index
+func (vr *VCFReader) Query(chromosome string, start, end uint64) error {
+	if vr.index == nil || vr.bgzf == nil {
+		return fmt.Errorf("region queries require a bgzip-compressed VCF with a tabix index")
+	}
+	if start == 0 {
+		start = 1
+	}
+	if end < start {
+		return fmt.Errorf("invalid region %s:%d-%d", chromosome, start, end)
+	}
+
+	// Accept both "chr17" and "17" naming
+	name := chromosome
+	for _, candidate := range []string{chromosome, "chr" + chromosome, strings.TrimPrefix(chromosome, "chr")} {
+		if vr.index.HasSequence(candidate) {
+			name = candidate
+			break
+		}
+	}
+
+	vr.region = &vcfRegion{
+		chrom:  name,
+		start:  start,
+		end:    end,
+		chunks: vr.index.Chunks(name, int64(start-1), int64(end)),
+	}
+	return nil
+}
+
+// Read returns the next record, or io.EOF when the file (or region) is exhausted
+func (vr *VCFReader) Read() (*VCFRecord, error) {
+	for {
+		line, err := vr.nextLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		record, err := vr.parseRecord(string(line))
+		if err != nil {
+			return nil, fmt.Errorf("VCF line %d: %w", vr.lineNum, err)
+		}
+
+		if region := vr.region; region != nil {
+			if record.Chromosome != region.chrom || record.Position > region.end {
+				// Records are sorted: nothing later in the file can overlap
+				region.active = false
+				region.next = len(region.chunks)
+				return nil, io.EOF
+			}
+			if record.End() < region.start {
+				continue
+			}
+		}
+		return record, nil
+	}
+}
+
+// nextLine returns the next raw line, following region chunks when querying
+func (vr *VCFReader) nextLine() ([]byte, error) {
+	region := vr.region
+	if region == nil {
+		vr.lineNum++
+		return vr.lines.ReadLine()
+	}
+
+	for {
+		if region.active && vr.bgzf.VirtualOffset() < region.chunks[region.next-1].End {
+			line, err := vr.bgzf.ReadLine()
+			if err == io.EOF {
+				region.active = false
+				continue
+			}
+			vr.lineNum++
+			return line, err
+		}
+		if region.next >= len(region.chunks) {
+			return nil, io.EOF
+		}
+		if err := vr.bgzf.Seek(region.chunks[region.next].Begin); err != nil {
+			return nil, err
+		}
+		region.next++
+		region.active = true
+	}
+}
+
+// parseRecord parses one tab-separated data line
+func (vr *VCFReader) parseRecord(line string) (*VCFRecord, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 8 {
+		return nil, fmt.Errorf("expected at least 8 columns, got %d", len(fields))
+	}
+
+	position, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid position: %w", err)
+	}
+
+	record := &VCFRecord{
+		Chromosome: fields[0],
+		Position:   position,
+		Ref:        strings.ToUpper(fields[3]),
+		Qual:       math.NaN(),
+		Info:       make(map[string]string),
+		header:     vr.header,
+	}
+
+	if fields[2] != "." {
+		record.IDs = strings.Split(fields[2], ";")
+	}
+	if fields[4] != "." {
+		record.Alts = strings.Split(fields[4], ",")
+	}
+	if fields[5] != "." {
+		if record.Qual, err = strconv.ParseFloat(fields[5], 64); err != nil {
+			return nil, fmt.Errorf("invalid QUAL %q", fields[5])
+		}
+	}
+	if fields[6] != "." {
+		record.Filters = strings.Split(fields[6], ";")
+	}
+	if fields[7] != "." {
+		for _, entry := range strings.Split(fields[7], ";") {
+			key, value, _ := strings.Cut(entry, "=")
+			record.Info[key] = decodeVCFValue(value)
+		}
+	}
+
+	if len(fields) > 8 {
+		record.Format = strings.Split(fields[8], ":")
+		samples := fields[9:]
+		if len(vr.header.Samples) > 0 && len(samples) != len(vr.header.Samples) {
+			return nil, fmt.Errorf("expected %d samples, got %d", len(vr.header.Samples), len(samples))
+		}
+		record.Genotypes = make([]VCFGenotype, len(samples))
+		for i, sample := range samples {
+			genotype, err := parseGenotype(record.Format, sample)
+			if err != nil {
+				return nil, fmt.Errorf("sample %d: %w", i+1, err)
+			}
+			record.Genotypes[i] = genotype
+		}
+	}
+
+	return record, nil
+}
+
+// parseGenotype parses one sample column against the FORMAT keys
+func parseGenotype(format []string, sample string) (VCFGenotype, error) {
+	genotype := VCFGenotype{Fields: make(map[string]string, len(format))}
+	values := strings.Split(sample, ":")
+	for i, key := range format {
+		// Trailing fields may be dropped
+		if i < len(values) {
+			genotype.Fields[key] = values[i]
+		}
+	}
+
+	gt, ok := genotype.Fields["GT"]
+	if !ok || gt == "" {
+		return genotype, nil
+	}
+	genotype.Phased = strings.Contains(gt, "|")
+	for _, allele := range strings.FieldsFunc(gt, func(r rune) bool { return r == '/' || r == '|' }) {
+		if allele == "." {
+			genotype.Alleles = append(genotype.Alleles, -1)
+			continue
+		}
+		index, err := strconv.Atoi(allele)
+		if err != nil || index < 0 {
+			return genotype, fmt.Errorf("invalid GT %q", gt)
+		}
+		genotype.Alleles = append(genotype.Alleles, index)
+	}
+	return genotype, nil
+}
+
+// decodeVCFValue decodes VCF 4.3 percent-encoding (%3A, %3B, %3D, %25, %2C, ...)
+func decodeVCFValue(value string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '%' && i+2 < len(value) {
+			if b, err := strconv.ParseUint(value[i+1:i+3], 16, 8); err == nil {
+				sb.WriteByte(byte(b))
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(value[i])
+	}
+	return sb.String()
+}
+
+// Carries reports whether the genotype contains the given allele
+func (g *VCFGenotype) Carries(allele int) bool {
+	for _, a := range g.Alleles {
+		if a == allele {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMissing reports whether no allele was called
+func (g *VCFGenotype) IsMissing() bool {
+	for _, a := range g.Alleles {
+		if a >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// End returns the last reference position covered by the record (1-based)
+func (r *VCFRecord) End() uint64 {
+	if end, err := strconv.ParseUint(r.Info["END"], 10, 64); err == nil && end >= r.Position {
+		return end
+	}
+	return r.Position + uint64(len(r.Ref)) - 1
+}
+
+// Passed reports whether the record passed all filters (or was not filtered)
+func (r *VCFRecord) Passed() bool {
+	return len(r.Filters) == 0 || (len(r.Filters) == 1 && r.Filters[0] == "PASS")
+}
+
+// HasQual reports whether QUAL was given
+func (r *VCFRecord) HasQual() bool {
+	return !math.IsNaN(r.Qual)
+}
+
+// AltInfo returns the INFO value for one ALT allele, honouring Number=A/R
+// definitions; other fields return the whole value
+func (r *VCFRecord) AltInfo(key string, altIndex int) string {
+	value, ok := r.Info[key]
+	if !ok {
+		return ""
+	}
+	number := ""
+	if r.header != nil {
+		if def, ok := r.header.Info[key]; ok {
+			number = def.Number
+		}
+	}
+
+	values := strings.Split(value, ",")
+	switch {
+	case number == "A" && altIndex < len(values):
+		return values[altIndex]
+	case number == "R" && altIndex+1 < len(values):
+		return values[altIndex+1]
+	case number == "A" || number == "R":
+		return ""
+	}
+	// Undeclared per-allele fields: pick by position when counts line up
+	if number == "" && len(values) == len(r.Alts) && len(values) > 1 {
+		return values[altIndex]
+	}
+	return value
+}
+
+// AlleleFraction returns the variant allele fraction of an ALT allele in a
+// sample, from FORMAT AF or from AD allele depths
+func (r *VCFRecord) AlleleFraction(sample, altIndex int) (float64, bool) {
+	if sample < 0 || sample >= len(r.Genotypes) {
+		return 0, false
+	}
+	fields := r.Genotypes[sample].Fields
+
+	if af, ok := fields["AF"]; ok {
+		values := strings.Split(af, ",")
+		if altIndex < len(values) {
+			if v, err := strconv.ParseFloat(values[altIndex], 64); err == nil {
+				return v, true
+			}
+		}
+	}
+
+	if ad, ok := fields["AD"]; ok {
+		depths := strings.Split(ad, ",")
+		total, alt := 0.0, -1.0
+		for i, d := range depths {
+			v, err := strconv.ParseFloat(d, 64)
+			if err != nil {
+				continue
+			}
+			total += v
+			if i == altIndex+1 {
+				alt = v
+			}
+		}
+		if alt >= 0 && total > 0 {
+			return alt / total, true
+		}
+	}
+	return 0, false
+}
+
+// IsSymbolicAllele reports whether an ALT is symbolic (<DEL>, <*>),
+// a breakend (G]17:198982]) or the spanning-deletion allele (*)
+func IsSymbolicAllele(alt string) bool {
+	return strings.HasPrefix(alt, "<") || strings.ContainsAny(alt, "[]") || alt == "*" ||
+		strings.HasPrefix(alt, ".") || strings.HasSuffix(alt, ".")
+}
+
+// Mutations converts the record to one Mutation per ALT allele.
+// Spanning deletions (*) and gVCF reference blocks (<*>, <NON_REF>) are skipped.
+func (r *VCFRecord) Mutations() []*Mutation {
+	mutations := make([]*Mutation, 0, len(r.Alts))
+
+	for i, alt := range r.Alts {
+		alt = strings.ToUpper(alt)
+		if alt == "*" || alt == "<*>" || alt == "<NON_REF>" {
+			continue
+		}
+
+		position, ref, trimmedAlt := r.Position, r.Ref, alt
+		if !IsSymbolicAllele(alt) {
+			position, ref, trimmedAlt = TrimAlleles(r.Position, r.Ref, alt)
+		}
+
+		consequence, gene := r.consequence(i, alt)
+		mutation := &Mutation{
+			Chromosome:   r.Chromosome,
+			Position:     position,
+			RefAllele:    ref,
+			AltAllele:    trimmedAlt,
+			MutationType: parseMutationType(consequence),
+			Gene:         gene,
+			SampleCount:  r.sampleCount(i),
+			Significance: parseVCFSignificance(r.AltInfo("CLNSIG", i)),
+		}
+		if af, err := strconv.ParseFloat(r.AltInfo("AF", i), 64); err == nil {
+			mutation.Frequency = af
+		}
+		mutation.HGVSc, mutation.HGVSp = r.hgvs(i, alt)
+
+		mutations = append(mutations, mutation)
+	}
+
+	return mutations
+}
+
+// TrimAlleles removes bases shared by REF and ALT (suffix first, then
+// prefix), keeping at least one base in each allele
+func TrimAlleles(position uint64, ref, alt string) (uint64, string, string) {
+	for len(ref) > 1 && len(alt) > 1 && ref[len(ref)-1] == alt[len(alt)-1] {
+		ref, alt = ref[:len(ref)-1], alt[:len(alt)-1]
+	}
+	for len(ref) > 1 && len(alt) > 1 && ref[0] == alt[0] {
+		ref, alt = ref[1:], alt[1:]
+		position++
+	}
+	return position, ref, alt
+}
+
+// sampleCount returns the number of samples carrying an ALT allele: the
+// COSMIC CNT field when present, otherwise counted from genotypes
+func (r *VCFRecord) sampleCount(altIndex int) int {
+	if count, err := strconv.Atoi(r.AltInfo("CNT", altIndex)); err == nil {
+		return count
+	}
+	if len(r.Genotypes) == 0 {
+		return 1 // Sites-only VCF: one observation
+	}
+	count := 0
+	for i := range r.Genotypes {
+		if r.Genotypes[i].Carries(altIndex + 1) {
+			count++
+		}
+	}
+	return count
+}
+
+// consequence returns the consequence term and gene for an ALT allele from
+// VEP (CSQ), snpEff (ANN) or simple INFO annotations
+func (r *VCFRecord) consequence(altIndex int, alt string) (string, string) {
+	gene := vcfGeneSymbol(r.Info)
+
+	if entries, columns := r.csqEntries(alt); entries != nil {
+		consequenceCol, symbolCol := indexOf(columns, "Consequence"), indexOf(columns, "SYMBOL")
+		for _, values := range entries {
+			if consequenceCol >= 0 && consequenceCol < len(values) {
+				if symbolCol >= 0 && symbolCol < len(values) && values[symbolCol] != "" {
+					gene = values[symbolCol]
+				}
+				return firstTerm(values[consequenceCol]), gene
+			}
+		}
+	}
+
+	if ann, ok := r.Info["ANN"]; ok {
+		// snpEff: Allele|Annotation|Impact|Gene_Name|...
+		for _, entry := range strings.Split(ann, ",") {
+			values := strings.Split(entry, "|")
+			if len(values) < 4 || (values[0] != alt && len(r.Alts) > 1) {
+				continue
+			}
+			if values[3] != "" {
+				gene = values[3]
+			}
+			return firstTerm(values[1]), gene
+		}
+	}
+
+	for _, key := range []string{"MC", "CONSEQUENCE", "VC"} {
+		if value := r.AltInfo(key, altIndex); value != "" {
+			// ClinVar MC: "SO:0001583|missense_variant"
+			if _, term, found := strings.Cut(value, "|"); found {
+				value = term
+			}
+			return firstTerm(value), gene
+		}
+	}
+	return "", gene
+}
+
+// hgvs returns the HGVS coding and protein notation for an ALT allele from
+// VEP (CSQ HGVSc/HGVSp, preferring MANE, canonical and picked transcripts),
+// snpEff (ANN HGVS.c/HGVS.p) or COSMIC (CDS/AA)
+func (r *VCFRecord) hgvs(altIndex int, alt string) (string, string) {
+	if entries, columns := r.csqEntries(alt); entries != nil {
+		cCol, pCol := indexOf(columns, "HGVSc"), indexOf(columns, "HGVSp")
+		for _, values := range entries {
+			var hgvsc, hgvsp string
+			if cCol >= 0 && cCol < len(values) {
+				hgvsc = decodeVCFValue(values[cCol])
+			}
+			if pCol >= 0 && pCol < len(values) {
+				hgvsp = decodeVCFValue(values[pCol])
+			}
+			if hgvsc != "" || hgvsp != "" {
+				return hgvsc, hgvsp
+			}
+		}
+	}
+
+	if ann, ok := r.Info["ANN"]; ok {
+		for _, entry := range strings.Split(ann, ",") {
+			values := strings.Split(entry, "|")
+			if len(values) < 11 || (values[0] != alt && len(r.Alts) > 1) {
+				continue
+			}
+			if values[9] != "" || values[10] != "" {
+				return values[9], values[10]
+			}
+		}
+	}
+
+	// COSMIC CDS/AA (AA means "ancestral allele" elsewhere, so require p.)
+	var hgvsc, hgvsp string
+	if cds := r.AltInfo("CDS", altIndex); strings.HasPrefix(cds, "c.") {
+		hgvsc = cds
+	}
+	if aa := r.AltInfo("AA", altIndex); strings.HasPrefix(aa, "p.") {
+		hgvsp = aa
+	}
+	return hgvsc, hgvsp
+}
+
+// csqEntries returns the VEP CSQ entries for an ALT allele split into
+// fields, with the MANE Select transcript first, then the canonical one,
+// then the one flagged by --pick; otherwise in annotation order. Entries
+// are nil when the record has no CSQ.
+func (r *VCFRecord) csqEntries(alt string) ([][]string, []string) {
+	csq, ok := r.Info["CSQ"]
+	if !ok {
+		return nil, nil
+	}
+	columns := r.csqColumns()
+	alleleCol := indexOf(columns, "Allele")
+	maneCol, canonicalCol, pickCol := indexOf(columns, "MANE_SELECT"), indexOf(columns, "CANONICAL"), indexOf(columns, "PICK")
+	if maneCol < 0 {
+		maneCol = indexOf(columns, "MANE") // VEP < 104
+	}
+
+	type rankedEntry struct {
+		values []string
+		rank   int
+	}
+	var ranked []rankedEntry
+	for _, entry := range strings.Split(csq, ",") {
+		values := strings.Split(entry, "|")
+		if alleleCol >= 0 && alleleCol < len(values) && !vepAlleleMatches(values[alleleCol], r.Ref, alt) {
+			continue
+		}
+		field := func(col int) string {
+			if col >= 0 && col < len(values) {
+				return values[col]
+			}
+			return ""
+		}
+		rank := 3
+		switch {
+		case field(maneCol) != "":
+			rank = 0
+		case field(canonicalCol) == "YES":
+			rank = 1
+		case field(pickCol) == "1":
+			rank = 2
+		}
+		ranked = append(ranked, rankedEntry{values, rank})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].rank < ranked[j].rank })
+
+	entries := make([][]string, len(ranked))
+	for i, entry := range ranked {
+		entries[i] = entry.values
+	}
+	return entries, columns
+}
+
+// csqColumns returns the VEP CSQ field names declared in the header
+func (r *VCFRecord) csqColumns() []string {
+	if r.header == nil {
+		return nil
+	}
+	def, ok := r.header.Info["CSQ"]
+	if !ok {
+		return nil
+	}
+	_, format, found := strings.Cut(def.Description, "Format: ")
+	if !found {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(format), "|")
+}
+
+// vepAlleleMatches compares a VEP CSQ Allele (which drops the shared
+// leading base of indels, and uses "-" for deletions) with an ALT
+func vepAlleleMatches(vepAllele, ref, alt string) bool {
+	if vepAllele == alt {
+		return true
+	}
+	if len(ref) > 0 && len(alt) > 0 && ref[0] == alt[0] {
+		trimmed := alt[1:]
+		if trimmed == "" {
+			trimmed = "-"
+		}
+		return vepAllele == trimmed
+	}
+	return false
+}
+
+// vcfGeneSymbol extracts the gene symbol from common INFO conventions
+func vcfGeneSymbol(info map[string]string) string {
+	for _, key := range []string{"GENE", "SYMBOL", "Gene"} {
+		if gene := info[key]; gene != "" {
+			// COSMIC appends transcript IDs: "TP53_ENST00000269305"
+			gene, _, _ = strings.Cut(gene, "_")
+			return gene
+		}
+	}
+	if geneInfo := info["GENEINFO"]; geneInfo != "" {
+		// ClinVar: "TP53:7157|..."
+		symbol, _, _ := strings.Cut(geneInfo, ":")
+		return symbol
+	}
+	return ""
+}
+
+// parseVCFSignificance maps ClinVar CLNSIG values, including combined
+// terms such as "Pathogenic/Likely_pathogenic", to Significance
+func parseVCFSignificance(clnsig string) Significance {
+	value := strings.ToLower(strings.ReplaceAll(clnsig, " ", "_"))
+	switch value {
+	case "pathogenic/likely_pathogenic":
+		return SignificanceLikelyPathogenic
+	case "benign/likely_benign":
+		return SignificanceLikelyBenign
+	case "uncertain_significance", "conflicting_interpretations_of_pathogenicity":
+		return SignificanceUncertain
+	}
+	return parseSignificance(value)
+}
+
+// firstTerm returns the most severe (first) term of "a&b" consequence lists
+func firstTerm(value string) string {
+	term, _, _ := strings.Cut(value, "&")
+	return term
+}
+
+// indexOf returns the index of value in values, or -1
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,231 @@
+package mutations
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"genomevedic/internal/bgzf"
+)
+
+// testVCFHeader declares the INFO and FORMAT fields used by the tests
+const testVCFHeader = "##fileformat=VCFv4.3\n" +
+	"##contig=<ID=chr17,length=83257441>\n" +
+	"##INFO=<ID=AF,Number=A,Type=Float,Description=\"Allele frequency, per ALT\">\n" +
+	"##INFO=<ID=AD_R,Number=R,Type=Integer,Description=\"Depth per allele\">\n" +
+	"##INFO=<ID=DB,Number=0,Type=Flag,Description=\"dbSNP membership\">\n" +
+	"##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">\n" +
+	"##FORMAT=<ID=AD,Number=R,Type=Integer,Description=\"Allelic depths\">\n" +
+	"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\ttumor\tnormal\n"
+
+// readAll drains a reader
+func readAll(t *testing.T, reader *VCFReader) []*VCFRecord {
+	t.Helper()
+	var records []*VCFRecord
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+// TestVCFHeader parses meta lines, field definitions, contigs and samples
+func TestVCFHeader(t *testing.T) {
+	reader, err := NewVCFReader(strings.NewReader(testVCFHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := reader.Header()
+	if header.FileFormat != "VCFv4.3" || len(header.Meta) != 7 {
+		t.Errorf("Unexpected meta: %q %d", header.FileFormat, len(header.Meta))
+	}
+	if af := header.Info["AF"]; af == nil || af.Number != "A" || af.Description != "Allele frequency, per ALT" {
+		t.Errorf("Unexpected AF definition %+v", af)
+	}
+	if header.Format["AD"] == nil || header.Contigs["chr17"] != 83257441 {
+		t.Errorf("Unexpected FORMAT or contigs: %v %v", header.Format, header.Contigs)
+	}
+	if strings.Join(header.Samples, ",") != "tumor,normal" {
+		t.Errorf("Unexpected samples %v", header.Samples)
+	}
+
+	for _, bad := range []string{
+		"##fileformat=VCFv4.2\n",
+		"##fileformat=VCFv4.2\nchr1\t1\t.\tA\tG\t.\t.\t.\n",
+		"##INFO=<Number=1,Type=Integer>\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n",
+	} {
+		if _, err := NewVCFReader(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected header error for %q", bad)
+		}
+	}
+}
+
+// TestVCFMultiAllelic splits per-allele INFO fields and converts each ALT
+func TestVCFMultiAllelic(t *testing.T) {
+	vcf := testVCFHeader +
+		"chr17\t7675088\trs1;COSV1\tCAG\tTAG,C,<DEL>\t50\tPASS\tAF=0.1,0.2,0.3;AD_R=10,1,2,3;DB;NOTE=a%3Bb\tGT:AD\t0/1:5,5,0,0\t0/0:9,0,0,0\n"
+	reader, err := NewVCFReader(strings.NewReader(vcf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readAll(t, reader)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	record := records[0]
+
+	if strings.Join(record.IDs, ",") != "rs1,COSV1" || record.Qual != 50 || !record.Passed() || record.End() != 7675090 {
+		t.Errorf("Unexpected fixed fields %+v", record)
+	}
+	if _, ok := record.Info["DB"]; !ok || record.Info["NOTE"] != "a;b" {
+		t.Errorf("Unexpected INFO %v", record.Info)
+	}
+	for i, want := range []struct{ af, ad string }{{"0.1", "1"}, {"0.2", "2"}, {"0.3", "3"}} {
+		if got := record.AltInfo("AF", i); got != want.af {
+			t.Errorf("AF[%d] = %q, want %q", i, got, want.af)
+		}
+		if got := record.AltInfo("AD_R", i); got != want.ad {
+			t.Errorf("AD_R[%d] = %q, want %q", i, got, want.ad)
+		}
+	}
+	if got := record.AltInfo("AF", 5); got != "" {
+		t.Errorf("Expected no AF for a missing allele, got %q", got)
+	}
+
+	mutations := record.Mutations()
+	if len(mutations) != 3 {
+		t.Fatalf("Expected 3 mutations, got %d", len(mutations))
+	}
+	if m := mutations[0]; m.Position != 7675088 || m.RefAllele != "C" || m.AltAllele != "T" || m.Frequency != 0.1 {
+		t.Errorf("Unexpected SNV %+v", m)
+	}
+	if m := mutations[1]; m.Position != 7675088 || m.RefAllele != "CAG" || m.AltAllele != "C" || m.Frequency != 0.2 {
+		t.Errorf("Unexpected deletion %+v", m)
+	}
+	if m := mutations[2]; m.AltAllele != "<DEL>" || m.RefAllele != "CAG" {
+		t.Errorf("Unexpected symbolic allele %+v", m)
+	}
+}
+
+// TestVCFGenotypes parses GT and allele fractions per sample
+func TestVCFGenotypes(t *testing.T) {
+	vcf := testVCFHeader +
+		"chr17\t100\t.\tA\tG,T\t.\t.\t.\tGT:AD\t1|2:0,3,1\t./.\n"
+	reader, err := NewVCFReader(strings.NewReader(vcf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := readAll(t, reader)[0]
+
+	tumor, normal := record.Genotypes[0], record.Genotypes[1]
+	if !tumor.Phased || !tumor.Carries(1) || !tumor.Carries(2) || tumor.Carries(0) || tumor.IsMissing() {
+		t.Errorf("Unexpected tumor genotype %+v", tumor)
+	}
+	if !normal.IsMissing() || normal.Fields["AD"] != "" {
+		t.Errorf("Expected missing normal genotype with dropped AD, got %+v", normal)
+	}
+	if vaf, ok := record.AlleleFraction(0, 0); !ok || vaf != 0.75 {
+		t.Errorf("VAF = %v, %v; want 0.75", vaf, ok)
+	}
+	if _, ok := record.AlleleFraction(1, 0); ok {
+		t.Error("Expected no VAF without AD")
+	}
+	if record.HasQual() || !record.Passed() {
+		t.Error("Expected missing QUAL and FILTER")
+	}
+	if record.sampleCount(0) != 1 || record.sampleCount(1) != 1 {
+		t.Errorf("Unexpected sample counts %d, %d", record.sampleCount(0), record.sampleCount(1))
+	}
+
+	bad := testVCFHeader + "chr17\t100\t.\tA\tG\t.\t.\t.\tGT\tx/1\t0/0\n"
+	reader, _ = NewVCFReader(strings.NewReader(bad))
+	if _, err := reader.Read(); err == nil {
+		t.Error("Expected error for an invalid GT")
+	}
+}
+
+// TestVCFTabixQuery compares tabix region queries with a full scan
+func TestVCFTabixQuery(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	var sb strings.Builder
+	sb.WriteString(testVCFHeader)
+	type site struct {
+		chrom    string
+		pos, end uint64
+	}
+	var sites []site
+	for _, chrom := range []string{"chr1", "chr17"} {
+		pos := uint64(1)
+		for i := 0; i < 5000; i++ {
+			pos += uint64(1 + rng.Intn(200))
+			ref := strings.Repeat("A", 1+rng.Intn(30))
+			fmt.Fprintf(&sb, "%s\t%d\tv%d\t%s\tG\t.\tPASS\tAF=0.5\tGT\t0/1\t0/0\n", chrom, pos, len(sites), ref)
+			sites = append(sites, site{chrom, pos, pos + uint64(len(ref)) - 1})
+		}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "calls.vcf.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bgzf.NewWriter(file)
+	w.Write([]byte(sb.String()))
+	w.Close()
+	file.Close()
+
+	file, _ = os.Open(path)
+	index, err := bgzf.BuildTabix(bgzf.NewReader(file), bgzf.VCFTabixConfig)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbi, _ := os.Create(path + ".tbi")
+	if err := index.Write(tbi); err != nil {
+		t.Fatal(err)
+	}
+	tbi.Close()
+
+	reader, err := OpenVCF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if !reader.Indexed() {
+		t.Fatal("Expected the tabix index to be loaded")
+	}
+
+	for _, q := range []site{{"chr1", 1, 100}, {"chr1", 20000, 60000}, {"17", 500000, 500500}, {"chr17", 400000, 10000000}, {"chr2", 1, 1000}} {
+		if err := reader.Query(q.chrom, q.pos, q.end); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, record := range readAll(t, reader) {
+			got = append(got, record.IDs[0])
+		}
+		var want []string
+		for i, s := range sites {
+			if "chr"+strings.TrimPrefix(q.chrom, "chr") == s.chrom && s.pos <= q.end && s.end >= q.pos {
+				want = append(want, fmt.Sprintf("v%d", i))
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s:%d-%d: got %d records, want %d", q.chrom, q.pos, q.end, len(got), len(want))
+		}
+	}
+
+	plain, _ := NewVCFReader(strings.NewReader(testVCFHeader))
+	if err := plain.Query("chr1", 1, 100); err == nil {
+		t.Error("Expected error querying an unindexed VCF")
+	}
+}
@@ -0,0 +1,147 @@
+/**
+ * FASTA Index (.fai)
+ *
+ * samtools faidx index format (5 tab-separated columns per sequence):
+ * 1. name      - Sequence name
+ * 2. length    - Number of bases
+ * 3. offset    - Byte offset of the first base (uncompressed for bgzip files)
+ * 4. linebases - Bases per line
+ * 5. linewidth - Bytes per line, including the newline
+ */
+
+package reference
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FAIEntry describes one sequence in a FASTA file
+type FAIEntry struct {
+	Name      string
+	Length    int64
+	Offset    int64
+	LineBases int64
+	LineWidth int64
+}
+
+// ReadFAI parses a .fai index
+func ReadFAI(r io.Reader) ([]FAIEntry, error) {
+	var entries []FAIEntry
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("line %d: expected 5 fields, got %d", lineNum, len(fields))
+		}
+
+		entry := FAIEntry{Name: fields[0]}
+		values := []*int64{&entry.Length, &entry.Offset, &entry.LineBases, &entry.LineWidth}
+		for i, v := range values {
+			n, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("line %d: invalid field %q", lineNum, fields[i+1])
+			}
+			*v = n
+		}
+		if entry.Length > 0 && (entry.LineBases == 0 || entry.LineWidth < entry.LineBases) {
+			return nil, fmt.Errorf("line %d: invalid line layout for %s", lineNum, entry.Name)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanner error: %w", err)
+	}
+	return entries, nil
+}
+
+// WriteFAI writes entries in .fai format
+func WriteFAI(w io.Writer, entries []FAIEntry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", e.Name, e.Length, e.Offset, e.LineBases, e.LineWidth); err != nil {
+			return fmt.Errorf("failed to write FASTA index: %w", err)
+		}
+	}
+	return nil
+}
+
+// BuildFAI scans an uncompressed FASTA stream and builds its index.
+// Like samtools faidx, it requires every line of a sequence except the
+// last to have the same length.
+func BuildFAI(r io.Reader) ([]FAIEntry, error) {
+	var entries []FAIEntry
+	reader := bufio.NewReaderSize(r, 1<<20)
+
+	var offset int64
+	var current *FAIEntry
+	lastLineShort := false
+	lineNum := 0
+
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("line %d: line too long", lineNum+1)
+		}
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read FASTA: %w", err)
+		}
+		lineNum++
+
+		width := int64(len(line))
+		content := strings.TrimRight(string(line), "\r\n")
+		bases := int64(len(content))
+
+		switch {
+		case strings.HasPrefix(content, ">"):
+			name := strings.Fields(content[1:])
+			if len(name) == 0 {
+				return nil, fmt.Errorf("line %d: sequence without a name", lineNum)
+			}
+			entries = append(entries, FAIEntry{Name: name[0], Offset: offset + width})
+			current = &entries[len(entries)-1]
+			lastLineShort = false
+
+		case current == nil:
+			if bases > 0 {
+				return nil, fmt.Errorf("line %d: sequence data before the first header", lineNum)
+			}
+
+		case bases == 0:
+			lastLineShort = current.Length > 0
+
+		default:
+			if current.LineBases == 0 {
+				current.LineBases = bases
+				current.LineWidth = width
+			} else if lastLineShort || bases > current.LineBases ||
+				(bases == current.LineBases && width != current.LineWidth && err != io.EOF) {
+				return nil, fmt.Errorf("line %d: inconsistent line length in %s", lineNum, current.Name)
+			}
+			lastLineShort = bases < current.LineBases
+			current.Length += bases
+		}
+
+		offset += width
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,193 @@
+/**
+ * Indexed Reference FASTA
+ *
+ * Random access to reference genome subsequences from plain or
+ * bgzip-compressed FASTA files using samtools-style indexes:
+ *   genome.fa      + genome.fa.fai
+ *   genome.fa.gz   + genome.fa.gz.fai + genome.fa.gz.gzi
+ *
+ * Missing indexes are built in memory on open (a full scan of the file),
+ * so pre-built indexes are recommended for whole genomes.
+ */
+
+package reference
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"genomevedic/internal/bgzf"
+)
+
+// FASTA is an indexed reference genome. It is safe for concurrent use.
+type FASTA struct {
+	path    string
+	file    *os.File
+	entries []FAIEntry
+	byName  map[string]int
+	bgzip   bool
+	gzi     bgzf.GZI
+}
+
+// Open opens a FASTA file and its index, building the index if absent
+func Open(path string) (*FASTA, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open FASTA: %w", err)
+	}
+
+	f := &FASTA{
+		path:   path,
+		file:   file,
+		byName: make(map[string]int),
+	}
+	if err := f.loadIndexes(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	for i, entry := range f.entries {
+		f.byName[entry.Name] = i
+	}
+	return f, nil
+}
+
+// loadIndexes detects compression and loads (or builds) the .fai and .gzi indexes
+func (f *FASTA) loadIndexes() error {
+	header := make([]byte, bgzf.HeaderSize)
+	n, _ := f.file.ReadAt(header, 0)
+	header = header[:n]
+
+	if len(header) >= 2 && header[0] == 0x1f && header[1] == 0x8b {
+		if !bgzf.IsBGZF(header) {
+			return fmt.Errorf("%s is gzip-compressed but not BGZF; recompress with bgzip", f.path)
+		}
+		f.bgzip = true
+
+		gzi, err := readIndexFile(f.path+".gzi", bgzf.ReadGZI)
+		if os.IsNotExist(err) {
+			gzi, err = bgzf.BuildGZI(f.file)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load GZI index: %w", err)
+		}
+		f.gzi = gzi
+	}
+
+	entries, err := readIndexFile(f.path+".fai", ReadFAI)
+	if os.IsNotExist(err) {
+		var stream io.Reader = io.NewSectionReader(f.file, 0, 1<<62)
+		if f.bgzip {
+			stream = bgzf.NewReader(f.file)
+		}
+		entries, err = BuildFAI(stream)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load FASTA index: %w", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no sequences found in %s", f.path)
+	}
+	f.entries = entries
+	return nil
+}
+
+// readIndexFile opens path and parses it with parse
+func readIndexFile[T any](path string, parse func(io.Reader) (T, error)) (T, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer file.Close()
+	return parse(file)
+}
+
+// Close closes the underlying file
+func (f *FASTA) Close() error {
+	return f.file.Close()
+}
+
+// Sequences returns the index entries in file order
+func (f *FASTA) Sequences() []FAIEntry {
+	return f.entries
+}
+
+// ResolveName maps a chromosome name to the name used in the file,
+// accepting both "chr17" and "17" styles (and chrM/MT)
+func (f *FASTA) ResolveName(name string) (string, bool) {
+	candidates := []string{name}
+	switch {
+	case name == "chrM" || name == "MT":
+		candidates = append(candidates, "chrM", "MT", "M", "chrMT")
+	case strings.HasPrefix(name, "chr"):
+		candidates = append(candidates, strings.TrimPrefix(name, "chr"))
+	default:
+		candidates = append(candidates, "chr"+name)
+	}
+
+	for _, candidate := range candidates {
+		if _, ok := f.byName[candidate]; ok {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// Length returns the length of a sequence
+func (f *FASTA) Length(name string) (int64, bool) {
+	resolved, ok := f.ResolveName(name)
+	if !ok {
+		return 0, false
+	}
+	return f.entries[f.byName[resolved]].Length, true
+}
+
+// Fetch returns bases [start, end) (0-based, half-open) of a sequence,
+// upper-cased
+func (f *FASTA) Fetch(name string, start, end int64) (string, error) {
+	resolved, ok := f.ResolveName(name)
+	if !ok {
+		return "", fmt.Errorf("sequence %q not found in %s", name, f.path)
+	}
+	entry := f.entries[f.byName[resolved]]
+
+	if start < 0 || end > entry.Length || start > end {
+		return "", fmt.Errorf("range %d-%d outside %s (length %d)", start, end, resolved, entry.Length)
+	}
+	if start == end {
+		return "", nil
+	}
+
+	// Byte range covering the bases, newlines included
+	first := entry.Offset + start/entry.LineBases*entry.LineWidth + start%entry.LineBases
+	last := entry.Offset + (end-1)/entry.LineBases*entry.LineWidth + (end-1)%entry.LineBases
+	raw := make([]byte, last-first+1)
+
+	if f.bgzip {
+		reader := bgzf.NewReader(f.file)
+		if err := reader.Seek(f.gzi.VirtualOffset(first)); err != nil {
+			return "", fmt.Errorf("failed to seek in %s: %w", f.path, err)
+		}
+		if _, err := io.ReadFull(reader, raw); err != nil {
+			return "", fmt.Errorf("failed to read %s:%d-%d: %w", resolved, start, end, err)
+		}
+	} else if _, err := f.file.ReadAt(raw, first); err != nil {
+		return "", fmt.Errorf("failed to read %s:%d-%d: %w", resolved, start, end, err)
+	}
+
+	seq := make([]byte, 0, end-start)
+	for _, b := range raw {
+		if b == '\n' || b == '\r' {
+			continue
+		}
+		seq = append(seq, b)
+	}
+	if int64(len(seq)) != end-start {
+		return "", fmt.Errorf("index does not match %s: expected %d bases, read %d", f.path, end-start, len(seq))
+	}
+	return string(bytes.ToUpper(seq)), nil
+}
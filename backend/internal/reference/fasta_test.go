@@ -0,0 +1,181 @@
+package reference
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"genomevedic/internal/bgzf"
+)
+
+// writeTestFASTA writes sequences wrapped at 60 columns and returns the path
+func writeTestFASTA(t *testing.T, dir string, compress bool, sequences map[string]string, order []string) string {
+	t.Helper()
+
+	var sb strings.Builder
+	for _, name := range order {
+		sb.WriteString(">" + name + " test sequence\n")
+		seq := sequences[name]
+		for i := 0; i < len(seq); i += 60 {
+			end := i + 60
+			if end > len(seq) {
+				end = len(seq)
+			}
+			sb.WriteString(seq[i:end] + "\n")
+		}
+	}
+
+	path := filepath.Join(dir, "genome.fa")
+	if !compress {
+		if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	path += ".gz"
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := bgzf.NewWriter(file)
+	w.Write([]byte(sb.String()))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestFetch tests subsequence access for plain and bgzip FASTA, with and without index files
+func TestFetch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sequences := map[string]string{}
+	for _, name := range []string{"chr1", "chr17"} {
+		seq := make([]byte, 150000+rng.Intn(1000))
+		for i := range seq {
+			seq[i] = "ACGTacgtN"[rng.Intn(9)]
+		}
+		sequences[name] = string(seq)
+	}
+	order := []string{"chr1", "chr17"}
+
+	for _, compress := range []bool{false, true} {
+		for _, withIndex := range []bool{false, true} {
+			dir := t.TempDir()
+			path := writeTestFASTA(t, dir, compress, sequences, order)
+
+			if withIndex {
+				// Build the indexes once, write them, and reopen from disk
+				f, err := Open(path)
+				if err != nil {
+					t.Fatalf("Open failed: %v", err)
+				}
+				fai, _ := os.Create(path + ".fai")
+				WriteFAI(fai, f.Sequences())
+				fai.Close()
+				if compress {
+					gzi, _ := os.Create(path + ".gzi")
+					f.gzi.Write(gzi)
+					gzi.Close()
+				}
+				f.Close()
+			}
+
+			f, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open(compress=%v, index=%v) failed: %v", compress, withIndex, err)
+			}
+
+			if length, ok := f.Length("17"); !ok || length != int64(len(sequences["chr17"])) {
+				t.Errorf("Length(17) = %d, %v", length, ok)
+			}
+
+			for _, r := range [][2]int64{{0, 10}, {55, 125}, {59, 61}, {70000, 70500}, {149990, 150000}} {
+				for _, name := range order {
+					want := strings.ToUpper(sequences[name][r[0]:r[1]])
+					got, err := f.Fetch(name, r[0], r[1])
+					if err != nil || got != want {
+						t.Errorf("compress=%v index=%v Fetch(%s, %d, %d) = %q, %v", compress, withIndex, name, r[0], r[1], got, err)
+					}
+				}
+			}
+
+			if _, err := f.Fetch("chr1", 0, int64(len(sequences["chr1"]))+1); err == nil {
+				t.Error("Expected error for range past the end")
+			}
+			if _, err := f.Fetch("chrZ", 0, 10); err == nil {
+				t.Error("Expected error for unknown sequence")
+			}
+			f.Close()
+		}
+	}
+}
+
+// TestBuildFAIRejectsRaggedLines tests that inconsistent line lengths are reported
+func TestBuildFAIRejectsRaggedLines(t *testing.T) {
+	if _, err := BuildFAI(strings.NewReader(">chr1\nACGT\nAC\nACGT\n")); err == nil {
+		t.Error("Expected error for a short line in the middle of a sequence")
+	}
+
+	entries, err := BuildFAI(strings.NewReader(">chr1 desc\nACGT\nACGT\nAC\n>chr2\nGG"))
+	if err != nil {
+		t.Fatalf("BuildFAI failed: %v", err)
+	}
+	want := []FAIEntry{
+		{Name: "chr1", Length: 10, Offset: 11, LineBases: 4, LineWidth: 5},
+		{Name: "chr2", Length: 2, Offset: 30, LineBases: 2, LineWidth: 2},
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("Entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+// TestReadSequences streams records from plain, gzip and bgzip FASTA
+func TestReadSequences(t *testing.T) {
+	long := strings.Repeat("ACGTN", 500000) // Unwrapped, longer than the read buffer
+	fasta := ">chr1 desc\r\nacgt\r\nAC\n\n>chr2\n" + long + "\n>empty\n>chr3\nGG"
+	dir := t.TempDir()
+
+	plain := filepath.Join(dir, "plain.fa")
+	os.WriteFile(plain, []byte(fasta), 0644)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(fasta))
+	zw.Close()
+	gzipped := filepath.Join(dir, "plain.fa.gz")
+	os.WriteFile(gzipped, gz.Bytes(), 0644)
+
+	var bgz bytes.Buffer
+	bw := bgzf.NewWriter(&bgz)
+	bw.Write([]byte(fasta))
+	bw.Close()
+	bgzipped := filepath.Join(dir, "bgzip.fa.gz")
+	os.WriteFile(bgzipped, bgz.Bytes(), 0644)
+
+	want := []string{"chr1=acgtAC", "chr2=" + long, "empty=", "chr3=GG"}
+	for _, path := range []string{plain, gzipped, bgzipped} {
+		var got []string
+		err := ReadSequences(path, func(name string, seq []byte) error {
+			got = append(got, name+"="+string(seq))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: got %d records %.40q", path, len(got), got)
+		}
+	}
+
+	if err := ScanSequences(strings.NewReader("ACGT\n>chr1\nA\n"), func(string, []byte) error { return nil }); err == nil {
+		t.Error("Expected error for sequence before the first header")
+	}
+}
@@ -0,0 +1,101 @@
+/**
+ * Sequential FASTA Reading
+ *
+ * Streams every record of a plain, gzip or bgzip FASTA file in order,
+ * holding one sequence in memory at a time. Used to build whole-genome
+ * indexes, where random access through a .fai is not needed.
+ */
+
+package reference
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReadSequences calls fn with the name and bases of each record in the
+// FASTA at path, in file order. seq is only valid during the call. Gzip
+// and bgzip files are decompressed transparently.
+func ReadSequences(path string, fn func(name string, seq []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open FASTA: %w", err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReaderSize(file, 1<<20)
+	var r io.Reader = buffered
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered) // BGZF is multi-member gzip
+		if err != nil {
+			return fmt.Errorf("failed to open gzipped FASTA: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	return ScanSequences(r, fn)
+}
+
+// ScanSequences is ReadSequences over an uncompressed FASTA stream
+func ScanSequences(r io.Reader, fn func(name string, seq []byte) error) error {
+	reader := bufio.NewReaderSize(r, 1<<20)
+	var name string
+	var seq []byte
+	started := false
+	lineNum := 0
+
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Unwrapped sequence: keep appending until the newline
+			if !started || line[0] == '>' {
+				return fmt.Errorf("line %d: header line too long", lineNum+1)
+			}
+			seq = append(seq, line...)
+			continue
+		}
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to read FASTA: %w", err)
+		}
+		lineNum++
+
+		content := bytes.TrimSpace(line)
+		switch {
+		case len(content) == 0:
+		case content[0] == '>':
+			if started {
+				if err := fn(name, seq); err != nil {
+					return err
+				}
+			}
+			fields := bytes.Fields(content[1:])
+			if len(fields) == 0 {
+				return fmt.Errorf("line %d: sequence without a name", lineNum)
+			}
+			name = string(fields[0])
+			seq = seq[:0]
+			started = true
+		case !started:
+			return fmt.Errorf("line %d: sequence data before the first header", lineNum)
+		default:
+			seq = append(seq, content...)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if !started {
+		return nil
+	}
+	return fn(name, seq)
+}
@@ -0,0 +1,653 @@
+/**
+ * Clonal Evolution Builder
+ *
+ * Builds an evolution timeline from real multi-timepoint (or multi-region)
+ * tumour VCFs instead of GenerateCancerEvolution's simulated one:
+ *
+ * 1. Collect alt/total read counts per mutation and tumour sample (FORMAT
+ *    AD, or AF with DP). Mutations not called in a sample count as absent.
+ * 2. Convert to cancer cell fractions, CCF = 2 × VAF / purity (heterozygous,
+ *    diploid), and cluster mutations into clones with a binomial mixture
+ *    model fitted by EM; the number of clones is chosen by BIC.
+ * 3. Infer a clone tree under the standard ordering constraints: a child's
+ *    CCF never exceeds its parent's in any sample (crossing rule) and
+ *    siblings' CCFs sum to at most their parent's (sum rule).
+ * 4. Emit TemporalMutations: each clone emerges just before the first sample
+ *    it is detected in, ancestors before descendants, drivers first.
+ */
+
+package trails
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"genomevedic/internal/mutations"
+)
+
+const (
+	cloneDetectionCCF = 0.05 // CCF above which a clone counts as present
+	treeTolerance     = 0.10 // CCF slack allowed by the ordering rules
+	pseudoDepth       = 100  // Read depth assumed when only AF is known
+	maxClones         = 10
+)
+
+// DefaultDriverGenes are frequently mutated cancer driver genes used when
+// no driver list is given
+var DefaultDriverGenes = []string{
+	"TP53", "KRAS", "NRAS", "HRAS", "BRAF", "PIK3CA", "PTEN", "APC", "EGFR",
+	"ERBB2", "IDH1", "IDH2", "CTNNB1", "SMAD4", "CDKN2A", "RB1", "NOTCH1",
+	"FBXW7", "ARID1A", "KMT2D", "NF1", "ATM", "BRCA1", "BRCA2", "VHL",
+	"MYC", "ESR1", "AR", "KIT", "PDGFRA", "ALK", "MET", "RET", "FGFR3",
+}
+
+// TumourSample is one timepoint or region of a patient's tumour
+type TumourSample struct {
+	Name   string         // VCF sample column (or label for AddSampleVCF)
+	Time   float32        // Collection time; orders the samples
+	Stage  EvolutionStage // StageNormal (zero value) means StagePrimary
+	Purity float64        // Tumour cell fraction; 0 means 1.0
+}
+
+// Clone is a cluster of mutations sharing a cancer cell fraction profile
+type Clone struct {
+	ID        int
+	Parent    int // -1 for the founding (truncal) clone
+	Children  []int
+	CCF       []float64 // Per sample, in builder sample order
+	Mutations []*mutations.Mutation
+	Drivers   []string // Driver genes mutated in this clone
+	FirstSeen int      // Index of the first sample the clone is detected in
+	Emergence float32  // Timeline time of the clone's first mutation
+	Stage     EvolutionStage
+}
+
+// CloneTree is the inferred clonal phylogeny
+type CloneTree struct {
+	Samples    []TumourSample
+	Clones     []*Clone
+	Root       int
+	Violations []string // Ordering constraints that could not be satisfied
+}
+
+// trackedVariant holds read counts of one mutation across samples
+type trackedVariant struct {
+	mutation *mutations.Mutation
+	alt      []float64
+	depth    []float64
+	called   []bool
+}
+
+// EvolutionBuilder accumulates tumour sample VCFs and builds the timeline
+type EvolutionBuilder struct {
+	samples  []TumourSample
+	variants map[string]*trackedVariant
+	order    []string
+	drivers  map[string]bool
+	seed     int64
+}
+
+// NewEvolutionBuilder creates a builder for the given tumour samples
+func NewEvolutionBuilder(samples []TumourSample) *EvolutionBuilder {
+	sorted := append([]TumourSample(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time < sorted[j].Time })
+	for i := range sorted {
+		if sorted[i].Purity <= 0 || sorted[i].Purity > 1 {
+			sorted[i].Purity = 1
+		}
+		if sorted[i].Stage == StageNormal {
+			sorted[i].Stage = StagePrimary
+		}
+	}
+
+	eb := &EvolutionBuilder{
+		samples:  sorted,
+		variants: make(map[string]*trackedVariant),
+		seed:     1,
+	}
+	eb.SetDriverGenes(DefaultDriverGenes)
+	return eb
+}
+
+// SetDriverGenes replaces the genes whose protein-altering mutations are
+// flagged as drivers
+func (eb *EvolutionBuilder) SetDriverGenes(genes []string) {
+	eb.drivers = make(map[string]bool, len(genes))
+	for _, gene := range genes {
+		eb.drivers[strings.ToUpper(gene)] = true
+	}
+}
+
+// AddVCF reads a multi-sample VCF whose sample columns are named like the
+// builder's tumour samples (other columns, such as the matched normal, are
+// ignored)
+func (eb *EvolutionBuilder) AddVCF(vr *mutations.VCFReader) error {
+	columns := make(map[int]int)
+	for column, name := range vr.Header().Samples {
+		for i, sample := range eb.samples {
+			if sample.Name == name {
+				columns[column] = i
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("no VCF sample column matches a tumour sample")
+	}
+	return eb.read(vr, columns)
+}
+
+// AddSampleVCF reads a per-timepoint VCF, assigning its tumour column to the
+// named sample. The column is the one named like the sample, else "TUMOR",
+// else the only or last column.
+func (eb *EvolutionBuilder) AddSampleVCF(sample string, vr *mutations.VCFReader) error {
+	index := -1
+	for i, s := range eb.samples {
+		if s.Name == sample {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("unknown tumour sample: %s", sample)
+	}
+
+	names := vr.Header().Samples
+	if len(names) == 0 {
+		return fmt.Errorf("VCF for %s has no sample columns", sample)
+	}
+	column := len(names) - 1
+	for i, name := range names {
+		if name == sample || strings.EqualFold(name, "TUMOR") {
+			column = i
+			break
+		}
+	}
+	return eb.read(vr, map[int]int{column: index})
+}
+
+// read collects read counts from PASS records for the mapped columns
+func (eb *EvolutionBuilder) read(vr *mutations.VCFReader, columns map[int]int) error {
+	for {
+		record, err := vr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read VCF record: %w", err)
+		}
+		if !record.Passed() {
+			continue
+		}
+
+		// Mutations skips the same ALTs, so the two stay aligned
+		recordMutations := record.Mutations()
+		next := 0
+		for altIndex, alt := range record.Alts {
+			alt = strings.ToUpper(alt)
+			if alt == "*" || alt == "<*>" || alt == "<NON_REF>" {
+				continue
+			}
+			m := recordMutations[next]
+			next++
+			if mutations.IsSymbolicAllele(alt) {
+				continue
+			}
+
+			key := fmt.Sprintf("%s:%d:%s>%s", strings.TrimPrefix(m.Chromosome, "chr"), m.Position, m.RefAllele, m.AltAllele)
+			tv, ok := eb.variants[key]
+			if !ok {
+				n := len(eb.samples)
+				tv = &trackedVariant{mutation: m, alt: make([]float64, n), depth: make([]float64, n), called: make([]bool, n)}
+				eb.variants[key] = tv
+				eb.order = append(eb.order, key)
+			}
+
+			for column, sample := range columns {
+				alt, depth, ok := readCounts(record, column, altIndex)
+				if !ok {
+					continue
+				}
+				tv.alt[sample], tv.depth[sample], tv.called[sample] = alt, depth, true
+			}
+		}
+	}
+}
+
+// readCounts returns alt and total read counts of an ALT in one sample
+func readCounts(record *mutations.VCFRecord, sample, altIndex int) (float64, float64, bool) {
+	if sample >= len(record.Genotypes) {
+		return 0, 0, false
+	}
+	fields := record.Genotypes[sample].Fields
+
+	if ad, ok := fields["AD"]; ok {
+		depths := strings.Split(ad, ",")
+		total, alt := 0.0, -1.0
+		for i, d := range depths {
+			v, err := strconv.ParseFloat(d, 64)
+			if err != nil {
+				continue
+			}
+			total += v
+			if i == altIndex+1 {
+				alt = v
+			}
+		}
+		if alt >= 0 && total > 0 {
+			return alt, total, true
+		}
+	}
+
+	vaf, ok := record.AlleleFraction(sample, altIndex)
+	if !ok {
+		return 0, 0, false
+	}
+	depth := float64(pseudoDepth)
+	if dp, err := strconv.ParseFloat(fields["DP"], 64); err == nil && dp > 0 {
+		depth = dp
+	}
+	return vaf * depth, depth, true
+}
+
+// Build clusters mutations into clones, infers the clone tree and returns
+// the timeline
+func (eb *EvolutionBuilder) Build() (*CloneTree, []*TemporalMutation, error) {
+	if len(eb.samples) == 0 {
+		return nil, nil, fmt.Errorf("no tumour samples")
+	}
+
+	// Keep mutations detected in at least one sample
+	var variants []*trackedVariant
+	for _, key := range eb.order {
+		tv := eb.variants[key]
+		for s := range eb.samples {
+			if tv.called[s] && tv.alt[s] > 0 {
+				variants = append(variants, tv)
+				break
+			}
+		}
+	}
+	if len(variants) == 0 {
+		return nil, nil, fmt.Errorf("no mutations with allele frequencies")
+	}
+
+	// Uncalled samples: absent, at the median depth seen for the mutation
+	for _, tv := range variants {
+		depth := medianDepth(tv)
+		for s := range eb.samples {
+			if !tv.called[s] {
+				tv.alt[s], tv.depth[s] = 0, depth
+			}
+		}
+	}
+
+	assignments, ccf := eb.cluster(variants)
+	tree := eb.buildTree(variants, assignments, ccf)
+	timeline := eb.timeline(tree)
+	return tree, timeline, nil
+}
+
+// medianDepth returns the median depth of a variant's called samples
+func medianDepth(tv *trackedVariant) float64 {
+	var depths []float64
+	for s, called := range tv.called {
+		if called {
+			depths = append(depths, tv.depth[s])
+		}
+	}
+	if len(depths) == 0 {
+		return pseudoDepth
+	}
+	sort.Float64s(depths)
+	return depths[len(depths)/2]
+}
+
+// cluster fits binomial mixtures with 1..maxClones components and keeps the
+// one with the lowest BIC. Returns each variant's cluster and each
+// cluster's per-sample CCF.
+func (eb *EvolutionBuilder) cluster(variants []*trackedVariant) ([]int, [][]float64) {
+	n, samples := len(variants), len(eb.samples)
+	rng := rand.New(rand.NewSource(eb.seed))
+
+	var bestAssign []int
+	var bestCCF [][]float64
+	bestBIC := math.Inf(1)
+	for k := 1; k <= min(maxClones, n); k++ {
+		assign, ccf, logLikelihood := eb.fitMixture(variants, k, rng)
+		parameters := float64(k*samples + k - 1)
+		bic := -2*logLikelihood + parameters*math.Log(float64(n))
+		if bic < bestBIC {
+			bestBIC, bestAssign, bestCCF = bic, assign, ccf
+		}
+	}
+
+	// Drop empty clusters and renumber
+	used := make(map[int]int)
+	var ccf [][]float64
+	for i, c := range bestAssign {
+		id, ok := used[c]
+		if !ok {
+			id = len(ccf)
+			used[c] = id
+			ccf = append(ccf, bestCCF[c])
+		}
+		bestAssign[i] = id
+	}
+	return bestAssign, ccf
+}
+
+// fitMixture runs EM for a k-component binomial mixture over CCFs
+func (eb *EvolutionBuilder) fitMixture(variants []*trackedVariant, k int, rng *rand.Rand) ([]int, [][]float64, float64) {
+	n, samples := len(variants), len(eb.samples)
+	const epsilon = 1e-9
+
+	observed := make([][]float64, n)
+	for i, tv := range variants {
+		observed[i] = make([]float64, samples)
+		for s := range eb.samples {
+			observed[i][s] = eb.cellFraction(tv, s)
+		}
+	}
+
+	// k-means++ style initialisation on observed CCFs
+	centres := [][]float64{append([]float64(nil), observed[rng.Intn(n)]...)}
+	for len(centres) < k {
+		distances := make([]float64, n)
+		total := 0.0
+		for i := range observed {
+			distances[i] = math.Inf(1)
+			for _, centre := range centres {
+				distances[i] = math.Min(distances[i], squaredDistance(observed[i], centre))
+			}
+			total += distances[i]
+		}
+		pick := rng.Float64() * total
+		chosen := n - 1
+		for i, d := range distances {
+			if pick -= d; pick <= 0 {
+				chosen = i
+				break
+			}
+		}
+		centres = append(centres, append([]float64(nil), observed[chosen]...))
+	}
+
+	weights := make([]float64, k)
+	for c := range weights {
+		weights[c] = 1 / float64(k)
+	}
+	responsibilities := make([][]float64, n)
+	for i := range responsibilities {
+		responsibilities[i] = make([]float64, k)
+	}
+
+	logLikelihood := math.Inf(-1)
+	for iteration := 0; iteration < 200; iteration++ {
+		// E step
+		current := 0.0
+		for i, tv := range variants {
+			logs := make([]float64, k)
+			maxLog := math.Inf(-1)
+			for c := 0; c < k; c++ {
+				logs[c] = math.Log(weights[c] + epsilon)
+				for s := range eb.samples {
+					p := centres[c][s] * eb.samples[s].Purity / 2
+					logs[c] += binomialLogPMF(tv.alt[s], tv.depth[s], p)
+				}
+				maxLog = math.Max(maxLog, logs[c])
+			}
+			sum := 0.0
+			for c := range logs {
+				responsibilities[i][c] = math.Exp(logs[c] - maxLog)
+				sum += responsibilities[i][c]
+			}
+			for c := range logs {
+				responsibilities[i][c] /= sum
+			}
+			current += maxLog + math.Log(sum)
+		}
+
+		// M step
+		for c := 0; c < k; c++ {
+			total := 0.0
+			for i := range variants {
+				total += responsibilities[i][c]
+			}
+			weights[c] = total / float64(n)
+			for s := range eb.samples {
+				alt, depth := 0.0, 0.0
+				for i, tv := range variants {
+					alt += responsibilities[i][c] * tv.alt[s]
+					depth += responsibilities[i][c] * tv.depth[s]
+				}
+				if depth > 0 {
+					centres[c][s] = math.Min(2*alt/depth/eb.samples[s].Purity, 1)
+				}
+			}
+		}
+
+		if current-logLikelihood < 1e-6*math.Abs(current) {
+			logLikelihood = current
+			break
+		}
+		logLikelihood = current
+	}
+
+	assign := make([]int, n)
+	for i := range variants {
+		for c := 1; c < k; c++ {
+			if responsibilities[i][c] > responsibilities[i][assign[i]] {
+				assign[i] = c
+			}
+		}
+	}
+	return assign, centres, logLikelihood
+}
+
+// cellFraction returns a variant's observed CCF in a sample
+func (eb *EvolutionBuilder) cellFraction(tv *trackedVariant, sample int) float64 {
+	if tv.depth[sample] == 0 {
+		return 0
+	}
+	return math.Min(2*tv.alt[sample]/tv.depth[sample]/eb.samples[sample].Purity, 1)
+}
+
+// binomialLogPMF returns log P(alt | depth, p) for possibly fractional counts
+func binomialLogPMF(alt, depth, p float64) float64 {
+	p = math.Min(math.Max(p, 1e-4), 1-1e-4)
+	lgDepth, _ := math.Lgamma(depth + 1)
+	lgAlt, _ := math.Lgamma(alt + 1)
+	lgRef, _ := math.Lgamma(depth - alt + 1)
+	return lgDepth - lgAlt - lgRef + alt*math.Log(p) + (depth-alt)*math.Log1p(-p)
+}
+
+func squaredDistance(a, b []float64) float64 {
+	d := 0.0
+	for i := range a {
+		d += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return d
+}
+
+// buildTree places clones, largest first, under the deepest already-placed
+// clone that satisfies the crossing and sum rules in every sample
+func (eb *EvolutionBuilder) buildTree(variants []*trackedVariant, assignments []int, ccf [][]float64) *CloneTree {
+	tree := &CloneTree{Samples: eb.samples}
+	for id := range ccf {
+		tree.Clones = append(tree.Clones, &Clone{ID: id, Parent: -1, CCF: ccf[id], FirstSeen: -1})
+	}
+	for i, tv := range variants {
+		clone := tree.Clones[assignments[i]]
+		clone.Mutations = append(clone.Mutations, tv.mutation)
+		if eb.isDriver(tv.mutation) && !containsString(clone.Drivers, tv.mutation.Gene) {
+			clone.Drivers = append(clone.Drivers, tv.mutation.Gene)
+		}
+	}
+
+	total := func(c *Clone) float64 {
+		sum := 0.0
+		for _, v := range c.CCF {
+			sum += v
+		}
+		return sum
+	}
+	order := make([]*Clone, len(tree.Clones))
+	copy(order, tree.Clones)
+	sort.SliceStable(order, func(i, j int) bool { return total(order[i]) > total(order[j]) })
+
+	tree.Root = order[0].ID
+	remaining := make(map[int][]float64) // Unclaimed CCF per placed clone
+	remaining[tree.Root] = append([]float64(nil), order[0].CCF...)
+	depth := map[int]int{tree.Root: 0}
+
+	for _, child := range order[1:] {
+		parent := -1
+		for _, candidate := range order {
+			capacity, placed := remaining[candidate.ID]
+			if !placed || candidate.ID == child.ID {
+				continue
+			}
+			fits := true
+			for s, v := range child.CCF {
+				if v > candidate.CCF[s]+treeTolerance || v > capacity[s]+treeTolerance {
+					fits = false
+					break
+				}
+			}
+			if fits && (parent < 0 || depth[candidate.ID] > depth[parent]) {
+				parent = candidate.ID
+			}
+		}
+		if parent < 0 {
+			parent = tree.Root
+			tree.Violations = append(tree.Violations,
+				fmt.Sprintf("clone %d fits under no clone; attached to the founding clone", child.ID))
+		}
+
+		child.Parent = parent
+		tree.Clones[parent].Children = append(tree.Clones[parent].Children, child.ID)
+		// Siblings may exceed the parent by up to the tolerance (or more for
+		// a clone that fits nowhere); claimed CCF never goes below zero
+		for s, v := range child.CCF {
+			remaining[parent][s] -= v
+			if over := -remaining[parent][s]; over > 0 {
+				if over > treeTolerance {
+					tree.Violations = append(tree.Violations,
+						fmt.Sprintf("children of clone %d exceed its CCF by %.2f in %s", parent, over, eb.samples[s].Name))
+				}
+				remaining[parent][s] = 0
+			}
+		}
+		remaining[child.ID] = append([]float64(nil), child.CCF...)
+		depth[child.ID] = depth[parent] + 1
+	}
+
+	// First detection and stage; descendants never precede ancestors
+	for _, clone := range order {
+		for s, v := range clone.CCF {
+			if v >= cloneDetectionCCF {
+				clone.FirstSeen = s
+				break
+			}
+		}
+		if clone.FirstSeen < 0 {
+			clone.FirstSeen = len(eb.samples) - 1
+		}
+		if clone.Parent >= 0 {
+			clone.FirstSeen = max(clone.FirstSeen, tree.Clones[clone.Parent].FirstSeen)
+		}
+		clone.Stage = eb.samples[clone.FirstSeen].Stage
+	}
+	return tree
+}
+
+// isDriver reports whether a mutation is a protein-altering change in a
+// driver gene or is classified (likely) pathogenic
+func (eb *EvolutionBuilder) isDriver(m *mutations.Mutation) bool {
+	if m.Significance == mutations.SignificancePathogenic || m.Significance == mutations.SignificanceLikelyPathogenic {
+		return true
+	}
+	if !eb.drivers[strings.ToUpper(m.Gene)] {
+		return false
+	}
+	switch m.MutationType {
+	case mutations.MutationSynonymous, mutations.MutationUTR, mutations.MutationIntronic, mutations.MutationIntergenic:
+		return false
+	}
+	return true
+}
+
+// timeline emits one TemporalMutation per mutation. Clones first seen in
+// sample k emerge in the interval before sample k's time, split into slots
+// by tree depth; within a clone, drivers come first.
+func (eb *EvolutionBuilder) timeline(tree *CloneTree) []*TemporalMutation {
+	depths := make([]int, len(tree.Clones))
+	for _, clone := range tree.Clones {
+		for p := clone.Parent; p >= 0; p = tree.Clones[p].Parent {
+			depths[clone.ID]++
+		}
+	}
+
+	// Group clones by first detection, ancestors first
+	bySample := make(map[int][]*Clone)
+	for _, clone := range tree.Clones {
+		bySample[clone.FirstSeen] = append(bySample[clone.FirstSeen], clone)
+	}
+
+	palette := mutations.SignaturePalette(len(tree.Clones))
+	var timeline []*TemporalMutation
+	for s := range eb.samples {
+		clones := bySample[s]
+		if len(clones) == 0 {
+			continue
+		}
+		sort.SliceStable(clones, func(i, j int) bool { return depths[clones[i].ID] < depths[clones[j].ID] })
+
+		end := eb.samples[s].Time
+		start := end - 1
+		if s > 0 {
+			start = eb.samples[s-1].Time
+		}
+		slot := (end - start) / float32(len(clones))
+
+		for rank, clone := range clones {
+			clone.Emergence = start + float32(rank)*slot
+
+			ordered := append([]*mutations.Mutation(nil), clone.Mutations...)
+			sort.SliceStable(ordered, func(i, j int) bool {
+				return eb.isDriver(ordered[i]) && !eb.isDriver(ordered[j])
+			})
+			for i, m := range ordered {
+				driver := eb.isDriver(m)
+				c := palette[clone.ID]
+				color := [4]float32{c.R, c.G, c.B, c.A}
+				if !driver {
+					color[3] = 0.6
+				}
+				timeline = append(timeline, &TemporalMutation{
+					Chromosome: m.Chromosome,
+					Position:   m.Position,
+					Timepoint:  clone.Emergence + slot*0.9*float32(i)/float32(len(ordered)),
+					Stage:      clone.Stage,
+					Color:      color,
+					IsDriver:   driver,
+					Clone:      clone.ID,
+				})
+			}
+		}
+	}
+	return timeline
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
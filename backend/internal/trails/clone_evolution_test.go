@@ -0,0 +1,161 @@
+package trails
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"genomevedic/internal/mutations"
+)
+
+// syntheticClone plants mutations at a CCF profile across the samples
+type syntheticClone struct {
+	parent int
+	ccf    []float64
+}
+
+// TestCloneRecovery simulates read counts from a known four-clone tree over
+// three timepoints and recovers the clones, their CCFs and the tree
+func TestCloneRecovery(t *testing.T) {
+	clones := []syntheticClone{
+		{-1, []float64{1.0, 1.0, 1.0}}, // Trunk
+		{0, []float64{0.6, 0.8, 0.25}}, // Expands, then declines
+		{0, []float64{0.0, 0.15, 0.7}}, // Emerges late
+		{1, []float64{0.3, 0.5, 0.1}},  // Nested in clone 1
+	}
+	const perClone, depth = 25, 300
+
+	rng := rand.New(rand.NewSource(7))
+	var sb strings.Builder
+	sb.WriteString("##fileformat=VCFv4.2\n" +
+		"##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">\n" +
+		"##FORMAT=<ID=AD,Number=R,Type=Integer,Description=\"Allelic depths\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tnormal\tt0\tt1\tt2\n")
+	truth := make(map[uint64]int)
+	for c, clone := range clones {
+		for m := 0; m < perClone; m++ {
+			position := uint64(1000000*(c+1) + 100*m)
+			truth[position] = c
+			fmt.Fprintf(&sb, "chr1\t%d\t.\tC\tT\t.\tPASS\t.\tGT:AD\t0/0:%d,0", position, depth)
+			for _, ccf := range clone.ccf {
+				alt := 0
+				for r := 0; r < depth; r++ {
+					if rng.Float64() < ccf/2 {
+						alt++
+					}
+				}
+				fmt.Fprintf(&sb, "\t0/1:%d,%d", depth-alt, alt)
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	builder := NewEvolutionBuilder([]TumourSample{
+		{Name: "t2", Time: 3, Stage: StageMetastasis},
+		{Name: "t0", Time: 1},
+		{Name: "t1", Time: 2},
+	})
+	reader, err := mutations.NewVCFReader(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddVCF(reader); err != nil {
+		t.Fatal(err)
+	}
+	tree, timeline, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tree.Clones) != len(clones) {
+		t.Fatalf("Recovered %d clones, want %d", len(tree.Clones), len(clones))
+	}
+	if len(tree.Violations) != 0 {
+		t.Errorf("Unexpected violations %v", tree.Violations)
+	}
+
+	// Map recovered clones to planted ones by their mutations
+	recovered := make([]int, len(clones))
+	for _, clone := range tree.Clones {
+		planted := truth[clone.Mutations[0].Position]
+		for _, m := range clone.Mutations {
+			if truth[m.Position] != planted {
+				t.Errorf("Clone %d mixes mutations of planted clones %d and %d", clone.ID, planted, truth[m.Position])
+			}
+		}
+		if len(clone.Mutations) != perClone {
+			t.Errorf("Clone %d has %d mutations, want %d", clone.ID, len(clone.Mutations), perClone)
+		}
+		recovered[planted] = clone.ID
+	}
+
+	for c, planted := range clones {
+		clone := tree.Clones[recovered[c]]
+		for s, want := range planted.ccf {
+			if math.Abs(clone.CCF[s]-want) > 0.08 {
+				t.Errorf("Clone %d CCF in sample %d = %.3f, want %.2f", c, s, clone.CCF[s], want)
+			}
+		}
+		wantParent := -1
+		if planted.parent >= 0 {
+			wantParent = recovered[planted.parent]
+		}
+		if clone.Parent != wantParent {
+			t.Errorf("Clone %d has parent %d, want %d", c, clone.Parent, wantParent)
+		}
+	}
+	if tree.Root != recovered[0] {
+		t.Errorf("Root is clone %d, want the trunk %d", tree.Root, recovered[0])
+	}
+
+	// Samples are ordered by time; the late clone appears with t1
+	if tree.Samples[0].Name != "t0" || tree.Clones[recovered[2]].FirstSeen != 1 || tree.Clones[recovered[0]].FirstSeen != 0 {
+		t.Errorf("Unexpected first detection: %v, trunk %d, late %d", tree.Samples,
+			tree.Clones[recovered[0]].FirstSeen, tree.Clones[recovered[2]].FirstSeen)
+	}
+
+	if len(timeline) != len(clones)*perClone {
+		t.Fatalf("Timeline has %d mutations, want %d", len(timeline), len(clones)*perClone)
+	}
+	emergence := make(map[int]float32)
+	for _, tm := range timeline {
+		if first, ok := emergence[tm.Clone]; !ok || tm.Timepoint < first {
+			emergence[tm.Clone] = tm.Timepoint
+		}
+	}
+	for c, planted := range clones {
+		if planted.parent >= 0 && emergence[recovered[c]] <= emergence[recovered[planted.parent]] {
+			t.Errorf("Clone %d emerges at %.2f, not after its parent at %.2f", c,
+				emergence[recovered[c]], emergence[recovered[planted.parent]])
+		}
+	}
+}
+
+// TestCloneTreeSumRule reports clones whose CCF exceeds what their parent
+// has left
+func TestCloneTreeSumRule(t *testing.T) {
+	builder := NewEvolutionBuilder([]TumourSample{{Name: "a", Time: 1}, {Name: "b", Time: 2}})
+	tree := builder.buildTree(nil, nil, [][]float64{
+		{1.0, 1.0},
+		{0.8, 0.3},
+		{0.2, 0.7},   // Claims the rest of the trunk
+		{0.4, 0.45},  // Fits under neither sibling nor the claimed trunk
+		{0.05, 0.05}, // Fits under clone 1
+	})
+
+	for id, want := range []int{-1, 0, 0, 0, 1} {
+		if tree.Clones[id].Parent != want {
+			t.Errorf("Clone %d has parent %d, want %d", id, tree.Clones[id].Parent, want)
+		}
+	}
+	want := []string{
+		"clone 3 fits under no clone; attached to the founding clone",
+		"children of clone 0 exceed its CCF by 0.40 in a",
+		"children of clone 0 exceed its CCF by 0.45 in b",
+	}
+	if strings.Join(tree.Violations, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Violations %q, want %q", tree.Violations, want)
+	}
+}
@@ -13,6 +13,7 @@ package trails
 
 import (
 	"math"
+	"sort"
 	"sync"
 )
 
@@ -91,6 +92,17 @@ func (ea *EvolutionAnimation) AddMutation(mutation *TemporalMutation) {
 	ea.sortMutations()
 }
 
+// AddMutations adds a whole timeline (e.g. from EvolutionBuilder), sorting once
+func (ea *EvolutionAnimation) AddMutations(mutations []*TemporalMutation) {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+
+	ea.mutations = append(ea.mutations, mutations...)
+	sort.SliceStable(ea.mutations, func(i, j int) bool {
+		return ea.mutations[i].Timepoint < ea.mutations[j].Timepoint
+	})
+}
+
 // sortMutations sorts mutations by timepoint (earliest first)
 func (ea *EvolutionAnimation) sortMutations() {
 	// Simple bubble sort (small arrays)
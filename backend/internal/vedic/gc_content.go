@@ -6,7 +6,7 @@ import (
 	"math"
 	"strings"
 
-	"genomevedic/backend/pkg/types"
+	"genomevedic/pkg/types"
 )
 
 // GCContentColor computes color based on GC content (golden ratio hue mapping)
@@ -4,7 +4,7 @@ package vedic
 import (
 	"image/color"
 
-	"genomevedic/backend/pkg/types"
+	"genomevedic/pkg/types"
 )
 
 // MutationFrequencyColor maps mutation frequency to color